@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/bugVanisher/streamer/discovery"
+	"github.com/spf13/cobra"
+)
+
+var discoverCmd = &cobra.Command{
+	Use:   "discover",
+	Short: "List streamer instances advertised over mDNS/DNS-SD (_streamer._tcp) on the local network",
+	RunE: func(cmd *cobra.Command, args []string) (err error) {
+		list, err := discovery.Discover(context.Background(), disc.group, disc.wait)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tHOST\tADDR\tVERSION\tENDPOINTS\tSTREAMS")
+		for _, a := range list {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", a.Name, a.Host, a.Addr, a.Version,
+				strings.Join(a.Endpoints, ","), strings.Join(a.Streams, ","))
+		}
+		return w.Flush()
+	},
+}
+
+type discoverArgs struct {
+	group string
+	wait  time.Duration
+}
+
+var disc discoverArgs
+
+func init() {
+	rootCmd.AddCommand(discoverCmd)
+
+	discoverCmd.Flags().StringVar(&disc.group, "group", discovery.DefaultGroup, "mDNS address to query, a unicast host:port queries that advertiser directly")
+	discoverCmd.Flags().DurationVar(&disc.wait, "wait", 2*time.Second, "how long to collect answers")
+}
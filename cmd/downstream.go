@@ -1,23 +1,45 @@
 package cmd
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/bugVanisher/streamer/common/output"
 	"github.com/bugVanisher/streamer/downstream"
+	"github.com/bugVanisher/streamer/media/av/avutil"
+	"github.com/bugVanisher/streamer/media/av/pktque"
+	"github.com/bugVanisher/streamer/media/protocol/hls"
+	"github.com/bugVanisher/streamer/statistics"
+	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
 	"io"
 	"os"
+	"path/filepath"
+	"time"
 )
 
 var downstreamCmd = &cobra.Command{
 	Use:   "pull",
 	Short: "Streaming downstream",
 	RunE: func(cmd *cobra.Command, args []string) (err error) {
+		if dryRun {
+			return runDryRun(func(ctx context.Context) (avutil.GOPReport, error) {
+				return downstream.DryRun(ctx, down.pUrl)
+			})
+		}
 		var writer io.Writer
 		if down.outFile != "" {
-			file, err := os.OpenFile(down.outFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+			path := down.outFile
+			// 显式指定--output-dir时, 相对路径放到录制目录下
+			if f := cmd.Flag("output-dir"); f != nil && f.Changed && !filepath.IsAbs(path) {
+				path = output.Path(output.KindRecord, path)
+			}
+			// 录制文件只在关键帧处滚动, 见downstream.newRecordMuxer
+			file, err := output.OpenManualFile(path, out.Rotation)
 			if err != nil {
 				return err
 			}
-			defer func(file *os.File) {
+			defer func(file *output.File) {
 				err := file.Close()
 				if err != nil {
 
@@ -27,15 +49,38 @@ var downstreamCmd = &cobra.Command{
 		} else {
 			writer = io.Discard
 		}
+		ext := filepath.Ext(down.outFile)
 		down := downstream.NewFlvDownStreamer(down.pUrl, writer)
+		// .h264/.265/.aac写成elementary stream, 其他扩展名原样写flv
+		if ext != ".flv" {
+			down.NewMuxer = avutil.DefaultHandlers.WriterMuxer(ext)
+		}
+		setupDiscontinuity(down)
+		setupLoopDetector(down)
+		setupSegmenter(down)
+		if err = setupAlerter(down); err != nil {
+			return err
+		}
 
-		return downstream.Launch("download", down, duration)
+		err = downstream.Launch("download", down, duration)
+		if down.Segmenter != nil {
+			writeSegmentReport(down.Segmenter.Report())
+		}
+		return err
 	},
 }
 
 type downstreamArgs struct {
 	pUrl    string
 	outFile string
+
+	alerts       []string
+	alertWebhook string
+	tsJump       time.Duration
+	detectLoop   bool
+	hlsSegment   time.Duration
+	hlsTolerance time.Duration
+	hlsCaptions  bool
 }
 
 var down downstreamArgs
@@ -45,5 +90,100 @@ func init() {
 
 	downstreamCmd.Flags().StringVarP(&down.pUrl, "url", "u", "", "Downstream URL")
 	downstreamCmd.MarkFlagRequired("url")
-	downstreamCmd.Flags().StringVarP(&down.outFile, "file", "f", "", "File to save")
+	downstreamCmd.Flags().StringVarP(&down.outFile, "file", "f", "", "File to save, relative to <output-dir>/record when --output-dir is set; rotated at keyframes by --rotate-size/--rotate-interval. "+
+		".h264/.265/.aac save the elementary stream (annexb/adts) instead of flv")
+	downstreamCmd.Flags().StringArrayVar(&down.alerts, "alert", nil, `alert rule, e.g. "fps<20 for 10s" (metrics: fps, audio_fps, bitrate, delay, drift, gop, health, overhead)`)
+	downstreamCmd.Flags().StringVar(&down.alertWebhook, "alert-webhook", "", "URL to POST alert events to")
+	downstreamCmd.Flags().DurationVar(&down.tsJump, "detect-ts-jump", 0, "log timestamps that go backwards or jump forward more than this, e.g. 1s (0 disables)")
+	downstreamCmd.Flags().BoolVar(&down.detectLoop, "detect-loop", false, "log when the pulled content repeats (e.g. a looped test file) and its loop period")
+	downstreamCmd.Flags().DurationVar(&down.hlsSegment, "hls-segment", 0, "cut the pulled stream into HLS segments of about this duration at key frames and log the GOP that would make them regular, e.g. 4s (0 disables)")
+	downstreamCmd.Flags().DurationVar(&down.hlsTolerance, "hls-tolerance", 500*time.Millisecond, "with --hls-segment, segments whose duration differs from the target by more than this count as violations in the report")
+	downstreamCmd.Flags().BoolVar(&down.hlsCaptions, "hls-captions", false, "with --hls-segment, decode CEA-608 captions (CC1) in H.264 SEI into a WebVTT subtitle track")
+}
+
+// setupDiscontinuity 开启拉流时间戳的连续性检查, 用于观察服务端对推流端注入的时间戳异常的处理
+func setupDiscontinuity(d *downstream.FlvDownStreamer) {
+	if down.tsJump > 0 {
+		d.Discontinuity = &pktque.DiscontinuityDetector{Threshold: down.tsJump}
+	}
+}
+
+// setupLoopDetector 开启循环内容检测, 用于区分真实直播源和循环推的测试内容
+func setupLoopDetector(d *downstream.FlvDownStreamer) {
+	if down.detectLoop {
+		d.LoopDetector = &pktque.LoopDetector{}
+	}
+}
+
+// hlsWindowSegments 拉流切片时TSCache保留的切片数
+const hlsWindowSegments = 6
+
+// setupSegmenter 把拉到的流切成HLS切片, 观察源流GOP长度下的切片时长
+func setupSegmenter(d *downstream.FlvDownStreamer) {
+	if down.hlsSegment <= 0 {
+		return
+	}
+	cache := hls.NewTSCache("pull", "", int(hlsWindowSegments*down.hlsSegment/time.Millisecond))
+	cache.SetSegmentStats(hls.NewSegmentStats(down.hlsSegment, down.hlsTolerance))
+	d.Segmenter = hls.NewSegmenter(cache, "pull", down.hlsSegment)
+	d.Segmenter.Targeter().GOPHint = func(gop time.Duration) {
+		log.Info().Str("url", down.pUrl).Dur("gop", gop).Dur("target", down.hlsSegment).Msg("[hls] suggested source gop")
+	}
+	if down.hlsCaptions {
+		d.ParseSEI = true
+		d.Segmenter.AddCaptionTrack(hls.NewSubtitleTrack("CC1", ""))
+	}
+}
+
+// writeSegmentReport 拉流结束时输出切片统计报告
+func writeSegmentReport(report hls.SegmentReport) {
+	out, _ := json.MarshalIndent(report, "", "  ")
+	fmt.Fprintln(os.Stdout, string(out))
+	if reportToFile {
+		writeReport("hls-segments", out)
+	}
+}
+
+func setupAlerter(d *downstream.FlvDownStreamer) error {
+	rules, err := parseAlertRules(down.alerts)
+	if err != nil || len(rules) == 0 {
+		return err
+	}
+	notify := alertNotifier(down.alertWebhook)
+	d.Alerter = statistics.NewAlerter(down.pUrl, rules, func(e statistics.AlertEvent) {
+		notify("", e)
+	})
+	return nil
+}
+
+// parseAlertRules 解析--alert的规则
+func parseAlertRules(specs []string) ([]statistics.AlertRule, error) {
+	rules := make([]statistics.AlertRule, 0, len(specs))
+	for _, s := range specs {
+		rule, err := statistics.ParseAlertRule(s)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// alertNotifier 告警事件输出到日志, webhook不为空时同时POST到webhook. 每个进程只调用一次,
+// 返回的函数的session为服务端会话ID, 拉流时为空
+func alertNotifier(webhook string) func(session string, e statistics.AlertEvent) {
+	if webhook != "" {
+		hls.InitHook(context.Background())
+	}
+	return func(session string, e statistics.AlertEvent) {
+		ev := log.Warn()
+		if session != "" {
+			ev = ev.Str("session", session)
+		}
+		ev.Str("stream", e.Stream).Str("rule", e.Rule).Float64("value", e.Value).
+			Bool("firing", e.Firing).Msg("alert")
+		if webhook != "" {
+			hls.OnHookEvent(&hls.HookEvent{Url: webhook, Data: e})
+		}
+	}
 }
@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/bugVanisher/streamer/common/output"
+	"github.com/bugVanisher/streamer/common/seed"
+	"github.com/bugVanisher/streamer/media/av/avutil"
+	"github.com/rs/zerolog/log"
+)
+
+// dryRunTimeout dry run的最长耗时
+const dryRunTimeout = 5 * time.Second
+
+var dryRun bool
+
+// runDryRun 执行dry run并输出检查结果, 检查不通过时返回错误
+func runDryRun(run func(ctx context.Context) (avutil.GOPReport, error)) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dryRunTimeout)
+	defer cancel()
+	start := time.Now()
+	report, err := run(ctx)
+	out, _ := json.MarshalIndent(struct {
+		avutil.GOPReport
+		Elapsed string `json:"elapsed"`
+		Seed    int64  `json:"seed"`
+	}{report, time.Since(start).String(), seed.Get()}, "", "  ")
+	fmt.Fprintln(os.Stdout, string(out))
+	if reportToFile {
+		writeReport("dryrun", out)
+	}
+	if err != nil {
+		return err
+	}
+	if !report.OK() {
+		return fmt.Errorf("dry run failed")
+	}
+	return nil
+}
+
+// reportToFile 显式指定--output-dir时, 报告同时写入<output-dir>/report
+var reportToFile bool
+
+// writeReport 把报告写入报告目录, 文件名带时间戳, 失败只记录日志
+func writeReport(name string, content []byte) {
+	f, err := output.Create(output.KindReport, fmt.Sprintf("%s.%s.json", name, time.Now().Format("20060102T150405")))
+	if err != nil {
+		log.Error().Err(err).Msg("create report file failed")
+		return
+	}
+	defer f.Close()
+	if _, err = f.Write(append(content, '\n')); err != nil {
+		log.Error().Err(err).Str("file", f.Name()).Msg("write report failed")
+		return
+	}
+	log.Info().Str("file", f.Name()).Msg("report saved")
+}
+
+func init() {
+	upstream.Flags().BoolVar(&dryRun, "dry-run", false, "connect, send headers and the first GOP, validate and disconnect")
+	downstreamCmd.Flags().BoolVar(&dryRun, "dry-run", false, "connect, read headers and the first GOP, validate and disconnect")
+}
@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/bugVanisher/streamer/pusher"
+	"github.com/spf13/cobra"
+)
+
+var interopCmd = &cobra.Command{
+	Use:   "interop",
+	Short: "Run the same publish+play scenario against several servers and report compatibility",
+	RunE: func(cmd *cobra.Command, args []string) (err error) {
+		var endpoints []pusher.InteropEndpoint
+		for _, e := range ia.endpoints {
+			name, u, ok := strings.Cut(e, "=")
+			if !ok || name == "" || u == "" {
+				return fmt.Errorf("invalid endpoint %q, want name=url", e)
+			}
+			endpoints = append(endpoints, pusher.InteropEndpoint{Name: name, URL: u, PlayURL: ia.playUrls[name]})
+		}
+		reports := pusher.Interop(context.Background(), endpoints, pusher.InteropOptions{
+			File:      ia.sourceFile,
+			HEVCFile:  ia.hevcFile,
+			ChunkSize: ia.chunkSize,
+			RunFor:    ia.runFor,
+		})
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tCOMPLEX HS\tSIMPLE HS\tAUTH\tPUBLISH\tCHUNK\tPEER CHUNK\tHEVC")
+		for _, r := range reports {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%d\t%s\n", r.Name,
+				r.ComplexHandshake.Status, r.SimpleHandshake.Status, r.Auth.Status, r.Publish.Status,
+				fmt.Sprintf("%s(%d)", r.ChunkSizeHonored.Status, r.ChunkSize), r.PeerChunkSize, r.HEVC.Status)
+		}
+		if err = w.Flush(); err != nil {
+			return
+		}
+		out, _ := json.MarshalIndent(reports, "", "  ")
+		fmt.Fprintln(os.Stdout, string(out))
+		if reportToFile {
+			writeReport("interop", out)
+		}
+		return nil
+	},
+}
+
+type interopArgs struct {
+	endpoints  []string
+	playUrls   map[string]string
+	sourceFile string
+	hevcFile   string
+	chunkSize  int
+	runFor     time.Duration
+}
+
+var ia interopArgs
+
+func init() {
+	rootCmd.AddCommand(interopCmd)
+
+	interopCmd.Flags().StringArrayVarP(&ia.endpoints, "endpoint", "e", nil, "server to test as name=rtmp://[user:password@]host/app/stream, repeatable")
+	interopCmd.MarkFlagRequired("endpoint")
+	interopCmd.Flags().StringToStringVar(&ia.playUrls, "play-url", nil, "play URL per endpoint name when it differs from the publish URL")
+	interopCmd.Flags().StringVarP(&ia.sourceFile, "file", "f", "", "H.264 file to publish")
+	interopCmd.MarkFlagRequired("file")
+	interopCmd.Flags().StringVar(&ia.hevcFile, "hevc-file", "", "H.265 file to publish for the HEVC check, skipped when empty")
+	interopCmd.Flags().IntVar(&ia.chunkSize, "chunk-size", pusher.DefaultInteropChunkSize, "chunk size to publish with")
+	interopCmd.Flags().DurationVar(&ia.runFor, "run-for", 5*time.Second, "duration of each publish+play run")
+}
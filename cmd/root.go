@@ -1,6 +1,13 @@
 package cmd
 
 import (
+	"context"
+	"github.com/bugVanisher/streamer/common/fingerprint"
+	"github.com/bugVanisher/streamer/common/output"
+	"github.com/bugVanisher/streamer/common/seed"
+	"github.com/bugVanisher/streamer/discovery"
+	"github.com/bugVanisher/streamer/downstream"
+	"github.com/bugVanisher/streamer/pusher"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"github.com/rs/zerolog/pkgerrors"
@@ -17,8 +24,21 @@ var rootCmd = &cobra.Command{
 	Use:   "streamer",
 	Short: "Stream Push And Pull Tool.",
 	Long:  ``,
-	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
 		initLogger(logLevel, logJSON)
+		output.SetConfig(out)
+		if err := setupFingerprint(); err != nil {
+			return err
+		}
+		sessionSeed = seed.Init(sessionSeed)
+		log.Info().Int64("seed", sessionSeed).Msg("session seed, rerun with --seed to replay")
+		if f := cmd.Flag("output-dir"); f != nil && f.Changed {
+			reportToFile = true
+		}
+		if advertise {
+			startAdvertise(cmd.Name(), cmd.Root().Version)
+		}
+		return nil
 	},
 	Version:          "v1.0.0",
 	TraverseChildren: true, // parses flags on all parents before executing child command
@@ -32,6 +52,20 @@ var (
 	logLevel string
 	logJSON  bool
 	duration time.Duration
+
+	// sessionSeed 所有随机行为的会话种子, 0表示按时间随机选取
+	sessionSeed int64
+
+	advertise      bool
+	advertiseGroup string
+
+	// out debug抓取、录制和报告的输出目录及滚动策略
+	out output.Config
+
+	// client 客户端指纹, headers和cookies在启动时解析
+	client  fingerprint.Config
+	headers []string
+	cookies string
 )
 
 // Execute adds all child commands to the root command and sets flags appropriately.
@@ -40,6 +74,18 @@ func Execute() int {
 	rootCmd.PersistentFlags().StringVarP(&logLevel, "log-level", "l", "INFO", "set log level")
 	rootCmd.PersistentFlags().BoolVar(&logJSON, "log-json", false, "set log to json format (default colorized console)")
 	rootCmd.PersistentFlags().DurationVarP(&duration, "duration", "d", 60*time.Second, "set duration")
+	rootCmd.PersistentFlags().BoolVar(&advertise, "advertise", false, "advertise this instance and its streams over mDNS/DNS-SD as _streamer._tcp for `streamer discover`")
+	rootCmd.PersistentFlags().StringVar(&out.Dir, "output-dir", "log", "root directory of debug captures, recordings and reports")
+	rootCmd.PersistentFlags().Int64Var(&out.Rotation.MaxSize, "rotate-size", 0, "rotate output files larger than this many bytes, 0 disables")
+	rootCmd.PersistentFlags().DurationVar(&out.Rotation.MaxAge, "rotate-interval", 0, "rotate output files older than this, 0 disables")
+	rootCmd.PersistentFlags().IntVar(&out.Rotation.MaxBackups, "max-backups", 0, "max rotated files kept per output file, 0 keeps all")
+	rootCmd.PersistentFlags().DurationVar(&out.Rotation.Retention, "retention", 0, "remove rotated files older than this, 0 keeps all")
+	rootCmd.PersistentFlags().Int64Var(&sessionSeed, "seed", 0, "session random seed of all randomized behavior, the same seed replays the same run, 0 picks one")
+	rootCmd.PersistentFlags().StringVar(&advertiseGroup, "advertise-group", discovery.DefaultGroup, "mDNS address used by --advertise, a unicast host:port answers queries only there")
+	rootCmd.PersistentFlags().StringVar(&client.UserAgent, "user-agent", fingerprint.DefaultUserAgent, "User-Agent of http pull requests")
+	rootCmd.PersistentFlags().StringVar(&client.FlashVer, "flash-ver", fingerprint.DefaultFlashVer, "flashVer sent in the rtmp connect command")
+	rootCmd.PersistentFlags().StringArrayVar(&headers, "header", nil, "extra http request header \"Name: value\", repeatable")
+	rootCmd.PersistentFlags().StringVar(&cookies, "cookie", "", "cookies sent with http requests, e.g. \"session=1; region=cn\"")
 
 	err := rootCmd.Execute()
 	if err != nil {
@@ -48,6 +94,39 @@ func Execute() int {
 	return 0
 }
 
+func startAdvertise(name, version string) {
+	announce := func() discovery.Announcement {
+		a := discovery.Announcement{
+			Name:    name,
+			Version: version,
+			Streams: append(pusher.GetAllStreamInfos(), downstream.GetAllStreamInfos()...),
+		}
+		if server != nil {
+			if l := server.Listener(); l != nil {
+				scheme := "rtmp://"
+				if srv.tlsCert != "" {
+					scheme = "rtmps://"
+				}
+				a.Endpoints = append(a.Endpoints, scheme+l.Addr().String())
+			}
+			if httpSrv != nil {
+				if l := httpSrv.Listener(); l != nil {
+					a.Endpoints = append(a.Endpoints, "http://"+l.Addr().String())
+				}
+			}
+			for _, st := range server.Streams() {
+				a.Streams = append(a.Streams, st.Key)
+			}
+		}
+		return a
+	}
+	go func() {
+		if err := discovery.Advertise(context.Background(), advertiseGroup, discovery.DefaultInterval, announce); err != nil {
+			log.Error().Err(err).Msg("advertise failed")
+		}
+	}()
+}
+
 func initLogger(logLevel string, logJSON bool) {
 	// Error Logging with Stacktrace
 	zerolog.ErrorStackMarshaler = pkgerrors.MarshalStack
@@ -95,3 +174,15 @@ func initLogger(logLevel string, logJSON bool) {
 		zerolog.SetGlobalLevel(zerolog.PanicLevel)
 	}
 }
+
+// setupFingerprint 解析--header/--cookie, 设置全局客户端指纹
+func setupFingerprint() (err error) {
+	if client.Header, err = fingerprint.ParseHeaders(headers); err != nil {
+		return
+	}
+	if client.Cookies, err = fingerprint.ParseCookies(cookies); err != nil {
+		return
+	}
+	fingerprint.SetConfig(client)
+	return
+}
@@ -0,0 +1,233 @@
+package cmd
+
+import (
+	"errors"
+	"os"
+	"time"
+
+	"github.com/bugVanisher/streamer/common/acl"
+	"github.com/bugVanisher/streamer/common/output"
+	"github.com/bugVanisher/streamer/httpserver"
+	"github.com/bugVanisher/streamer/media/container/flv/flvio"
+	"github.com/bugVanisher/streamer/media/protocol/rtmp"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Run as a standalone RTMP origin",
+	RunE: func(cmd *cobra.Command, args []string) (err error) {
+		opts := []rtmp.Option{rtmp.WithReadWriteTimeout(srv.timeout), rtmp.WithTimeouts(srv.readTimeout, srv.writeTimeout, srv.idleTimeout)}
+		if srv.sendQueue > 0 {
+			policy, err := rtmp.ParseSendQueuePolicy(srv.sendQueuePolicy)
+			if err != nil {
+				return err
+			}
+			opts = append(opts, rtmp.WithSendQueue(srv.sendQueue, policy))
+		}
+		if len(srv.metadata) > 0 {
+			fields := flvio.AMFMap{}
+			for k, v := range srv.metadata {
+				fields[k] = v
+			}
+			opts = append(opts, rtmp.WithMetadata(fields))
+		}
+		if srv.metadataPassThrough {
+			opts = append(opts, rtmp.WithMetadataPassThrough(true))
+		}
+		if srv.sharedLoop {
+			opts = append(opts, rtmp.WithEventLoop(nil))
+		}
+		if (srv.tlsCert == "") != (srv.tlsKey == "") {
+			return errors.New("--tls-cert and --tls-key must be set together")
+		}
+		s := rtmp.NewServer(srv.listen, opts...)
+		if s.ACL, err = srv.acl(); err != nil {
+			return err
+		}
+		for key, rate := range srv.egressLimits {
+			s.SetEgressLimit(key, rate)
+		}
+		for _, key := range srv.recoveryPoints {
+			s.SetRecoveryPoint(key, true)
+		}
+		if srv.shedMaxCPU > 0 || srv.shedMaxEgress > 0 {
+			s.EnableShedding(rtmp.ShedOptions{Interval: srv.shedInterval, MaxCPU: srv.shedMaxCPU, MaxEgress: srv.shedMaxEgress})
+		}
+		if srv.journalDir != "" {
+			if err = os.MkdirAll(srv.journalDir, 0755); err != nil {
+				return err
+			}
+			s.JournalDir = srv.journalDir
+		}
+		if srv.debugDir != "" {
+			if err = os.MkdirAll(srv.debugDir, 0755); err != nil {
+				return err
+			}
+			s.DebugDir = srv.debugDir
+		}
+		if len(srv.alerts) > 0 {
+			if s.AlertRules, err = parseAlertRules(srv.alerts); err != nil {
+				return err
+			}
+			s.OnAlert = alertNotifier(srv.alertWebhook)
+		}
+		server = s
+		if srv.httpAddr != "" {
+			startHTTP(s)
+		}
+		// serve默认一直运行, 只有显式指定--duration时才定时退出
+		if f := cmd.Flag("duration"); f != nil && f.Changed && duration > 0 {
+			time.AfterFunc(duration, func() {
+				log.Info().Msg("serve duration reached, closing")
+				s.Close()
+			})
+		}
+		if srv.tlsCert != "" {
+			err = s.ListenAndServeTLS(srv.tlsCert, srv.tlsKey)
+		} else {
+			err = s.ListenAndServe()
+		}
+		if httpSrv != nil {
+			httpSrv.Close()
+		}
+		if err == rtmp.ErrServerClosed {
+			return nil
+		}
+		return err
+	},
+}
+
+type serveArgs struct {
+	listen          string
+	timeout         time.Duration
+	readTimeout     time.Duration
+	writeTimeout    time.Duration
+	idleTimeout     time.Duration
+	allow           []string
+	deny            []string
+	maxConnsPerIP   int
+	maxBytesPerIPS  int64
+	journalDir      string
+	alerts          []string
+	alertWebhook    string
+	httpAddr        string
+	recordDir       string
+	debugDir        string
+	sendQueue       int
+	sendQueuePolicy string
+	metadata        map[string]string
+	// metadataPassThrough 拉流端收到推流端原始的onMetaData
+	metadataPassThrough bool
+	// egressLimits 每路流拉流出口总带宽上限(字节/秒), key为app/stream或*
+	egressLimits map[string]int64
+	// shedMaxCPU/shedMaxEgress 超过时按优先级断开拉流会话
+	shedMaxCPU    float64
+	shedMaxEgress int64
+	shedInterval  time.Duration
+	// access 播放接口的跨域和Referer策略
+	access httpserver.AccessPolicy
+	// playURLs 索引页中除rtmp外的播放地址模板, 如flv=http://{host}:8080/{app}/{stream}.flv
+	playURLs map[string]string
+	// recoveryPoints 把recovery point帧当作关键帧的流, app/stream或*
+	recoveryPoints []string
+	// sharedLoop 所有连接的保活和统计回调共享一个goroutine
+	sharedLoop bool
+	// tlsCert/tlsKey 不为空时--listen以rtmps提供服务
+	tlsCert string
+	tlsKey  string
+}
+
+var (
+	srv serveArgs
+	// server 正在运行的rtmp服务端, 用于--advertise上报
+	server *rtmp.Server
+	// httpSrv 正在运行的HTTP服务, 未开启时为nil
+	httpSrv *httpserver.Server
+)
+
+// startHTTP 启动内置HTTP服务, rtmp服务端退出时一起关闭
+func startHTTP(s *rtmp.Server) {
+	h := httpserver.NewServer(srv.httpAddr)
+	health := httpserver.NewHealth()
+	health.AddHealth("rtmp", s.Health)
+	health.AddHealth("output", func() error { return output.Writable(output.GetConfig().Dir) })
+	health.AddReady("rtmp-listener", s.Ready)
+	health.AddReady("http-listener", func() error {
+		if h.Listener() == nil {
+			return errors.New("http listener not bound")
+		}
+		return nil
+	})
+	h.Handle("/healthz", health.HealthzHandler())
+	h.Handle("/readyz", health.ReadyzHandler())
+	h.Handle("/sessions", httpserver.SessionsHandler("/sessions", s))
+	h.Handle("/sessions/", httpserver.SessionsHandler("/sessions", s))
+	if s.ACL != nil {
+		h.Handle("/acl", httpserver.ACLHandler(s.ACLStats))
+	}
+	h.Handle("/", &httpserver.IndexPage{Streams: s, RTMPAddr: srv.listen, RTMPS: srv.tlsCert != "", PlayURLs: srv.playURLs})
+	if srv.recordDir != "" {
+		h.Handle("/record/", srv.access.Handler(httpserver.RecordingHandler("/record/", srv.recordDir)))
+		h.Handle("/vod/", srv.access.Handler(httpserver.VODHandler("/vod/", srv.recordDir)))
+	}
+	httpSrv = h
+	go func() {
+		if err := h.ListenAndServe(); err != nil {
+			log.Error().Err(err).Msg("http server exited")
+			s.Close()
+		}
+	}()
+}
+
+func (a *serveArgs) acl() (*acl.ACL, error) {
+	if len(a.allow) == 0 && len(a.deny) == 0 && a.maxConnsPerIP == 0 && a.maxBytesPerIPS == 0 {
+		return nil, nil
+	}
+	allow, err := acl.ParseCIDRs(a.allow)
+	if err != nil {
+		return nil, err
+	}
+	deny, err := acl.ParseCIDRs(a.deny)
+	if err != nil {
+		return nil, err
+	}
+	return &acl.ACL{Allow: allow, Deny: deny, MaxConnsPerIP: a.maxConnsPerIP, MaxBytesPerIPPS: a.maxBytesPerIPS}, nil
+}
+
+func init() {
+	rootCmd.AddCommand(serveCmd)
+
+	serveCmd.Flags().StringVar(&srv.listen, "listen", ":1935", "rtmp listen address")
+	serveCmd.Flags().DurationVar(&srv.timeout, "timeout", 10*time.Second, "read/write timeout of each connection")
+	serveCmd.Flags().DurationVar(&srv.readTimeout, "read-timeout", 0, "timeout of reading each chunk, 0 uses --timeout")
+	serveCmd.Flags().DurationVar(&srv.writeTimeout, "write-timeout", 0, "timeout of each write, 0 uses --timeout")
+	serveCmd.Flags().DurationVar(&srv.idleTimeout, "idle-timeout", 0, "close connections that send nothing for this long, pinging idle peers; 0 disables keep-alive pings")
+	serveCmd.Flags().StringSliceVar(&srv.allow, "allow", nil, "CIDRs allowed to connect (default all)")
+	serveCmd.Flags().StringSliceVar(&srv.deny, "deny", nil, "CIDRs denied to connect")
+	serveCmd.Flags().IntVar(&srv.maxConnsPerIP, "max-conns-per-ip", 0, "max concurrent connections per ip, 0 means unlimited")
+	serveCmd.Flags().Int64Var(&srv.maxBytesPerIPS, "max-bps-per-ip", 0, "max bytes per second per ip, 0 means unlimited")
+	serveCmd.Flags().StringVar(&srv.httpAddr, "http", "", "http listen address (also serves the stream index at /, /healthz, /readyz and ACL stats at /acl), empty disables the http server")
+	serveCmd.Flags().StringVar(&srv.recordDir, "record-dir", "", "serve recorded flv/mp4/ts files in this directory under /record/, and flv remuxed to fmp4 under /vod/")
+	serveCmd.Flags().StringVar(&srv.debugDir, "debug-dir", "", "output directory of debug captures started via POST /sessions/{id}/debug (default <output-dir>/debug)")
+	serveCmd.Flags().IntVar(&srv.sendQueue, "send-queue", 0, "per-player send queue length in packets, 0 writes to players synchronously")
+	serveCmd.Flags().StringVar(&srv.sendQueuePolicy, "send-queue-policy", "block", "what to do when a player's send queue is full: block, drop-gop or drop-nonkey")
+	serveCmd.Flags().StringToStringVar(&srv.metadata, "metadata", nil, "extra onMetaData fields sent to players, e.g. encoder=streamer,author=qa")
+	serveCmd.Flags().BoolVar(&srv.metadataPassThrough, "metadata-passthrough", false, "send the publisher's original onMetaData to players instead of rebuilding it from the codec headers")
+	serveCmd.Flags().StringToInt64Var(&srv.egressLimits, "egress-limit", nil, "aggregate egress cap in bytes/s shared fairly by all players of a stream, keyed by app/stream or * for every stream, e.g. *=625000,live/vip=0 (0 leaves a stream uncapped)")
+	serveCmd.Flags().BoolVar(&srv.sharedLoop, "shared-loop", false, "run keep-alive pings and metrics callbacks of all connections on one shared goroutine instead of one per connection, for 10k-connection tests")
+	serveCmd.Flags().StringSliceVar(&srv.recoveryPoints, "recovery-point", nil, "streams (app/stream or * for every stream) whose H.264 recovery point SEI frames count as key frames, so players of open-GOP publishers can start on them")
+	serveCmd.Flags().StringSliceVar(&srv.access.AllowOrigins, "cors-origin", nil, "origins allowed to fetch /record/ and /vod/ from browser pages, * allows any (default no CORS headers)")
+	serveCmd.Flags().StringSliceVar(&srv.access.AllowReferers, "allow-referer", nil, "referer hosts allowed on /record/ and /vod/, e.g. *.example.com (default any)")
+	serveCmd.Flags().BoolVar(&srv.access.AllowEmptyReferer, "allow-empty-referer", true, "with --allow-referer, also allow requests without a Referer")
+	serveCmd.Flags().Float64Var(&srv.shedMaxCPU, "shed-max-cpu", 0, "disconnect the lowest priority player (?priority=low|normal|high on the play url) while process cpu usage exceeds this many cores, 0 disables")
+	serveCmd.Flags().Int64Var(&srv.shedMaxEgress, "shed-max-egress", 0, "disconnect the lowest priority player while total player egress exceeds this many bytes/s, 0 disables")
+	serveCmd.Flags().DurationVar(&srv.shedInterval, "shed-interval", time.Second, "how often cpu and egress are sampled for --shed-max-cpu/--shed-max-egress")
+	serveCmd.Flags().StringToStringVar(&srv.playURLs, "play-url", nil, "extra playback links listed on the http index page /, {host}, {app}, {stream} and {key} are replaced, e.g. flv=http://{host}:8080/{app}/{stream}.flv,hls=http://{host}:8080/{app}/{stream}.m3u8")
+	serveCmd.Flags().StringVar(&srv.tlsCert, "tls-cert", "", "PEM certificate file, serves rtmps instead of rtmp on --listen")
+	serveCmd.Flags().StringVar(&srv.tlsKey, "tls-key", "", "PEM private key file of --tls-cert")
+	serveCmd.Flags().StringArrayVar(&srv.alerts, "alert", nil, `alert rule checked on every publish and play session, degraded sessions are flagged in /sessions, e.g. "fps<20 for 10s" (metrics: fps, audio_fps, bitrate, delay, drift, gop, health, overhead)`)
+	serveCmd.Flags().StringVar(&srv.alertWebhook, "alert-webhook", "", "URL to POST alert events to")
+	serveCmd.Flags().StringVar(&srv.journalDir, "journal-dir", "", "write a command journal of every session into this directory")
+}
@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/bugVanisher/streamer/pusher"
+	"github.com/spf13/cobra"
+)
+
+var sweepCmd = &cobra.Command{
+	Use:   "sweep",
+	Short: "Run the same push scenario across a matrix of parameters and compare",
+	RunE: func(cmd *cobra.Command, args []string) (err error) {
+		var pacing []bool
+		for _, p := range sw.pacing {
+			switch p {
+			case "on":
+				pacing = append(pacing, true)
+			case "off":
+				pacing = append(pacing, false)
+			default:
+				return fmt.Errorf("invalid pacing %q, want on or off", p)
+			}
+		}
+		matrix := pusher.SweepMatrix(sw.chunkSizes, sw.readBuffers, sw.writeBuffers, pacing)
+		results := pusher.Sweep(context.Background(), sw.rUrl, sw.sourceFile, sw.pullUrl, sw.runFor, matrix)
+		return pusher.WriteSweepReport(os.Stdout, results)
+	},
+}
+
+type sweepArgs struct {
+	rUrl         string
+	sourceFile   string
+	pullUrl      string
+	runFor       time.Duration
+	chunkSizes   []int
+	readBuffers  []int
+	writeBuffers []int
+	pacing       []string
+}
+
+var sw sweepArgs
+
+func init() {
+	rootCmd.AddCommand(sweepCmd)
+
+	sweepCmd.Flags().StringVarP(&sw.rUrl, "url", "u", "", "Upstream URL")
+	sweepCmd.MarkFlagRequired("url")
+	sweepCmd.Flags().StringVarP(&sw.sourceFile, "file", "f", "", "File to upstream")
+	sweepCmd.MarkFlagRequired("file")
+	sweepCmd.Flags().StringVar(&sw.pullUrl, "pull-url", "", "http-flv URL to pull during each run for delay measurement")
+	sweepCmd.Flags().DurationVar(&sw.runFor, "run-for", 10*time.Second, "duration of each run")
+	sweepCmd.Flags().IntSliceVar(&sw.chunkSizes, "chunk-size", []int{4096}, "chunk sizes to sweep")
+	sweepCmd.Flags().IntSliceVar(&sw.readBuffers, "read-buffer", []int{4096}, "read buffer sizes to sweep")
+	sweepCmd.Flags().IntSliceVar(&sw.writeBuffers, "write-buffer", []int{4096}, "write buffer sizes to sweep")
+	sweepCmd.Flags().StringSliceVar(&sw.pacing, "pacing", []string{"on"}, "pacing modes to sweep (on, off)")
+}
@@ -1,7 +1,20 @@
 package cmd
 
 import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/bugVanisher/streamer/common/seed"
+	"github.com/bugVanisher/streamer/media/av"
+	"github.com/bugVanisher/streamer/media/av/avutil"
+	"github.com/bugVanisher/streamer/media/av/pktque"
+	"github.com/bugVanisher/streamer/media/protocol/rtmp"
 	"github.com/bugVanisher/streamer/pusher"
+	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
 )
 
@@ -9,14 +22,143 @@ var upstream = &cobra.Command{
 	Use:   "push",
 	Short: "Streaming upstream",
 	RunE: func(cmd *cobra.Command, args []string) (err error) {
-		rtmpPusher := pusher.NewRtmpPusher(up.rUrl, up.sourceFile)
+		opts, err := up.rtmpOptions()
+		if err != nil {
+			return err
+		}
+		if up.probeSize > 0 {
+			avutil.DefaultHandlers.ProbeSize = up.probeSize
+		}
+		if dryRun {
+			return runDryRun(func(ctx context.Context) (avutil.GOPReport, error) {
+				return pusher.DryRun(ctx, up.rUrl, up.sourceFile, opts...)
+			})
+		}
+		if up.standby > 0 {
+			return launchStandby(opts)
+		}
+		if cmd.Flags().Changed("churn-rate") {
+			churner, err := pusher.NewChurner(up.rUrl, up.sourceFile, up.churnRate, up.churnLifetime, opts...)
+			if err != nil {
+				return err
+			}
+			return pusher.Launch("churn", churner, duration)
+		}
+		rtmpPusher := pusher.NewRtmpPusher(up.rUrl, up.sourceFile, opts...)
+		if up.reconnect != 0 {
+			policy := pusher.DefaultReconnect
+			policy.MaxRetries = up.reconnect
+			policy.MaxBackoff = up.reconnectMaxBackoff
+			rtmpPusher.SetReconnect(policy)
+		}
+		if up.startOffset > 0 || up.length > 0 {
+			rtmpPusher.SetTrim(up.startOffset, up.length)
+		}
+		if !cmd.Flags().Changed("seek-seed") {
+			up.seekSeed = seed.Derive("seek")
+		}
+		if !cmd.Flags().Changed("drift-seed") {
+			up.driftSeed = seed.Derive("drift")
+		}
+		if up.seekSegment > 0 {
+			rtmpPusher.SetSeekStress(&pktque.SeekStressOptions{
+				SegmentLength: up.seekSegment,
+				Reverse:       up.seekReverse,
+				Monotonic:     up.seekMonotonic,
+				Seed:          up.seekSeed,
+			})
+		}
+		if up.driftPPM != 0 || up.driftWalk > 0 {
+			rtmpPusher.SetClockDrift(&pktque.ClockDriftOptions{PPM: up.driftPPM, Walk: up.driftWalk, Seed: up.driftSeed})
+		}
+		if up.tsAnomalies != "" {
+			anomalies, err := pktque.ParseTimeAnomalies(up.tsAnomalies)
+			if err != nil {
+				return err
+			}
+			rtmpPusher.SetTimeAnomalies(anomalies)
+		}
+		if up.gopMutations != "" {
+			mutations, err := pktque.ParseGOPMutations(up.gopMutations)
+			if err != nil {
+				return err
+			}
+			rtmpPusher.SetGOPMutations(mutations)
+		}
+		switch up.seiSendTime {
+		case "":
+		case "key", "all":
+			rtmpPusher.SetSendTimeSEI(true, up.seiSendTime == "key")
+		default:
+			return fmt.Errorf("invalid --sei-send-time %q, want key or all", up.seiSendTime)
+		}
+		if up.fillSilence {
+			layout := av.CH_STEREO
+			if up.silenceChannels == 1 {
+				layout = av.CH_MONO
+			} else if up.silenceChannels != 2 {
+				return fmt.Errorf("invalid --silence-channels %d, want 1 or 2", up.silenceChannels)
+			}
+			rtmpPusher.SetSilence(&pktque.SilenceOptions{SampleRate: up.silenceRate, ChannelLayout: layout})
+		}
+		if up.esAudio != "" || up.esFPS > 0 {
+			rtmpPusher.SetElementaryStream(up.esAudio, up.esFPS)
+		}
 		return pusher.Launch("test", rtmpPusher, duration)
 	},
 }
 
 type upstreamArgs struct {
-	rUrl       string
-	sourceFile string
+	rUrl        string
+	sourceFile  string
+	standby     int
+	standbyHold time.Duration
+
+	churnRate     float64
+	churnLifetime time.Duration
+
+	tlsCA       string
+	tlsInsecure bool
+	tlsSNI      string
+	tlsCert     string
+	tlsKey      string
+	tlsALPN     []string
+	proxy       string
+
+	simpleHandshake bool
+	vhost           string
+
+	authUser      string
+	authPassword  string
+	tokenKey      string
+	tokenTTL      time.Duration
+	paceRate      int64
+	paceBurst     int64
+	flushBytes    int
+	flushInterval time.Duration
+	startOffset   time.Duration
+	length        time.Duration
+	seekSegment   time.Duration
+	seekReverse   bool
+	seekMonotonic bool
+	seekSeed      int64
+	esAudio       string
+	esFPS         float64
+	driftPPM      float64
+	driftWalk     time.Duration
+	driftSeed     int64
+	tsAnomalies   string
+	gopMutations  string
+	seiSendTime   string
+
+	fillSilence     bool
+	silenceRate     int
+	silenceChannels int
+
+	reconnect           int
+	reconnectMaxBackoff time.Duration
+	// probeSize 按内容探测--file格式时最多读取的字节数
+	probeSize int
 }
 
 var up upstreamArgs
@@ -28,4 +170,108 @@ func init() {
 	upstream.MarkFlagRequired("url")
 	upstream.Flags().StringVarP(&up.sourceFile, "file", "f", "", "File to upstream")
 	upstream.MarkFlagRequired("file")
+	upstream.Flags().IntVar(&up.standby, "standby", 0, "pre-establish N idle connections and publish them simultaneously")
+	upstream.Flags().StringVar(&up.tlsCA, "tls-ca", "", "rtmps: PEM file with root CAs (default system roots)")
+	upstream.Flags().BoolVar(&up.tlsInsecure, "tls-insecure", false, "rtmps: skip server certificate verification")
+	upstream.Flags().StringVar(&up.tlsSNI, "tls-sni", "", "rtmps: server name for SNI and verification (default url host)")
+	upstream.Flags().StringVar(&up.tlsCert, "tls-cert", "", "rtmps: PEM client certificate for mutual TLS, used with --tls-key")
+	upstream.Flags().StringVar(&up.tlsKey, "tls-key", "", "rtmps: PEM private key of --tls-cert")
+	upstream.Flags().StringSliceVar(&up.tlsALPN, "tls-alpn", nil, "rtmps: ALPN protocols to offer, comma separated")
+	upstream.Flags().StringVar(&up.proxy, "proxy", "", "connect through a proxy: http://[user:password@]host:port or socks5://[user:password@]host:port")
+	upstream.Flags().BoolVar(&up.simpleHandshake, "simple-handshake", false, "use the plain rtmp handshake without digest")
+	upstream.Flags().StringVar(&up.vhost, "vhost", "", "virtual host sent as ?vhost= in the connect tcUrl and app (SRS style)")
+	upstream.Flags().StringVar(&up.authUser, "auth-user", "", "user for adobe connect auth (authmod=adobe)")
+	upstream.Flags().StringVar(&up.authPassword, "auth-password", "", "password for adobe connect auth")
+	upstream.Flags().StringVar(&up.tokenKey, "token-key", "", "sign the publish path with an auth_key token using this key")
+	upstream.Flags().DurationVar(&up.tokenTTL, "token-ttl", time.Hour, "validity of the signed auth_key token")
+	upstream.Flags().Int64Var(&up.paceRate, "pace-bps", 0, "limit the upload to this many bytes per second to simulate a constrained uplink, 0 means unlimited")
+	upstream.Flags().Int64Var(&up.paceBurst, "pace-burst", 0, "bytes allowed to burst above --pace-bps (default one second of --pace-bps)")
+	upstream.Flags().IntVar(&up.flushBytes, "flush-bytes", 0, "send buffered audio/video once this many bytes are pending, 0 sends only when the write buffer is full")
+	upstream.Flags().DurationVar(&up.flushInterval, "flush-interval", 0, "send buffered audio/video at most this long after it was written, e.g. 20ms")
+	upstream.Flags().DurationVar(&up.startOffset, "start-offset", 0, "start pushing from the last keyframe before this file position, timestamps start from zero")
+	upstream.Flags().DurationVar(&up.length, "length", 0, "push only this long from --start-offset, then write the trailer and stop (0 means until the end of file)")
+	upstream.Flags().DurationVar(&up.seekSegment, "seek-stress", 0, "seek stress mode: jump to a random keyframe of the file after pushing this long from each seek, 0 disables")
+	upstream.Flags().BoolVar(&up.seekReverse, "seek-reverse", false, "seek stress mode: play the file backwards segment by segment instead of random seeks")
+	upstream.Flags().BoolVar(&up.seekMonotonic, "seek-monotonic", false, "seek stress mode: keep timestamps increasing and turn each seek into a forward jump, otherwise send the source timestamps")
+	upstream.Flags().Int64Var(&up.seekSeed, "seek-seed", 0, "seek stress mode: random seed, the same seed repeats the same seeks (default derived from --seed)")
+	upstream.Flags().StringVar(&up.esAudio, "audio", "", "ADTS .aac file pushed together with an elementary stream video file (.h264/.265) given by --file")
+	upstream.Flags().Float64Var(&up.esFPS, "fps", 0, "frame rate of an elementary stream video file, 0 uses the SPS timing info or 25")
+	upstream.Flags().Float64Var(&up.driftPPM, "drift-ppm", 0, "skew pushed timestamps by this many ppm relative to the wallclock pacing, negative makes the clock run slow")
+	upstream.Flags().DurationVar(&up.driftWalk, "drift-walk", 0, "add a random walk to the timestamp skew with this standard deviation per second, e.g. 2ms")
+	upstream.Flags().Int64Var(&up.driftSeed, "drift-seed", 0, "random seed of --drift-walk, the same seed repeats the same skew (default derived from --seed)")
+	upstream.Flags().StringVar(&up.tsAnomalies, "ts-anomaly", "", `inject timestamp anomalies at source times, e.g. "jump@10s:10h,reset@20s,backward@30s:500ms/2s"`)
+	upstream.Flags().StringVar(&up.seiSendTime, "sei-send-time", "", "insert wallclock send-time SEI into H.264 frames for end-to-end latency: key (keyframes only) or all")
+	upstream.Flags().BoolVar(&up.fillSilence, "fill-silence", false, "add a silent AAC track when the source has no audio, for players that refuse video-only streams")
+	upstream.Flags().IntVar(&up.silenceRate, "silence-sample-rate", pktque.DefaultSilenceSampleRate, "sample rate of the --fill-silence track")
+	upstream.Flags().IntVar(&up.silenceChannels, "silence-channels", 2, "channels of the --fill-silence track: 1 or 2")
+	upstream.Flags().StringVar(&up.gopMutations, "gop-mutation", "", `inject GOP structure faults at source times: drop-idr, strip-ps (in-band SPS/PPS), no-header (skip sequence header resends), pps-change; e.g. "drop-idr@10s,strip-ps@20s/10s,pps-change@30s"`)
+	upstream.Flags().IntVar(&up.probeSize, "probe-size", avutil.DefaultProbeSize, "max bytes read to detect the --file format by content when its extension is unknown; short files and live sources are detected with less")
+	upstream.Flags().IntVar(&up.reconnect, "reconnect", 0, "reconnect and resume publishing up to N times after a broken connection, -1 retries forever")
+	upstream.Flags().DurationVar(&up.reconnectMaxBackoff, "reconnect-max-backoff", pusher.DefaultReconnect.MaxBackoff, "upper bound of the exponential reconnect backoff")
+	upstream.Flags().Float64Var(&up.churnRate, "churn-rate", 0, "churn mode: publishes started per second")
+	upstream.Flags().DurationVar(&up.churnLifetime, "churn-lifetime", 30*time.Second, "churn mode: lifetime of each publisher")
+	upstream.Flags().DurationVar(&up.standbyHold, "standby-hold", 0, "hold standby connections idle for this long before publishing (0 waits for Enter on stdin)")
+}
+
+// rtmpOptions 根据命令行参数生成rtmp连接选项
+func (a *upstreamArgs) rtmpOptions() ([]rtmp.Option, error) {
+	var opts []rtmp.Option
+	if a.tlsCA != "" || a.tlsInsecure || a.tlsSNI != "" {
+		cfg, err := rtmp.NewTLSConfig(a.tlsCA, a.tlsInsecure, a.tlsSNI)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, rtmp.WithTLSConfig(cfg))
+	}
+	if a.tlsCert != "" || a.tlsKey != "" {
+		cert, err := tls.LoadX509KeyPair(a.tlsCert, a.tlsKey)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, rtmp.WithClientCertificates(cert))
+	}
+	if len(a.tlsALPN) > 0 {
+		opts = append(opts, rtmp.WithALPN(a.tlsALPN...))
+	}
+	if a.proxy != "" {
+		dial, err := rtmp.NewProxyDialer(a.proxy, nil)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, rtmp.WithDialContext(dial))
+	}
+	if a.simpleHandshake {
+		opts = append(opts, rtmp.WithSimpleHandshake(true))
+	}
+	if a.vhost != "" {
+		opts = append(opts, rtmp.WithVhost(a.vhost))
+	}
+	if a.authUser != "" {
+		opts = append(opts, rtmp.WithAdobeAuth(a.authUser, a.authPassword))
+	}
+	if a.tokenKey != "" {
+		opts = append(opts, rtmp.WithTokenSigner(rtmp.AuthKeySigner(a.tokenKey, a.tokenTTL)))
+	}
+	if a.paceRate > 0 {
+		opts = append(opts, rtmp.WithPacer(a.paceRate, a.paceBurst))
+	}
+	if a.flushBytes > 0 || a.flushInterval > 0 {
+		opts = append(opts, rtmp.WithFlushStrategy(a.flushBytes, a.flushInterval))
+	}
+	return opts, nil
+}
+
+func launchStandby(opts []rtmp.Option) error {
+	pool := pusher.NewStandbyPool(up.rUrl, up.sourceFile, up.standby, opts...)
+	go func() {
+		<-pool.Ready()
+		if up.standbyHold > 0 {
+			time.Sleep(up.standbyHold)
+		} else {
+			log.Info().Msg("standby connections ready, press Enter to publish")
+			_, _ = bufio.NewReader(os.Stdin).ReadString('\n')
+		}
+		pool.Fire()
+	}()
+	return pusher.Launch("standby", pool, duration)
 }
@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"crypto/x509"
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"text/tabwriter"
+
+	"github.com/bugVanisher/streamer/common/output"
+	"github.com/spf13/cobra"
+)
+
+// version 发布版本, 构建时可以通过 -ldflags "-X github.com/bugVanisher/streamer/cmd.version=..." 覆盖
+var version = "v1.0.0"
+
+var versionCmd = &cobra.Command{
+	Use:   "version",
+	Short: "Print the version, with --build-info also the build and runtime environment",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		fmt.Println(version)
+		if !showBuildInfo {
+			return nil
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		if info, ok := debug.ReadBuildInfo(); ok {
+			fmt.Fprintf(w, "go\t%s\n", info.GoVersion)
+			fmt.Fprintf(w, "module\t%s %s\n", info.Main.Path, info.Main.Version)
+			for _, s := range info.Settings {
+				fmt.Fprintf(w, "%s\t%s\n", s.Key, s.Value)
+			}
+		}
+		fmt.Fprintf(w, "platform\t%s/%s\n", runtime.GOOS, runtime.GOARCH)
+		fmt.Fprintf(w, "cpus\t%d\n", runtime.NumCPU())
+		// scratch镜像中没有根证书时rtmps无法校验服务端证书
+		if pool, err := x509.SystemCertPool(); err != nil || pool == nil {
+			fmt.Fprintf(w, "tls-roots\tunavailable\n")
+		} else {
+			fmt.Fprintf(w, "tls-roots\tok\n")
+		}
+		// 容器中工作目录只读时录制和报告会失败
+		if err := output.Writable(out.Dir); err != nil {
+			fmt.Fprintf(w, "output-dir\t%s (not writable: %v)\n", out.Dir, err)
+		} else {
+			fmt.Fprintf(w, "output-dir\t%s (writable)\n", out.Dir)
+		}
+		return w.Flush()
+	},
+}
+
+var showBuildInfo bool
+
+func init() {
+	rootCmd.AddCommand(versionCmd)
+	rootCmd.Version = version
+
+	versionCmd.Flags().BoolVar(&showBuildInfo, "build-info", false, "print go version, vcs and build settings, platform and runtime checks")
+}
@@ -0,0 +1,246 @@
+// Package acl 服务端连接的访问控制, 在accept时按IP进行允许/拒绝、连接数和带宽限制
+package acl
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// ACL 访问控制配置
+type ACL struct {
+	Allow           []*net.IPNet // 非空时只允许列表中的IP
+	Deny            []*net.IPNet // 拒绝列表, 优先于Allow
+	MaxConnsPerIP   int          // 每个IP的最大连接数, 0表示不限制
+	MaxBytesPerIPPS int64        // 每个IP的读写带宽上限, 字节/秒, 0表示不限制
+}
+
+// ParseCIDRs 解析CIDR列表, 单个IP按/32或/128处理
+func ParseCIDRs(list []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(list))
+	for _, s := range list {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		if !strings.Contains(s, "/") {
+			ip := net.ParseIP(s)
+			if ip == nil {
+				return nil, fmt.Errorf("acl: invalid ip %q", s)
+			}
+			if ip.To4() != nil {
+				s += "/32"
+			} else {
+				s += "/128"
+			}
+		}
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, fmt.Errorf("acl: invalid cidr %q", s)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// Permit 检查IP是否被允许
+func (a *ACL) Permit(ip net.IP) bool {
+	for _, n := range a.Deny {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+	if len(a.Allow) == 0 {
+		return true
+	}
+	for _, n := range a.Allow {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Stats 拒绝和限速统计
+type Stats struct {
+	Accepted     uint64 `json:"accepted"`
+	DeniedByACL  uint64 `json:"denied_by_acl"`
+	DeniedByConn uint64 `json:"denied_by_conn"`
+	// Throttled 因带宽限制等待的读写次数和累计时间
+	Throttled     uint64        `json:"throttled"`
+	ThrottledTime time.Duration `json:"throttled_time"`
+}
+
+type ipState struct {
+	conns   int
+	limiter *limiter
+}
+
+// Listener 在accept时执行ACL的net.Listener
+type Listener struct {
+	net.Listener
+	acl *ACL
+
+	lock sync.Mutex
+	ips  map[string]*ipState
+
+	accepted      uint64
+	deniedByACL   uint64
+	deniedByConn  uint64
+	throttled     uint64
+	throttledTime int64
+}
+
+// NewListener 用acl包装listener, 被拒绝的连接直接关闭, 不会返回给调用方
+func NewListener(l net.Listener, acl *ACL) *Listener {
+	return &Listener{
+		Listener: l,
+		acl:      acl,
+		ips:      make(map[string]*ipState),
+	}
+}
+
+// Accept 返回第一个通过ACL检查的连接
+func (l *Listener) Accept() (net.Conn, error) {
+	for {
+		c, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		host, _, _ := net.SplitHostPort(c.RemoteAddr().String())
+		ip := net.ParseIP(host)
+		if ip == nil || !l.acl.Permit(ip) {
+			atomic.AddUint64(&l.deniedByACL, 1)
+			log.Warn().Str("remote", c.RemoteAddr().String()).Msg("[acl] connection denied")
+			c.Close()
+			continue
+		}
+
+		l.lock.Lock()
+		st, ok := l.ips[host]
+		if !ok {
+			st = &ipState{}
+			if l.acl.MaxBytesPerIPPS > 0 {
+				st.limiter = newLimiter(l.acl.MaxBytesPerIPPS)
+			}
+			l.ips[host] = st
+		}
+		if l.acl.MaxConnsPerIP > 0 && st.conns >= l.acl.MaxConnsPerIP {
+			l.lock.Unlock()
+			atomic.AddUint64(&l.deniedByConn, 1)
+			log.Warn().Str("remote", c.RemoteAddr().String()).Int("conns", st.conns).Msg("[acl] too many connections")
+			c.Close()
+			continue
+		}
+		st.conns++
+		l.lock.Unlock()
+
+		atomic.AddUint64(&l.accepted, 1)
+		return &conn{Conn: c, listener: l, host: host, limiter: st.limiter}, nil
+	}
+}
+
+// Stats 返回accept、拒绝和限速统计
+func (l *Listener) Stats() Stats {
+	return Stats{
+		Accepted:      atomic.LoadUint64(&l.accepted),
+		DeniedByACL:   atomic.LoadUint64(&l.deniedByACL),
+		DeniedByConn:  atomic.LoadUint64(&l.deniedByConn),
+		Throttled:     atomic.LoadUint64(&l.throttled),
+		ThrottledTime: time.Duration(atomic.LoadInt64(&l.throttledTime)),
+	}
+}
+
+func (l *Listener) throttle(wait time.Duration) {
+	if wait > 0 {
+		atomic.AddUint64(&l.throttled, 1)
+		atomic.AddInt64(&l.throttledTime, int64(wait))
+	}
+}
+
+func (l *Listener) release(host string) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	st, ok := l.ips[host]
+	if !ok {
+		return
+	}
+	st.conns--
+	if st.conns <= 0 {
+		delete(l.ips, host)
+	}
+}
+
+// conn 连接关闭时释放IP计数, 读写时按IP限速
+type conn struct {
+	net.Conn
+	listener *Listener
+	host     string
+	limiter  *limiter
+	once     sync.Once
+}
+
+func (c *conn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if c.limiter != nil {
+		c.listener.throttle(c.limiter.wait(n))
+	}
+	return n, err
+}
+
+func (c *conn) Write(p []byte) (int, error) {
+	if c.limiter != nil {
+		c.listener.throttle(c.limiter.wait(len(p)))
+	}
+	return c.Conn.Write(p)
+}
+
+func (c *conn) Close() error {
+	c.once.Do(func() {
+		c.listener.release(c.host)
+	})
+	return c.Conn.Close()
+}
+
+// limiter 简单的令牌桶, 同一IP的连接共享
+type limiter struct {
+	lock   sync.Mutex
+	rate   int64
+	tokens int64
+	last   time.Time
+}
+
+func newLimiter(rate int64) *limiter {
+	return &limiter{rate: rate, tokens: rate, last: time.Now()}
+}
+
+// wait 消耗n个令牌, 令牌不足时等待, 返回等待的时长
+func (l *limiter) wait(n int) time.Duration {
+	sleep := l.reserve(n, time.Now())
+	if sleep > 0 {
+		time.Sleep(sleep)
+	}
+	return sleep
+}
+
+// reserve 在now时刻消耗n个令牌, 返回令牌补足需要等待的时长
+func (l *limiter) reserve(n int, now time.Time) time.Duration {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	// 按float64计算, 长时间空闲后int64(elapsed)*rate会溢出
+	l.tokens += int64(now.Sub(l.last).Seconds() * float64(l.rate))
+	if l.tokens > l.rate {
+		l.tokens = l.rate
+	}
+	l.last = now
+	l.tokens -= int64(n)
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens * int64(time.Second) / l.rate)
+}
@@ -0,0 +1,38 @@
+package acl
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimiterReserve(t *testing.T) {
+	l := newLimiter(1000)
+	now := l.last
+	require.Equal(t, time.Duration(0), l.reserve(1000, now))
+	require.Equal(t, 500*time.Millisecond, l.reserve(500, now))
+	// 令牌按时间补充, 不超过一秒的量
+	require.Equal(t, time.Duration(0), l.reserve(400, now.Add(2*time.Second)))
+	require.Equal(t, 400*time.Millisecond, l.reserve(1000, now.Add(2*time.Second)))
+}
+
+func TestListenerThrottleStats(t *testing.T) {
+	l := NewListener(nil, &ACL{})
+	l.throttle(0)
+	l.throttle(100 * time.Millisecond)
+	l.throttle(50 * time.Millisecond)
+	st := l.Stats()
+	require.Equal(t, uint64(2), st.Throttled)
+	require.Equal(t, 150*time.Millisecond, st.ThrottledTime)
+}
+
+func TestLimiterReserveLongIdle(t *testing.T) {
+	// 10MB/s空闲15分钟, 不限制间隔时int64(elapsed)*rate会溢出
+	l := newLimiter(10 * 1000 * 1000)
+	now := l.last
+	require.Equal(t, time.Duration(0), l.reserve(10*1000*1000, now))
+	now = now.Add(15 * time.Minute)
+	require.Equal(t, time.Duration(0), l.reserve(1000, now))
+	require.Equal(t, int64(10*1000*1000-1000), l.tokens)
+}
@@ -0,0 +1,102 @@
+// Package fingerprint 客户端指纹: http拉流请求的User-Agent、额外请求头和cookie, 以及rtmp connect的flashVer,
+// 用于验证CDN边缘按客户端指纹区分的规则
+package fingerprint
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+const (
+	// DefaultUserAgent 未设置时http请求的User-Agent
+	DefaultUserAgent = "streamer"
+	// DefaultFlashVer 未设置时rtmp connect的flashVer
+	DefaultFlashVer = "MAC 22,0,0,192"
+)
+
+// Config 客户端指纹配置, 各项为空时使用默认值
+type Config struct {
+	UserAgent string
+	FlashVer  string
+	// Header 额外的http请求头, 与默认请求头同名时覆盖
+	Header http.Header
+	// Cookies 随http请求发送的cookie
+	Cookies []*http.Cookie
+}
+
+var (
+	lock   sync.RWMutex
+	config Config
+)
+
+// SetConfig 设置全局客户端指纹, 启动时调用
+func SetConfig(c Config) {
+	lock.Lock()
+	defer lock.Unlock()
+	config = c
+}
+
+// GetConfig 返回全局客户端指纹
+func GetConfig() Config {
+	lock.RLock()
+	defer lock.RUnlock()
+	return config
+}
+
+// FlashVersion rtmp connect的flashVer
+func (c Config) FlashVersion() string {
+	if c.FlashVer != "" {
+		return c.FlashVer
+	}
+	return DefaultFlashVer
+}
+
+// Apply 设置req的User-Agent、额外请求头和cookie
+func (c Config) Apply(req *http.Request) {
+	ua := c.UserAgent
+	if ua == "" {
+		ua = DefaultUserAgent
+	}
+	req.Header.Set("User-Agent", ua)
+	for k, vs := range c.Header {
+		req.Header.Del(k)
+		for _, v := range vs {
+			req.Header.Add(k, v)
+		}
+	}
+	for _, cookie := range c.Cookies {
+		req.AddCookie(cookie)
+	}
+}
+
+// ParseHeaders 解析"Name: value"格式的请求头, 同名的多项都保留
+func ParseHeaders(lines []string) (http.Header, error) {
+	h := http.Header{}
+	for _, line := range lines {
+		i := strings.IndexByte(line, ':')
+		if i <= 0 {
+			return nil, fmt.Errorf("fingerprint: invalid header %q, want Name: value", line)
+		}
+		h.Add(strings.TrimSpace(line[:i]), strings.TrimSpace(line[i+1:]))
+	}
+	return h, nil
+}
+
+// ParseCookies 解析"a=1; b=2"格式的cookie
+func ParseCookies(s string) ([]*http.Cookie, error) {
+	var cookies []*http.Cookie
+	for _, part := range strings.Split(s, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		i := strings.IndexByte(part, '=')
+		if i <= 0 {
+			return nil, fmt.Errorf("fingerprint: invalid cookie %q, want name=value", part)
+		}
+		cookies = append(cookies, &http.Cookie{Name: part[:i], Value: part[i+1:]})
+	}
+	return cookies, nil
+}
@@ -0,0 +1,34 @@
+package fingerprint
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestApply(t *testing.T) {
+	req, _ := http.NewRequest("GET", "http://127.0.0.1/live/test.flv", nil)
+	Config{}.Apply(req)
+	require.Equal(t, DefaultUserAgent, req.Header.Get("User-Agent"))
+	require.Equal(t, DefaultFlashVer, Config{}.FlashVersion())
+
+	header, err := ParseHeaders([]string{"X-Edge-Rule: a", "X-Edge-Rule: b", "Referer:http://example.com/"})
+	require.Nil(t, err)
+	cookies, err := ParseCookies("session=1; region=cn")
+	require.Nil(t, err)
+	c := Config{UserAgent: "VLC/3.0.18", FlashVer: "LNX 9,0,124,2", Header: header, Cookies: cookies}
+
+	req, _ = http.NewRequest("GET", "http://127.0.0.1/live/test.flv", nil)
+	c.Apply(req)
+	require.Equal(t, "VLC/3.0.18", req.Header.Get("User-Agent"))
+	require.Equal(t, []string{"a", "b"}, req.Header.Values("X-Edge-Rule"))
+	require.Equal(t, "http://example.com/", req.Header.Get("Referer"))
+	require.Equal(t, "session=1; region=cn", req.Header.Get("Cookie"))
+	require.Equal(t, "LNX 9,0,124,2", c.FlashVersion())
+
+	_, err = ParseHeaders([]string{"no-colon"})
+	require.NotNil(t, err)
+	_, err = ParseCookies("novalue")
+	require.NotNil(t, err)
+}
@@ -0,0 +1,262 @@
+// Package output 统一管理debug抓取、录制和报告等输出文件的目录, 以及按大小/时间的滚动和保留清理
+package output
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// 输出文件的类别, 对应Dir下的子目录
+const (
+	KindDebug  = "debug"
+	KindRecord = "record"
+	KindReport = "report"
+)
+
+// rotateLayout 滚动文件名中的时间格式, 按字典序即时间序
+const rotateLayout = "20060102T150405.000"
+
+// Rotation 文件滚动和保留策略, 各项为0表示不限制
+type Rotation struct {
+	MaxSize    int64         // 单个文件的最大字节数
+	MaxAge     time.Duration // 单个文件的最长写入时间
+	MaxBackups int           // 最多保留的滚动文件数
+	Retention  time.Duration // 滚动文件的保留时间
+}
+
+// Enabled 是否配置了滚动条件
+func (r Rotation) Enabled() bool {
+	return r.MaxSize > 0 || r.MaxAge > 0
+}
+
+// Config 输出配置
+type Config struct {
+	Dir      string // 输出根目录, 各类别写入Dir/<kind>/
+	Rotation Rotation
+}
+
+var (
+	lock   sync.RWMutex
+	config = Config{Dir: "log"}
+)
+
+// SetConfig 设置全局输出配置, 启动时调用
+func SetConfig(c Config) {
+	lock.Lock()
+	defer lock.Unlock()
+	config = c
+}
+
+// GetConfig 返回全局输出配置
+func GetConfig() Config {
+	lock.RLock()
+	defer lock.RUnlock()
+	return config
+}
+
+// Path 返回kind类别下名为name的文件路径
+func Path(kind, name string) string {
+	return filepath.Join(GetConfig().Dir, kind, name)
+}
+
+// unsafeChars Windows文件名中不允许的字符以及路径分隔符
+var unsafeChars = strings.NewReplacer("<", "_", ">", "_", ":", "_", "\"", "_", "/", "_", "\\", "_", "|", "_", "?", "_", "*", "_")
+
+// SafeName 把name中在Windows或Unix文件名中非法的字符替换为_, 用于由地址、角色等拼出的文件名
+func SafeName(name string) string {
+	return unsafeChars.Replace(name)
+}
+
+// Writable 检查dir(不存在时创建)中能否创建文件, 用于启动自检和健康检查
+func Writable(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, ".probe")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// Create 按全局配置在kind类别下创建文件, 写入时自动滚动
+func Create(kind, name string) (*File, error) {
+	return OpenFile(Path(kind, name), GetConfig().Rotation)
+}
+
+// File 可滚动的输出文件. 滚动时当前文件重命名为<name>.<时间><ext>, 再创建新文件
+type File struct {
+	path     string
+	rotation Rotation
+	// manual 为true时Write不自动滚动, 由调用方在合适的位置(如关键帧)调用Rotate
+	manual bool
+
+	lock     sync.Mutex
+	f        *os.File
+	size     int64
+	openedAt time.Time
+}
+
+// OpenFile 创建path, 不存在的父目录会一起创建
+func OpenFile(path string, r Rotation) (*File, error) {
+	file := &File{path: path, rotation: r}
+	if err := file.open(); err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+// OpenManualFile 同OpenFile, 但只在调用Rotate时滚动, 用于需要在边界上滚动的录制文件
+func OpenManualFile(path string, r Rotation) (*File, error) {
+	file := &File{path: path, rotation: r, manual: true}
+	if err := file.open(); err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+func (self *File) open() (err error) {
+	if err = os.MkdirAll(filepath.Dir(self.path), 0755); err != nil {
+		return
+	}
+	if self.f, err = os.Create(self.path); err != nil {
+		return
+	}
+	self.size = 0
+	self.openedAt = time.Now()
+	return
+}
+
+// Name 当前写入的文件路径
+func (self *File) Name() string {
+	return self.path
+}
+
+// Write 写入数据, 非manual模式下超过滚动条件时先滚动
+func (self *File) Write(p []byte) (n int, err error) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if self.f == nil {
+		return 0, os.ErrClosed
+	}
+	if !self.manual && self.size > 0 && self.due(int64(len(p))) {
+		if err = self.rotate(); err != nil {
+			return
+		}
+	}
+	n, err = self.f.Write(p)
+	self.size += int64(n)
+	return
+}
+
+// Due 是否已经达到滚动条件
+func (self *File) Due() bool {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return self.size > 0 && self.due(0)
+}
+
+func (self *File) due(incoming int64) bool {
+	r := self.rotation
+	return (r.MaxSize > 0 && self.size+incoming > r.MaxSize) ||
+		(r.MaxAge > 0 && time.Since(self.openedAt) >= r.MaxAge)
+}
+
+// Rotate 立即滚动
+func (self *File) Rotate() error {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if self.f == nil {
+		return os.ErrClosed
+	}
+	return self.rotate()
+}
+
+func (self *File) rotate() (err error) {
+	if err = self.f.Close(); err != nil {
+		log.Warn().Err(err).Str("file", self.path).Msg("[output] close before rotate failed")
+	}
+	self.f = nil
+	ext := filepath.Ext(self.path)
+	backup := strings.TrimSuffix(self.path, ext) + "." + time.Now().Format(rotateLayout) + ext
+	if err = os.Rename(self.path, backup); err != nil {
+		return
+	}
+	if err = self.open(); err != nil {
+		return
+	}
+	self.cleanup()
+	return
+}
+
+// cleanup 按MaxBackups和Retention删除旧的滚动文件
+func (self *File) cleanup() {
+	r := self.rotation
+	if r.MaxBackups <= 0 && r.Retention <= 0 {
+		return
+	}
+	backups := Backups(self.path)
+	// Backups按时间升序, 从最新的开始保留
+	kept := 0
+	for i := len(backups) - 1; i >= 0; i-- {
+		b := backups[i]
+		expired := r.Retention > 0 && time.Since(b.Time) > r.Retention
+		if expired || (r.MaxBackups > 0 && kept >= r.MaxBackups) {
+			if err := os.Remove(b.Path); err != nil {
+				log.Warn().Err(err).Str("file", b.Path).Msg("[output] remove backup failed")
+			}
+			continue
+		}
+		kept++
+	}
+}
+
+// Close 关闭文件
+func (self *File) Close() error {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if self.f == nil {
+		return nil
+	}
+	err := self.f.Close()
+	self.f = nil
+	return err
+}
+
+// Backup 一个滚动文件
+type Backup struct {
+	Path string
+	Time time.Time
+}
+
+// Backups 返回path的所有滚动文件, 按滚动时间升序
+func Backups(path string) []Backup {
+	ext := filepath.Ext(path)
+	prefix := filepath.Base(strings.TrimSuffix(path, ext)) + "."
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		return nil
+	}
+	var backups []Backup
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, ext) {
+			continue
+		}
+		ts := strings.TrimSuffix(strings.TrimPrefix(name, prefix), ext)
+		t, err := time.ParseInLocation(rotateLayout, ts, time.Local)
+		if err != nil {
+			continue
+		}
+		backups = append(backups, Backup{Path: filepath.Join(filepath.Dir(path), name), Time: t})
+	}
+	sort.Slice(backups, func(i, j int) bool { return backups[i].Time.Before(backups[j].Time) })
+	return backups
+}
@@ -0,0 +1,54 @@
+package output
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileRotateBySize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "debug", "rtmpdebug.1.log")
+	f, err := OpenFile(path, Rotation{MaxSize: 10, MaxBackups: 2})
+	require.Nil(t, err)
+	defer f.Close()
+
+	for i := 0; i < 4; i++ {
+		_, err = f.Write([]byte("0123456789"))
+		require.Nil(t, err)
+		// 滚动文件名精确到毫秒
+		time.Sleep(2 * time.Millisecond)
+	}
+
+	b, err := os.ReadFile(path)
+	require.Nil(t, err)
+	require.Equal(t, "0123456789", string(b))
+	backups := Backups(path)
+	require.Len(t, backups, 2)
+	for _, backup := range backups {
+		require.Equal(t, ".log", filepath.Ext(backup.Path))
+	}
+}
+
+func TestManualFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "record.flv")
+	f, err := OpenManualFile(path, Rotation{MaxSize: 4})
+	require.Nil(t, err)
+	defer f.Close()
+
+	_, err = f.Write([]byte("0123456789"))
+	require.Nil(t, err)
+	require.True(t, f.Due())
+	require.Len(t, Backups(path), 0)
+
+	require.Nil(t, f.Rotate())
+	require.False(t, f.Due())
+	require.Len(t, Backups(path), 1)
+}
+
+func TestSafeName(t *testing.T) {
+	require.Equal(t, "rtmpdebug.127.0.0.1_1935.log", SafeName("rtmpdebug.127.0.0.1:1935.log"))
+	require.Equal(t, "a_b_c", SafeName(`a/b\c`))
+}
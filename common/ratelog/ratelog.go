@@ -0,0 +1,152 @@
+// Package ratelog 热点路径上的限速日志: 同一个key在一个周期内只打印前若干条, 其余只计数,
+// 在下一条打印出来的日志中以suppressed字段带上被丢弃的条数
+package ratelog
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// 默认限速: 每个key每秒最多打印5条
+const (
+	DefaultInterval = time.Second
+	DefaultBurst    = 5
+)
+
+// Limiter 按key限速的日志. 零值不可用, 用New创建
+type Limiter struct {
+	interval time.Duration
+	burst    int
+
+	lock  sync.Mutex
+	keys  map[string]*keyState
+	total uint64 // 所有key累计被丢弃的条数
+	now   func() time.Time
+}
+
+type keyState struct {
+	start      time.Time // 当前周期的开始时间
+	count      int       // 当前周期内已打印的条数
+	pending    uint64    // 上次打印之后被丢弃的条数
+	suppressed uint64    // 累计被丢弃的条数
+}
+
+// New 每个key在interval内最多打印burst条, burst不大于0时每个周期打印1条
+func New(interval time.Duration, burst int) *Limiter {
+	if burst <= 0 {
+		burst = 1
+	}
+	return &Limiter{interval: interval, burst: burst, keys: map[string]*keyState{}, now: time.Now}
+}
+
+// Allow 判断key的这条日志是否打印, 打印时返回上次打印之后被丢弃的条数
+func (l *Limiter) Allow(key string) (ok bool, suppressed uint64) {
+	now := l.now()
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	st := l.keys[key]
+	if st == nil {
+		st = &keyState{start: now}
+		l.keys[key] = st
+	}
+	if now.Sub(st.start) >= l.interval {
+		st.start, st.count = now, 0
+	}
+	if st.count >= l.burst {
+		st.pending++
+		st.suppressed++
+		l.total++
+		return false, 0
+	}
+	st.count++
+	suppressed, st.pending = st.pending, 0
+	return true, suppressed
+}
+
+// WithLevel 返回key的日志事件, 级别未开启或被限速时返回nil. zerolog的nil事件可以照常链式调用, 不会打印
+func (l *Limiter) WithLevel(level zerolog.Level, key string) *zerolog.Event {
+	// 先判断级别, 关闭的级别不进入限速计数
+	if level < zerolog.GlobalLevel() || level < log.Logger.GetLevel() {
+		return nil
+	}
+	ok, suppressed := l.Allow(key)
+	if !ok {
+		return nil
+	}
+	e := log.WithLevel(level)
+	if suppressed > 0 {
+		e = e.Uint64("suppressed", suppressed)
+	}
+	return e
+}
+
+// Debug 限速的Debug日志
+func (l *Limiter) Debug(key string) *zerolog.Event {
+	return l.WithLevel(zerolog.DebugLevel, key)
+}
+
+// Info 限速的Info日志
+func (l *Limiter) Info(key string) *zerolog.Event {
+	return l.WithLevel(zerolog.InfoLevel, key)
+}
+
+// Warn 限速的Warn日志
+func (l *Limiter) Warn(key string) *zerolog.Event {
+	return l.WithLevel(zerolog.WarnLevel, key)
+}
+
+// Error 限速的Error日志
+func (l *Limiter) Error(key string) *zerolog.Event {
+	return l.WithLevel(zerolog.ErrorLevel, key)
+}
+
+// Suppressed 所有key累计被丢弃的条数
+func (l *Limiter) Suppressed() uint64 {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.total
+}
+
+// Counter 一个key的丢弃计数
+type Counter struct {
+	Key        string `json:"key"`
+	Suppressed uint64 `json:"suppressed"`
+}
+
+// Counters 每个有过丢弃的key的累计丢弃条数, 按条数从多到少排序
+func (l *Limiter) Counters() []Counter {
+	l.lock.Lock()
+	counters := make([]Counter, 0, len(l.keys))
+	for k, st := range l.keys {
+		if st.suppressed > 0 {
+			counters = append(counters, Counter{Key: k, Suppressed: st.suppressed})
+		}
+	}
+	l.lock.Unlock()
+	sort.Slice(counters, func(i, j int) bool {
+		if counters[i].Suppressed != counters[j].Suppressed {
+			return counters[i].Suppressed > counters[j].Suppressed
+		}
+		return counters[i].Key < counters[j].Key
+	})
+	return counters
+}
+
+// Default queue/rtmp/slice等包共用的限速器
+var Default = New(DefaultInterval, DefaultBurst)
+
+// Debug 用Default打印限速的Debug日志
+func Debug(key string) *zerolog.Event { return Default.Debug(key) }
+
+// Info 用Default打印限速的Info日志
+func Info(key string) *zerolog.Event { return Default.Info(key) }
+
+// Warn 用Default打印限速的Warn日志
+func Warn(key string) *zerolog.Event { return Default.Warn(key) }
+
+// Error 用Default打印限速的Error日志
+func Error(key string) *zerolog.Event { return Default.Error(key) }
@@ -0,0 +1,72 @@
+package ratelog
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimiter(t *testing.T) {
+	now := time.Unix(1000, 0)
+	l := New(time.Second, 2)
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		ok, suppressed := l.Allow("a")
+		require.True(t, ok)
+		require.Equal(t, uint64(0), suppressed)
+	}
+	for i := 0; i < 3; i++ {
+		ok, _ := l.Allow("a")
+		require.False(t, ok)
+	}
+	// 不同key互不影响
+	ok, _ := l.Allow("b")
+	require.True(t, ok)
+
+	now = now.Add(time.Second)
+	ok, suppressed := l.Allow("a")
+	require.True(t, ok)
+	require.Equal(t, uint64(3), suppressed)
+	ok, suppressed = l.Allow("a")
+	require.True(t, ok)
+	require.Equal(t, uint64(0), suppressed)
+	ok, _ = l.Allow("a")
+	require.False(t, ok)
+
+	require.Equal(t, uint64(4), l.Suppressed())
+	require.Equal(t, []Counter{{Key: "a", Suppressed: 4}}, l.Counters())
+}
+
+func TestLimiterEvent(t *testing.T) {
+	var out bytes.Buffer
+	old := log.Logger
+	log.Logger = zerolog.New(&out).Level(zerolog.InfoLevel)
+	defer func() { log.Logger = old }()
+
+	now := time.Unix(1000, 0)
+	l := New(time.Second, 1)
+	l.now = func() time.Time { return now }
+
+	// 未开启的级别不计数
+	l.Debug("k").Msg("debug")
+	require.Equal(t, uint64(0), l.Suppressed())
+
+	for i := 0; i < 3; i++ {
+		l.Info("k").Int("i", i).Msg("hot")
+	}
+	now = now.Add(time.Second)
+	l.Info("k").Int("i", 3).Msg("hot")
+
+	lines := bytes.Split(bytes.TrimSpace(out.Bytes()), []byte("\n"))
+	require.Len(t, lines, 2)
+	var last map[string]interface{}
+	require.Nil(t, json.Unmarshal(lines[1], &last))
+	require.Equal(t, float64(3), last["i"])
+	require.Equal(t, float64(2), last["suppressed"])
+}
@@ -0,0 +1,52 @@
+// Package seed 会话级随机种子: 故障注入、合成源等所有随机行为都从同一个种子派生,
+// 种子记录在日志和运行报告中, 相同的种子可以精确重放一次运行
+package seed
+
+import (
+	"hash/fnv"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+var (
+	lock    sync.RWMutex
+	session int64
+)
+
+// Init 设置会话种子, s为0时按当前时间随机选取, 返回实际使用的种子.
+// 同时用该种子初始化math/rand的全局源, 使未单独持有rand.Rand的随机行为也可重放
+func Init(s int64) int64 {
+	if s == 0 {
+		s = time.Now().UnixNano()
+	}
+	lock.Lock()
+	session = s
+	lock.Unlock()
+	rand.Seed(s)
+	return s
+}
+
+// Get 当前的会话种子, 未Init时为0
+func Get() int64 {
+	lock.RLock()
+	defer lock.RUnlock()
+	return session
+}
+
+// Derive 为名为name的组件派生子种子, 同一会话种子下同名组件总是得到相同的值,
+// 不同组件之间互不相关, 增加新的随机组件不会改变已有组件的随机序列
+func Derive(name string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	s := int64(h.Sum64()) ^ Get()
+	if s == 0 {
+		s = 1
+	}
+	return s
+}
+
+// New 返回组件name专用的随机数生成器
+func New(name string) *rand.Rand {
+	return rand.New(rand.NewSource(Derive(name)))
+}
@@ -0,0 +1,29 @@
+package seed
+
+import "testing"
+
+func TestDerive(t *testing.T) {
+	Init(42)
+	if Get() != 42 {
+		t.Fatalf("expected session seed 42, got %d", Get())
+	}
+	a, b := Derive("seek"), Derive("drift")
+	if a == b {
+		t.Fatal("components should get different seeds")
+	}
+	if Derive("seek") != a {
+		t.Fatal("derive should be deterministic")
+	}
+	x, y := New("seek").Int63(), New("seek").Int63()
+	if x != y {
+		t.Fatalf("same seed got %d and %d", x, y)
+	}
+
+	Init(43)
+	if Derive("seek") == a {
+		t.Fatal("different session seed should change derived seed")
+	}
+	if Init(0) == 0 {
+		t.Fatal("zero seed should be replaced")
+	}
+}
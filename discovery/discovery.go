@@ -0,0 +1,323 @@
+// Package discovery 局域网内streamer实例的发现, 基于mDNS(RFC 6762)和DNS-SD(RFC 6763).
+// 实例以_streamer._tcp服务通告, TXT记录中带有版本、服务地址和流列表, 也可以用avahi-browse/dns-sd浏览
+package discovery
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	DefaultGroup    = "224.0.0.251:5353"
+	DefaultInterval = 5 * time.Second
+
+	mdnsPort   = 5353
+	defaultTTL = 120
+	// legacyTTL 传统单播查询(来源端口不是5353)的响应TTL不超过10秒
+	legacyTTL = 10
+
+	maxMsgSize = 9000
+	// maxTXTSize TXT记录的总长度, 流太多时只通告前面的流
+	maxTXTSize = 6000
+)
+
+var (
+	// serviceName DNS-SD服务类型_streamer._tcp.local.
+	serviceName = dnsName{"_streamer", "_tcp", "local"}
+	// servicesName DNS-SD服务类型枚举
+	servicesName = dnsName{"_services", "_dns-sd", "_udp", "local"}
+)
+
+// Announcement 实例的通告信息
+type Announcement struct {
+	Name      string   `json:"name"`
+	Host      string   `json:"host"`
+	Version   string   `json:"version"`
+	Endpoints []string `json:"endpoints,omitempty"`
+	Streams   []string `json:"streams,omitempty"`
+	Addr      string   `json:"-"` // 收到响应的来源地址
+}
+
+// instanceName DNS-SD实例名, 不同主机上同名命令的实例以主机名区分
+func (a *Announcement) instanceName() dnsName {
+	return append(dnsName{a.Name + "@" + hostLabel(a.Host)}, serviceName...)
+}
+
+// records 实例的PTR/SRV/TXT/A记录, SRV的端口取第一个endpoint的端口
+func (a *Announcement) records(ttl uint32) []record {
+	instance := a.instanceName()
+	host := dnsName{hostLabel(a.Host), "local"}
+	txt := []string{"name=" + a.Name, "version=" + a.Version}
+	for _, e := range a.Endpoints {
+		txt = append(txt, "endpoint="+e)
+	}
+	size := 0
+	for _, s := range a.Streams {
+		if size += len(s) + 8; size > maxTXTSize {
+			break
+		}
+		txt = append(txt, "stream="+s)
+	}
+	rs := []record{
+		{name: serviceName, rtype: typePTR, class: classIN, ttl: ttl, target: instance},
+		{name: instance, rtype: typeSRV, class: classIN | classTopBit, ttl: ttl, target: host, port: endpointPort(a.Endpoints)},
+		{name: instance, rtype: typeTXT, class: classIN | classTopBit, ttl: ttl, txt: txt},
+	}
+	for _, ip := range localIPv4() {
+		rs = append(rs, record{name: host, rtype: typeA, class: classIN | classTopBit, ttl: ttl, ip: ip})
+	}
+	return rs
+}
+
+// answer 对查询中和本实例相关的问题生成响应记录, unicast表示有问题要求单播响应
+func answer(qs []question, a Announcement, ttl uint32) (rs []record, unicast bool) {
+	instance := a.instanceName()
+	var enumerated, full bool
+	for _, q := range qs {
+		if q.qtype != typePTR && q.qtype != typeSRV && q.qtype != typeTXT && q.qtype != typeANY {
+			continue
+		}
+		switch {
+		case q.name.equal(servicesName):
+			if !enumerated {
+				rs = append(rs, record{name: servicesName, rtype: typePTR, class: classIN, ttl: ttl, target: serviceName})
+				enumerated = true
+			}
+		case q.name.equal(serviceName), q.name.equal(instance):
+			if !full {
+				rs = append(rs, a.records(ttl)...)
+				full = true
+			}
+		default:
+			continue
+		}
+		if q.qclass&classTopBit != 0 {
+			unicast = true
+		}
+	}
+	return
+}
+
+// collect 取出响应中通告的实例, TTL为0的是实例下线的goodbye, 忽略
+func collect(m *dnsMessage) (list []Announcement) {
+	for _, ptr := range m.records {
+		if ptr.rtype != typePTR || ptr.ttl == 0 || !ptr.name.equal(serviceName) || len(ptr.target) == 0 {
+			continue
+		}
+		a := Announcement{Name: ptr.target[0]}
+		for _, r := range m.records {
+			if !r.name.equal(ptr.target) {
+				continue
+			}
+			switch r.rtype {
+			case typeSRV:
+				if len(r.target) > 0 {
+					a.Host = r.target[0]
+				}
+			case typeTXT:
+				for _, kv := range r.txt {
+					k, v, _ := strings.Cut(kv, "=")
+					switch k {
+					case "name":
+						a.Name = v
+					case "version":
+						a.Version = v
+					case "endpoint":
+						a.Endpoints = append(a.Endpoints, v)
+					case "stream":
+						a.Streams = append(a.Streams, v)
+					}
+				}
+			}
+		}
+		list = append(list, a)
+	}
+	return
+}
+
+// listen 组播地址时加入组播组, 单播地址时直接监听, 用于没有组播的环境
+func listen(addr *net.UDPAddr) (*net.UDPConn, error) {
+	if addr.IP.IsMulticast() {
+		return net.ListenMulticastUDP("udp4", nil, addr)
+	}
+	return net.ListenUDP("udp4", addr)
+}
+
+// Advertise 在group上响应_streamer._tcp的查询并周期性发送通告, 阻塞直到ctx结束, 结束时发送goodbye.
+// announce在每次响应前调用, 用于获取最新的流列表
+func Advertise(ctx context.Context, group string, interval time.Duration, announce func() Announcement) error {
+	addr, err := net.ResolveUDPAddr("udp4", group)
+	if err != nil {
+		return err
+	}
+	conn, err := listen(addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	current := func() Announcement {
+		a := announce()
+		if a.Host == "" {
+			a.Host, _ = os.Hostname()
+		}
+		return a
+	}
+	send := func(m *dnsMessage, to *net.UDPAddr) {
+		if _, err := conn.WriteToUDP(m.pack(), to); err != nil {
+			log.Debug().Err(err).Str("to", to.String()).Msg("[discovery] send response failed")
+		}
+	}
+
+	go func() {
+		<-ctx.Done()
+		a := current()
+		send(&dnsMessage{response: true, records: a.records(0)}, addr)
+		conn.Close()
+	}()
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			a := current()
+			send(&dnsMessage{response: true, records: a.records(defaultTTL)}, addr)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	buf := make([]byte, maxMsgSize)
+	for {
+		n, from, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		m, err := parseMessage(buf[:n])
+		if err != nil || m.response {
+			continue
+		}
+		legacy := from.Port != mdnsPort
+		ttl := uint32(defaultTTL)
+		if legacy {
+			ttl = legacyTTL
+		}
+		rs, unicast := answer(m.questions, current(), ttl)
+		if len(rs) == 0 {
+			continue
+		}
+		resp := &dnsMessage{response: true, records: rs}
+		to := addr
+		if legacy {
+			// 传统单播查询: 回复到来源端口, 带上查询的ID和问题, 不设置cache-flush
+			resp.id, resp.questions = m.id, m.questions
+			for i := range rs {
+				rs[i].class &^= classTopBit
+			}
+			to = from
+		} else if unicast || !addr.IP.IsMulticast() {
+			to = from
+		}
+		send(resp, to)
+	}
+}
+
+// Discover 向group查询_streamer._tcp服务并收集wait时长内的响应, 同一来源的同一实例只保留最新的一条
+func Discover(ctx context.Context, group string, wait time.Duration) ([]Announcement, error) {
+	addr, err := net.ResolveUDPAddr("udp4", group)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenUDP("udp4", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	query := &dnsMessage{questions: []question{{name: serviceName, qtype: typePTR, qclass: classIN | classTopBit}}}
+	if _, err = conn.WriteToUDP(query.pack(), addr); err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(wait)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetReadDeadline(deadline)
+
+	var result []Announcement
+	index := make(map[string]int)
+	buf := make([]byte, maxMsgSize)
+	for {
+		n, from, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				return result, nil
+			}
+			return result, err
+		}
+		m, err := parseMessage(buf[:n])
+		if err != nil || !m.response {
+			continue
+		}
+		for _, a := range collect(m) {
+			a.Addr = from.String()
+			key := a.Addr + "/" + a.Name
+			if i, ok := index[key]; ok {
+				result[i] = a
+				continue
+			}
+			index[key] = len(result)
+			result = append(result, a)
+		}
+	}
+}
+
+// hostLabel 主机名的第一个label, 作为.local.下的主机名
+func hostLabel(host string) string {
+	if i := strings.IndexByte(host, '.'); i >= 0 {
+		host = host[:i]
+	}
+	if host == "" {
+		return "streamer"
+	}
+	return host
+}
+
+// endpointPort 第一个endpoint的端口, 没有时为0
+func endpointPort(endpoints []string) uint16 {
+	if len(endpoints) == 0 {
+		return 0
+	}
+	u, err := url.Parse(endpoints[0])
+	if err != nil {
+		return 0
+	}
+	port, _ := strconv.ParseUint(u.Port(), 10, 16)
+	return uint16(port)
+}
+
+// localIPv4 本机非loopback的IPv4地址
+func localIPv4() (ips []net.IP) {
+	addrs, _ := net.InterfaceAddrs()
+	for _, addr := range addrs {
+		if ipnet, ok := addr.(*net.IPNet); ok && !ipnet.IP.IsLoopback() {
+			if ip := ipnet.IP.To4(); ip != nil {
+				ips = append(ips, ip)
+			}
+		}
+	}
+	return
+}
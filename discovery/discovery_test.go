@@ -0,0 +1,86 @@
+package discovery
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdvertiseDiscover(t *testing.T) {
+	// 没有组播的环境中直接向单播地址查询, 响应按传统单播查询回到查询端口
+	l, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.Nil(t, err)
+	group := l.LocalAddr().String()
+	l.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- Advertise(ctx, group, time.Hour, func() Announcement {
+			return Announcement{Name: "serve", Host: "lab1.example.com", Version: "1.2.3",
+				Endpoints: []string{"rtmp://10.0.0.1:1935", "http://10.0.0.1:8080"}, Streams: []string{"live/a", "live/b"}}
+		})
+	}()
+
+	var list []Announcement
+	for i := 0; i < 20 && len(list) == 0; i++ {
+		list, err = Discover(context.Background(), group, 100*time.Millisecond)
+		require.Nil(t, err)
+	}
+	require.Len(t, list, 1)
+	a := list[0]
+	require.Equal(t, "serve", a.Name)
+	require.Equal(t, "lab1", a.Host)
+	require.Equal(t, "1.2.3", a.Version)
+	require.Equal(t, []string{"rtmp://10.0.0.1:1935", "http://10.0.0.1:8080"}, a.Endpoints)
+	require.Equal(t, []string{"live/a", "live/b"}, a.Streams)
+	require.Equal(t, group, a.Addr)
+
+	cancel()
+	require.Nil(t, <-done)
+}
+
+func TestDNSMessage(t *testing.T) {
+	a := Announcement{Name: "serve", Host: "lab1", Version: "1.0", Endpoints: []string{"rtmp://[::1]:1936"}}
+	rs := a.records(defaultTTL)
+	require.Equal(t, uint16(1936), rs[1].port)
+
+	// 查询服务类型枚举和实例, 其他问题不响应
+	rs, unicast := answer([]question{{name: servicesName, qtype: typePTR, qclass: classIN}}, a, defaultTTL)
+	require.False(t, unicast)
+	require.Len(t, rs, 1)
+	require.True(t, rs[0].target.equal(serviceName))
+	rs, unicast = answer([]question{{name: dnsName{"SERVE@LAB1", "_streamer", "_tcp", "local"}, qtype: typeANY, qclass: classIN | classTopBit}}, a, defaultTTL)
+	require.True(t, unicast)
+	require.True(t, len(rs) >= 3)
+	rs, _ = answer([]question{{name: dnsName{"_http", "_tcp", "local"}, qtype: typePTR, qclass: classIN}}, a, defaultTTL)
+	require.Empty(t, rs)
+
+	// 编码后再解码
+	m, err := parseMessage((&dnsMessage{response: true, records: a.records(defaultTTL)}).pack())
+	require.Nil(t, err)
+	list := collect(m)
+	require.Len(t, list, 1)
+	require.Equal(t, "serve", list[0].Name)
+	require.Equal(t, []string{"rtmp://[::1]:1936"}, list[0].Endpoints)
+
+	// 其他实现的响应使用名字压缩
+	b := []byte{0, 0, 0x84, 0, 0, 0, 0, 2, 0, 0, 0, 0}
+	b = append(b, 9, '_', 's', 't', 'r', 'e', 'a', 'm', 'e', 'r', 4, '_', 't', 'c', 'p', 5, 'l', 'o', 'c', 'a', 'l', 0)
+	b = append(b, 0, typePTR, 0, classIN, 0, 0, 0, 120, 0, 6, 3, 'o', 'n', 'e', 0xc0, 12)
+	// TXT的名字指向PTR的RDATA
+	b = append(b, 0xc0, 44, 0, typeTXT, 0x80, classIN, 0, 0, 0, 120, 0, 10, 9, 'v', 'e', 'r', 's', 'i', 'o', 'n', '=', '2')
+	m, err = parseMessage(b)
+	require.Nil(t, err)
+	list = collect(m)
+	require.Equal(t, []Announcement{{Name: "one", Version: "2"}}, list)
+
+	// 指针循环和越界
+	_, err = parseMessage([]byte{0, 0, 0x84, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0xc0, 12})
+	require.Equal(t, errMalformed, err)
+	_, err = parseMessage(b[:len(b)-3])
+	require.Equal(t, errMalformed, err)
+}
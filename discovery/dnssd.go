@@ -0,0 +1,258 @@
+package discovery
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"strings"
+)
+
+// DNS资源记录类型和类
+const (
+	typeA   = 1
+	typePTR = 12
+	typeTXT = 16
+	typeSRV = 33
+	typeANY = 255
+
+	classIN = 1
+	// classTopBit 查询中表示要求单播响应(QU), 响应中表示cache-flush
+	classTopBit = 0x8000
+
+	flagResponse = 0x8400 // QR和AA
+
+	maxPointerJumps = 16
+)
+
+var errMalformed = errors.New("discovery: malformed dns message")
+
+// dnsName 按label保存的域名, 实例名label中可以含有'.'
+type dnsName []string
+
+func (n dnsName) equal(o dnsName) bool {
+	if len(n) != len(o) {
+		return false
+	}
+	for i := range n {
+		if !strings.EqualFold(n[i], o[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func (n dnsName) String() string {
+	return strings.Join(n, ".") + "."
+}
+
+type question struct {
+	name   dnsName
+	qtype  uint16
+	qclass uint16
+}
+
+// record 资源记录, 编码时由rdata生成RDATA, 解码时填充对应类型的字段
+type record struct {
+	name  dnsName
+	rtype uint16
+	class uint16
+	ttl   uint32
+
+	target dnsName  // PTR指向的名字或SRV的目标主机
+	port   uint16   // SRV
+	txt    []string // TXT
+	ip     net.IP   // A
+}
+
+type dnsMessage struct {
+	id        uint16
+	response  bool
+	questions []question
+	records   []record // 解码时包括answer、authority和additional
+}
+
+func appendUint16(b []byte, v uint16) []byte {
+	return append(b, byte(v>>8), byte(v))
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	return append(b, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+func appendName(b []byte, n dnsName) []byte {
+	for _, label := range n {
+		if len(label) > 63 {
+			label = label[:63]
+		}
+		b = append(b, byte(len(label)))
+		b = append(b, label...)
+	}
+	return append(b, 0)
+}
+
+func (r *record) rdata() []byte {
+	switch r.rtype {
+	case typePTR:
+		return appendName(nil, r.target)
+	case typeSRV:
+		b := []byte{0, 0, 0, 0, byte(r.port >> 8), byte(r.port)}
+		return appendName(b, r.target)
+	case typeTXT:
+		var b []byte
+		for _, s := range r.txt {
+			if len(s) > 255 {
+				s = s[:255]
+			}
+			b = append(b, byte(len(s)))
+			b = append(b, s...)
+		}
+		if len(b) == 0 {
+			b = []byte{0}
+		}
+		return b
+	case typeA:
+		return r.ip.To4()
+	}
+	return nil
+}
+
+// pack 编码消息, 不做名字压缩, 所有记录都放在answer中
+func (m *dnsMessage) pack() []byte {
+	var flags uint16
+	if m.response {
+		flags = flagResponse
+	}
+	b := make([]byte, 12, 512)
+	binary.BigEndian.PutUint16(b[0:], m.id)
+	binary.BigEndian.PutUint16(b[2:], flags)
+	binary.BigEndian.PutUint16(b[4:], uint16(len(m.questions)))
+	binary.BigEndian.PutUint16(b[6:], uint16(len(m.records)))
+	for _, q := range m.questions {
+		b = appendName(b, q.name)
+		b = appendUint16(b, q.qtype)
+		b = appendUint16(b, q.qclass)
+	}
+	for i := range m.records {
+		r := &m.records[i]
+		b = appendName(b, r.name)
+		b = appendUint16(b, r.rtype)
+		b = appendUint16(b, r.class)
+		b = appendUint32(b, r.ttl)
+		data := r.rdata()
+		b = appendUint16(b, uint16(len(data)))
+		b = append(b, data...)
+	}
+	return b
+}
+
+// readName 读取off处的名字, 支持名字压缩, 返回名字之后的偏移
+func readName(b []byte, off int) (n dnsName, next int, err error) {
+	next = -1
+	for jumps := 0; ; {
+		if off >= len(b) {
+			return nil, 0, errMalformed
+		}
+		l := int(b[off])
+		switch {
+		case l == 0:
+			if next < 0 {
+				next = off + 1
+			}
+			return n, next, nil
+		case l&0xc0 == 0xc0:
+			if off+1 >= len(b) || jumps >= maxPointerJumps {
+				return nil, 0, errMalformed
+			}
+			if next < 0 {
+				next = off + 2
+			}
+			off = int(binary.BigEndian.Uint16(b[off:]) & 0x3fff)
+			jumps++
+		case l&0xc0 != 0:
+			return nil, 0, errMalformed
+		default:
+			if off+1+l > len(b) {
+				return nil, 0, errMalformed
+			}
+			n = append(n, string(b[off+1:off+1+l]))
+			off += 1 + l
+		}
+	}
+}
+
+// parseMessage 解码消息, 不认识的记录类型只保留头部字段
+func parseMessage(b []byte) (m *dnsMessage, err error) {
+	if len(b) < 12 {
+		return nil, errMalformed
+	}
+	m = &dnsMessage{
+		id:       binary.BigEndian.Uint16(b[0:]),
+		response: b[2]&0x80 != 0,
+	}
+	qdcount := int(binary.BigEndian.Uint16(b[4:]))
+	rrcount := int(binary.BigEndian.Uint16(b[6:])) + int(binary.BigEndian.Uint16(b[8:])) + int(binary.BigEndian.Uint16(b[10:]))
+	off := 12
+	for i := 0; i < qdcount; i++ {
+		var q question
+		if q.name, off, err = readName(b, off); err != nil {
+			return nil, err
+		}
+		if off+4 > len(b) {
+			return nil, errMalformed
+		}
+		q.qtype = binary.BigEndian.Uint16(b[off:])
+		q.qclass = binary.BigEndian.Uint16(b[off+2:])
+		off += 4
+		m.questions = append(m.questions, q)
+	}
+	for i := 0; i < rrcount; i++ {
+		var r record
+		if r.name, off, err = readName(b, off); err != nil {
+			return nil, err
+		}
+		if off+10 > len(b) {
+			return nil, errMalformed
+		}
+		r.rtype = binary.BigEndian.Uint16(b[off:])
+		r.class = binary.BigEndian.Uint16(b[off+2:])
+		r.ttl = binary.BigEndian.Uint32(b[off+4:])
+		rdlen := int(binary.BigEndian.Uint16(b[off+8:]))
+		off += 10
+		if off+rdlen > len(b) {
+			return nil, errMalformed
+		}
+		data := b[off : off+rdlen]
+		switch r.rtype {
+		case typePTR:
+			if r.target, _, err = readName(b, off); err != nil {
+				return nil, err
+			}
+		case typeSRV:
+			if rdlen < 7 {
+				return nil, errMalformed
+			}
+			r.port = binary.BigEndian.Uint16(data[4:])
+			if r.target, _, err = readName(b, off+6); err != nil {
+				return nil, err
+			}
+		case typeTXT:
+			for len(data) > 0 {
+				l := int(data[0])
+				if 1+l > len(data) {
+					return nil, errMalformed
+				}
+				if l > 0 {
+					r.txt = append(r.txt, string(data[1:1+l]))
+				}
+				data = data[1+l:]
+			}
+		case typeA:
+			if rdlen == net.IPv4len {
+				r.ip = net.IP(append([]byte(nil), data...))
+			}
+		}
+		off += rdlen
+		m.records = append(m.records, r)
+	}
+	return m, nil
+}
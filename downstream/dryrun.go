@@ -0,0 +1,50 @@
+package downstream
+
+import (
+	"context"
+	"io"
+	"net/http"
+
+	"github.com/bugVanisher/streamer/common/errs"
+	"github.com/bugVanisher/streamer/common/fingerprint"
+	"github.com/bugVanisher/streamer/media/av/avutil"
+	"github.com/bugVanisher/streamer/media/container/flv"
+)
+
+// DryRun 拉取http-flv流, 只读取音视频头和第一个GOP, 检查后断开连接
+func DryRun(ctx context.Context, url string) (report avutil.GOPReport, err error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return report, errs.Wrapf(errs.ErrConnectURL, "url: %s: %v", url, err)
+	}
+	fingerprint.GetConfig().Apply(req)
+	response, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return report, errs.Wrapf(errs.ErrConnectURL, "url: %s: %v", url, err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return report, errs.Wrapf(errs.ErrStreamNotExist, "url: %s", url)
+	}
+
+	demuxer := flv.NewDemuxer(response.Body)
+	streams, err := demuxer.Streams()
+	if err != nil {
+		return
+	}
+	checker := avutil.NewGOPChecker(streams)
+	for {
+		pkt, rerr := demuxer.ReadPacket()
+		if rerr == io.EOF {
+			break
+		}
+		if rerr != nil {
+			err = rerr
+			break
+		}
+		if checker.Add(pkt) {
+			break
+		}
+	}
+	return checker.Report(), err
+}
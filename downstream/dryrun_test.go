@@ -0,0 +1,79 @@
+package downstream
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bugVanisher/streamer/common/errs"
+	"github.com/bugVanisher/streamer/media/av"
+	"github.com/bugVanisher/streamer/media/codec/h264parser"
+	"github.com/bugVanisher/streamer/media/container/flv"
+	"github.com/bugVanisher/streamer/media/container/flv/flvio"
+)
+
+// testFLV 两个GOP的H.264视频, 每5帧一个关键帧, 帧间隔40ms
+func testFLV(t *testing.T) []byte {
+	sps := []byte{0x67, 0x64, 0x00, 0x1e, 0xac, 0xd9, 0x40, 0xa0, 0x2f, 0xf9, 0x70, 0x11, 0x00, 0x00, 0x03,
+		0x00, 0x01, 0x00, 0x00, 0x03, 0x00, 0x32, 0x0f, 0x16, 0x2d, 0x96}
+	h264, err := h264parser.NewCodecDataFromSPSAndPPS(sps, []byte{0x68, 0xeb, 0xe3, 0xcb, 0x22, 0xc0})
+	require.Nil(t, err)
+
+	var b bytes.Buffer
+	m := flv.NewMuxer(&b)
+	require.Nil(t, m.WriteHeader([]av.CodecData{h264}))
+	for i := 0; i < 10; i++ {
+		require.Nil(t, m.WritePacket(av.Packet{
+			IsKeyFrame:    i%5 == 0,
+			DataType:      int8(flvio.TAG_VIDEO),
+			AVCPacketType: av.AVC_NALU,
+			Time:          av.MediaTimeFromMs(int32(i * 40)),
+			Data:          bytes.Repeat([]byte{byte(i + 1)}, 100),
+		}))
+	}
+	require.Nil(t, m.WriteTrailer())
+	return b.Bytes()
+}
+
+func TestDryRun(t *testing.T) {
+	data := testFLV(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/live/test.flv" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(data)
+	}))
+	defer srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	report, err := DryRun(ctx, srv.URL+"/live/test.flv")
+	require.Nil(t, err)
+	require.True(t, report.OK(), "%+v", report.Problems)
+	require.Len(t, report.Streams, 1)
+	require.Equal(t, av.H264, report.Streams[0].Type())
+	// 第二个关键帧结束第一个GOP
+	require.Equal(t, 6, report.Packets)
+	require.Equal(t, 200*time.Millisecond, report.GOPDuration)
+
+	_, err = DryRun(ctx, srv.URL+"/live/none.flv")
+	require.Equal(t, errs.ErrStreamNotExist, errors.Cause(err))
+
+	// 连接失败时保留底层错误
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	addr := l.Addr().String()
+	l.Close()
+	_, err = DryRun(ctx, "http://"+addr+"/live/test.flv")
+	require.Equal(t, errs.ErrConnectURL, errors.Cause(err))
+	require.True(t, strings.Contains(err.Error(), "connection refused"), err.Error())
+}
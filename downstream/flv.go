@@ -3,13 +3,18 @@ package downstream
 import (
 	"context"
 	"github.com/bugVanisher/streamer/common/errs"
+	"github.com/bugVanisher/streamer/common/fingerprint"
 	"github.com/bugVanisher/streamer/media/av"
+	"github.com/bugVanisher/streamer/media/av/pktque"
 	"github.com/bugVanisher/streamer/media/container/flv"
+	"github.com/bugVanisher/streamer/media/protocol/hls"
 	"github.com/bugVanisher/streamer/statistics"
+	"github.com/bugVanisher/streamer/utils/loop"
 	"github.com/rs/zerolog/log"
 	"io"
 	"net"
 	"net/http"
+	"sync/atomic"
 	"time"
 )
 
@@ -21,6 +26,38 @@ type FlvDownStreamer struct {
 	height    uint32
 	firstPkt  bool
 	codecType av.CodecType
+	overhead  *statistics.Overhead
+	health    *statistics.Health
+	lastStat  atomic.Value
+
+	// Alerter 可选, 每个统计周期按告警规则检查一次
+	Alerter *statistics.Alerter
+	// NewMuxer 可选, 写入Writer使用的muxer, 默认原样写flv
+	NewMuxer func(w io.Writer) av.Muxer
+	// Discontinuity 可选, 检查拉到的时间戳是否连续, 每次不连续打印日志
+	Discontinuity *pktque.DiscontinuityDetector
+	// Loop 可选, 统计在该Loop中定期计算, 不再每路拉流启动一个goroutine, 用于大量拉流的压测
+	Loop *loop.Loop
+	// LoopDetector 可选, 检查拉到的内容是否循环, 确认循环时打印周期
+	LoopDetector *pktque.LoopDetector
+	// Segmenter 可选, 把拉到的流切成HLS切片, 用于观察源流GOP对切片时长的影响. 出错时停止切片, 不影响拉流
+	Segmenter *hls.Segmenter
+	// ParseSEI 解析拉到的H.264帧中的SEI消息和字幕, Segmenter添加了字幕轨道时需要开启
+	ParseSEI bool
+	// segmentStopped 切片出错后不再写入Segmenter, 只在拉流goroutine中访问
+	segmentStopped bool
+}
+
+// countReader 统计从网络读取的字节数
+type countReader struct {
+	io.ReadCloser
+	overhead *statistics.Overhead
+}
+
+func (r *countReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.overhead.AddWire(uint64(n))
+	return n, err
 }
 
 func NewFlvDownStreamer(url string, writer io.Writer) *FlvDownStreamer {
@@ -50,10 +87,10 @@ func (d *FlvDownStreamer) Pull(ctx context.Context) (bool, error) {
 		return false, errs.Wrapf(errs.ErrConnectURL, "url: %s", d.Url)
 	}
 
-	req.Header.Set("User-Agent", "streamer")
 	req.Header.Set("Accept", "*/*")
 	req.Header.Set("Range", "bytes=0-")
 	req.Header.Set("Connection", "close")
+	fingerprint.GetConfig().Apply(req)
 
 	response, err := httpClient.Do(req)
 	if err != nil {
@@ -65,19 +102,48 @@ func (d *FlvDownStreamer) Pull(ctx context.Context) (bool, error) {
 	}
 	pktCount := 0
 	d.avFlow = statistics.NewAVFlow()
+	d.overhead = statistics.NewOverhead("http-flv")
+	d.health = statistics.NewHealth(statistics.DefaultHealthWindow)
 	t := av.NewTransport(av.WithAfterReadPacket(func(pkt *av.Packet) error {
 		d.avFlow.Stat(pkt)
+		d.overhead.AddMedia(uint64(len(pkt.Data)))
+		if d.Discontinuity != nil && d.Discontinuity.Add(*pkt) {
+			found := d.Discontinuity.Found[len(d.Discontinuity.Found)-1]
+			log.Warn().Str("url", d.Url).Int8("idx", found.Idx).Dur("from", found.From).Dur("to", found.To).
+				Msg("[HTTPFLVIngester] timestamp discontinuity")
+		}
+		if d.LoopDetector != nil && d.LoopDetector.Add(*pkt) {
+			log.Warn().Str("url", d.Url).Dur("period", d.LoopDetector.Period()).
+				Msg("[HTTPFLVIngester] content is looping")
+		}
+		if d.segmenting() {
+			d.segment(d.Segmenter.WritePacket(*pkt))
+		}
 		pktCount++
 		if pktCount%1000 == 0 {
 			log.Debug().Msgf("recv packet count %d\n", pktCount)
 		}
 		return nil
 	}), av.WithAfterReadHeaders(d.AfterReadHeader))
-	muxer := flv.NewMuxer(d.Writer)
-	stop := make(chan bool)
-	go d.LogStatistic(stop)
-	err = t.CopyAV(ctx, muxer, flv.NewDemuxer(response.Body))
-	stop <- true
+	muxer := newRecordMuxer(d.Writer, d.NewMuxer)
+	demuxer := flv.NewDemuxer(&countReader{ReadCloser: response.Body, overhead: d.overhead})
+	demuxer.SetParseSEI(d.ParseSEI)
+	if d.Loop != nil {
+		task := d.Loop.Every(statInterval, d.logStatistic)
+		err = t.CopyAV(ctx, muxer, demuxer)
+		task.Stop()
+	} else {
+		stop := make(chan bool)
+		go d.LogStatistic(stop)
+		err = t.CopyAV(ctx, muxer, demuxer)
+		stop <- true
+	}
+	if d.segmenting() {
+		d.segment(d.Segmenter.WriteTrailer())
+	}
+	if d.Segmenter != nil {
+		log.Info().Str("url", d.Url).Str("report", d.Segmenter.Report().String()).Msg("[HTTPFLVIngester] hls segment statistic")
+	}
 	if err != nil {
 		log.Error().Err(err).Msg("CopyAV error")
 		return false, errs.Wrapf(errs.ErrConnectURL, "url: %s", d.Url)
@@ -85,8 +151,11 @@ func (d *FlvDownStreamer) Pull(ctx context.Context) (bool, error) {
 	return true, nil
 }
 
+// statInterval 统计周期
+const statInterval = 3 * time.Second
+
 func (d *FlvDownStreamer) LogStatistic(done chan bool) {
-	ticker := time.NewTicker(3 * time.Second)
+	ticker := time.NewTicker(statInterval)
 	defer ticker.Stop()
 	time.Sleep(2 * time.Second)
 	for {
@@ -94,28 +163,78 @@ func (d *FlvDownStreamer) LogStatistic(done chan bool) {
 		case <-done:
 			return
 		case <-ticker.C:
-			stat := &statistics.StreamHandler{
-				VideoBitrate:  d.avFlow.VideoBitrate.GetBitrate(),
-				VideoFPS:      d.avFlow.VideoFPS.GetFPS(),
-				AudioFPS:      d.avFlow.AudioFPS.GetFPS(),
-				VideoGop:      d.avFlow.VideoGop.GetGop(),
-				VideoDuration: d.avFlow.VideoDuration.GetDuration(),
-				AudioDuration: d.avFlow.AudioDuration.GetDuration(),
-				AudioBitrate:  d.avFlow.AudioBitrate.GetBitrate(),
-				VideoWidth:    d.width,
-				VideoHeight:   d.height,
-				VideoDelay:    d.avFlow.VideoDelay.GetDelay(),
-			}
-			log.Debug().Any("statistic", stat).Str("codecType", d.codecType.String()).Msgf("%s stat", d.Url)
+			d.logStatistic()
 		}
 	}
+}
+
+// logStatistic 计算一个统计周期的数据, 更新健康分并检查告警
+func (d *FlvDownStreamer) logStatistic() {
+	stat := &statistics.StreamHandler{
+		VideoBitrate:  d.avFlow.VideoBitrate.GetBitrate(),
+		VideoFPS:      d.avFlow.VideoFPS.GetFPS(),
+		AudioFPS:      d.avFlow.AudioFPS.GetFPS(),
+		VideoGop:      d.avFlow.VideoGop.GetGop(),
+		VideoDuration: d.avFlow.VideoDuration.GetDuration(),
+		AudioDuration: d.avFlow.AudioDuration.GetDuration(),
+		AudioBitrate:  d.avFlow.AudioBitrate.GetBitrate(),
+		VideoWidth:    d.width,
+		VideoHeight:   d.height,
+		VideoDelay:    d.avFlow.VideoDelay.GetDelay(),
+		Proto:         d.overhead.Proto,
+		WireBytes:     d.overhead.WireBytes(),
+		MediaBytes:    d.overhead.MediaBytes(),
+		Overhead:      d.overhead.GetOverhead(),
+		LostRefFrames: d.avFlow.VideoRefFrame.GetLost(),
+		ReorderErrors: d.avFlow.VideoRefFrame.GetReorderErrors(),
 
+		DeclaredBitrate: d.avFlow.VideoVBV.GetDeclaredBitrate(),
+		VBVViolations:   d.avFlow.VideoVBV.GetViolations(),
+	}
+	if d.Segmenter != nil {
+		report := d.Segmenter.Report()
+		stat.Segments = report.Count
+		stat.SegmentViolations = report.Violations
+		stat.UnalignedSegments = report.Unaligned
+		stat.SegmentLatencyP95 = report.GenLatency.P95
+		stat.SegmentOverhead = d.Segmenter.Overhead().GetOverhead()
+	}
+	d.health.Add(*stat)
+	stat.Health = d.health.Score()
+	d.lastStat.Store(*stat)
+	if d.Alerter != nil {
+		d.Alerter.Check(stat, time.Now())
+	}
+	log.Debug().Any("statistic", stat).Str("codecType", d.codecType.String()).Msgf("%s stat", d.Url)
+}
+
+// Health 返回当前的健康分
+func (d *FlvDownStreamer) Health() int {
+	if d.health == nil {
+		return 100
+	}
+	return d.health.Score()
+}
+
+// LastStatistic 返回最近一个统计周期的数据
+func (d *FlvDownStreamer) LastStatistic() (stat statistics.StreamHandler, ok bool) {
+	stat, ok = d.lastStat.Load().(statistics.StreamHandler)
+	return
+}
+
+// Degraded 是否有告警正在触发
+func (d *FlvDownStreamer) Degraded() bool {
+	return d.Alerter != nil && d.Alerter.Degraded()
 }
 
 func (d *FlvDownStreamer) AfterReadHeader(data []av.CodecData) error {
 	if !d.firstPkt {
 		log.Info().Msg("[HTTPFLVIngester]read first header")
 	}
+	d.avFlow.SetCodecData(data)
+	if d.segmenting() {
+		d.segment(d.Segmenter.WriteHeader(data))
+	}
 	for _, codec := range data {
 		if codec.Type().IsVideo() {
 			d.codecType = codec.Type()
@@ -127,3 +246,15 @@ func (d *FlvDownStreamer) AfterReadHeader(data []av.CodecData) error {
 	}
 	return nil
 }
+
+func (d *FlvDownStreamer) segmenting() bool {
+	return d.Segmenter != nil && !d.segmentStopped
+}
+
+// segment 切片出错时记录日志并停止切片
+func (d *FlvDownStreamer) segment(err error) {
+	if err != nil {
+		log.Error().Err(err).Str("url", d.Url).Msg("[HTTPFLVIngester] hls segmenter stopped")
+		d.segmentStopped = true
+	}
+}
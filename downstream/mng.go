@@ -2,6 +2,7 @@ package downstream
 
 import (
 	"context"
+	"fmt"
 	"github.com/bugVanisher/streamer/common/errs"
 	"sync"
 	"time"
@@ -50,3 +51,24 @@ func Stop(name string) error {
 	info.(downStreamInfo).cancel()
 	return nil
 }
+
+// GetAllStreamInfos 所有拉流的"名字-时长", 处于告警降级状态的拉流再加上"-degraded"
+func GetAllStreamInfos() (infos []string) {
+	UpStreamerManager.streams.Range(func(key, value interface{}) bool {
+		name := key.(string)
+		pullInfo := value.(downStreamInfo)
+		info := fmt.Sprintf("%s-%s", name, pullInfo.duration)
+		if pullInfo.degraded() {
+			info += "-degraded"
+		}
+		infos = append(infos, info)
+		return true
+	})
+	return infos
+}
+
+// degraded 拉流是否处于告警降级状态
+func (info downStreamInfo) degraded() bool {
+	d, ok := info.downStreamer.(interface{ Degraded() bool })
+	return ok && d.Degraded()
+}
@@ -0,0 +1,74 @@
+package downstream
+
+import (
+	"io"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/bugVanisher/streamer/media/av"
+	"github.com/bugVanisher/streamer/media/container/flv"
+)
+
+// rotator 可以滚动的输出, 如output.File
+type rotator interface {
+	Due() bool
+	Rotate() error
+}
+
+// rotatingMuxer 录制时在关键帧处滚动文件, 新文件重新写入FLV头和sequence header, 每个文件都可以单独播放
+type rotatingMuxer struct {
+	w        rotator
+	newMux   func() av.Muxer
+	muxer    av.Muxer
+	streams  []av.CodecData
+	hasVideo bool
+}
+
+func newRotatingMuxer(w rotator, newMux func() av.Muxer) *rotatingMuxer {
+	return &rotatingMuxer{w: w, newMux: newMux, muxer: newMux()}
+}
+
+func (m *rotatingMuxer) WriteHeader(streams []av.CodecData) error {
+	m.streams = streams
+	m.hasVideo = false
+	for _, s := range streams {
+		if s.Type().IsVideo() {
+			m.hasVideo = true
+		}
+	}
+	return m.muxer.WriteHeader(streams)
+}
+
+func (m *rotatingMuxer) WritePacket(pkt av.Packet) error {
+	boundary := pkt.IsKeyFrame || !m.hasVideo
+	if boundary && !pkt.IsSequenceHeader() && m.w.Due() {
+		if err := m.muxer.WriteTrailer(); err != nil {
+			return err
+		}
+		if err := m.w.Rotate(); err != nil {
+			return err
+		}
+		log.Info().Msg("[record] rotate recording file")
+		m.muxer = m.newMux()
+		if err := m.muxer.WriteHeader(m.streams); err != nil {
+			return err
+		}
+	}
+	return m.muxer.WritePacket(pkt)
+}
+
+func (m *rotatingMuxer) WriteTrailer() error {
+	return m.muxer.WriteTrailer()
+}
+
+// newRecordMuxer 创建录制用的muxer, newMux为nil时为flv, w支持滚动时在关键帧处滚动
+func newRecordMuxer(w io.Writer, newMux func(w io.Writer) av.Muxer) av.Muxer {
+	if newMux == nil {
+		newMux = func(w io.Writer) av.Muxer { return flv.NewMuxer(w) }
+	}
+	r, ok := w.(rotator)
+	if !ok {
+		return newMux(w)
+	}
+	return newRotatingMuxer(r, func() av.Muxer { return newMux(w) })
+}
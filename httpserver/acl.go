@@ -0,0 +1,27 @@
+package httpserver
+
+import (
+	"net/http"
+
+	"github.com/bugVanisher/streamer/common/acl"
+)
+
+// ACLStatsFunc 返回ACL统计, 未启用ACL时ok为false, 由rtmp.Server.ACLStats实现
+type ACLStatsFunc func() (stats acl.Stats, ok bool)
+
+// ACLHandler GET返回ACL的accept、拒绝和限速统计, 未启用ACL时返回404
+func ACLHandler(stats ACLStatsFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", "GET")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		st, ok := stats()
+		if !ok {
+			http.Error(w, "acl not enabled", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, http.StatusOK, st)
+	})
+}
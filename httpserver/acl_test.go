@@ -0,0 +1,33 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bugVanisher/streamer/common/acl"
+)
+
+func TestACLHandler(t *testing.T) {
+	want := acl.Stats{Accepted: 3, DeniedByACL: 1, Throttled: 2, ThrottledTime: time.Second}
+	h := ACLHandler(func() (acl.Stats, bool) { return want, true })
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/acl", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	var got acl.Stats
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+	require.Equal(t, want, got)
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/acl", nil))
+	require.Equal(t, http.StatusMethodNotAllowed, w.Code)
+
+	w = httptest.NewRecorder()
+	ACLHandler(func() (acl.Stats, bool) { return acl.Stats{}, false }).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/acl", nil))
+	require.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,94 @@
+package httpserver
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// AccessPolicy 播放接口的跨域和Referer策略, 零值不限制也不返回CORS头
+type AccessPolicy struct {
+	// AllowOrigins 允许跨域访问的Origin, 如https://player.example.com, "*"允许任意Origin; 为空时不返回CORS头
+	AllowOrigins []string
+	// AllowReferers 允许的Referer域名, 支持*.example.com通配子域名; 为空时不检查Referer
+	AllowReferers []string
+	// AllowEmptyReferer 检查Referer时是否允许不带Referer的请求(如播放器直接打开)
+	AllowEmptyReferer bool
+}
+
+// hostMatch host是否匹配pattern, pattern可以是*.example.com
+func hostMatch(pattern, host string) bool {
+	if pattern == "*" || strings.EqualFold(pattern, host) {
+		return true
+	}
+	if strings.HasPrefix(pattern, "*.") {
+		return strings.HasSuffix(strings.ToLower(host), strings.ToLower(pattern[1:]))
+	}
+	return false
+}
+
+// allowOrigin 返回Access-Control-Allow-Origin的值, 不允许时为空
+func (p AccessPolicy) allowOrigin(origin string) string {
+	for _, o := range p.AllowOrigins {
+		if o == "*" {
+			return "*"
+		}
+		if strings.EqualFold(strings.TrimSuffix(o, "/"), origin) {
+			return origin
+		}
+	}
+	return ""
+}
+
+// refererAllowed Referer是否在白名单中
+func (p AccessPolicy) refererAllowed(referer string) bool {
+	if len(p.AllowReferers) == 0 {
+		return true
+	}
+	if referer == "" {
+		return p.AllowEmptyReferer
+	}
+	u, err := url.Parse(referer)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	for _, pattern := range p.AllowReferers {
+		if hostMatch(pattern, u.Hostname()) {
+			return true
+		}
+	}
+	return false
+}
+
+// Handler 按策略处理h的请求: 回复CORS预检请求, 给允许的Origin加上CORS头, 拒绝不在白名单中的Referer
+func (p AccessPolicy) Handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		allow := ""
+		if origin != "" && len(p.AllowOrigins) > 0 {
+			w.Header().Add("Vary", "Origin")
+			allow = p.allowOrigin(origin)
+		}
+		if allow != "" {
+			w.Header().Set("Access-Control-Allow-Origin", allow)
+			w.Header().Set("Access-Control-Expose-Headers", "Content-Length, Content-Range, Accept-Ranges, ETag")
+		}
+		// 预检请求不带Referer以外的凭据, 只看Origin
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			if allow == "" {
+				http.Error(w, "origin not allowed", http.StatusForbidden)
+				return
+			}
+			w.Header().Set("Access-Control-Allow-Methods", "GET, HEAD, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", "Range, If-None-Match, If-Modified-Since")
+			w.Header().Set("Access-Control-Max-Age", "600")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if !p.refererAllowed(r.Header.Get("Referer")) {
+			http.Error(w, "referer not allowed", http.StatusForbidden)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,55 @@
+package httpserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccessPolicy(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("ok")) })
+	serve := func(p AccessPolicy, method string, header map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/record/live_test.flv", nil)
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		p.Handler(ok).ServeHTTP(rec, req)
+		return rec
+	}
+
+	// 零值不限制, 也不返回CORS头
+	rec := serve(AccessPolicy{}, http.MethodGet, map[string]string{"Origin": "https://a.com", "Referer": "https://a.com/"})
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Empty(t, rec.Header().Get("Access-Control-Allow-Origin"))
+
+	p := AccessPolicy{AllowOrigins: []string{"https://player.example.com"}, AllowReferers: []string{"*.example.com"}}
+	rec = serve(p, http.MethodGet, map[string]string{"Origin": "https://player.example.com", "Referer": "https://player.example.com/test.html"})
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "https://player.example.com", rec.Header().Get("Access-Control-Allow-Origin"))
+	require.Contains(t, rec.Header().Get("Access-Control-Expose-Headers"), "Content-Range")
+
+	// 预检请求
+	rec = serve(p, http.MethodOptions, map[string]string{"Origin": "https://player.example.com", "Access-Control-Request-Method": "GET"})
+	require.Equal(t, http.StatusNoContent, rec.Code)
+	require.Contains(t, rec.Header().Get("Access-Control-Allow-Headers"), "Range")
+	rec = serve(p, http.MethodOptions, map[string]string{"Origin": "https://evil.com", "Access-Control-Request-Method": "GET"})
+	require.Equal(t, http.StatusForbidden, rec.Code)
+
+	// 不允许的Origin没有CORS头, 由浏览器拦截
+	rec = serve(p, http.MethodGet, map[string]string{"Origin": "https://evil.com", "Referer": "https://www.example.com/"})
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Empty(t, rec.Header().Get("Access-Control-Allow-Origin"))
+
+	// Referer白名单
+	require.Equal(t, http.StatusForbidden, serve(p, http.MethodGet, map[string]string{"Referer": "https://evil.com/"}).Code)
+	require.Equal(t, http.StatusForbidden, serve(p, http.MethodGet, nil).Code)
+	p.AllowEmptyReferer = true
+	require.Equal(t, http.StatusOK, serve(p, http.MethodGet, nil).Code)
+
+	p.AllowOrigins = []string{"*"}
+	rec = serve(p, http.MethodGet, map[string]string{"Origin": "https://any.com"})
+	require.Equal(t, "*", rec.Header().Get("Access-Control-Allow-Origin"))
+}
@@ -0,0 +1,87 @@
+package httpserver
+
+import (
+	"net/http"
+	"sync"
+)
+
+// Check 子系统检查, 返回nil表示正常
+type Check func() error
+
+// healthResult /healthz和/readyz的返回
+type healthResult struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks"`
+}
+
+// Health 健康和就绪检查, 各子系统通过AddHealth/AddReady注册
+type Health struct {
+	lock   sync.Mutex
+	health []namedCheck
+	ready  []namedCheck
+}
+
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+// NewHealth 创建健康检查
+func NewHealth() *Health {
+	return &Health{}
+}
+
+// AddHealth 注册存活检查, 失败时/healthz返回503, 通常意味着需要重启
+func (h *Health) AddHealth(name string, c Check) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.health = append(h.health, namedCheck{name, c})
+}
+
+// AddReady 注册就绪检查, 失败时/readyz返回503, 不再接收新的流量. 就绪检查同时包含全部存活检查
+func (h *Health) AddReady(name string, c Check) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.ready = append(h.ready, namedCheck{name, c})
+}
+
+// HealthzHandler 存活探针, 返回每个子系统的状态
+func (h *Health) HealthzHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.lock.Lock()
+		checks := append([]namedCheck(nil), h.health...)
+		h.lock.Unlock()
+		serveChecks(w, r, checks)
+	})
+}
+
+// ReadyzHandler 就绪探针
+func (h *Health) ReadyzHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.lock.Lock()
+		checks := append(append([]namedCheck(nil), h.health...), h.ready...)
+		h.lock.Unlock()
+		serveChecks(w, r, checks)
+	})
+}
+
+func serveChecks(w http.ResponseWriter, r *http.Request, checks []namedCheck) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	res := healthResult{Status: "ok", Checks: make(map[string]string, len(checks))}
+	status := http.StatusOK
+	for _, c := range checks {
+		if err := c.check(); err != nil {
+			res.Checks[c.name] = err.Error()
+			res.Status = "fail"
+			status = http.StatusServiceUnavailable
+			continue
+		}
+		res.Checks[c.name] = "ok"
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, status, res)
+}
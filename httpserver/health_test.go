@@ -0,0 +1,39 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHealth(t *testing.T) {
+	h := NewHealth()
+	var listening bool
+	h.AddHealth("rtmp", func() error { return nil })
+	h.AddReady("rtmp-listener", func() error {
+		if !listening {
+			return errors.New("listener not bound")
+		}
+		return nil
+	})
+
+	rec := httptest.NewRecorder()
+	h.HealthzHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	rec = httptest.NewRecorder()
+	h.ReadyzHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	var res healthResult
+	require.Nil(t, json.Unmarshal(rec.Body.Bytes(), &res))
+	require.Equal(t, healthResult{Status: "fail", Checks: map[string]string{"rtmp": "ok", "rtmp-listener": "listener not bound"}}, res)
+
+	listening = true
+	rec = httptest.NewRecorder()
+	h.ReadyzHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+}
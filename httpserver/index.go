@@ -0,0 +1,171 @@
+package httpserver
+
+import (
+	"fmt"
+	"html/template"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/bugVanisher/streamer/media/protocol/rtmp"
+)
+
+// StreamLister 流的列表, 由rtmp.Server实现
+type StreamLister interface {
+	Streams() []rtmp.StreamInfo
+}
+
+// IndexPage 挂载在/的流索引页, 列出所有流和它们的播放地址, 方便测试时人工点击验证:
+//
+//	GET /                  HTML页面, 每5秒自动刷新
+//	GET /?format=json      JSON, Accept为application/json时同样返回JSON
+//	GET /?format=m3u       M3U播放列表, 可以直接用播放器打开
+type IndexPage struct {
+	Streams StreamLister
+	// RTMPAddr rtmp服务的监听地址, host为空或为未指定地址时使用请求的Host
+	RTMPAddr string
+	// RTMPS rtmp服务使用TLS, 播放地址为rtmps://, 默认端口为443
+	RTMPS bool
+	// PlayURLs 名称(如flv, hls, slice)到播放地址模板的映射, 模板中的{host}, {app}, {stream}, {key}会被替换
+	PlayURLs map[string]string
+}
+
+// indexStream 索引中的一路流
+type indexStream struct {
+	rtmp.StreamInfo
+	Uptime string            `json:"uptime,omitempty"`
+	URLs   map[string]string `json:"urls"`
+}
+
+// indexTemplate 索引页模板, 播放地址由服务端生成, 标记为可信以保留rtmp://等scheme
+var indexTemplate = template.Must(template.New("index").Funcs(template.FuncMap{
+	"playURL": func(s string) template.URL { return template.URL(s) },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="5">
+<title>streamer</title>
+<style>body{font-family:sans-serif}table{border-collapse:collapse}td,th{border:1px solid #ccc;padding:4px 8px;text-align:left}</style>
+</head>
+<body>
+<h1>streams ({{len .}})</h1>
+<p><a href="?format=json">json</a> <a href="?format=m3u">m3u</a> <a href="sessions">sessions</a></p>
+<table>
+<tr><th>stream</th><th>publisher</th><th>uptime</th><th>players</th><th>egress limit</th><th>throttled</th><th>play</th></tr>
+{{range .}}<tr>
+<td>{{.Key}}</td>
+<td>{{if .Publishing}}{{.Publisher}}{{else}}-{{end}}</td>
+<td>{{.Uptime}}</td>
+<td>{{.Players}}</td>
+<td>{{if .EgressLimit}}{{.EgressLimit}} B/s{{end}}</td>
+<td>{{if .Throttled}}{{.Throttled}} ({{.ThrottledTime}}){{end}}</td>
+<td>{{range $name, $url := .URLs}}<a href="{{playURL $url}}">{{$name}}</a> {{end}}</td>
+</tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+func (p *IndexPage) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// 挂载在/时会匹配所有未注册的路径
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	now := time.Now()
+	infos := p.Streams.Streams()
+	streams := make([]indexStream, 0, len(infos))
+	for _, info := range infos {
+		st := indexStream{StreamInfo: info, URLs: p.urls(r, info.Key)}
+		if info.Publishing {
+			st.Uptime = now.Sub(info.PublishAt).Truncate(time.Second).String()
+		}
+		streams = append(streams, st)
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" && strings.Contains(r.Header.Get("Accept"), "application/json") {
+		format = "json"
+	}
+	switch format {
+	case "json":
+		writeJSON(w, http.StatusOK, streams)
+	case "m3u":
+		w.Header().Set("Content-Type", "audio/x-mpegurl")
+		fmt.Fprintln(w, "#EXTM3U")
+		for _, st := range streams {
+			if st.Publishing {
+				fmt.Fprintf(w, "#EXTINF:-1,%s\n%s\n", st.Key, st.URLs["rtmp"])
+			}
+		}
+	case "", "html":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := indexTemplate.Execute(w, streams); err != nil {
+			log.Debug().Err(err).Msg("[http] write index failed")
+		}
+	default:
+		http.Error(w, "unsupported format: "+format, http.StatusBadRequest)
+	}
+}
+
+func (p *IndexPage) scheme() string {
+	if p.RTMPS {
+		return "rtmps"
+	}
+	return "rtmp"
+}
+
+func (p *IndexPage) defaultPort() string {
+	if p.RTMPS {
+		return "443"
+	}
+	return "1935"
+}
+
+// urls 流的播放地址, key为app/stream或vhost/app/stream
+func (p *IndexPage) urls(r *http.Request, key string) map[string]string {
+	vhost, app, stream := "", "", key
+	parts := strings.Split(key, "/")
+	switch len(parts) {
+	case 2:
+		app, stream = parts[0], parts[1]
+	case 3:
+		vhost, app, stream = parts[0], parts[1], parts[2]
+	}
+
+	reqHost := r.Host
+	if h, _, err := net.SplitHostPort(reqHost); err == nil {
+		reqHost = h
+	}
+	rtmpHost := reqHost
+	if h, port, err := net.SplitHostPort(p.RTMPAddr); err == nil {
+		if ip := net.ParseIP(h); h != "" && (ip == nil || !ip.IsUnspecified()) {
+			rtmpHost = h
+		}
+		if port != p.defaultPort() {
+			rtmpHost = net.JoinHostPort(rtmpHost, port)
+		}
+	}
+	play := &url.URL{Scheme: p.scheme(), Host: rtmpHost, Path: "/" + app + "/" + stream}
+	if vhost != "" {
+		play.RawQuery = url.Values{"vhost": {vhost}}.Encode()
+	}
+
+	urls := map[string]string{"rtmp": play.String()}
+	replacer := strings.NewReplacer("{host}", reqHost, "{app}", app, "{stream}", stream, "{key}", key)
+	for name, tmpl := range p.PlayURLs {
+		urls[name] = replacer.Replace(tmpl)
+	}
+	return urls
+}
@@ -0,0 +1,78 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bugVanisher/streamer/media/protocol/rtmp"
+)
+
+type fakeStreams []rtmp.StreamInfo
+
+func (f fakeStreams) Streams() []rtmp.StreamInfo { return f }
+
+func TestIndexPage(t *testing.T) {
+	p := &IndexPage{
+		Streams: fakeStreams{
+			{Key: "live/test", Publishing: true, Publisher: "127.0.0.1:5000", Players: 2, PublishAt: time.Now().Add(-time.Minute)},
+			{Key: "v1/live/idle", Players: 1},
+		},
+		RTMPAddr: ":19350",
+		PlayURLs: map[string]string{"flv": "http://{host}:8080/{app}/{stream}.flv"},
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/?format=json", nil)
+	req.Host = "example.com:8000"
+	rec := httptest.NewRecorder()
+	p.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+	var streams []indexStream
+	require.Nil(t, json.Unmarshal(rec.Body.Bytes(), &streams))
+	require.Equal(t, 2, len(streams))
+	require.Equal(t, 2, streams[0].Players)
+	require.Equal(t, "1m0s", streams[0].Uptime)
+	require.Equal(t, map[string]string{
+		"rtmp": "rtmp://example.com:19350/live/test",
+		"flv":  "http://example.com:8080/live/test.flv",
+	}, streams[0].URLs)
+	require.Equal(t, "rtmp://example.com:19350/live/idle?vhost=v1", streams[1].URLs["rtmp"])
+
+	// Accept为json时返回json, 默认返回html
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept", "application/json")
+	rec = httptest.NewRecorder()
+	p.ServeHTTP(rec, req)
+	require.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+
+	rec = httptest.NewRecorder()
+	p.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	require.True(t, strings.HasPrefix(rec.Header().Get("Content-Type"), "text/html"))
+	require.Contains(t, rec.Body.String(), `<a href="rtmp://example.com:19350/live/test">rtmp</a>`)
+	require.Contains(t, rec.Body.String(), "127.0.0.1:5000")
+
+	// m3u只列出正在推流的流
+	p.RTMPAddr = "10.0.0.1:1935"
+	rec = httptest.NewRecorder()
+	p.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/?format=m3u", nil))
+	require.Equal(t, "#EXTM3U\n#EXTINF:-1,live/test\nrtmp://10.0.0.1/live/test\n", rec.Body.String())
+
+	// rtmps省略443端口
+	p.RTMPAddr, p.RTMPS = "10.0.0.1:443", true
+	rec = httptest.NewRecorder()
+	p.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/?format=m3u", nil))
+	require.Equal(t, "#EXTM3U\n#EXTINF:-1,live/test\nrtmps://10.0.0.1/live/test\n", rec.Body.String())
+	p.RTMPS = false
+
+	rec = httptest.NewRecorder()
+	p.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/missing", nil))
+	require.Equal(t, http.StatusNotFound, rec.Code)
+	rec = httptest.NewRecorder()
+	p.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/?format=xml", nil))
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+}
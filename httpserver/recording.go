@@ -0,0 +1,62 @@
+package httpserver
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// recordingTypes 可以点播的录制文件类型
+var recordingTypes = map[string]string{
+	".flv": "video/x-flv",
+	".mp4": "video/mp4",
+	".ts":  "video/mp2t",
+}
+
+// RecordingHandler 点播dir下的录制文件, 支持Range请求和ETag条件请求, 便于浏览器播放器拖动.
+// 请求路径去掉prefix后作为dir下的相对路径.
+func RecordingHandler(prefix, dir string) http.Handler {
+	return http.StripPrefix(prefix, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		// path.Clean以/开头时不会越过根目录
+		name := path.Clean("/" + r.URL.Path)
+		contentType, ok := recordingTypes[strings.ToLower(path.Ext(name))]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		f, err := os.Open(filepath.Join(dir, filepath.FromSlash(name)))
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		defer f.Close()
+		info, err := f.Stat()
+		if err != nil || info.IsDir() {
+			http.NotFound(w, r)
+			return
+		}
+
+		h := w.Header()
+		h.Set("Content-Type", contentType)
+		h.Set("Accept-Ranges", "bytes")
+		h.Set("ETag", RecordingETag(info))
+		log.Debug().Str("file", name).Str("range", r.Header.Get("Range")).Msg("[http] serve recording")
+		// ServeContent处理Range/If-Range/If-None-Match/If-Modified-Since, 并设置Content-Length
+		http.ServeContent(w, r, info.Name(), info.ModTime(), f)
+	}))
+}
+
+// RecordingETag 由文件大小和修改时间生成强ETag, 录制中的文件变化后ETag随之变化
+func RecordingETag(info os.FileInfo) string {
+	return fmt.Sprintf(`"%x-%x"`, info.Size(), info.ModTime().UnixNano())
+}
@@ -0,0 +1,41 @@
+package httpserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordingHandler(t *testing.T) {
+	dir := t.TempDir()
+	require.Nil(t, os.WriteFile(filepath.Join(dir, "live_test.flv"), []byte("0123456789"), 0644))
+	h := RecordingHandler("/record/", dir)
+
+	req := httptest.NewRequest(http.MethodGet, "/record/live_test.flv", nil)
+	req.Header.Set("Range", "bytes=2-5")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusPartialContent, rec.Code)
+	require.Equal(t, "2345", rec.Body.String())
+	require.Equal(t, "4", rec.Header().Get("Content-Length"))
+	require.Equal(t, "bytes 2-5/10", rec.Header().Get("Content-Range"))
+	require.Equal(t, "video/x-flv", rec.Header().Get("Content-Type"))
+	etag := rec.Header().Get("ETag")
+	require.NotEmpty(t, etag)
+
+	req = httptest.NewRequest(http.MethodGet, "/record/live_test.flv", nil)
+	req.Header.Set("If-None-Match", etag)
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusNotModified, rec.Code)
+
+	for _, p := range []string{"/record/../recording.go", "/record/missing.flv", "/record/x.txt"} {
+		rec = httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, p, nil))
+		require.Equal(t, http.StatusNotFound, rec.Code, p)
+	}
+}
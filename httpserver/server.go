@@ -0,0 +1,82 @@
+// Package httpserver 是serve模式内置的HTTP服务, 提供录制文件点播等接口
+package httpserver
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Server 内置HTTP服务, 各功能通过Handle挂载到同一个mux上
+type Server struct {
+	Addr string
+
+	mux      *http.ServeMux
+	lock     sync.Mutex
+	srv      *http.Server
+	listener net.Listener
+}
+
+// NewServer 创建HTTP服务
+func NewServer(addr string) *Server {
+	return &Server{Addr: addr, mux: http.NewServeMux()}
+}
+
+// Handle 挂载handler, pattern语义同http.ServeMux
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
+}
+
+// ServeHTTP 实现http.Handler
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// ListenAndServe 监听Addr并处理请求, 阻塞直到Close
+func (s *Server) ListenAndServe() error {
+	l, err := net.Listen("tcp", s.Addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Serve 在l上处理请求, 阻塞直到Close
+func (s *Server) Serve(l net.Listener) error {
+	srv := &http.Server{Handler: s, ReadHeaderTimeout: 10 * time.Second}
+	s.lock.Lock()
+	s.srv = srv
+	s.listener = l
+	s.lock.Unlock()
+	log.Info().Str("addr", l.Addr().String()).Msg("[http] server listening")
+	err := srv.Serve(l)
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// Listener 返回正在使用的listener, 未开始Serve时为nil
+func (s *Server) Listener() net.Listener {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.listener
+}
+
+// Close 关闭服务, 等待进行中的请求最多5秒
+func (s *Server) Close() error {
+	s.lock.Lock()
+	srv := s.srv
+	s.lock.Unlock()
+	if srv == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return srv.Shutdown(ctx)
+}
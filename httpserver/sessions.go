@@ -0,0 +1,163 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/bugVanisher/streamer/media/av/pktque"
+	"github.com/bugVanisher/streamer/media/protocol/rtmp"
+)
+
+// SessionController 会话的查询和控制, 由rtmp.Server实现
+type SessionController interface {
+	Sessions() []rtmp.SessionInfo
+	StartDebug(id string, duration time.Duration) (string, error)
+	StopDebug(id string) (string, error)
+	SetTrack(id, track string, enabled bool) (pktque.TrackState, error)
+}
+
+// debugResult debug抓取接口的返回
+type debugResult struct {
+	ID        string `json:"id"`
+	Debugging bool   `json:"debugging"`
+	File      string `json:"file"`
+	Duration  string `json:"duration,omitempty"`
+}
+
+// trackResult 轨道开关接口的返回
+type trackResult struct {
+	ID string `json:"id"`
+	pktque.TrackState
+}
+
+// SessionsHandler 会话API, 挂载在prefix(如/sessions)下:
+//
+//	GET    /sessions                           列出所有会话
+//	POST   /sessions/{id}/debug?duration=60s   开启debug抓取, 不带duration时抓取到停止或会话结束
+//	DELETE /sessions/{id}/debug                停止debug抓取
+//	POST   /sessions/{id}/tracks?video=off     打开(on)/关闭(off)拉流会话的video/audio轨道, 在下一个关键帧生效
+func SessionsHandler(prefix string, c SessionController) http.Handler {
+	prefix = strings.TrimSuffix(prefix, "/")
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, prefix), "/"), "/")
+		switch {
+		case len(parts) == 1 && parts[0] == "":
+			if r.Method != http.MethodGet {
+				w.Header().Set("Allow", "GET")
+				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			writeJSON(w, http.StatusOK, c.Sessions())
+
+		case len(parts) == 2 && parts[1] == "debug":
+			handleSessionDebug(w, r, c, parts[0])
+
+		case len(parts) == 2 && parts[1] == "tracks":
+			handleSessionTracks(w, r, c, parts[0])
+
+		default:
+			http.NotFound(w, r)
+		}
+	})
+}
+
+func handleSessionDebug(w http.ResponseWriter, r *http.Request, c SessionController, id string) {
+	var res debugResult
+	var err error
+	switch r.Method {
+	case http.MethodPost:
+		var duration time.Duration
+		if v := r.URL.Query().Get("duration"); v != "" {
+			if duration, err = time.ParseDuration(v); err != nil {
+				http.Error(w, "invalid duration: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			res.Duration = duration.String()
+		}
+		res.File, err = c.StartDebug(id, duration)
+		res.Debugging = err == nil
+	case http.MethodDelete:
+		res.File, err = c.StopDebug(id)
+	default:
+		w.Header().Set("Allow", "POST, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if errors.Is(err, rtmp.ErrSessionNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Error().Err(err).Str("session", id).Msg("[http] session debug failed")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	res.ID = id
+	writeJSON(w, http.StatusOK, res)
+}
+
+func handleSessionTracks(w http.ResponseWriter, r *http.Request, c SessionController, id string) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	res := trackResult{ID: id}
+	query := r.URL.Query()
+	applied := false
+	for _, track := range []string{pktque.TrackVideo, pktque.TrackAudio} {
+		v := query.Get(track)
+		if v == "" {
+			continue
+		}
+		enabled, err := parseOnOff(v)
+		if err != nil {
+			http.Error(w, "invalid "+track+": "+v, http.StatusBadRequest)
+			return
+		}
+		res.TrackState, err = c.SetTrack(id, track, enabled)
+		switch {
+		case errors.Is(err, rtmp.ErrSessionNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		case errors.Is(err, rtmp.ErrSessionNotPlay):
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		applied = true
+	}
+	if !applied {
+		http.Error(w, "video or audio required", http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+// parseOnOff 支持on/off和strconv.ParseBool的取值
+func parseOnOff(v string) (bool, error) {
+	switch strings.ToLower(v) {
+	case "on":
+		return true, nil
+	case "off":
+		return false, nil
+	}
+	return strconv.ParseBool(v)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Debug().Err(err).Msg("[http] write json failed")
+	}
+}
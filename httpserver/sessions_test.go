@@ -0,0 +1,125 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bugVanisher/streamer/media/av/pktque"
+	"github.com/bugVanisher/streamer/media/protocol/rtmp"
+)
+
+type fakeSessions struct {
+	duration time.Duration
+	started  bool
+	tracks   pktque.TrackState
+}
+
+func (f *fakeSessions) Sessions() []rtmp.SessionInfo {
+	return []rtmp.SessionInfo{{ID: "1", Key: "live/test", Publishing: true, Debugging: f.started, Health: 85, Degraded: true}}
+}
+
+func (f *fakeSessions) StartDebug(id string, duration time.Duration) (string, error) {
+	if id != "1" {
+		return "", rtmp.ErrSessionNotFound
+	}
+	f.duration, f.started = duration, true
+	return "/tmp/rtmpdebug.1.log", nil
+}
+
+func (f *fakeSessions) StopDebug(id string) (string, error) {
+	if id != "1" {
+		return "", rtmp.ErrSessionNotFound
+	}
+	f.started = false
+	return "/tmp/rtmpdebug.1.log", nil
+}
+
+func (f *fakeSessions) SetTrack(id, track string, enabled bool) (pktque.TrackState, error) {
+	switch id {
+	case "1":
+		return pktque.TrackState{}, rtmp.ErrSessionNotPlay
+	case "2":
+	default:
+		return pktque.TrackState{}, rtmp.ErrSessionNotFound
+	}
+	switch track {
+	case pktque.TrackVideo:
+		f.tracks.Video = enabled
+	case pktque.TrackAudio:
+		f.tracks.Audio = enabled
+	}
+	if !f.tracks.Video && !f.tracks.Audio {
+		return f.tracks, pktque.ErrNoTrackLeft
+	}
+	f.tracks.Pending = true
+	return f.tracks, nil
+}
+
+func TestSessionsHandler(t *testing.T) {
+	f := &fakeSessions{}
+	h := SessionsHandler("/sessions", f)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/sessions/1/debug?duration=60s", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	var res debugResult
+	require.Nil(t, json.Unmarshal(rec.Body.Bytes(), &res))
+	require.Equal(t, debugResult{ID: "1", Debugging: true, File: "/tmp/rtmpdebug.1.log", Duration: "1m0s"}, res)
+	require.Equal(t, time.Minute, f.duration)
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/sessions", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	var sessions []rtmp.SessionInfo
+	require.Nil(t, json.Unmarshal(rec.Body.Bytes(), &sessions))
+	require.Len(t, sessions, 1)
+	require.True(t, sessions[0].Debugging)
+	require.Equal(t, 85, sessions[0].Health)
+	require.True(t, sessions[0].Degraded)
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/sessions/1/debug", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.False(t, f.started)
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/sessions/2/debug", nil))
+	require.Equal(t, http.StatusNotFound, rec.Code)
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/sessions/1/debug?duration=abc", nil))
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestSessionTracks(t *testing.T) {
+	f := &fakeSessions{tracks: pktque.TrackState{Video: true, Audio: true}}
+	h := SessionsHandler("/sessions", f)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/sessions/2/tracks?video=off", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	var res trackResult
+	require.Nil(t, json.Unmarshal(rec.Body.Bytes(), &res))
+	require.Equal(t, trackResult{ID: "2", TrackState: pktque.TrackState{Audio: true, Pending: true}}, res)
+
+	for target, code := range map[string]int{
+		"/sessions/2/tracks?audio=off":   http.StatusBadRequest,
+		"/sessions/2/tracks?video=maybe": http.StatusBadRequest,
+		"/sessions/2/tracks":             http.StatusBadRequest,
+		"/sessions/1/tracks?video=on":    http.StatusConflict,
+		"/sessions/3/tracks?video=on":    http.StatusNotFound,
+	} {
+		rec = httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, target, nil))
+		require.Equal(t, code, rec.Code, target)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/sessions/2/tracks", nil))
+	require.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
@@ -0,0 +1,73 @@
+package httpserver
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/bugVanisher/streamer/media/av"
+	"github.com/bugVanisher/streamer/media/container/flv"
+	"github.com/bugVanisher/streamer/media/container/fmp4"
+)
+
+// VODHandler 将dir下录制的FLV文件按请求实时转封装为fragmented MP4, 不做转码.
+// 请求路径去掉prefix后, 把.mp4后缀换成.flv作为dir下的相对路径, 例如/vod/live/test.mp4 -> live/test.flv.
+// 输出是流式的, 不支持Range请求.
+func VODHandler(prefix, dir string) http.Handler {
+	return http.StripPrefix(prefix, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		name := path.Clean("/" + r.URL.Path)
+		if strings.ToLower(path.Ext(name)) != ".mp4" {
+			http.NotFound(w, r)
+			return
+		}
+		name = strings.TrimSuffix(name, path.Ext(name)) + ".flv"
+		f, err := os.Open(filepath.Join(dir, filepath.FromSlash(name)))
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		demuxer := flv.NewDemuxer(f)
+		defer demuxer.Close()
+
+		streams, err := demuxer.Streams()
+		if err != nil {
+			http.Error(w, "invalid flv file", http.StatusUnprocessableEntity)
+			return
+		}
+		for _, stream := range streams {
+			if !supportedByFMP4(stream.Type()) {
+				http.Error(w, "codec "+stream.Type().String()+" can not be remuxed to mp4", http.StatusUnsupportedMediaType)
+				return
+			}
+		}
+
+		w.Header().Set("Content-Type", "video/mp4")
+		if r.Method == http.MethodHead {
+			return
+		}
+		log.Debug().Str("file", name).Msg("[http] remux recording to fmp4")
+		err = av.NewTransport().CopyAV(r.Context(), fmp4.NewMuxer(w), demuxer)
+		if err != nil && err != io.EOF {
+			log.Warn().Err(err).Str("file", name).Msg("[http] remux recording failed")
+		}
+	}))
+}
+
+func supportedByFMP4(t av.CodecType) bool {
+	for _, c := range fmp4.CodecTypes {
+		if c == t {
+			return true
+		}
+	}
+	return false
+}
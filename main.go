@@ -4,7 +4,9 @@ import (
 	"github.com/bugVanisher/streamer/cmd"
 	"github.com/rs/zerolog/log"
 	"os"
+	"os/signal"
 	"runtime"
+	"syscall"
 )
 
 func main() {
@@ -17,6 +19,14 @@ func main() {
 			log.Error().Str("stack", string(buf)).Any("error", err).Msg("panic recover")
 		}
 	}()
+	// 容器中作为PID 1运行时内核不会对SIGINT/SIGTERM执行默认的退出动作, 需要显式处理
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-sigs
+		log.Info().Str("signal", sig.String()).Msg("exit on signal")
+		os.Exit(128 + int(sig.(syscall.Signal)))
+	}()
 	exitCode := cmd.Execute()
 	os.Exit(exitCode)
 }
@@ -110,6 +110,9 @@ const (
 	AVC_NALU   = 1
 	AVC_EOS    = 2
 
+	AAC_SEQHDR = 0
+	AAC_RAW    = 1
+
 	FRAME_KEY   = 1
 	FRAME_INTER = 2
 
@@ -142,6 +145,7 @@ var (
 	NELLYMOSER = MakeAudioCodecType(avCodecTypeMagic + 5)
 	PCM        = MakeAudioCodecType(avCodecTypeMagic + 6)
 	OPUS       = MakeAudioCodecType(avCodecTypeMagic + 7)
+	MP3        = MakeAudioCodecType(avCodecTypeMagic + 8)
 )
 
 const codecTypeAudioBit = 0x1
@@ -175,6 +179,8 @@ func (self CodecType) String() string {
 		return "PCM"
 	case OPUS:
 		return "OPUS"
+	case MP3:
+		return "MP3"
 	}
 	return ""
 }
@@ -265,7 +271,7 @@ type Packet struct {
 	IsKeyFrame      bool          // video packet is key frame
 	Idx             int8          // stream index in container format
 	CompositionTime time.Duration // packet presentation time minus decode time for H264 B-Frame
-	Time            time.Duration // packet decode time
+	Time            MediaTime     // packet decode time
 	Duration        time.Duration //packet duration
 	Data            []byte        // packet data
 	DataType        int8          // packet data type: video/audio.
@@ -279,11 +285,33 @@ type Packet struct {
 	SliceId        uint32 // slice id
 	SliceFrameCnt  uint16 // slice frame cnt
 	SliceTimeStamp uint64 // slice timestamp
+
+	MetadataUpdated bool // script data(onMetaData)有更新, 和编码header的变化(HeaderChanged)无关
+
+	SEI      []SEIMessage  // 视频帧中的SEI消息, 只在开启SEI解析时填充
+	Captions []CaptionData // SEI中携带的CEA-608/708字幕数据
+
+	Picture PictureStructure // 隔行视频的场结构, 只在检测到隔行内容时填充
+
+	RecoveryPoint bool // 非IDR帧带recovery point SEI, 是open GOP的随机访问点, 只在开启检测时填充
+}
+
+// SEIMessage 一条SEI消息, Payload已去除防竞争码
+type SEIMessage struct {
+	PayloadType uint
+	Payload     []byte
+}
+
+// CaptionData 一个cc_data三元组, Type为0/1时是CEA-608 field 1/2, 为2/3时是CEA-708(DTVCC)数据
+type CaptionData struct {
+	Type  uint8
+	Data1 byte
+	Data2 byte
 }
 
 func (pkt *Packet) String() string {
 	return fmt.Sprintf("IsKeyFrame:%t, Idx:%d, CompositionTime:%d, Time:%d, AVCPacketType:%d, DataType:%d, Drop:%t, HeaderChanged:%t",
-		pkt.IsKeyFrame, pkt.Idx, pkt.CompositionTime/time.Millisecond, pkt.Time/time.Millisecond, pkt.AVCPacketType,
+		pkt.IsKeyFrame, pkt.Idx, pkt.CompositionTime/time.Millisecond, pkt.Time.Ms(), pkt.AVCPacketType,
 		pkt.DataType, pkt.Drop, pkt.HeaderChanged)
 }
 
@@ -305,22 +333,15 @@ func (pkt *Packet) EarlierThen(confirmedPktTime time.Duration) bool {
 
 // IsSequenceHeader Packet是否是audio/video sequence hdr
 func (pkt *Packet) IsSequenceHeader() bool {
-	if (pkt.DataType == int8(FLV_TAG_VIDEO) && pkt.AVCPacketType == uint8(AVC_SEQHDR)) ||
-		(pkt.DataType == int8(FLV_TAG_AUDIO) && pkt.AVCPacketType == uint8(AVC_SEQHDR)) {
-		return true
-	}
-	return false
+	return pkt.IsVideoSequenceHeader() || pkt.IsAudioSequenceHeader()
 }
 
 // IsVideoNalu Packet is video nalu
 func (pkt *Packet) IsVideoNalu() bool {
-	if pkt.DataType == int8(FLV_TAG_VIDEO) && pkt.AVCPacketType != uint8(AVC_SEQHDR) {
-		return true
-	}
-	return false
+	return pkt.IsVideo() && pkt.AVCPacketType != uint8(AVC_SEQHDR)
 }
 
-// IsVideoNalu Packet is video
+// IsVideo Packet is video
 func (pkt *Packet) IsVideo() bool {
 	if pkt.DataType == int8(FLV_TAG_VIDEO) {
 		return true
@@ -328,6 +349,26 @@ func (pkt *Packet) IsVideo() bool {
 	return false
 }
 
+// IsAudio Packet is audio
+func (pkt *Packet) IsAudio() bool {
+	return pkt.DataType == int8(FLV_TAG_AUDIO)
+}
+
+// IsVideoKeyFrame Packet是否是视频关键帧, 音频包的IsKeyFrame没有意义, 不能单独判断IsKeyFrame字段
+func (pkt *Packet) IsVideoKeyFrame() bool {
+	return pkt.IsVideo() && pkt.IsKeyFrame
+}
+
+// IsVideoSequenceHeader Packet是否是video sequence hdr
+func (pkt *Packet) IsVideoSequenceHeader() bool {
+	return pkt.IsVideo() && pkt.AVCPacketType == uint8(AVC_SEQHDR)
+}
+
+// IsAudioSequenceHeader Packet是否是audio sequence hdr
+func (pkt *Packet) IsAudioSequenceHeader() bool {
+	return pkt.IsAudio() && pkt.AVCPacketType == uint8(AAC_SEQHDR)
+}
+
 // IsScriptData Packet是否是script data类型的flvTag
 func (pkt *Packet) IsScriptData() bool {
 	return pkt.DataType == int8(FLV_TAG_SCRIPTDATA)
@@ -350,6 +391,12 @@ func (ht HeaderType) IsVideo() bool {
 var (
 	HeaderTypeH264 = makeVideoHeaderType(headerTypeBase + 1)
 	HeaderTypeAAC  = makeAudioHeaderType(headerTypeBase + 1)
+	HeaderTypePCMA = makeAudioHeaderType(headerTypeBase + 2) // G.711 A-law, 没有sequence header
+	HeaderTypePCMU = makeAudioHeaderType(headerTypeBase + 3) // G.711 mu-law, 没有sequence header
+	HeaderTypeH265 = makeVideoHeaderType(headerTypeBase + 2)
+	HeaderTypeAV1  = makeVideoHeaderType(headerTypeBase + 3)
+	HeaderTypeVP9  = makeVideoHeaderType(headerTypeBase + 4)
+	HeaderTypeMP3  = makeAudioHeaderType(headerTypeBase + 4) // 没有sequence header
 )
 
 const headerTypeBase = 1234
@@ -239,7 +239,7 @@ func ConvertCmdline(args []string) (err error) {
 		if flagv {
 			fmt.Println(pkt.Idx, pkt.Time, len(pkt.Data), pkt.IsKeyFrame)
 		}
-		if duration != 0 && pkt.Time > duration {
+		if duration != 0 && pkt.Time.Duration() > duration {
 			break
 		}
 		if err = muxer.WritePacket(pkt); err != nil {
@@ -1,6 +1,7 @@
 package avutil
 
 import (
+	"bufio"
 	"bytes"
 	"fmt"
 	"github.com/bugVanisher/streamer/media/container/flv/flvio"
@@ -11,8 +12,13 @@ import (
 	"strings"
 
 	"github.com/bugVanisher/streamer/media/av"
+	"github.com/bugVanisher/streamer/media/codec"
 	"github.com/bugVanisher/streamer/media/codec/aacparser"
+	"github.com/bugVanisher/streamer/media/codec/av1parser"
 	"github.com/bugVanisher/streamer/media/codec/h264parser"
+	"github.com/bugVanisher/streamer/media/codec/h265parser"
+	"github.com/bugVanisher/streamer/media/codec/mp3parser"
+	"github.com/bugVanisher/streamer/media/codec/vp9parser"
 )
 
 type HandlerDemuxer struct {
@@ -72,8 +78,17 @@ type RegisterHandler struct {
 	CodecTypes    []av.CodecType
 }
 
+// DefaultProbeSize Open按内容探测格式时默认最多读取的字节数
+const DefaultProbeSize = 1024
+
+// minProbeSize 第一次探测读取的字节数, 没有匹配时加倍直到ProbeSize,
+// 直播源不必等读满ProbeSize就可以识别出格式
+const minProbeSize = 16
+
 type Handlers struct {
 	handlers []RegisterHandler
+	// ProbeSize Open按内容探测格式时最多读取的字节数, 不大于0时使用DefaultProbeSize
+	ProbeSize int
 }
 
 func (self *Handlers) Add(fn func(*RegisterHandler)) {
@@ -179,36 +194,71 @@ func (self *Handlers) Open(uri string) (demuxer av.DemuxCloser, err error) {
 		}
 	}
 
-	var probebuf [1024]byte
 	if r, err = self.openUrl(u, uri); err != nil {
 		return
 	}
-	if _, err = io.ReadFull(r, probebuf[:]); err != nil {
+	br := bufio.NewReaderSize(r, self.probeSize())
+	handler, ok, err := self.probe(br)
+	if err != nil || !ok {
+		r.Close()
+		if err == nil {
+			err = fmt.Errorf("avutil: open %s failed", uri)
+		}
 		return
 	}
+	// 可以seek时回到开头直接读原始的reader, 否则从预读的缓冲继续读, 不重复读取
+	var _r io.Reader = probedReader{Reader: br, Closer: r}
+	if rs, ok := r.(io.ReadSeeker); ok {
+		if _, err = rs.Seek(0, io.SeekStart); err != nil {
+			r.Close()
+			return
+		}
+		_r = r
+	}
+	demuxer = &HandlerDemuxer{
+		Demuxer: handler.ReaderDemuxer(_r),
+		r:       r,
+	}
+	return
+}
 
-	for _, handler := range self.handlers {
-		if handler.Probe != nil && handler.Probe(probebuf[:]) && handler.ReaderDemuxer != nil {
-			var _r io.Reader
-			if rs, ok := r.(io.ReadSeeker); ok {
-				if _, err = rs.Seek(0, 0); err != nil {
-					return
+// probedReader 探测时预读了数据的reader, 读取时先返回预读的数据, Close关闭原始的reader
+type probedReader struct {
+	*bufio.Reader
+	io.Closer
+}
+
+func (self *Handlers) probeSize() int {
+	if self.ProbeSize > 0 {
+		return self.ProbeSize
+	}
+	return DefaultProbeSize
+}
+
+// probe 逐次读取更多的数据探测格式, 读到结尾时用已有的部分数据探测, 最多读取probeSize字节
+func (self *Handlers) probe(br *bufio.Reader) (handler RegisterHandler, ok bool, err error) {
+	max := self.probeSize()
+	for n := minProbeSize; ; n *= 2 {
+		if n > max {
+			n = max
+		}
+		b, perr := br.Peek(n)
+		if len(b) > 0 {
+			for _, handler = range self.handlers {
+				if handler.Probe != nil && handler.ReaderDemuxer != nil && handler.Probe(b) {
+					return handler, true, nil
 				}
-				_r = rs
-			} else {
-				_r = io.MultiReader(bytes.NewReader(probebuf[:]), r)
-			}
-			demuxer = &HandlerDemuxer{
-				Demuxer: handler.ReaderDemuxer(_r),
-				r:       r,
 			}
+		}
+		switch {
+		case perr == io.EOF:
+			return
+		case perr != nil:
+			return handler, false, perr
+		case n == max:
 			return
 		}
 	}
-
-	r.Close()
-	err = fmt.Errorf("avutil: open %s failed", uri)
-	return
 }
 
 func (self *Handlers) Create(uri string) (muxer av.MuxCloser, err error) {
@@ -269,6 +319,16 @@ func (self *Handlers) FindCreate(uri string) (handler RegisterHandler, muxer av.
 	return
 }
 
+// WriterMuxer 按文件扩展名查找注册的WriterMuxer, 没有时返回nil
+func (self *Handlers) WriterMuxer(ext string) func(io.Writer) av.Muxer {
+	for _, handler := range self.handlers {
+		if handler.Ext == ext && handler.WriterMuxer != nil {
+			return handler.WriterMuxer
+		}
+	}
+	return nil
+}
+
 var DefaultHandlers = &Handlers{}
 
 func Open(url string) (demuxer av.DemuxCloser, err error) {
@@ -342,22 +402,85 @@ func Equal(c1 []av.CodecData, c2 []av.CodecData) bool {
 	return true
 }
 
+// EqualHeaders 比较两组header的结构, 类型和sequence header tag的编码参数及数据都相同时返回true
+func EqualHeaders(h1, h2 []av.Header) bool {
+	if len(h1) != len(h2) {
+		return false
+	}
+	for i := range h1 {
+		if h1[i].Type != h2[i].Type {
+			return false
+		}
+		t1, ok1 := h1[i].Data.(flvio.Tag)
+		t2, ok2 := h2[i].Data.(flvio.Tag)
+		if ok1 != ok2 {
+			return false
+		}
+		if !ok1 {
+			continue
+		}
+		if t1.Type != t2.Type || t1.CodecID != t2.CodecID || t1.SoundFormat != t2.SoundFormat ||
+			t1.SoundRate != t2.SoundRate || t1.SoundSize != t2.SoundSize || t1.SoundType != t2.SoundType ||
+			t1.IsExHeader != t2.IsExHeader || t1.FourCC != t2.FourCC || !bytes.Equal(t1.Data, t2.Data) {
+			return false
+		}
+	}
+	return true
+}
+
 func ConvertHeader(srchdr []av.CodecData) []av.Header {
 	var headers []av.Header
 	for _, data := range srchdr {
-		switch data.Type() {
-		case av.H264:
-			c := data.(h264parser.CodecData)
-			headers = append(headers, av.Header{
-				Type: av.HeaderTypeH264,
-				Data: c.SequnceHeaderTag,
-			})
-		case av.AAC:
-			c := data.(aacparser.CodecData)
-			headers = append(headers, av.Header{
-				Type: av.HeaderTypeAAC,
-				Data: c.SequnceHeaderTag,
-			})
+		// 没有sequence header tag时Data为nil, RevertHeader会跳过
+		switch c := data.(type) {
+		case h264parser.CodecData:
+			hdr := av.Header{Type: av.HeaderTypeH264}
+			if tag, ok := c.SequenceHeaderTag(); ok {
+				hdr.Data = tag
+			}
+			headers = append(headers, hdr)
+		case aacparser.CodecData:
+			hdr := av.Header{Type: av.HeaderTypeAAC}
+			if tag, ok := c.SequenceHeaderTag(); ok {
+				hdr.Data = tag
+			}
+			headers = append(headers, hdr)
+		case h265parser.CodecData:
+			hdr := av.Header{Type: av.HeaderTypeH265}
+			if tag, ok := c.SequenceHeaderTag(); ok {
+				hdr.Data = tag
+			}
+			headers = append(headers, hdr)
+		case av1parser.CodecData:
+			hdr := av.Header{Type: av.HeaderTypeAV1}
+			if tag, ok := c.SequenceHeaderTag(); ok {
+				hdr.Data = tag
+			}
+			headers = append(headers, hdr)
+		case vp9parser.CodecData:
+			hdr := av.Header{Type: av.HeaderTypeVP9}
+			if tag, ok := c.SequenceHeaderTag(); ok {
+				hdr.Data = tag
+			}
+			headers = append(headers, hdr)
+		case mp3parser.CodecData:
+			// MP3没有sequence header, 保存tag头, Data为帧头以保留准确的采样率和声道
+			tag := flvio.Tag{Type: flvio.TAG_AUDIO, SoundFormat: flvio.SOUND_MP3, SoundType: flvio.SOUND_STEREO,
+				Data: c.FrameHeader.Bytes()}
+			if c.ChannelLayout() == av.CH_MONO {
+				tag.SoundType = flvio.SOUND_MONO
+			}
+			headers = append(headers, av.Header{Type: av.HeaderTypeMP3, Data: tag})
+		default:
+			// G.711没有sequence header, 保存tag头用于RevertHeader
+			switch data.Type() {
+			case av.PCM_ALAW:
+				headers = append(headers, av.Header{Type: av.HeaderTypePCMA,
+					Data: flvio.Tag{Type: flvio.TAG_AUDIO, SoundFormat: flvio.SOUND_ALAW}})
+			case av.PCM_MULAW:
+				headers = append(headers, av.Header{Type: av.HeaderTypePCMU,
+					Data: flvio.Tag{Type: flvio.TAG_AUDIO, SoundFormat: flvio.SOUND_MULAW}})
+			}
 		}
 	}
 	return headers
@@ -366,17 +489,42 @@ func ConvertHeader(srchdr []av.CodecData) []av.Header {
 func RevertHeader(srchdr []av.Header) []av.CodecData {
 	var headers []av.CodecData
 	for _, data := range srchdr {
-		tag := data.Data.(flvio.Tag)
+		tag, ok := data.Data.(flvio.Tag)
+		if !ok {
+			continue
+		}
 
 		switch data.Type {
 		case av.HeaderTypeH264:
 			videoHdr, _ := h264parser.NewCodecDataFromAVCDecoderConfRecord(tag.Data)
-			videoHdr.SequnceHeaderTag = tag
+			videoHdr.SetSequenceHeaderTag(tag)
 			headers = append(headers, videoHdr)
 		case av.HeaderTypeAAC:
 			aacHdr, _ := aacparser.NewCodecDataFromMPEG4AudioConfigBytes(tag.Data)
-			aacHdr.SequnceHeaderTag = tag
+			aacHdr.SetSequenceHeaderTag(tag)
 			headers = append(headers, aacHdr)
+		case av.HeaderTypeH265:
+			h265Hdr, _ := h265parser.NewCodecDataFromHVCCDecoderConfRecord(tag.Data)
+			h265Hdr.SetSequenceHeaderTag(tag)
+			headers = append(headers, h265Hdr)
+		case av.HeaderTypeAV1:
+			av1Hdr, _ := av1parser.NewCodecDataFromAV1CodecConfRecord(tag.Data)
+			av1Hdr.SetSequenceHeaderTag(tag)
+			headers = append(headers, av1Hdr)
+		case av.HeaderTypeVP9:
+			vp9Hdr, _ := vp9parser.NewCodecDataFromVPCodecConfRecord(tag.Data)
+			vp9Hdr.SetSequenceHeaderTag(tag)
+			headers = append(headers, vp9Hdr)
+		case av.HeaderTypeMP3:
+			mp3Hdr, err := mp3parser.NewCodecDataFromFrame(tag.Data)
+			if err != nil {
+				mp3Hdr = mp3parser.NewCodecData(44100, tag.ChannelLayout())
+			}
+			headers = append(headers, mp3Hdr)
+		case av.HeaderTypePCMA:
+			headers = append(headers, codec.NewPCMAlawCodecData())
+		case av.HeaderTypePCMU:
+			headers = append(headers, codec.NewPCMMulawCodecData())
 		}
 	}
 
@@ -384,11 +532,17 @@ func RevertHeader(srchdr []av.Header) []av.CodecData {
 }
 
 func ConvertH264Header(h av.CodecData) (h264parser.CodecData, error) {
-	tag := h.(h264parser.CodecData).SequnceHeaderTag.(flvio.Tag)
+	tag, ok := h.(h264parser.CodecData).SequenceHeaderTag()
+	if !ok {
+		return h264parser.CodecData{}, fmt.Errorf("avutil: h264 codec data without sequence header tag")
+	}
 	return h264parser.NewCodecDataFromAVCDecoderConfRecord(tag.Data)
 }
 
 func ConvertAACHeader(h av.CodecData) (aacparser.CodecData, error) {
-	tag := h.(aacparser.CodecData).SequnceHeaderTag.(flvio.Tag)
+	tag, ok := h.(aacparser.CodecData).SequenceHeaderTag()
+	if !ok {
+		return aacparser.CodecData{}, fmt.Errorf("avutil: aac codec data without sequence header tag")
+	}
 	return aacparser.NewCodecDataFromMPEG4AudioConfigBytes(tag.Data)
 }
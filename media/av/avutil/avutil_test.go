@@ -0,0 +1,82 @@
+package avutil
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bugVanisher/streamer/media/av"
+)
+
+// readerDemuxer 记录ReaderDemuxer拿到的reader
+type readerDemuxer struct {
+	av.Demuxer
+	r io.Reader
+}
+
+func testHandlers(readers map[string]io.ReadCloser) *Handlers {
+	h := &Handlers{}
+	h.Add(func(h *RegisterHandler) {
+		h.UrlReader = func(uri string) (bool, io.ReadCloser, error) {
+			r, ok := readers[uri]
+			return ok, r, nil
+		}
+	})
+	h.Add(func(h *RegisterHandler) {
+		h.Probe = func(b []byte) bool { return bytes.HasPrefix(b, []byte("MAGIC")) }
+		h.ReaderDemuxer = func(r io.Reader) av.Demuxer { return &readerDemuxer{r: r} }
+	})
+	return h
+}
+
+func TestOpenProbe(t *testing.T) {
+	// 不足ProbeSize的短文件
+	dir, err := ioutil.TempDir("", "avutil")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "short.bin")
+	require.Nil(t, ioutil.WriteFile(file, []byte("MAGIC-data"), 0644))
+	h := testHandlers(nil)
+	d, err := h.Open(file)
+	require.Nil(t, err)
+	data, err := ioutil.ReadAll(d.(*HandlerDemuxer).Demuxer.(*readerDemuxer).r)
+	require.Nil(t, err)
+	require.Equal(t, "MAGIC-data", string(data))
+	d.Close()
+
+	// 直播源只有少量数据时不等待读满ProbeSize, 预读的数据不丢失
+	pr, pw := io.Pipe()
+	h = testHandlers(map[string]io.ReadCloser{"live://test": pr})
+	go pw.Write([]byte("MAGIC-live-header"))
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		d, err = h.Open("live://test")
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("probe waits for ProbeSize bytes")
+	}
+	require.Nil(t, err)
+	go func() {
+		pw.Write([]byte("-more"))
+		pw.Close()
+	}()
+	data, err = ioutil.ReadAll(d.(*HandlerDemuxer).Demuxer.(*readerDemuxer).r)
+	require.Nil(t, err)
+	require.Equal(t, "MAGIC-live-header-more", string(data))
+
+	// 超过ProbeSize仍不匹配时失败
+	h = testHandlers(map[string]io.ReadCloser{"live://other": ioutil.NopCloser(strings.NewReader(strings.Repeat("x", 100) + "MAGIC"))})
+	h.ProbeSize = 64
+	_, err = h.Open("live://other")
+	require.NotNil(t, err)
+}
@@ -0,0 +1,115 @@
+package avutil
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/bugVanisher/streamer/media/av"
+)
+
+// audioOnlyCheckDuration 纯音频流检查的时长
+const audioOnlyCheckDuration = time.Second
+
+// GOPReport 首个GOP的检查结果
+type GOPReport struct {
+	Streams     []av.CodecData `json:"streams"`
+	Packets     int            `json:"packets"`
+	GOPDuration time.Duration  `json:"gop_duration"`
+	Complete    bool           `json:"complete"`
+	Problems    []string       `json:"problems,omitempty"`
+}
+
+// OK 是否通过检查
+func (r GOPReport) OK() bool {
+	return r.Complete && len(r.Problems) == 0
+}
+
+// GOPChecker 检查音视频头和第一个完整GOP, 用于推拉流前的快速预检
+type GOPChecker struct {
+	report   GOPReport
+	videoIdx int
+	gotKey   bool
+	first    time.Duration
+	lastTime map[int8]time.Duration
+}
+
+// NewGOPChecker 创建GOPChecker并检查音视频头
+func NewGOPChecker(streams []av.CodecData) *GOPChecker {
+	c := &GOPChecker{
+		videoIdx: -1,
+		lastTime: make(map[int8]time.Duration),
+	}
+	c.report.Streams = streams
+	if len(streams) == 0 {
+		c.problem("no stream header")
+	}
+	for i, s := range streams {
+		if s == nil {
+			c.problem("stream %d has no codec data", i)
+			continue
+		}
+		if v, ok := s.(av.VideoCodecData); ok {
+			c.videoIdx = i
+			if v.Width() <= 0 || v.Height() <= 0 {
+				c.problem("invalid video resolution %dx%d", v.Width(), v.Height())
+			}
+		}
+		if a, ok := s.(av.AudioCodecData); ok && a.SampleRate() <= 0 {
+			c.problem("invalid audio sample rate %d", a.SampleRate())
+		}
+	}
+	return c
+}
+
+func (c *GOPChecker) problem(format string, args ...interface{}) {
+	c.report.Problems = append(c.report.Problems, fmt.Sprintf(format, args...))
+}
+
+// Add 检查一个包, 返回true表示第一个GOP已经完整
+func (c *GOPChecker) Add(pkt av.Packet) (done bool) {
+	if c.report.Complete {
+		return true
+	}
+	if pkt.IsSequenceHeader() || pkt.IsScriptData() {
+		return false
+	}
+	t := pkt.Time.Duration()
+	if len(pkt.Data) == 0 {
+		c.problem("empty packet at %s", pkt.Time)
+	}
+	if last, ok := c.lastTime[pkt.Idx]; ok && t < last {
+		c.problem("stream %d timestamp goes back %s -> %s", pkt.Idx, last, t)
+	}
+	c.lastTime[pkt.Idx] = t
+	if c.report.Packets == 0 {
+		c.first = t
+	}
+	c.report.Packets++
+
+	if c.videoIdx < 0 {
+		c.report.GOPDuration = t - c.first
+		c.report.Complete = c.report.GOPDuration >= audioOnlyCheckDuration
+		return c.report.Complete
+	}
+	if int(pkt.Idx) != c.videoIdx {
+		return false
+	}
+	if !c.gotKey {
+		if !pkt.IsKeyFrame {
+			c.problem("first video frame is not a key frame")
+		}
+		c.gotKey = true
+		c.first = t
+		return false
+	}
+	if pkt.IsKeyFrame {
+		c.report.GOPDuration = t - c.first
+		c.report.Complete = true
+	}
+	return c.report.Complete
+}
+
+// Report 返回检查结果
+func (c *GOPChecker) Report() GOPReport {
+	return c.report
+}
@@ -0,0 +1,109 @@
+package avutil
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bugVanisher/streamer/media/av"
+	"github.com/bugVanisher/streamer/media/codec/aacparser"
+	"github.com/bugVanisher/streamer/media/codec/h264parser"
+)
+
+func checkVideo(ms int32, key bool) av.Packet {
+	return av.Packet{Idx: 0, DataType: int8(av.FLV_TAG_VIDEO), AVCPacketType: av.AVC_NALU, IsKeyFrame: key,
+		Time: av.MediaTimeFromMs(ms), Data: []byte{1}}
+}
+
+func checkAudio(ms int32) av.Packet {
+	return checkAudioIdx(1, ms)
+}
+
+func checkAudioIdx(idx int8, ms int32) av.Packet {
+	return av.Packet{Idx: idx, DataType: int8(av.FLV_TAG_AUDIO), AVCPacketType: av.AAC_RAW,
+		Time: av.MediaTimeFromMs(ms), Data: []byte{1}}
+}
+
+func TestGOPChecker(t *testing.T) {
+	sps := []byte{0x67, 0x64, 0x00, 0x1e, 0xac, 0xd9, 0x40, 0xa0, 0x2f, 0xf9, 0x70, 0x11, 0x00, 0x00, 0x03,
+		0x00, 0x01, 0x00, 0x00, 0x03, 0x00, 0x32, 0x0f, 0x16, 0x2d, 0x96}
+	h264, err := h264parser.NewCodecDataFromSPSAndPPS(sps, []byte{0x68, 0xeb, 0xe3, 0xcb, 0x22, 0xc0})
+	require.Nil(t, err)
+	aac, err := aacparser.NewCodecDataFromMPEG4AudioConfigBytes([]byte{0x12, 0x10})
+	require.Nil(t, err)
+
+	for _, c := range []struct {
+		name     string
+		streams  []av.CodecData
+		pkts     []av.Packet
+		complete bool
+		gop      time.Duration
+		packets  int
+		problems []string
+	}{
+		{
+			name:    "ok",
+			streams: []av.CodecData{h264, aac},
+			pkts: []av.Packet{checkVideo(0, true), checkAudio(10), checkVideo(40, false), checkAudio(33),
+				checkVideo(80, false), checkVideo(120, true)},
+			complete: true, gop: 120 * time.Millisecond, packets: 6,
+		},
+		{
+			name:     "missing headers",
+			streams:  nil,
+			pkts:     []av.Packet{checkAudio(0)},
+			packets:  1,
+			problems: []string{"no stream header"},
+		},
+		{
+			name:     "nil codec data",
+			streams:  []av.CodecData{h264, nil},
+			pkts:     []av.Packet{checkVideo(0, true), checkVideo(40, true)},
+			complete: true, gop: 40 * time.Millisecond, packets: 2,
+			problems: []string{"stream 1 has no codec data"},
+		},
+		{
+			name:     "no key frame in first gop",
+			streams:  []av.CodecData{h264},
+			pkts:     []av.Packet{checkVideo(0, false), checkVideo(40, false), checkVideo(80, true)},
+			complete: true, gop: 80 * time.Millisecond, packets: 3,
+			problems: []string{"first video frame is not a key frame"},
+		},
+		{
+			name:     "dts goes back",
+			streams:  []av.CodecData{h264},
+			pkts:     []av.Packet{checkVideo(0, true), checkVideo(80, false), checkVideo(40, false), checkVideo(120, true)},
+			complete: true, gop: 120 * time.Millisecond, packets: 4,
+			problems: []string{"stream 0 timestamp goes back 80ms -> 40ms"},
+		},
+		{
+			name:     "gop not finished",
+			streams:  []av.CodecData{h264},
+			pkts:     []av.Packet{checkVideo(0, true), checkVideo(40, false)},
+			packets:  2,
+			problems: nil,
+		},
+		{
+			// 纯音频检查1秒
+			name:     "audio only",
+			streams:  []av.CodecData{aac},
+			pkts:     []av.Packet{checkAudioIdx(0, 0), checkAudioIdx(0, 500), checkAudioIdx(0, 1000)},
+			complete: true, gop: time.Second, packets: 3,
+		},
+	} {
+		checker := NewGOPChecker(c.streams)
+		var done bool
+		for _, pkt := range c.pkts {
+			require.False(t, done, c.name)
+			done = checker.Add(pkt)
+		}
+		report := checker.Report()
+		require.Equal(t, c.complete, done, c.name)
+		require.Equal(t, c.complete, report.Complete, c.name)
+		require.Equal(t, c.gop, report.GOPDuration, c.name)
+		require.Equal(t, c.packets, report.Packets, c.name)
+		require.Equal(t, c.problems, report.Problems, c.name)
+		require.Equal(t, c.complete && len(c.problems) == 0, report.OK(), c.name)
+	}
+}
@@ -0,0 +1,37 @@
+package avutil
+
+import (
+	"io"
+
+	"github.com/bugVanisher/streamer/media/av"
+	"github.com/bugVanisher/streamer/media/container/es"
+)
+
+// esExts elementary stream的文件扩展名, 写入时只保留对应类型的一路流, 读取时视频按SPS中的帧率生成时间戳
+var esExts = []struct {
+	ext string
+	typ av.CodecType
+}{
+	{".h264", av.H264},
+	{".265", av.H265},
+	{".aac", av.AAC},
+}
+
+func init() {
+	for _, e := range esExts {
+		e := e
+		DefaultHandlers.Add(func(h *RegisterHandler) {
+			h.Ext = e.ext
+			h.WriterMuxer = func(w io.Writer) av.Muxer {
+				return es.NewMuxer(w, e.typ)
+			}
+			h.ReaderDemuxer = func(r io.Reader) av.Demuxer {
+				if e.typ == av.AAC {
+					return es.NewAudioDemuxer(r)
+				}
+				return es.NewVideoDemuxer(r, e.typ, 0)
+			}
+			h.CodecTypes = []av.CodecType{e.typ}
+		})
+	}
+}
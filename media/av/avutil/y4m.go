@@ -0,0 +1,19 @@
+package avutil
+
+import (
+	"io"
+
+	"github.com/bugVanisher/streamer/media/av"
+	"github.com/bugVanisher/streamer/media/container/y4m"
+)
+
+// .y4m输出解码后的视频帧, 需要以-tags ffmpeg编译
+func init() {
+	DefaultHandlers.Add(func(h *RegisterHandler) {
+		h.Ext = ".y4m"
+		h.WriterMuxer = func(w io.Writer) av.Muxer {
+			return y4m.NewFFmpegMuxer(w)
+		}
+		h.CodecTypes = []av.CodecType{av.H264, av.H265}
+	})
+}
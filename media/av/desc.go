@@ -0,0 +1,36 @@
+package av
+
+import (
+	"encoding/hex"
+)
+
+// CodecDescription 编解码参数的可读描述, 用于json/yaml序列化
+type CodecDescription struct {
+	Codec      string `json:"codec" yaml:"codec"`
+	Profile    string `json:"profile,omitempty" yaml:"profile,omitempty"`
+	Level      string `json:"level,omitempty" yaml:"level,omitempty"`
+	Width      int    `json:"width,omitempty" yaml:"width,omitempty"`
+	Height     int    `json:"height,omitempty" yaml:"height,omitempty"`
+	FPS        int    `json:"fps,omitempty" yaml:"fps,omitempty"`
+	SampleRate int    `json:"sample_rate,omitempty" yaml:"sample_rate,omitempty"`
+	Channels   int    `json:"channels,omitempty" yaml:"channels,omitempty"`
+	ObjectType uint   `json:"object_type,omitempty" yaml:"object_type,omitempty"`
+	Extradata  string `json:"extradata,omitempty" yaml:"extradata,omitempty"` // 序列头原始数据的hex
+}
+
+// Describe 根据通用接口生成CodecData的描述, 具体编码的Profile/Level等由各codec包补充
+func Describe(codec CodecData, extradata []byte) CodecDescription {
+	desc := CodecDescription{Codec: codec.Type().String()}
+	switch c := codec.(type) {
+	case VideoCodecData:
+		desc.Width = c.Width()
+		desc.Height = c.Height()
+	case AudioCodecData:
+		desc.SampleRate = c.SampleRate()
+		desc.Channels = c.ChannelLayout().Count()
+	}
+	if len(extradata) > 0 {
+		desc.Extradata = hex.EncodeToString(extradata)
+	}
+	return desc
+}
@@ -0,0 +1,114 @@
+package av
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultFPSWindow FPSEstimator默认的滑动窗口帧数
+	DefaultFPSWindow = 32
+
+	// fpsMaxGap 相邻两帧dts间隔超过该值视为断流或跳变, 重新开始估计
+	fpsMaxGap = MediaTime(time.Second)
+)
+
+// FPSEstimator 用视频packet的dts在滑动窗口内估计帧率.
+// SPS没有VUI timing_info等码流不带帧率信息时, 作为CodecData.FPS()/PacketDuration()的后备.
+// CodecData是值类型, 各个副本共享同一个*FPSEstimator, 方法并发安全, nil时估计值为0
+type FPSEstimator struct {
+	lock  sync.Mutex
+	times []MediaTime
+	pos   int
+	n     int
+}
+
+// FPSEstimated 可以挂载FPSEstimator的视频CodecData, 返回挂载后的副本
+type FPSEstimated interface {
+	WithFPSEstimator(e *FPSEstimator) CodecData
+}
+
+// NewFPSEstimator window为窗口帧数, 小于2时使用DefaultFPSWindow
+func NewFPSEstimator(window int) *FPSEstimator {
+	if window < 2 {
+		window = DefaultFPSWindow
+	}
+	return &FPSEstimator{times: make([]MediaTime, window)}
+}
+
+// Add 加入一帧的dts. 同一时间戳的帧(如分开传输的两场)只计一次, 时间戳回退或间隔过大时重新估计
+func (self *FPSEstimator) Add(dts MediaTime) {
+	if self == nil {
+		return
+	}
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if self.n > 0 {
+		last := self.times[(self.pos+len(self.times)-1)%len(self.times)]
+		if dts == last {
+			return
+		}
+		if dts < last || dts-last > fpsMaxGap {
+			self.n = 0
+		}
+	}
+	self.times[self.pos] = dts
+	self.pos = (self.pos + 1) % len(self.times)
+	if self.n < len(self.times) {
+		self.n++
+	}
+}
+
+// span 窗口内首尾两帧的间隔和帧间隔数
+func (self *FPSEstimator) span() (d MediaTime, frames int) {
+	if self.n < 2 {
+		return 0, 0
+	}
+	first := self.times[(self.pos+len(self.times)-self.n)%len(self.times)]
+	last := self.times[(self.pos+len(self.times)-1)%len(self.times)]
+	return last - first, self.n - 1
+}
+
+// Rate 估计的帧率, 样本不足时为0
+func (self *FPSEstimator) Rate() float64 {
+	if self == nil {
+		return 0
+	}
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	d, frames := self.span()
+	if d <= 0 {
+		return 0
+	}
+	return float64(frames) * float64(time.Second) / float64(d)
+}
+
+// FPS 四舍五入后的帧率, 如29.97为30
+func (self *FPSEstimator) FPS() int {
+	return int(math.Round(self.Rate()))
+}
+
+// FrameDuration 平均帧间隔, 样本不足时为0
+func (self *FPSEstimator) FrameDuration() time.Duration {
+	if self == nil {
+		return 0
+	}
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	d, frames := self.span()
+	if frames == 0 {
+		return 0
+	}
+	return time.Duration(d) / time.Duration(frames)
+}
+
+// Reset 清空窗口
+func (self *FPSEstimator) Reset() {
+	if self == nil {
+		return
+	}
+	self.lock.Lock()
+	self.n, self.pos = 0, 0
+	self.lock.Unlock()
+}
@@ -0,0 +1,49 @@
+package av
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFPSEstimator(t *testing.T) {
+	var nilEstimator *FPSEstimator
+	nilEstimator.Add(0)
+	require.Equal(t, 0, nilEstimator.FPS())
+	require.Equal(t, time.Duration(0), nilEstimator.FrameDuration())
+
+	e := NewFPSEstimator(8)
+	require.Equal(t, 0, e.FPS())
+	e.Add(0)
+	require.Equal(t, 0, e.FPS())
+
+	// 29.97fps, 毫秒时间戳的帧间隔在33和34ms之间交替
+	var ts MediaTime
+	for i := 1; i <= 20; i++ {
+		ts = MediaTime(time.Duration(i) * time.Second * 1001 / 30000 / time.Millisecond * time.Millisecond)
+		e.Add(ts)
+		// 同一时间戳的两场只计一次
+		e.Add(ts)
+	}
+	require.Equal(t, 30, e.FPS())
+	require.InDelta(t, 29.97, e.Rate(), 0.2)
+	require.InDelta(t, float64(33*time.Millisecond), float64(e.FrameDuration()), float64(time.Millisecond))
+
+	// 时间戳回退后重新估计
+	e.Add(0)
+	require.Equal(t, 0, e.FPS())
+	for i := 1; i <= 10; i++ {
+		e.Add(MediaTime(time.Duration(i) * 40 * time.Millisecond))
+	}
+	require.Equal(t, 25, e.FPS())
+	require.Equal(t, 40*time.Millisecond, e.FrameDuration())
+
+	// 断流后的大间隔不计入
+	e.Add(MediaTime(10 * time.Second))
+	e.Add(MediaTime(10*time.Second + 20*time.Millisecond))
+	require.Equal(t, 50, e.FPS())
+
+	e.Reset()
+	require.Equal(t, 0, e.FPS())
+}
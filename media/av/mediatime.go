@@ -0,0 +1,121 @@
+package av
+
+import (
+	"fmt"
+	"time"
+)
+
+// MediaTime 统一的媒体时间, 精度为纳秒, 与time.Duration数值相同.
+// flv/rtmp的毫秒时间戳、ts的90kHz pts都通过显式的转换函数与之互转, 避免单位混用.
+type MediaTime time.Duration
+
+const (
+	// PTSHz mpegts时钟频率
+	PTSHz = 90000
+
+	msMask32  = 1<<32 - 1
+	ptsMask33 = 1<<33 - 1
+)
+
+// MediaTimeFromDuration 由time.Duration得到MediaTime
+func MediaTimeFromDuration(d time.Duration) MediaTime {
+	return MediaTime(d)
+}
+
+// MediaTimeFromMs 由有符号毫秒时间戳(flv/rtmp的int32)得到MediaTime
+func MediaTimeFromMs(ms int32) MediaTime {
+	return MediaTime(time.Duration(ms) * time.Millisecond)
+}
+
+// MediaTimeFromMsU32 由无符号毫秒时间戳得到MediaTime, 超过int32的时间戳不会被当成负数
+func MediaTimeFromMsU32(ms uint32) MediaTime {
+	return MediaTime(time.Duration(ms) * time.Millisecond)
+}
+
+// MediaTimeFromPTS 由90kHz的pts/dts得到MediaTime
+func MediaTimeFromPTS(pts int64) MediaTime {
+	// 1s/90000 = 100000ns/9, 避免pts*time.Second溢出
+	return MediaTime(pts * 100000 / 9)
+}
+
+// Duration 转为time.Duration
+func (t MediaTime) Duration() time.Duration {
+	return time.Duration(t)
+}
+
+// Ms 转为有符号毫秒时间戳, 超出int32范围时按32位回绕
+func (t MediaTime) Ms() int32 {
+	return int32(int64(t) / int64(time.Millisecond))
+}
+
+// MsU32 转为无符号毫秒时间戳, 按32位回绕, 负数时间同样回绕到高位
+func (t MediaTime) MsU32() uint32 {
+	return uint32(int64(t) / int64(time.Millisecond) & msMask32)
+}
+
+// PTS 转为90kHz的pts, 按33位回绕
+func (t MediaTime) PTS() int64 {
+	return t.pts() & ptsMask33
+}
+
+// pts 四舍五入到最近的90kHz时钟
+func (t MediaTime) pts() int64 {
+	if t < 0 {
+		return (int64(t)*9 - 50000) / 100000
+	}
+	return (int64(t)*9 + 50000) / 100000
+}
+
+// UnwrapMsU32 根据上一个时间prev把32位回绕后的毫秒时间戳ms展开为连续的MediaTime.
+// ms与prev的差值在半个回绕周期内时认为是同一周期, 否则认为发生了正向或反向回绕.
+func UnwrapMsU32(prev MediaTime, ms uint32) MediaTime {
+	v := unwrapValue(int64(prev)/int64(time.Millisecond), int64(ms), msMask32+1)
+	return MediaTime(time.Duration(v) * time.Millisecond)
+}
+
+// UnwrapPTS 根据上一个时间prev把33位回绕后的pts展开为连续的MediaTime
+func UnwrapPTS(prev MediaTime, pts int64) MediaTime {
+	v := unwrapValue(prev.pts(), pts&ptsMask33, ptsMask33+1)
+	return MediaTimeFromPTS(v)
+}
+
+// MsUnwrapper 跟踪32位毫秒时间戳的回绕, 把rtmp/flv的时间戳展开为单调增长的64位MediaTime, 零值可用.
+// 第一个时间戳按有符号int32解释, 与MediaTimeFromMs一致, 之后的时间戳相对上一个时间戳展开
+type MsUnwrapper struct {
+	last    MediaTime
+	started bool
+}
+
+// Unwrap 展开ms并作为之后展开的参考
+func (self *MsUnwrapper) Unwrap(ms uint32) MediaTime {
+	self.last = self.Peek(ms)
+	self.started = true
+	return self.last
+}
+
+// Peek 展开ms但不更新参考, 用于sequence header等时间戳可能不连续的消息
+func (self *MsUnwrapper) Peek(ms uint32) MediaTime {
+	if !self.started {
+		return MediaTimeFromMs(int32(ms))
+	}
+	return UnwrapMsU32(self.last, ms)
+}
+
+func unwrapValue(prev, v, period int64) int64 {
+	base := prev - prev%period
+	if prev < 0 && prev%period != 0 {
+		base -= period
+	}
+	v += base
+	if d := v - prev; d > period/2 {
+		v -= period
+	} else if d < -period/2 {
+		v += period
+	}
+	return v
+}
+
+// String 以毫秒格式输出
+func (t MediaTime) String() string {
+	return fmt.Sprintf("%dms", int64(t)/int64(time.Millisecond))
+}
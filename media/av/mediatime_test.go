@@ -0,0 +1,68 @@
+package av
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMediaTimeConversion(t *testing.T) {
+	tm := MediaTimeFromMs(1324)
+	require.Equal(t, 1324*time.Millisecond, tm.Duration())
+	require.Equal(t, int32(1324), tm.Ms())
+	require.Equal(t, uint32(1324), tm.MsU32())
+	require.Equal(t, int64(1324*90), tm.PTS())
+	require.Equal(t, tm, MediaTimeFromPTS(1324*90))
+	require.Equal(t, tm, MediaTimeFromDuration(1324*time.Millisecond))
+
+	// 负的int32毫秒时间戳与超过int32的无符号时间戳
+	require.Equal(t, -40*time.Millisecond, MediaTimeFromMs(-40).Duration())
+	require.Equal(t, uint32(math.MaxUint32-39), MediaTimeFromMs(-40).MsU32())
+	big := MediaTimeFromMsU32(math.MaxInt32 + 10)
+	require.True(t, big > 0)
+	require.Equal(t, uint32(math.MaxInt32+10), big.MsU32())
+	require.Equal(t, int32(math.MinInt32+9), big.Ms())
+}
+
+func TestMediaTimeWrap(t *testing.T) {
+	// 32位毫秒时间戳回绕
+	prev := MediaTimeFromMsU32(math.MaxUint32 - 10)
+	next := UnwrapMsU32(prev, 20)
+	require.Equal(t, 31*time.Millisecond, (next - prev).Duration())
+	// 回绕前的乱序包
+	require.Equal(t, prev-MediaTimeFromMs(5), UnwrapMsU32(next, math.MaxUint32-15))
+	// 没有回绕
+	require.Equal(t, MediaTimeFromMs(2000), UnwrapMsU32(MediaTimeFromMs(1000), 2000))
+
+	// 33位pts回绕
+	const ptsPeriod = 1 << 33
+	prev = MediaTimeFromPTS(ptsPeriod - 900)
+	require.Equal(t, int64(ptsPeriod-900), prev.PTS())
+	next = UnwrapPTS(prev, 900)
+	require.Equal(t, 20*time.Millisecond, (next - prev).Duration())
+	require.Equal(t, int64(900), next.PTS())
+}
+
+func TestMsUnwrapper(t *testing.T) {
+	var u MsUnwrapper
+	// 第一个时间戳按有符号解释
+	require.Equal(t, MediaTimeFromMs(-40), u.Unwrap(math.MaxUint32-39))
+	require.Equal(t, MediaTimeFromMs(0), u.Unwrap(0))
+
+	// 超过int32后继续增长, 再回绕到第二个周期
+	u = MsUnwrapper{}
+	u.Unwrap(math.MaxInt32 - 20)
+	for _, ms := range []uint32{math.MaxInt32 + 20, math.MaxUint32 - 20, 20, 100} {
+		prev := u.last
+		next := u.Unwrap(ms)
+		require.True(t, next > prev, "%v -> %v", prev, next)
+		require.Equal(t, ms, next.MsU32())
+	}
+	// 第二个周期
+	require.Equal(t, MediaTimeFromMsU32(math.MaxUint32)+MediaTimeFromMs(101), u.last)
+	// Peek不改变参考
+	require.Equal(t, MediaTimeFromMsU32(math.MaxUint32)+MediaTimeFromMs(1), u.Peek(0))
+	require.Equal(t, MediaTimeFromMsU32(math.MaxUint32)+MediaTimeFromMs(101), u.last)
+}
@@ -0,0 +1,75 @@
+package av
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPacketTypeHelpers(t *testing.T) {
+	video := Packet{DataType: FLV_TAG_VIDEO, IsKeyFrame: true, AVCPacketType: AVC_NALU}
+	audio := Packet{DataType: FLV_TAG_AUDIO, IsKeyFrame: true, AVCPacketType: AAC_SEQHDR}
+
+	require.True(t, video.IsVideo() && video.IsVideoKeyFrame() && video.IsVideoNalu())
+	require.False(t, video.IsAudio() || video.IsSequenceHeader())
+	require.True(t, audio.IsAudio() && audio.IsAudioSequenceHeader() && audio.IsSequenceHeader())
+	// 音频包的IsKeyFrame不算关键帧
+	require.False(t, audio.IsVideoKeyFrame() || audio.IsVideoSequenceHeader())
+}
+
+// TestNoRawDataTypeComparison 除av.go中的helper外, 不允许直接比较或switch Packet.DataType,
+// 统一使用IsVideo/IsAudio/IsScriptData/IsVideoKeyFrame等方法
+func TestNoRawDataTypeComparison(t *testing.T) {
+	root, err := filepath.Abs("../..")
+	require.Nil(t, err)
+	isDataType := func(e ast.Expr) bool {
+		if call, ok := e.(*ast.CallExpr); ok && len(call.Args) == 1 {
+			e = call.Args[0] // int8(pkt.DataType)之类的类型转换
+		}
+		sel, ok := e.(*ast.SelectorExpr)
+		return ok && sel.Sel.Name == "DataType"
+	}
+
+	var found []string
+	fset := token.NewFileSet()
+	err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if strings.HasPrefix(info.Name(), ".") || info.Name() == "vendor" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(path, ".go") || path == filepath.Join(root, "media", "av", "av.go") {
+			return nil
+		}
+		f, err := parser.ParseFile(fset, path, nil, 0)
+		if err != nil {
+			return err
+		}
+		ast.Inspect(f, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.BinaryExpr:
+				if (n.Op == token.EQL || n.Op == token.NEQ) && (isDataType(n.X) || isDataType(n.Y)) {
+					found = append(found, fset.Position(n.Pos()).String())
+				}
+			case *ast.SwitchStmt:
+				if n.Tag != nil && isDataType(n.Tag) {
+					found = append(found, fset.Position(n.Pos()).String())
+				}
+			}
+			return true
+		})
+		return nil
+	})
+	require.Nil(t, err)
+	require.Empty(t, found, "compare av.Packet.DataType with the helper methods instead")
+}
@@ -0,0 +1,43 @@
+package av
+
+// PictureStructure 视频packet的图像结构, 区分逐行帧和隔行内容的场
+type PictureStructure uint8
+
+const (
+	// PictureFrame 逐行帧, 未检测时也是该值
+	PictureFrame PictureStructure = iota
+	// PictureInterlacedFrame 按帧编码(含MBAFF)的隔行帧, 包含两个场
+	PictureInterlacedFrame
+	// PictureFieldPair 按场编码, packet中包含顶场和底场
+	PictureFieldPair
+	// PictureTopField 按场编码, packet中只有顶场
+	PictureTopField
+	// PictureBottomField 按场编码, packet中只有底场
+	PictureBottomField
+)
+
+func (self PictureStructure) String() string {
+	switch self {
+	case PictureFrame:
+		return "frame"
+	case PictureInterlacedFrame:
+		return "interlaced-frame"
+	case PictureFieldPair:
+		return "field-pair"
+	case PictureTopField:
+		return "top-field"
+	case PictureBottomField:
+		return "bottom-field"
+	}
+	return "unknown"
+}
+
+// IsInterlaced 是否是隔行内容
+func (self PictureStructure) IsInterlaced() bool {
+	return self != PictureFrame
+}
+
+// IsSingleField packet是否只有一个场, 需要和另一个场组成完整的帧
+func (self PictureStructure) IsSingleField() bool {
+	return self == PictureTopField || self == PictureBottomField
+}
@@ -0,0 +1,135 @@
+package pktque
+
+import (
+	"encoding/binary"
+
+	"github.com/bugVanisher/streamer/media/av"
+	"github.com/bugVanisher/streamer/media/codec/h264parser"
+	"github.com/bugVanisher/streamer/media/codec/h265parser"
+)
+
+// NALUFormat H.264/H.265视频packet中NALU的封装格式
+type NALUFormat int
+
+const (
+	// FormatAVCC 每个NALU前是4字节长度, flv/mp4使用
+	FormatAVCC NALUFormat = iota
+	// FormatAnnexB 每个NALU前是起始码, ts/裸流使用
+	FormatAnnexB
+)
+
+func (f NALUFormat) String() string {
+	if f == FormatAnnexB {
+		return "annexb"
+	}
+	return "avcc"
+}
+
+// annexBStartCode 转为AnnexB时使用的4字节起始码
+var annexBStartCode = []byte{0, 0, 0, 1}
+
+// nalUnits 按codec拆分NALU, 返回是否为参数集/AUD的判断函数和codec中的参数集, 不是H.264/H.265时ok为false
+func nalUnits(codec av.CodecData, data []byte) (nalus [][]byte, inband func([]byte) bool, params [][]byte, ok bool) {
+	switch codec := codec.(type) {
+	case h264parser.CodecData:
+		nalus, _ = h264parser.SplitNALUs(data)
+		inband = func(nalu []byte) bool {
+			typ := nalu[0] & 0x1f
+			return typ == h264parser.NALU_SPS || typ == h264parser.NALU_PPS || typ == h264parser.NALU_AUD
+		}
+		return nalus, inband, codec.ParameterSets(), true
+	case h265parser.CodecData:
+		nalus, _ = h265parser.SplitNALUs(data)
+		inband = func(nalu []byte) bool {
+			typ := h265parser.NALUType(nalu)
+			return typ >= h265parser.NAL_UNIT_VPS && typ <= h265parser.NAL_UNIT_ACCESS_UNIT_DELIMITER
+		}
+		info := codec.RecordInfo
+		params = append(params, info.VPS...)
+		params = append(params, info.SPS...)
+		params = append(params, info.PPS...)
+		return nalus, inband, params, true
+	}
+	return
+}
+
+// ToAnnexB 把帧转为AnnexB格式, 输入可以是AVCC或AnnexB. withParams时在关键帧前插入codec中的参数集,
+// 帧中已带参数集时不重复插入. 总是返回新的切片, 不修改data
+func ToAnnexB(codec av.CodecData, data []byte, keyFrame, withParams bool) ([]byte, bool) {
+	nalus, inband, params, ok := nalUnits(codec, data)
+	if !ok {
+		return nil, false
+	}
+	if withParams && keyFrame {
+		for _, nalu := range nalus {
+			if len(nalu) > 0 && inband(nalu) {
+				params = nil
+				break
+			}
+		}
+		nalus = append(params, nalus...)
+	}
+	out := make([]byte, 0, len(data)+len(nalus)*len(annexBStartCode))
+	for _, nalu := range nalus {
+		if len(nalu) == 0 {
+			continue
+		}
+		out = append(out, annexBStartCode...)
+		out = append(out, nalu...)
+	}
+	return out, true
+}
+
+// ToAVCC 把帧转为AVCC格式, 输入可以是AVCC或AnnexB. stripParams时去掉带内的参数集和AUD,
+// 参数集由sequence header携带. 总是返回新的切片, 不修改data
+func ToAVCC(codec av.CodecData, data []byte, stripParams bool) ([]byte, bool) {
+	nalus, inband, _, ok := nalUnits(codec, data)
+	if !ok {
+		return nil, false
+	}
+	out := make([]byte, 0, len(data)+len(nalus)*4)
+	var size [4]byte
+	for _, nalu := range nalus {
+		if len(nalu) == 0 || stripParams && inband(nalu) {
+			continue
+		}
+		binary.BigEndian.PutUint32(size[:], uint32(len(nalu)))
+		out = append(out, size[:]...)
+		out = append(out, nalu...)
+	}
+	return out, true
+}
+
+// BitstreamFilter 把H.264/H.265视频packet转为Format指定的格式, 其它packet不变.
+// 转为AnnexB时在关键帧前插入参数集, 转为AVCC时去掉带内的参数集和AUD, KeepParamSets为true时都不处理参数集
+type BitstreamFilter struct {
+	Format        NALUFormat
+	KeepParamSets bool
+}
+
+// NewAnnexBFilter 转为AnnexB并在关键帧前插入参数集, 适合写ts/裸流之前使用
+func NewAnnexBFilter() *BitstreamFilter {
+	return &BitstreamFilter{Format: FormatAnnexB}
+}
+
+// NewAVCCFilter 转为AVCC并去掉带内参数集, 适合写flv/mp4之前使用
+func NewAVCCFilter() *BitstreamFilter {
+	return &BitstreamFilter{Format: FormatAVCC}
+}
+
+func (self *BitstreamFilter) ModifyPacket(pkt *av.Packet, streams []av.CodecData, videoidx int, audioidx int) (drop bool, err error) {
+	if videoidx < 0 || videoidx >= len(streams) || int(pkt.Idx) != videoidx || !pkt.IsVideoNalu() {
+		return
+	}
+	var data []byte
+	var ok bool
+	if self.Format == FormatAnnexB {
+		data, ok = ToAnnexB(streams[videoidx], pkt.Data, pkt.IsKeyFrame, !self.KeepParamSets)
+	} else {
+		data, ok = ToAVCC(streams[videoidx], pkt.Data, !self.KeepParamSets)
+	}
+	if ok {
+		pkt.Data = data
+	}
+	return
+}
@@ -0,0 +1,83 @@
+package pktque
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bugVanisher/streamer/media/av"
+	"github.com/bugVanisher/streamer/media/codec/h264parser"
+)
+
+func TestBitstreamFilter(t *testing.T) {
+	sps := []byte{0x67, 0x64, 0x00, 0x1e, 0xac, 0xd9, 0x40, 0xa0, 0x2f, 0xf9, 0x70, 0x11, 0x00, 0x00, 0x03,
+		0x00, 0x01, 0x00, 0x00, 0x03, 0x00, 0x32, 0x0f, 0x16, 0x2d, 0x96}
+	pps := []byte{0x68, 0xeb, 0xe3, 0xcb, 0x22, 0xc0}
+	h264, err := h264parser.NewCodecDataFromSPSAndPPS(sps, pps)
+	require.Nil(t, err)
+	streams := []av.CodecData{testCodec(av.AAC), h264}
+
+	avcc := func(nalus ...[]byte) (b []byte) {
+		for _, nalu := range nalus {
+			b = append(b, 0, 0, 0, byte(len(nalu)))
+			b = append(b, nalu...)
+		}
+		return
+	}
+	annexb := func(nalus ...[]byte) (b []byte) {
+		for _, nalu := range nalus {
+			b = append(b, 0, 0, 0, 1)
+			b = append(b, nalu...)
+		}
+		return
+	}
+	aud := []byte{0x09, 0xf0}
+	idr := []byte{0x65, 0x88, 0x84}
+	slice := []byte{0x41, 0x9a, 0x02}
+
+	// AVCC -> AnnexB, 关键帧前插入参数集, 源数据不变
+	toAnnexB := NewAnnexBFilter()
+	src := avcc(idr)
+	key := av.Packet{Idx: 1, DataType: av.FLV_TAG_VIDEO, AVCPacketType: av.AVC_NALU, IsKeyFrame: true, Data: src}
+	_, err = toAnnexB.ModifyPacket(&key, streams, 1, 0)
+	require.Nil(t, err)
+	require.Equal(t, annexb(sps, pps, idr), key.Data)
+	require.Equal(t, avcc(idr), src)
+
+	// 帧中已有参数集时不重复插入, 非关键帧不插入
+	key.Data = avcc(sps, pps, idr)
+	toAnnexB.ModifyPacket(&key, streams, 1, 0)
+	require.Equal(t, annexb(sps, pps, idr), key.Data)
+	inter := av.Packet{Idx: 1, DataType: av.FLV_TAG_VIDEO, AVCPacketType: av.AVC_NALU, Data: avcc(slice)}
+	toAnnexB.ModifyPacket(&inter, streams, 1, 0)
+	require.Equal(t, annexb(slice), inter.Data)
+
+	// AnnexB(3字节起始码) -> AVCC, 去掉带内参数集和AUD
+	toAVCC := NewAVCCFilter()
+	key.Data = append([]byte{0, 0, 1}, aud...)
+	key.Data = append(key.Data, annexb(sps, pps, idr)...)
+	toAVCC.ModifyPacket(&key, streams, 1, 0)
+	require.Equal(t, avcc(idr), key.Data)
+
+	toAVCC.KeepParamSets = true
+	key.Data = annexb(sps, pps, idr)
+	toAVCC.ModifyPacket(&key, streams, 1, 0)
+	require.Equal(t, avcc(sps, pps, idr), key.Data)
+
+	// 往返转换不变
+	data, ok := ToAnnexB(h264, avcc(slice, slice), false, true)
+	require.True(t, ok)
+	data, ok = ToAVCC(h264, data, true)
+	require.True(t, ok)
+	require.Equal(t, avcc(slice, slice), data)
+
+	// 音频, sequence header和非H.264/H.265视频不处理
+	audio := av.Packet{Idx: 0, DataType: av.FLV_TAG_AUDIO, Data: []byte{0x21}}
+	toAnnexB.ModifyPacket(&audio, streams, 1, 0)
+	require.Equal(t, []byte{0x21}, audio.Data)
+	seqhdr := av.Packet{Idx: 1, DataType: av.FLV_TAG_VIDEO, AVCPacketType: av.AVC_SEQHDR, Data: []byte{1, 2}}
+	toAnnexB.ModifyPacket(&seqhdr, streams, 1, 0)
+	require.Equal(t, []byte{1, 2}, seqhdr.Data)
+	_, ok = ToAnnexB(testCodec(av.AV1), avcc(idr), true, true)
+	require.False(t, ok)
+}
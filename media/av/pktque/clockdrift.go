@@ -0,0 +1,63 @@
+package pktque
+
+import (
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/bugVanisher/streamer/media/av"
+)
+
+// ClockDriftOptions 见ClockDrift
+type ClockDriftOptions struct {
+	PPM  float64       // 恒定漂移, 每秒偏离的百万分比. 正数时时间戳比墙上时钟走得快, 负数时走得慢
+	Walk time.Duration // 随机游走: 偏移量每秒变化的标准差, 0时只有恒定漂移
+	Seed int64         // 随机游走的种子, 相同的种子得到相同的偏移序列
+}
+
+// ClockDrift 模拟编码器时钟不准: 发送节奏不变(放在Walltime之后), 只按漂移改写DTS, PTS随DTS一起平移.
+// 所有流共用一个时钟, 每路流输出的时间戳保持不减, 用于测试服务端的时间戳校正和音画同步处理
+type ClockDrift struct {
+	Options ClockDriftOptions
+
+	rand    *rand.Rand
+	started bool
+	base    av.MediaTime // 第一个packet的时间戳
+	walked  av.MediaTime // 随机游走已经推进到的源时间戳
+	walk    float64      // 随机游走累计的偏移, 纳秒
+	last    map[int8]av.MediaTime
+}
+
+// NewClockDrift 创建漂移filter
+func NewClockDrift(opts ClockDriftOptions) *ClockDrift {
+	return &ClockDrift{Options: opts, rand: rand.New(rand.NewSource(opts.Seed)), last: map[int8]av.MediaTime{}}
+}
+
+// Offset 当前时间戳相对源时间戳的偏移
+func (self *ClockDrift) Offset(t av.MediaTime) time.Duration {
+	elapsed := float64(t - self.base)
+	return time.Duration(elapsed*self.Options.PPM/1e6 + self.walk)
+}
+
+func (self *ClockDrift) ModifyPacket(pkt *av.Packet, streams []av.CodecData, videoidx int, audioidx int) (drop bool, err error) {
+	if !self.started {
+		self.started = true
+		self.base, self.walked = pkt.Time, pkt.Time
+	}
+	// 源时间戳每前进dt, 偏移量增加一个标准差为Walk*sqrt(dt/1s)的随机量
+	if self.Options.Walk > 0 && pkt.Time > self.walked {
+		dt := (pkt.Time - self.walked).Duration().Seconds()
+		self.walk += self.rand.NormFloat64() * float64(self.Options.Walk) * math.Sqrt(dt)
+		self.walked = pkt.Time
+	}
+	t := pkt.Time + av.MediaTimeFromDuration(self.Offset(pkt.Time))
+	if t < 0 {
+		t = 0
+	}
+	if last, ok := self.last[pkt.Idx]; ok && t < last {
+		t = last
+	}
+	self.last[pkt.Idx] = t
+	pkt.Time = t
+	return
+}
@@ -0,0 +1,45 @@
+package pktque
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bugVanisher/streamer/media/av"
+)
+
+func TestClockDrift(t *testing.T) {
+	ms := func(n int) av.MediaTime { return av.MediaTimeFromDuration(time.Duration(n) * time.Millisecond) }
+
+	// 1000ppm: 源时间戳每秒多1ms
+	d := NewClockDrift(ClockDriftOptions{PPM: 1000})
+	for _, c := range []struct{ in, out av.MediaTime }{{ms(5000), ms(5000)}, {ms(6000), ms(6001)}, {ms(15000), ms(15010)}} {
+		pkt := av.Packet{Time: c.in}
+		_, err := d.ModifyPacket(&pkt, nil, 0, -1)
+		require.Nil(t, err)
+		require.Equal(t, c.out, pkt.Time)
+	}
+
+	// 随机游走: 相同种子结果相同, 每路流不回退
+	run := func() (times []av.MediaTime) {
+		d := NewClockDrift(ClockDriftOptions{PPM: -500, Walk: 20 * time.Millisecond, Seed: 7})
+		for i := 0; i < 500; i++ {
+			pkt := av.Packet{Idx: int8(i % 2), Time: ms(i / 2 * 40)}
+			_, err := d.ModifyPacket(&pkt, nil, 0, 1)
+			require.Nil(t, err)
+			times = append(times, pkt.Time)
+		}
+		return
+	}
+	a, b := run(), run()
+	require.Equal(t, a, b)
+	moved := false
+	for i := 2; i < len(a); i++ {
+		require.True(t, a[i] >= a[i-2])
+		if a[i] != ms(i/2*40) {
+			moved = true
+		}
+	}
+	require.True(t, moved)
+}
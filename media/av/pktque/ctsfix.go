@@ -0,0 +1,156 @@
+package pktque
+
+import (
+	"time"
+
+	"github.com/bugVanisher/streamer/media/av"
+	"github.com/bugVanisher/streamer/media/codec/h264parser"
+)
+
+// CTSFixStats CTSFixer的修正统计
+type CTSFixStats struct {
+	Frames      int64 `json:"frames"`       // 检查的视频帧数
+	DTSFixed    int64 `json:"dts_fixed"`    // 负数或不递增的DTS被修正的帧数
+	NegativeCTS int64 `json:"negative_cts"` // CompositionTime为负(PTS早于DTS)的帧数
+	Misordered  int64 `json:"misordered"`   // PTS顺序和POC顺序相反的帧数
+	CTSFixed    int64 `json:"cts_fixed"`    // CompositionTime被修改的帧数
+}
+
+// CTSFixer 校验并修正视频的DTS和CompositionTime, 用在封装TS/HLS之前:
+//   - DTS为负或不递增时改为上一帧DTS之后1ms, 保持PTS不变
+//   - H.264按slice header计算POC得到显示顺序, CompositionTime为负或PTS顺序和POC相反时,
+//     按帧间隔和重排序深度重新计算: CTS = (显示序号 - 解码序号 + 重排序深度) * 帧间隔.
+//     出现过PTS顺序错误的流之后所有帧都重新计算
+//   - 其它编码或无法计算POC时, 负的CompositionTime改为0
+//
+// 帧间隔取相邻DTS差值的最小值, 重排序深度取SPS的max_num_reorder_frames和观测到的最大值
+type CTSFixer struct {
+	Stats CTSFixStats
+
+	started  bool
+	lastDTS  av.MediaTime
+	frameDur time.Duration
+
+	order   *h264parser.PictureOrder // header变化时重新创建
+	pps     h264parser.PPSInfo
+	pocBase int // IDR的POC
+	pocStep int // 相邻显示帧的POC差值
+	prevPOC int
+	decoded int  // IDR之后的解码序号
+	reorder int  // 重排序深度(帧)
+	rewrite bool // 出现过PTS顺序错误, 之后都按POC计算
+}
+
+func (self *CTSFixer) ModifyPacket(pkt *av.Packet, streams []av.CodecData, videoidx int, audioidx int) (drop bool, err error) {
+	if pkt.Idx != int8(videoidx) || pkt.IsSequenceHeader() || len(pkt.Data) == 0 {
+		return
+	}
+	if self.order == nil || pkt.HeaderChanged {
+		self.setCodecData(streams, videoidx)
+	}
+	self.Stats.Frames++
+	self.fixDTS(pkt)
+
+	valid := pkt.CompositionTime >= 0
+	if !valid {
+		self.Stats.NegativeCTS++
+	}
+	poc, ok, misordered := self.decodePOC(pkt)
+	if misordered {
+		self.Stats.Misordered++
+		valid, self.rewrite = false, true
+	}
+	switch {
+	case ok && self.frameDur > 0 && (!valid || self.rewrite):
+		if cts := self.expectedCTS(poc); cts != pkt.CompositionTime {
+			pkt.CompositionTime = cts
+			self.Stats.CTSFixed++
+		}
+	case !valid && pkt.CompositionTime < 0:
+		pkt.CompositionTime = 0
+		self.Stats.CTSFixed++
+	}
+	return
+}
+
+// setCodecData 视频是H.264时按SPS/PPS重新开始计算POC
+func (self *CTSFixer) setCodecData(streams []av.CodecData, videoidx int) {
+	self.order = nil
+	if videoidx < 0 || videoidx >= len(streams) {
+		return
+	}
+	if codec, ok := streams[videoidx].(h264parser.CodecData); ok {
+		self.order = &h264parser.PictureOrder{SPS: codec.SPSInfo}
+		self.pps = codec.PPSInfo
+		if sps := codec.SPSInfo; sps.BitstreamRestrictionFlag == 1 && int(sps.MaxNumReorderFrames) > self.reorder {
+			self.reorder = int(sps.MaxNumReorderFrames)
+		}
+	}
+}
+
+// fixDTS 负数或不递增的DTS改为上一帧之后1ms, 调整CompositionTime保持PTS不变
+func (self *CTSFixer) fixDTS(pkt *av.Packet) {
+	floor := av.MediaTime(0)
+	if self.started {
+		floor = self.lastDTS + av.MediaTimeFromDuration(time.Millisecond)
+		if d := (pkt.Time - self.lastDTS).Duration(); d > 0 && (self.frameDur == 0 || d < self.frameDur) {
+			self.frameDur = d
+		}
+	}
+	if pkt.Time < floor {
+		pkt.CompositionTime -= (floor - pkt.Time).Duration()
+		pkt.Time = floor
+		self.Stats.DTSFixed++
+	}
+	self.started, self.lastDTS = true, pkt.Time
+}
+
+// decodePOC 计算H.264帧的POC, 同时返回PTS顺序是否和POC顺序相反
+func (self *CTSFixer) decodePOC(pkt *av.Packet) (poc int, ok, misordered bool) {
+	if self.order == nil {
+		return
+	}
+	nalus, _ := h264parser.SplitNALUs(pkt.Data)
+	for _, nalu := range nalus {
+		if !h264parser.IsDataNALU(nalu) {
+			continue
+		}
+		h, err := h264parser.ParseSliceHeader(nalu, self.order.SPS, self.pps)
+		if err != nil || h.FirstMbInSlice != 0 {
+			return
+		}
+		reorderErrors := self.order.ReorderErrors
+		self.order.Add(h, pkt.Time.Duration()+pkt.CompositionTime)
+		if poc, ok = self.order.POC(); !ok {
+			return
+		}
+		misordered = self.order.ReorderErrors > reorderErrors
+		if h.IsIDR() {
+			self.pocBase, self.decoded = poc, 0
+			if self.pocStep == 0 {
+				self.pocStep = 2
+			}
+		} else {
+			self.decoded++
+			diff := poc - self.prevPOC
+			if diff < 0 {
+				diff = -diff
+			}
+			if diff > 0 && diff < self.pocStep {
+				self.pocStep = diff
+			}
+		}
+		if lag := self.decoded - (poc-self.pocBase)/self.pocStep; lag > self.reorder {
+			self.reorder = lag
+		}
+		self.prevPOC = poc
+		return
+	}
+	return
+}
+
+// expectedCTS 按显示序号和解码序号计算的CompositionTime
+func (self *CTSFixer) expectedCTS(poc int) time.Duration {
+	order := (poc - self.pocBase) / self.pocStep
+	return time.Duration(order-self.decoded+self.reorder) * self.frameDur
+}
@@ -0,0 +1,117 @@
+package pktque
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bugVanisher/streamer/media/av"
+	"github.com/bugVanisher/streamer/media/codec/h264parser"
+)
+
+// testSlice 按frame_num 4位, pic_order_cnt_lsb 6位的SPS编码的AVCC格式slice
+func testSlice(idr, ref bool, sliceType, frameNum, pocLsb int) []byte {
+	var bits strings.Builder
+	write := func(v, n int) {
+		for i := n - 1; i >= 0; i-- {
+			bits.WriteByte('0' + byte(v>>uint(i)&1))
+		}
+	}
+	ue := func(v int) {
+		n := len(strconv.FormatInt(int64(v+1), 2))
+		write(0, n-1)
+		write(v+1, n)
+	}
+	header := 1
+	if idr {
+		header = h264parser.NALU_IDR_SLICE
+	}
+	if ref {
+		header |= 3 << 5
+	}
+	write(header, 8)
+	ue(0)         // first_mb_in_slice
+	ue(sliceType) // slice_type
+	ue(0)         // pic_parameter_set_id
+	write(frameNum, 4)
+	if idr {
+		ue(0) // idr_pic_id
+	}
+	write(pocLsb, 6)
+	write(1, 1)
+	for bits.Len()%8 != 0 {
+		bits.WriteByte('0')
+	}
+	nalu := make([]byte, bits.Len()/8)
+	for i := range nalu {
+		v, _ := strconv.ParseUint(bits.String()[i*8:i*8+8], 2, 8)
+		nalu[i] = byte(v)
+	}
+	return append([]byte{0, 0, 0, byte(len(nalu))}, nalu...)
+}
+
+func TestCTSFixerReorder(t *testing.T) {
+	codec := h264parser.CodecData{SPSInfo: h264parser.SPSInfo{Log2MaxPicOrderCntLsbMinus4: 2, FrameMbsOnlyFlag: 1}}
+	streams := []av.CodecData{codec}
+	f := &CTSFixer{}
+
+	// I0 P6 B2 B4 P12 B8 B10 | I0 P6, 25fps, 推流端没有设置CompositionTime
+	frames := []struct {
+		idr, ref  bool
+		sliceType int
+		frameNum  int
+		poc       int
+		cts       time.Duration // 修正后的CompositionTime
+	}{
+		{true, true, 7, 0, 0, 0},
+		{false, true, 5, 1, 6, 0},
+		{false, false, 6, 2, 2, 0},
+		{false, false, 6, 2, 4, 0},
+		{false, true, 5, 2, 12, 120 * time.Millisecond},
+		{false, false, 6, 3, 8, 0},
+		{false, false, 6, 3, 10, 0},
+		{true, true, 7, 0, 0, 40 * time.Millisecond},
+		{false, true, 5, 1, 6, 120 * time.Millisecond},
+	}
+	for i, fr := range frames {
+		pkt := av.Packet{DataType: av.FLV_TAG_VIDEO, AVCPacketType: av.AVC_NALU, IsKeyFrame: fr.idr,
+			Time: av.MediaTimeFromDuration(time.Duration(i) * 40 * time.Millisecond),
+			Data: testSlice(fr.idr, fr.ref, fr.sliceType, fr.frameNum, fr.poc)}
+		drop, err := f.ModifyPacket(&pkt, streams, 0, -1)
+		require.Nil(t, err)
+		require.False(t, drop)
+		require.Equal(t, fr.cts, pkt.CompositionTime, "frame %d", i)
+	}
+	require.Equal(t, CTSFixStats{Frames: 9, Misordered: 2, CTSFixed: 3}, f.Stats)
+}
+
+func TestCTSFixerDTS(t *testing.T) {
+	ms := func(n int) av.MediaTime { return av.MediaTimeFromDuration(time.Duration(n) * time.Millisecond) }
+	f := &CTSFixer{}
+	write := func(dts av.MediaTime, cts time.Duration) av.Packet {
+		pkt := av.Packet{DataType: av.FLV_TAG_VIDEO, AVCPacketType: av.AVC_NALU, Time: dts, CompositionTime: cts, Data: []byte{1}}
+		_, err := f.ModifyPacket(&pkt, nil, 0, 1)
+		require.Nil(t, err)
+		return pkt
+	}
+
+	// 负的DTS改为0, 保持PTS
+	pkt := write(ms(-80), 120*time.Millisecond)
+	require.Equal(t, ms(0), pkt.Time)
+	require.Equal(t, 40*time.Millisecond, pkt.CompositionTime)
+	// 回退的DTS改为上一帧之后1ms, PTS早于新的DTS时CompositionTime改为0
+	write(ms(40), 0)
+	pkt = write(ms(30), 0)
+	require.Equal(t, ms(41), pkt.Time)
+	require.Equal(t, time.Duration(0), pkt.CompositionTime)
+	// 非视频不处理
+	audio := av.Packet{Idx: 1, DataType: av.FLV_TAG_AUDIO, Time: ms(-10), Data: []byte{1}}
+	_, err := f.ModifyPacket(&audio, nil, 0, 1)
+	require.Nil(t, err)
+	require.Equal(t, ms(-10), audio.Time)
+
+	require.Equal(t, CTSFixStats{Frames: 3, DTSFixed: 2, NegativeCTS: 1, CTSFixed: 1}, f.Stats)
+}
@@ -0,0 +1,190 @@
+package pktque
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bugVanisher/streamer/media/av"
+)
+
+// 时间戳异常的类型, 见TimeAnomaly
+const (
+	AnomalyJump     = "jump"     // 时间戳向前跳变Amount, 之后保持该偏移
+	AnomalyReset    = "reset"    // 时间戳回到0重新开始
+	AnomalyBackward = "backward" // 时间戳回退Amount, 持续Duration后恢复
+)
+
+// DefaultJumpAmount 未指定Amount时jump的跳变量
+const DefaultJumpAmount = 10 * time.Hour
+
+// TimeAnomaly 在源时间At注入的一次时间戳异常
+type TimeAnomaly struct {
+	At       time.Duration // 相对第一个packet的源时间
+	Kind     string        // AnomalyJump/AnomalyReset/AnomalyBackward
+	Amount   time.Duration // jump/backward的跳变量
+	Duration time.Duration // backward持续的源时长, 0时只影响一个packet
+}
+
+func (a TimeAnomaly) String() string {
+	switch a.Kind {
+	case AnomalyReset:
+		return fmt.Sprintf("%s@%v", a.Kind, a.At)
+	case AnomalyBackward:
+		return fmt.Sprintf("%s@%v:%v/%v", a.Kind, a.At, a.Amount, a.Duration)
+	}
+	return fmt.Sprintf("%s@%v:%v", a.Kind, a.At, a.Amount)
+}
+
+// ParseTimeAnomalies 解析逗号分隔的异常列表, 如"jump@10s:10h,reset@20s,backward@30s:500ms/2s".
+// jump省略跳变量时为DefaultJumpAmount
+func ParseTimeAnomalies(spec string) (anomalies []TimeAnomaly, err error) {
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		kind, rest, ok := strings.Cut(item, "@")
+		if !ok {
+			return nil, fmt.Errorf("pktque: anomaly %q has no @time", item)
+		}
+		var a TimeAnomaly
+		a.Kind = kind
+		at, arg, _ := strings.Cut(rest, ":")
+		if a.At, err = time.ParseDuration(at); err != nil {
+			return nil, fmt.Errorf("pktque: anomaly %q: %v", item, err)
+		}
+		switch kind {
+		case AnomalyJump:
+			a.Amount = DefaultJumpAmount
+			if arg != "" {
+				a.Amount, err = time.ParseDuration(arg)
+			}
+		case AnomalyReset:
+			if arg != "" {
+				err = fmt.Errorf("reset takes no argument")
+			}
+		case AnomalyBackward:
+			amount, length, _ := strings.Cut(arg, "/")
+			if a.Amount, err = time.ParseDuration(amount); err == nil && length != "" {
+				a.Duration, err = time.ParseDuration(length)
+			}
+		default:
+			err = fmt.Errorf("unknown kind %q", kind)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("pktque: anomaly %q: %v", item, err)
+		}
+		anomalies = append(anomalies, a)
+	}
+	return
+}
+
+// TimeAnomalies 在指定的源时间注入时间戳异常, 用于测试服务端和拉流端对时间戳不连续的处理.
+// 放在Walltime之后时发送节奏不受影响. 按At的顺序注入, 所有流使用相同的偏移
+type TimeAnomalies struct {
+	Anomalies []TimeAnomaly
+	Injected  int // 已经注入的异常数
+
+	started  bool
+	base     av.MediaTime
+	offset   av.MediaTime // 当前持续的偏移
+	backward av.MediaTime // backward的临时偏移
+	restore  av.MediaTime // backward恢复的源时间
+}
+
+// NewTimeAnomalies 按At排序后创建filter
+func NewTimeAnomalies(anomalies []TimeAnomaly) *TimeAnomalies {
+	sorted := append([]TimeAnomaly{}, anomalies...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].At < sorted[j].At })
+	return &TimeAnomalies{Anomalies: sorted}
+}
+
+func (self *TimeAnomalies) ModifyPacket(pkt *av.Packet, streams []av.CodecData, videoidx int, audioidx int) (drop bool, err error) {
+	if !self.started {
+		self.started = true
+		self.base = pkt.Time
+	}
+	if self.backward != 0 && pkt.Time >= self.restore {
+		self.backward = 0
+	}
+	for self.Injected < len(self.Anomalies) {
+		a := self.Anomalies[self.Injected]
+		at := self.base + av.MediaTimeFromDuration(a.At)
+		if pkt.Time < at {
+			break
+		}
+		switch a.Kind {
+		case AnomalyJump:
+			self.offset += av.MediaTimeFromDuration(a.Amount)
+		case AnomalyReset:
+			self.offset = -pkt.Time
+		case AnomalyBackward:
+			self.backward = -av.MediaTimeFromDuration(a.Amount)
+			self.restore = pkt.Time + av.MediaTimeFromDuration(a.Duration)
+			if a.Duration <= 0 {
+				// 只影响当前packet
+				self.restore = pkt.Time + 1
+			}
+		}
+		self.Injected++
+	}
+	if pkt.Time += self.offset + self.backward; pkt.Time < 0 {
+		pkt.Time = 0
+	}
+	return
+}
+
+// TimeDiscontinuity 拉流端观察到的一次时间戳不连续
+type TimeDiscontinuity struct {
+	Idx  int8          `json:"idx"`
+	From time.Duration `json:"from"` // 上一个packet的时间戳
+	To   time.Duration `json:"to"`
+}
+
+// Delta 跳变量, 负数为回退
+func (d TimeDiscontinuity) Delta() time.Duration {
+	return d.To - d.From
+}
+
+func (d TimeDiscontinuity) String() string {
+	return fmt.Sprintf("stream %d %v -> %v (%+v)", d.Idx, d.From, d.To, d.Delta())
+}
+
+// DefaultDiscontinuityThreshold 相邻packet时间戳前进超过该值时认为不连续
+const DefaultDiscontinuityThreshold = time.Second
+
+// DiscontinuityDetector 拉流端检查每路流相邻packet的时间戳, 记录回退和超过Threshold的前进,
+// 用于验证服务端如何处理推流端注入的异常
+type DiscontinuityDetector struct {
+	Threshold time.Duration // 0时为DefaultDiscontinuityThreshold
+	Found     []TimeDiscontinuity
+
+	last map[int8]av.MediaTime
+}
+
+// Add 检查一个packet, 不连续时返回true
+func (self *DiscontinuityDetector) Add(pkt av.Packet) bool {
+	if pkt.IsSequenceHeader() || pkt.IsScriptData() {
+		return false
+	}
+	if self.last == nil {
+		self.last = map[int8]av.MediaTime{}
+	}
+	threshold := self.Threshold
+	if threshold <= 0 {
+		threshold = DefaultDiscontinuityThreshold
+	}
+	last, ok := self.last[pkt.Idx]
+	self.last[pkt.Idx] = pkt.Time
+	if !ok {
+		return false
+	}
+	delta := (pkt.Time - last).Duration()
+	if delta >= 0 && delta <= threshold {
+		return false
+	}
+	self.Found = append(self.Found, TimeDiscontinuity{Idx: pkt.Idx, From: last.Duration(), To: pkt.Time.Duration()})
+	return true
+}
@@ -0,0 +1,68 @@
+package pktque
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bugVanisher/streamer/media/av"
+)
+
+func TestParseTimeAnomalies(t *testing.T) {
+	anomalies, err := ParseTimeAnomalies("jump@10s, reset@20s,backward@30s:500ms/2s,jump@40s:1m")
+	require.Nil(t, err)
+	require.Equal(t, []TimeAnomaly{
+		{At: 10 * time.Second, Kind: AnomalyJump, Amount: DefaultJumpAmount},
+		{At: 20 * time.Second, Kind: AnomalyReset},
+		{At: 30 * time.Second, Kind: AnomalyBackward, Amount: 500 * time.Millisecond, Duration: 2 * time.Second},
+		{At: 40 * time.Second, Kind: AnomalyJump, Amount: time.Minute},
+	}, anomalies)
+	require.Equal(t, "backward@30s:500ms/2s", anomalies[2].String())
+
+	for _, spec := range []string{"jump", "skip@1s", "reset@1s:2s", "backward@1s"} {
+		_, err = ParseTimeAnomalies(spec)
+		require.NotNil(t, err, spec)
+	}
+}
+
+func TestTimeAnomalies(t *testing.T) {
+	src := &sliceDemuxer{streams: []av.CodecData{testCodec(av.H264), testCodec(av.AAC)}}
+	for i := 0; i < 1000; i++ {
+		ts := av.MediaTimeFromDuration(time.Second + time.Duration(i)*40*time.Millisecond)
+		src.pkts = append(src.pkts,
+			av.Packet{Idx: 0, DataType: av.FLV_TAG_VIDEO, AVCPacketType: av.AVC_NALU, Time: ts},
+			av.Packet{Idx: 1, DataType: av.FLV_TAG_AUDIO, AVCPacketType: av.AVC_NALU, Time: ts + av.MediaTimeFromDuration(20*time.Millisecond)})
+	}
+	anomalies, err := ParseTimeAnomalies("backward@30s:500ms/2s,jump@10s,reset@20s")
+	require.Nil(t, err)
+	inject := NewTimeAnomalies(anomalies)
+	d := &FilterDemuxer{Demuxer: src, Filter: inject}
+
+	detector := &DiscontinuityDetector{Threshold: 500 * time.Millisecond}
+	for {
+		pkt, err := d.ReadPacket()
+		if err == io.EOF {
+			break
+		}
+		require.Nil(t, err)
+		detector.Add(pkt)
+	}
+	require.Equal(t, 3, inject.Injected)
+
+	// 每路流: +10h, 回到0, 回退500ms, 2s后恢复
+	var video []time.Duration
+	for _, found := range detector.Found {
+		if found.Idx == 0 {
+			video = append(video, found.Delta())
+		}
+	}
+	require.Len(t, detector.Found, 8)
+	require.Equal(t, []time.Duration{
+		10*time.Hour + 40*time.Millisecond,
+		-(10*time.Hour + 21*time.Second - 40*time.Millisecond),
+		-460 * time.Millisecond,
+		540 * time.Millisecond,
+	}, video)
+}
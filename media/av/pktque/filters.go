@@ -81,9 +81,9 @@ func (self *WaitKeyFrame) ModifyPacket(pkt *av.Packet, streams []av.CodecData, v
 
 // Fix incorrect packet timestamps.
 type FixTime struct {
-	zerobase      time.Duration
-	incrbase      time.Duration
-	lasttime      time.Duration
+	zerobase      av.MediaTime
+	incrbase      av.MediaTime
+	lasttime      av.MediaTime
 	StartFromZero bool // make timestamp start from zero
 	MakeIncrement bool // force timestamp increment
 }
@@ -101,7 +101,7 @@ func (self *FixTime) ModifyPacket(pkt *av.Packet, streams []av.CodecData, videoi
 		if self.lasttime == 0 {
 			self.lasttime = pkt.Time
 		}
-		if pkt.Time < self.lasttime || pkt.Time > self.lasttime+time.Millisecond*500 {
+		if pkt.Time < self.lasttime || pkt.Time > self.lasttime+av.MediaTime(time.Millisecond*500) {
 			self.incrbase += pkt.Time - self.lasttime
 			pkt.Time = self.lasttime
 		}
@@ -114,12 +114,12 @@ func (self *FixTime) ModifyPacket(pkt *av.Packet, streams []av.CodecData, videoi
 // Drop incorrect packets to make A/V sync.
 type AVSync struct {
 	MaxTimeDiff time.Duration
-	time        []time.Duration
+	time        []av.MediaTime
 }
 
 func (self *AVSync) ModifyPacket(pkt *av.Packet, streams []av.CodecData, videoidx int, audioidx int) (drop bool, err error) {
 	if self.time == nil {
-		self.time = make([]time.Duration, len(streams))
+		self.time = make([]av.MediaTime, len(streams))
 		if self.MaxTimeDiff == 0 {
 			self.MaxTimeDiff = time.Millisecond * 500
 		}
@@ -141,7 +141,7 @@ func (self *AVSync) ModifyPacket(pkt *av.Packet, streams []av.CodecData, videoid
 	return
 }
 
-func (self *AVSync) check(i int) (start time.Duration, end time.Duration, correctable bool, correcttime time.Duration) {
+func (self *AVSync) check(i int) (start av.MediaTime, end av.MediaTime, correctable bool, correcttime av.MediaTime) {
 	minidx := -1
 	maxidx := -1
 	for j := range self.time {
@@ -165,8 +165,8 @@ func (self *AVSync) check(i int) (start time.Duration, end time.Duration, correc
 	}
 
 	start = self.time[minidx]
-	end = start + self.MaxTimeDiff
-	correcttime = start + time.Millisecond*40
+	end = start + av.MediaTime(self.MaxTimeDiff)
+	correcttime = start + av.MediaTime(time.Millisecond*40)
 	return
 }
 
@@ -180,7 +180,7 @@ func (self *Walltime) ModifyPacket(pkt *av.Packet, streams []av.CodecData, video
 		if self.firsttime.IsZero() {
 			self.firsttime = time.Now()
 		}
-		pkttime := self.firsttime.Add(pkt.Time)
+		pkttime := self.firsttime.Add(pkt.Time.Duration())
 		delta := pkttime.Sub(time.Now())
 		if delta > 0 {
 			time.Sleep(delta)
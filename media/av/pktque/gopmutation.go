@@ -0,0 +1,260 @@
+package pktque
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bugVanisher/streamer/media/av"
+	"github.com/bugVanisher/streamer/media/codec/h264parser"
+	"github.com/bugVanisher/streamer/media/codec/h265parser"
+	"github.com/bugVanisher/streamer/utils/bits/pio"
+)
+
+// GOP结构异常的类型, 见GOPMutation. 都是编码器常见的不规范行为, 用来验证源站和拉流端能容忍哪些
+const (
+	MutationDropIDR       = "drop-idr"   // 丢掉关键帧, GOP从非IDR帧开始
+	MutationStripPS       = "strip-ps"   // 去掉关键帧中带内的VPS/SPS/PPS
+	MutationNoHeader      = "no-header"  // header变化时不重发sequence header, 新参数集的IDR之前没有header
+	MutationPPSChangeOnly = "pps-change" // SPS不变只改变PPS, 重发sequence header
+)
+
+// GOPMutation 从源时间At开始持续Duration的GOP结构异常, Duration为0时只影响At之后的第一个关键帧
+type GOPMutation struct {
+	At       time.Duration // 相对第一个packet的源时间
+	Kind     string        // MutationDropIDR/MutationStripPS/MutationNoHeader/MutationPPSChangeOnly
+	Duration time.Duration // pps-change不使用
+}
+
+func (m GOPMutation) String() string {
+	if m.Duration > 0 {
+		return fmt.Sprintf("%s@%v/%v", m.Kind, m.At, m.Duration)
+	}
+	return fmt.Sprintf("%s@%v", m.Kind, m.At)
+}
+
+// ParseGOPMutations 解析逗号分隔的异常列表, 如"drop-idr@10s,strip-ps@20s/10s,pps-change@30s,no-header@40s/10s"
+func ParseGOPMutations(spec string) (mutations []GOPMutation, err error) {
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		kind, rest, ok := strings.Cut(item, "@")
+		if !ok {
+			return nil, fmt.Errorf("pktque: gop mutation %q has no @time", item)
+		}
+		var m GOPMutation
+		m.Kind = kind
+		at, length, _ := strings.Cut(rest, "/")
+		if m.At, err = time.ParseDuration(at); err == nil && length != "" {
+			m.Duration, err = time.ParseDuration(length)
+		}
+		switch kind {
+		case MutationDropIDR, MutationStripPS, MutationNoHeader:
+		case MutationPPSChangeOnly:
+			if length != "" {
+				err = fmt.Errorf("pps-change takes no duration")
+			}
+		default:
+			err = fmt.Errorf("unknown kind %q", kind)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("pktque: gop mutation %q: %v", item, err)
+		}
+		mutations = append(mutations, m)
+	}
+	return
+}
+
+// GOPMutationDemuxer 按源时间对视频流注入GOP结构异常. pps-change需要替换header, 所以包装Demuxer而不是作为Filter,
+// 放在FixTime之后时文件循环推送也只注入一次
+type GOPMutationDemuxer struct {
+	Demuxer   av.Demuxer
+	Mutations []GOPMutation
+	Applied   map[string]int // 每种异常影响的packet数
+
+	started  bool
+	base     av.MediaTime
+	active   []activeMutation
+	next     int
+	streams  []av.CodecData
+	videoidx int
+	replaced av.CodecData // pps-change后的视频header
+	padded   bool
+}
+
+type activeMutation struct {
+	GOPMutation
+	end  av.MediaTime
+	once bool
+}
+
+// NewGOPMutationDemuxer 按At排序后包装src
+func NewGOPMutationDemuxer(src av.Demuxer, mutations []GOPMutation) *GOPMutationDemuxer {
+	sorted := append([]GOPMutation{}, mutations...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].At < sorted[j].At })
+	return &GOPMutationDemuxer{Demuxer: src, Mutations: sorted, Applied: map[string]int{}, videoidx: -1}
+}
+
+// Streams 返回源的header, pps-change之后视频header为替换了PPS的CodecData
+func (self *GOPMutationDemuxer) Streams() (streams []av.CodecData, err error) {
+	if self.streams, err = self.Demuxer.Streams(); err != nil {
+		return
+	}
+	self.videoidx = -1
+	for i, stream := range self.streams {
+		if stream.Type().IsVideo() {
+			self.videoidx = i
+		}
+	}
+	if self.replaced == nil || self.videoidx < 0 {
+		return self.streams, nil
+	}
+	streams = append([]av.CodecData{}, self.streams...)
+	streams[self.videoidx] = self.replaced
+	return
+}
+
+func (self *GOPMutationDemuxer) ReadPacket() (pkt av.Packet, err error) {
+	if self.streams == nil {
+		if _, err = self.Streams(); err != nil {
+			return
+		}
+	}
+	for {
+		if pkt, err = self.Demuxer.ReadPacket(); err != nil {
+			return
+		}
+		if pkt.HeaderChanged {
+			// 源的header变化时替换的PPS失效
+			self.replaced = nil
+			if _, err = self.Streams(); err != nil {
+				return
+			}
+		}
+		var drop bool
+		if drop, err = self.mutate(&pkt); err != nil {
+			return
+		}
+		if !drop {
+			return
+		}
+	}
+}
+
+func (self *GOPMutationDemuxer) mutate(pkt *av.Packet) (drop bool, err error) {
+	if pkt.Idx != int8(self.videoidx) || pkt.IsScriptData() {
+		return
+	}
+	if !self.started {
+		self.started = true
+		self.base = pkt.Time
+	}
+	for self.next < len(self.Mutations) {
+		m := self.Mutations[self.next]
+		at := self.base + av.MediaTimeFromDuration(m.At)
+		if pkt.Time < at {
+			break
+		}
+		self.active = append(self.active, activeMutation{GOPMutation: m, end: at + av.MediaTimeFromDuration(m.Duration), once: m.Duration <= 0})
+		self.next++
+	}
+
+	active := self.active[:0]
+	for _, m := range self.active {
+		if !m.once && pkt.Time >= m.end {
+			continue
+		}
+		applied := false
+		switch m.Kind {
+		case MutationNoHeader:
+			if pkt.IsSequenceHeader() {
+				drop, applied = true, true
+			} else if pkt.HeaderChanged {
+				pkt.HeaderChanged, applied = false, true
+			}
+		case MutationDropIDR:
+			if pkt.IsKeyFrame && !pkt.IsSequenceHeader() {
+				drop, applied = true, true
+			}
+		case MutationStripPS:
+			if pkt.IsKeyFrame && !pkt.IsSequenceHeader() {
+				applied = self.stripParamSets(pkt)
+			}
+		case MutationPPSChangeOnly:
+			if pkt.IsKeyFrame && !pkt.IsSequenceHeader() && !drop {
+				if err = self.changePPS(); err != nil {
+					return
+				}
+				pkt.HeaderChanged, applied = true, true
+			}
+		}
+		if applied {
+			self.Applied[m.Kind]++
+		}
+		// Duration为0的异常只影响At之后的第一个关键帧(no-header为第一次header变化)
+		if m.once && (applied && m.Kind == MutationNoHeader || pkt.IsKeyFrame && !pkt.IsSequenceHeader() && m.Kind != MutationNoHeader) {
+			continue
+		}
+		active = append(active, m)
+	}
+	self.active = active
+	return
+}
+
+// stripParamSets 去掉avcc格式的关键帧中的参数集nalu, 有修改时返回true
+func (self *GOPMutationDemuxer) stripParamSets(pkt *av.Packet) bool {
+	nalus, typ := h264parser.SplitNALUs(pkt.Data)
+	if typ != h264parser.NALU_AVCC {
+		return false
+	}
+	isH265 := self.streams[self.videoidx].Type() == av.H265
+	data := make([]byte, 0, len(pkt.Data))
+	stripped := false
+	for _, nalu := range nalus {
+		if len(nalu) > 0 {
+			var ps bool
+			if isH265 {
+				typ := h265parser.NALUType(nalu)
+				ps = typ == h265parser.NAL_UNIT_VPS || typ == h265parser.NAL_UNIT_SPS || typ == h265parser.NAL_UNIT_PPS
+			} else {
+				typ := nalu[0] & 0x1f
+				ps = typ == h264parser.NALU_SPS || typ == h264parser.NALU_PPS
+			}
+			if ps {
+				stripped = true
+				continue
+			}
+		}
+		var size [4]byte
+		pio.PutU32BE(size[:], uint32(len(nalu)))
+		data = append(append(data, size[:]...), nalu...)
+	}
+	if stripped {
+		pkt.Data = data
+	}
+	return stripped
+}
+
+// changePPS 在PPS末尾交替添加/去掉一个0字节, 解码结果不变但header的字节不同
+func (self *GOPMutationDemuxer) changePPS() (err error) {
+	self.padded = !self.padded
+	pad := func(pps []byte) []byte {
+		pps = append([]byte{}, pps...)
+		if self.padded {
+			pps = append(pps, 0)
+		}
+		return pps
+	}
+	switch codec := self.streams[self.videoidx].(type) {
+	case h264parser.CodecData:
+		self.replaced, err = h264parser.NewCodecDataFromSPSAndPPS(codec.SPS(), pad(codec.PPS()))
+	case h265parser.CodecData:
+		self.replaced, err = h265parser.NewCodecDataFromVPSAndSPSAndPPS(codec.VPS(), codec.SPS(), pad(codec.PPS()))
+	default:
+		err = fmt.Errorf("pktque: pps-change does not support %v", codec.Type())
+	}
+	return
+}
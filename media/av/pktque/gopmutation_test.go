@@ -0,0 +1,92 @@
+package pktque
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bugVanisher/streamer/media/av"
+	"github.com/bugVanisher/streamer/media/codec/h264parser"
+)
+
+func TestParseGOPMutations(t *testing.T) {
+	mutations, err := ParseGOPMutations("drop-idr@10s, strip-ps@20s/10s,pps-change@30s")
+	require.Nil(t, err)
+	require.Equal(t, []GOPMutation{
+		{At: 10 * time.Second, Kind: MutationDropIDR},
+		{At: 20 * time.Second, Kind: MutationStripPS, Duration: 10 * time.Second},
+		{At: 30 * time.Second, Kind: MutationPPSChangeOnly},
+	}, mutations)
+	require.Equal(t, "strip-ps@20s/10s", mutations[1].String())
+
+	for _, spec := range []string{"drop-idr", "drop-sps@1s", "pps-change@1s/2s", "no-header@x"} {
+		_, err = ParseGOPMutations(spec)
+		require.NotNil(t, err, spec)
+	}
+}
+
+func TestGOPMutationDemuxer(t *testing.T) {
+	sps := []byte{0x67, 0x64, 0x00, 0x1e, 0xac, 0xd9, 0x40, 0xa0, 0x2f, 0xf9, 0x70, 0x11, 0x00, 0x00, 0x03,
+		0x00, 0x01, 0x00, 0x00, 0x03, 0x00, 0x32, 0x0f, 0x16, 0x2d, 0x96}
+	pps := []byte{0x68, 0xeb, 0xe3, 0xcb, 0x22, 0xc0}
+	h264, err := h264parser.NewCodecDataFromSPSAndPPS(sps, pps)
+	require.Nil(t, err)
+
+	// 每秒一个GOP, 关键帧带内有SPS/PPS
+	avcc := func(nalus ...[]byte) (b []byte) {
+		for _, nalu := range nalus {
+			b = append(b, 0, 0, 0, byte(len(nalu)))
+			b = append(b, nalu...)
+		}
+		return
+	}
+	idr := avcc(sps, pps, []byte{0x65, 0x88})
+	src := &sliceDemuxer{streams: []av.CodecData{h264, testCodec(av.AAC)}}
+	for i := 0; i < 100; i++ {
+		ts := av.MediaTimeFromDuration(time.Duration(i) * 100 * time.Millisecond)
+		pkt := av.Packet{Idx: 0, DataType: av.FLV_TAG_VIDEO, AVCPacketType: av.AVC_NALU, Time: ts, Data: avcc([]byte{0x41, 0x9a})}
+		if i%10 == 0 {
+			pkt.IsKeyFrame, pkt.Data = true, idr
+		}
+		src.pkts = append(src.pkts, pkt, av.Packet{Idx: 1, DataType: av.FLV_TAG_AUDIO, Time: ts})
+	}
+	mutations, err := ParseGOPMutations("drop-idr@2s,strip-ps@4s/2s,pps-change@7s,pps-change@8500ms")
+	require.Nil(t, err)
+	d := NewGOPMutationDemuxer(src, mutations)
+
+	var keyframes, stripped, audio int
+	var headers [][]byte
+	for {
+		pkt, err := d.ReadPacket()
+		if err == io.EOF {
+			break
+		}
+		require.Nil(t, err)
+		if pkt.Idx == 1 {
+			audio++
+			continue
+		}
+		if pkt.HeaderChanged {
+			streams, err := d.Streams()
+			require.Nil(t, err)
+			headers = append(headers, streams[0].(h264parser.CodecData).PPS())
+			require.Equal(t, sps, streams[0].(h264parser.CodecData).SPS())
+		}
+		if pkt.IsKeyFrame {
+			keyframes++
+			if !bytes.Equal(pkt.Data, idr) {
+				stripped++
+				require.Equal(t, avcc([]byte{0x65, 0x88}), pkt.Data)
+			}
+		}
+	}
+	require.Equal(t, 100, audio)
+	require.Equal(t, 9, keyframes)
+	require.Equal(t, 2, stripped)
+	// 两次只改变PPS: 先加一个0字节, 再恢复
+	require.Equal(t, [][]byte{append(append([]byte{}, pps...), 0), pps}, headers)
+	require.Equal(t, map[string]int{MutationDropIDR: 1, MutationStripPS: 2, MutationPPSChangeOnly: 2}, d.Applied)
+}
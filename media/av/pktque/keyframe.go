@@ -0,0 +1,81 @@
+package pktque
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/bugVanisher/streamer/media/av"
+)
+
+// KeyFrameOnly 只保留视频关键帧, MinInterval大于0时两个输出帧的时间间隔至少为MinInterval, 比如time.Second为最多1fps.
+// 被丢弃的包上的HeaderChanged转移到下一个输出的关键帧
+type KeyFrameOnly struct {
+	MinInterval time.Duration
+	last        av.MediaTime
+	started     bool
+	changed     bool
+}
+
+func (self *KeyFrameOnly) ModifyPacket(pkt *av.Packet, streams []av.CodecData, videoidx int, audioidx int) (drop bool, err error) {
+	drop = pkt.Idx != int8(videoidx) || !pkt.IsKeyFrame || pkt.IsSequenceHeader() || pkt.IsScriptData() ||
+		self.started && pkt.Time-self.last < av.MediaTimeFromDuration(self.MinInterval)
+	if drop {
+		self.changed = self.changed || pkt.HeaderChanged
+		return
+	}
+	self.last, self.started = pkt.Time, true
+	if self.changed {
+		pkt.HeaderChanged, self.changed = true, false
+	}
+	return
+}
+
+// KeyFrameDemuxer 关键帧预览流(缩略图轨道), Streams只返回视频流, ReadPacket只输出视频关键帧且Idx为0
+type KeyFrameDemuxer struct {
+	Demuxer  av.Demuxer
+	Filter   KeyFrameOnly
+	videoidx int
+	probed   bool
+}
+
+// NewKeyFrameDemuxer 包装src输出关键帧预览流, minInterval见KeyFrameOnly.MinInterval
+func NewKeyFrameDemuxer(src av.Demuxer, minInterval time.Duration) *KeyFrameDemuxer {
+	return &KeyFrameDemuxer{Demuxer: src, Filter: KeyFrameOnly{MinInterval: minInterval}}
+}
+
+// Streams 返回源的视频流, header变化后重新调用时更新视频流的位置
+func (self *KeyFrameDemuxer) Streams() (streams []av.CodecData, err error) {
+	var all []av.CodecData
+	if all, err = self.Demuxer.Streams(); err != nil {
+		return
+	}
+	for i, stream := range all {
+		if stream.Type().IsVideo() {
+			self.videoidx, self.probed = i, true
+			return []av.CodecData{stream}, nil
+		}
+	}
+	err = fmt.Errorf("pktque: no video stream for keyframe output")
+	return
+}
+
+func (self *KeyFrameDemuxer) ReadPacket() (pkt av.Packet, err error) {
+	if !self.probed {
+		if _, err = self.Streams(); err != nil {
+			return
+		}
+	}
+	for {
+		if pkt, err = self.Demuxer.ReadPacket(); err != nil {
+			return
+		}
+		var drop bool
+		if drop, err = self.Filter.ModifyPacket(&pkt, nil, self.videoidx, -1); err != nil {
+			return
+		}
+		if !drop {
+			pkt.Idx = 0
+			return
+		}
+	}
+}
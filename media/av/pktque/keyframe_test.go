@@ -0,0 +1,62 @@
+package pktque
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bugVanisher/streamer/media/av"
+)
+
+type testCodec av.CodecType
+
+func (c testCodec) Type() av.CodecType { return av.CodecType(c) }
+
+type sliceDemuxer struct {
+	streams []av.CodecData
+	pkts    []av.Packet
+}
+
+func (d *sliceDemuxer) Streams() ([]av.CodecData, error) { return d.streams, nil }
+
+func (d *sliceDemuxer) ReadPacket() (pkt av.Packet, err error) {
+	if len(d.pkts) == 0 {
+		return pkt, io.EOF
+	}
+	pkt, d.pkts = d.pkts[0], d.pkts[1:]
+	return
+}
+
+func TestKeyFrameDemuxer(t *testing.T) {
+	src := &sliceDemuxer{streams: []av.CodecData{testCodec(av.AAC), testCodec(av.H264)}}
+	// 25fps, 每12帧一个关键帧, 每帧视频之后一个音频包
+	for i := 0; i < 100; i++ {
+		ts := av.MediaTimeFromDuration(time.Duration(i) * 40 * time.Millisecond)
+		src.pkts = append(src.pkts,
+			av.Packet{Idx: 1, DataType: av.FLV_TAG_VIDEO, AVCPacketType: av.AVC_NALU, IsKeyFrame: i%12 == 0, Time: ts},
+			av.Packet{Idx: 0, DataType: av.FLV_TAG_AUDIO, AVCPacketType: av.AVC_NALU, Time: ts})
+	}
+	// header变化标记在被丢弃的音频包上
+	src.pkts[3].HeaderChanged = true
+
+	d := NewKeyFrameDemuxer(src, 900*time.Millisecond)
+	streams, err := d.Streams()
+	require.Nil(t, err)
+	require.Equal(t, []av.CodecData{testCodec(av.H264)}, streams)
+
+	var times []time.Duration
+	for {
+		pkt, err := d.ReadPacket()
+		if err == io.EOF {
+			break
+		}
+		require.Nil(t, err)
+		require.Equal(t, int8(0), pkt.Idx)
+		require.True(t, pkt.IsKeyFrame)
+		require.Equal(t, pkt.Time == av.MediaTimeFromDuration(960*time.Millisecond), pkt.HeaderChanged)
+		times = append(times, pkt.Time.Duration())
+	}
+	require.Equal(t, []time.Duration{0, 960 * time.Millisecond, 1920 * time.Millisecond, 2880 * time.Millisecond, 3840 * time.Millisecond}, times)
+}
@@ -0,0 +1,140 @@
+package pktque
+
+import (
+	"fmt"
+	"hash"
+	"hash/fnv"
+	"time"
+
+	"github.com/bugVanisher/streamer/media/av"
+)
+
+const (
+	// DefaultLoopMinGOPs 连续多少个GOP按原顺序重复出现才认为是循环内容
+	DefaultLoopMinGOPs = 3
+	// DefaultLoopMaxPeriod 能检测到的最长循环周期, 更早的GOP指纹不再保留
+	DefaultLoopMaxPeriod = 10 * time.Minute
+)
+
+// ContentLoop 拉流端观察到的一次内容循环
+type ContentLoop struct {
+	At     time.Duration `json:"at"`     // 确认循环时的时间戳
+	Period time.Duration `json:"period"` // 循环周期, 即重复内容上次出现到这次的时间差
+}
+
+func (l ContentLoop) String() string {
+	return fmt.Sprintf("loop period %v at %v", l.Period, l.At)
+}
+
+// gopPrint 一个GOP的指纹
+type gopPrint struct {
+	hash  uint64
+	start av.MediaTime
+}
+
+// LoopDetector 拉流端用视频GOP的指纹检查内容是否循环(如压测推流端循环推同一个文件),
+// 用于区分真实的直播源和循环的测试内容. 时间戳连续改写过的循环也能检测到, 纯音频流不检测.
+// 完全静止的画面每个GOP都相同, 会被当作周期为一个GOP的循环
+type LoopDetector struct {
+	MinGOPs   int           // 0时为DefaultLoopMinGOPs
+	MaxPeriod time.Duration // 0时为DefaultLoopMaxPeriod
+	Found     []ContentLoop
+
+	prints []gopPrint
+	base   int            // prints[0]的序号, 淘汰旧指纹后增长
+	index  map[uint64]int // 指纹最近一次出现的序号
+
+	cur     hash.Hash64 // 当前GOP的指纹, 第一个关键帧之前为nil
+	curTime av.MediaTime
+
+	next   int // 正在匹配的循环中下一个GOP应该重复的序号
+	run    int // 已经按顺序重复的GOP数
+	period av.MediaTime
+}
+
+// Looped 是否检测到过循环
+func (self *LoopDetector) Looped() bool {
+	return len(self.Found) > 0
+}
+
+// Period 最近一次检测到的循环周期, 没有循环时为0
+func (self *LoopDetector) Period() time.Duration {
+	if len(self.Found) == 0 {
+		return 0
+	}
+	return self.Found[len(self.Found)-1].Period
+}
+
+// Add 检查一个packet, 确认一次循环时返回true
+func (self *LoopDetector) Add(pkt av.Packet) bool {
+	if !pkt.IsVideoNalu() {
+		return false
+	}
+	found := false
+	if pkt.IsKeyFrame {
+		if self.cur != nil {
+			found = self.endGOP(self.cur.Sum64(), self.curTime)
+			self.cur.Reset()
+		} else {
+			self.cur = fnv.New64a()
+		}
+		self.curTime = pkt.Time
+	}
+	if self.cur != nil {
+		self.cur.Write(pkt.Data)
+	}
+	return found
+}
+
+// endGOP 一个GOP结束, 和之前的GOP比较
+func (self *LoopDetector) endGOP(sum uint64, start av.MediaTime) (found bool) {
+	if self.index == nil {
+		self.index = map[uint64]int{}
+	}
+	minGOPs := self.MinGOPs
+	if minGOPs <= 0 {
+		minGOPs = DefaultLoopMinGOPs
+	}
+	maxPeriod := self.MaxPeriod
+	if maxPeriod <= 0 {
+		maxPeriod = DefaultLoopMaxPeriod
+	}
+
+	if self.run > 0 {
+		if p, ok := self.print(self.next); ok && p.hash == sum {
+			self.run++
+			self.next++
+		} else {
+			self.run = 0
+		}
+	}
+	if self.run == 0 {
+		if i, ok := self.index[sum]; ok && i >= self.base {
+			self.run, self.next = 1, i+1
+			self.period = start - self.prints[i-self.base].start
+		}
+	}
+	if self.run == minGOPs && self.period > 0 {
+		self.Found = append(self.Found, ContentLoop{At: start.Duration(), Period: self.period.Duration()})
+		found = true
+	}
+
+	self.index[sum] = self.base + len(self.prints)
+	self.prints = append(self.prints, gopPrint{hash: sum, start: start})
+	// 淘汰超过MaxPeriod的指纹, 正在匹配的循环不受影响
+	for len(self.prints) > 0 && start-self.prints[0].start > av.MediaTimeFromDuration(maxPeriod) && (self.run == 0 || self.base < self.next) {
+		if self.index[self.prints[0].hash] == self.base {
+			delete(self.index, self.prints[0].hash)
+		}
+		self.prints = self.prints[1:]
+		self.base++
+	}
+	return
+}
+
+func (self *LoopDetector) print(i int) (gopPrint, bool) {
+	if i < self.base || i >= self.base+len(self.prints) {
+		return gopPrint{}, false
+	}
+	return self.prints[i-self.base], true
+}
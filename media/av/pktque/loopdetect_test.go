@@ -0,0 +1,58 @@
+package pktque
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bugVanisher/streamer/media/av"
+)
+
+// loopPackets gops个不同的GOP循环推loops遍, 时间戳连续, 每个GOP 1s
+func loopPackets(gops, loops int) (pkts []av.Packet) {
+	var ts time.Duration
+	for l := 0; l < loops; l++ {
+		for g := 0; g < gops; g++ {
+			for f := 0; f < 25; f++ {
+				pkts = append(pkts, av.Packet{DataType: av.FLV_TAG_VIDEO, AVCPacketType: av.AVC_NALU,
+					IsKeyFrame: f == 0, Time: av.MediaTimeFromDuration(ts), Data: []byte{byte(g), byte(f)}})
+				pkts = append(pkts, av.Packet{Idx: 1, DataType: av.FLV_TAG_AUDIO, AVCPacketType: av.AVC_NALU,
+					Time: av.MediaTimeFromDuration(ts), Data: []byte{byte(l)}})
+				ts += 40 * time.Millisecond
+			}
+		}
+	}
+	return
+}
+
+func TestLoopDetector(t *testing.T) {
+	d := &LoopDetector{}
+	var at []time.Duration
+	for _, pkt := range loopPackets(10, 3) {
+		if d.Add(pkt) {
+			at = append(at, pkt.Time.Duration())
+		}
+	}
+	require.True(t, d.Looped())
+	require.Equal(t, 10*time.Second, d.Period())
+	// 第二遍的第3个GOP结束时确认, 之后持续循环不重复报告
+	require.Equal(t, []time.Duration{13 * time.Second}, at)
+	require.Equal(t, []ContentLoop{{At: 12 * time.Second, Period: 10 * time.Second}}, d.Found)
+
+	// 内容不重复
+	d = &LoopDetector{}
+	for _, pkt := range loopPackets(30, 1) {
+		require.False(t, d.Add(pkt))
+	}
+	require.False(t, d.Looped())
+	require.Equal(t, time.Duration(0), d.Period())
+
+	// 周期超过MaxPeriod时检测不到
+	d = &LoopDetector{MaxPeriod: 5 * time.Second}
+	for _, pkt := range loopPackets(10, 3) {
+		d.Add(pkt)
+	}
+	require.False(t, d.Looped())
+	require.True(t, len(d.prints) <= 7)
+}
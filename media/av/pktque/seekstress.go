@@ -0,0 +1,165 @@
+package pktque
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"time"
+
+	"github.com/bugVanisher/streamer/media/av"
+)
+
+// DefaultSeekSegment 未指定SegmentLength时每次seek之后播放的时长
+const DefaultSeekSegment = 2 * time.Second
+
+// SeekStressOptions 见SeekStressDemuxer
+type SeekStressOptions struct {
+	SegmentLength time.Duration // 每次seek之后播放的源时长, 0时为DefaultSeekSegment
+	Reverse       bool          // 倒放: 每次seek到上一段起点之前的关键帧, 到文件开头后从最后一个关键帧重新开始. 否则随机选择关键帧
+	Monotonic     bool          // 时间戳保持递增, seek的距离体现为向前的跳变. 否则输出源时间戳, 向后seek时时间戳回退
+	Pace          bool          // 按实际播放的时长实时输出, 不受时间戳跳变影响
+	Seed          int64         // 随机seek的种子, 相同的种子得到相同的seek序列
+}
+
+// SeekStressDemuxer 在录制的文件中反复seek到视频关键帧推送, 用于测试源站对时间戳跳变的处理.
+// 源的全部packet在第一次读取时载入内存, 之后一直输出不会返回io.EOF. 文件中途的header变化被忽略
+type SeekStressDemuxer struct {
+	Demuxer av.Demuxer
+	Options SeekStressOptions
+	Seeks   int // 已经执行的seek次数
+
+	rand    *rand.Rand
+	loaded  bool
+	pkts    []av.Packet
+	keys    []int // 视频关键帧在pkts中的下标
+	key     int   // 当前段起点在keys中的下标
+	pos     int   // 下一个输出的packet
+	segEnd  av.MediaTime
+	segBase av.MediaTime // 当前段起点的输出时间戳
+	lastOut av.MediaTime
+	started time.Time
+	played  time.Duration // 之前各段已播放的时长
+}
+
+// NewSeekStressDemuxer 包装src反复seek输出
+func NewSeekStressDemuxer(src av.Demuxer, opts SeekStressOptions) *SeekStressDemuxer {
+	if opts.SegmentLength <= 0 {
+		opts.SegmentLength = DefaultSeekSegment
+	}
+	return &SeekStressDemuxer{Demuxer: src, Options: opts, rand: rand.New(rand.NewSource(opts.Seed))}
+}
+
+func (self *SeekStressDemuxer) Streams() ([]av.CodecData, error) {
+	return self.Demuxer.Streams()
+}
+
+func (self *SeekStressDemuxer) ReadPacket() (pkt av.Packet, err error) {
+	if !self.loaded {
+		if err = self.load(); err != nil {
+			return
+		}
+		self.setSegment(self.startKey())
+		self.segBase = self.pkts[self.pos].Time
+	}
+	if self.pos >= len(self.pkts) || self.pkts[self.pos].Time >= self.segEnd {
+		self.seek(self.nextKey())
+	}
+	pkt = self.pkts[self.pos]
+	self.pos++
+	start := self.pkts[self.keys[self.key]].Time
+	offset := pkt.Time - start
+	if self.Options.Monotonic {
+		// 关键帧之后交错的音频可能早于关键帧, 不早于段起点以免回退到上一段
+		if pkt.Time = offset + self.segBase; pkt.Time < self.segBase {
+			pkt.Time = self.segBase
+		}
+		if pkt.Time > self.lastOut {
+			self.lastOut = pkt.Time
+		}
+	}
+	pkt.HeaderChanged = false
+	if self.Options.Pace {
+		self.pace(offset)
+	}
+	return
+}
+
+// load 读入源的全部packet并记录视频关键帧的位置
+func (self *SeekStressDemuxer) load() (err error) {
+	streams, err := self.Demuxer.Streams()
+	if err != nil {
+		return
+	}
+	videoidx := -1
+	for i, stream := range streams {
+		if stream.Type().IsVideo() {
+			videoidx = i
+			break
+		}
+	}
+	for {
+		var pkt av.Packet
+		if pkt, err = self.Demuxer.ReadPacket(); err != nil {
+			if err != io.EOF {
+				return
+			}
+			break
+		}
+		if pkt.Idx == int8(videoidx) && pkt.IsKeyFrame && !pkt.IsSequenceHeader() {
+			self.keys = append(self.keys, len(self.pkts))
+		}
+		self.pkts = append(self.pkts, pkt)
+	}
+	if len(self.keys) == 0 {
+		return fmt.Errorf("pktque: seek stress needs video keyframes in the source")
+	}
+	self.loaded = true
+	return nil
+}
+
+func (self *SeekStressDemuxer) startKey() int {
+	if self.Options.Reverse {
+		return len(self.keys) - 1
+	}
+	return 0
+}
+
+func (self *SeekStressDemuxer) nextKey() int {
+	if self.Options.Reverse {
+		if self.key == 0 {
+			return len(self.keys) - 1
+		}
+		return self.key - 1
+	}
+	return self.rand.Intn(len(self.keys))
+}
+
+// seek 结束当前段, 从keys[key]开始新的一段
+func (self *SeekStressDemuxer) seek(key int) {
+	prevStart := self.pkts[self.keys[self.key]].Time
+	prevEnd := self.pkts[self.pos-1].Time
+	self.played += (prevEnd - prevStart).Duration()
+	self.Seeks++
+	// 向前或向后seek的距离都作为向前的跳变
+	jump := self.pkts[self.keys[key]].Time - prevEnd
+	if jump < 0 {
+		jump = -jump
+	}
+	self.segBase = self.lastOut + jump
+	self.setSegment(key)
+}
+
+func (self *SeekStressDemuxer) setSegment(key int) {
+	self.key, self.pos = key, self.keys[key]
+	self.segEnd = self.pkts[self.pos].Time + av.MediaTimeFromDuration(self.Options.SegmentLength)
+}
+
+// pace 等待到当前段内offset对应的播放时刻
+func (self *SeekStressDemuxer) pace(offset av.MediaTime) {
+	if self.started.IsZero() {
+		self.started = time.Now()
+	}
+	if delta := time.Until(self.started.Add(self.played + offset.Duration())); delta > 0 {
+		time.Sleep(delta)
+	}
+}
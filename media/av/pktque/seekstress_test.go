@@ -0,0 +1,66 @@
+package pktque
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bugVanisher/streamer/media/av"
+)
+
+// newGOPSource 25fps, 每12帧一个关键帧, 每帧视频之后一个音频包, 共4秒
+func newGOPSource() *sliceDemuxer {
+	src := &sliceDemuxer{streams: []av.CodecData{testCodec(av.H264), testCodec(av.AAC)}}
+	for i := 0; i < 100; i++ {
+		ts := av.MediaTimeFromDuration(time.Duration(i) * 40 * time.Millisecond)
+		src.pkts = append(src.pkts,
+			av.Packet{Idx: 0, DataType: av.FLV_TAG_VIDEO, AVCPacketType: av.AVC_NALU, IsKeyFrame: i%12 == 0, Time: ts},
+			av.Packet{Idx: 1, DataType: av.FLV_TAG_AUDIO, AVCPacketType: av.AVC_NALU, Time: ts})
+	}
+	return src
+}
+
+// readSeekStress 读取n个packet, 返回输出时间戳和各段第一个关键帧的时间戳
+func readSeekStress(t *testing.T, d *SeekStressDemuxer, n int) (times, keys []time.Duration) {
+	for i := 0; i < n; i++ {
+		pkt, err := d.ReadPacket()
+		require.Nil(t, err)
+		times = append(times, pkt.Time.Duration())
+		if pkt.IsKeyFrame {
+			keys = append(keys, pkt.Time.Duration())
+		}
+	}
+	return
+}
+
+func TestSeekStressReverse(t *testing.T) {
+	d := NewSeekStressDemuxer(newGOPSource(), SeekStressOptions{SegmentLength: 400 * time.Millisecond, Reverse: true})
+	_, keys := readSeekStress(t, d, 170)
+	// 每段一个关键帧, 从最后一个关键帧开始倒序, 到开头后回到最后
+	ms := time.Millisecond
+	require.Equal(t, []time.Duration{3840 * ms, 3360 * ms, 2880 * ms, 2400 * ms, 1920 * ms, 1440 * ms, 960 * ms, 480 * ms, 0, 3840 * ms}, keys)
+	require.Equal(t, 9, d.Seeks)
+}
+
+func TestSeekStressMonotonic(t *testing.T) {
+	d := NewSeekStressDemuxer(newGOPSource(), SeekStressOptions{SegmentLength: 400 * time.Millisecond, Reverse: true, Monotonic: true})
+	times, keys := readSeekStress(t, d, 60)
+	for i := 1; i < len(times); i++ {
+		require.True(t, times[i] >= times[i-1], "timestamp went back at %d: %v -> %v", i, times[i-1], times[i])
+	}
+	// 最后一段输出到3960ms, 倒退到3360ms的距离600ms成为向前的跳变
+	require.Equal(t, 3840*time.Millisecond, keys[0])
+	require.Equal(t, 3960*time.Millisecond+600*time.Millisecond, keys[1])
+}
+
+func TestSeekStressRandomSeed(t *testing.T) {
+	opts := SeekStressOptions{SegmentLength: 200 * time.Millisecond, Seed: 7}
+	_, keys1 := readSeekStress(t, NewSeekStressDemuxer(newGOPSource(), opts), 200)
+	_, keys2 := readSeekStress(t, NewSeekStressDemuxer(newGOPSource(), opts), 200)
+	require.Equal(t, keys1, keys2)
+	require.True(t, len(keys1) > 10)
+
+	_, err := NewSeekStressDemuxer(&sliceDemuxer{streams: []av.CodecData{testCodec(av.AAC)}}, opts).ReadPacket()
+	require.NotNil(t, err)
+}
@@ -0,0 +1,44 @@
+package pktque
+
+import (
+	"time"
+
+	"github.com/bugVanisher/streamer/media/av"
+	"github.com/bugVanisher/streamer/media/codec/h264parser"
+)
+
+// SEIInjector 在H.264视频帧中插入SEI NALU, 如推流端的发送时间, 拉流端解析后可以得到端到端延迟.
+// 放在Walltime之后时packet按发送节奏到达, 记录的时间接近实际发送时间
+type SEIInjector struct {
+	KeyFrameOnly bool // 只在关键帧中插入
+	// NALU 返回要插入的SEI NALU(带NALU头和防竞争码), 返回nil时不插入
+	NALU func(pkt *av.Packet) []byte
+}
+
+// NewSendTimeSEI 创建插入发送时间SEI的filter, 见h264parser.SendTimeSEI
+func NewSendTimeSEI(keyFrameOnly bool) *SEIInjector {
+	return &SEIInjector{
+		KeyFrameOnly: keyFrameOnly,
+		NALU: func(pkt *av.Packet) []byte {
+			return h264parser.SendTimeSEI(time.Now())
+		},
+	}
+}
+
+func (self *SEIInjector) ModifyPacket(pkt *av.Packet, streams []av.CodecData, videoidx int, audioidx int) (drop bool, err error) {
+	if videoidx < 0 || videoidx >= len(streams) || int(pkt.Idx) != videoidx || !pkt.IsVideoNalu() {
+		return
+	}
+	if streams[videoidx].Type() != av.H264 || self.KeyFrameOnly && !pkt.IsKeyFrame {
+		return
+	}
+	sei := self.NALU(pkt)
+	if sei == nil {
+		return
+	}
+	// 源数据可能和demuxer共用缓冲, InsertSEI总是返回新的切片
+	if data, ok := h264parser.InsertSEI(pkt.Data, sei); ok {
+		pkt.Data = data
+	}
+	return
+}
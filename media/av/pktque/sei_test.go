@@ -0,0 +1,41 @@
+package pktque
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bugVanisher/streamer/media/av"
+	"github.com/bugVanisher/streamer/media/codec/h264parser"
+)
+
+func TestSendTimeSEI(t *testing.T) {
+	streams := []av.CodecData{testCodec(av.AAC), testCodec(av.H264)}
+	frame := []byte{0, 0, 0, 2, 0x65, 0x88}
+	f := NewSendTimeSEI(true)
+
+	key := av.Packet{Idx: 1, DataType: av.FLV_TAG_VIDEO, AVCPacketType: av.AVC_NALU, IsKeyFrame: true, Data: frame}
+	inter := av.Packet{Idx: 1, DataType: av.FLV_TAG_VIDEO, AVCPacketType: av.AVC_NALU, Data: frame}
+	audio := av.Packet{Idx: 0, DataType: av.FLV_TAG_AUDIO, Data: []byte{0x21}}
+	before := time.Now()
+	for _, pkt := range []*av.Packet{&key, &inter, &audio} {
+		_, err := f.ModifyPacket(pkt, streams, 1, 0)
+		require.Nil(t, err)
+	}
+	require.Equal(t, frame, inter.Data)
+	require.Equal(t, []byte{0x21}, audio.Data)
+	require.Equal(t, []byte{0, 0, 0, 2, 0x65, 0x88}, frame, "source data must not be modified")
+
+	msgs, _ := h264parser.ParseSEIFromNALUs(key.Data)
+	require.Equal(t, 1, len(msgs))
+	sent, ok := h264parser.ParseSendTime(msgs[0])
+	require.True(t, ok)
+	require.False(t, sent.Before(before.Truncate(time.Nanosecond)))
+
+	// 非H.264视频不插入
+	hevc := av.Packet{Idx: 1, DataType: av.FLV_TAG_VIDEO, AVCPacketType: av.AVC_NALU, IsKeyFrame: true, Data: frame}
+	_, err := f.ModifyPacket(&hevc, []av.CodecData{testCodec(av.AAC), testCodec(av.H265)}, 1, 0)
+	require.Nil(t, err)
+	require.Equal(t, frame, hevc.Data)
+}
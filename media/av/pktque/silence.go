@@ -0,0 +1,128 @@
+package pktque
+
+import (
+	"time"
+
+	"github.com/bugVanisher/streamer/media/av"
+	"github.com/bugVanisher/streamer/media/codec/aacparser"
+)
+
+// DefaultSilenceSampleRate 未指定采样率时静音帧的采样率
+const DefaultSilenceSampleRate = 44100
+
+// silenceMaxGap 视频时间戳跳变超过该值时静音帧从新的时间戳重新开始, 不补齐中间的空白
+const silenceMaxGap = av.MediaTime(time.Second)
+
+// SilenceOptions 合成的静音音频流参数
+type SilenceOptions struct {
+	SampleRate    int              // 0时为DefaultSilenceSampleRate
+	ChannelLayout av.ChannelLayout // 0时为立体声, 只支持单声道和立体声
+}
+
+// SilenceDemuxer 源没有音频时合成一路AAC-LC静音, 时间戳跟随视频, 用于不接受纯视频流的播放器.
+// 源有音频时原样透传. 包装Demuxer而不是作为Filter, 因为需要增加header和插入packet
+type SilenceDemuxer struct {
+	Demuxer av.Demuxer
+	Filled  int // 合成的静音帧数
+
+	codec    aacparser.CodecData
+	frame    []byte
+	streams  []av.CodecData
+	audioidx int // 合成的音频流下标, 源有音频时为-1
+
+	pending    av.Packet // 等待静音帧追上的视频packet
+	hasPending bool
+	started    bool
+	base       av.MediaTime // 静音帧的起始时间
+	n          int64        // 从base开始已经合成的帧数
+}
+
+// NewSilenceDemuxer 包装src, opts不支持时返回错误
+func NewSilenceDemuxer(src av.Demuxer, opts SilenceOptions) (*SilenceDemuxer, error) {
+	if opts.SampleRate <= 0 {
+		opts.SampleRate = DefaultSilenceSampleRate
+	}
+	if opts.ChannelLayout == 0 {
+		opts.ChannelLayout = av.CH_STEREO
+	}
+	frame, err := aacparser.SilentFrame(opts.ChannelLayout)
+	if err != nil {
+		return nil, err
+	}
+	codec, err := aacparser.NewSilenceCodecData(opts.SampleRate, opts.ChannelLayout)
+	if err != nil {
+		return nil, err
+	}
+	return &SilenceDemuxer{Demuxer: src, codec: codec, frame: frame, audioidx: -1}, nil
+}
+
+// Streams 源没有音频时在最后加上静音的AAC header
+func (self *SilenceDemuxer) Streams() (streams []av.CodecData, err error) {
+	if streams, err = self.Demuxer.Streams(); err != nil {
+		return
+	}
+	self.audioidx = len(streams)
+	for _, stream := range streams {
+		if stream.Type().IsAudio() {
+			self.audioidx = -1
+		}
+	}
+	if self.audioidx >= 0 {
+		streams = append(append([]av.CodecData{}, streams...), self.codec)
+	}
+	self.streams = streams
+	return
+}
+
+func (self *SilenceDemuxer) ReadPacket() (pkt av.Packet, err error) {
+	if self.streams == nil {
+		if _, err = self.Streams(); err != nil {
+			return
+		}
+	}
+	for {
+		if self.hasPending {
+			if self.audioidx >= 0 && self.next() <= self.pending.Time {
+				pkt = av.Packet{Idx: int8(self.audioidx), DataType: av.FLV_TAG_AUDIO, AVCPacketType: av.AAC_RAW,
+					Time: self.next(), Data: self.frame}
+				self.n++
+				self.Filled++
+				if rate := int64(self.codec.SampleRate()); self.n == rate {
+					// rate帧正好是整数秒, 移动base避免长时间推流时溢出
+					self.base += av.MediaTime(int64(self.codec.Config.SamplesPerFrame()) * int64(time.Second))
+					self.n = 0
+				}
+				return
+			}
+			self.hasPending = false
+			return self.pending, nil
+		}
+		if pkt, err = self.Demuxer.ReadPacket(); err != nil {
+			return
+		}
+		if pkt.HeaderChanged {
+			if _, err = self.Streams(); err != nil {
+				return
+			}
+		}
+		if self.audioidx < 0 || !pkt.IsVideoNalu() {
+			return
+		}
+		// 第一个视频帧, 或者视频时间戳回退/跳变时重新开始
+		if next := self.next(); !self.started || pkt.Time+self.frameDuration() < next || pkt.Time-next > silenceMaxGap {
+			self.started = true
+			self.base, self.n = pkt.Time, 0
+		}
+		self.pending, self.hasPending = pkt, true
+	}
+}
+
+// next 下一个静音帧的时间戳, 按帧数计算避免累计误差
+func (self *SilenceDemuxer) next() av.MediaTime {
+	samples := int64(self.codec.Config.SamplesPerFrame())
+	return self.base + av.MediaTime(self.n*samples*int64(time.Second)/int64(self.codec.SampleRate()))
+}
+
+func (self *SilenceDemuxer) frameDuration() av.MediaTime {
+	return av.MediaTimeFromDuration(self.codec.Config.FrameDuration())
+}
@@ -0,0 +1,76 @@
+package pktque
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bugVanisher/streamer/media/av"
+	"github.com/bugVanisher/streamer/media/codec/aacparser"
+)
+
+func TestSilenceDemuxer(t *testing.T) {
+	src := &sliceDemuxer{streams: []av.CodecData{testCodec(av.H264)}}
+	for i := 0; i < 50; i++ {
+		src.pkts = append(src.pkts, av.Packet{DataType: av.FLV_TAG_VIDEO, AVCPacketType: av.AVC_NALU,
+			IsKeyFrame: i%25 == 0, Time: av.MediaTimeFromDuration(time.Second + time.Duration(i)*40*time.Millisecond)})
+	}
+	d, err := NewSilenceDemuxer(src, SilenceOptions{})
+	require.Nil(t, err)
+	streams, err := d.Streams()
+	require.Nil(t, err)
+	require.Equal(t, 2, len(streams))
+	aac := streams[1].(aacparser.CodecData)
+	require.Equal(t, DefaultSilenceSampleRate, aac.SampleRate())
+	require.Equal(t, av.CH_STEREO, aac.ChannelLayout())
+
+	var video, audio int
+	var last, lastAudio av.MediaTime
+	for {
+		pkt, err := d.ReadPacket()
+		if err == io.EOF {
+			break
+		}
+		require.Nil(t, err)
+		require.True(t, pkt.Time >= last)
+		last = pkt.Time
+		if pkt.IsAudio() {
+			require.Equal(t, int8(1), pkt.Idx)
+			require.Equal(t, uint8(av.AAC_RAW), pkt.AVCPacketType)
+			if audio > 0 {
+				require.InDelta(t, float64(aac.Config.FrameDuration()), float64(pkt.Time-lastAudio), 1)
+			}
+			lastAudio = pkt.Time
+			audio++
+		} else {
+			video++
+		}
+	}
+	require.Equal(t, 50, video)
+	// 1s到2.96s之间的静音帧, 第一个和第一个视频帧对齐
+	require.Equal(t, 85, audio)
+	require.Equal(t, 85, d.Filled)
+
+	// 源有音频时透传
+	src = &sliceDemuxer{streams: []av.CodecData{testCodec(av.H264), testCodec(av.AAC)}, pkts: []av.Packet{
+		{DataType: av.FLV_TAG_VIDEO, AVCPacketType: av.AVC_NALU, IsKeyFrame: true},
+		{Idx: 1, DataType: av.FLV_TAG_AUDIO, AVCPacketType: av.AAC_RAW},
+	}}
+	d, err = NewSilenceDemuxer(src, SilenceOptions{SampleRate: 48000, ChannelLayout: av.CH_MONO})
+	require.Nil(t, err)
+	streams, err = d.Streams()
+	require.Nil(t, err)
+	require.Equal(t, 2, len(streams))
+	for i := 0; i < 2; i++ {
+		_, err = d.ReadPacket()
+		require.Nil(t, err)
+	}
+	_, err = d.ReadPacket()
+	require.Equal(t, io.EOF, err)
+	require.Equal(t, 0, d.Filled)
+
+	_, err = NewSilenceDemuxer(src, SilenceOptions{ChannelLayout: av.CH_SURROUND})
+	require.NotNil(t, err)
+}
@@ -0,0 +1,166 @@
+package pktque
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/bugVanisher/streamer/media/av"
+)
+
+// 可以开关的轨道
+const (
+	TrackVideo = "video"
+	TrackAudio = "audio"
+)
+
+// ErrNoTrackLeft 关闭轨道后没有任何输出轨道
+var ErrNoTrackLeft = errors.New("pktque: cannot disable all tracks")
+
+// TrackState 轨道的开关状态, Pending表示有还没生效的切换
+type TrackState struct {
+	Video   bool `json:"video"`
+	Audio   bool `json:"audio"`
+	Pending bool `json:"pending"`
+}
+
+// TrackToggleDemuxer 运行中关闭/打开音频或视频轨道, 用来验证播放器对轨道消失和出现的容忍.
+// 切换在视频关键帧生效(没有视频时在下一个音频包生效), 生效时置HeaderChanged,
+// Streams只返回打开的轨道, 输出的packet的Idx按Streams重新编号
+type TrackToggleDemuxer struct {
+	Demuxer av.Demuxer
+
+	lock    sync.Mutex
+	applied [2]bool // 生效的状态, 下标0为视频, 1为音频
+	wanted  [2]bool // SetTrack设置的状态
+
+	probed   bool
+	hasVideo bool
+	idxmap   []int8 // 源的Idx到输出Idx, -1为关闭的轨道
+	changed  bool   // 被丢弃的包上的HeaderChanged转移到下一个输出的包
+}
+
+// NewTrackToggleDemuxer 包装src, 初始时所有轨道打开
+func NewTrackToggleDemuxer(src av.Demuxer) *TrackToggleDemuxer {
+	return &TrackToggleDemuxer{Demuxer: src, applied: [2]bool{true, true}, wanted: [2]bool{true, true}}
+}
+
+func trackIndex(track string) (int, error) {
+	switch track {
+	case TrackVideo:
+		return 0, nil
+	case TrackAudio:
+		return 1, nil
+	}
+	return 0, fmt.Errorf("pktque: unknown track %q", track)
+}
+
+// SetTrack 打开或关闭轨道, 在下一个关键帧生效
+func (self *TrackToggleDemuxer) SetTrack(track string, enabled bool) (state TrackState, err error) {
+	i, err := trackIndex(track)
+	if err != nil {
+		return
+	}
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	wanted := self.wanted
+	wanted[i] = enabled
+	if !wanted[0] && !wanted[1] {
+		return self.state(), ErrNoTrackLeft
+	}
+	self.wanted = wanted
+	return self.state(), nil
+}
+
+// State 当前的开关状态
+func (self *TrackToggleDemuxer) State() TrackState {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return self.state()
+}
+
+func (self *TrackToggleDemuxer) state() TrackState {
+	return TrackState{Video: self.applied[0], Audio: self.applied[1], Pending: self.applied != self.wanted}
+}
+
+// Streams 返回源中打开的轨道
+func (self *TrackToggleDemuxer) Streams() (streams []av.CodecData, err error) {
+	var all []av.CodecData
+	if all, err = self.Demuxer.Streams(); err != nil {
+		return
+	}
+	self.lock.Lock()
+	applied := self.applied
+	self.lock.Unlock()
+
+	self.probed, self.hasVideo = true, false
+	self.idxmap = make([]int8, len(all))
+	for i, stream := range all {
+		self.idxmap[i] = -1
+		typ := stream.Type()
+		if typ.IsVideo() {
+			self.hasVideo = true
+		}
+		if typ.IsVideo() && applied[0] || typ.IsAudio() && applied[1] {
+			self.idxmap[i] = int8(len(streams))
+			streams = append(streams, stream)
+		}
+	}
+	return
+}
+
+// Metadata 实现av.MetadataReader, 透传源的onMetaData
+func (self *TrackToggleDemuxer) Metadata() map[string]interface{} {
+	if r, ok := self.Demuxer.(av.MetadataReader); ok {
+		return r.Metadata()
+	}
+	return nil
+}
+
+func (self *TrackToggleDemuxer) ReadPacket() (pkt av.Packet, err error) {
+	if !self.probed {
+		if _, err = self.Streams(); err != nil {
+			return
+		}
+	}
+	for {
+		if pkt, err = self.Demuxer.ReadPacket(); err != nil {
+			return
+		}
+		if pkt.HeaderChanged {
+			if _, err = self.Streams(); err != nil {
+				return
+			}
+		}
+		if self.apply(&pkt) {
+			if _, err = self.Streams(); err != nil {
+				return
+			}
+			pkt.HeaderChanged = true
+		}
+		if pkt.Idx < 0 || int(pkt.Idx) >= len(self.idxmap) || self.idxmap[pkt.Idx] < 0 {
+			self.changed = self.changed || pkt.HeaderChanged
+			continue
+		}
+		pkt.Idx = self.idxmap[pkt.Idx]
+		if self.changed {
+			pkt.HeaderChanged, self.changed = true, false
+		}
+		return
+	}
+}
+
+// apply 在关键帧边界让SetTrack的切换生效, 状态有变化时返回true
+func (self *TrackToggleDemuxer) apply(pkt *av.Packet) bool {
+	boundary := pkt.IsKeyFrame && pkt.IsVideoNalu() || !self.hasVideo && pkt.IsAudio()
+	if !boundary || pkt.IsSequenceHeader() {
+		return false
+	}
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if self.applied == self.wanted {
+		return false
+	}
+	self.applied = self.wanted
+	return true
+}
@@ -0,0 +1,61 @@
+package pktque
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bugVanisher/streamer/media/av"
+)
+
+func TestTrackToggleDemuxer(t *testing.T) {
+	src := &sliceDemuxer{streams: []av.CodecData{testCodec(av.H264), testCodec(av.AAC)}}
+	// 每10帧一个关键帧, 每帧视频之后一个音频包
+	for i := 0; i < 60; i++ {
+		ts := av.MediaTimeFromDuration(time.Duration(i) * 40 * time.Millisecond)
+		src.pkts = append(src.pkts,
+			av.Packet{Idx: 0, DataType: av.FLV_TAG_VIDEO, AVCPacketType: av.AVC_NALU, IsKeyFrame: i%10 == 0, Time: ts},
+			av.Packet{Idx: 1, DataType: av.FLV_TAG_AUDIO, Time: ts})
+	}
+	d := NewTrackToggleDemuxer(src)
+
+	_, err := d.SetTrack("subtitle", false)
+	require.NotNil(t, err)
+
+	var changes []TrackState
+	var streams []int
+	for i := 0; ; i++ {
+		switch i {
+		case 5:
+			state, err := d.SetTrack(TrackVideo, false)
+			require.Nil(t, err)
+			require.Equal(t, TrackState{Video: true, Audio: true, Pending: true}, state)
+			_, err = d.SetTrack(TrackAudio, false)
+			require.Equal(t, ErrNoTrackLeft, err)
+		case 50:
+			_, err := d.SetTrack(TrackVideo, true)
+			require.Nil(t, err)
+		}
+		pkt, err := d.ReadPacket()
+		if err == io.EOF {
+			break
+		}
+		require.Nil(t, err)
+		if pkt.HeaderChanged {
+			s, err := d.Streams()
+			require.Nil(t, err)
+			changes = append(changes, d.State())
+			streams = append(streams, len(s))
+			// 切换在关键帧生效
+			require.Equal(t, pkt.Idx == 0 && len(s) == 2, pkt.IsKeyFrame)
+		}
+		if !d.State().Video {
+			require.Equal(t, int8(0), pkt.Idx)
+			require.Equal(t, int8(av.FLV_TAG_AUDIO), pkt.DataType)
+		}
+	}
+	require.Equal(t, []TrackState{{Video: false, Audio: true}, {Video: true, Audio: true}}, changes)
+	require.Equal(t, []int{1, 2}, streams)
+}
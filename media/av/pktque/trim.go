@@ -0,0 +1,91 @@
+package pktque
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/bugVanisher/streamer/media/av"
+)
+
+// TrimDemuxer 截取源的一段: 从StartOffset之前最近的视频关键帧开始输出, 时间戳以该关键帧为0,
+// 源时间戳到达StartOffset+Length时返回io.EOF. Length为0时输出到源结束, 没有视频时从StartOffset开始
+type TrimDemuxer struct {
+	Demuxer     av.Demuxer
+	StartOffset time.Duration
+	Length      time.Duration
+
+	started  bool
+	pending  []av.Packet // 起始关键帧到StartOffset之间的包
+	base     av.MediaTime
+	videoidx int
+}
+
+// NewTrimDemuxer 包装src截取[start, start+length)
+func NewTrimDemuxer(src av.Demuxer, start, length time.Duration) *TrimDemuxer {
+	return &TrimDemuxer{Demuxer: src, StartOffset: start, Length: length}
+}
+
+func (self *TrimDemuxer) Streams() ([]av.CodecData, error) {
+	return self.Demuxer.Streams()
+}
+
+func (self *TrimDemuxer) ReadPacket() (pkt av.Packet, err error) {
+	if !self.started {
+		if err = self.seek(); err != nil {
+			return
+		}
+	}
+	if len(self.pending) > 0 {
+		pkt, self.pending = self.pending[0], self.pending[1:]
+	} else if pkt, err = self.Demuxer.ReadPacket(); err != nil {
+		return
+	}
+	if self.Length > 0 && pkt.Time >= av.MediaTimeFromDuration(self.StartOffset+self.Length) {
+		self.pending = nil
+		err = io.EOF
+		return
+	}
+	if pkt.Time -= self.base; pkt.Time < 0 {
+		pkt.Time = 0
+	}
+	return
+}
+
+// seek 读到StartOffset, 保留最近的视频关键帧之后的包
+func (self *TrimDemuxer) seek() (err error) {
+	streams, err := self.Demuxer.Streams()
+	if err != nil {
+		return
+	}
+	self.videoidx = -1
+	for i, stream := range streams {
+		if stream.Type().IsVideo() {
+			self.videoidx = i
+			break
+		}
+	}
+	start := av.MediaTimeFromDuration(self.StartOffset)
+	for {
+		var pkt av.Packet
+		if pkt, err = self.Demuxer.ReadPacket(); err != nil {
+			if err == io.EOF {
+				err = fmt.Errorf("pktque: trim start offset %v beyond the end of source", self.StartOffset)
+			}
+			return
+		}
+		isKey := pkt.Idx == int8(self.videoidx) && pkt.IsKeyFrame && !pkt.IsSequenceHeader()
+		if isKey {
+			self.pending = self.pending[:0]
+		}
+		if isKey || len(self.pending) > 0 || self.videoidx == -1 && pkt.Time >= start {
+			self.pending = append(self.pending, pkt)
+		}
+		if pkt.Time >= start && len(self.pending) > 0 {
+			break
+		}
+	}
+	self.base = self.pending[0].Time
+	self.started = true
+	return
+}
@@ -0,0 +1,43 @@
+package pktque
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bugVanisher/streamer/media/av"
+)
+
+func TestTrimDemuxer(t *testing.T) {
+	src := &sliceDemuxer{streams: []av.CodecData{testCodec(av.H264), testCodec(av.AAC)}}
+	// 25fps, 每秒一个关键帧, 共10秒
+	for i := 0; i < 250; i++ {
+		ts := av.MediaTimeFromDuration(time.Duration(i) * 40 * time.Millisecond)
+		src.pkts = append(src.pkts,
+			av.Packet{Idx: 0, DataType: av.FLV_TAG_VIDEO, AVCPacketType: av.AVC_NALU, IsKeyFrame: i%25 == 0, Time: ts},
+			av.Packet{Idx: 1, DataType: av.FLV_TAG_AUDIO, AVCPacketType: av.AVC_NALU, Time: ts + av.MediaTimeFromDuration(20*time.Millisecond)})
+	}
+
+	d := NewTrimDemuxer(src, 2500*time.Millisecond, 3*time.Second)
+	var pkts []av.Packet
+	for {
+		pkt, err := d.ReadPacket()
+		if err == io.EOF {
+			break
+		}
+		require.Nil(t, err)
+		pkts = append(pkts, pkt)
+	}
+	// 从2s的关键帧开始, 到源时间戳5.5s结束
+	require.True(t, pkts[0].IsKeyFrame)
+	require.Equal(t, av.MediaTime(0), pkts[0].Time)
+	last := pkts[len(pkts)-1]
+	require.Equal(t, av.MediaTimeFromDuration(3480*time.Millisecond), last.Time)
+	// 2s~5.48s的视频和2.02s~5.46s的音频
+	require.Len(t, pkts, 88+87)
+
+	_, err := NewTrimDemuxer(&sliceDemuxer{streams: src.streams}, time.Second, 0).ReadPacket()
+	require.NotNil(t, err)
+}
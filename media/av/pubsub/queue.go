@@ -145,7 +145,7 @@ func (self *Queue) DelayedTime(dur time.Duration) *QueueCursor {
 		if buf.IsValidPos(i) {
 			end := buf.Get(i)
 			for buf.IsValidPos(i) {
-				if end.Time-buf.Get(i).Time > dur {
+				if (end.Time - buf.Get(i).Time).Duration() > dur {
 					break
 				}
 				i--
@@ -2,72 +2,18 @@ package queue
 
 import (
 	"github.com/bugVanisher/streamer/media/av"
+	"github.com/bugVanisher/streamer/utils/ring"
 )
 
-type Buf struct {
-	Head, Tail BufPos
-	pkts       []av.Packet
-	Size       int
-	Count      int
-}
-
-func NewBuf() *Buf {
-	return &Buf{
-		pkts: make([]av.Packet, 64),
-	}
-}
-
-func (self *Buf) Pop() av.Packet {
-	if self.Count == 0 { //TODO 改进panic?
-		panic("pktque.Buf: Pop() when count == 0")
-	}
+// Buf 保存av.Packet的环形缓冲, Size为packet数据的字节数
+type Buf = ring.Buf[av.Packet]
 
-	i := int(self.Head) & (len(self.pkts) - 1)
-	pkt := self.pkts[i]
-	self.pkts[i] = av.Packet{}
-	self.Size -= len(pkt.Data)
-	self.Head++
-	self.Count--
+type BufPos = ring.Pos
 
-	return pkt
-}
-
-func (self *Buf) grow() {
-	newpkts := make([]av.Packet, len(self.pkts)*2)
-	for i := self.Head; i.LT(self.Tail); i++ {
-		newpkts[int(i)&(len(newpkts)-1)] = self.pkts[int(i)&(len(self.pkts)-1)]
-	}
-	self.pkts = newpkts
-}
-
-func (self *Buf) Push(pkt av.Packet) {
-	if self.Count == len(self.pkts) {
-		self.grow()
-	}
-	self.pkts[int(self.Tail)&(len(self.pkts)-1)] = pkt
-	self.Tail++
-	self.Count++
-	self.Size += len(pkt.Data)
-}
-
-func (self *Buf) Get(pos BufPos) av.Packet {
-	return self.pkts[int(pos)&(len(self.pkts)-1)]
-}
-
-func (self *Buf) IsValidPos(pos BufPos) bool {
-	return pos.GE(self.Head) && pos.LT(self.Tail)
-}
-
-type BufPos int
-
-func (self BufPos) LT(pos BufPos) bool {
-	return self-pos < 0
-}
-
-func (self BufPos) GE(pos BufPos) bool {
-	return self-pos >= 0
+func NewBuf() *Buf {
+	return ring.New(packetSize)
 }
 
-func (self BufPos) GT(pos BufPos) bool {
-	return self-pos > 0
+func packetSize(pkt av.Packet) int {
+	return len(pkt.Data)
 }
@@ -0,0 +1,92 @@
+package queue
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+)
+
+// 拉流URL中latency参数的取值
+const (
+	LatencyLow    = "low"
+	LatencyNormal = "normal"
+)
+
+// 拉流URL中degrade参数的取值, audio开启低带宽降级, 见DegradeOptions
+const (
+	DegradeAudio = "audio"
+	DegradeOff   = "off"
+)
+
+// LowLatencySkipFrames latency=low时游标落后超过该帧数就跳到最新的关键帧
+var LowLatencySkipFrames = 100
+
+// CursorOptions 游标的起播位置和追帧策略, 一般由拉流URL的query参数解析得到
+type CursorOptions struct {
+	DelayFrames        int // 从距最新帧至少DelayFrames帧的关键帧开始, 0为最新的关键帧
+	SkipFrameThreshold int // 落后超过该帧数时跳到最新的关键帧, 0不跳帧
+	TimeOffset         int // 大于0时从缓存中距最新帧TimeOffset毫秒的关键帧开始
+	StartPts           int // 见QueueCursor.SetStartPts
+	Degrade            bool
+}
+
+// ParseCursorOptions 解析拉流URL的参数:
+//
+//	latency=low|normal  low在落后时跳帧追赶, normal(默认)不跳帧
+//	delayFrames=N       起播位置向前N帧
+//	skipFrames=N        落后超过N帧时跳帧, 覆盖latency的设置
+//	timeOffset=MS       起播位置向前MS毫秒
+//	startPts=PTS        >0时从pts不小于PTS的关键帧开始, <0时同timeOffset=-PTS
+//	degrade=audio|off   audio时持续落后后只发送音频和定期的关键帧, 按DefaultDegradeOptions
+func ParseCursorOptions(query url.Values) (opts CursorOptions, err error) {
+	switch latency := query.Get("latency"); latency {
+	case "", LatencyNormal:
+	case LatencyLow:
+		opts.SkipFrameThreshold = LowLatencySkipFrames
+	default:
+		return opts, fmt.Errorf("queue: invalid latency %q, want low or normal", latency)
+	}
+	switch degrade := query.Get("degrade"); degrade {
+	case "", DegradeOff:
+	case DegradeAudio:
+		opts.Degrade = true
+	default:
+		return opts, fmt.Errorf("queue: invalid degrade %q, want audio or off", degrade)
+	}
+	for _, p := range []struct {
+		name string
+		v    *int
+		min  int
+	}{
+		{"delayFrames", &opts.DelayFrames, 0},
+		{"skipFrames", &opts.SkipFrameThreshold, 0},
+		{"timeOffset", &opts.TimeOffset, 0},
+		{"startPts", &opts.StartPts, -1 << 31},
+	} {
+		s := query.Get(p.name)
+		if s == "" {
+			continue
+		}
+		n, perr := strconv.Atoi(s)
+		if perr != nil || n < p.min {
+			return opts, fmt.Errorf("queue: invalid %s %q", p.name, s)
+		}
+		*p.v = n
+	}
+	return
+}
+
+// CursorWithOptions 按CursorOptions创建游标
+func (q *Queue) CursorWithOptions(id, sid string, opts CursorOptions) *QueueCursor {
+	cursor := q.CursorByDelayedFrame(id, sid, opts.DelayFrames, opts.SkipFrameThreshold)
+	if opts.TimeOffset > 0 {
+		cursor.SetTimeOffset(opts.TimeOffset)
+	}
+	if opts.StartPts != 0 {
+		cursor.SetStartPts(opts.StartPts)
+	}
+	if opts.Degrade {
+		cursor.EnableDegrade(DefaultDegradeOptions)
+	}
+	return cursor
+}
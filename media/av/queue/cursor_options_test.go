@@ -0,0 +1,41 @@
+package queue
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCursorOptions(t *testing.T) {
+	parse := func(raw string) (CursorOptions, error) {
+		q, err := url.ParseQuery(raw)
+		require.Nil(t, err)
+		return ParseCursorOptions(q)
+	}
+
+	opts, err := parse("")
+	require.Nil(t, err)
+	require.Equal(t, CursorOptions{}, opts)
+
+	opts, err = parse("latency=low&delayFrames=30")
+	require.Nil(t, err)
+	require.Equal(t, CursorOptions{DelayFrames: 30, SkipFrameThreshold: LowLatencySkipFrames}, opts)
+
+	opts, err = parse("latency=low&skipFrames=20&startPts=-3000")
+	require.Nil(t, err)
+	require.Equal(t, CursorOptions{SkipFrameThreshold: 20, StartPts: -3000}, opts)
+
+	opts, err = parse("degrade=audio")
+	require.Nil(t, err)
+	require.True(t, opts.Degrade)
+
+	_, err = parse("latency=ultra")
+	require.NotNil(t, err)
+	_, err = parse("degrade=video")
+	require.NotNil(t, err)
+	_, err = parse("delayFrames=-1")
+	require.NotNil(t, err)
+	_, err = parse("timeOffset=abc")
+	require.NotNil(t, err)
+}
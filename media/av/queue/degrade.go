@@ -0,0 +1,123 @@
+package queue
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/bugVanisher/streamer/media/av"
+)
+
+// DegradeOptions 低带宽降级: 订阅者持续落后时丢弃视频, 只发送音频和定期的关键帧(幻灯片), 追上后从关键帧恢复完整视频.
+// 落后时长为游标读到的包和队列最新包的时间差, 持续时长按媒体时间计算
+type DegradeOptions struct {
+	EnterLag         time.Duration // 落后超过EnterLag并持续EnterAfter后进入降级
+	EnterAfter       time.Duration
+	ExitLag          time.Duration // 降级中落后小于ExitLag并持续ExitAfter后恢复
+	ExitAfter        time.Duration
+	KeyFrameInterval time.Duration // 降级时关键帧的最小发送间隔, 0时不发送视频
+}
+
+// DefaultDegradeOptions 拉流URL参数degrade=audio时使用的降级参数
+var DefaultDegradeOptions = DegradeOptions{
+	EnterLag:         3 * time.Second,
+	EnterAfter:       2 * time.Second,
+	ExitLag:          500 * time.Millisecond,
+	ExitAfter:        5 * time.Second,
+	KeyFrameInterval: 2 * time.Second,
+}
+
+// degrader 游标的降级状态, 只在读取游标的goroutine中使用
+type degrader struct {
+	opts     DegradeOptions
+	degraded bool
+	resuming bool // 已满足恢复条件, 等待下一个关键帧
+	since    av.MediaTime
+	timing   bool // since有效
+	lastKey  av.MediaTime
+	sentKey  bool
+	changed  bool // 丢弃的包带有HeaderChanged, 转移到下一个发送的包
+}
+
+// EnableDegrade 开启低带宽降级, 在第一次ReadPacket之前调用
+func (qc *QueueCursor) EnableDegrade(opts DegradeOptions) {
+	qc.degrade = &degrader{opts: opts}
+}
+
+// Degraded 当前是否处于降级状态
+func (qc *QueueCursor) Degraded() bool {
+	return atomic.LoadInt32(&qc.degraded) == 1
+}
+
+// readDegradedPacket 开启降级时读取, 跳过降级丢弃的视频包
+func (qc *QueueCursor) readDegradedPacket() (pkt av.Packet, err error) {
+	for {
+		if pkt, err = qc.readWholePacket(); err != nil {
+			return
+		}
+		if qc.degrade.filter(qc, &pkt, qc.lag) {
+			return
+		}
+		atomic.AddInt64(&qc.droppedPkts, 1)
+	}
+}
+
+// filter 返回false时丢弃pkt, lag为pkt落后队列最新包的时长
+func (d *degrader) filter(qc *QueueCursor, pkt *av.Packet, lag time.Duration) bool {
+	d.update(qc, pkt, lag)
+	keep := true
+	if d.degraded && pkt.IsVideo() {
+		keep = pkt.IsKeyFrame && d.opts.KeyFrameInterval > 0 &&
+			(!d.sentKey || pkt.Time-d.lastKey >= av.MediaTimeFromDuration(d.opts.KeyFrameInterval))
+		if keep {
+			d.lastKey, d.sentKey = pkt.Time, true
+		}
+	}
+	if !keep {
+		d.changed = d.changed || pkt.HeaderChanged
+		return false
+	}
+	if d.changed {
+		pkt.HeaderChanged, d.changed = true, false
+	}
+	return true
+}
+
+func (d *degrader) update(qc *QueueCursor, pkt *av.Packet, lag time.Duration) {
+	if !d.degraded {
+		if lag <= d.opts.EnterLag {
+			d.timing = false
+			return
+		}
+		if !d.timing {
+			d.since, d.timing = pkt.Time, true
+		}
+		if pkt.Time-d.since >= av.MediaTimeFromDuration(d.opts.EnterAfter) {
+			d.degraded, d.timing, d.sentKey = true, false, false
+			atomic.StoreInt32(&qc.degraded, 1)
+			log.Info().Str("id", qc.id).Str("sid", qc.sid).Dur("lag", lag).Msg("[QueueCursor] enter degraded mode")
+		}
+		return
+	}
+	if !d.resuming {
+		if lag >= d.opts.ExitLag {
+			d.timing = false
+			return
+		}
+		if !d.timing {
+			d.since, d.timing = pkt.Time, true
+		}
+		if pkt.Time-d.since < av.MediaTimeFromDuration(d.opts.ExitAfter) {
+			return
+		}
+		d.resuming, d.timing = true, false
+	}
+	// 从关键帧恢复完整视频, 保证解码不花屏
+	if pkt.IsVideo() && pkt.IsKeyFrame {
+		d.degraded, d.resuming = false, false
+		atomic.StoreInt32(&qc.degraded, 0)
+		log.Info().Str("id", qc.id).Str("sid", qc.sid).Int64("dropped", atomic.LoadInt64(&qc.droppedPkts)).
+			Msg("[QueueCursor] leave degraded mode")
+	}
+}
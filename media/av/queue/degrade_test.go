@@ -0,0 +1,89 @@
+package queue
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bugVanisher/streamer/media/av"
+	"github.com/bugVanisher/streamer/media/container/flv/flvio"
+)
+
+// degradeSource 25fps视频, 每秒一个关键帧, 每帧视频之后一个音频包
+type degradeSource struct {
+	q     *Queue
+	frame int
+}
+
+func (s *degradeSource) write(d time.Duration) (lastAudio av.MediaTime) {
+	for n := int(d / (40 * time.Millisecond)); n > 0; n-- {
+		t := time.Duration(s.frame) * 40 * time.Millisecond
+		s.q.WritePacket(av.Packet{Idx: 0, DataType: int8(flvio.TAG_VIDEO), IsKeyFrame: s.frame%25 == 0,
+			Time: av.MediaTimeFromDuration(t)})
+		lastAudio = av.MediaTimeFromDuration(t + 20*time.Millisecond)
+		s.q.WritePacket(av.Packet{Idx: 1, DataType: int8(flvio.TAG_AUDIO), Time: lastAudio})
+		s.frame++
+	}
+	return
+}
+
+// readUntil 读到时间为t的音频包, 返回读到的视频包
+func readUntil(t *testing.T, c *QueueCursor, at av.MediaTime) (videos []av.Packet) {
+	for {
+		pkt, err := c.ReadPacket()
+		require.Nil(t, err)
+		if pkt.IsVideo() {
+			videos = append(videos, pkt)
+		} else if pkt.Time == at {
+			return
+		}
+	}
+}
+
+func TestDegrade(t *testing.T) {
+	q := NewQueue()
+	q.SetMaxGopCount(100)
+	q.videoidx = 0
+	src := &degradeSource{q: q}
+	c := q.CursorByDelayedFrame("1", "live/test", 0, 0)
+	c.EnableDegrade(DegradeOptions{
+		EnterLag:         time.Second,
+		EnterAfter:       500 * time.Millisecond,
+		ExitLag:          200 * time.Millisecond,
+		ExitAfter:        time.Second,
+		KeyFrameInterval: 2 * time.Second,
+	})
+
+	readUntil(t, c, src.write(40*time.Millisecond))
+
+	// 订阅者落后6秒, 进入降级后只有间隔2秒以上的关键帧
+	videos := readUntil(t, c, src.write(6*time.Second))
+	require.True(t, c.Degraded())
+	var keys []av.MediaTime
+	for _, pkt := range videos {
+		if pkt.Time >= av.MediaTimeFromDuration(600*time.Millisecond) {
+			require.True(t, pkt.IsKeyFrame)
+			keys = append(keys, pkt.Time)
+		}
+	}
+	require.Equal(t, []av.MediaTime{av.MediaTimeFromDuration(time.Second), av.MediaTimeFromDuration(3 * time.Second),
+		av.MediaTimeFromDuration(5 * time.Second)}, keys)
+	stat := c.Stat()
+	require.True(t, stat.Degraded)
+	require.True(t, stat.Dropped > 100)
+
+	// 追上之后持续1秒, 从下一个关键帧恢复完整视频
+	var resumed []av.Packet
+	for i := 0; i < 74; i++ {
+		resumed = append(resumed, readUntil(t, c, src.write(40*time.Millisecond))...)
+	}
+	require.False(t, c.Degraded())
+	require.Len(t, resumed, 50)
+	require.True(t, resumed[0].IsKeyFrame)
+	require.Equal(t, av.MediaTimeFromDuration(7*time.Second), resumed[0].Time)
+	last := resumed[len(resumed)-1]
+	require.False(t, last.IsKeyFrame)
+	require.Equal(t, av.MediaTimeFromDuration(8960*time.Millisecond), last.Time)
+	require.Nil(t, c.Close())
+}
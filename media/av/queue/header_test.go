@@ -0,0 +1,78 @@
+package queue
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bugVanisher/streamer/media/av"
+	"github.com/bugVanisher/streamer/media/codec"
+	"github.com/bugVanisher/streamer/media/codec/aacparser"
+	"github.com/bugVanisher/streamer/media/container/flv/flvio"
+)
+
+func testAACHeader(t *testing.T, config []byte) []av.CodecData {
+	aac, err := aacparser.NewCodecDataFromMPEG4AudioConfigBytes(config)
+	require.Nil(t, err)
+	aac.SetSequenceHeaderTag(flvio.Tag{Type: flvio.TAG_AUDIO, SoundFormat: flvio.SOUND_AAC,
+		AACPacketType: flvio.AAC_SEQHDR, Data: config})
+	return []av.CodecData{aac}
+}
+
+func TestHeaderDebounce(t *testing.T) {
+	q := NewQueue()
+	audio := func() {
+		q.WritePacket(av.Packet{DataType: int8(flvio.TAG_AUDIO), Data: []byte{1}})
+	}
+	c := q.CursorByDelayedFrame("1", "live/test", 0, 0)
+
+	require.Nil(t, q.WriteHeader(testAACHeader(t, []byte{0x12, 0x10})))
+	audio()
+	// 重连的推流端重发相同的header
+	require.Nil(t, q.WriteHeader(testAACHeader(t, []byte{0x12, 0x10})))
+	audio()
+	// 编码参数变化的header正常生效
+	require.Nil(t, q.WriteHeader(testAACHeader(t, []byte{0x11, 0x90})))
+	audio()
+	q.Close()
+
+	stat := q.Stat()
+	require.Equal(t, []uint32{2, 1}, []uint32{stat.HeaderCount, stat.Suppressed})
+
+	var changed int
+	for {
+		pkt, err := c.ReadPacket()
+		if err != nil {
+			break
+		}
+		if pkt.HeaderChanged {
+			changed++
+		}
+	}
+	require.Equal(t, 1, changed)
+
+	// 关闭debounce后每次都生效
+	q = NewQueue()
+	q.SetHeaderDebounce(0)
+	for i := 0; i < 2; i++ {
+		require.Nil(t, q.WriteHeader(testAACHeader(t, []byte{0x12, 0x10})))
+		audio()
+	}
+	require.Equal(t, uint32(2), q.Stat().HeaderCount)
+	require.Len(t, q.headers, 2)
+}
+
+func TestG711Header(t *testing.T) {
+	q := NewQueue()
+	require.Nil(t, q.WriteHeader([]av.CodecData{codec.NewPCMAlawCodecData()}))
+	q.WritePacket(av.Packet{DataType: int8(flvio.TAG_AUDIO), Data: []byte{1}})
+	c := q.CursorByDelayedFrame("1", "live/test", 0, 0)
+	// 读到第一个包后游标才有对应的header
+	pkt, err := c.ReadPacket()
+	require.Nil(t, err)
+	require.True(t, pkt.HeaderChanged)
+	streams, err := c.Streams()
+	require.Nil(t, err)
+	require.Len(t, streams, 1)
+	require.Equal(t, av.PCM_ALAW, streams[0].Type())
+}
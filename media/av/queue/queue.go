@@ -5,11 +5,12 @@ import (
 	"github.com/rs/zerolog/log"
 	"io"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/bugVanisher/streamer/common/ratelog"
 	"github.com/bugVanisher/streamer/media/av"
 	"github.com/bugVanisher/streamer/media/av/avutil"
-	"github.com/bugVanisher/streamer/media/container/flv/flvio"
 
 	util "github.com/bugVanisher/streamer/utils"
 )
@@ -27,6 +28,9 @@ const (
 	minPureAudioDuration = 10 * time.Second
 )
 
+// DefaultHeaderDebounce 和最新header相同的header在该时间内重复写入时忽略, 见SetHeaderDebounce
+var DefaultHeaderDebounce = 5 * time.Second
+
 //        time
 // ----------------->
 //
@@ -53,6 +57,8 @@ type Stat struct {
 	HeadPos      int    `json:"head_pos"`
 	TailPos      int    `json:"tail_pos"`
 	Closed       bool   `json:"closed"`
+	HeaderCount  uint32 `json:"header_count"`       // 生效的header次数
+	Suppressed   uint32 `json:"suppressed_headers"` // 被忽略的重复header次数
 }
 
 //Queue buffer queue
@@ -64,6 +70,7 @@ type Queue struct {
 	headers  []Header
 	videoidx int
 	closed   bool
+	metadata map[string]interface{} // 推流端最近一次的onMetaData
 
 	maxGOPCount   int
 	maxPktCount   int
@@ -72,7 +79,15 @@ type Queue struct {
 	curAudioCount int
 	lossPktCount  uint32
 
-	sid string
+	sid  string
+	hook CursorHook
+
+	headerDebounce    time.Duration
+	lastHeaderAt      time.Time // 最近一次WriteHeader的时间, 包括被忽略的
+	headerCount       uint32
+	suppressedHeaders uint32
+
+	recoveryPoint bool // 把recovery point帧当作关键帧, 见SetRecoveryPoint
 }
 
 // NewQueue new a queue
@@ -84,9 +99,25 @@ func NewQueue() *Queue {
 	q.lock = &sync.RWMutex{}
 	q.cond = sync.NewCond(q.lock.RLocker())
 	q.videoidx = -1
+	q.headerDebounce = DefaultHeaderDebounce
 	return q
 }
 
+// SetHeaderDebounce 设置重复header的忽略时间, 0时每次WriteHeader都生效
+func (q *Queue) SetHeaderDebounce(d time.Duration) {
+	q.lock.Lock()
+	q.headerDebounce = d
+	q.lock.Unlock()
+}
+
+// SetRecoveryPoint 为true时把带recovery point SEI的帧(pkt.RecoveryPoint)当作关键帧, open GOP的流
+// 拉流游标可以从这些帧开始, 也按它们计算缓存的GOP个数. 只影响之后写入的packet
+func (q *Queue) SetRecoveryPoint(enabled bool) {
+	q.lock.Lock()
+	q.recoveryPoint = enabled
+	q.lock.Unlock()
+}
+
 // SetMaxGopCount set MaxGopCount
 func (q *Queue) SetMaxGopCount(n int) {
 	q.lock.Lock()
@@ -123,14 +154,13 @@ func (q *Queue) WriteHeader(data []av.CodecData) error {
 	// 如果仅只有视频头或音频头
 	if len(datas) == 1 && len(q.headers) > 0 {
 		prevHeader := q.headers[len(q.headers)-1]
-		lostHeaderType := av.HeaderTypeH264
+		lostAudio := datas[0].Type.IsVideo()
 		lostHeader := "video"
-		if datas[0].Type == av.HeaderTypeH264 {
-			lostHeaderType = av.HeaderTypeAAC
+		if lostAudio {
 			lostHeader = "audio"
 		}
 		for _, data := range prevHeader.Datas {
-			if data.Type == lostHeaderType {
+			if data.Type.IsAudio() == lostAudio {
 				datas = append(datas, data)
 				log.Info().Str("sid", q.sid).Str("lost_header", lostHeader).Msg("[Queue] repair lost header")
 				break
@@ -138,6 +168,19 @@ func (q *Queue) WriteHeader(data []av.CodecData) error {
 		}
 	}
 
+	// 推流端重连或重复发送相同的header时不产生新的header, 避免拉流端HeaderChanged和HLS的discontinuity
+	now := time.Now()
+	if len(q.headers) > 0 && q.headerDebounce > 0 && now.Sub(q.lastHeaderAt) < q.headerDebounce &&
+		avutil.EqualHeaders(q.headers[len(q.headers)-1].Datas, datas) {
+		q.lastHeaderAt = now
+		q.suppressedHeaders++
+		q.lock.Unlock()
+		log.Debug().Str("sid", q.sid).Uint32("suppressed", q.suppressedHeaders).Msg("[Queue] ignore identical header")
+		return nil
+	}
+	q.lastHeaderAt = now
+	q.headerCount++
+
 	duplicatedHeader := false
 	for i := 0; i < len(q.headers); i++ {
 		// 音频和视频的header可能会分别写入,这里做个简单的去重
@@ -165,6 +208,13 @@ func (q *Queue) WriteHeader(data []av.CodecData) error {
 	return nil
 }
 
+// SetMetadata 实现av.MetadataWriter, 保存推流端的onMetaData供拉流透传
+func (q *Queue) SetMetadata(metadata map[string]interface{}) {
+	q.lock.Lock()
+	q.metadata = metadata
+	q.lock.Unlock()
+}
+
 // WriteTrailer write trailer
 func (q *Queue) WriteTrailer() error {
 	return nil
@@ -192,27 +242,30 @@ func (q *Queue) WritePacket(pkt av.Packet) error {
 	if len(q.headers) > 0 {
 		pkt.HeaderBeginAt = int(q.headers[len(q.headers)-1].BeginAt)
 	}
+	if q.recoveryPoint && pkt.RecoveryPoint && pkt.IsVideo() {
+		pkt.IsKeyFrame = true
+	}
 
 	q.buf.Push(pkt)
 
-	if pkt.DataType == int8(flvio.TAG_VIDEO) {
+	if pkt.IsVideo() {
 		q.curVideoCount++
-	} else if pkt.DataType == int8(flvio.TAG_AUDIO) {
+	} else if pkt.IsAudio() {
 		q.curAudioCount++
 	}
 
-	if pkt.DataType == int8(flvio.TAG_VIDEO) && pkt.IsKeyFrame {
+	if pkt.IsVideoKeyFrame() {
 		q.curGOPCount++
 	}
 
 	for q.buf.Count > 1 && (q.curGOPCount >= q.maxGOPCount || q.buf.Count >= q.maxPktCount) {
 		pkt := q.buf.Pop()
-		if pkt.DataType == int8(flvio.TAG_VIDEO) {
+		if pkt.IsVideo() {
 			q.curVideoCount--
-		} else if pkt.DataType == int8(flvio.TAG_AUDIO) {
+		} else if pkt.IsAudio() {
 			q.curAudioCount--
 		}
-		if pkt.DataType == int8(flvio.TAG_VIDEO) && pkt.IsKeyFrame {
+		if pkt.IsVideoKeyFrame() {
 			q.curGOPCount--
 		}
 		if q.curGOPCount < q.maxGOPCount && q.buf.Count < q.maxPktCount {
@@ -222,7 +275,7 @@ func (q *Queue) WritePacket(pkt av.Packet) error {
 	//清理header
 	clearPoint := len(q.headers) - 1
 	for ; clearPoint >= 0; clearPoint-- {
-		if q.buf.Head >= q.headers[clearPoint].BeginAt {
+		if q.buf.Head.GE(q.headers[clearPoint].BeginAt) {
 			break
 		}
 	}
@@ -237,6 +290,12 @@ func (q *Queue) WritePacket(pkt av.Packet) error {
 
 // QueueCursor Cursor of queue
 type QueueCursor struct {
+	// 订阅者统计, 原子操作, 放在开头保证64位对齐
+	sentPkts    int64
+	sentBytes   int64
+	droppedPkts int64 // 降级丢弃的视频包数
+	degraded    int32
+
 	que                *Queue
 	pos                BufPos
 	gotpos             bool
@@ -266,20 +325,37 @@ type QueueCursor struct {
 	lastSendSliceId    uint32 // 上一次发送的切片ID
 	lastSendSliceStamp uint64
 	initSlice          func(buf *Buf, sliceStartId uint32, sliceSubstreamId uint8, sliceStreamBase uint8) (BufPos, uint32)
+
+	attachAt  time.Time
+	hook      CursorHook
+	closeOnce sync.Once
+
+	// 低带宽降级, 见EnableDegrade
+	degrade *degrader
+	lag     time.Duration // 最后读到的包落后队列最新包的时长
+	stopped bool          // Close之后读取返回io.EOF, 由queue的锁保护
 }
 
-func (q *Queue) newCursor() *QueueCursor {
-	return &QueueCursor{
+func (q *Queue) newCursor(id, sid string) *QueueCursor {
+	cursor := &QueueCursor{
 		que:              q,
 		curHeaderBeginAt: -1,
+		id:               id,
+		sid:              sid,
+		attachAt:         time.Now(),
+	}
+	q.lock.RLock()
+	cursor.hook = q.hook
+	q.lock.RUnlock()
+	if cursor.hook != nil {
+		cursor.hook.OnCursorAttach(cursor)
 	}
+	return cursor
 }
 
 // CursorByDelayedFrame 按帧偏移量初始化游标，对齐到关键帧
 func (q *Queue) CursorByDelayedFrame(id, sid string, startOffset, skipFrameThreshold int) *QueueCursor {
-	cursor := q.newCursor()
-	cursor.id = id
-	cursor.sid = sid
+	cursor := q.newCursor(id, sid)
 	cursor.StartOffset = startOffset
 	cursor.SkipFrameThreshold = skipFrameThreshold
 	cursor.init = func(buf *Buf, videoidx int, startOffset int, adjustToLastKeyFrame bool) BufPos {
@@ -313,9 +389,7 @@ func (q *Queue) CursorByDelayedFrame(id, sid string, startOffset, skipFrameThres
 
 // CursorBySliceReq 按切片请求参数，找到对应的位置
 func (q *Queue) CursorBySliceReq(id, sid string, sliceStartId uint32, sliceSubstreamId, sliceStreamBase uint8) *QueueCursor {
-	cursor := q.newCursor()
-	cursor.id = id
-	cursor.sid = sid
+	cursor := q.newCursor(id, sid)
 	cursor.EnableSlice = true
 	cursor.SliceStartId = sliceStartId
 	cursor.SliceSubstreamId = sliceSubstreamId
@@ -390,13 +464,15 @@ func (q *Queue) CursorBySliceReq(id, sid string, sliceStartId uint32, sliceSubst
 
 func (q *Queue) Stat() *Stat {
 	stat := &Stat{
-		PktCount:   uint32(q.buf.Count),
-		GopCount:   uint32(q.curGOPCount),
-		VideoCount: uint32(q.curVideoCount),
-		AudioCount: uint32(q.curAudioCount),
-		HeadPos:    int(q.buf.Head),
-		TailPos:    int(q.buf.Tail),
-		Closed:     q.closed,
+		PktCount:    uint32(q.buf.Count),
+		GopCount:    uint32(q.curGOPCount),
+		VideoCount:  uint32(q.curVideoCount),
+		AudioCount:  uint32(q.curAudioCount),
+		HeadPos:     int(q.buf.Head),
+		TailPos:     int(q.buf.Tail),
+		Closed:      q.closed,
+		HeaderCount: q.headerCount,
+		Suppressed:  q.suppressedHeaders,
 	}
 	return stat
 }
@@ -410,14 +486,14 @@ func (q *Queue) Format() string {
 func (q *QueueCursor) Headers() (cdata []av.CodecData, err error) {
 	q.que.cond.L.Lock()
 	defer q.que.cond.L.Unlock()
-	if q.que.closed {
+	if q.que.closed || q.stopped {
 		err = io.EOF
 		return
 	}
 	if q.curHeaderBeginAt == -1 {
 		return
 	}
-	for q.que.headers == nil && !q.que.closed {
+	for q.que.headers == nil && !q.que.closed && !q.stopped {
 		q.que.cond.Wait()
 	}
 	var headerBeginAts []int
@@ -440,6 +516,18 @@ func (q *QueueCursor) Headers() (cdata []av.CodecData, err error) {
 	return
 }
 
+// Metadata 实现av.MetadataReader, 返回推流端最近一次的onMetaData
+func (q *QueueCursor) Metadata() map[string]interface{} {
+	q.que.lock.RLock()
+	defer q.que.lock.RUnlock()
+	return q.que.metadata
+}
+
+// Streams 实现av.Demuxer接口, 同Headers
+func (q *QueueCursor) Streams() ([]av.CodecData, error) {
+	return q.Headers()
+}
+
 func (q *QueueCursor) preInit() (err error) {
 	buf := q.que.buf
 	for !q.gotpos {
@@ -452,19 +540,19 @@ func (q *QueueCursor) preInit() (err error) {
 		}
 		timeDelay := 0
 		if buf.IsValidPos(q.pos) {
-			timeDelay = int(util.TimeToTs(buf.Get(buf.Tail-1).Time) - util.TimeToTs(buf.Get(q.pos).Time))
+			timeDelay = int(buf.Get(buf.Tail-1).Time.Ms() - buf.Get(q.pos).Time.Ms())
 		}
 		log.Info().Str("id", q.id).Str("sid", q.sid).Int("pos", int(q.pos)).Int(
 			"videoidx", q.que.videoidx).Int("head", int(buf.Head)).Int(
 			"tail", int(buf.Tail)).Int("startOffset", q.StartOffset).Int(
 			"timeOffset", q.TimeOffset).Int("startPts", q.StartPts).Int32(
-			"posPts", util.TimeToTs(buf.Get(q.pos).Time)).Int("timeDelay", timeDelay).Msg("[QueueCursor] pre-init cursor")
+			"posPts", buf.Get(q.pos).Time.Ms()).Int("timeDelay", timeDelay).Msg("[QueueCursor] pre-init cursor")
 		if buf.IsValidPos(q.pos) {
 			q.gotpos = true
 			q.preInited = true
 			break
 		}
-		if q.que.closed {
+		if q.que.closed || q.stopped {
 			err = io.EOF
 			break
 		}
@@ -494,7 +582,7 @@ func (q *QueueCursor) preInitSlice() (err error) {
 			q.preInited = true
 			break
 		}
-		if q.que.closed {
+		if q.que.closed || q.stopped {
 			err = io.EOF
 			break
 		}
@@ -536,11 +624,11 @@ func (q *QueueCursor) readSlicePacket() (pkt av.Packet, err error) {
 				q.gotpos = true
 			} else {
 				q.gotpos = false
-				if q.que.closed {
+				if q.que.closed || q.stopped {
 					err = io.EOF
 					break
 				}
-				log.Error().
+				ratelog.Error("[QueueCursor] re-init slice cursor pos invalid").
 					Str("id", q.id).
 					Str("sid", q.sid).
 					Int("head", int(buf.Head)).
@@ -571,7 +659,7 @@ func (q *QueueCursor) readSlicePacket() (pkt av.Packet, err error) {
 						streamBase = 1
 					}
 					if q.lastSendSliceId != 0 && q.curAtSliceId != q.lastSendSliceId+uint32(streamBase) {
-						log.Error().
+						ratelog.Error("[QueueCursor] slice Jump").
 							Str("id", q.id).
 							Str("sid", q.sid).
 							Uint32("lastSendSliceId", q.lastSendSliceId).
@@ -588,7 +676,7 @@ func (q *QueueCursor) readSlicePacket() (pkt av.Packet, err error) {
 					q.lastSendSliceStamp = now
 				}
 				if sendInterval > 800 {
-					log.Info().
+					ratelog.Info("[QueueCursor] slice SendSlicePacket too long").
 						Str("id", q.id).
 						Str("sid", q.sid).
 						Int8("DataType", pktTmp.DataType).
@@ -624,26 +712,26 @@ func (q *QueueCursor) readSlicePacket() (pkt av.Packet, err error) {
 					Uint32("curAtSliceId", q.curAtSliceId).
 					Int("curHeaderBeginAt", int(q.curHeaderBeginAt)).
 					Int("pkt.HeaderBeginAt", pkt.HeaderBeginAt).
-					Int("pkt.Time", int(pkt.Time/time.Millisecond)).
+					Int("pkt.Time", int(pkt.Time.Ms())).
 					Msg("[QueueCursor] slice stats")
 
 			}
 			if pkt.HeaderBeginAt > int(q.curHeaderBeginAt) {
 				pkt.HeaderChanged = true // 触发重新发送header
-				log.Info().
+				ratelog.Info("[QueueCursor] slice resend header").
 					Str("id", q.id).
 					Str("sid", q.sid).
 					Int("curHeaderBeginAt", int(q.curHeaderBeginAt)).
 					Int("pkt.HeaderBeginAt", pkt.HeaderBeginAt).
 					Int("pos", int(q.pos)).
-					Int("pkt.Time", int(pkt.Time/time.Millisecond)).
+					Int("pkt.Time", int(pkt.Time.Ms())).
 					Msg("[QueueCursor] slice resend header")
 
 				q.curHeaderBeginAt = BufPos(pkt.HeaderBeginAt)
 			}
 			break
 		}
-		if q.que.closed {
+		if q.que.closed || q.stopped {
 			err = io.EOF
 			break
 		}
@@ -658,6 +746,7 @@ func (q *QueueCursor) readWholePacket() (pkt av.Packet, err error) {
 	buf := q.que.buf
 	if !q.preInited {
 		if err = q.preInit(); err != nil {
+			q.que.cond.L.Unlock()
 			return
 		}
 	}
@@ -675,7 +764,7 @@ func (q *QueueCursor) readWholePacket() (pkt av.Packet, err error) {
 			//3 pos落后帧数超过阀值
 			oldPos := q.pos
 			q.pos = q.init(buf, q.que.videoidx, q.StartOffset, true)
-			log.Info().
+			ratelog.Info("[QueueCursor] re-init cursor").
 				Str("id", q.id).
 				Str("sid", q.sid).
 				Int("oldpos", int(oldPos)).
@@ -691,11 +780,11 @@ func (q *QueueCursor) readWholePacket() (pkt av.Packet, err error) {
 				q.gotpos = true
 			} else {
 				q.gotpos = false
-				if q.que.closed {
+				if q.que.closed || q.stopped {
 					err = io.EOF
 					break
 				}
-				log.Error().
+				ratelog.Error("[QueueCursor] re-init cursor pos invalid").
 					Str("id", q.id).
 					Str("sid", q.sid).
 					Int("head", int(buf.Head)).
@@ -713,6 +802,7 @@ func (q *QueueCursor) readWholePacket() (pkt av.Packet, err error) {
 
 		if buf.IsValidPos(q.pos) {
 			pkt = buf.Get(q.pos)
+			q.lag = (buf.Get(buf.Tail-1).Time - pkt.Time).Duration()
 			q.pos++
 			q.readCount++
 			if q.readCount%1000 == 0 {
@@ -729,25 +819,25 @@ func (q *QueueCursor) readWholePacket() (pkt av.Packet, err error) {
 					Int64("readcount", q.readCount).
 					Int("curHeaderBeginAt", int(q.curHeaderBeginAt)).
 					Int("pkt.HeaderBeginAt", pkt.HeaderBeginAt).
-					Int("pkt.Time", int(pkt.Time/time.Millisecond)).
+					Int("pkt.Time", int(pkt.Time.Ms())).
 					Msg("[QueueCursor] stats")
 
 			}
 			if pkt.HeaderBeginAt > int(q.curHeaderBeginAt) {
 				pkt.HeaderChanged = true // 触发重新发送header
-				log.Info().
+				ratelog.Info("[QueueCursor] resend header").
 					Str("id", q.id).
 					Str("sid", q.sid).
 					Int("curHeaderBeginAt", int(q.curHeaderBeginAt)).
 					Int("pkt.HeaderBeginAt", pkt.HeaderBeginAt).
-					Int("pkt.Time", int(pkt.Time/time.Millisecond)).
+					Int("pkt.Time", int(pkt.Time.Ms())).
 					Msg("[QueueCursor] resend header")
 
 				q.curHeaderBeginAt = BufPos(pkt.HeaderBeginAt)
 			}
 			break
 		}
-		if q.que.closed {
+		if q.que.closed || q.stopped {
 			err = io.EOF
 			break
 		}
@@ -764,11 +854,11 @@ func (q *QueueCursor) SetTimeOffset(timeOffset int) {
 		delayedFrame := 0
 		lastKeyFramePos := buf.Tail
 		if videoidx != -1 && buf.IsValidPos(i) {
-			latestFramePts := util.TimeToTs(buf.Get(i).Time)
+			latestFramePts := buf.Get(i).Time.Ms()
 			for ; buf.IsValidPos(i); i-- {
 				pkt := buf.Get(i)
 				if pkt.Idx == int8(videoidx) && pkt.IsKeyFrame {
-					if latestFramePts-util.TimeToTs(buf.Get(i).Time) >= int32(timeOffset) {
+					if latestFramePts-buf.Get(i).Time.Ms() >= int32(timeOffset) {
 						break
 					}
 					lastKeyFramePos = i
@@ -808,7 +898,7 @@ func (q *QueueCursor) SetStartPts(startPts int) {
 			for ; buf.IsValidPos(i); i++ {
 				pkt := buf.Get(i)
 				if pkt.Idx == int8(videoidx) && pkt.IsKeyFrame {
-					if util.TimeToTs(buf.Get(i).Time) >= int32(startPts) {
+					if buf.Get(i).Time.Ms() >= int32(startPts) {
 						break
 					}
 					lastKeyFramePos = i
@@ -835,13 +925,21 @@ func (q *QueueCursor) UpdateOption(startOffset, skipFrameThreshold int) {
 }
 
 // ReadPacket will not consume packets in Queue, it's just a cursor.
-func (q *QueueCursor) ReadPacket() (av.Packet, error) {
-	// 走切片拉流逻辑
+func (q *QueueCursor) ReadPacket() (pkt av.Packet, err error) {
 	if q.EnableSlice {
-		return q.readSlicePacket()
+		// 走切片拉流逻辑
+		pkt, err = q.readSlicePacket()
+	} else if q.degrade != nil {
+		pkt, err = q.readDegradedPacket()
+	} else {
+		// 以前拉完整流逻辑
+		pkt, err = q.readWholePacket()
+	}
+	if err == nil {
+		atomic.AddInt64(&q.sentPkts, 1)
+		atomic.AddInt64(&q.sentBytes, int64(len(pkt.Data)))
 	}
-	// 以前拉完整流逻辑
-	return q.readWholePacket()
+	return
 }
 
 func (qc *QueueCursor) SeekToConfirmedPkt(confirmedPktTime time.Duration) {
@@ -852,7 +950,7 @@ func (qc *QueueCursor) SeekToConfirmedPkt(confirmedPktTime time.Duration) {
 
 	// find latest keyframe video pkt that is earlier then confirmedPktTime
 	for ; idx.GT(buf.Head); idx-- {
-		if pkt := buf.Get(idx); pkt.EarlierThen(confirmedPktTime) && pkt.DataType == int8(flvio.TAG_VIDEO) && pkt.IsKeyFrame {
+		if pkt := buf.Get(idx); pkt.EarlierThen(confirmedPktTime) && pkt.IsVideoKeyFrame() {
 			// check if the queue is getting pure audio frames,
 			// which would make transfer retransmit too many pure audios
 			if confirmedPktTime-pkt.AbsoluteTime > minPureAudioDuration {
@@ -866,7 +964,7 @@ func (qc *QueueCursor) SeekToConfirmedPkt(confirmedPktTime time.Duration) {
 
 	// otherwise, seek to the earliest keyframe, buf.Head
 	for idx = buf.Head; idx.LT(buf.Tail); idx++ {
-		if pkt := buf.Get(idx); pkt.DataType == int8(flvio.TAG_VIDEO) && pkt.IsKeyFrame {
+		if pkt := buf.Get(idx); pkt.IsVideoKeyFrame() {
 			qc.pos = idx
 			return
 		}
@@ -879,7 +977,7 @@ func (qc *QueueCursor) SeekToConfirmedAudioPkt(confirmedPktTime time.Duration) {
 
 	// find latest audio pkt that is earlier then confirmedPktTime
 	for ; idx.GT(buf.Head); idx-- {
-		if pkt := buf.Get(idx); pkt.EarlierThen(confirmedPktTime) && pkt.DataType == int8(flvio.TAG_AUDIO) {
+		if pkt := buf.Get(idx); pkt.EarlierThen(confirmedPktTime) && pkt.IsAudio() {
 			qc.pos = idx
 			return
 		}
@@ -888,11 +986,65 @@ func (qc *QueueCursor) SeekToConfirmedAudioPkt(confirmedPktTime time.Duration) {
 	qc.pos = buf.Head
 }
 
+// SeekToTime 把游标移到pkt.Time不晚于pos的最近一个视频关键帧, 没有时移到缓存中第一个关键帧, 纯音频时移到第一个不早于pos的包.
+// pos早于缓存中第一个包或晚于最后一个包时不移动游标, 返回false. 用于拉流端的seek
+func (qc *QueueCursor) SeekToTime(pos time.Duration) bool {
+	qc.que.lock.Lock()
+	defer qc.que.lock.Unlock()
+
+	buf := qc.que.buf
+	target := av.MediaTimeFromDuration(pos)
+	if !buf.IsValidPos(buf.Head) || target < buf.Get(buf.Head).Time || target > buf.Get(buf.Tail-1).Time {
+		return false
+	}
+	found := BufPos(-1)
+	if qc.que.videoidx != -1 {
+		for idx := buf.Head; idx.LT(buf.Tail); idx++ {
+			pkt := buf.Get(idx)
+			if pkt.Idx != int8(qc.que.videoidx) || !pkt.IsKeyFrame {
+				continue
+			}
+			if found >= 0 && pkt.Time > target {
+				break
+			}
+			found = idx
+		}
+	} else {
+		for idx := buf.Head; idx.LT(buf.Tail); idx++ {
+			found = idx
+			if buf.Get(idx).Time >= target {
+				break
+			}
+		}
+	}
+	if found < 0 || !buf.IsValidPos(found) {
+		return false
+	}
+	log.Info().Str("id", qc.id).Str("sid", qc.sid).Int("oldpos", int(qc.pos)).Int("pos", int(found)).
+		Dur("seek", pos).Msg("[QueueCursor] seek to time")
+	qc.pos = found
+	qc.gotpos = true
+	qc.preInited = true
+	// 唤醒已读到缓存末尾、正在等待新包的读取
+	qc.que.cond.Broadcast()
+	return true
+}
+
 func (qc *QueueCursor) Format() string {
 	pkt := qc.que.buf.Get(qc.pos)
-	return fmt.Sprintf("cursor: curPos[%d], pktTimestamp[%d], absoluteTimestamp[%d], isKeyFrame[%v]", qc.pos, util.TimeToTs(pkt.Time), util.TimeToTs(pkt.AbsoluteTime), pkt.IsKeyFrame)
+	return fmt.Sprintf("cursor: curPos[%d], pktTimestamp[%d], absoluteTimestamp[%d], isKeyFrame[%v]", qc.pos, pkt.Time.Ms(), util.TimeToTs(pkt.AbsoluteTime), pkt.IsKeyFrame)
 }
 
+// Close 关闭游标, 阻塞中的读取返回io.EOF, 第一次关闭时回调CursorHook.OnCursorDetach
 func (qc *QueueCursor) Close() error {
+	qc.que.lock.Lock()
+	qc.stopped = true
+	qc.que.cond.Broadcast()
+	qc.que.lock.Unlock()
+	qc.closeOnce.Do(func() {
+		if qc.hook != nil {
+			qc.hook.OnCursorDetach(qc, qc.Stat())
+		}
+	})
 	return nil
 }
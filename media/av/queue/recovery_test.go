@@ -0,0 +1,34 @@
+package queue
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bugVanisher/streamer/media/av"
+	"github.com/bugVanisher/streamer/media/container/flv/flvio"
+)
+
+func TestRecoveryPoint(t *testing.T) {
+	q := NewQueue()
+	write := func(key, recovery bool) {
+		q.WritePacket(av.Packet{DataType: int8(flvio.TAG_VIDEO), IsKeyFrame: key, RecoveryPoint: recovery})
+	}
+	write(true, false)
+	write(false, true)
+	write(false, false)
+	require.Equal(t, uint32(1), q.Stat().GopCount)
+
+	// 开启后之后写入的recovery point帧计为关键帧
+	q.SetRecoveryPoint(true)
+	write(false, true)
+	write(false, false)
+	write(false, true)
+	require.Equal(t, uint32(3), q.Stat().GopCount)
+
+	var keys []bool
+	for i := q.buf.Head; i.LT(q.buf.Tail); i++ {
+		keys = append(keys, q.buf.Get(i).IsKeyFrame)
+	}
+	require.Equal(t, []bool{true, false, false, true, false, true}, keys)
+}
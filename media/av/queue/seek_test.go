@@ -0,0 +1,48 @@
+package queue
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bugVanisher/streamer/media/av"
+)
+
+func TestSeekToTime(t *testing.T) {
+	q := NewQueue()
+	q.SetMaxGopCount(100)
+	q.videoidx = 0
+	src := &degradeSource{q: q}
+	c := q.CursorByDelayedFrame("1", "live/test", 0, 0)
+	last := src.write(3 * time.Second)
+	readUntil(t, c, last)
+
+	// 超出缓存范围时不移动游标
+	require.False(t, c.SeekToTime(10*time.Second))
+	require.False(t, c.SeekToTime(-time.Second))
+
+	// 读到缓存末尾后阻塞, seek唤醒读取, 从不晚于目标的最近关键帧开始
+	read := make(chan av.Packet, 1)
+	go func() {
+		pkt, err := c.ReadPacket()
+		require.Nil(t, err)
+		read <- pkt
+	}()
+	time.Sleep(50 * time.Millisecond)
+	require.True(t, c.SeekToTime(1500*time.Millisecond))
+	select {
+	case pkt := <-read:
+		require.True(t, pkt.IsKeyFrame)
+		require.Equal(t, av.MediaTimeFromDuration(time.Second), pkt.Time)
+	case <-time.After(2 * time.Second):
+		t.Fatal("seek did not wake the blocked reader")
+	}
+
+	// seek到缓存开头
+	require.True(t, c.SeekToTime(0))
+	pkt, err := c.ReadPacket()
+	require.Nil(t, err)
+	require.True(t, pkt.IsKeyFrame)
+	require.Equal(t, av.MediaTime(0), pkt.Time)
+}
@@ -0,0 +1,55 @@
+package queue
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// CursorStat 游标(订阅者)的统计
+type CursorStat struct {
+	ID       string        `json:"id"`
+	SID      string        `json:"sid"`
+	AttachAt time.Time     `json:"attach_at"`
+	Packets  int64         `json:"packets"`
+	Bytes    int64         `json:"bytes"`
+	Duration time.Duration `json:"duration"`
+	Degraded bool          `json:"degraded"`      // 是否处于低带宽降级
+	Dropped  int64         `json:"dropped_video"` // 降级丢弃的视频包数
+}
+
+// CursorHook 游标创建和关闭时回调, 用于按订阅者统计. 回调时不持有queue的锁
+type CursorHook interface {
+	OnCursorAttach(c *QueueCursor)
+	OnCursorDetach(c *QueueCursor, stat CursorStat)
+}
+
+// SetCursorHook 设置之后创建的游标的回调
+func (q *Queue) SetCursorHook(h CursorHook) {
+	q.lock.Lock()
+	q.hook = h
+	q.lock.Unlock()
+}
+
+// ID 订阅者ID
+func (qc *QueueCursor) ID() string {
+	return qc.id
+}
+
+// SID 流ID
+func (qc *QueueCursor) SID() string {
+	return qc.sid
+}
+
+// Stat 当前的订阅统计, 已读取的包数和字节数以及订阅时长
+func (qc *QueueCursor) Stat() CursorStat {
+	return CursorStat{
+		ID:       qc.id,
+		SID:      qc.sid,
+		AttachAt: qc.attachAt,
+		Packets:  atomic.LoadInt64(&qc.sentPkts),
+		Bytes:    atomic.LoadInt64(&qc.sentBytes),
+		Duration: time.Since(qc.attachAt),
+		Degraded: qc.Degraded(),
+		Dropped:  atomic.LoadInt64(&qc.droppedPkts),
+	}
+}
@@ -0,0 +1,37 @@
+package queue
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type recordHook struct {
+	attached []string
+	detached []CursorStat
+}
+
+func (h *recordHook) OnCursorAttach(c *QueueCursor) {
+	h.attached = append(h.attached, c.ID())
+}
+
+func (h *recordHook) OnCursorDetach(c *QueueCursor, stat CursorStat) {
+	h.detached = append(h.detached, stat)
+}
+
+func TestCursorHook(t *testing.T) {
+	h := &recordHook{}
+	q := NewQueue()
+	q.SetSID("live/test")
+	q.SetCursorHook(h)
+
+	c := q.CursorByDelayedFrame("1", "live/test", 0, 0)
+	require.Equal(t, []string{"1"}, h.attached)
+
+	require.Nil(t, c.Close())
+	require.Nil(t, c.Close())
+	require.Len(t, h.detached, 1)
+	require.Equal(t, "1", h.detached[0].ID)
+	require.Equal(t, "live/test", h.detached[0].SID)
+	require.False(t, h.detached[0].AttachAt.IsZero())
+}
@@ -83,7 +83,7 @@ func (self *tStream) audioDecodeAndEncode(inpkt av.Packet) (outpkts []av.Packet,
 	if Debug {
 		fmt.Println("transcode: push", inpkt.Time, dur)
 	}
-	self.timeline.Push(inpkt.Time, dur)
+	self.timeline.Push(inpkt.Time.Duration(), dur)
 
 	var _outpkts [][]byte
 	if _outpkts, err = self.aenc.Encode(frame); err != nil {
@@ -95,7 +95,7 @@ func (self *tStream) audioDecodeAndEncode(inpkt av.Packet) (outpkts []av.Packet,
 			return
 		}
 		outpkt := av.Packet{Idx: inpkt.Idx, Data: _outpkt}
-		outpkt.Time = self.timeline.Pop(dur)
+		outpkt.Time = av.MediaTime(self.timeline.Pop(dur))
 
 		if Debug {
 			fmt.Println("transcode: pop", outpkt.Time, dur)
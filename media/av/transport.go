@@ -64,6 +64,16 @@ func WithAfterWriteHeaders(f func([]CodecData) error) Option {
 	}
 }
 
+// MetadataReader 能提供源流原始onMetaData的Demuxer
+type MetadataReader interface {
+	Metadata() map[string]interface{}
+}
+
+// MetadataWriter 能在WriteHeader时透传onMetaData的Muxer, SetMetadata在WriteHeader之前调用
+type MetadataWriter interface {
+	SetMetadata(metadata map[string]interface{})
+}
+
 // Transport 从高层次封装了AV传输
 type Transport struct {
 	opts            *Options
@@ -121,6 +131,12 @@ func (t *Transport) CopyHeaders(ctx context.Context, dst Muxer, src Demuxer) (er
 			return err
 		}
 	}
+	// 源流的onMetaData随header一起交给dst, 是否使用由dst决定
+	if r, ok := src.(MetadataReader); ok {
+		if w, ok := dst.(MetadataWriter); ok {
+			w.SetMetadata(r.Metadata())
+		}
+	}
 	if err = dst.WriteHeader(headers); err != nil {
 		return
 	}
@@ -159,6 +175,16 @@ func (t *Transport) CopyPackets(ctx context.Context, dst Muxer, src Demuxer) (er
 			if pkt.IsSequenceHeader() || pkt.IsScriptData() {
 				continue
 			}
+		} else if pkt.MetadataUpdated {
+			// 只更新dst保存的onMetaData, 不重新发送header
+			if r, ok := src.(MetadataReader); ok {
+				if w, ok := dst.(MetadataWriter); ok {
+					w.SetMetadata(r.Metadata())
+				}
+			}
+			if pkt.IsScriptData() {
+				continue
+			}
 		}
 		if pkt.Drop {
 			continue
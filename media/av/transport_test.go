@@ -0,0 +1,55 @@
+package av
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type metadataDemuxer struct {
+	pkts     []Packet
+	metadata map[string]interface{}
+}
+
+func (d *metadataDemuxer) Streams() ([]CodecData, error) { return nil, nil }
+
+func (d *metadataDemuxer) Metadata() map[string]interface{} { return d.metadata }
+
+func (d *metadataDemuxer) ReadPacket() (pkt Packet, err error) {
+	if len(d.pkts) == 0 {
+		return pkt, io.EOF
+	}
+	pkt, d.pkts = d.pkts[0], d.pkts[1:]
+	if pkt.MetadataUpdated {
+		d.metadata = map[string]interface{}{"width": 1280.0}
+	}
+	return
+}
+
+type metadataMuxer struct {
+	headers  int
+	packets  int
+	metadata map[string]interface{}
+}
+
+func (m *metadataMuxer) WriteHeader([]CodecData) error { m.headers++; return nil }
+func (m *metadataMuxer) WritePacket(Packet) error      { m.packets++; return nil }
+func (m *metadataMuxer) WriteTrailer() error           { return nil }
+func (m *metadataMuxer) SetMetadata(metadata map[string]interface{}) {
+	m.metadata = metadata
+}
+
+func TestTransportMetadataUpdated(t *testing.T) {
+	src := &metadataDemuxer{pkts: []Packet{
+		{DataType: FLV_TAG_VIDEO},
+		{DataType: FLV_TAG_SCRIPTDATA, MetadataUpdated: true},
+		{DataType: FLV_TAG_VIDEO},
+	}}
+	dst := &metadataMuxer{}
+	require.Equal(t, io.EOF, NewTransport().CopyPackets(context.Background(), dst, src))
+	// 只更新onMetaData, 不重新发送header, script data不写入
+	require.Equal(t, []int{0, 2}, []int{dst.headers, dst.packets})
+	require.Equal(t, map[string]interface{}{"width": 1280.0}, dst.metadata)
+}
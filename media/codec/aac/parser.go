@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/bugVanisher/streamer/media/av"
+	"github.com/bugVanisher/streamer/media/container/flv/flvio"
 	"github.com/bugVanisher/streamer/utils/bits"
 )
 
@@ -269,7 +270,24 @@ type CodecData struct {
 	ConfigBytes []byte
 	Config      MPEG4AudioConfig
 
+	// Deprecated: 使用SequenceHeaderTag/SetSequenceHeaderTag, 该字段只为兼容保留, 由SetSequenceHeaderTag同步写入
 	SequnceHeaderTag interface{}
+	seqHdrTag        *flvio.Tag
+}
+
+// SequenceHeaderTag 推流端的sequence header tag, 未设置时ok为false
+func (self CodecData) SequenceHeaderTag() (tag flvio.Tag, ok bool) {
+	if self.seqHdrTag != nil {
+		return *self.seqHdrTag, true
+	}
+	tag, ok = self.SequnceHeaderTag.(flvio.Tag)
+	return
+}
+
+// SetSequenceHeaderTag 保存sequence header tag, 转发时原样写出
+func (self *CodecData) SetSequenceHeaderTag(tag flvio.Tag) {
+	self.seqHdrTag = &tag
+	self.SequnceHeaderTag = tag
 }
 
 func (self CodecData) Type() av.CodecType {
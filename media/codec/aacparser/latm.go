@@ -0,0 +1,284 @@
+package aacparser
+
+import (
+	"fmt"
+)
+
+// LOAS(AudioSyncStream)的同步字和帧头长度, 见ISO/IEC 14496-3 1.7
+const (
+	LOASSyncWord     = 0x2b7
+	LOASHeaderLength = 3
+)
+
+// IsLOASSync data是否以LOAS同步字开始
+func IsLOASSync(data []byte) bool {
+	return len(data) >= 2 && uint(data[0])<<3|uint(data[1])>>5 == LOASSyncWord
+}
+
+// LATMDemuxer 解析LOAS/LATM封装的AAC(MPEG-TS stream_type 0x11), 输出裸AAC帧和MPEG4AudioConfig.
+// 只支持单节目单层、所有流同时分帧、frameLengthType为0的常见配置
+type LATMDemuxer struct {
+	// Config 最近一次StreamMuxConfig中的音频配置
+	Config MPEG4AudioConfig
+	// ConfigChanged 最近一次ReadFrame是否带来了和之前不同的配置
+	ConfigChanged bool
+
+	hasConfig   bool
+	numSubFrame int
+	version     uint
+}
+
+// ReadFrame 解析data开头的一个LOAS帧, 返回其中的裸AAC帧和LOAS帧的总长度.
+// 还没有收到StreamMuxConfig时返回错误, 调用者跳过n字节继续
+func (self *LATMDemuxer) ReadFrame(data []byte) (frames [][]byte, n int, err error) {
+	if !IsLOASSync(data) || len(data) < LOASHeaderLength {
+		err = fmt.Errorf("aacparser: not loas sync")
+		return
+	}
+	length := int(data[1]&0x1f)<<8 | int(data[2])
+	n = LOASHeaderLength + length
+	if len(data) < n {
+		err = fmt.Errorf("aacparser: loas frame truncated, want %d got %d", n, len(data))
+		return
+	}
+	self.ConfigChanged = false
+	frames, err = self.readAudioMuxElement(&configReader{b: data[LOASHeaderLength:n]})
+	return
+}
+
+// latmValue LatmGetValue()
+func latmValue(r *configReader) (v uint, err error) {
+	var bytesForValue uint
+	if bytesForValue, err = r.ReadBits(2); err != nil {
+		return
+	}
+	for i := uint(0); i <= bytesForValue; i++ {
+		var b uint
+		if b, err = r.ReadBits(8); err != nil {
+			return
+		}
+		v = v<<8 | b
+	}
+	return
+}
+
+func (self *LATMDemuxer) readAudioMuxElement(r *configReader) (frames [][]byte, err error) {
+	var useSameStreamMux uint
+	if useSameStreamMux, err = r.ReadBits(1); err != nil {
+		return
+	}
+	if useSameStreamMux == 0 {
+		if err = self.readStreamMuxConfig(r); err != nil {
+			return
+		}
+	}
+	if !self.hasConfig {
+		err = fmt.Errorf("aacparser: latm frame before StreamMuxConfig")
+		return
+	}
+	if self.version > 0 {
+		err = fmt.Errorf("aacparser: latm audioMuxVersionA not supported")
+		return
+	}
+	for i := 0; i < self.numSubFrame; i++ {
+		// PayloadLengthInfo, frameLengthType为0
+		var length uint
+		for {
+			var tmp uint
+			if tmp, err = r.ReadBits(8); err != nil {
+				return
+			}
+			length += tmp
+			if tmp != 255 {
+				break
+			}
+		}
+		if r.left() < int(length)*8 {
+			err = fmt.Errorf("aacparser: latm payload length %d exceeds frame", length)
+			return
+		}
+		frames = append(frames, r.bytes(int(length)*8))
+	}
+	return
+}
+
+func (self *LATMDemuxer) readStreamMuxConfig(r *configReader) (err error) {
+	var audioMuxVersion, versionA uint
+	if audioMuxVersion, err = r.ReadBits(1); err != nil {
+		return
+	}
+	if audioMuxVersion == 1 {
+		if versionA, err = r.ReadBits(1); err != nil {
+			return
+		}
+		if versionA != 0 {
+			self.version = versionA
+			return
+		}
+		if _, err = latmValue(r); err != nil { // taraBufferFullness
+			return
+		}
+	}
+	var v uint
+	// allStreamsSameTimeFraming(1) numSubFrames(6) numProgram(4) numLayer(3)
+	if v, err = r.ReadBits(14); err != nil {
+		return
+	}
+	if v>>13 != 1 || v&0x7f != 0 {
+		err = fmt.Errorf("aacparser: latm with multiple programs/layers not supported")
+		return
+	}
+	numSubFrame := int(v>>7&0x3f) + 1
+
+	var config MPEG4AudioConfig
+	if audioMuxVersion == 1 {
+		var ascLen uint
+		if ascLen, err = latmValue(r); err != nil {
+			return
+		}
+		end := r.pos + int(ascLen)
+		if config, err = parseAudioSpecificConfig(r, false); err != nil {
+			return
+		}
+		if end < r.pos || end > len(r.b)*8 {
+			err = fmt.Errorf("aacparser: latm AudioSpecificConfig length %d invalid", ascLen)
+			return
+		}
+		r.pos = end
+	} else {
+		if config, err = parseAudioSpecificConfig(r, false); err != nil {
+			return
+		}
+		if !isGAObjectType(config.ObjectType) || config.ChannelConfig == 0 {
+			// 无法确定AudioSpecificConfig的长度
+			err = fmt.Errorf("aacparser: latm object type %d channel config %d not supported", config.ObjectType, config.ChannelConfig)
+			return
+		}
+	}
+
+	var frameLengthType uint
+	if frameLengthType, err = r.ReadBits(3); err != nil {
+		return
+	}
+	if frameLengthType != 0 {
+		err = fmt.Errorf("aacparser: latm frameLengthType %d not supported", frameLengthType)
+		return
+	}
+	if _, err = r.ReadBits(8); err != nil { // latmBufferFullness
+		return
+	}
+	var otherDataPresent uint
+	if otherDataPresent, err = r.ReadBits(1); err != nil {
+		return
+	}
+	if otherDataPresent == 1 {
+		if audioMuxVersion == 1 {
+			if _, err = latmValue(r); err != nil {
+				return
+			}
+		} else {
+			for esc := uint(1); esc == 1; {
+				if esc, err = r.ReadBits(1); err != nil {
+					return
+				}
+				if _, err = r.ReadBits(8); err != nil {
+					return
+				}
+			}
+		}
+	}
+	var crcCheckPresent uint
+	if crcCheckPresent, err = r.ReadBits(1); err != nil {
+		return
+	}
+	if crcCheckPresent == 1 {
+		if _, err = r.ReadBits(8); err != nil {
+			return
+		}
+	}
+
+	self.ConfigChanged = self.hasConfig && config != self.Config
+	self.Config, self.hasConfig, self.numSubFrame, self.version = config, true, numSubFrame, 0
+	return
+}
+
+// bytes 从当前位置读取nbits位, 按字节对齐输出
+func (self *configReader) bytes(nbits int) []byte {
+	b := make([]byte, (nbits+7)/8)
+	for i := 0; i < nbits; i += 8 {
+		n := 8
+		if nbits-i < 8 {
+			n = nbits - i
+		}
+		b[i/8] = byte(self.show(n) << uint(8-n))
+		self.pos += n
+	}
+	return b
+}
+
+// bitAppender 按位写入, 不足一个字节的部分补0
+type bitAppender struct {
+	b   []byte
+	pos int
+}
+
+func (self *bitAppender) write(v uint, n int) {
+	for i := n - 1; i >= 0; i-- {
+		if self.pos%8 == 0 {
+			self.b = append(self.b, 0)
+		}
+		if v>>uint(i)&1 != 0 {
+			self.b[len(self.b)-1] |= 0x80 >> uint(self.pos%8)
+		}
+		self.pos++
+	}
+}
+
+// MarshalLOASFrame 把裸AAC帧封装为带StreamMuxConfig的LOAS帧(audioMuxVersion 0), 用于ADTS转LATM
+func MarshalLOASFrame(config MPEG4AudioConfig, frame []byte) (b []byte, err error) {
+	if !isGAObjectType(config.ObjectType) || config.ChannelConfig == 0 {
+		err = fmt.Errorf("aacparser: latm object type %d channel config %d not supported", config.ObjectType, config.ChannelConfig)
+		return
+	}
+	w := &bitAppender{}
+	w.write(0, 1)     // useSameStreamMux
+	w.write(0, 1)     // audioMuxVersion
+	w.write(1, 1)     // allStreamsSameTimeFraming
+	w.write(0, 6+4+3) // numSubFrames, numProgram, numLayer
+	w.write(config.SignaledObjectType(), 5)
+	w.write(config.SampleRateIndex, 4)
+	w.write(config.ChannelConfig, 4)
+	if config.SBR {
+		w.write(config.ExtSampleRateIndex, 4)
+		w.write(config.ObjectType, 5)
+	}
+	frameLengthFlag := uint(0)
+	if config.FrameLength == 960 {
+		frameLengthFlag = 1
+	}
+	w.write(frameLengthFlag<<2, 3) // frameLengthFlag, dependsOnCoreCoder, extensionFlag
+	w.write(0, 3)                  // frameLengthType
+	w.write(0xff, 8)               // latmBufferFullness
+	w.write(0, 1)                  // otherDataPresent
+	w.write(0, 1)                  // crcCheckPresent
+	for length := len(frame); ; length -= 255 {
+		if length < 255 {
+			w.write(uint(length), 8)
+			break
+		}
+		w.write(255, 8)
+	}
+	for _, c := range frame {
+		w.write(uint(c), 8)
+	}
+	if len(w.b) >= 1<<13 {
+		err = fmt.Errorf("aacparser: loas frame too large %d", len(w.b))
+		return
+	}
+	b = make([]byte, LOASHeaderLength, LOASHeaderLength+len(w.b))
+	b[0] = LOASSyncWord >> 3
+	b[1] = byte(LOASSyncWord&0x7)<<5 | byte(len(w.b)>>8)
+	b[2] = byte(len(w.b))
+	b = append(b, w.b...)
+	return
+}
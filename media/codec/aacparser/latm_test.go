@@ -0,0 +1,65 @@
+package aacparser
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestLATMRoundTrip(t *testing.T) {
+	config, err := ParseMPEG4AudioConfigBytes(testBits("00101 0110 0010 0011 00010 000"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	frame := bytes.Repeat([]byte{0xa5, 0x01}, 150) // 300字节, 长度需要两个字节表示
+	loas, err := MarshalLOASFrame(config, frame)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsLOASSync(loas) {
+		t.Fatalf("no sync word %x", loas[:2])
+	}
+
+	d := &LATMDemuxer{}
+	// 两帧连在一起, 第二帧之后带上多余的数据
+	data := append(append([]byte{}, loas...), loas...)
+	frames, n, err := d.ReadFrame(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != len(loas) || len(frames) != 1 || !bytes.Equal(frames[0], frame) {
+		t.Fatalf("n=%d frames=%d", n, len(frames))
+	}
+	if !d.Config.SBR || d.Config.ObjectType != AOT_AAC_LC || d.Config.SampleRate != 24000 || d.Config.OutputSampleRate() != 48000 {
+		t.Fatalf("config %+v", d.Config)
+	}
+	if d.ConfigChanged {
+		t.Fatal("first config reported as changed")
+	}
+	if _, _, err = d.ReadFrame(data[n:]); err != nil || d.ConfigChanged {
+		t.Fatalf("second frame err=%v changed=%v", err, d.ConfigChanged)
+	}
+
+	// useSameStreamMux的帧沿用之前的配置
+	same := &bitAppender{}
+	same.write(1, 1)
+	same.write(3, 8)
+	same.write(0xabcdef, 24)
+	b := append([]byte{LOASSyncWord >> 3, LOASSyncWord & 0x7 << 5, byte(len(same.b))}, same.b...)
+	if frames, _, err = d.ReadFrame(b); err != nil || !bytes.Equal(frames[0], []byte{0xab, 0xcd, 0xef}) {
+		t.Fatalf("same stream mux frames=%x err=%v", frames, err)
+	}
+	if _, _, err = (&LATMDemuxer{}).ReadFrame(b); err == nil {
+		t.Fatal("frame without StreamMuxConfig accepted")
+	}
+
+	// 配置变化
+	lc, _ := ParseMPEG4AudioConfigBytes([]byte{0x12, 0x10})
+	loas, _ = MarshalLOASFrame(lc, frame)
+	if _, _, err = d.ReadFrame(loas); err != nil || !d.ConfigChanged || d.Config.SampleRate != 44100 {
+		t.Fatalf("config change err=%v changed=%v config=%+v", err, d.ConfigChanged, d.Config)
+	}
+
+	if _, _, err = d.ReadFrame(loas[:10]); err == nil {
+		t.Fatal("truncated frame accepted")
+	}
+}
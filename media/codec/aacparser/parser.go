@@ -2,58 +2,60 @@ package aacparser
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
 	"time"
 
 	"github.com/bugVanisher/streamer/media/av"
+	"github.com/bugVanisher/streamer/media/container/flv/flvio"
 	"github.com/bugVanisher/streamer/utils/bits"
 )
 
-// copied from libavcodec/mpeg4audio.h
+// copied from libavcodec/mpeg4audio.h, 取值和ISO/IEC 14496-3的audioObjectType一致
 const (
-	AOT_AAC_MAIN        = 1 + iota  ///< Y                       Main
-	AOT_AAC_LC                      ///< Y                       Low Complexity
-	AOT_AAC_SSR                     ///< N (code in SoC repo)    Scalable Sample Rate
-	AOT_AAC_LTP                     ///< Y                       Long Term Prediction
-	AOT_SBR                         ///< Y                       Spectral Band Replication
-	AOT_AAC_SCALABLE                ///< N                       Scalable
-	AOT_TWINVQ                      ///< N                       Twin Vector Quantizer
-	AOT_CELP                        ///< N                       Code Excited Linear Prediction
-	AOT_HVXC                        ///< N                       Harmonic Vector eXcitation Coding
-	AOT_TTSI            = 12 + iota ///< N                       Text-To-Speech Interface
-	AOT_MAINSYNTH                   ///< N                       Main Synthesis
-	AOT_WAVESYNTH                   ///< N                       Wavetable Synthesis
-	AOT_MIDI                        ///< N                       General MIDI
-	AOT_SAFX                        ///< N                       Algorithmic Synthesis and Audio Effects
-	AOT_ER_AAC_LC                   ///< N                       Error Resilient Low Complexity
-	AOT_ER_AAC_LTP      = 19 + iota ///< N                       Error Resilient Long Term Prediction
-	AOT_ER_AAC_SCALABLE             ///< N                       Error Resilient Scalable
-	AOT_ER_TWINVQ                   ///< N                       Error Resilient Twin Vector Quantizer
-	AOT_ER_BSAC                     ///< N                       Error Resilient Bit-Sliced Arithmetic Coding
-	AOT_ER_AAC_LD                   ///< N                       Error Resilient Low Delay
-	AOT_ER_CELP                     ///< N                       Error Resilient Code Excited Linear Prediction
-	AOT_ER_HVXC                     ///< N                       Error Resilient Harmonic Vector eXcitation Coding
-	AOT_ER_HILN                     ///< N                       Error Resilient Harmonic and Individual Lines plus Noise
-	AOT_ER_PARAM                    ///< N                       Error Resilient Parametric
-	AOT_SSC                         ///< N                       SinuSoidal Coding
-	AOT_PS                          ///< N                       Parametric Stereo
-	AOT_SURROUND                    ///< N                       MPEG Surround
-	AOT_ESCAPE                      ///< Y                       Escape Value
-	AOT_L1                          ///< Y                       Layer 1
-	AOT_L2                          ///< Y                       Layer 2
-	AOT_L3                          ///< Y                       Layer 3
-	AOT_DST                         ///< N                       Direct Stream Transfer
-	AOT_ALS                         ///< Y                       Audio LosslesS
-	AOT_SLS                         ///< N                       Scalable LosslesS
-	AOT_SLS_NON_CORE                ///< N                       Scalable LosslesS (non core)
-	AOT_ER_AAC_ELD                  ///< N                       Error Resilient Enhanced Low Delay
-	AOT_SMR_SIMPLE                  ///< N                       Symbolic Music Representation Simple
-	AOT_SMR_MAIN                    ///< N                       Symbolic Music Representation Main
-	AOT_USAC_NOSBR                  ///< N                       Unified Speech and Audio Coding (no SBR)
-	AOT_SAOC                        ///< N                       Spatial Audio Object Coding
-	AOT_LD_SURROUND                 ///< N                       Low Delay MPEG Surround
-	AOT_USAC                        ///< N                       Unified Speech and Audio Coding
+	AOT_AAC_MAIN        = 1 + iota ///< Y                       Main
+	AOT_AAC_LC                     ///< Y                       Low Complexity
+	AOT_AAC_SSR                    ///< N (code in SoC repo)    Scalable Sample Rate
+	AOT_AAC_LTP                    ///< Y                       Long Term Prediction
+	AOT_SBR                        ///< Y                       Spectral Band Replication
+	AOT_AAC_SCALABLE               ///< N                       Scalable
+	AOT_TWINVQ                     ///< N                       Twin Vector Quantizer
+	AOT_CELP                       ///< N                       Code Excited Linear Prediction
+	AOT_HVXC                       ///< N                       Harmonic Vector eXcitation Coding
+	AOT_TTSI            = iota + 3 ///< N                       Text-To-Speech Interface
+	AOT_MAINSYNTH                  ///< N                       Main Synthesis
+	AOT_WAVESYNTH                  ///< N                       Wavetable Synthesis
+	AOT_MIDI                       ///< N                       General MIDI
+	AOT_SAFX                       ///< N                       Algorithmic Synthesis and Audio Effects
+	AOT_ER_AAC_LC                  ///< N                       Error Resilient Low Complexity
+	AOT_ER_AAC_LTP      = iota + 4 ///< N                       Error Resilient Long Term Prediction
+	AOT_ER_AAC_SCALABLE            ///< N                       Error Resilient Scalable
+	AOT_ER_TWINVQ                  ///< N                       Error Resilient Twin Vector Quantizer
+	AOT_ER_BSAC                    ///< N                       Error Resilient Bit-Sliced Arithmetic Coding
+	AOT_ER_AAC_LD                  ///< N                       Error Resilient Low Delay
+	AOT_ER_CELP                    ///< N                       Error Resilient Code Excited Linear Prediction
+	AOT_ER_HVXC                    ///< N                       Error Resilient Harmonic Vector eXcitation Coding
+	AOT_ER_HILN                    ///< N                       Error Resilient Harmonic and Individual Lines plus Noise
+	AOT_ER_PARAM                   ///< N                       Error Resilient Parametric
+	AOT_SSC                        ///< N                       SinuSoidal Coding
+	AOT_PS                         ///< N                       Parametric Stereo
+	AOT_SURROUND                   ///< N                       MPEG Surround
+	AOT_ESCAPE                     ///< Y                       Escape Value
+	AOT_L1                         ///< Y                       Layer 1
+	AOT_L2                         ///< Y                       Layer 2
+	AOT_L3                         ///< Y                       Layer 3
+	AOT_DST                        ///< N                       Direct Stream Transfer
+	AOT_ALS                        ///< Y                       Audio LosslesS
+	AOT_SLS                        ///< N                       Scalable LosslesS
+	AOT_SLS_NON_CORE               ///< N                       Scalable LosslesS (non core)
+	AOT_ER_AAC_ELD                 ///< N                       Error Resilient Enhanced Low Delay
+	AOT_SMR_SIMPLE                 ///< N                       Symbolic Music Representation Simple
+	AOT_SMR_MAIN                   ///< N                       Symbolic Music Representation Main
+	AOT_USAC_NOSBR                 ///< N                       Unified Speech and Audio Coding (no SBR)
+	AOT_SAOC                       ///< N                       Spatial Audio Object Coding
+	AOT_LD_SURROUND                ///< N                       Low Delay MPEG Surround
+	AOT_USAC                       ///< N                       Unified Speech and Audio Coding
 )
 
 type MPEG4AudioConfig struct {
@@ -62,6 +64,14 @@ type MPEG4AudioConfig struct {
 	ObjectType      uint
 	SampleRateIndex uint
 	ChannelConfig   uint
+
+	// SBR/PS 显式信令(AOT 5/29或sync extension)声明了SBR/PS, 此时ObjectType为核心的AAC类型(通常为LC),
+	// SampleRate为核心采样率. 隐式信令只能从码流发现, 这里为false, 按核心采样率计算的时长不受影响
+	SBR, PS            bool
+	ExtSampleRate      int // SBR的输出采样率
+	ExtSampleRateIndex uint
+	// FrameLength 每帧的核心采样数, GASpecificConfig的frameLengthFlag为1时为960, 否则为1024
+	FrameLength int
 }
 
 var sampleRateTable = []int{
@@ -142,7 +152,12 @@ func FillADTSHeader(header []byte, config MPEG4AudioConfig, samples int, payload
 	return
 }
 
-func readObjectType(r *bits.Reader) (objectType uint, err error) {
+// bitReader 读取AudioSpecificConfig的位
+type bitReader interface {
+	ReadBits(n int) (uint, error)
+}
+
+func readObjectType(r bitReader) (objectType uint, err error) {
 	if objectType, err = r.ReadBits(5); err != nil {
 		return
 	}
@@ -172,7 +187,7 @@ func writeObjectType(w *bits.Writer, objectType uint) (err error) {
 	return
 }
 
-func readSampleRateIndex(r *bits.Reader) (index uint, err error) {
+func readSampleRateIndex(r bitReader) (index uint, err error) {
 	if index, err = r.ReadBits(4); err != nil {
 		return
 	}
@@ -211,13 +226,99 @@ func (self *MPEG4AudioConfig) Complete() {
 	if int(self.ChannelConfig) < len(chanConfigTable) {
 		self.ChannelLayout = chanConfigTable[self.ChannelConfig]
 	}
+	if self.SBR && int(self.ExtSampleRateIndex) < len(sampleRateTable) {
+		self.ExtSampleRate = sampleRateTable[self.ExtSampleRateIndex]
+	}
+	return
+}
+
+// SamplesPerFrame 每帧的核心采样数
+func (self MPEG4AudioConfig) SamplesPerFrame() int {
+	if self.FrameLength > 0 {
+		return self.FrameLength
+	}
+	return 1024
+}
+
+// FrameDuration 每帧的时长, 按核心采样率计算, SBR输出的采样数和采样率都加倍, 时长相同
+func (self MPEG4AudioConfig) FrameDuration() time.Duration {
+	if self.SampleRate <= 0 {
+		return 0
+	}
+	return time.Duration(self.SamplesPerFrame()) * time.Second / time.Duration(self.SampleRate)
+}
+
+// OutputSampleRate 解码输出的采样率, 有SBR时为SBR的采样率
+func (self MPEG4AudioConfig) OutputSampleRate() int {
+	if self.SBR && self.ExtSampleRate > 0 {
+		return self.ExtSampleRate
+	}
+	return self.SampleRate
+}
+
+// OutputChannelLayout 解码输出的声道布局, PS把单声道核心还原为立体声
+func (self MPEG4AudioConfig) OutputChannelLayout() av.ChannelLayout {
+	if self.PS && self.ChannelConfig == 1 {
+		return chanConfigTable[2]
+	}
+	return self.ChannelLayout
+}
+
+// SignaledObjectType 对外声明的object type: HE-AACv2为AOT_PS, HE-AAC为AOT_SBR, 否则为ObjectType
+func (self MPEG4AudioConfig) SignaledObjectType() uint {
+	if self.PS {
+		return AOT_PS
+	}
+	if self.SBR {
+		return AOT_SBR
+	}
+	return self.ObjectType
+}
+
+// configReader 可以查看剩余位数和预读的位读取器, 用于查找sync extension
+type configReader struct {
+	b   []byte
+	pos int
+}
+
+func (self *configReader) left() int {
+	return len(self.b)*8 - self.pos
+}
+
+func (self *configReader) show(n int) (v uint) {
+	for i := 0; i < n; i++ {
+		p := self.pos + i
+		v = v<<1 | uint(self.b[p/8]>>(7-uint(p%8))&1)
+	}
+	return
+}
+
+func (self *configReader) ReadBits(n int) (v uint, err error) {
+	if self.left() < n {
+		err = io.EOF
+		return
+	}
+	v = self.show(n)
+	self.pos += n
 	return
 }
 
+// isGAObjectType 使用GASpecificConfig的object type
+func isGAObjectType(objectType uint) bool {
+	switch objectType {
+	case AOT_AAC_MAIN, AOT_AAC_LC, AOT_AAC_SSR, AOT_AAC_LTP, AOT_AAC_SCALABLE, AOT_TWINVQ:
+		return true
+	}
+	return false
+}
+
 func ParseMPEG4AudioConfigBytes(data []byte) (config MPEG4AudioConfig, err error) {
+	return parseAudioSpecificConfig(&configReader{b: data}, true)
+}
+
+// parseAudioSpecificConfig 从br的当前位置解析AudioSpecificConfig, syncExtension为false时不查找其后的sync extension
+func parseAudioSpecificConfig(br *configReader, syncExtension bool) (config MPEG4AudioConfig, err error) {
 	// copied from libavcodec/mpeg4audio.c avpriv_mpeg4audio_get_config()
-	r := bytes.NewReader(data)
-	br := &bits.Reader{R: r}
 	if config.ObjectType, err = readObjectType(br); err != nil {
 		return
 	}
@@ -228,14 +329,85 @@ func ParseMPEG4AudioConfigBytes(data []byte) (config MPEG4AudioConfig, err error
 		return
 	}
 	(&config).Complete()
+
+	// 显式分层信令: AOT_SBR/AOT_PS之后是SBR采样率和核心的object type
+	if config.ObjectType == AOT_SBR || config.ObjectType == AOT_PS {
+		config.SBR, config.PS = true, config.ObjectType == AOT_PS
+		if config.ExtSampleRateIndex, err = readSampleRateIndex(br); err != nil {
+			return
+		}
+		if config.ObjectType, err = readObjectType(br); err != nil {
+			return
+		}
+		(&config).Complete()
+	}
+
+	// 以下为可选的信息, 早期的推流端只写前两个字节, 数据不完整时忽略
+	if !isGAObjectType(config.ObjectType) || br.left() < 3 {
+		return
+	}
+	flags, _ := br.ReadBits(2) // frameLengthFlag, dependsOnCoreCoder
+	if flags&0x2 != 0 {
+		config.FrameLength = 960
+	}
+	if flags&0x1 != 0 {
+		if _, err := br.ReadBits(14); err != nil { // coreCoderDelay
+			return config, nil
+		}
+	}
+	if _, err := br.ReadBits(1); err != nil { // extensionFlag
+		return config, nil
+	}
+	if config.ChannelConfig == 0 || config.SBR || !syncExtension {
+		// program_config_element不解析, 无法定位其后的sync extension
+		return
+	}
+
+	// 后向兼容的显式信令: 核心配置之后的sync extension(0x2b7)
+	for br.left() > 15 {
+		if br.show(11) != 0x2b7 {
+			br.pos++
+			continue
+		}
+		br.pos += 11
+		ext, err := readObjectType(br)
+		if err != nil || ext != AOT_SBR {
+			break
+		}
+		if sbr, err := br.ReadBits(1); err != nil || sbr == 0 {
+			break
+		}
+		if config.ExtSampleRateIndex, err = readSampleRateIndex(br); err != nil {
+			break
+		}
+		config.SBR = true
+		(&config).Complete()
+		if config.ExtSampleRate == config.SampleRate {
+			config.SBR, config.ExtSampleRate = false, 0
+		}
+		if br.left() >= 12 && br.show(11) == 0x548 {
+			br.pos += 11
+			ps, _ := br.ReadBits(1)
+			config.PS = config.SBR && ps == 1
+		}
+		break
+	}
 	return
 }
 
+// WriteMPEG4AudioConfig 写AudioSpecificConfig, SBR/PS使用显式分层信令
 func WriteMPEG4AudioConfig(w io.Writer, config MPEG4AudioConfig) (err error) {
 	bw := &bits.Writer{W: w}
-	if err = writeObjectType(bw, config.ObjectType); err != nil {
+	if err = writeObjectType(bw, config.SignaledObjectType()); err != nil {
 		return
 	}
+	if config.SBR && config.ExtSampleRateIndex == 0 {
+		for i, rate := range sampleRateTable {
+			if rate == config.ExtSampleRate {
+				config.ExtSampleRateIndex = uint(i)
+			}
+		}
+	}
 
 	if config.SampleRateIndex == 0 {
 		for i, rate := range sampleRateTable {
@@ -258,6 +430,20 @@ func WriteMPEG4AudioConfig(w io.Writer, config MPEG4AudioConfig) (err error) {
 	if err = bw.WriteBits(config.ChannelConfig, 4); err != nil {
 		return
 	}
+	if config.SBR {
+		if err = writeSampleRateIndex(bw, config.ExtSampleRateIndex); err != nil {
+			return
+		}
+		if err = writeObjectType(bw, config.ObjectType); err != nil {
+			return
+		}
+	}
+	if config.FrameLength == 960 {
+		// frameLengthFlag, dependsOnCoreCoder, extensionFlag
+		if err = bw.WriteBits(0x4, 3); err != nil {
+			return
+		}
+	}
 
 	if err = bw.FlushBits(); err != nil {
 		return
@@ -269,7 +455,24 @@ type CodecData struct {
 	ConfigBytes []byte
 	Config      MPEG4AudioConfig
 
+	// Deprecated: 使用SequenceHeaderTag/SetSequenceHeaderTag, 该字段只为兼容保留, 由SetSequenceHeaderTag同步写入
 	SequnceHeaderTag interface{}
+	seqHdrTag        *flvio.Tag
+}
+
+// SequenceHeaderTag 推流端的sequence header tag, 未设置时ok为false
+func (self CodecData) SequenceHeaderTag() (tag flvio.Tag, ok bool) {
+	if self.seqHdrTag != nil {
+		return *self.seqHdrTag, true
+	}
+	tag, ok = self.SequnceHeaderTag.(flvio.Tag)
+	return
+}
+
+// SetSequenceHeaderTag 保存sequence header tag, 转发时原样写出
+func (self *CodecData) SetSequenceHeaderTag(tag flvio.Tag) {
+	self.seqHdrTag = &tag
+	self.SequnceHeaderTag = tag
 }
 
 func (self CodecData) Type() av.CodecType {
@@ -293,11 +496,43 @@ func (self CodecData) SampleFormat() av.SampleFormat {
 }
 
 func (self CodecData) Tag() string {
-	return fmt.Sprintf("mp4a.40.%d", self.Config.ObjectType)
+	return fmt.Sprintf("mp4a.40.%d", self.Config.SignaledObjectType())
+}
+
+// Description 编解码参数的可读描述
+func (self CodecData) Description() (desc av.CodecDescription) {
+	desc = av.Describe(self, self.ConfigBytes)
+	desc.ObjectType = self.Config.SignaledObjectType()
+	desc.SampleRate = self.Config.OutputSampleRate()
+	desc.Channels = self.Config.OutputChannelLayout().Count()
+	switch desc.ObjectType {
+	case AOT_AAC_MAIN:
+		desc.Profile = "Main"
+	case AOT_AAC_LC:
+		desc.Profile = "LC"
+	case AOT_AAC_SSR:
+		desc.Profile = "SSR"
+	case AOT_AAC_LTP:
+		desc.Profile = "LTP"
+	case AOT_SBR:
+		desc.Profile = "HE-AAC"
+	case AOT_PS:
+		desc.Profile = "HE-AACv2"
+	}
+	return
+}
+
+func (self CodecData) MarshalJSON() ([]byte, error) {
+	return json.Marshal(self.Description())
+}
+
+// MarshalYAML 与MarshalJSON输出相同的字段
+func (self CodecData) MarshalYAML() (interface{}, error) {
+	return self.Description(), nil
 }
 
 func (self CodecData) PacketDuration(data []byte) (dur time.Duration, err error) {
-	dur = time.Duration(1024) * time.Second / time.Duration(self.Config.SampleRate)
+	dur = self.Config.FrameDuration()
 	return
 }
 
@@ -0,0 +1,165 @@
+package aacparser
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bugVanisher/streamer/media/av"
+)
+
+// testBits 把"0101 1"格式的位串转换为字节, 不足一个字节的部分补0
+func testBits(s string) []byte {
+	s = strings.ReplaceAll(s, " ", "")
+	b := make([]byte, (len(s)+7)/8)
+	for i, c := range s {
+		if c == '1' {
+			b[i/8] |= 0x80 >> uint(i%8)
+		}
+	}
+	return b
+}
+
+func TestParseMPEG4AudioConfigSBR(t *testing.T) {
+	for _, c := range []struct {
+		name        string
+		data        []byte
+		sbr, ps     bool
+		rate, out   int
+		channels    int
+		tag         string
+		frameLength int
+	}{
+		{"LC", []byte{0x12, 0x10}, false, false, 44100, 44100, 2, "mp4a.40.2", 1024},
+		// AOT_SBR, 24000, 2声道, SBR 48000, 核心LC
+		{"HE-AAC", testBits("00101 0110 0010 0011 00010 000"), true, false, 24000, 48000, 2, "mp4a.40.5", 1024},
+		// AOT_PS, 24000, 单声道, SBR 48000, 核心LC
+		{"HE-AACv2", testBits("11101 0110 0001 0011 00010 000"), true, true, 24000, 48000, 2, "mp4a.40.29", 1024},
+		// LC 24000单声道, GASpecificConfig, sync extension: SBR 48000, PS
+		{"backward compatible", testBits("00010 0110 0001 000 01010110111 00101 1 0011 10101001000 1"), true, true, 24000, 48000, 2, "mp4a.40.29", 1024},
+		// sync extension中的SBR采样率和核心相同, 不算SBR
+		{"same rate sync extension", testBits("00010 0110 0001 000 01010110111 00101 1 0110"), false, false, 24000, 24000, 1, "mp4a.40.2", 1024},
+		// frameLengthFlag
+		{"960", testBits("00010 0011 0010 100"), false, false, 48000, 48000, 2, "mp4a.40.2", 960},
+	} {
+		config, err := ParseMPEG4AudioConfigBytes(c.data)
+		if err != nil {
+			t.Fatal(c.name, err)
+		}
+		if config.SBR != c.sbr || config.PS != c.ps {
+			t.Fatalf("%s: sbr=%v ps=%v", c.name, config.SBR, config.PS)
+		}
+		if config.ObjectType != AOT_AAC_LC {
+			t.Fatalf("%s: core object type %d", c.name, config.ObjectType)
+		}
+		if config.SampleRate != c.rate || config.OutputSampleRate() != c.out {
+			t.Fatalf("%s: sample rate %d output %d", c.name, config.SampleRate, config.OutputSampleRate())
+		}
+		if config.OutputChannelLayout().Count() != c.channels {
+			t.Fatalf("%s: channels %d", c.name, config.OutputChannelLayout().Count())
+		}
+		if config.SamplesPerFrame() != c.frameLength {
+			t.Fatalf("%s: frame length %d", c.name, config.SamplesPerFrame())
+		}
+		codec, err := NewCodecDataFromMPEG4AudioConfigBytes(c.data)
+		if err != nil {
+			t.Fatal(c.name, err)
+		}
+		if codec.Tag() != c.tag {
+			t.Fatalf("%s: tag %s", c.name, codec.Tag())
+		}
+		// 时长按核心采样率计算
+		dur, _ := codec.PacketDuration(nil)
+		if want := time.Duration(c.frameLength) * time.Second / time.Duration(c.rate); dur != want {
+			t.Fatalf("%s: duration %v want %v", c.name, dur, want)
+		}
+
+		// 重新写出后解析结果相同
+		b := &bytes.Buffer{}
+		if err = WriteMPEG4AudioConfig(b, config); err != nil {
+			t.Fatal(c.name, err)
+		}
+		again, err := ParseMPEG4AudioConfigBytes(b.Bytes())
+		if err != nil {
+			t.Fatal(c.name, err)
+		}
+		if again.SBR != config.SBR || again.PS != config.PS || again.ExtSampleRate != config.ExtSampleRate ||
+			again.ObjectType != config.ObjectType || again.SamplesPerFrame() != config.SamplesPerFrame() {
+			t.Fatalf("%s: round trip %+v != %+v", c.name, again, config)
+		}
+	}
+}
+
+func TestFillADTSHeaderHEAAC(t *testing.T) {
+	config, err := ParseMPEG4AudioConfigBytes(testBits("11101 0110 0001 0011 00010 000"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// ADTS只能声明核心的LC和核心采样率, SBR/PS由解码器从码流发现
+	hdr := make([]byte, ADTSHeaderLength)
+	FillADTSHeader(hdr, config, 1024, 100)
+	adts, _, framelen, samples, err := ParseADTSHeader(hdr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if adts.ObjectType != AOT_AAC_LC || adts.SampleRate != 24000 || framelen != 107 || samples != 1024 {
+		t.Fatalf("adts %+v framelen=%d samples=%d", adts, framelen, samples)
+	}
+}
+
+func TestSilentFrame(t *testing.T) {
+	for _, layout := range []av.ChannelLayout{av.CH_MONO, av.CH_STEREO} {
+		frame, err := SilentFrame(layout)
+		if err != nil || len(frame) == 0 {
+			t.Fatalf("%v: %v", layout, err)
+		}
+		codec, err := NewSilenceCodecData(44100, layout)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if codec.SampleRate() != 44100 || codec.ChannelLayout() != layout || codec.Config.ObjectType != AOT_AAC_LC {
+			t.Fatalf("config %+v", codec.Config)
+		}
+		if codec.Config.FrameDuration() != 1024*time.Second/44100 {
+			t.Fatalf("duration %v", codec.Config.FrameDuration())
+		}
+	}
+	if _, err := SilentFrame(av.CH_SURROUND); err == nil {
+		t.Fatal("surround should fail")
+	}
+}
+
+func TestDescription(t *testing.T) {
+	for _, c := range []struct {
+		name   string
+		config []byte
+		want   av.CodecDescription
+	}{
+		{"LC 44100", []byte{0x12, 0x10}, av.CodecDescription{Codec: "AAC", Profile: "LC", SampleRate: 44100, Channels: 2, ObjectType: 2, Extradata: "1210"}},
+		{"LC 48000", []byte{0x11, 0x90}, av.CodecDescription{Codec: "AAC", Profile: "LC", SampleRate: 48000, Channels: 2, ObjectType: 2, Extradata: "1190"}},
+		// 输出采样率为SBR之后的48000
+		{"HE-AAC", testBits("00101 0110 0010 0011 00010 000"), av.CodecDescription{Codec: "AAC", Profile: "HE-AAC", SampleRate: 48000, Channels: 2,
+			ObjectType: 5, Extradata: "2b118800"}},
+	} {
+		codec, err := NewCodecDataFromMPEG4AudioConfigBytes(c.config)
+		if err != nil {
+			t.Fatal(c.name, err)
+		}
+		if desc := codec.Description(); desc != c.want {
+			t.Fatalf("%s: %+v", c.name, desc)
+		}
+		b, err := json.Marshal(codec)
+		if err != nil {
+			t.Fatal(c.name, err)
+		}
+		want, _ := json.Marshal(c.want)
+		if string(b) != string(want) {
+			t.Fatalf("%s: json %s", c.name, b)
+		}
+		if y, err := codec.MarshalYAML(); err != nil || y != c.want {
+			t.Fatalf("%s: yaml %+v %v", c.name, y, err)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package aacparser
+
+import (
+	"fmt"
+
+	"github.com/bugVanisher/streamer/media/av"
+)
+
+// AAC-LC的静音raw frame, 全部系数为0, 与采样率无关
+var (
+	silentFrameMono   = []byte{0x00, 0xc8, 0x00, 0x80, 0x23, 0x80}
+	silentFrameStereo = []byte{0x21, 0x00, 0x49, 0x90, 0x02, 0x19, 0x00, 0x23, 0x80}
+)
+
+// SilentFrame 返回一个1024采样的AAC-LC静音raw frame(不带ADTS头), 只支持单声道和立体声
+func SilentFrame(layout av.ChannelLayout) ([]byte, error) {
+	switch layout {
+	case av.CH_MONO:
+		return append([]byte{}, silentFrameMono...), nil
+	case av.CH_STEREO:
+		return append([]byte{}, silentFrameStereo...), nil
+	}
+	return nil, fmt.Errorf("aacparser: no silent frame for channel layout %v", layout)
+}
+
+// NewSilenceCodecData 静音帧对应的AAC-LC header
+func NewSilenceCodecData(sampleRate int, layout av.ChannelLayout) (CodecData, error) {
+	if _, err := SilentFrame(layout); err != nil {
+		return CodecData{}, err
+	}
+	return NewCodecDataFromMPEG4AudioConfig(MPEG4AudioConfig{ObjectType: AOT_AAC_LC, SampleRate: sampleRate, ChannelLayout: layout})
+}
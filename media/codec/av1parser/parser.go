@@ -0,0 +1,743 @@
+package av1parser
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bugVanisher/streamer/media/av"
+	"github.com/bugVanisher/streamer/media/container/flv/flvio"
+	"github.com/bugVanisher/streamer/utils/bits"
+)
+
+// OBU类型, 见AV1规范6.2.2
+const (
+	OBU_SEQUENCE_HEADER        = 1
+	OBU_TEMPORAL_DELIMITER     = 2
+	OBU_FRAME_HEADER           = 3
+	OBU_TILE_GROUP             = 4
+	OBU_METADATA               = 5
+	OBU_FRAME                  = 6
+	OBU_REDUNDANT_FRAME_HEADER = 7
+	OBU_TILE_LIST              = 8
+	OBU_PADDING                = 15
+)
+
+var (
+	ErrOBUInvalid     = errors.New("av1parser: obu invalid")
+	ErrDecconfInvalid = errors.New("av1parser: AV1CodecConfRecord invalid")
+)
+
+// TemporalDelimiter 没有payload的temporal delimiter OBU
+var TemporalDelimiter = []byte{OBU_TEMPORAL_DELIMITER<<3 | 0x02, 0}
+
+// OBUHeader obu_header, Size为payload的长度, HeaderLen包括头部和leb128的obu_size
+type OBUHeader struct {
+	Type         uint8
+	HasExtension bool
+	HasSizeField bool
+	TemporalID   uint8
+	SpatialID    uint8
+	HeaderLen    int
+	Size         int
+}
+
+// OBUType OBU的类型
+func OBUType(obu []byte) uint8 {
+	if len(obu) == 0 {
+		return 0
+	}
+	return (obu[0] >> 3) & 0x0f
+}
+
+// ReadLEB128 读取leb128编码的无符号数, 返回值和占用的字节数
+func ReadLEB128(b []byte) (v uint64, n int, err error) {
+	for i := 0; i < 8; i++ {
+		if i >= len(b) {
+			err = ErrOBUInvalid
+			return
+		}
+		v |= uint64(b[i]&0x7f) << (uint(i) * 7)
+		if b[i]&0x80 == 0 {
+			n = i + 1
+			return
+		}
+	}
+	err = ErrOBUInvalid
+	return
+}
+
+// AppendLEB128 按leb128编码v追加到b
+func AppendLEB128(b []byte, v uint64) []byte {
+	for {
+		c := byte(v & 0x7f)
+		v >>= 7
+		if v == 0 {
+			return append(b, c)
+		}
+		b = append(b, c|0x80)
+	}
+}
+
+// ParseOBUHeader 解析OBU头部, 没有obu_size时Size为b中头部之后的全部字节
+func ParseOBUHeader(b []byte) (h OBUHeader, err error) {
+	if len(b) < 1 || b[0]&0x80 != 0 {
+		err = ErrOBUInvalid
+		return
+	}
+	h.Type = (b[0] >> 3) & 0x0f
+	h.HasExtension = b[0]&0x04 != 0
+	h.HasSizeField = b[0]&0x02 != 0
+	h.HeaderLen = 1
+	if h.HasExtension {
+		if len(b) < 2 {
+			err = ErrOBUInvalid
+			return
+		}
+		h.TemporalID = b[1] >> 5
+		h.SpatialID = (b[1] >> 3) & 0x03
+		h.HeaderLen++
+	}
+	if !h.HasSizeField {
+		h.Size = len(b) - h.HeaderLen
+		return
+	}
+	size, n, err := ReadLEB128(b[h.HeaderLen:])
+	if err != nil {
+		return
+	}
+	h.HeaderLen += n
+	if size > uint64(len(b)-h.HeaderLen) {
+		err = ErrOBUInvalid
+		return
+	}
+	h.Size = int(size)
+	return
+}
+
+// SplitOBUs 按obu_size切分低开销格式(Low Overhead Bitstream Format)的数据, 每个OBU包括头部,
+// 最后一个OBU可以没有obu_size
+func SplitOBUs(b []byte) (obus [][]byte, err error) {
+	for len(b) > 0 {
+		var h OBUHeader
+		if h, err = ParseOBUHeader(b); err != nil {
+			return
+		}
+		n := h.HeaderLen + h.Size
+		obus = append(obus, b[:n])
+		b = b[n:]
+	}
+	return
+}
+
+// IsKeyFrame temporal unit是否以sequence header开始, 编码器在关键帧前重复sequence header
+func IsKeyFrame(tu []byte) bool {
+	obus, err := SplitOBUs(tu)
+	if err != nil {
+		return false
+	}
+	for _, obu := range obus {
+		switch OBUType(obu) {
+		case OBU_TEMPORAL_DELIMITER, OBU_PADDING, OBU_METADATA:
+		case OBU_SEQUENCE_HEADER:
+			return true
+		default:
+			return false
+		}
+	}
+	return false
+}
+
+// SequenceHeader sequence_header_obu中和配置有关的字段
+type SequenceHeader struct {
+	SeqProfile                uint
+	StillPicture              uint
+	ReducedStillPictureHeader uint
+	TimingInfoPresentFlag     uint
+	NumUnitsInDisplayTick     uint
+	TimeScale                 uint
+	EqualPictureInterval      uint
+	SeqLevelIdx0              uint
+	SeqTier0                  uint
+	InitialDisplayDelayMinus1 uint // 0xf以上表示没有
+	MaxFrameWidth             uint
+	MaxFrameHeight            uint
+	BitDepth                  uint
+	MonoChrome                uint
+	ColorPrimaries            uint
+	TransferCharacteristics   uint
+	MatrixCoefficients        uint
+	ColorRange                uint
+	SubsamplingX              uint
+	SubsamplingY              uint
+	ChromaSamplePosition      uint
+	FilmGrainParamsPresent    uint
+
+	FPS uint
+}
+
+func readUvlc(br *bits.GolombBitReader) (v uint, err error) {
+	leadingZeros := 0
+	for {
+		var done uint
+		if done, err = br.ReadBit(); err != nil {
+			return
+		}
+		if done != 0 {
+			break
+		}
+		leadingZeros++
+	}
+	if leadingZeros >= 32 {
+		return 1<<32 - 1, nil
+	}
+	if v, err = br.ReadBits(leadingZeros); err != nil {
+		return
+	}
+	v += 1<<uint(leadingZeros) - 1
+	return
+}
+
+// ParseSequenceHeader 解析sequence header OBU, obu包括OBU头部
+func ParseSequenceHeader(obu []byte) (sh SequenceHeader, err error) {
+	h, err := ParseOBUHeader(obu)
+	if err != nil {
+		return
+	}
+	if h.Type != OBU_SEQUENCE_HEADER {
+		err = fmt.Errorf("av1parser: obu_type=%d is not sequence header", h.Type)
+		return
+	}
+	br := &bits.GolombBitReader{R: bytes.NewReader(obu[h.HeaderLen : h.HeaderLen+h.Size])}
+	if sh.SeqProfile, err = br.ReadBits(3); err != nil {
+		return
+	}
+	if sh.StillPicture, err = br.ReadBit(); err != nil {
+		return
+	}
+	if sh.ReducedStillPictureHeader, err = br.ReadBit(); err != nil {
+		return
+	}
+	sh.InitialDisplayDelayMinus1 = 0xff
+	if sh.ReducedStillPictureHeader != 0 {
+		if sh.SeqLevelIdx0, err = br.ReadBits(5); err != nil {
+			return
+		}
+	} else {
+		if err = parseOperatingPoints(br, &sh); err != nil {
+			return
+		}
+	}
+
+	frameWidthBitsMinus1, err := br.ReadBits(4)
+	if err != nil {
+		return
+	}
+	frameHeightBitsMinus1, err := br.ReadBits(4)
+	if err != nil {
+		return
+	}
+	if sh.MaxFrameWidth, err = br.ReadBits(int(frameWidthBitsMinus1) + 1); err != nil {
+		return
+	}
+	sh.MaxFrameWidth++
+	if sh.MaxFrameHeight, err = br.ReadBits(int(frameHeightBitsMinus1) + 1); err != nil {
+		return
+	}
+	sh.MaxFrameHeight++
+
+	if sh.ReducedStillPictureHeader == 0 {
+		var frameIDNumbersPresentFlag uint
+		if frameIDNumbersPresentFlag, err = br.ReadBit(); err != nil {
+			return
+		}
+		if frameIDNumbersPresentFlag != 0 {
+			// delta_frame_id_length_minus_2, additional_frame_id_length_minus_1
+			if _, err = br.ReadBits(7); err != nil {
+				return
+			}
+		}
+	}
+	// use_128x128_superblock, enable_filter_intra, enable_intra_edge_filter
+	if _, err = br.ReadBits(3); err != nil {
+		return
+	}
+	if sh.ReducedStillPictureHeader == 0 {
+		if err = skipSequenceTools(br); err != nil {
+			return
+		}
+	}
+	// enable_superres, enable_cdef, enable_restoration
+	if _, err = br.ReadBits(3); err != nil {
+		return
+	}
+	if err = parseColorConfig(br, &sh); err != nil {
+		return
+	}
+	if sh.FilmGrainParamsPresent, err = br.ReadBit(); err != nil {
+		return
+	}
+	return
+}
+
+func parseOperatingPoints(br *bits.GolombBitReader, sh *SequenceHeader) (err error) {
+	if sh.TimingInfoPresentFlag, err = br.ReadBit(); err != nil {
+		return
+	}
+	var decoderModelInfoPresentFlag, bufferDelayLengthMinus1 uint
+	if sh.TimingInfoPresentFlag != 0 {
+		if sh.NumUnitsInDisplayTick, err = br.ReadBits(32); err != nil {
+			return
+		}
+		if sh.TimeScale, err = br.ReadBits(32); err != nil {
+			return
+		}
+		if sh.EqualPictureInterval, err = br.ReadBit(); err != nil {
+			return
+		}
+		var numTicksPerPictureMinus1 uint
+		if sh.EqualPictureInterval != 0 {
+			if numTicksPerPictureMinus1, err = readUvlc(br); err != nil {
+				return
+			}
+		}
+		if sh.NumUnitsInDisplayTick > 0 {
+			sh.FPS = sh.TimeScale / (sh.NumUnitsInDisplayTick * (numTicksPerPictureMinus1 + 1))
+		}
+		if decoderModelInfoPresentFlag, err = br.ReadBit(); err != nil {
+			return
+		}
+		if decoderModelInfoPresentFlag != 0 {
+			if bufferDelayLengthMinus1, err = br.ReadBits(5); err != nil {
+				return
+			}
+			// num_units_in_decoding_tick, buffer_removal_time_length_minus_1, frame_presentation_time_length_minus_1
+			if _, err = br.ReadBits(32); err != nil {
+				return
+			}
+			if _, err = br.ReadBits(10); err != nil {
+				return
+			}
+		}
+	}
+	initialDisplayDelayPresentFlag, err := br.ReadBit()
+	if err != nil {
+		return
+	}
+	operatingPointsCntMinus1, err := br.ReadBits(5)
+	if err != nil {
+		return
+	}
+	for i := uint(0); i <= operatingPointsCntMinus1; i++ {
+		// operating_point_idc
+		if _, err = br.ReadBits(12); err != nil {
+			return
+		}
+		var seqLevelIdx, seqTier uint
+		if seqLevelIdx, err = br.ReadBits(5); err != nil {
+			return
+		}
+		if seqLevelIdx > 7 {
+			if seqTier, err = br.ReadBit(); err != nil {
+				return
+			}
+		}
+		if decoderModelInfoPresentFlag != 0 {
+			var decoderModelPresentForThisOp uint
+			if decoderModelPresentForThisOp, err = br.ReadBit(); err != nil {
+				return
+			}
+			if decoderModelPresentForThisOp != 0 {
+				// decoder_buffer_delay, encoder_buffer_delay, low_delay_mode_flag
+				n := int(bufferDelayLengthMinus1) + 1
+				if _, err = br.ReadBits(2*n + 1); err != nil {
+					return
+				}
+			}
+		}
+		initialDisplayDelayMinus1 := uint(0xff)
+		if initialDisplayDelayPresentFlag != 0 {
+			var presentForThisOp uint
+			if presentForThisOp, err = br.ReadBit(); err != nil {
+				return
+			}
+			if presentForThisOp != 0 {
+				if initialDisplayDelayMinus1, err = br.ReadBits(4); err != nil {
+					return
+				}
+			}
+		}
+		if i == 0 {
+			sh.SeqLevelIdx0 = seqLevelIdx
+			sh.SeqTier0 = seqTier
+			sh.InitialDisplayDelayMinus1 = initialDisplayDelayMinus1
+		}
+	}
+	return
+}
+
+// skipSequenceTools enable_interintra_compound到order_hint_bits_minus_1
+func skipSequenceTools(br *bits.GolombBitReader) (err error) {
+	// enable_interintra_compound, enable_masked_compound, enable_warped_motion, enable_dual_filter
+	if _, err = br.ReadBits(4); err != nil {
+		return
+	}
+	enableOrderHint, err := br.ReadBit()
+	if err != nil {
+		return
+	}
+	if enableOrderHint != 0 {
+		// enable_jnt_comp, enable_ref_frame_mvs
+		if _, err = br.ReadBits(2); err != nil {
+			return
+		}
+	}
+	seqChooseScreenContentTools, err := br.ReadBit()
+	if err != nil {
+		return
+	}
+	seqForceScreenContentTools := uint(2) // SELECT_SCREEN_CONTENT_TOOLS
+	if seqChooseScreenContentTools == 0 {
+		if seqForceScreenContentTools, err = br.ReadBit(); err != nil {
+			return
+		}
+	}
+	if seqForceScreenContentTools > 0 {
+		var seqChooseIntegerMv uint
+		if seqChooseIntegerMv, err = br.ReadBit(); err != nil {
+			return
+		}
+		if seqChooseIntegerMv == 0 {
+			// seq_force_integer_mv
+			if _, err = br.ReadBit(); err != nil {
+				return
+			}
+		}
+	}
+	if enableOrderHint != 0 {
+		// order_hint_bits_minus_1
+		if _, err = br.ReadBits(3); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// parseColorConfig 5.5.2 color_config
+func parseColorConfig(br *bits.GolombBitReader, sh *SequenceHeader) (err error) {
+	highBitdepth, err := br.ReadBit()
+	if err != nil {
+		return
+	}
+	sh.BitDepth = 8
+	if sh.SeqProfile == 2 && highBitdepth != 0 {
+		var twelveBit uint
+		if twelveBit, err = br.ReadBit(); err != nil {
+			return
+		}
+		sh.BitDepth = 10
+		if twelveBit != 0 {
+			sh.BitDepth = 12
+		}
+	} else if highBitdepth != 0 {
+		sh.BitDepth = 10
+	}
+	if sh.SeqProfile != 1 {
+		if sh.MonoChrome, err = br.ReadBit(); err != nil {
+			return
+		}
+	}
+	colorDescriptionPresentFlag, err := br.ReadBit()
+	if err != nil {
+		return
+	}
+	sh.ColorPrimaries, sh.TransferCharacteristics, sh.MatrixCoefficients = 2, 2, 2
+	if colorDescriptionPresentFlag != 0 {
+		if sh.ColorPrimaries, err = br.ReadBits(8); err != nil {
+			return
+		}
+		if sh.TransferCharacteristics, err = br.ReadBits(8); err != nil {
+			return
+		}
+		if sh.MatrixCoefficients, err = br.ReadBits(8); err != nil {
+			return
+		}
+	}
+	if sh.MonoChrome != 0 {
+		if sh.ColorRange, err = br.ReadBit(); err != nil {
+			return
+		}
+		sh.SubsamplingX, sh.SubsamplingY = 1, 1
+		return
+	}
+	// BT.709 + sRGB + Identity为4:4:4
+	if sh.ColorPrimaries == 1 && sh.TransferCharacteristics == 13 && sh.MatrixCoefficients == 0 {
+		sh.ColorRange = 1
+	} else {
+		if sh.ColorRange, err = br.ReadBit(); err != nil {
+			return
+		}
+		switch sh.SeqProfile {
+		case 0:
+			sh.SubsamplingX, sh.SubsamplingY = 1, 1
+		case 1:
+		default:
+			if sh.BitDepth == 12 {
+				if sh.SubsamplingX, err = br.ReadBit(); err != nil {
+					return
+				}
+				if sh.SubsamplingX != 0 {
+					if sh.SubsamplingY, err = br.ReadBit(); err != nil {
+						return
+					}
+				}
+			} else {
+				sh.SubsamplingX = 1
+			}
+		}
+		if sh.SubsamplingX != 0 && sh.SubsamplingY != 0 {
+			if sh.ChromaSamplePosition, err = br.ReadBits(2); err != nil {
+				return
+			}
+		}
+	}
+	// separate_uv_delta_q
+	_, err = br.ReadBit()
+	return
+}
+
+// AV1CodecConfRecord AV1CodecConfigurationRecord(av1C), 见AV1 ISOBMFF绑定规范2.3.3
+type AV1CodecConfRecord struct {
+	SeqProfile                       uint8
+	SeqLevelIdx0                     uint8
+	SeqTier0                         uint8
+	HighBitdepth                     uint8
+	TwelveBit                        uint8
+	MonoChrome                       uint8
+	ChromaSubsamplingX               uint8
+	ChromaSubsamplingY               uint8
+	ChromaSamplePosition             uint8
+	InitialPresentationDelayPresent  uint8
+	InitialPresentationDelayMinusOne uint8
+	ConfigOBUs                       []byte
+}
+
+func (self *AV1CodecConfRecord) Unmarshal(b []byte) (n int, err error) {
+	if len(b) < 4 || b[0] != 0x81 {
+		err = ErrDecconfInvalid
+		return
+	}
+	self.SeqProfile = b[1] >> 5
+	self.SeqLevelIdx0 = b[1] & 0x1f
+	self.SeqTier0 = b[2] >> 7
+	self.HighBitdepth = (b[2] >> 6) & 0x01
+	self.TwelveBit = (b[2] >> 5) & 0x01
+	self.MonoChrome = (b[2] >> 4) & 0x01
+	self.ChromaSubsamplingX = (b[2] >> 3) & 0x01
+	self.ChromaSubsamplingY = (b[2] >> 2) & 0x01
+	self.ChromaSamplePosition = b[2] & 0x03
+	self.InitialPresentationDelayPresent = (b[3] >> 4) & 0x01
+	self.InitialPresentationDelayMinusOne = b[3] & 0x0f
+	self.ConfigOBUs = b[4:]
+	n = len(b)
+	return
+}
+
+func (self AV1CodecConfRecord) Len() int {
+	return 4 + len(self.ConfigOBUs)
+}
+
+func (self AV1CodecConfRecord) Marshal(b []byte) (n int) {
+	b[0] = 0x81 // marker, version 1
+	b[1] = self.SeqProfile<<5 | self.SeqLevelIdx0&0x1f
+	b[2] = self.SeqTier0<<7 | self.HighBitdepth<<6 | self.TwelveBit<<5 | self.MonoChrome<<4 |
+		self.ChromaSubsamplingX<<3 | self.ChromaSubsamplingY<<2 | self.ChromaSamplePosition&0x03
+	b[3] = self.InitialPresentationDelayPresent<<4 | self.InitialPresentationDelayMinusOne&0x0f
+	n = 4
+	n += copy(b[n:], self.ConfigOBUs)
+	return
+}
+
+type CodecData struct {
+	Record         []byte
+	RecordInfo     AV1CodecConfRecord
+	SequenceHeader SequenceHeader
+
+	seqHdrTag *flvio.Tag
+	// fpsEstimator sequence header没有timing_info时的帧率估计, 见WithFPSEstimator
+	fpsEstimator *av.FPSEstimator
+}
+
+// WithFPSEstimator 挂载帧率估计, sequence header不带帧率时FPS()和PacketDuration()使用其估计值
+func (self CodecData) WithFPSEstimator(e *av.FPSEstimator) av.CodecData {
+	self.fpsEstimator = e
+	return self
+}
+
+// SequenceHeaderTag 推流端的sequence header tag, 未设置时ok为false
+func (self CodecData) SequenceHeaderTag() (tag flvio.Tag, ok bool) {
+	if self.seqHdrTag != nil {
+		return *self.seqHdrTag, true
+	}
+	return
+}
+
+// SetSequenceHeaderTag 保存sequence header tag, 转发时原样写出
+func (self *CodecData) SetSequenceHeaderTag(tag flvio.Tag) {
+	self.seqHdrTag = &tag
+}
+
+func (self CodecData) Type() av.CodecType {
+	return av.AV1
+}
+
+// AV1CodecConfRecordBytes av1C
+func (self CodecData) AV1CodecConfRecordBytes() []byte {
+	return self.Record
+}
+
+// SequenceHeaderOBU av1C中的sequence header OBU
+func (self CodecData) SequenceHeaderOBU() []byte {
+	obus, _ := SplitOBUs(self.RecordInfo.ConfigOBUs)
+	for _, obu := range obus {
+		if OBUType(obu) == OBU_SEQUENCE_HEADER {
+			return obu
+		}
+	}
+	return nil
+}
+
+func (self CodecData) Width() int {
+	return int(self.SequenceHeader.MaxFrameWidth)
+}
+
+func (self CodecData) Height() int {
+	return int(self.SequenceHeader.MaxFrameHeight)
+}
+
+// FPS sequence header中的帧率, 没有timing_info时为FPSEstimator的估计值, 都没有时为0
+func (self CodecData) FPS() int {
+	if self.SequenceHeader.FPS > 0 {
+		return int(self.SequenceHeader.FPS)
+	}
+	return self.fpsEstimator.FPS()
+}
+
+func (self CodecData) Resolution() string {
+	return fmt.Sprintf("%vx%v", self.Width(), self.Height())
+}
+
+// Tag RFC 6381的codecs参数, 如av01.0.08M.08
+func (self CodecData) Tag() string {
+	tier := "M"
+	if self.SequenceHeader.SeqTier0 != 0 {
+		tier = "H"
+	}
+	return fmt.Sprintf("av01.%d.%02d%s.%02d", self.SequenceHeader.SeqProfile, self.SequenceHeader.SeqLevelIdx0, tier, self.SequenceHeader.BitDepth)
+}
+
+func (self CodecData) Bandwidth() string {
+	fps := self.FPS()
+	if fps <= 0 {
+		fps = 30
+	}
+	return fmt.Sprintf("%v", (int(float64(self.Width())*(float64(1.71)*(30/float64(fps)))))*1000)
+}
+
+// ProfileName seq_profile的名字
+func ProfileName(profile uint) string {
+	switch profile {
+	case 0:
+		return "Main"
+	case 1:
+		return "High"
+	case 2:
+		return "Professional"
+	}
+	return fmt.Sprintf("%d", profile)
+}
+
+func (self CodecData) MarshalJSON() ([]byte, error) {
+	desc := av.Describe(self, self.Record)
+	desc.Profile = ProfileName(self.SequenceHeader.SeqProfile)
+	// seq_level_idx为(X-2)*4+Y, 对应level X.Y
+	desc.Level = fmt.Sprintf("%d.%d", 2+self.SequenceHeader.SeqLevelIdx0/4, self.SequenceHeader.SeqLevelIdx0%4)
+	desc.FPS = self.FPS()
+	return json.Marshal(desc)
+}
+
+// PacketDuration sequence header没有timing信息时返回0
+func (self CodecData) PacketDuration(data []byte) time.Duration {
+	if self.SequenceHeader.FPS == 0 {
+		return self.fpsEstimator.FrameDuration()
+	}
+	if self.FPS() <= 0 {
+		return 0
+	}
+	return time.Duration(1000./float64(self.FPS())) * time.Millisecond
+}
+
+// NewCodecDataFromAV1CodecConfRecord 从E-RTMP/mp4中的av1C创建, av1C中必须带sequence header OBU
+func NewCodecDataFromAV1CodecConfRecord(record []byte) (self CodecData, err error) {
+	self.Record = record
+	if _, err = (&self.RecordInfo).Unmarshal(record); err != nil {
+		return
+	}
+	obu := self.SequenceHeaderOBU()
+	if obu == nil {
+		err = fmt.Errorf("av1parser: no sequence header found in AV1CodecConfRecord")
+		return
+	}
+	if self.SequenceHeader, err = ParseSequenceHeader(obu); err != nil {
+		err = fmt.Errorf("av1parser: parse sequence header failed(%s)", err)
+		return
+	}
+	return
+}
+
+// NewCodecDataFromSequenceHeader 从码流中的sequence header OBU创建, av1C的字段由sequence header生成
+func NewCodecDataFromSequenceHeader(obu []byte) (self CodecData, err error) {
+	if self.SequenceHeader, err = ParseSequenceHeader(obu); err != nil {
+		return
+	}
+	sh := self.SequenceHeader
+	recordinfo := AV1CodecConfRecord{
+		SeqProfile:           uint8(sh.SeqProfile),
+		SeqLevelIdx0:         uint8(sh.SeqLevelIdx0),
+		SeqTier0:             uint8(sh.SeqTier0),
+		MonoChrome:           uint8(sh.MonoChrome),
+		ChromaSubsamplingX:   uint8(sh.SubsamplingX),
+		ChromaSubsamplingY:   uint8(sh.SubsamplingY),
+		ChromaSamplePosition: uint8(sh.ChromaSamplePosition),
+		ConfigOBUs:           WithSizeField(obu),
+	}
+	if sh.BitDepth > 8 {
+		recordinfo.HighBitdepth = 1
+	}
+	if sh.BitDepth == 12 {
+		recordinfo.TwelveBit = 1
+	}
+	if sh.InitialDisplayDelayMinus1 <= 0x0f {
+		recordinfo.InitialPresentationDelayPresent = 1
+		recordinfo.InitialPresentationDelayMinusOne = uint8(sh.InitialDisplayDelayMinus1)
+	}
+	self.Record = make([]byte, recordinfo.Len())
+	recordinfo.Marshal(self.Record)
+	self.RecordInfo = recordinfo
+	return
+}
+
+// WithSizeField 返回带obu_size的OBU, 已经有obu_size时原样返回
+func WithSizeField(obu []byte) []byte {
+	h, err := ParseOBUHeader(obu)
+	if err != nil || h.HasSizeField {
+		return obu
+	}
+	b := make([]byte, 0, len(obu)+8)
+	b = append(b, obu[:h.HeaderLen]...)
+	b[0] |= 0x02
+	b = AppendLEB128(b, uint64(h.Size))
+	return append(b, obu[h.HeaderLen:]...)
+}
@@ -0,0 +1,138 @@
+package av1parser
+
+import (
+	"bytes"
+	"testing"
+)
+
+type bitWriter struct {
+	buf  []byte
+	nbit int
+}
+
+func (w *bitWriter) write(v uint64, n int) {
+	for i := n - 1; i >= 0; i-- {
+		if w.nbit%8 == 0 {
+			w.buf = append(w.buf, 0)
+		}
+		if v>>uint(i)&1 != 0 {
+			w.buf[len(w.buf)-1] |= 0x80 >> uint(w.nbit%8)
+		}
+		w.nbit++
+	}
+}
+
+// testSequenceHeader main profile, level 4.0, 1280x720, 30fps
+func testSequenceHeader() []byte {
+	w := &bitWriter{}
+	w.write(0, 3)     // seq_profile
+	w.write(0, 2)     // still_picture, reduced_still_picture_header
+	w.write(1, 1)     // timing_info_present_flag
+	w.write(1, 32)    // num_units_in_display_tick
+	w.write(30, 32)   // time_scale
+	w.write(1, 1)     // equal_picture_interval
+	w.write(1, 1)     // num_ticks_per_picture_minus_1 = 0
+	w.write(0, 1)     // decoder_model_info_present_flag
+	w.write(0, 1)     // initial_display_delay_present_flag
+	w.write(0, 5)     // operating_points_cnt_minus_1
+	w.write(0, 12)    // operating_point_idc
+	w.write(8, 5)     // seq_level_idx
+	w.write(0, 1)     // seq_tier
+	w.write(10, 4)    // frame_width_bits_minus_1
+	w.write(10, 4)    // frame_height_bits_minus_1
+	w.write(1279, 11) // max_frame_width_minus_1
+	w.write(719, 11)  // max_frame_height_minus_1
+	w.write(0, 1)     // frame_id_numbers_present_flag
+	w.write(0, 3)     // use_128x128_superblock, enable_filter_intra, enable_intra_edge_filter
+	w.write(0, 4)     // enable_interintra_compound ... enable_dual_filter
+	w.write(1, 1)     // enable_order_hint
+	w.write(3, 2)     // enable_jnt_comp, enable_ref_frame_mvs
+	w.write(1, 1)     // seq_choose_screen_content_tools
+	w.write(1, 1)     // seq_choose_integer_mv
+	w.write(6, 3)     // order_hint_bits_minus_1
+	w.write(2, 3)     // enable_superres, enable_cdef, enable_restoration
+	w.write(0, 4)     // high_bitdepth, mono_chrome, color_description_present_flag, color_range
+	w.write(0, 2)     // chroma_sample_position
+	w.write(0, 1)     // separate_uv_delta_q
+	w.write(0, 1)     // film_grain_params_present
+	w.write(1, 1)     // trailing_one_bit
+	payload := w.buf
+	return append(AppendLEB128([]byte{OBU_SEQUENCE_HEADER<<3 | 0x02}, uint64(len(payload))), payload...)
+}
+
+func TestLEB128(t *testing.T) {
+	for _, v := range []uint64{0, 1, 127, 128, 300, 1 << 20} {
+		b := AppendLEB128(nil, v)
+		got, n, err := ReadLEB128(b)
+		if err != nil || got != v || n != len(b) {
+			t.Fatalf("leb128 %d: got %d n=%d err=%v", v, got, n, err)
+		}
+	}
+}
+
+func TestParseSequenceHeader(t *testing.T) {
+	sh, err := ParseSequenceHeader(testSequenceHeader())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sh.MaxFrameWidth != 1280 || sh.MaxFrameHeight != 720 || sh.FPS != 30 {
+		t.Fatalf("got %dx%d@%d", sh.MaxFrameWidth, sh.MaxFrameHeight, sh.FPS)
+	}
+	if sh.SeqProfile != 0 || sh.SeqLevelIdx0 != 8 || sh.BitDepth != 8 || sh.SubsamplingX != 1 || sh.SubsamplingY != 1 {
+		t.Fatalf("unexpected sequence header %+v", sh)
+	}
+}
+
+func TestCodecData(t *testing.T) {
+	obu := testSequenceHeader()
+	codec, err := NewCodecDataFromSequenceHeader(obu)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if codec.Tag() != "av01.0.08M.08" || codec.Resolution() != "1280x720" {
+		t.Fatalf("got tag %s resolution %s", codec.Tag(), codec.Resolution())
+	}
+	if codec.Record[0] != 0x81 || codec.Record[1] != 0x08 {
+		t.Fatalf("unexpected av1C header % x", codec.Record[:4])
+	}
+
+	// av1C往返
+	parsed, err := NewCodecDataFromAV1CodecConfRecord(codec.AV1CodecConfRecordBytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(parsed.SequenceHeaderOBU(), obu) || parsed.SequenceHeader != codec.SequenceHeader {
+		t.Fatalf("av1C round trip mismatch")
+	}
+	if _, err = NewCodecDataFromAV1CodecConfRecord(codec.Record[:4]); err == nil {
+		t.Fatal("expected error for av1C without sequence header")
+	}
+}
+
+func TestStartCodeFormat(t *testing.T) {
+	frame := []byte{OBU_FRAME<<3 | 0x02, 6, 0x10, 0, 0, 1, 0, 0}
+	tu := append(append(append([]byte{}, TemporalDelimiter...), testSequenceHeader()...), frame...)
+	if !IsKeyFrame(tu[len(TemporalDelimiter):]) || IsKeyFrame(frame) {
+		t.Fatal("IsKeyFrame mismatch")
+	}
+
+	b, err := ToStartCodeFormat(tu)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 帧数据中的00 00 01需要加防竞争字节
+	if bytes.Count(b, startCode) != 3 {
+		t.Fatalf("expected 3 start codes in % x", b)
+	}
+	back, err := FromStartCodeFormat(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(back, tu) {
+		t.Fatalf("start code round trip mismatch\n% x\n% x", back, tu)
+	}
+	obus, err := SplitOBUs(back)
+	if err != nil || len(obus) != 3 || OBUType(obus[2]) != OBU_FRAME {
+		t.Fatalf("split %d obus err=%v", len(obus), err)
+	}
+}
@@ -0,0 +1,83 @@
+package av1parser
+
+import (
+	"bytes"
+)
+
+var startCode = []byte{0, 0, 1}
+
+// ToStartCodeFormat 把低开销格式的temporal unit转为MPEG-2 TS中的start code格式:
+// 每个OBU之前加00 00 01, 去掉obu_size并插入防竞争字节
+func ToStartCodeFormat(tu []byte) (b []byte, err error) {
+	obus, err := SplitOBUs(tu)
+	if err != nil {
+		return
+	}
+	b = make([]byte, 0, len(tu)+len(obus)*3+16)
+	for _, obu := range obus {
+		var h OBUHeader
+		if h, err = ParseOBUHeader(obu); err != nil {
+			return
+		}
+		hdr := []byte{obu[0] &^ 0x02}
+		if h.HasExtension {
+			hdr = append(hdr, obu[1])
+		}
+		b = append(b, startCode...)
+		b = appendEmulationPrevention(b, append(hdr, obu[h.HeaderLen:h.HeaderLen+h.Size]...))
+	}
+	return
+}
+
+// FromStartCodeFormat 把start code格式转为低开销格式, 每个OBU都带obu_size
+func FromStartCodeFormat(b []byte) (tu []byte, err error) {
+	for len(b) > 0 {
+		i := bytes.Index(b, startCode)
+		if i < 0 {
+			break
+		}
+		b = b[i+len(startCode):]
+		end := bytes.Index(b, startCode)
+		if end < 0 {
+			end = len(b)
+		}
+		obu := b[:end]
+		b = b[end:]
+		if len(obu) == 0 {
+			continue
+		}
+		obu = removeEmulationPrevention(obu)
+		var h OBUHeader
+		if h, err = ParseOBUHeader(obu); err != nil {
+			return
+		}
+		if h.HasSizeField {
+			tu = append(tu, obu[:h.HeaderLen+h.Size]...)
+		} else {
+			tu = append(tu, WithSizeField(obu)...)
+		}
+	}
+	return
+}
+
+// appendEmulationPrevention 在连续两个0之后的0~3之前插入0x03
+func appendEmulationPrevention(b []byte, data []byte) []byte {
+	zeros := 0
+	for _, c := range data {
+		if zeros >= 2 && c <= 3 {
+			b = append(b, 3)
+			zeros = 0
+		}
+		b = append(b, c)
+		if c == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+	}
+	return b
+}
+
+func removeEmulationPrevention(data []byte) []byte {
+	return bytes.Replace(data, []byte{0, 0, 3}, []byte{0, 0}, -1)
+}
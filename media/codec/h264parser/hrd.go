@@ -0,0 +1,173 @@
+package h264parser
+
+import (
+	"github.com/bugVanisher/streamer/utils/bits"
+)
+
+// HRDParameters hrd_parameters(), 见H.264 E.1.2
+type HRDParameters struct {
+	CpbCntMinus1                       uint
+	BitRateScale                       uint
+	CpbSizeScale                       uint
+	BitRateValueMinus1                 []uint
+	CpbSizeValueMinus1                 []uint
+	CbrFlag                            []uint
+	InitialCpbRemovalDelayLengthMinus1 uint
+	CpbRemovalDelayLengthMinus1        uint
+	DpbOutputDelayLengthMinus1         uint
+	TimeOffsetLength                   uint
+}
+
+// BitRate 第i个CPB的最大输入码率, 单位bit/s
+func (self HRDParameters) BitRate(i int) uint64 {
+	if i >= len(self.BitRateValueMinus1) {
+		return 0
+	}
+	return uint64(self.BitRateValueMinus1[i]+1) << (6 + self.BitRateScale)
+}
+
+// CpbSize 第i个CPB的大小, 单位bit
+func (self HRDParameters) CpbSize(i int) uint64 {
+	if i >= len(self.CpbSizeValueMinus1) {
+		return 0
+	}
+	return uint64(self.CpbSizeValueMinus1[i]+1) << (4 + self.CpbSizeScale)
+}
+
+// CBR 第i个CPB是否为恒定码率
+func (self HRDParameters) CBR(i int) bool {
+	return i < len(self.CbrFlag) && self.CbrFlag[i] == 1
+}
+
+func parseHRDParameters(r *bits.GolombBitReader) (hrd HRDParameters, err error) {
+	if hrd.CpbCntMinus1, err = r.ReadExponentialGolombCode(); err != nil {
+		return
+	}
+	if hrd.BitRateScale, err = r.ReadBits(4); err != nil {
+		return
+	}
+	if hrd.CpbSizeScale, err = r.ReadBits(4); err != nil {
+		return
+	}
+	// cpb_cnt_minus1最大为31
+	for i := uint(0); i <= hrd.CpbCntMinus1 && i < 32; i++ {
+		var v uint
+		if v, err = r.ReadExponentialGolombCode(); err != nil {
+			return
+		}
+		hrd.BitRateValueMinus1 = append(hrd.BitRateValueMinus1, v)
+		if v, err = r.ReadExponentialGolombCode(); err != nil {
+			return
+		}
+		hrd.CpbSizeValueMinus1 = append(hrd.CpbSizeValueMinus1, v)
+		if v, err = r.ReadBit(); err != nil {
+			return
+		}
+		hrd.CbrFlag = append(hrd.CbrFlag, v)
+	}
+	if hrd.InitialCpbRemovalDelayLengthMinus1, err = r.ReadBits(5); err != nil {
+		return
+	}
+	if hrd.CpbRemovalDelayLengthMinus1, err = r.ReadBits(5); err != nil {
+		return
+	}
+	if hrd.DpbOutputDelayLengthMinus1, err = r.ReadBits(5); err != nil {
+		return
+	}
+	if hrd.TimeOffsetLength, err = r.ReadBits(5); err != nil {
+		return
+	}
+	return
+}
+
+// parseVuiHrdAndRestriction 解析vui_parameters()中timing_info之后的HRD参数和bitstream_restriction
+func parseVuiHrdAndRestriction(sps *SPSInfo, r *bits.GolombBitReader) (err error) {
+	if sps.NalHrdParametersPresentFlag, err = r.ReadBit(); err != nil {
+		return
+	}
+	if sps.NalHrdParametersPresentFlag != 0 {
+		if sps.NalHrdParameters, err = parseHRDParameters(r); err != nil {
+			return
+		}
+	}
+	if sps.VclHrdParametersPresentFlag, err = r.ReadBit(); err != nil {
+		return
+	}
+	if sps.VclHrdParametersPresentFlag != 0 {
+		if sps.VclHrdParameters, err = parseHRDParameters(r); err != nil {
+			return
+		}
+	}
+	if sps.NalHrdParametersPresentFlag != 0 || sps.VclHrdParametersPresentFlag != 0 {
+		if sps.LowDelayHrdFlag, err = r.ReadBit(); err != nil {
+			return
+		}
+	}
+	if sps.PicStructPresentFlag, err = r.ReadBit(); err != nil {
+		return
+	}
+	if sps.BitstreamRestrictionFlag, err = r.ReadBit(); err != nil {
+		return
+	}
+	if sps.BitstreamRestrictionFlag == 0 {
+		return
+	}
+	if sps.MotionVectorsOverPicBoundariesFlag, err = r.ReadBit(); err != nil {
+		return
+	}
+	for _, v := range []*uint{
+		&sps.MaxBytesPerPicDenom, &sps.MaxBitsPerMbDenom, &sps.Log2MaxMvLengthHorizontal,
+		&sps.Log2MaxMvLengthVertical, &sps.MaxNumReorderFrames, &sps.MaxDecFrameBuffering,
+	} {
+		if *v, err = r.ReadExponentialGolombCode(); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// hrd 优先使用NAL HRD参数, 没有时使用VCL HRD参数
+func (self SPSInfo) hrd() (HRDParameters, bool) {
+	if self.NalHrdParametersPresentFlag != 0 {
+		return self.NalHrdParameters, true
+	}
+	if self.VclHrdParametersPresentFlag != 0 {
+		return self.VclHrdParameters, true
+	}
+	return HRDParameters{}, false
+}
+
+// MaxBitRate 编码器在HRD参数中声明的最大码率(bit/s), 没有HRD参数时为0
+func (self SPSInfo) MaxBitRate() uint64 {
+	hrd, ok := self.hrd()
+	if !ok {
+		return 0
+	}
+	return hrd.BitRate(0)
+}
+
+// CpbSize 编码器在HRD参数中声明的CPB(VBV缓冲)大小(bit), 没有HRD参数时为0
+func (self SPSInfo) CpbSize() uint64 {
+	hrd, ok := self.hrd()
+	if !ok {
+		return 0
+	}
+	return hrd.CpbSize(0)
+}
+
+// SEITimingParams 解析buffering_period和pic_timing SEI需要的参数
+func (self SPSInfo) SEITimingParams() SEITimingParams {
+	params := SEITimingParams{
+		NalHrdParametersPresent: self.NalHrdParametersPresentFlag != 0,
+		VclHrdParametersPresent: self.VclHrdParametersPresentFlag != 0,
+		PicStructPresent:        self.PicStructPresentFlag != 0,
+	}
+	if hrd, ok := self.hrd(); ok {
+		params.CpbCnt = int(hrd.CpbCntMinus1) + 1
+		params.InitialCpbRemovalDelayLength = hrd.InitialCpbRemovalDelayLengthMinus1 + 1
+		params.CpbRemovalDelayLength = hrd.CpbRemovalDelayLengthMinus1 + 1
+		params.DpbOutputDelayLength = hrd.DpbOutputDelayLengthMinus1 + 1
+		params.TimeOffsetLength = hrd.TimeOffsetLength
+	}
+	return params
+}
@@ -0,0 +1,78 @@
+package h264parser
+
+import "testing"
+
+// testSPSWithHRD baseline 1280x720@25fps, NAL HRD 2Mbps/4Mbit CPB, 带bitstream_restriction
+func testSPSWithHRD() []byte {
+	w := &bitWriter{}
+	w.write(0x67, 8)
+	w.write(66, 8) // profile_idc
+	w.write(0, 8)  // constraint_set_flags, reserved_zero_2bits
+	w.write(31, 8) // level_idc
+	w.writeUE(0)   // seq_parameter_set_id
+	w.writeUE(0)   // log2_max_frame_num_minus4
+	w.writeUE(0)   // pic_order_cnt_type
+	w.writeUE(0)   // log2_max_pic_order_cnt_lsb_minus4
+	w.writeUE(1)   // max_num_ref_frames
+	w.write(0, 1)  // gaps_in_frame_num_value_allowed_flag
+	w.writeUE(79)  // pic_width_in_mbs_minus1
+	w.writeUE(44)  // pic_height_in_map_units_minus1
+	w.write(1, 1)  // frame_mbs_only_flag
+	w.write(1, 1)  // direct_8x8_inference_flag
+	w.write(0, 1)  // frame_cropping_flag
+	w.write(1, 1)  // vui_parameters_present_flag
+
+	w.write(0, 4)  // aspect_ratio, overscan, video_signal_type, chroma_loc_info
+	w.write(1, 1)  // timing_info_present_flag
+	w.write(1, 32) // num_units_in_tick
+	w.write(50, 32)
+	w.write(1, 1) // fixed_frame_rate_flag
+
+	w.write(1, 1)     // nal_hrd_parameters_present_flag
+	w.writeUE(0)      // cpb_cnt_minus1
+	w.write(0, 4)     // bit_rate_scale
+	w.write(0, 4)     // cpb_size_scale
+	w.writeUE(31249)  // bit_rate_value_minus1: 31250<<6 = 2Mbps
+	w.writeUE(249999) // cpb_size_value_minus1: 250000<<4 = 4Mbit
+	w.write(0, 1)     // cbr_flag
+	w.write(23, 5)    // initial_cpb_removal_delay_length_minus1
+	w.write(23, 5)    // cpb_removal_delay_length_minus1
+	w.write(23, 5)    // dpb_output_delay_length_minus1
+	w.write(24, 5)    // time_offset_length
+	w.write(0, 1)     // vcl_hrd_parameters_present_flag
+	w.write(0, 1)     // low_delay_hrd_flag
+	w.write(1, 1)     // pic_struct_present_flag
+	w.write(1, 1)     // bitstream_restriction_flag
+	w.write(1, 1)     // motion_vectors_over_pic_boundaries_flag
+	for _, v := range []uint64{2, 1, 16, 16, 2, 4} {
+		w.writeUE(v)
+	}
+	w.write(1, 1) // rbsp_stop_one_bit
+	return w.buf
+}
+
+func TestParseSPSHRD(t *testing.T) {
+	sps, err := ParseSPS(testSPSWithHRD())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sps.Width != 1280 || sps.Height != 720 || sps.FPS != 25 {
+		t.Fatalf("unexpected size %dx%d@%d", sps.Width, sps.Height, sps.FPS)
+	}
+	if sps.MaxBitRate() != 2000000 || sps.CpbSize() != 4000000 || sps.NalHrdParameters.CBR(0) {
+		t.Fatalf("bitrate %d cpb %d", sps.MaxBitRate(), sps.CpbSize())
+	}
+	if sps.BitstreamRestrictionFlag != 1 || sps.MaxNumReorderFrames != 2 || sps.MaxDecFrameBuffering != 4 || sps.Log2MaxMvLengthVertical != 16 {
+		t.Fatalf("unexpected bitstream restriction %+v", sps.VuiParameters)
+	}
+	params := sps.SEITimingParams()
+	if !params.CpbDpbDelaysPresent() || !params.PicStructPresent || params.CpbRemovalDelayLength != 24 || params.TimeOffsetLength != 24 || params.CpbCnt != 1 {
+		t.Fatalf("unexpected sei timing params %+v", params)
+	}
+
+	// VUI末尾截断时HRD之前的字段仍然有效
+	truncated := testSPSWithHRD()[:19]
+	if sps, err = ParseSPS(truncated); err != nil || sps.FPS != 25 {
+		t.Fatalf("truncated hrd: fps %d err=%v", sps.FPS, err)
+	}
+}
@@ -0,0 +1,87 @@
+package h264parser
+
+import (
+	"github.com/bugVanisher/streamer/media/av"
+)
+
+// IsInterlaced SPS是否允许场编码或MBAFF(frame_mbs_only_flag为0)
+func (self SPSInfo) IsInterlaced() bool {
+	return self.FrameMbsOnlyFlag == 0
+}
+
+// MayBeInterlaced 流中可能有隔行内容: SPS允许场编码, 或pic_timing SEI中可能带pic_struct
+func (self CodecData) MayBeInterlaced() bool {
+	return self.SPSInfo.IsInterlaced() || self.SPSInfo.PicStructPresentFlag != 0
+}
+
+// picStructure 帧编码图像的pic_struct(Table D-1)对应的图像结构, pic_struct为1, 2的单个场由slice header判断
+func picStructure(picStruct uint) av.PictureStructure {
+	switch picStruct {
+	case 3, 4, 5, 6:
+		return av.PictureInterlacedFrame
+	}
+	return av.PictureFrame
+}
+
+// PictureStructure 按slice header的field_pic_flag/bottom_field_flag和pic_timing SEI的pic_struct
+// 检测帧(AVCC或AnnexB)的图像结构. 场编码时按帧中出现的场判断是单个场还是场对,
+// 帧编码时以pic_struct为准, 没有pic_struct时frame_mbs_only_flag为0的帧按隔行帧处理
+func (self CodecData) PictureStructure(frame []byte) av.PictureStructure {
+	sps, pps := self.SPSInfo, self.PPSInfo
+	if !self.MayBeInterlaced() {
+		return av.PictureFrame
+	}
+	var top, bottom, coded, hasPicStruct bool
+	var picStruct uint
+	nalus, _ := SplitNALUs(frame)
+	for _, nalu := range nalus {
+		if len(nalu) == 0 {
+			continue
+		}
+		switch nalu[0] & 0x1f {
+		case NALU_SEI:
+			if sps.PicStructPresentFlag == 0 || hasPicStruct {
+				continue
+			}
+			msgs, _ := SEIMessages(nalu)
+			for _, msg := range msgs {
+				if msg.PayloadType != SEI_PIC_TIMING {
+					continue
+				}
+				if pt, err := ParsePicTiming(msg.Payload, sps.SEITimingParams()); err == nil {
+					hasPicStruct, picStruct = true, pt.PicStruct
+				}
+			}
+		case 1, NALU_IDR_SLICE:
+			if !sps.IsInterlaced() {
+				continue
+			}
+			h, err := ParseSliceHeader(nalu, sps, pps)
+			if err != nil {
+				continue
+			}
+			switch {
+			case h.FieldPicFlag == 0:
+				coded = true
+			case h.BottomFieldFlag == 1:
+				bottom = true
+			default:
+				top = true
+			}
+		}
+	}
+
+	switch {
+	case top && bottom:
+		return av.PictureFieldPair
+	case top:
+		return av.PictureTopField
+	case bottom:
+		return av.PictureBottomField
+	case hasPicStruct:
+		return picStructure(picStruct)
+	case coded:
+		return av.PictureInterlacedFrame
+	}
+	return av.PictureFrame
+}
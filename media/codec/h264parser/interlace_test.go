@@ -0,0 +1,115 @@
+package h264parser
+
+import (
+	"testing"
+
+	"github.com/bugVanisher/streamer/media/av"
+)
+
+// testInterlacedSPS frame_mbs_only_flag为0的1920x1080 SPS
+func testInterlacedSPS() []byte {
+	w := &bitWriter{}
+	w.write(0x67, 8)
+	w.write(77, 8) // profile_idc
+	w.write(0, 8)  // constraint_set_flags, reserved_zero_2bits
+	w.write(40, 8) // level_idc
+	w.writeUE(0)   // seq_parameter_set_id
+	w.writeUE(0)   // log2_max_frame_num_minus4
+	w.writeUE(2)   // pic_order_cnt_type
+	w.writeUE(1)   // max_num_ref_frames
+	w.write(0, 1)  // gaps_in_frame_num_value_allowed_flag
+	w.writeUE(119) // pic_width_in_mbs_minus1
+	w.writeUE(33)  // pic_height_in_map_units_minus1
+	w.write(0, 1)  // frame_mbs_only_flag
+	w.write(0, 1)  // mb_adaptive_frame_field_flag
+	w.write(1, 1)  // direct_8x8_inference_flag
+	w.write(0, 1)  // frame_cropping_flag
+	w.write(0, 1)  // vui_parameters_present_flag
+	w.write(1, 1)  // rbsp_stop_one_bit
+	return w.buf
+}
+
+// testFieldSlice 引用testInterlacedSPS的I slice, field为0时是帧, 1为顶场, 2为底场
+func testFieldSlice(idr bool, field int) []byte {
+	w := &bitWriter{}
+	if idr {
+		w.write(0x65, 8)
+	} else {
+		w.write(0x41, 8)
+	}
+	w.writeUE(0)  // first_mb_in_slice
+	w.writeUE(7)  // slice_type
+	w.writeUE(0)  // pic_parameter_set_id
+	w.write(0, 4) // frame_num
+	if field == 0 {
+		w.write(0, 1) // field_pic_flag
+	} else {
+		w.write(1, 1)
+		w.write(uint64(field-1), 1) // bottom_field_flag
+	}
+	if idr {
+		w.writeUE(0) // idr_pic_id
+	}
+	w.write(0xff, 8)
+	return w.buf
+}
+
+func testAVCC(nalus ...[]byte) (b []byte) {
+	for _, nalu := range nalus {
+		b = append(b, 0, 0, 0, byte(len(nalu)))
+		b = append(b, nalu...)
+	}
+	return
+}
+
+func TestPictureStructure(t *testing.T) {
+	progressive, err := NewCodecDataFromSPSAndPPS(testSPS(0, 80, 45), testPPS(0, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if progressive.MayBeInterlaced() || progressive.PictureStructure(testIDR(0)) != av.PictureFrame {
+		t.Fatal("progressive stream detected as interlaced")
+	}
+
+	codec, err := NewCodecDataFromSPSAndPPS(testInterlacedSPS(), testPPS(0, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !codec.SPSInfo.IsInterlaced() || codec.Height() != 1088 {
+		t.Fatalf("unexpected sps %+v", codec.SPSInfo)
+	}
+	cases := []struct {
+		frame []byte
+		want  av.PictureStructure
+	}{
+		{testAVCC(testFieldSlice(true, 0)), av.PictureInterlacedFrame},
+		{testAVCC(testFieldSlice(true, 1), testFieldSlice(false, 2)), av.PictureFieldPair},
+		{testAVCC(testFieldSlice(true, 1)), av.PictureTopField},
+		{testAVCC(testFieldSlice(false, 2)), av.PictureBottomField},
+	}
+	for i, c := range cases {
+		if got := codec.PictureStructure(c.frame); got != c.want {
+			t.Fatalf("case %d: got %v, want %v", i, got, c.want)
+		}
+	}
+
+	// frame_mbs_only_flag为1时按pic_timing的pic_struct判断
+	timed, err := NewCodecDataFromSPSAndPPS(testSPSWithHRD(), testPPS(0, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	picTiming := func(picStruct uint64) []byte {
+		w := &bitWriter{}
+		w.write(0, 24)                    // cpb_removal_delay
+		w.write(0, 24)                    // dpb_output_delay
+		w.write(picStruct, 4)             // pic_struct
+		w.write(0, numClockTS[picStruct]) // clock_timestamp_flag
+		return MarshalSEINALU(SEI_PIC_TIMING, w.buf)
+	}
+	if got := timed.PictureStructure(testAVCC(picTiming(3), testIDR(0)[4:])); got != av.PictureInterlacedFrame {
+		t.Fatalf("pic_struct 3: got %v", got)
+	}
+	if got := timed.PictureStructure(testAVCC(picTiming(0), testIDR(0)[4:])); got != av.PictureFrame {
+		t.Fatalf("pic_struct 0: got %v", got)
+	}
+}
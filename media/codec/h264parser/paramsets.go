@@ -0,0 +1,123 @@
+package h264parser
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/bugVanisher/streamer/utils/bits"
+)
+
+// ParameterSets record中的全部SPS和PPS, 关键帧前重复写出时使用, 轮换使用多组参数集的流的任意关键帧都可以解码
+func (self CodecData) ParameterSets() (nalus [][]byte) {
+	nalus = append(nalus, self.RecordInfo.SPS...)
+	nalus = append(nalus, self.RecordInfo.PPS...)
+	return
+}
+
+// spsIndex seq_parameter_set_id为id的SPS在record中的下标, 相同id以后出现的为准
+func (self CodecData) spsIndex(id uint) (idx int, info SPSInfo, ok bool) {
+	for i, b := range self.RecordInfo.SPS {
+		if sps, err := ParseSPS(b); err == nil && sps.SeqParameterSetID == id {
+			idx, info, ok = i, sps, true
+		}
+	}
+	return
+}
+
+// ppsIndex pic_parameter_set_id为id的PPS在record中的下标, 相同id以后出现的为准
+func (self CodecData) ppsIndex(id uint) (idx int, info PPSInfo, ok bool) {
+	for i, b := range self.RecordInfo.PPS {
+		if pps, err := ParsePPS(b); err == nil && pps.PicParameterSetID == id {
+			idx, info, ok = i, pps, true
+		}
+	}
+	return
+}
+
+// SPSByID 按seq_parameter_set_id查找SPS
+func (self CodecData) SPSByID(id uint) (sps []byte, ok bool) {
+	var idx int
+	if idx, _, ok = self.spsIndex(id); ok {
+		sps = self.RecordInfo.SPS[idx]
+	}
+	return
+}
+
+// PPSByID 按pic_parameter_set_id查找PPS
+func (self CodecData) PPSByID(id uint) (pps []byte, ok bool) {
+	var idx int
+	if idx, _, ok = self.ppsIndex(id); ok {
+		pps = self.RecordInfo.PPS[idx]
+	}
+	return
+}
+
+// SlicePPSID 帧中第一个slice引用的pic_parameter_set_id, 帧可以是AVCC或AnnexB格式
+func SlicePPSID(frame []byte) (id uint, err error) {
+	nalus, _ := SplitNALUs(frame)
+	for _, nalu := range nalus {
+		if len(nalu) <= 1 {
+			continue
+		}
+		switch nalu[0] & 0x1f {
+		case 1, 2, 5, 19:
+		default:
+			continue
+		}
+		data := nalu[1:]
+		if len(data) > sliceHeaderMaxBytes {
+			data = data[:sliceHeaderMaxBytes]
+		}
+		r := &bits.GolombBitReader{R: bytes.NewReader(RemoveH264orH265EmulationBytes(data))}
+		// first_mb_in_slice, slice_type
+		for i := 0; i < 2; i++ {
+			if _, err = r.ReadExponentialGolombCode(); err != nil {
+				return
+			}
+		}
+		return r.ReadExponentialGolombCode()
+	}
+	err = fmt.Errorf("h264parser: no slice found in frame")
+	return
+}
+
+// Activate 按pic_parameter_set_id切换生效的参数集, 更新SPSInfo/PPSInfo, 返回生效的SPS或PPS内容是否变化
+func (self *CodecData) Activate(ppsID uint) (changed bool, err error) {
+	ppsIdx, pps, ok := self.ppsIndex(ppsID)
+	if !ok {
+		err = fmt.Errorf("h264parser: pps id %d not found in AVCDecoderConfRecord", ppsID)
+		return
+	}
+	spsIdx, sps, ok := self.spsIndex(pps.SeqParameterSetID)
+	if !ok {
+		err = fmt.Errorf("h264parser: sps id %d referenced by pps %d not found in AVCDecoderConfRecord", pps.SeqParameterSetID, ppsID)
+		return
+	}
+	changed = !bytes.Equal(self.RecordInfo.SPS[spsIdx], self.SPS()) || !bytes.Equal(self.RecordInfo.PPS[ppsIdx], self.PPS())
+	self.activeSPS, self.activePPS = spsIdx, ppsIdx
+	self.SPSInfo, self.PPSInfo = sps, pps
+	return
+}
+
+// ActivateFrame 按关键帧引用的PPS切换生效的参数集
+func (self *CodecData) ActivateFrame(frame []byte) (changed bool, err error) {
+	var id uint
+	if id, err = SlicePPSID(frame); err != nil {
+		return
+	}
+	return self.Activate(id)
+}
+
+// Update 用新的AVCDecoderConfRecord替换, 沿用当前生效的pic_parameter_set_id.
+// 只有生效的SPS或PPS内容不同时changed为true, 参数集的顺序、增减未生效的参数集不算变化
+func (self CodecData) Update(record []byte) (next CodecData, changed bool, err error) {
+	if next, err = NewCodecDataFromAVCDecoderConfRecord(record); err != nil {
+		return
+	}
+	if _, err := next.Activate(self.PPSInfo.PicParameterSetID); err != nil {
+		// 新的record没有当前生效的PPS, 使用其第一个参数集
+		return next, true, nil
+	}
+	changed = !bytes.Equal(next.SPS(), self.SPS()) || !bytes.Equal(next.PPS(), self.PPS())
+	return
+}
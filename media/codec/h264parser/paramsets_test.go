@@ -0,0 +1,118 @@
+package h264parser
+
+import (
+	"bytes"
+	"testing"
+)
+
+// testSPS baseline, 宽高以宏块为单位
+func testSPS(id, widthMbs, heightMbs uint64) []byte {
+	w := &bitWriter{}
+	w.write(0x67, 8)
+	w.write(66, 8) // profile_idc
+	w.write(0, 8)  // constraint_set_flags, reserved_zero_2bits
+	w.write(31, 8) // level_idc
+	w.writeUE(id)  // seq_parameter_set_id
+	w.writeUE(0)   // log2_max_frame_num_minus4
+	w.writeUE(2)   // pic_order_cnt_type
+	w.writeUE(1)   // max_num_ref_frames
+	w.write(0, 1)  // gaps_in_frame_num_value_allowed_flag
+	w.writeUE(widthMbs - 1)
+	w.writeUE(heightMbs - 1)
+	w.write(1, 1) // frame_mbs_only_flag
+	w.write(1, 1) // direct_8x8_inference_flag
+	w.write(0, 1) // frame_cropping_flag
+	w.write(0, 1) // vui_parameters_present_flag
+	w.write(1, 1) // rbsp_stop_one_bit
+	return w.buf
+}
+
+func testPPS(id, spsID uint64) []byte {
+	w := &bitWriter{}
+	w.write(0x68, 8)
+	w.writeUE(id)
+	w.writeUE(spsID)
+	w.write(0, 2) // entropy_coding_mode_flag, bottom_field_pic_order_in_frame_present_flag
+	w.writeUE(0)  // num_slice_groups_minus1
+	w.writeUE(0)  // num_ref_idx_l0_default_active_minus1
+	w.writeUE(0)  // num_ref_idx_l1_default_active_minus1
+	w.write(0, 3) // weighted_pred_flag, weighted_bipred_idc
+	w.writeUE(0)  // pic_init_qp_minus26
+	w.writeUE(0)  // pic_init_qs_minus26
+	w.writeUE(0)  // chroma_qp_index_offset
+	w.write(0, 3) // deblocking_filter_control_present_flag, constrained_intra_pred_flag, redundant_pic_cnt_present_flag
+	w.write(1, 1) // rbsp_stop_one_bit
+	return w.buf
+}
+
+func testRecord(sps, pps [][]byte) []byte {
+	info := AVCDecoderConfRecord{AVCProfileIndication: 66, AVCLevelIndication: 31, LengthSizeMinusOne: 3, SPS: sps, PPS: pps}
+	b := make([]byte, info.Len())
+	info.Marshal(b)
+	return b
+}
+
+// testIDR 引用ppsID的IDR帧, AVCC格式
+func testIDR(ppsID uint64) []byte {
+	w := &bitWriter{}
+	w.write(0x65, 8)
+	w.writeUE(0) // first_mb_in_slice
+	w.writeUE(7) // slice_type
+	w.writeUE(ppsID)
+	w.write(0xff, 8)
+	nalu := w.buf
+	return append([]byte{0, 0, 0, byte(len(nalu))}, nalu...)
+}
+
+func TestParameterSets(t *testing.T) {
+	sps0, sps1 := testSPS(0, 80, 45), testSPS(1, 40, 30)
+	pps0, pps1 := testPPS(0, 0), testPPS(1, 1)
+	codec, err := NewCodecDataFromAVCDecoderConfRecord(testRecord([][]byte{sps0, sps1}, [][]byte{pps0, pps1}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codec.ParameterSets()) != 4 {
+		t.Fatalf("parameter sets %d", len(codec.ParameterSets()))
+	}
+	if b, ok := codec.PPSByID(1); !ok || !bytes.Equal(b, pps1) {
+		t.Fatal("pps 1 not found")
+	}
+	if _, ok := codec.SPSByID(2); ok {
+		t.Fatal("unexpected sps 2")
+	}
+	if codec.Width() != 1280 || !bytes.Equal(codec.SPS(), sps0) {
+		t.Fatalf("default set width %d", codec.Width())
+	}
+
+	// IDR引用PPS 1, 切换到第二组参数集
+	changed, err := codec.ActivateFrame(testIDR(1))
+	if err != nil || !changed {
+		t.Fatalf("activate pps 1: changed=%v err=%v", changed, err)
+	}
+	if codec.Width() != 640 || codec.Height() != 480 || !bytes.Equal(codec.PPS(), pps1) {
+		t.Fatalf("active set %dx%d", codec.Width(), codec.Height())
+	}
+	if changed, _ = codec.ActivateFrame(testIDR(1)); changed {
+		t.Fatal("same set reported as changed")
+	}
+	if _, err = codec.ActivateFrame(testIDR(5)); err == nil {
+		t.Fatal("unknown pps activated")
+	}
+
+	// 参数集顺序变化、去掉未生效的参数集不算变化, 生效的参数集沿用
+	next, changed, err := codec.Update(testRecord([][]byte{sps1}, [][]byte{pps1}))
+	if err != nil || changed {
+		t.Fatalf("reordered record: changed=%v err=%v", changed, err)
+	}
+	if next.Width() != 640 {
+		t.Fatalf("width %d after update", next.Width())
+	}
+	// 生效的SPS内容变化
+	if _, changed, _ = codec.Update(testRecord([][]byte{sps0, testSPS(1, 80, 45)}, [][]byte{pps0, pps1})); !changed {
+		t.Fatal("active sps change not reported")
+	}
+	// 生效的PPS不存在
+	if _, changed, _ = codec.Update(testRecord([][]byte{sps0}, [][]byte{pps0})); !changed {
+		t.Fatal("missing active pps not reported")
+	}
+}
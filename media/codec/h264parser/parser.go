@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/bugVanisher/streamer/media/av"
+	"github.com/bugVanisher/streamer/media/container/flv/flvio"
 	"github.com/bugVanisher/streamer/utils/bits"
 	"github.com/bugVanisher/streamer/utils/bits/pio"
 )
@@ -335,18 +336,21 @@ type VuiParameters struct {
 	TimeScale                      uint
 	FixedFrameRateFlag             uint
 	FPS                            uint
-	/*NalHrdParametersPresentFlag         uint
-	VclHrdParametersPresentFlag         uint
-	LowDelayHrdFlag                      uint
-	PicStructPresentFlag                 uint
-	BitstreamRestrictionFlag              uint
+
+	NalHrdParametersPresentFlag        uint
+	NalHrdParameters                   HRDParameters
+	VclHrdParametersPresentFlag        uint
+	VclHrdParameters                   HRDParameters
+	LowDelayHrdFlag                    uint
+	PicStructPresentFlag               uint
+	BitstreamRestrictionFlag           uint
 	MotionVectorsOverPicBoundariesFlag uint
-	MaxBytesPerPicDenom                 uint
-	MaxBitsPerMbDenom                   uint
-	Log2MaxMvLengthHorizontal           uint
-	Log2MaxMvLengthVertical             uint
-	MumReorderFrames                      uint
-	MaxDecFrameBuffering                 uint*/
+	MaxBytesPerPicDenom                uint
+	MaxBitsPerMbDenom                  uint
+	Log2MaxMvLengthHorizontal          uint
+	Log2MaxMvLengthVertical            uint
+	MaxNumReorderFrames                uint
+	MaxDecFrameBuffering               uint
 }
 
 //SPSInfo ...
@@ -498,7 +502,8 @@ func AddEmulationPrevention(data []byte) ([]byte, int) {
 	dataCopy := make([]byte, dataLen) //在copy前申请足够空间,copy操作会进行深拷贝,否则还是浅拷贝
 	copy(dataCopy, data)
 	addCnt := 0
-	for i := 0; i < dataLen-2; i++ {
+	// 插入后数据变长, 按当前长度检查到结尾
+	for i := 0; i < len(dataCopy)-2; i++ {
 		//check 0x000000-0x000003
 		if dataCopy[i] == 0x00 && dataCopy[i+1] == 0x00 && dataCopy[i+2] <= 3 {
 			//add 0x03
@@ -820,8 +825,8 @@ func parseVuiParameters(sps *SPSInfo, r *bits.GolombBitReader) (err error) {
 		}
 	}
 
-	//todo 后续部分参数待实现
-
+	// HRD参数和bitstream_restriction只用于统计, 截断或不规范时不影响宽高和帧率, 忽略错误
+	parseVuiHrdAndRestriction(sps, r)
 	return
 }
 
@@ -1033,7 +1038,36 @@ type CodecData struct {
 	SPSInfo    SPSInfo
 	PPSInfo    PPSInfo
 
+	// Deprecated: 使用SequenceHeaderTag/SetSequenceHeaderTag, 该字段只为兼容保留, 由SetSequenceHeaderTag同步写入
 	SequnceHeaderTag interface{}
+	seqHdrTag        *flvio.Tag
+
+	// activeSPS/activePPS 当前生效的参数集在RecordInfo.SPS/PPS中的下标, 见Activate
+	activeSPS, activePPS int
+
+	// fpsEstimator SPS没有timing_info时的帧率估计, 见WithFPSEstimator
+	fpsEstimator *av.FPSEstimator
+}
+
+// WithFPSEstimator 挂载帧率估计, SPS不带帧率时FPS()和PacketDuration()使用其估计值
+func (self CodecData) WithFPSEstimator(e *av.FPSEstimator) av.CodecData {
+	self.fpsEstimator = e
+	return self
+}
+
+// SequenceHeaderTag 推流端的sequence header tag, 未设置时ok为false
+func (self CodecData) SequenceHeaderTag() (tag flvio.Tag, ok bool) {
+	if self.seqHdrTag != nil {
+		return *self.seqHdrTag, true
+	}
+	tag, ok = self.SequnceHeaderTag.(flvio.Tag)
+	return
+}
+
+// SetSequenceHeaderTag 保存sequence header tag, 转发时原样写出
+func (self *CodecData) SetSequenceHeaderTag(tag flvio.Tag) {
+	self.seqHdrTag = &tag
+	self.SequnceHeaderTag = tag
 }
 
 func (self CodecData) Type() av.CodecType {
@@ -1044,12 +1078,14 @@ func (self CodecData) AVCDecoderConfRecordBytes() []byte {
 	return self.Record
 }
 
+// SPS 当前生效的SPS, 默认为record中的第一个
 func (self CodecData) SPS() []byte {
-	return self.RecordInfo.SPS[0]
+	return self.RecordInfo.SPS[self.activeSPS]
 }
 
+// PPS 当前生效的PPS, 默认为record中的第一个
 func (self CodecData) PPS() []byte {
-	return self.RecordInfo.PPS[0]
+	return self.RecordInfo.PPS[self.activePPS]
 }
 
 func (self CodecData) Width() int {
@@ -1060,8 +1096,12 @@ func (self CodecData) Height() int {
 	return int(self.SPSInfo.Height)
 }
 
+// FPS SPS中的帧率, 没有timing_info时为FPSEstimator的估计值, 都没有时为0
 func (self CodecData) FPS() int {
-	return int(self.SPSInfo.FPS)
+	if self.SPSInfo.FPS > 0 {
+		return int(self.SPSInfo.FPS)
+	}
+	return self.fpsEstimator.FPS()
 }
 
 func (self CodecData) Resolution() string {
@@ -1073,10 +1113,56 @@ func (self CodecData) Tag() string {
 }
 
 func (self CodecData) Bandwidth() string {
-	return fmt.Sprintf("%v", (int(float64(self.Width())*(float64(1.71)*(30/float64(self.FPS())))))*1000)
+	fps := self.FPS()
+	if fps <= 0 {
+		fps = 30
+	}
+	return fmt.Sprintf("%v", (int(float64(self.Width())*(float64(1.71)*(30/float64(fps)))))*1000)
+}
+
+// ProfileName 返回profile_idc对应的名称
+func ProfileName(profileIdc uint) string {
+	switch profileIdc {
+	case 66:
+		return "Baseline"
+	case 77:
+		return "Main"
+	case 88:
+		return "Extended"
+	case 100:
+		return "High"
+	case 110:
+		return "High 10"
+	case 122:
+		return "High 4:2:2"
+	case 244:
+		return "High 4:4:4"
+	}
+	return fmt.Sprintf("%d", profileIdc)
+}
+
+// Description 编解码参数的可读描述
+func (self CodecData) Description() (desc av.CodecDescription) {
+	desc = av.Describe(self, self.Record)
+	desc.Profile = ProfileName(self.SPSInfo.ProfileIdc)
+	desc.Level = fmt.Sprintf("%.1f", float64(self.SPSInfo.LevelIdc)/10)
+	desc.FPS = self.FPS()
+	return
+}
+
+func (self CodecData) MarshalJSON() ([]byte, error) {
+	return jsoniter.Marshal(self.Description())
+}
+
+// MarshalYAML 与MarshalJSON输出相同的字段
+func (self CodecData) MarshalYAML() (interface{}, error) {
+	return self.Description(), nil
 }
 
 func (self CodecData) PacketDuration(data []byte) time.Duration {
+	if self.SPSInfo.FPS == 0 {
+		return self.fpsEstimator.FrameDuration()
+	}
 	return time.Duration(1000./float64(self.FPS())) * time.Millisecond
 }
 
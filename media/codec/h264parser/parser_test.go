@@ -2,7 +2,12 @@ package h264parser
 
 import (
 	"encoding/hex"
+	"encoding/json"
 	"testing"
+	"time"
+
+	"github.com/bugVanisher/streamer/media/av"
+	"github.com/bugVanisher/streamer/media/container/flv/flvio"
 )
 
 func TestParser(t *testing.T) {
@@ -19,3 +24,83 @@ func TestParser(t *testing.T) {
 	nalus, ok = SplitNALUs(avccFrame)
 	t.Log(ok, len(nalus))
 }
+
+func TestSequenceHeaderTag(t *testing.T) {
+	var c CodecData
+	if _, ok := c.SequenceHeaderTag(); ok {
+		t.Fatal("empty codec data should have no sequence header tag")
+	}
+
+	// 兼容直接写旧字段的调用方
+	c.SequnceHeaderTag = flvio.Tag{Type: flvio.TAG_VIDEO, CodecID: flvio.VIDEO_H264}
+	if tag, ok := c.SequenceHeaderTag(); !ok || tag.CodecID != flvio.VIDEO_H264 {
+		t.Fatalf("legacy tag not returned: %+v %v", tag, ok)
+	}
+
+	c.SetSequenceHeaderTag(flvio.Tag{Type: flvio.TAG_VIDEO, CodecID: flvio.VIDEO_H265})
+	if tag, ok := c.SequenceHeaderTag(); !ok || tag.CodecID != flvio.VIDEO_H265 {
+		t.Fatalf("typed tag not returned: %+v %v", tag, ok)
+	}
+	if tag, ok := c.SequnceHeaderTag.(flvio.Tag); !ok || tag.CodecID != flvio.VIDEO_H265 {
+		t.Fatalf("legacy field not synced: %+v %v", tag, ok)
+	}
+}
+
+func TestFPSEstimatorFallback(t *testing.T) {
+	// SPS没有timing_info
+	var c CodecData
+	if c.FPS() != 0 || c.PacketDuration(nil) != 0 || c.Bandwidth() == "" {
+		t.Fatalf("no fps: %v %v", c.FPS(), c.PacketDuration(nil))
+	}
+	e := av.NewFPSEstimator(av.DefaultFPSWindow)
+	c = c.WithFPSEstimator(e).(CodecData)
+	for i := 0; i < 10; i++ {
+		e.Add(av.MediaTime(time.Duration(i) * 40 * time.Millisecond))
+	}
+	if c.FPS() != 25 || c.PacketDuration(nil) != 40*time.Millisecond {
+		t.Fatalf("estimated: %v %v", c.FPS(), c.PacketDuration(nil))
+	}
+
+	// SPS中的帧率优先
+	c.SPSInfo.FPS = 30
+	if c.FPS() != 30 {
+		t.Fatalf("sps fps: %v", c.FPS())
+	}
+}
+
+func TestDescription(t *testing.T) {
+	pps := []byte{0x68, 0xeb, 0xe3, 0xcb, 0x22, 0xc0}
+	for _, c := range []struct {
+		name string
+		sps  []byte
+		want av.CodecDescription
+	}{
+		// fixed_frame_rate_flag为0, 帧率为time_scale/num_units_in_tick
+		{"high", testHighSPS, av.CodecDescription{Codec: "H264", Profile: "High", Level: "3.0", Width: 640, Height: 360, FPS: 50,
+			Extradata: "0164001effe1001a6764001eacd940a02ff97011000003000100000300320f162d9601000668ebe3cb22c0"}},
+		{"baseline hrd", testSPSWithHRD(), av.CodecDescription{Codec: "H264", Profile: "Baseline", Level: "3.1", Width: 1280, Height: 720, FPS: 25,
+			Extradata: "0142001fffe100226742001ff402802dd080000000800000197000003d0900003d0905ef7c1da088459601000668ebe3cb22c0"}},
+		// 没有timing_info时不输出fps
+		{"no timing", testSPS(0, 80, 45), av.CodecDescription{Codec: "H264", Profile: "Baseline", Level: "3.1", Width: 1280, Height: 720,
+			Extradata: "0142001fffe100096742001fda014016e401000668ebe3cb22c0"}},
+	} {
+		codec, err := NewCodecDataFromSPSAndPPS(c.sps, pps)
+		if err != nil {
+			t.Fatal(c.name, err)
+		}
+		if desc := codec.Description(); desc != c.want {
+			t.Fatalf("%s: %+v", c.name, desc)
+		}
+		b, err := json.Marshal(codec)
+		if err != nil {
+			t.Fatal(c.name, err)
+		}
+		want, _ := json.Marshal(c.want)
+		if string(b) != string(want) {
+			t.Fatalf("%s: json %s", c.name, b)
+		}
+		if y, err := codec.MarshalYAML(); err != nil || y != c.want {
+			t.Fatalf("%s: yaml %+v %v", c.name, y, err)
+		}
+	}
+}
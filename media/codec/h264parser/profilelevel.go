@@ -0,0 +1,109 @@
+package h264parser
+
+import (
+	"fmt"
+)
+
+// ProfileLevel SPS开头的profile_idc、constraint_set0~5_flag(含reserved_zero_2bits)和level_idc,
+// 也是AVCDecoderConfRecord中的AVCProfileIndication、ProfileCompatibility和AVCLevelIndication
+type ProfileLevel struct {
+	Profile     uint8
+	Constraints uint8
+	Level       uint8
+}
+
+func (pl ProfileLevel) String() string {
+	return fmt.Sprintf("%s(%d) level %d.%d constraints 0x%02x", ProfileName(uint(pl.Profile)), pl.Profile, pl.Level/10, pl.Level%10, pl.Constraints)
+}
+
+// CapLevel 返回把level_idc限制为不超过max的改写函数, 用于RewriteRecordProfileLevel.
+// 只改写level, 不改变码流实际的参数, 用于让只按声明的level拒绝播放的播放器接受流
+func CapLevel(max uint8) func(ProfileLevel) ProfileLevel {
+	return func(pl ProfileLevel) ProfileLevel {
+		if pl.Level > max {
+			pl.Level = max
+		}
+		return pl
+	}
+}
+
+// hasChromaInfo 该profile的SPS带chroma_format_idc等字段, 见ParseSPS
+func hasChromaInfo(profile uint8) bool {
+	switch profile {
+	case 100, 110, 122, 244, 44, 83, 86, 118, 128, 138, 139, 134, 135:
+		return true
+	}
+	return false
+}
+
+// SPSProfileLevel 读取SPS NALU(带NALU头)中的profile和level
+func SPSProfileLevel(sps []byte) (pl ProfileLevel, err error) {
+	rbsp := RemoveH264orH265EmulationBytes(sps)
+	if len(rbsp) < 4 || rbsp[0]&0x1f != NALU_SPS {
+		err = fmt.Errorf("h264parser: invalid SPS")
+		return
+	}
+	return ProfileLevel{Profile: rbsp[1], Constraints: rbsp[2], Level: rbsp[3]}, nil
+}
+
+// RewriteSPSProfileLevel 改写SPS NALU中的profile_idc、constraint标志和level_idc, 重新插入防竞争码.
+// 是否带chroma_format_idc等字段不同的两类profile之间不能改写, SPS的语法不同
+func RewriteSPSProfileLevel(sps []byte, pl ProfileLevel) ([]byte, error) {
+	rbsp := RemoveH264orH265EmulationBytes(sps)
+	if len(rbsp) < 4 || rbsp[0]&0x1f != NALU_SPS {
+		return nil, fmt.Errorf("h264parser: invalid SPS")
+	}
+	if hasChromaInfo(rbsp[1]) != hasChromaInfo(pl.Profile) {
+		return nil, fmt.Errorf("h264parser: can not rewrite profile_idc %d to %d, SPS syntax differs", rbsp[1], pl.Profile)
+	}
+	rbsp[1], rbsp[2], rbsp[3] = pl.Profile, pl.Constraints, pl.Level
+	out, _ := AddEmulationPrevention(rbsp)
+	return out, nil
+}
+
+// RewriteRecordProfileLevel 用fn改写AVCDecoderConfRecord头部和其中每个SPS的profile和level, 返回新的record.
+// record中SPS之后的扩展字段(High profile的chroma_format等)原样保留
+func RewriteRecordProfileLevel(record []byte, fn func(ProfileLevel) ProfileLevel) ([]byte, error) {
+	var info AVCDecoderConfRecord
+	n, err := info.Unmarshal(record)
+	if err != nil {
+		return nil, err
+	}
+	next := info
+	next.SPS = make([][]byte, len(info.SPS))
+	for i, sps := range info.SPS {
+		pl, err := SPSProfileLevel(sps)
+		if err != nil {
+			return nil, err
+		}
+		if next.SPS[i], err = RewriteSPSProfileLevel(sps, fn(pl)); err != nil {
+			return nil, err
+		}
+	}
+	pl := fn(ProfileLevel{Profile: info.AVCProfileIndication, Constraints: info.ProfileCompatibility, Level: info.AVCLevelIndication})
+	if hasChromaInfo(info.AVCProfileIndication) != hasChromaInfo(pl.Profile) {
+		return nil, fmt.Errorf("h264parser: can not rewrite AVCProfileIndication %d to %d", info.AVCProfileIndication, pl.Profile)
+	}
+	next.AVCProfileIndication, next.ProfileCompatibility, next.AVCLevelIndication = pl.Profile, pl.Constraints, pl.Level
+
+	out := make([]byte, next.Len(), next.Len()+len(record)-n)
+	next.Marshal(out)
+	return append(out, record[n:]...), nil
+}
+
+// RewriteProfileLevel 用fn改写record和SPS中的profile和level, 返回新的CodecData, 生效的参数集不变.
+// sequence header tag需要调用方按新的Record重新设置
+func (self CodecData) RewriteProfileLevel(fn func(ProfileLevel) ProfileLevel) (next CodecData, err error) {
+	record, err := RewriteRecordProfileLevel(self.Record, fn)
+	if err != nil {
+		return
+	}
+	if next, err = NewCodecDataFromAVCDecoderConfRecord(record); err != nil {
+		return
+	}
+	if len(next.RecordInfo.SPS)+len(next.RecordInfo.PPS) > 2 {
+		next.Activate(self.PPSInfo.PicParameterSetID)
+	}
+	next.fpsEstimator = self.fpsEstimator
+	return
+}
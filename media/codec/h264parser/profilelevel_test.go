@@ -0,0 +1,98 @@
+package h264parser
+
+import (
+	"bytes"
+	"testing"
+)
+
+var testHighSPS = []byte{0x67, 0x64, 0x00, 0x1e, 0xac, 0xd9, 0x40, 0xa0, 0x2f, 0xf9, 0x70, 0x11, 0x00, 0x00, 0x03,
+	0x00, 0x01, 0x00, 0x00, 0x03, 0x00, 0x32, 0x0f, 0x16, 0x2d, 0x96}
+
+func TestRewriteSPSProfileLevel(t *testing.T) {
+	pl, err := SPSProfileLevel(testHighSPS)
+	if err != nil || pl != (ProfileLevel{Profile: 100, Level: 30}) {
+		t.Fatalf("profile level %v %v", pl, err)
+	}
+	before, _ := ParseSPS(testHighSPS)
+
+	pl.Level, pl.Constraints = 31, 0x0c
+	sps, err := RewriteSPSProfileLevel(testHighSPS, pl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	after, err := ParseSPS(sps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.LevelIdc != 31 || after.ConstraintSetFlag[4] != 1 || after.ConstraintSetFlag[5] != 1 {
+		t.Fatalf("level %d constraints %v", after.LevelIdc, after.ConstraintSetFlag)
+	}
+	if after.Width != before.Width || after.Height != before.Height || after.FPS != before.FPS {
+		t.Fatalf("sps changed: %+v", after)
+	}
+
+	// 不同语法的profile之间不能改写
+	if _, err = RewriteSPSProfileLevel(testHighSPS, ProfileLevel{Profile: 66, Level: 30}); err == nil {
+		t.Fatal("high to baseline should fail")
+	}
+
+	// level_idc为0时需要插入防竞争码, 改回去后去掉
+	escaped := []byte{0x67, 0x42, 0x00, 0x00, 0x03, 0x01, 0x80}
+	if pl, err = SPSProfileLevel(escaped); err != nil || pl.Level != 0 {
+		t.Fatalf("escaped %v %v", pl, err)
+	}
+	pl.Level = 30
+	if sps, err = RewriteSPSProfileLevel(escaped, pl); err != nil || !bytes.Equal(sps, []byte{0x67, 0x42, 0x00, 0x1e, 0x01, 0x80}) {
+		t.Fatalf("unescaped %x %v", sps, err)
+	}
+	pl.Level = 0
+	if sps, err = RewriteSPSProfileLevel(sps, pl); err != nil || !bytes.Equal(sps, escaped) {
+		t.Fatalf("escaped %x %v", sps, err)
+	}
+}
+
+func TestRewriteRecordProfileLevel(t *testing.T) {
+	pps := []byte{0x68, 0xeb, 0xe3, 0xcb, 0x22, 0xc0}
+	c, err := NewCodecDataFromSPSAndPPS(testHighSPS, pps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// High profile record的扩展字段
+	ext := []byte{0xfd, 0xf8, 0xf8, 0x00}
+	record := append(append([]byte{}, c.Record...), ext...)
+
+	out, err := RewriteRecordProfileLevel(record, CapLevel(21))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out[3] != 21 || !bytes.HasSuffix(out, ext) {
+		t.Fatalf("record %x", out)
+	}
+	next, err := NewCodecDataFromAVCDecoderConfRecord(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next.SPSInfo.LevelIdc != 21 || next.Width() != c.Width() {
+		t.Fatalf("level %d width %d", next.SPSInfo.LevelIdc, next.Width())
+	}
+
+	// 没有超过上限时不改变
+	if out, err = RewriteRecordProfileLevel(record, CapLevel(40)); err != nil || !bytes.Equal(out, record) {
+		t.Fatalf("record changed %x %v", out, err)
+	}
+
+	if next, err = c.RewriteProfileLevel(CapLevel(21)); err != nil || next.SPSInfo.LevelIdc != 21 || next.RecordInfo.AVCLevelIndication != 21 {
+		t.Fatalf("codec data %v %v", next.SPSInfo.LevelIdc, err)
+	}
+}
+
+func TestAddEmulationPrevention(t *testing.T) {
+	rbsp := []byte{0x67, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01}
+	out, n := AddEmulationPrevention(rbsp)
+	if n != 3 || !bytes.Equal(out, []byte{0x67, 0x00, 0x00, 0x03, 0x00, 0x00, 0x03, 0x00, 0x00, 0x03, 0x01}) {
+		t.Fatalf("%x %d", out, n)
+	}
+	if !bytes.Equal(RemoveH264orH265EmulationBytes(out), rbsp) {
+		t.Fatal("round trip")
+	}
+}
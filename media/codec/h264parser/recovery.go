@@ -0,0 +1,54 @@
+package h264parser
+
+import (
+	"bytes"
+
+	"github.com/bugVanisher/streamer/utils/bits"
+)
+
+// RecoveryPoint recovery_point SEI, 见H.264 D.1.7. open GOP的编码器用它代替IDR标记随机访问点
+type RecoveryPoint struct {
+	RecoveryFrameCnt      uint // 从该帧开始解码, 输出顺序上再经过多少帧画面完全正确
+	ExactMatch            bool
+	BrokenLink            bool
+	ChangingSliceGroupIdc uint
+}
+
+// ParseRecoveryPoint 解析recovery_point的payload
+func ParseRecoveryPoint(payload []byte) (rp RecoveryPoint, err error) {
+	r := &bits.GolombBitReader{R: bytes.NewReader(payload)}
+	if rp.RecoveryFrameCnt, err = r.ReadExponentialGolombCode(); err != nil {
+		return
+	}
+	var flag uint
+	if flag, err = r.ReadBit(); err != nil {
+		return
+	}
+	rp.ExactMatch = flag == 1
+	if flag, err = r.ReadBit(); err != nil {
+		return
+	}
+	rp.BrokenLink = flag == 1
+	rp.ChangingSliceGroupIdc, err = r.ReadBits(2)
+	return
+}
+
+// FindRecoveryPoint 查找帧数据(AVCC或Annex-B)中的recovery_point SEI
+func FindRecoveryPoint(frame []byte) (rp RecoveryPoint, ok bool) {
+	nalus, _ := SplitNALUs(frame)
+	for _, nalu := range nalus {
+		if len(nalu) == 0 || !IsSeiNALU(nalu[0]) {
+			continue
+		}
+		msgs, _ := SEIMessages(nalu)
+		for _, msg := range msgs {
+			if msg.PayloadType != SEI_RECOVERY_POINT {
+				continue
+			}
+			if rp, err := ParseRecoveryPoint(msg.Payload); err == nil {
+				return rp, true
+			}
+		}
+	}
+	return
+}
@@ -0,0 +1,28 @@
+package h264parser
+
+import (
+	"testing"
+)
+
+func TestFindRecoveryPoint(t *testing.T) {
+	// recovery_frame_cnt=3, exact_match_flag=0, broken_link_flag=1, changing_slice_group_idc=0
+	sei := MarshalSEINALU(SEI_RECOVERY_POINT, []byte{0x22, 0x00})
+	frame := testAVCC(sei, []byte{0x41, 0x9a, 0x00})
+	rp, ok := FindRecoveryPoint(frame)
+	if !ok {
+		t.Fatal("recovery point not found")
+	}
+	if rp != (RecoveryPoint{RecoveryFrameCnt: 3, BrokenLink: true}) {
+		t.Fatalf("unexpected recovery point %+v", rp)
+	}
+
+	// recovery_frame_cnt=0, exact_match_flag=1
+	rp, ok = FindRecoveryPoint(testAVCC(MarshalSEINALU(SEI_RECOVERY_POINT, []byte{0xc0})))
+	if !ok || rp != (RecoveryPoint{ExactMatch: true}) {
+		t.Fatalf("unexpected recovery point %+v %v", rp, ok)
+	}
+
+	if _, ok = FindRecoveryPoint(testAVCC(UserDataUnregisteredSEI(SendTimeUUID, nil))); ok {
+		t.Fatal("unexpected recovery point in user data sei")
+	}
+}
@@ -0,0 +1,394 @@
+package h264parser
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bugVanisher/streamer/media/av"
+	"github.com/bugVanisher/streamer/utils/bits"
+)
+
+// SEI payloadType, 见H.264 Annex D.1
+const (
+	SEI_BUFFERING_PERIOD              = 0
+	SEI_PIC_TIMING                    = 1
+	SEI_USER_DATA_REGISTERED_ITU_T_35 = 4
+	SEI_USER_DATA_UNREGISTERED        = 5
+	SEI_RECOVERY_POINT                = 6
+)
+
+var ErrSEIInvalid = errors.New("h264parser: sei invalid")
+
+// SEIMessages 解析一个SEI NALU(带NALU头)中的所有SEI消息, 一个NALU可以有多条消息
+func SEIMessages(nalu []byte) (msgs []av.SEIMessage, err error) {
+	if len(nalu) < 2 || !IsSeiNALU(nalu[0]) {
+		err = ErrSEIInvalid
+		return
+	}
+	rbsp := RemoveH264orH265EmulationBytes(nalu[1:])
+	for pos := 0; pos < len(rbsp); {
+		// rbsp_trailing_bits
+		if rbsp[pos] == 0x80 && pos == len(rbsp)-1 {
+			break
+		}
+		var msg av.SEIMessage
+		var size uint
+		if msg.PayloadType, pos, err = readSEIValue(rbsp, pos); err != nil {
+			return
+		}
+		if size, pos, err = readSEIValue(rbsp, pos); err != nil {
+			return
+		}
+		if uint(len(rbsp)-pos) < size {
+			err = fmt.Errorf("h264parser: sei payload type %d size %d exceeds nalu", msg.PayloadType, size)
+			return
+		}
+		msg.Payload = rbsp[pos : pos+int(size)]
+		pos += int(size)
+		msgs = append(msgs, msg)
+	}
+	return
+}
+
+// readSEIValue 读取以0xff累加编码的payloadType/payloadSize
+func readSEIValue(b []byte, pos int) (v uint, next int, err error) {
+	for {
+		if pos >= len(b) {
+			err = ErrSEIInvalid
+			return
+		}
+		v += uint(b[pos])
+		pos++
+		if b[pos-1] != 0xff {
+			return v, pos, nil
+		}
+	}
+}
+
+// SEITimingParams 解析buffering_period和pic_timing所需的SPS VUI/HRD参数
+type SEITimingParams struct {
+	NalHrdParametersPresent      bool
+	VclHrdParametersPresent      bool
+	CpbCnt                       int  // cpb_cnt_minus1 + 1
+	InitialCpbRemovalDelayLength uint // initial_cpb_removal_delay_length_minus1 + 1
+	CpbRemovalDelayLength        uint // cpb_removal_delay_length_minus1 + 1
+	DpbOutputDelayLength         uint // dpb_output_delay_length_minus1 + 1
+	TimeOffsetLength             uint
+	PicStructPresent             bool
+}
+
+// CpbDpbDelaysPresent pic_timing中是否有cpb_removal_delay和dpb_output_delay
+func (self SEITimingParams) CpbDpbDelaysPresent() bool {
+	return self.NalHrdParametersPresent || self.VclHrdParametersPresent
+}
+
+// BufferingPeriod buffering_period SEI
+type BufferingPeriod struct {
+	SeqParameterSetID uint
+	// 每个CPB的initial_cpb_removal_delay和initial_cpb_removal_delay_offset, 单位90kHz
+	NalInitialCpbRemovalDelay       []uint
+	NalInitialCpbRemovalDelayOffset []uint
+	VclInitialCpbRemovalDelay       []uint
+	VclInitialCpbRemovalDelayOffset []uint
+}
+
+// ParseBufferingPeriod 解析buffering_period的payload
+func ParseBufferingPeriod(payload []byte, params SEITimingParams) (bp BufferingPeriod, err error) {
+	r := &bits.GolombBitReader{R: bytes.NewReader(payload)}
+	if bp.SeqParameterSetID, err = r.ReadExponentialGolombCode(); err != nil {
+		return
+	}
+	readDelays := func(delays, offsets *[]uint) error {
+		for i := 0; i < params.CpbCnt; i++ {
+			d, err := r.ReadBits(int(params.InitialCpbRemovalDelayLength))
+			if err != nil {
+				return err
+			}
+			o, err := r.ReadBits(int(params.InitialCpbRemovalDelayLength))
+			if err != nil {
+				return err
+			}
+			*delays = append(*delays, d)
+			*offsets = append(*offsets, o)
+		}
+		return nil
+	}
+	if params.NalHrdParametersPresent {
+		if err = readDelays(&bp.NalInitialCpbRemovalDelay, &bp.NalInitialCpbRemovalDelayOffset); err != nil {
+			return
+		}
+	}
+	if params.VclHrdParametersPresent {
+		if err = readDelays(&bp.VclInitialCpbRemovalDelay, &bp.VclInitialCpbRemovalDelayOffset); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// ClockTimestamp pic_timing中的一个时间码
+type ClockTimestamp struct {
+	CtType             uint
+	NuitFieldBasedFlag uint
+	CountingType       uint
+	FullTimestampFlag  uint
+	DiscontinuityFlag  uint
+	CntDroppedFlag     uint
+	NFrames            uint
+	Seconds            uint
+	Minutes            uint
+	Hours              uint
+	TimeOffset         int
+}
+
+// Timecode HH:MM:SS:FF格式的时间码, drop frame时最后的分隔符为';'
+func (self ClockTimestamp) Timecode() string {
+	sep := ":"
+	if self.CntDroppedFlag == 1 {
+		sep = ";"
+	}
+	return fmt.Sprintf("%02d:%02d:%02d%s%02d", self.Hours, self.Minutes, self.Seconds, sep, self.NFrames)
+}
+
+// PicTiming pic_timing SEI
+type PicTiming struct {
+	CpbRemovalDelay uint
+	DpbOutputDelay  uint
+	PicStruct       uint
+	ClockTimestamps []ClockTimestamp
+}
+
+// numClockTS 每种pic_struct对应的时间码个数, 见Table D-1
+var numClockTS = [9]int{1, 1, 1, 2, 2, 3, 3, 2, 3}
+
+// ParsePicTiming 解析pic_timing的payload
+func ParsePicTiming(payload []byte, params SEITimingParams) (pt PicTiming, err error) {
+	r := &bits.GolombBitReader{R: bytes.NewReader(payload)}
+	if params.CpbDpbDelaysPresent() {
+		if pt.CpbRemovalDelay, err = r.ReadBits(int(params.CpbRemovalDelayLength)); err != nil {
+			return
+		}
+		if pt.DpbOutputDelay, err = r.ReadBits(int(params.DpbOutputDelayLength)); err != nil {
+			return
+		}
+	}
+	if !params.PicStructPresent {
+		return
+	}
+	if pt.PicStruct, err = r.ReadBits(4); err != nil {
+		return
+	}
+	if int(pt.PicStruct) >= len(numClockTS) {
+		err = fmt.Errorf("h264parser: invalid pic_struct %d", pt.PicStruct)
+		return
+	}
+	for i := 0; i < numClockTS[pt.PicStruct]; i++ {
+		var flag uint
+		if flag, err = r.ReadBit(); err != nil {
+			return
+		}
+		if flag == 0 {
+			continue
+		}
+		var ts ClockTimestamp
+		if ts, err = readClockTimestamp(r, params.TimeOffsetLength); err != nil {
+			return
+		}
+		pt.ClockTimestamps = append(pt.ClockTimestamps, ts)
+	}
+	return
+}
+
+func readClockTimestamp(r *bits.GolombBitReader, timeOffsetLength uint) (ts ClockTimestamp, err error) {
+	fields := []struct {
+		v *uint
+		n int
+	}{
+		{&ts.CtType, 2}, {&ts.NuitFieldBasedFlag, 1}, {&ts.CountingType, 5}, {&ts.FullTimestampFlag, 1},
+		{&ts.DiscontinuityFlag, 1}, {&ts.CntDroppedFlag, 1}, {&ts.NFrames, 8},
+	}
+	for _, f := range fields {
+		if *f.v, err = r.ReadBits(f.n); err != nil {
+			return
+		}
+	}
+	if ts.FullTimestampFlag == 1 {
+		if ts.Seconds, err = r.ReadBits(6); err != nil {
+			return
+		}
+		if ts.Minutes, err = r.ReadBits(6); err != nil {
+			return
+		}
+		if ts.Hours, err = r.ReadBits(5); err != nil {
+			return
+		}
+	} else {
+		// seconds_flag { seconds minutes_flag { minutes hours_flag { hours } } }
+		values := []struct {
+			v *uint
+			n int
+		}{{&ts.Seconds, 6}, {&ts.Minutes, 6}, {&ts.Hours, 5}}
+		for _, f := range values {
+			var flag uint
+			if flag, err = r.ReadBit(); err != nil || flag == 0 {
+				break
+			}
+			if *f.v, err = r.ReadBits(f.n); err != nil {
+				return
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+	if timeOffsetLength > 0 {
+		var v uint
+		if v, err = r.ReadBits(int(timeOffsetLength)); err != nil {
+			return
+		}
+		// time_offset为有符号数i(v)
+		ts.TimeOffset = int(v)
+		if v&(1<<(timeOffsetLength-1)) != 0 {
+			ts.TimeOffset -= 1 << timeOffsetLength
+		}
+	}
+	return
+}
+
+// ATSC A/53的user_data_registered_itu_t_t35标识
+const (
+	t35CountryCodeUSA   = 0xb5
+	t35ProviderCodeATSC = 0x0031
+	atscUserDataTypeCC  = 0x03
+)
+
+var atscUserIdentifier = []byte("GA94")
+
+// ParseCaptions 从user_data_registered_itu_t_t35的payload中取出ATSC A/53的cc_data,
+// 不是字幕数据时返回ok为false
+func ParseCaptions(payload []byte) (cc []av.CaptionData, ok bool) {
+	// itu_t_t35_country_code(8) itu_t_t35_provider_code(16) user_identifier(32) user_data_type_code(8)
+	if len(payload) < 10 || payload[0] != t35CountryCodeUSA ||
+		int(payload[1])<<8|int(payload[2]) != t35ProviderCodeATSC ||
+		!bytes.Equal(payload[3:7], atscUserIdentifier) || payload[7] != atscUserDataTypeCC {
+		return
+	}
+	// process_em_data_flag(1) process_cc_data_flag(1) additional_data_flag(1) cc_count(5), em_data(8)
+	if payload[8]&0x40 == 0 {
+		return nil, true
+	}
+	count := int(payload[8] & 0x1f)
+	data := payload[10:]
+	for i := 0; i < count && len(data) >= 3; i++ {
+		// marker_bits(5) cc_valid(1) cc_type(2) cc_data_1(8) cc_data_2(8)
+		if data[0]&0x04 != 0 {
+			cc = append(cc, av.CaptionData{Type: data[0] & 0x03, Data1: data[1], Data2: data[2]})
+		}
+		data = data[3:]
+	}
+	return cc, true
+}
+
+// ParseSEIFromNALUs 取出AVCC格式帧数据中所有SEI NALU的消息和字幕
+func ParseSEIFromNALUs(data []byte) (msgs []av.SEIMessage, cc []av.CaptionData) {
+	nalus, _ := SplitNALUs(data)
+	for _, nalu := range nalus {
+		if len(nalu) == 0 || !IsSeiNALU(nalu[0]) {
+			continue
+		}
+		m, _ := SEIMessages(nalu)
+		for _, msg := range m {
+			if msg.PayloadType == SEI_USER_DATA_REGISTERED_ITU_T_35 {
+				if c, ok := ParseCaptions(msg.Payload); ok {
+					cc = append(cc, c...)
+				}
+			}
+		}
+		msgs = append(msgs, m...)
+	}
+	return
+}
+
+// SendTimeUUID 推流端发送时间SEI的uuid_iso_iec_11578, 数据为8字节大端的unix纳秒, 用于测量端到端延迟
+var SendTimeUUID = [16]byte{0x73, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x65, 0x72, 0x2d, 0x73, 0x65, 0x6e, 0x64, 0x74, 0x69, 0x6d}
+
+// MarshalSEINALU 把一条SEI消息封装为SEI NALU, 加上rbsp_trailing_bits和防竞争码
+func MarshalSEINALU(payloadType uint, payload []byte) []byte {
+	rbsp := make([]byte, 0, len(payload)+8)
+	rbsp = appendSEIValue(rbsp, payloadType)
+	rbsp = appendSEIValue(rbsp, uint(len(payload)))
+	rbsp = append(rbsp, payload...)
+	rbsp = append(rbsp, 0x80)
+
+	nalu := make([]byte, 0, len(rbsp)+len(rbsp)/32+1)
+	nalu = append(nalu, NALU_SEI)
+	zeros := 0
+	for _, b := range rbsp {
+		if zeros == 2 && b <= 3 {
+			nalu = append(nalu, 0x03)
+			zeros = 0
+		}
+		nalu = append(nalu, b)
+		if b == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+	}
+	return nalu
+}
+
+func appendSEIValue(b []byte, v uint) []byte {
+	for ; v >= 0xff; v -= 0xff {
+		b = append(b, 0xff)
+	}
+	return append(b, byte(v))
+}
+
+// UserDataUnregisteredSEI 创建user_data_unregistered的SEI NALU
+func UserDataUnregisteredSEI(uuid [16]byte, data []byte) []byte {
+	return MarshalSEINALU(SEI_USER_DATA_UNREGISTERED, append(uuid[:], data...))
+}
+
+// SendTimeSEI 创建携带发送时间t的SEI NALU
+func SendTimeSEI(t time.Time) []byte {
+	var data [8]byte
+	binary.BigEndian.PutUint64(data[:], uint64(t.UnixNano()))
+	return UserDataUnregisteredSEI(SendTimeUUID, data[:])
+}
+
+// ParseSendTime 从SendTimeSEI创建的消息中取出发送时间
+func ParseSendTime(msg av.SEIMessage) (t time.Time, ok bool) {
+	if msg.PayloadType != SEI_USER_DATA_UNREGISTERED || len(msg.Payload) != 24 || !bytes.Equal(msg.Payload[:16], SendTimeUUID[:]) {
+		return
+	}
+	return time.Unix(0, int64(binary.BigEndian.Uint64(msg.Payload[16:]))), true
+}
+
+// InsertSEI 在AVCC格式帧数据的第一个VCL NALU之前(AUD/SPS/PPS之后)插入SEI NALU, 返回新的帧数据, 不修改frame.
+// frame不是AVCC格式时ok为false
+func InsertSEI(frame []byte, sei []byte) (out []byte, ok bool) {
+	if _, typ := SplitNALUs(frame); typ != NALU_AVCC {
+		return frame, false
+	}
+	pos := 0
+	for pos+4 < len(frame) {
+		size := int(binary.BigEndian.Uint32(frame[pos:]))
+		if typ := frame[pos+4] & 0x1f; typ >= 1 && typ <= 5 {
+			break
+		}
+		pos += 4 + size
+	}
+	if pos > len(frame) {
+		pos = len(frame)
+	}
+	out = make([]byte, 0, len(frame)+4+len(sei))
+	out = append(out, frame[:pos]...)
+	out = append(out, byte(len(sei)>>24), byte(len(sei)>>16), byte(len(sei)>>8), byte(len(sei)))
+	out = append(out, sei...)
+	out = append(out, frame[pos:]...)
+	return out, true
+}
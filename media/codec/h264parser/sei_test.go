@@ -0,0 +1,162 @@
+package h264parser
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+type bitWriter struct {
+	buf  []byte
+	nbit int
+}
+
+func (w *bitWriter) write(v uint64, n int) {
+	for i := n - 1; i >= 0; i-- {
+		if w.nbit%8 == 0 {
+			w.buf = append(w.buf, 0)
+		}
+		if v>>uint(i)&1 != 0 {
+			w.buf[len(w.buf)-1] |= 0x80 >> uint(w.nbit%8)
+		}
+		w.nbit++
+	}
+}
+
+// testSEINALU 把多条消息打包成SEI NALU, 并加上防竞争码
+func testSEINALU(msgs ...[]byte) []byte {
+	var rbsp []byte
+	for i := 0; i+1 < len(msgs); i += 2 {
+		rbsp = append(rbsp, msgs[i][0], byte(len(msgs[i+1])))
+		rbsp = append(rbsp, msgs[i+1]...)
+	}
+	rbsp = append(rbsp, 0x80)
+	nalu := []byte{NALU_SEI}
+	zeros := 0
+	for _, b := range rbsp {
+		if zeros == 2 && b <= 3 {
+			nalu = append(nalu, 0x03)
+			zeros = 0
+		}
+		nalu = append(nalu, b)
+		if b == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+	}
+	return nalu
+}
+
+func TestSEIMessages(t *testing.T) {
+	captions := []byte{0xb5, 0x00, 0x31, 'G', 'A', '9', '4', 0x03, 0x42, 0xff,
+		0xfc, 0x94, 0x2c, // CEA-608 field 1
+		0xfa, 0x00, 0x00, // cc_valid为0
+		0xff}
+
+	// pic_struct=0, 一个完整时间码07:56:34:12
+	w := &bitWriter{}
+	w.write(0, 4)  // pic_struct
+	w.write(1, 1)  // clock_timestamp_flag
+	w.write(0, 2)  // ct_type
+	w.write(0, 1)  // nuit_field_based_flag
+	w.write(0, 5)  // counting_type
+	w.write(1, 1)  // full_timestamp_flag
+	w.write(0, 1)  // discontinuity_flag
+	w.write(0, 1)  // cnt_dropped_flag
+	w.write(12, 8) // n_frames
+	w.write(34, 6) // seconds
+	w.write(56, 6) // minutes
+	w.write(7, 5)  // hours
+	picTiming := w.buf
+
+	unregistered := append(make([]byte, 16), 0x01, 0x02)
+
+	nalu := testSEINALU([]byte{SEI_USER_DATA_REGISTERED_ITU_T_35}, captions,
+		[]byte{SEI_PIC_TIMING}, picTiming, []byte{SEI_USER_DATA_UNREGISTERED}, unregistered)
+	msgs, err := SEIMessages(nalu)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 3 || msgs[0].PayloadType != SEI_USER_DATA_REGISTERED_ITU_T_35 || msgs[1].PayloadType != SEI_PIC_TIMING {
+		t.Fatalf("unexpected messages %+v", msgs)
+	}
+	if !bytes.Equal(msgs[2].Payload, unregistered) {
+		t.Fatalf("emulation prevention not removed: % x", msgs[2].Payload)
+	}
+
+	cc, ok := ParseCaptions(msgs[0].Payload)
+	if !ok || len(cc) != 1 || cc[0].Type != 0 || cc[0].Data1 != 0x94 || cc[0].Data2 != 0x2c {
+		t.Fatalf("unexpected captions %+v ok=%v", cc, ok)
+	}
+	if _, ok = ParseCaptions(unregistered); ok {
+		t.Fatal("unregistered payload is not captions")
+	}
+
+	pt, err := ParsePicTiming(msgs[1].Payload, SEITimingParams{PicStructPresent: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pt.ClockTimestamps) != 1 || pt.ClockTimestamps[0].Timecode() != "07:56:34:12" {
+		t.Fatalf("unexpected pic timing %+v", pt)
+	}
+
+	// 第一个NALU长度前缀的AVCC帧
+	frame := append([]byte{0, 0, 0, byte(len(nalu))}, nalu...)
+	frame = append(frame, 0, 0, 0, 2, 0x65, 0x88)
+	all, frameCC := ParseSEIFromNALUs(frame)
+	if len(all) != 3 || len(frameCC) != 1 {
+		t.Fatalf("got %d messages %d captions", len(all), len(frameCC))
+	}
+
+	if _, err = SEIMessages(nalu[:len(nalu)-5]); err == nil {
+		t.Fatal("expected error for truncated sei")
+	}
+}
+
+func TestParseBufferingPeriod(t *testing.T) {
+	params := SEITimingParams{NalHrdParametersPresent: true, CpbCnt: 1, InitialCpbRemovalDelayLength: 24}
+	w := &bitWriter{}
+	w.write(1, 1)      // seq_parameter_set_id=0, ue(v)
+	w.write(90000, 24) // initial_cpb_removal_delay
+	w.write(4500, 24)  // initial_cpb_removal_delay_offset
+	bp, err := ParseBufferingPeriod(w.buf, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bp.SeqParameterSetID != 0 || len(bp.NalInitialCpbRemovalDelay) != 1 || bp.NalInitialCpbRemovalDelay[0] != 90000 || bp.NalInitialCpbRemovalDelayOffset[0] != 4500 {
+		t.Fatalf("unexpected buffering period %+v", bp)
+	}
+}
+
+func TestInsertSEI(t *testing.T) {
+	now := time.Unix(1700000000, 123)
+	sei := SendTimeSEI(now)
+	msgs, err := SEIMessages(sei)
+	if err != nil || len(msgs) != 1 {
+		t.Fatalf("marshaled sei: %v, %d messages", err, len(msgs))
+	}
+	if got, ok := ParseSendTime(msgs[0]); !ok || !got.Equal(now) {
+		t.Fatalf("send time %v ok=%v", got, ok)
+	}
+
+	// 大payload的payloadSize用0xff累加编码, 全0数据需要防竞争码
+	big := make([]byte, 300)
+	if msgs, err = SEIMessages(UserDataUnregisteredSEI(SendTimeUUID, big)); err != nil || len(msgs) != 1 || len(msgs[0].Payload) != 316 {
+		t.Fatalf("big sei: %v %+v", err, msgs)
+	}
+
+	// SPS, PPS, IDR: SEI插在IDR之前
+	frame := []byte{0, 0, 0, 2, 0x67, 0x42, 0, 0, 0, 2, 0x68, 0xce, 0, 0, 0, 2, 0x65, 0x88}
+	out, ok := InsertSEI(frame, sei)
+	if !ok {
+		t.Fatal("insert failed")
+	}
+	nalus, _ := SplitNALUs(out)
+	if len(nalus) != 4 || !IsSeiNALU(nalus[2][0]) || nalus[3][0] != 0x65 || frame[4] != 0x67 {
+		t.Fatalf("unexpected nalus % x", nalus)
+	}
+	if _, ok = InsertSEI([]byte{0x65}, sei); ok {
+		t.Fatal("raw data is not avcc")
+	}
+}
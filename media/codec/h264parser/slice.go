@@ -0,0 +1,245 @@
+package h264parser
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	"github.com/bugVanisher/streamer/utils/bits"
+)
+
+// NALU_IDR_SLICE IDR图像的slice
+const NALU_IDR_SLICE = 5
+
+// sliceHeaderMaxBytes 解析到redundant_pic_cnt为止的slice header不会超过该长度, 只去除这部分的防竞争码
+const sliceHeaderMaxBytes = 64
+
+// SliceHeader slice_header中frame_num和POC相关的字段, 见H.264 7.3.3
+type SliceHeader struct {
+	NalRefIdc   uint
+	NalUnitType uint
+
+	FirstMbInSlice         uint
+	SliceType              SliceType
+	PicParameterSetID      uint
+	ColourPlaneID          uint
+	FrameNum               uint
+	FieldPicFlag           uint
+	BottomFieldFlag        uint
+	IdrPicID               uint
+	PicOrderCntLsb         uint
+	DeltaPicOrderCntBottom int
+	DeltaPicOrderCnt       [2]int
+	RedundantPicCnt        uint
+}
+
+// IsIDR 是否是IDR图像的slice
+func (self SliceHeader) IsIDR() bool {
+	return self.NalUnitType == NALU_IDR_SLICE
+}
+
+// IsReference 是否是参考图像的slice
+func (self SliceHeader) IsReference() bool {
+	return self.NalRefIdc != 0
+}
+
+// readSE se(v), GolombBitReader.ReadSE的负数结果不正确, 这里按有符号数处理
+func readSE(r *bits.GolombBitReader) (v int, err error) {
+	var u uint
+	if u, err = r.ReadExponentialGolombCode(); err != nil {
+		return
+	}
+	if u&0x01 != 0 {
+		return int(u+1) / 2, nil
+	}
+	return -int(u / 2), nil
+}
+
+// ParseSliceHeader 按当前生效的SPS/PPS解析slice header, 得到frame_num、pic_order_cnt_lsb等字段
+func ParseSliceHeader(nalu []byte, sps SPSInfo, pps PPSInfo) (h SliceHeader, err error) {
+	if len(nalu) <= 1 {
+		err = fmt.Errorf("h264parser: packet too short to parse slice header")
+		return
+	}
+	h.NalRefIdc = uint(nalu[0]>>5) & 0x03
+	h.NalUnitType = uint(nalu[0] & 0x1f)
+	switch h.NalUnitType {
+	case 1, 2, 5, 19:
+	default:
+		err = fmt.Errorf("h264parser: nal_unit_type=%d has no slice header", h.NalUnitType)
+		return
+	}
+	data := nalu[1:]
+	if len(data) > sliceHeaderMaxBytes {
+		data = data[:sliceHeaderMaxBytes]
+	}
+	r := &bits.GolombBitReader{R: bytes.NewReader(RemoveH264orH265EmulationBytes(data))}
+
+	if h.FirstMbInSlice, err = r.ReadExponentialGolombCode(); err != nil {
+		return
+	}
+	var u uint
+	if u, err = r.ReadExponentialGolombCode(); err != nil {
+		return
+	}
+	switch u {
+	case 0, 3, 5, 8:
+		h.SliceType = SLICE_P
+	case 1, 6:
+		h.SliceType = SLICE_B
+	case 2, 4, 7, 9:
+		h.SliceType = SLICE_I
+	default:
+		err = fmt.Errorf("h264parser: slice_type=%d invalid", u)
+		return
+	}
+	if h.PicParameterSetID, err = r.ReadExponentialGolombCode(); err != nil {
+		return
+	}
+	if sps.SeparateColourPlaneFlag == 1 {
+		if h.ColourPlaneID, err = r.ReadBits(2); err != nil {
+			return
+		}
+	}
+	if h.FrameNum, err = r.ReadBits(int(sps.Log2MaxFrameNumMinus4 + 4)); err != nil {
+		return
+	}
+	if sps.FrameMbsOnlyFlag == 0 {
+		if h.FieldPicFlag, err = r.ReadBit(); err != nil {
+			return
+		}
+		if h.FieldPicFlag == 1 {
+			if h.BottomFieldFlag, err = r.ReadBit(); err != nil {
+				return
+			}
+		}
+	}
+	if h.IsIDR() {
+		if h.IdrPicID, err = r.ReadExponentialGolombCode(); err != nil {
+			return
+		}
+	}
+	switch sps.PicOrderCntType {
+	case 0:
+		if h.PicOrderCntLsb, err = r.ReadBits(int(sps.Log2MaxPicOrderCntLsbMinus4 + 4)); err != nil {
+			return
+		}
+		if pps.PicOrderPresentFlag == 1 && h.FieldPicFlag == 0 {
+			if h.DeltaPicOrderCntBottom, err = readSE(r); err != nil {
+				return
+			}
+		}
+	case 1:
+		if sps.DeltaPicOrderAlwaysZeroFlag == 0 {
+			if h.DeltaPicOrderCnt[0], err = readSE(r); err != nil {
+				return
+			}
+			if pps.PicOrderPresentFlag == 1 && h.FieldPicFlag == 0 {
+				if h.DeltaPicOrderCnt[1], err = readSE(r); err != nil {
+					return
+				}
+			}
+		}
+	}
+	if pps.RedundantPicCntPresnetFlag == 1 {
+		if h.RedundantPicCnt, err = r.ReadExponentialGolombCode(); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// PictureOrder 按解码顺序输入每帧第一个slice的header, 检测参考帧丢失(frame_num跳变)和
+// POC顺序与显示时间戳不一致的重排序问题. 只支持pic_order_cnt_type为0和2的POC计算
+type PictureOrder struct {
+	SPS SPSInfo
+
+	LostRefFrames uint64 // 根据frame_num跳变估计的丢失参考帧数
+	FrameNumGaps  uint64 // frame_num跳变的次数
+	ReorderErrors uint64 // POC顺序和显示时间戳顺序相反的次数
+
+	started         bool
+	prevRefFrameNum uint
+	prevFrameNum    uint
+	frameNumOffset  int
+	prevPocMsb      int
+	prevPocLsb      int
+	prevPoc         int
+	prevPts         time.Duration
+	hasPrev         bool
+	lastPocOK       bool // 最近一次Add的帧计算出了POC, 值为prevPoc
+}
+
+// MaxFrameNum SPS中frame_num的取值范围
+func (self *PictureOrder) MaxFrameNum() uint {
+	return 1 << (self.SPS.Log2MaxFrameNumMinus4 + 4)
+}
+
+// Add 输入一帧的slice header和显示时间戳pts, 返回这一帧之前丢失的参考帧数
+func (self *PictureOrder) Add(h SliceHeader, pts time.Duration) (lost uint) {
+	maxFrameNum := self.MaxFrameNum()
+	self.lastPocOK = false
+	if h.IsIDR() {
+		self.started = true
+		self.prevRefFrameNum, self.prevFrameNum, self.frameNumOffset = 0, 0, 0
+		self.prevPocMsb, self.prevPocLsb = 0, 0
+		self.hasPrev = false
+	} else if !self.started {
+		// 从IDR开始检测
+		return
+	} else if h.FrameNum != self.prevRefFrameNum && h.FrameNum != (self.prevRefFrameNum+1)%maxFrameNum {
+		if self.SPS.GapsInFrameNumValueAllowedFlag == 0 {
+			lost = (h.FrameNum + maxFrameNum - self.prevRefFrameNum - 1) % maxFrameNum
+			self.FrameNumGaps++
+			self.LostRefFrames += uint64(lost)
+		}
+	}
+
+	if poc, ok := self.picOrderCnt(h, maxFrameNum); ok {
+		if self.hasPrev && (poc > self.prevPoc) != (pts > self.prevPts) && poc != self.prevPoc && pts != self.prevPts {
+			self.ReorderErrors++
+		}
+		self.prevPoc, self.prevPts, self.hasPrev = poc, pts, true
+		self.lastPocOK = true
+	}
+
+	if h.IsReference() {
+		self.prevRefFrameNum = h.FrameNum
+	}
+	self.prevFrameNum = h.FrameNum
+	return
+}
+
+// POC 最近一次Add的帧的POC, 还没有遇到IDR或pic_order_cnt_type不支持时ok为false
+func (self *PictureOrder) POC() (poc int, ok bool) {
+	return self.prevPoc, self.lastPocOK
+}
+
+// picOrderCnt 计算POC, 见H.264 8.2.1.1和8.2.1.3
+func (self *PictureOrder) picOrderCnt(h SliceHeader, maxFrameNum uint) (poc int, ok bool) {
+	switch self.SPS.PicOrderCntType {
+	case 0:
+		maxLsb := 1 << (self.SPS.Log2MaxPicOrderCntLsbMinus4 + 4)
+		lsb := int(h.PicOrderCntLsb)
+		msb := self.prevPocMsb
+		if lsb < self.prevPocLsb && self.prevPocLsb-lsb >= maxLsb/2 {
+			msb += maxLsb
+		} else if lsb > self.prevPocLsb && lsb-self.prevPocLsb > maxLsb/2 {
+			msb -= maxLsb
+		}
+		if h.IsReference() {
+			self.prevPocMsb, self.prevPocLsb = msb, lsb
+		}
+		return msb + lsb, true
+	case 2:
+		if !h.IsIDR() && h.FrameNum < self.prevFrameNum {
+			self.frameNumOffset += int(maxFrameNum)
+		}
+		poc = 2 * (self.frameNumOffset + int(h.FrameNum))
+		if !h.IsReference() {
+			poc--
+		}
+		return poc, true
+	}
+	return
+}
@@ -0,0 +1,110 @@
+package h264parser
+
+import (
+	"testing"
+	"time"
+)
+
+func (w *bitWriter) writeUE(v uint64) {
+	x := v + 1
+	n := 0
+	for t := x; t > 0; t >>= 1 {
+		n++
+	}
+	w.write(0, n-1)
+	w.write(x, n)
+}
+
+// testSliceNALU frame_num 4位, pic_order_cnt_lsb 6位
+func testSliceNALU(idr, ref bool, sliceType, frameNum, pocLsb uint64) []byte {
+	w := &bitWriter{}
+	header := uint64(1)
+	if idr {
+		header = NALU_IDR_SLICE
+	}
+	if ref {
+		header |= 3 << 5
+	}
+	w.write(header, 8)
+	w.writeUE(0)         // first_mb_in_slice
+	w.writeUE(sliceType) // slice_type
+	w.writeUE(0)         // pic_parameter_set_id
+	w.write(frameNum, 4)
+	if idr {
+		w.writeUE(0) // idr_pic_id
+	}
+	w.write(pocLsb, 6)
+	w.write(1, 1) // 后续数据
+	return w.buf
+}
+
+func TestParseSliceHeader(t *testing.T) {
+	sps := SPSInfo{Log2MaxPicOrderCntLsbMinus4: 2, FrameMbsOnlyFlag: 1}
+	h, err := ParseSliceHeader(testSliceNALU(false, false, 1, 9, 35), sps, PPSInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.SliceType != SLICE_B || h.FrameNum != 9 || h.PicOrderCntLsb != 35 || h.IsReference() || h.IsIDR() {
+		t.Fatalf("unexpected slice header %+v", h)
+	}
+	if _, err = ParseSliceHeader([]byte{0x67, 0x42}, sps, PPSInfo{}); err == nil {
+		t.Fatal("sps has no slice header")
+	}
+}
+
+func TestPictureOrder(t *testing.T) {
+	sps := SPSInfo{Log2MaxPicOrderCntLsbMinus4: 2, FrameMbsOnlyFlag: 1}
+	order := &PictureOrder{SPS: sps}
+	ms := func(n int) time.Duration { return time.Duration(n) * time.Millisecond }
+	frames := []struct {
+		idr, ref         bool
+		frameNum, pocLsb uint64
+		pts              time.Duration
+		lost             uint
+	}{
+		{true, true, 0, 0, 0, 0},
+		{false, true, 1, 6, ms(120), 0},
+		{false, false, 2, 2, ms(40), 0},
+		{false, false, 2, 4, ms(80), 0},
+		{false, true, 2, 12, ms(240), 0},
+		{false, true, 5, 18, ms(360), 2}, // frame_num 3和4丢失
+		{false, true, 6, 24, ms(300), 0}, // POC增加但显示时间回退
+		{false, true, 7, 30, ms(420), 0},
+	}
+	for i, f := range frames {
+		typ := uint64(0)
+		if f.idr {
+			typ = 2
+		}
+		h, err := ParseSliceHeader(testSliceNALU(f.idr, f.ref, typ, f.frameNum, f.pocLsb), sps, PPSInfo{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if lost := order.Add(h, f.pts); lost != f.lost {
+			t.Fatalf("frame %d lost %d, want %d", i, lost, f.lost)
+		}
+	}
+	if order.FrameNumGaps != 1 || order.LostRefFrames != 2 || order.ReorderErrors != 1 {
+		t.Fatalf("gaps %d lost %d reorder %d", order.FrameNumGaps, order.LostRefFrames, order.ReorderErrors)
+	}
+
+	// frame_num和pic_order_cnt_lsb回绕: 15之后是0, 60之后是0
+	order = &PictureOrder{SPS: sps}
+	order.Add(SliceHeader{NalUnitType: NALU_IDR_SLICE, NalRefIdc: 3}, 0)
+	for i := uint(1); i <= 17; i++ {
+		order.Add(SliceHeader{NalUnitType: 1, NalRefIdc: 3, FrameNum: i % 16, PicOrderCntLsb: i * 4 % 64}, ms(int(i)*40))
+	}
+	if order.FrameNumGaps != 0 || order.ReorderErrors != 0 {
+		t.Fatalf("wrap: gaps %d reorder %d", order.FrameNumGaps, order.ReorderErrors)
+	}
+	if poc, ok := order.POC(); !ok || poc != 68 {
+		t.Fatalf("wrap: poc %d %v, want 68", poc, ok)
+	}
+
+	// 没有从IDR开始时没有POC
+	order = &PictureOrder{SPS: sps}
+	order.Add(SliceHeader{NalUnitType: 1, NalRefIdc: 3, FrameNum: 1, PicOrderCntLsb: 4}, 0)
+	if _, ok := order.POC(); ok {
+		t.Fatal("poc before idr")
+	}
+}
@@ -0,0 +1,115 @@
+package h264parser
+
+import (
+	"fmt"
+	"strings"
+)
+
+// NALUErrorKind AVCC帧校验失败的类别
+type NALUErrorKind int
+
+const (
+	// NALUZeroLength 长度为0的NALU
+	NALUZeroLength NALUErrorKind = iota + 1
+	// NALUForbiddenBit NALU头的forbidden_zero_bit为1
+	NALUForbiddenBit
+	// NALUTruncated 长度字段超出了帧的剩余数据, 或帧末尾不足一个长度字段
+	NALUTruncated
+)
+
+func (k NALUErrorKind) String() string {
+	switch k {
+	case NALUZeroLength:
+		return "zero-length"
+	case NALUForbiddenBit:
+		return "forbidden-bit"
+	case NALUTruncated:
+		return "truncated"
+	}
+	return fmt.Sprintf("NALUErrorKind(%d)", int(k))
+}
+
+// NALUError 帧中一个不合法的NALU
+type NALUError struct {
+	Kind NALUErrorKind
+	// Index 第几个NALU, Offset 长度字段在帧中的偏移
+	Index, Offset int
+	// Length 长度字段的值, Remain 长度字段之后剩余的字节数
+	Length, Remain int
+}
+
+func (e NALUError) Error() string {
+	switch e.Kind {
+	case NALUTruncated:
+		return fmt.Sprintf("h264parser: nalu #%d at %d truncated, length %d, remain %d", e.Index, e.Offset, e.Length, e.Remain)
+	}
+	return fmt.Sprintf("h264parser: nalu #%d at %d %s", e.Index, e.Offset, e.Kind)
+}
+
+// NALUErrors 一帧的全部校验错误
+type NALUErrors []NALUError
+
+func (errs NALUErrors) Error() string {
+	msgs := make([]string, len(errs))
+	for i, e := range errs {
+		msgs[i] = e.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// ValidateAVCC 严格校验AVCC格式的帧, lengthSize为长度字段的字节数(1, 2或4), 0时按4.
+// H.264和H.265的NALU头最高位都是forbidden_zero_bit, 两者都可以使用. 帧合法时返回nil
+func ValidateAVCC(frame []byte, lengthSize int) (errs NALUErrors) {
+	if lengthSize <= 0 {
+		lengthSize = 4
+	}
+	for i, pos := 0, 0; pos < len(frame); i++ {
+		remain := len(frame) - pos - lengthSize
+		if remain < 0 {
+			errs = append(errs, NALUError{Kind: NALUTruncated, Index: i, Offset: pos, Remain: len(frame) - pos})
+			return
+		}
+		length := 0
+		for _, b := range frame[pos : pos+lengthSize] {
+			length = length<<8 | int(b)
+		}
+		switch {
+		case length > remain:
+			errs = append(errs, NALUError{Kind: NALUTruncated, Index: i, Offset: pos, Length: length, Remain: remain})
+			return
+		case length == 0:
+			errs = append(errs, NALUError{Kind: NALUZeroLength, Index: i, Offset: pos, Remain: remain})
+		case frame[pos+lengthSize]&0x80 != 0:
+			errs = append(errs, NALUError{Kind: NALUForbiddenBit, Index: i, Offset: pos, Length: length, Remain: remain})
+		}
+		pos += lengthSize + length
+	}
+	return
+}
+
+// NALUStats 帧校验的统计
+type NALUStats struct {
+	Frames        int64
+	InvalidFrames int64
+	ZeroLength    int64
+	ForbiddenBit  int64
+	Truncated     int64
+}
+
+// Add 计入一帧的校验结果
+func (self *NALUStats) Add(errs NALUErrors) {
+	self.Frames++
+	if len(errs) > 0 {
+		self.InvalidFrames++
+	}
+	for _, e := range errs {
+		switch e.Kind {
+		case NALUZeroLength:
+			self.ZeroLength++
+		case NALUForbiddenBit:
+			self.ForbiddenBit++
+		case NALUTruncated:
+			self.Truncated++
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package h264parser
+
+import (
+	"testing"
+)
+
+func TestValidateAVCC(t *testing.T) {
+	cases := []struct {
+		name  string
+		frame []byte
+		size  int
+		want  []NALUErrorKind
+	}{
+		{"valid", []byte{0, 0, 0, 2, 0x65, 0x88, 0, 0, 0, 1, 0x41}, 4, nil},
+		{"valid 2-byte length", []byte{0, 2, 0x65, 0x88, 0, 1, 0x41}, 2, nil},
+		{"zero length", []byte{0, 0, 0, 0, 0, 0, 0, 1, 0x41}, 4, []NALUErrorKind{NALUZeroLength}},
+		{"forbidden bit", []byte{0, 0, 0, 1, 0xe5, 0, 0, 0, 1, 0x41}, 4, []NALUErrorKind{NALUForbiddenBit}},
+		{"truncated length", []byte{0, 0, 0, 9, 0x65, 0x88}, 4, []NALUErrorKind{NALUTruncated}},
+		{"trailing bytes", []byte{0, 0, 0, 1, 0x65, 0, 0}, 4, []NALUErrorKind{NALUTruncated}},
+		{"mixed", []byte{0, 0, 0, 0, 0, 0, 0, 1, 0x85, 0, 0, 0, 5, 0x41}, 4,
+			[]NALUErrorKind{NALUZeroLength, NALUForbiddenBit, NALUTruncated}},
+	}
+	for _, c := range cases {
+		errs := ValidateAVCC(c.frame, c.size)
+		if len(errs) != len(c.want) {
+			t.Fatalf("%s: got %v, want %v", c.name, errs, c.want)
+		}
+		for i, e := range errs {
+			if e.Kind != c.want[i] {
+				t.Fatalf("%s: error %d got %v, want %v", c.name, i, e.Kind, c.want[i])
+			}
+		}
+	}
+
+	errs := ValidateAVCC([]byte{0, 0, 0, 2, 0x65, 0x88, 0, 0, 0, 9, 0x41}, 0)
+	if len(errs) != 1 || errs[0].Index != 1 || errs[0].Offset != 6 || errs[0].Length != 9 || errs[0].Remain != 1 {
+		t.Fatalf("unexpected error %+v", errs)
+	}
+	if errs.Error() != "h264parser: nalu #1 at 6 truncated, length 9, remain 1" {
+		t.Fatal(errs.Error())
+	}
+
+	var stats NALUStats
+	stats.Add(nil)
+	stats.Add(ValidateAVCC(cases[6].frame, 4))
+	if stats != (NALUStats{Frames: 2, InvalidFrames: 1, ZeroLength: 1, ForbiddenBit: 1, Truncated: 1}) {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
@@ -2,11 +2,13 @@ package h265parser
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"time"
 
 	"github.com/bugVanisher/streamer/media/av"
+	"github.com/bugVanisher/streamer/media/container/flv/flvio"
 	"github.com/bugVanisher/streamer/utils/bits"
 	"github.com/bugVanisher/streamer/utils/bits/pio"
 )
@@ -35,7 +37,57 @@ type SPSInfo struct {
 	generalProfileCompatibilityFlags uint32
 	generalConstraintIndicatorFlags  uint64
 	generalLevelIDC                  uint
-	fps                              uint
+
+	SpsID                    uint
+	SeparateColourPlaneFlag  uint
+	BitDepthLuma             uint
+	BitDepthChroma           uint
+	Log2MaxPicOrderCntLsb    uint
+	VuiParametersPresentFlag uint
+	VuiParameters
+
+	FPS uint
+}
+
+// VuiParameters SPS中的vui_parameters, 解析到timing信息为止
+type VuiParameters struct {
+	AspectRatioInfoPresentFlag   uint
+	AspectRatioIdc               uint
+	SarWidth                     uint
+	SarHeight                    uint
+	OverscanInfoPresentFlag      uint
+	OverscanAppropriateFlag      uint
+	VideoSignalTypePresentFlag   uint
+	VideoFormat                  uint
+	VideoFullRangeFlag           uint
+	ColourDescriptionPresentFlag uint
+	ColourPrimaries              uint
+	TransferCharacteristics      uint
+	MatrixCoefficients           uint
+	ChromaLocInfoPresentFlag     uint
+	FieldSeqFlag                 uint
+	DefaultDisplayWindowFlag     uint
+	TimingInfoPresentFlag        uint
+	NumUnitsInTick               uint
+	TimeScale                    uint
+}
+
+// VPSInfo VPS中和hvcC有关的字段
+type VPSInfo struct {
+	VpsID            uint
+	MaxSubLayers     uint
+	TemporalIdNested uint
+	ProfileIdc       uint
+	LevelIdc         uint
+}
+
+// PPSInfo PPS中解析slice header需要的字段
+type PPSInfo struct {
+	PpsID                             uint
+	SpsID                             uint
+	DependentSliceSegmentsEnabledFlag uint
+	OutputFlagPresentFlag             uint
+	NumExtraSliceHeaderBits           uint
 }
 
 const (
@@ -117,13 +169,27 @@ var (
 	ErrorH265IncorectUnitType = errors.New("Incorect Unit Type")
 )
 
+// NALUType nalu头中的nal_unit_type
+func NALUType(b []byte) uint8 {
+	if len(b) == 0 {
+		return NAL_UNIT_INVALID
+	}
+	return (b[0] >> 1) & 0x3f
+}
+
+// IsDataNALU VCL nalu(slice数据)
 func IsDataNALU(b []byte) bool {
-	typ := b[0] & 0x1f
-	return typ >= 1 && typ <= 5
+	return NALUType(b) < NAL_UNIT_VPS
+}
+
+// IsKeyFrameNALU IRAP(BLA/IDR/CRA) nalu
+func IsKeyFrameNALU(b []byte) bool {
+	typ := NALUType(b)
+	return typ >= NAL_UNIT_CODED_SLICE_BLA_W_LP && typ <= NAL_UNIT_RESERVED_IRAP_VCL23
 }
 
 var StartCodeBytes = []byte{0, 0, 1}
-var AUDBytes = []byte{0, 0, 0, 1, 0x9, 0xf0, 0, 0, 0, 1} // AUD
+var AUDBytes = []byte{0, 0, 0, 1, 0x46, 0x01, 0x50, 0, 0, 0, 1} // AUD
 
 func CheckNALUsType(b []byte) (typ int) {
 	_, typ = SplitNALUs(b)
@@ -208,6 +274,7 @@ func SplitNALUs(b []byte) (nalus [][]byte, typ int) {
 	return [][]byte{b}, NALU_RAW
 }
 
+// ParseSPS 解析SPS, 得到profile/level, 裁剪后的宽高以及vui中的帧率
 func ParseSPS(sps []byte) (ctx SPSInfo, err error) {
 	if len(sps) < 2 {
 		err = ErrorH265IncorectUnitSize
@@ -222,71 +289,79 @@ func ParseSPS(sps []byte) (ctx SPSInfo, err error) {
 	if err != nil {
 		return
 	}
-
-	if spsMaxSubLayersMinus1+1 > ctx.numTemporalLayers {
-		ctx.numTemporalLayers = spsMaxSubLayersMinus1 + 1
-	}
+	ctx.numTemporalLayers = spsMaxSubLayersMinus1 + 1
 	if ctx.temporalIdNested, err = br.ReadBit(); err != nil {
 		return
 	}
+	ctx.generalProfileCompatibilityFlags = 0xffffffff
+	ctx.generalConstraintIndicatorFlags = 0xffffffffffff
 	if err = parsePTL(br, &ctx, spsMaxSubLayersMinus1); err != nil {
 		return
 	}
-	if _, err = br.ReadExponentialGolombCode(); err != nil {
+	ctx.ProfileIdc = ctx.generalProfileIDC
+	ctx.LevelIdc = ctx.generalLevelIDC
+	if ctx.SpsID, err = br.ReadExponentialGolombCode(); err != nil {
 		return
 	}
-	var cf uint
-	if cf, err = br.ReadExponentialGolombCode(); err != nil {
+	if ctx.chromaFormat, err = br.ReadExponentialGolombCode(); err != nil {
 		return
 	}
-	ctx.chromaFormat = uint(cf)
 	if ctx.chromaFormat == 3 {
-		if _, err = br.ReadBit(); err != nil {
+		if ctx.SeparateColourPlaneFlag, err = br.ReadBit(); err != nil {
 			return
 		}
 	}
 	if ctx.PicWidthInLumaSamples, err = br.ReadExponentialGolombCode(); err != nil {
 		return
 	}
-	ctx.Width = uint(ctx.PicWidthInLumaSamples)
 	if ctx.PicHeightInLumaSamples, err = br.ReadExponentialGolombCode(); err != nil {
 		return
 	}
-	ctx.Height = uint(ctx.PicHeightInLumaSamples)
 	conformanceWindowFlag, err := br.ReadBit()
 	if err != nil {
 		return
 	}
 	if conformanceWindowFlag != 0 {
-		if _, err = br.ReadExponentialGolombCode(); err != nil {
+		if ctx.CropLeft, err = br.ReadExponentialGolombCode(); err != nil {
 			return
 		}
-		if _, err = br.ReadExponentialGolombCode(); err != nil {
+		if ctx.CropRight, err = br.ReadExponentialGolombCode(); err != nil {
 			return
 		}
-		if _, err = br.ReadExponentialGolombCode(); err != nil {
+		if ctx.CropTop, err = br.ReadExponentialGolombCode(); err != nil {
 			return
 		}
-		if _, err = br.ReadExponentialGolombCode(); err != nil {
+		if ctx.CropBottom, err = br.ReadExponentialGolombCode(); err != nil {
 			return
 		}
 	}
+	// 裁剪窗口以色度采样为单位
+	subWidthC, subHeightC := uint(1), uint(1)
+	if ctx.SeparateColourPlaneFlag == 0 {
+		switch ctx.chromaFormat {
+		case 1:
+			subWidthC, subHeightC = 2, 2
+		case 2:
+			subWidthC = 2
+		}
+	}
+	ctx.Width = ctx.PicWidthInLumaSamples - (ctx.CropLeft+ctx.CropRight)*subWidthC
+	ctx.Height = ctx.PicHeightInLumaSamples - (ctx.CropTop+ctx.CropBottom)*subHeightC
 
-	var bdlm8 uint
-	if bdlm8, err = br.ReadExponentialGolombCode(); err != nil {
+	if ctx.bitDepthLumaMinus8, err = br.ReadExponentialGolombCode(); err != nil {
 		return
 	}
-	ctx.bitDepthChromaMinus8 = uint(bdlm8)
-	var bdcm8 uint
-	if bdcm8, err = br.ReadExponentialGolombCode(); err != nil {
+	if ctx.bitDepthChromaMinus8, err = br.ReadExponentialGolombCode(); err != nil {
 		return
 	}
-	ctx.bitDepthChromaMinus8 = uint(bdcm8)
+	ctx.BitDepthLuma = ctx.bitDepthLumaMinus8 + 8
+	ctx.BitDepthChroma = ctx.bitDepthChromaMinus8 + 8
 
-	_, err = br.ReadExponentialGolombCode()
-	if err != nil {
+	var log2MaxPicOrderCntLsbMinus4 uint
+	if log2MaxPicOrderCntLsbMinus4, err = br.ReadExponentialGolombCode(); err != nil {
 		return
 	}
+	ctx.Log2MaxPicOrderCntLsb = log2MaxPicOrderCntLsbMinus4 + 4
 	spsSubLayerOrderingInfoPresentFlag, err := br.ReadBit()
 	if err != nil {
 		return
@@ -298,33 +373,366 @@ func ParseSPS(sps []byte) (ctx SPSInfo, err error) {
 		i = spsMaxSubLayersMinus1
 	}
 	for ; i <= spsMaxSubLayersMinus1; i++ {
+		// sps_max_dec_pic_buffering_minus1, sps_max_num_reorder_pics, sps_max_latency_increase_plus1
+		if err = skipGolomb(br, 3); err != nil {
+			return
+		}
+	}
+
+	// log2_min_luma_coding_block_size_minus3 ... max_transform_hierarchy_depth_intra
+	if err = skipGolomb(br, 6); err != nil {
+		return
+	}
+
+	scalingListEnabledFlag, err := br.ReadBit()
+	if err != nil {
+		return
+	}
+	if scalingListEnabledFlag != 0 {
+		var spsScalingListDataPresentFlag uint
+		if spsScalingListDataPresentFlag, err = br.ReadBit(); err != nil {
+			return
+		}
+		if spsScalingListDataPresentFlag != 0 {
+			if err = skipScalingListData(br); err != nil {
+				return
+			}
+		}
+	}
+
+	// amp_enabled_flag, sample_adaptive_offset_enabled_flag
+	if _, err = br.ReadBits(2); err != nil {
+		return
+	}
+	pcmEnabledFlag, err := br.ReadBit()
+	if err != nil {
+		return
+	}
+	if pcmEnabledFlag != 0 {
+		// pcm_sample_bit_depth_luma_minus1, pcm_sample_bit_depth_chroma_minus1
+		if _, err = br.ReadBits(8); err != nil {
+			return
+		}
+		if err = skipGolomb(br, 2); err != nil {
+			return
+		}
+		// pcm_loop_filter_disabled_flag
+		if _, err = br.ReadBit(); err != nil {
+			return
+		}
+	}
+
+	numShortTermRefPicSets, err := br.ReadExponentialGolombCode()
+	if err != nil {
+		return
+	}
+	if numShortTermRefPicSets > 64 {
+		err = fmt.Errorf("h265parser: num_short_term_ref_pic_sets=%d invalid", numShortTermRefPicSets)
+		return
+	}
+	numDeltaPocs := make([]uint, numShortTermRefPicSets)
+	for i := uint(0); i < numShortTermRefPicSets; i++ {
+		if err = skipShortTermRefPicSet(br, i, numDeltaPocs); err != nil {
+			return
+		}
+	}
+
+	longTermRefPicsPresentFlag, err := br.ReadBit()
+	if err != nil {
+		return
+	}
+	if longTermRefPicsPresentFlag != 0 {
+		var numLongTermRefPicsSps uint
+		if numLongTermRefPicsSps, err = br.ReadExponentialGolombCode(); err != nil {
+			return
+		}
+		for i := uint(0); i < numLongTermRefPicsSps; i++ {
+			// lt_ref_pic_poc_lsb_sps, used_by_curr_pic_lt_sps_flag
+			if _, err = br.ReadBits(int(ctx.Log2MaxPicOrderCntLsb) + 1); err != nil {
+				return
+			}
+		}
+	}
+
+	// sps_temporal_mvp_enabled_flag, strong_intra_smoothing_enabled_flag
+	if _, err = br.ReadBits(2); err != nil {
+		return
+	}
+	if ctx.VuiParametersPresentFlag, err = br.ReadBit(); err != nil {
+		return
+	}
+	if ctx.VuiParametersPresentFlag != 0 {
+		err = parseVuiParameters(&ctx, br)
+	}
+	return
+}
+
+func skipGolomb(br *bits.GolombBitReader, n int) (err error) {
+	for i := 0; i < n; i++ {
 		if _, err = br.ReadExponentialGolombCode(); err != nil {
 			return
 		}
+	}
+	return
+}
+
+// skipScalingListData 7.3.4 scaling_list_data
+func skipScalingListData(br *bits.GolombBitReader) (err error) {
+	for sizeID := 0; sizeID < 4; sizeID++ {
+		step := 1
+		if sizeID == 3 {
+			step = 3
+		}
+		for matrixID := 0; matrixID < 6; matrixID += step {
+			var predModeFlag uint
+			if predModeFlag, err = br.ReadBit(); err != nil {
+				return
+			}
+			if predModeFlag == 0 {
+				// scaling_list_pred_matrix_id_delta
+				if _, err = br.ReadExponentialGolombCode(); err != nil {
+					return
+				}
+				continue
+			}
+			coefNum := 1 << uint(4+(sizeID<<1))
+			if coefNum > 64 {
+				coefNum = 64
+			}
+			if sizeID > 1 {
+				// scaling_list_dc_coef_minus8
+				coefNum++
+			}
+			// scaling_list_delta_coef
+			if err = skipGolomb(br, coefNum); err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+// skipShortTermRefPicSet 7.3.7 st_ref_pic_set, 在numDeltaPocs中记录每个集合的NumDeltaPocs供后面的集合预测
+func skipShortTermRefPicSet(br *bits.GolombBitReader, idx uint, numDeltaPocs []uint) (err error) {
+	var interRefPicSetPredictionFlag uint
+	if idx != 0 {
+		if interRefPicSetPredictionFlag, err = br.ReadBit(); err != nil {
+			return
+		}
+	}
+	if interRefPicSetPredictionFlag != 0 {
+		// SPS中delta_idx_minus1不出现, 参考前一个集合
+		// delta_rps_sign, abs_delta_rps_minus1
+		if _, err = br.ReadBit(); err != nil {
+			return
+		}
 		if _, err = br.ReadExponentialGolombCode(); err != nil {
 			return
 		}
+		var n uint
+		for j := uint(0); j <= numDeltaPocs[idx-1]; j++ {
+			var usedByCurrPicFlag, useDeltaFlag uint = 0, 1
+			if usedByCurrPicFlag, err = br.ReadBit(); err != nil {
+				return
+			}
+			if usedByCurrPicFlag == 0 {
+				if useDeltaFlag, err = br.ReadBit(); err != nil {
+					return
+				}
+			}
+			if usedByCurrPicFlag != 0 || useDeltaFlag != 0 {
+				n++
+			}
+		}
+		numDeltaPocs[idx] = n
+		return
+	}
+	numNegativePics, err := br.ReadExponentialGolombCode()
+	if err != nil {
+		return
+	}
+	numPositivePics, err := br.ReadExponentialGolombCode()
+	if err != nil {
+		return
+	}
+	if numNegativePics > 16 || numPositivePics > 16 {
+		return fmt.Errorf("h265parser: st_ref_pic_set num_negative_pics=%d num_positive_pics=%d invalid", numNegativePics, numPositivePics)
+	}
+	for i := uint(0); i < numNegativePics+numPositivePics; i++ {
+		// delta_poc_s0/s1_minus1, used_by_curr_pic_s0/s1_flag
 		if _, err = br.ReadExponentialGolombCode(); err != nil {
 			return
 		}
+		if _, err = br.ReadBit(); err != nil {
+			return
+		}
 	}
+	numDeltaPocs[idx] = numNegativePics + numPositivePics
+	return
+}
 
-	if _, err = br.ReadExponentialGolombCode(); err != nil {
+// parseVuiParameters E.2.1 vui_parameters, hrd_parameters及之后的部分不解析
+func parseVuiParameters(sps *SPSInfo, br *bits.GolombBitReader) (err error) {
+	if sps.AspectRatioInfoPresentFlag, err = br.ReadBit(); err != nil {
 		return
 	}
-	if _, err = br.ReadExponentialGolombCode(); err != nil {
+	if sps.AspectRatioInfoPresentFlag != 0 {
+		if sps.AspectRatioIdc, err = br.ReadBits(8); err != nil {
+			return
+		}
+		if sps.AspectRatioIdc == 255 { //EXTENDED_SAR
+			if sps.SarWidth, err = br.ReadBits(16); err != nil {
+				return
+			}
+			if sps.SarHeight, err = br.ReadBits(16); err != nil {
+				return
+			}
+		}
+	}
+
+	if sps.OverscanInfoPresentFlag, err = br.ReadBit(); err != nil {
 		return
 	}
-	if _, err = br.ReadExponentialGolombCode(); err != nil {
+	if sps.OverscanInfoPresentFlag != 0 {
+		if sps.OverscanAppropriateFlag, err = br.ReadBit(); err != nil {
+			return
+		}
+	}
+
+	if sps.VideoSignalTypePresentFlag, err = br.ReadBit(); err != nil {
 		return
 	}
-	if _, err = br.ReadExponentialGolombCode(); err != nil {
+	if sps.VideoSignalTypePresentFlag != 0 {
+		if sps.VideoFormat, err = br.ReadBits(3); err != nil {
+			return
+		}
+		if sps.VideoFullRangeFlag, err = br.ReadBit(); err != nil {
+			return
+		}
+		if sps.ColourDescriptionPresentFlag, err = br.ReadBit(); err != nil {
+			return
+		}
+		if sps.ColourDescriptionPresentFlag != 0 {
+			if sps.ColourPrimaries, err = br.ReadBits(8); err != nil {
+				return
+			}
+			if sps.TransferCharacteristics, err = br.ReadBits(8); err != nil {
+				return
+			}
+			if sps.MatrixCoefficients, err = br.ReadBits(8); err != nil {
+				return
+			}
+		}
+	}
+
+	if sps.ChromaLocInfoPresentFlag, err = br.ReadBit(); err != nil {
 		return
 	}
-	if _, err = br.ReadExponentialGolombCode(); err != nil {
+	if sps.ChromaLocInfoPresentFlag != 0 {
+		if err = skipGolomb(br, 2); err != nil {
+			return
+		}
+	}
+
+	// neutral_chroma_indication_flag
+	if _, err = br.ReadBit(); err != nil {
+		return
+	}
+	if sps.FieldSeqFlag, err = br.ReadBit(); err != nil {
+		return
+	}
+	// frame_field_info_present_flag
+	if _, err = br.ReadBit(); err != nil {
+		return
+	}
+	if sps.DefaultDisplayWindowFlag, err = br.ReadBit(); err != nil {
+		return
+	}
+	if sps.DefaultDisplayWindowFlag != 0 {
+		if err = skipGolomb(br, 4); err != nil {
+			return
+		}
+	}
+
+	if sps.TimingInfoPresentFlag, err = br.ReadBit(); err != nil {
+		return
+	}
+	if sps.TimingInfoPresentFlag != 0 {
+		if sps.NumUnitsInTick, err = br.ReadBits(32); err != nil {
+			return
+		}
+		if sps.TimeScale, err = br.ReadBits(32); err != nil {
+			return
+		}
+		if sps.NumUnitsInTick > 0 {
+			sps.FPS = sps.TimeScale / sps.NumUnitsInTick
+			// field_seq_flag时每个picture是一场
+			if sps.FieldSeqFlag != 0 {
+				sps.FPS /= 2
+			}
+		}
+	}
+
+	//todo hrd_parameters和bitstream_restriction待实现
+
+	return
+}
+
+// ParseVPS 解析VPS
+func ParseVPS(vps []byte) (ctx VPSInfo, err error) {
+	if len(vps) < 2 {
+		err = ErrorH265IncorectUnitSize
+		return
+	}
+	br := &bits.GolombBitReader{R: bytes.NewReader(nal2rbsp(vps[2:]))}
+	if ctx.VpsID, err = br.ReadBits(4); err != nil {
+		return
+	}
+	// vps_base_layer_internal_flag, vps_base_layer_available_flag, vps_max_layers_minus1
+	if _, err = br.ReadBits(8); err != nil {
+		return
+	}
+	maxSubLayersMinus1, err := br.ReadBits(3)
+	if err != nil {
 		return
 	}
-	if _, err = br.ReadExponentialGolombCode(); err != nil {
+	ctx.MaxSubLayers = maxSubLayersMinus1 + 1
+	if ctx.TemporalIdNested, err = br.ReadBit(); err != nil {
+		return
+	}
+	// vps_reserved_0xffff_16bits
+	if _, err = br.ReadBits(16); err != nil {
+		return
+	}
+	var ptl SPSInfo
+	if err = parsePTL(br, &ptl, maxSubLayersMinus1); err != nil {
+		return
+	}
+	ctx.ProfileIdc = ptl.generalProfileIDC
+	ctx.LevelIdc = ptl.generalLevelIDC
+	return
+}
+
+// ParsePPS 解析PPS开头和slice header有关的字段
+func ParsePPS(pps []byte) (ctx PPSInfo, err error) {
+	if len(pps) < 2 {
+		err = ErrorH265IncorectUnitSize
+		return
+	}
+	br := &bits.GolombBitReader{R: bytes.NewReader(nal2rbsp(pps[2:]))}
+	if ctx.PpsID, err = br.ReadExponentialGolombCode(); err != nil {
+		return
+	}
+	if ctx.SpsID, err = br.ReadExponentialGolombCode(); err != nil {
+		return
+	}
+	if ctx.DependentSliceSegmentsEnabledFlag, err = br.ReadBit(); err != nil {
+		return
+	}
+	if ctx.OutputFlagPresentFlag, err = br.ReadBit(); err != nil {
+		return
+	}
+	if ctx.NumExtraSliceHeaderBits, err = br.ReadBits(3); err != nil {
 		return
 	}
 	return
@@ -422,16 +830,43 @@ func nal2rbsp(nal []byte) []byte {
 
 type CodecData struct {
 	Record     []byte
-	RecordInfo AVCDecoderConfRecord
+	RecordInfo HVCCDecoderConfRecord
 	SPSInfo    SPSInfo
 
+	// Deprecated: 使用SequenceHeaderTag/SetSequenceHeaderTag, 该字段只为兼容保留, 由SetSequenceHeaderTag同步写入
 	SequnceHeaderTag interface{}
+	seqHdrTag        *flvio.Tag
+
+	// fpsEstimator SPS没有timing_info时的帧率估计, 见WithFPSEstimator
+	fpsEstimator *av.FPSEstimator
+}
+
+// WithFPSEstimator 挂载帧率估计, SPS不带帧率时FPS()和PacketDuration()使用其估计值
+func (self CodecData) WithFPSEstimator(e *av.FPSEstimator) av.CodecData {
+	self.fpsEstimator = e
+	return self
+}
+
+// SequenceHeaderTag 推流端的sequence header tag, 未设置时ok为false
+func (self CodecData) SequenceHeaderTag() (tag flvio.Tag, ok bool) {
+	if self.seqHdrTag != nil {
+		return *self.seqHdrTag, true
+	}
+	tag, ok = self.SequnceHeaderTag.(flvio.Tag)
+	return
+}
+
+// SetSequenceHeaderTag 保存sequence header tag, 转发时原样写出
+func (self *CodecData) SetSequenceHeaderTag(tag flvio.Tag) {
+	self.seqHdrTag = &tag
+	self.SequnceHeaderTag = tag
 }
 
 func (self CodecData) Type() av.CodecType {
 	return av.H265
 }
 
+// AVCDecoderConfRecordBytes hvcC, 名字和h264parser保持一致
 func (self CodecData) AVCDecoderConfRecordBytes() []byte {
 	return self.Record
 }
@@ -456,42 +891,116 @@ func (self CodecData) Height() int {
 	return int(self.SPSInfo.Height)
 }
 
+// FPS SPS中的帧率, 没有timing_info时为FPSEstimator的估计值, 都没有时为0
 func (self CodecData) FPS() int {
-	return int(self.SPSInfo.fps)
+	if self.SPSInfo.FPS > 0 {
+		return int(self.SPSInfo.FPS)
+	}
+	return self.fpsEstimator.FPS()
 }
 
 func (self CodecData) Resolution() string {
 	return fmt.Sprintf("%vx%v", self.Width(), self.Height())
 }
 
+// Tag RFC 6381的codecs参数, 格式见ISO/IEC 14496-15 E.3, 如hev1.1.6.L93.B0
 func (self CodecData) Tag() string {
-	//return fmt.Sprintf("hvc1.%02X%02X%02X", self.RecordInfo.AVCProfileIndication, self.RecordInfo.ProfileCompatibility, self.RecordInfo.AVCLevelIndication)
-	return "hev1.1.6.L120.90"
+	r := self.RecordInfo
+	var space string
+	if r.GeneralProfileSpace > 0 {
+		space = string(rune('A' + r.GeneralProfileSpace - 1))
+	}
+	// general_profile_compatibility_flag按位逆序
+	var compat uint32
+	for i := uint(0); i < 32; i++ {
+		if r.GeneralProfileCompatibilityFlags&(1<<i) != 0 {
+			compat |= 1 << (31 - i)
+		}
+	}
+	tier := "L"
+	if r.GeneralTierFlag != 0 {
+		tier = "H"
+	}
+	tag := fmt.Sprintf("hev1.%s%d.%X.%s%d", space, r.GeneralProfileIDC, compat, tier, r.GeneralLevelIDC)
+	// 6字节的constraint flags, 省略末尾为0的字节
+	var constraints [6]byte
+	last := -1
+	for i := range constraints {
+		constraints[i] = byte(r.GeneralConstraintIndicatorFlags >> uint(40-8*i))
+		if constraints[i] != 0 {
+			last = i
+		}
+	}
+	for i := 0; i <= last; i++ {
+		tag += fmt.Sprintf(".%X", constraints[i])
+	}
+	return tag
 }
 
 func (self CodecData) Bandwidth() string {
-	return fmt.Sprintf("%v", (int(float64(self.Width())*(float64(1.71)*(30/float64(self.FPS())))))*1000)
+	fps := self.FPS()
+	if fps <= 0 {
+		fps = 30
+	}
+	return fmt.Sprintf("%v", (int(float64(self.Width())*(float64(1.71)*(30/float64(fps)))))*1000)
+}
+
+// Description 编解码参数的可读描述
+func (self CodecData) Description() (desc av.CodecDescription) {
+	desc = av.Describe(self, self.Record)
+	if len(self.Record) > 12 {
+		switch self.Record[1] & 0x1f {
+		case 1:
+			desc.Profile = "Main"
+		case 2:
+			desc.Profile = "Main 10"
+		case 3:
+			desc.Profile = "Main Still Picture"
+		default:
+			desc.Profile = fmt.Sprintf("%d", self.Record[1]&0x1f)
+		}
+		desc.Level = fmt.Sprintf("%.1f", float64(self.Record[12])/30)
+	}
+	desc.FPS = self.FPS()
+	return
+}
+
+func (self CodecData) MarshalJSON() ([]byte, error) {
+	return json.Marshal(self.Description())
+}
+
+// MarshalYAML 与MarshalJSON输出相同的字段
+func (self CodecData) MarshalYAML() (interface{}, error) {
+	return self.Description(), nil
 }
 
+// PacketDuration SPS没有timing信息时返回0
 func (self CodecData) PacketDuration(data []byte) time.Duration {
+	if self.SPSInfo.FPS == 0 {
+		return self.fpsEstimator.FrameDuration()
+	}
+	if self.FPS() <= 0 {
+		return 0
+	}
 	return time.Duration(1000./float64(self.FPS())) * time.Millisecond
 }
 
-func NewCodecDataFromAVCDecoderConfRecord(record []byte) (self CodecData, err error) {
+// NewCodecDataFromHVCCDecoderConfRecord 从flv/mp4中的hvcC创建
+func NewCodecDataFromHVCCDecoderConfRecord(record []byte) (self CodecData, err error) {
 	self.Record = record
 	if _, err = (&self.RecordInfo).Unmarshal(record); err != nil {
 		return
 	}
 	if len(self.RecordInfo.SPS) == 0 {
-		err = fmt.Errorf("h265parser: no SPS found in AVCDecoderConfRecord")
+		err = fmt.Errorf("h265parser: no SPS found in HVCCDecoderConfRecord")
 		return
 	}
 	if len(self.RecordInfo.PPS) == 0 {
-		err = fmt.Errorf("h265parser: no PPS found in AVCDecoderConfRecord")
+		err = fmt.Errorf("h265parser: no PPS found in HVCCDecoderConfRecord")
 		return
 	}
 	if len(self.RecordInfo.VPS) == 0 {
-		err = fmt.Errorf("h265parser: no VPS found in AVCDecoderConfRecord")
+		err = fmt.Errorf("h265parser: no VPS found in HVCCDecoderConfRecord")
 		return
 	}
 	if self.SPSInfo, err = ParseSPS(self.RecordInfo.SPS[0]); err != nil {
@@ -501,174 +1010,174 @@ func NewCodecDataFromAVCDecoderConfRecord(record []byte) (self CodecData, err er
 	return
 }
 
+// NewCodecDataFromAVCDecoderConfRecord Deprecated: 使用NewCodecDataFromHVCCDecoderConfRecord
+func NewCodecDataFromAVCDecoderConfRecord(record []byte) (self CodecData, err error) {
+	return NewCodecDataFromHVCCDecoderConfRecord(record)
+}
+
+// NewCodecDataFromVPSAndSPSAndPPS 从annexb中的参数集创建, hvcC的头部由SPS生成
 func NewCodecDataFromVPSAndSPSAndPPS(vps, sps, pps []byte) (self CodecData, err error) {
-	recordinfo := AVCDecoderConfRecord{}
-	recordinfo.AVCProfileIndication = sps[3]
-	recordinfo.ProfileCompatibility = sps[4]
-	recordinfo.AVCLevelIndication = sps[5]
-	recordinfo.SPS = [][]byte{sps}
-	recordinfo.PPS = [][]byte{pps}
-	recordinfo.VPS = [][]byte{vps}
-	recordinfo.LengthSizeMinusOne = 3
 	if self.SPSInfo, err = ParseSPS(sps); err != nil {
 		return
 	}
+	si := self.SPSInfo
+	recordinfo := HVCCDecoderConfRecord{
+		GeneralProfileSpace:              uint8(si.generalProfileSpace),
+		GeneralTierFlag:                  uint8(si.generalTierFlag),
+		GeneralProfileIDC:                uint8(si.generalProfileIDC),
+		GeneralProfileCompatibilityFlags: si.generalProfileCompatibilityFlags,
+		GeneralConstraintIndicatorFlags:  si.generalConstraintIndicatorFlags,
+		GeneralLevelIDC:                  uint8(si.generalLevelIDC),
+		ChromaFormat:                     uint8(si.chromaFormat),
+		BitDepthLumaMinus8:               uint8(si.bitDepthLumaMinus8),
+		BitDepthChromaMinus8:             uint8(si.bitDepthChromaMinus8),
+		NumTemporalLayers:                uint8(si.numTemporalLayers),
+		TemporalIdNested:                 uint8(si.temporalIdNested),
+		LengthSizeMinusOne:               3,
+		VPS:                              [][]byte{vps},
+		SPS:                              [][]byte{sps},
+		PPS:                              [][]byte{pps},
+	}
 	buf := make([]byte, recordinfo.Len())
-	recordinfo.Marshal(buf, self.SPSInfo)
+	recordinfo.Marshal(buf)
 	self.RecordInfo = recordinfo
 	self.Record = buf
 	return
 }
 
-type AVCDecoderConfRecord struct {
-	AVCProfileIndication uint8
-	ProfileCompatibility uint8
-	AVCLevelIndication   uint8
-	LengthSizeMinusOne   uint8
-	VPS                  [][]byte
-	SPS                  [][]byte
-	PPS                  [][]byte
+// HVCCDecoderConfRecord ISO/IEC 14496-15 8.3.3 HEVCDecoderConfigurationRecord(hvcC),
+// 只保留VPS/SPS/PPS数组
+type HVCCDecoderConfRecord struct {
+	GeneralProfileSpace              uint8
+	GeneralTierFlag                  uint8
+	GeneralProfileIDC                uint8
+	GeneralProfileCompatibilityFlags uint32
+	GeneralConstraintIndicatorFlags  uint64
+	GeneralLevelIDC                  uint8
+	ChromaFormat                     uint8
+	BitDepthLumaMinus8               uint8
+	BitDepthChromaMinus8             uint8
+	AvgFrameRate                     uint16
+	ConstantFrameRate                uint8
+	NumTemporalLayers                uint8
+	TemporalIdNested                 uint8
+	LengthSizeMinusOne               uint8
+	VPS                              [][]byte
+	SPS                              [][]byte
+	PPS                              [][]byte
 }
 
-var ErrDecconfInvalid = fmt.Errorf("h265parser: AVCDecoderConfRecord invalid")
-
-func (self *AVCDecoderConfRecord) Unmarshal(b []byte) (n int, err error) {
-	if len(b) < 30 {
-		err = ErrDecconfInvalid
-		return
-	}
-	self.AVCProfileIndication = b[1]
-	self.ProfileCompatibility = b[2]
-	self.AVCLevelIndication = b[3]
-	self.LengthSizeMinusOne = b[4] & 0x03
-
-	vpscount := int(b[25] & 0x1f)
-	n += 26
-	for i := 0; i < vpscount; i++ {
-		if len(b) < n+2 {
-			err = ErrDecconfInvalid
-			return
-		}
-		vpslen := int(pio.U16BE(b[n:]))
-		n += 2
+// AVCDecoderConfRecord Deprecated: 使用HVCCDecoderConfRecord
+type AVCDecoderConfRecord = HVCCDecoderConfRecord
 
-		if len(b) < n+vpslen {
-			err = ErrDecconfInvalid
-			return
-		}
-		self.VPS = append(self.VPS, b[n:n+vpslen])
-		n += vpslen
-	}
+var ErrDecconfInvalid = fmt.Errorf("h265parser: HVCCDecoderConfRecord invalid")
 
-	if len(b) < n+1 {
+func (self *HVCCDecoderConfRecord) Unmarshal(b []byte) (n int, err error) {
+	if len(b) < 23 {
 		err = ErrDecconfInvalid
 		return
 	}
-
-	n++
-	n++
-
-	spscount := int(b[n])
-	n++
-
-	for i := 0; i < spscount; i++ {
-		if len(b) < n+2 {
-			err = ErrDecconfInvalid
-			return
-		}
-		spslen := int(pio.U16BE(b[n:]))
-		n += 2
-
-		if len(b) < n+spslen {
-			err = ErrDecconfInvalid
-			return
-		}
-		self.SPS = append(self.SPS, b[n:n+spslen])
-		n += spslen
-	}
-
-	n++
-	n++
-
-	ppscount := int(b[n])
-	n++
-
-	for i := 0; i < ppscount; i++ {
-		if len(b) < n+2 {
+	self.GeneralProfileSpace = b[1] >> 6
+	self.GeneralTierFlag = (b[1] >> 5) & 0x01
+	self.GeneralProfileIDC = b[1] & 0x1f
+	self.GeneralProfileCompatibilityFlags = pio.U32BE(b[2:])
+	self.GeneralConstraintIndicatorFlags = uint64(pio.U16BE(b[6:]))<<32 | uint64(pio.U32BE(b[8:]))
+	self.GeneralLevelIDC = b[12]
+	self.ChromaFormat = b[16] & 0x03
+	self.BitDepthLumaMinus8 = b[17] & 0x07
+	self.BitDepthChromaMinus8 = b[18] & 0x07
+	self.AvgFrameRate = pio.U16BE(b[19:])
+	self.ConstantFrameRate = b[21] >> 6
+	self.NumTemporalLayers = (b[21] >> 3) & 0x07
+	self.TemporalIdNested = (b[21] >> 2) & 0x01
+	self.LengthSizeMinusOne = b[21] & 0x03
+
+	numOfArrays := int(b[22])
+	n = 23
+	for i := 0; i < numOfArrays; i++ {
+		if len(b) < n+3 {
 			err = ErrDecconfInvalid
 			return
 		}
-		ppslen := int(pio.U16BE(b[n:]))
-		n += 2
-
-		if len(b) < n+ppslen {
-			err = ErrDecconfInvalid
-			return
+		naltype := b[n] & 0x3f
+		numNalus := int(pio.U16BE(b[n+1:]))
+		n += 3
+		for j := 0; j < numNalus; j++ {
+			if len(b) < n+2 {
+				err = ErrDecconfInvalid
+				return
+			}
+			nalulen := int(pio.U16BE(b[n:]))
+			n += 2
+			if len(b) < n+nalulen {
+				err = ErrDecconfInvalid
+				return
+			}
+			nalu := b[n : n+nalulen]
+			n += nalulen
+			switch naltype {
+			case NAL_UNIT_VPS:
+				self.VPS = append(self.VPS, nalu)
+			case NAL_UNIT_SPS:
+				self.SPS = append(self.SPS, nalu)
+			case NAL_UNIT_PPS:
+				self.PPS = append(self.PPS, nalu)
+			}
 		}
-		self.PPS = append(self.PPS, b[n:n+ppslen])
-		n += ppslen
 	}
 	return
 }
 
-func (self AVCDecoderConfRecord) Len() (n int) {
+func (self HVCCDecoderConfRecord) arrays() [3][][]byte {
+	return [3][][]byte{self.VPS, self.SPS, self.PPS}
+}
+
+func (self HVCCDecoderConfRecord) Len() (n int) {
 	n = 23
-	for _, sps := range self.SPS {
-		n += 5 + len(sps)
-	}
-	for _, pps := range self.PPS {
-		n += 5 + len(pps)
-	}
-	for _, vps := range self.VPS {
-		n += 5 + len(vps)
+	for _, nalus := range self.arrays() {
+		if len(nalus) == 0 {
+			continue
+		}
+		n += 3
+		for _, nalu := range nalus {
+			n += 2 + len(nalu)
+		}
 	}
 	return
 }
 
-func (self AVCDecoderConfRecord) Marshal(b []byte, si SPSInfo) (n int) {
+func (self HVCCDecoderConfRecord) Marshal(b []byte) (n int) {
 	b[0] = 1
-	b[1] = self.AVCProfileIndication
-	b[2] = self.ProfileCompatibility
-	b[3] = self.AVCLevelIndication
-	b[21] = 3
-	b[22] = 3
-	n += 23
-	b[n] = (self.VPS[0][0] >> 1) & 0x3f
-	n++
-	b[n] = byte(len(self.VPS) >> 8)
-	n++
-	b[n] = byte(len(self.VPS))
-	n++
-	for _, vps := range self.VPS {
-		pio.PutU16BE(b[n:], uint16(len(vps)))
-		n += 2
-		copy(b[n:], vps)
-		n += len(vps)
-	}
-	b[n] = (self.SPS[0][0] >> 1) & 0x3f
-	n++
-	b[n] = byte(len(self.SPS) >> 8)
-	n++
-	b[n] = byte(len(self.SPS))
-	n++
-	for _, sps := range self.SPS {
-		pio.PutU16BE(b[n:], uint16(len(sps)))
-		n += 2
-		copy(b[n:], sps)
-		n += len(sps)
-	}
-	b[n] = (self.PPS[0][0] >> 1) & 0x3f
-	n++
-	b[n] = byte(len(self.PPS) >> 8)
-	n++
-	b[n] = byte(len(self.PPS))
-	n++
-	for _, pps := range self.PPS {
-		pio.PutU16BE(b[n:], uint16(len(pps)))
-		n += 2
-		copy(b[n:], pps)
-		n += len(pps)
+	b[1] = self.GeneralProfileSpace<<6 | (self.GeneralTierFlag&0x01)<<5 | self.GeneralProfileIDC&0x1f
+	pio.PutU32BE(b[2:], self.GeneralProfileCompatibilityFlags)
+	pio.PutU48BE(b[6:], self.GeneralConstraintIndicatorFlags)
+	b[12] = self.GeneralLevelIDC
+	// min_spatial_segmentation_idc和parallelismType为0, 保留位为1
+	pio.PutU16BE(b[13:], 0xf000)
+	b[15] = 0xfc
+	b[16] = 0xfc | self.ChromaFormat&0x03
+	b[17] = 0xf8 | self.BitDepthLumaMinus8&0x07
+	b[18] = 0xf8 | self.BitDepthChromaMinus8&0x07
+	pio.PutU16BE(b[19:], self.AvgFrameRate)
+	b[21] = self.ConstantFrameRate<<6 | (self.NumTemporalLayers&0x07)<<3 | (self.TemporalIdNested&0x01)<<2 | self.LengthSizeMinusOne&0x03
+	n = 23
+	var numOfArrays byte
+	for i, nalus := range self.arrays() {
+		if len(nalus) == 0 {
+			continue
+		}
+		numOfArrays++
+		b[n] = NAL_UNIT_VPS + byte(i)
+		pio.PutU16BE(b[n+1:], uint16(len(nalus)))
+		n += 3
+		for _, nalu := range nalus {
+			pio.PutU16BE(b[n:], uint16(len(nalu)))
+			n += 2
+			copy(b[n:], nalu)
+			n += len(nalu)
+		}
 	}
+	b[22] = numOfArrays
 	return
 }
 
@@ -692,35 +1201,49 @@ const (
 	SLICE_I
 )
 
+// ParseSliceHeaderFromNALU 解析slice_segment_header得到slice类型. 不依赖PPS, 只支持每帧的第一个slice segment,
+// 并假设num_extra_slice_header_bits为0(常见编码器的默认值)
 func ParseSliceHeaderFromNALU(packet []byte) (sliceType SliceType, err error) {
-	if len(packet) <= 1 {
+	if len(packet) <= 2 {
 		err = fmt.Errorf("h265parser: packet too short to parse slice header")
 		return
 	}
-	nal_unit_type := packet[0] & 0x1f
-	switch nal_unit_type {
-	case 1, 2, 5, 19:
-
-	default:
+	nal_unit_type := NALUType(packet)
+	if nal_unit_type > NAL_UNIT_CODED_SLICE_CRA || (nal_unit_type >= NAL_UNIT_RESERVED_VCL_N10 && nal_unit_type <= NAL_UNIT_RESERVED_VCL_R15) {
 		err = fmt.Errorf("h265parser: nal_unit_type=%d has no slice header", nal_unit_type)
 		return
 	}
 
-	r := &bits.GolombBitReader{R: bytes.NewReader(packet[1:])}
+	r := &bits.GolombBitReader{R: bytes.NewReader(nal2rbsp(packet[2:]))}
+	var firstSliceSegmentInPicFlag uint
+	if firstSliceSegmentInPicFlag, err = r.ReadBit(); err != nil {
+		return
+	}
+	if nal_unit_type >= NAL_UNIT_CODED_SLICE_BLA_W_LP {
+		// no_output_of_prior_pics_flag
+		if _, err = r.ReadBit(); err != nil {
+			return
+		}
+	}
+	// slice_pic_parameter_set_id
 	if _, err = r.ReadExponentialGolombCode(); err != nil {
 		return
 	}
+	if firstSliceSegmentInPicFlag == 0 {
+		err = fmt.Errorf("h265parser: slice segment address needs PPS")
+		return
+	}
 	var u uint
 	if u, err = r.ReadExponentialGolombCode(); err != nil {
 		return
 	}
 
 	switch u {
-	case 0, 3, 5, 8:
-		sliceType = SLICE_P
-	case 1, 6:
+	case 0:
 		sliceType = SLICE_B
-	case 2, 4, 7, 9:
+	case 1:
+		sliceType = SLICE_P
+	case 2:
 		sliceType = SLICE_I
 	default:
 		err = fmt.Errorf("h265parser: slice_type=%d invalid", u)
@@ -0,0 +1,46 @@
+package h265parser
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+
+	"github.com/bugVanisher/streamer/media/av"
+)
+
+func TestDescription(t *testing.T) {
+	for _, c := range []struct {
+		name          string
+		vps, sps, pps string
+		want          av.CodecDescription
+	}{
+		{"main 1080p", "40010c01ffff016000000300900000030000030078999809",
+			"420101016000000300900000030000030078a003c08010e596666924cae010000003001000000301e080", "4401c172b46240",
+			av.CodecDescription{Codec: "H265", Profile: "Main", Level: "4.0", Width: 1920, Height: 1080, FPS: 30,
+				Extradata: "01016000000090000000000078f000fcfdf8f800000f03200001001840010c01ffff016000000300900000030000030078999809" +
+					"210001002a420101016000000300900000030000030078a003c08010e596666924cae010000003001000000301e080" +
+					"22000100074401c172b46240"}},
+	} {
+		vps, _ := hex.DecodeString(c.vps)
+		sps, _ := hex.DecodeString(c.sps)
+		pps, _ := hex.DecodeString(c.pps)
+		codec, err := NewCodecDataFromVPSAndSPSAndPPS(vps, sps, pps)
+		if err != nil {
+			t.Fatal(c.name, err)
+		}
+		if desc := codec.Description(); desc != c.want {
+			t.Fatalf("%s: %+v", c.name, desc)
+		}
+		b, err := json.Marshal(codec)
+		if err != nil {
+			t.Fatal(c.name, err)
+		}
+		want, _ := json.Marshal(c.want)
+		if string(b) != string(want) {
+			t.Fatalf("%s: json %s", c.name, b)
+		}
+		if y, err := codec.MarshalYAML(); err != nil || y != c.want {
+			t.Fatalf("%s: yaml %+v %v", c.name, y, err)
+		}
+	}
+}
@@ -0,0 +1,256 @@
+package mp3parser
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bugVanisher/streamer/media/av"
+)
+
+// MPEG音频版本, 见帧头的version字段
+const (
+	MPEG25 = 0
+	MPEG2  = 2
+	MPEG1  = 3
+)
+
+// 层, 见帧头的layer字段
+const (
+	Layer3 = 1
+	Layer2 = 2
+	Layer1 = 3
+)
+
+// ChannelModeMono 单声道, 其它取值都是双声道
+const ChannelModeMono = 3
+
+var (
+	versionNames = [4]string{MPEG25: "2.5", MPEG2: "2", MPEG1: "1"}
+	layerNames   = [4]string{Layer1: "I", Layer2: "II", Layer3: "III"}
+)
+
+var ErrFrameHeaderInvalid = errors.New("mp3parser: frame header invalid")
+
+var sampleRates = [4][3]int{
+	MPEG25: {11025, 12000, 8000},
+	MPEG2:  {22050, 24000, 16000},
+	MPEG1:  {44100, 48000, 32000},
+}
+
+// bitrates 单位kbps, 下标为[MPEG1?0:1][layer][bitrate_index]
+var bitrates = [2][4][15]int{
+	{
+		Layer1: {0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448},
+		Layer2: {0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384},
+		Layer3: {0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320},
+	},
+	{
+		Layer1: {0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256},
+		Layer2: {0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+		Layer3: {0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+	},
+}
+
+// FrameHeader MPEG音频帧头(4字节)
+type FrameHeader struct {
+	Version     uint8
+	Layer       uint8
+	Protection  bool // 帧头之后有16位CRC
+	Bitrate     int  // 单位kbps, 0为free format
+	SampleRate  int
+	Padding     bool
+	ChannelMode uint8
+}
+
+// ParseFrameHeader 解析b开头的帧头
+func ParseFrameHeader(b []byte) (h FrameHeader, err error) {
+	if len(b) < 4 || b[0] != 0xff || b[1]&0xe0 != 0xe0 {
+		err = ErrFrameHeaderInvalid
+		return
+	}
+	h.Version = (b[1] >> 3) & 0x03
+	h.Layer = (b[1] >> 1) & 0x03
+	h.Protection = b[1]&0x01 == 0
+	bitrateIdx := b[2] >> 4
+	sampleRateIdx := (b[2] >> 2) & 0x03
+	if h.Version == 1 || h.Layer == 0 || bitrateIdx == 0x0f || sampleRateIdx == 0x03 {
+		err = ErrFrameHeaderInvalid
+		return
+	}
+	table := 1
+	if h.Version == MPEG1 {
+		table = 0
+	}
+	h.Bitrate = bitrates[table][h.Layer][bitrateIdx]
+	h.SampleRate = sampleRates[h.Version][sampleRateIdx]
+	h.Padding = (b[2]>>1)&0x01 != 0
+	h.ChannelMode = b[3] >> 6
+	return
+}
+
+// Bytes 编码为4字节帧头, 不在码率表中的码率按free format处理, 采样率不在采样率表中时返回nil
+func (self FrameHeader) Bytes() []byte {
+	sampleRateIdx := -1
+	for i, rate := range sampleRates[self.Version&0x03] {
+		if rate == self.SampleRate {
+			sampleRateIdx = i
+		}
+	}
+	if sampleRateIdx < 0 || self.Layer == 0 {
+		return nil
+	}
+	table := 1
+	if self.Version == MPEG1 {
+		table = 0
+	}
+	var bitrateIdx int
+	for i, rate := range bitrates[table][self.Layer] {
+		if i > 0 && rate == self.Bitrate {
+			bitrateIdx = i
+		}
+	}
+	b := []byte{0xff, 0xe0 | self.Version<<3 | self.Layer<<1, byte(bitrateIdx)<<4 | byte(sampleRateIdx)<<2, self.ChannelMode << 6}
+	if !self.Protection {
+		b[1] |= 0x01
+	}
+	if self.Padding {
+		b[2] |= 0x02
+	}
+	return b
+}
+
+// SamplesPerFrame 每帧的采样数
+func (self FrameHeader) SamplesPerFrame() int {
+	switch {
+	case self.Layer == Layer1:
+		return 384
+	case self.Layer == Layer3 && self.Version != MPEG1:
+		return 576
+	}
+	return 1152
+}
+
+// FrameLength 包括帧头的帧长度, free format时返回0
+func (self FrameHeader) FrameLength() int {
+	if self.Bitrate == 0 || self.SampleRate == 0 {
+		return 0
+	}
+	if self.Layer == Layer1 {
+		n := 12 * self.Bitrate * 1000 / self.SampleRate
+		if self.Padding {
+			n++
+		}
+		return n * 4
+	}
+	n := self.SamplesPerFrame() / 8 * self.Bitrate * 1000 / self.SampleRate
+	if self.Padding {
+		n++
+	}
+	return n
+}
+
+// Duration 一帧的时长
+func (self FrameHeader) Duration() time.Duration {
+	if self.SampleRate == 0 {
+		return 0
+	}
+	return time.Duration(self.SamplesPerFrame()) * time.Second / time.Duration(self.SampleRate)
+}
+
+// ChannelLayout 声道布局
+func (self FrameHeader) ChannelLayout() av.ChannelLayout {
+	if self.ChannelMode == ChannelModeMono {
+		return av.CH_MONO
+	}
+	return av.CH_STEREO
+}
+
+// SplitFrames 按帧头把data拆分为多个帧, 最后不完整的帧和无法解析的数据被丢弃
+func SplitFrames(data []byte) (frames []FrameHeader, err error) {
+	for len(data) > 0 {
+		var h FrameHeader
+		if h, err = ParseFrameHeader(data); err != nil {
+			return
+		}
+		n := h.FrameLength()
+		if n <= 0 || n > len(data) {
+			// free format或不完整的帧只能按单帧处理
+			frames = append(frames, h)
+			return
+		}
+		frames = append(frames, h)
+		data = data[n:]
+	}
+	return
+}
+
+type CodecData struct {
+	FrameHeader FrameHeader
+}
+
+// NewCodecDataFromFrame 从第一个帧的帧头得到采样率和声道
+func NewCodecDataFromFrame(data []byte) (self CodecData, err error) {
+	if self.FrameHeader, err = ParseFrameHeader(data); err != nil {
+		return
+	}
+	return
+}
+
+// NewCodecData 没有帧头时由容器中的参数创建, 如FLV tag的SoundRate/SoundType
+func NewCodecData(sampleRate int, layout av.ChannelLayout) CodecData {
+	h := FrameHeader{Version: MPEG1, Layer: Layer3, SampleRate: sampleRate}
+	switch sampleRate {
+	case 22050, 24000, 16000:
+		h.Version = MPEG2
+	case 11025, 12000, 8000:
+		h.Version = MPEG25
+	}
+	if layout == av.CH_MONO {
+		h.ChannelMode = ChannelModeMono
+	}
+	return CodecData{FrameHeader: h}
+}
+
+func (self CodecData) Type() av.CodecType {
+	return av.MP3
+}
+
+func (self CodecData) SampleRate() int {
+	return self.FrameHeader.SampleRate
+}
+
+func (self CodecData) ChannelLayout() av.ChannelLayout {
+	return self.FrameHeader.ChannelLayout()
+}
+
+func (self CodecData) SampleFormat() av.SampleFormat {
+	return av.S16
+}
+
+// PacketDuration packet中所有帧的时长, 无法解析时按一帧计算
+func (self CodecData) PacketDuration(data []byte) (dur time.Duration, err error) {
+	frames, _ := SplitFrames(data)
+	if len(frames) == 0 {
+		return self.FrameHeader.Duration(), nil
+	}
+	for _, h := range frames {
+		dur += h.Duration()
+	}
+	return
+}
+
+// Tag RFC 6381的codecs参数, MPEG-1为mp4a.6B, MPEG-2/2.5为mp4a.69
+func (self CodecData) Tag() string {
+	if self.FrameHeader.Version == MPEG1 {
+		return "mp4a.6B"
+	}
+	return "mp4a.69"
+}
+
+func (self CodecData) MarshalJSON() ([]byte, error) {
+	desc := av.Describe(self, nil)
+	desc.Profile = fmt.Sprintf("MPEG-%s Layer %s", versionNames[self.FrameHeader.Version], layerNames[self.FrameHeader.Layer])
+	return json.Marshal(desc)
+}
@@ -0,0 +1,69 @@
+package mp3parser
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bugVanisher/streamer/media/av"
+)
+
+// testFrame 帧头之后补0到frameLen
+func testFrame(header []byte, frameLen int) []byte {
+	return append(append([]byte{}, header...), make([]byte, frameLen-len(header))...)
+}
+
+func TestParseFrameHeader(t *testing.T) {
+	for _, c := range []struct {
+		header     []byte
+		sampleRate int
+		layout     av.ChannelLayout
+		bitrate    int
+		frameLen   int
+		samples    int
+		tag        string
+	}{
+		// MPEG-1 Layer III, 128kbps, 44.1kHz, stereo
+		{[]byte{0xff, 0xfb, 0x90, 0x00}, 44100, av.CH_STEREO, 128, 417, 1152, "mp4a.6B"},
+		// MPEG-2 Layer III, 64kbps, 22.05kHz, mono
+		{[]byte{0xff, 0xf3, 0x80, 0xc0}, 22050, av.CH_MONO, 64, 208, 576, "mp4a.69"},
+	} {
+		h, err := ParseFrameHeader(c.header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if h.SampleRate != c.sampleRate || h.ChannelLayout() != c.layout || h.Bitrate != c.bitrate ||
+			h.FrameLength() != c.frameLen || h.SamplesPerFrame() != c.samples {
+			t.Fatalf("unexpected frame header %+v", h)
+		}
+		codec, err := NewCodecDataFromFrame(c.header)
+		if err != nil || codec.Tag() != c.tag {
+			t.Fatalf("codec tag %s err=%v", codec.Tag(), err)
+		}
+		if b := h.Bytes(); string(b) != string(c.header) {
+			t.Fatalf("frame header bytes %x, expected %x", b, c.header)
+		}
+	}
+	if b := NewCodecData(48000, av.CH_MONO).FrameHeader.Bytes(); b == nil {
+		t.Fatal("expected frame header bytes for 48kHz")
+	} else if h, err := ParseFrameHeader(b); err != nil || h.SampleRate != 48000 || h.ChannelLayout() != av.CH_MONO {
+		t.Fatalf("unexpected frame header %+v err=%v", h, err)
+	}
+	if _, err := ParseFrameHeader([]byte{0xff, 0xfb, 0xf0, 0x00}); err != ErrFrameHeaderInvalid {
+		t.Fatalf("expected ErrFrameHeaderInvalid for bad bitrate, got %v", err)
+	}
+}
+
+func TestPacketDuration(t *testing.T) {
+	frame := testFrame([]byte{0xff, 0xfb, 0x90, 0x00}, 417)
+	codec, err := NewCodecDataFromFrame(frame)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dur, err := codec.PacketDuration(append(append([]byte{}, frame...), frame...))
+	if err != nil || dur != 2*(1152*time.Second/44100) {
+		t.Fatalf("duration %v err=%v", dur, err)
+	}
+	if codec = NewCodecData(22050, av.CH_MONO); codec.FrameHeader.Version != MPEG2 || codec.ChannelLayout() != av.CH_MONO {
+		t.Fatalf("unexpected codec %+v", codec.FrameHeader)
+	}
+}
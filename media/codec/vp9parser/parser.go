@@ -0,0 +1,417 @@
+package vp9parser
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/bugVanisher/streamer/media/av"
+	"github.com/bugVanisher/streamer/media/container/flv/flvio"
+	"github.com/bugVanisher/streamer/utils/bits"
+)
+
+// 帧类型, 见VP9规范7.2 frame_type
+const (
+	KEY_FRAME     = 0
+	NON_KEY_FRAME = 1
+)
+
+// CS_RGB color_space为RGB时没有color_range和subsampling
+const CS_RGB = 7
+
+var (
+	ErrFrameInvalid   = errors.New("vp9parser: frame header invalid")
+	ErrDecconfInvalid = errors.New("vp9parser: VPCodecConfRecord invalid")
+)
+
+var frameSyncCode = []byte{0x49, 0x83, 0x42}
+
+// FrameHeader uncompressed_header中和配置有关的字段, 只有关键帧带分辨率和color_config
+type FrameHeader struct {
+	Profile           uint
+	ShowExistingFrame uint
+	FrameType         uint
+	ShowFrame         uint
+	ErrorResilient    uint
+	BitDepth          uint
+	ColorSpace        uint
+	ColorRange        uint
+	SubsamplingX      uint
+	SubsamplingY      uint
+	Width             uint
+	Height            uint
+}
+
+// IsKeyFrame 是否是关键帧
+func (self FrameHeader) IsKeyFrame() bool {
+	return self.ShowExistingFrame == 0 && self.FrameType == KEY_FRAME
+}
+
+// SplitSuperframe 按superframe index把一个packet拆分为多个帧, 不是superframe时返回整个packet
+func SplitSuperframe(data []byte) (frames [][]byte) {
+	if len(data) == 0 {
+		return
+	}
+	marker := data[len(data)-1]
+	if marker&0xe0 == 0xc0 {
+		count := int(marker&0x07) + 1
+		size := int(marker>>3&0x03) + 1
+		indexLen := 2 + size*count
+		if len(data) >= indexLen && data[len(data)-indexLen] == marker {
+			index := data[len(data)-indexLen+1:]
+			offset := 0
+			for i := 0; i < count; i++ {
+				framelen := 0
+				for j := 0; j < size; j++ {
+					framelen |= int(index[i*size+j]) << uint(8*j)
+				}
+				if offset+framelen > len(data)-indexLen {
+					return [][]byte{data}
+				}
+				frames = append(frames, data[offset:offset+framelen])
+				offset += framelen
+			}
+			return
+		}
+	}
+	return [][]byte{data}
+}
+
+// ParseFrameHeader 解析帧的uncompressed_header, 非关键帧只解析到error_resilient_mode
+func ParseFrameHeader(frame []byte) (h FrameHeader, err error) {
+	br := &bits.GolombBitReader{R: bytes.NewReader(frame)}
+	var marker, low, high uint
+	if marker, err = br.ReadBits(2); err != nil {
+		return
+	}
+	if marker != 2 {
+		err = ErrFrameInvalid
+		return
+	}
+	if low, err = br.ReadBit(); err != nil {
+		return
+	}
+	if high, err = br.ReadBit(); err != nil {
+		return
+	}
+	h.Profile = high<<1 | low
+	if h.Profile == 3 {
+		// reserved_zero
+		if _, err = br.ReadBit(); err != nil {
+			return
+		}
+	}
+	if h.ShowExistingFrame, err = br.ReadBit(); err != nil {
+		return
+	}
+	if h.ShowExistingFrame != 0 {
+		return
+	}
+	if h.FrameType, err = br.ReadBit(); err != nil {
+		return
+	}
+	if h.ShowFrame, err = br.ReadBit(); err != nil {
+		return
+	}
+	if h.ErrorResilient, err = br.ReadBit(); err != nil {
+		return
+	}
+	if h.FrameType != KEY_FRAME {
+		return
+	}
+
+	var sync uint
+	if sync, err = br.ReadBits(24); err != nil {
+		return
+	}
+	if sync != uint(frameSyncCode[0])<<16|uint(frameSyncCode[1])<<8|uint(frameSyncCode[2]) {
+		err = ErrFrameInvalid
+		return
+	}
+	if err = parseColorConfig(br, &h); err != nil {
+		return
+	}
+	if h.Width, err = br.ReadBits(16); err != nil {
+		return
+	}
+	h.Width++
+	if h.Height, err = br.ReadBits(16); err != nil {
+		return
+	}
+	h.Height++
+	return
+}
+
+// parseColorConfig 7.2.2 color_config
+func parseColorConfig(br *bits.GolombBitReader, h *FrameHeader) (err error) {
+	h.BitDepth = 8
+	if h.Profile >= 2 {
+		var twelveBit uint
+		if twelveBit, err = br.ReadBit(); err != nil {
+			return
+		}
+		h.BitDepth = 10
+		if twelveBit != 0 {
+			h.BitDepth = 12
+		}
+	}
+	if h.ColorSpace, err = br.ReadBits(3); err != nil {
+		return
+	}
+	if h.ColorSpace != CS_RGB {
+		if h.ColorRange, err = br.ReadBit(); err != nil {
+			return
+		}
+		h.SubsamplingX, h.SubsamplingY = 1, 1
+		if h.Profile == 1 || h.Profile == 3 {
+			if h.SubsamplingX, err = br.ReadBit(); err != nil {
+				return
+			}
+			if h.SubsamplingY, err = br.ReadBit(); err != nil {
+				return
+			}
+			// reserved_zero
+			_, err = br.ReadBit()
+		}
+		return
+	}
+	h.ColorRange = 1
+	if h.Profile == 1 || h.Profile == 3 {
+		// reserved_zero
+		_, err = br.ReadBit()
+	}
+	return
+}
+
+// IsKeyFrame packet的第一帧是否是关键帧
+func IsKeyFrame(data []byte) bool {
+	frames := SplitSuperframe(data)
+	if len(frames) == 0 {
+		return false
+	}
+	h, err := ParseFrameHeader(frames[0])
+	return err == nil && h.IsKeyFrame()
+}
+
+// chroma_subsampling的取值, 见VP Codec ISO Media File Format Binding
+const (
+	ChromaSubsampling420Vertical  = 0
+	ChromaSubsampling420Colocated = 1
+	ChromaSubsampling422          = 2
+	ChromaSubsampling444          = 3
+)
+
+// VPCodecConfRecord VPCodecConfigurationRecord(vpcC), Unmarshal同时支持带和不带FullBox的version/flags
+type VPCodecConfRecord struct {
+	Profile                 uint8
+	Level                   uint8
+	BitDepth                uint8
+	ChromaSubsampling       uint8
+	VideoFullRangeFlag      uint8
+	ColourPrimaries         uint8
+	TransferCharacteristics uint8
+	MatrixCoefficients      uint8
+	CodecInitializationData []byte
+}
+
+func (self *VPCodecConfRecord) Unmarshal(b []byte) (n int, err error) {
+	// version(1)=1, flags(24)=0
+	if len(b) >= 12 && b[0] == 1 && b[1] == 0 && b[2] == 0 && b[3] == 0 && 12+(int(b[10])<<8|int(b[11])) == len(b) {
+		b = b[4:]
+		n = 4
+	}
+	if len(b) < 8 {
+		err = ErrDecconfInvalid
+		return
+	}
+	self.Profile = b[0]
+	self.Level = b[1]
+	self.BitDepth = b[2] >> 4
+	self.ChromaSubsampling = (b[2] >> 1) & 0x07
+	self.VideoFullRangeFlag = b[2] & 0x01
+	self.ColourPrimaries = b[3]
+	self.TransferCharacteristics = b[4]
+	self.MatrixCoefficients = b[5]
+	size := int(b[6])<<8 | int(b[7])
+	if len(b) < 8+size {
+		err = ErrDecconfInvalid
+		return
+	}
+	self.CodecInitializationData = b[8 : 8+size]
+	n += 8 + size
+	return
+}
+
+// Len Marshal的长度, 包括FullBox的version/flags
+func (self VPCodecConfRecord) Len() int {
+	return 12 + len(self.CodecInitializationData)
+}
+
+// Marshal 和ffmpeg一样写出version 1的FullBox头
+func (self VPCodecConfRecord) Marshal(b []byte) (n int) {
+	b[0], b[1], b[2], b[3] = 1, 0, 0, 0
+	b[4] = self.Profile
+	b[5] = self.Level
+	b[6] = self.BitDepth<<4 | (self.ChromaSubsampling&0x07)<<1 | self.VideoFullRangeFlag&0x01
+	b[7] = self.ColourPrimaries
+	b[8] = self.TransferCharacteristics
+	b[9] = self.MatrixCoefficients
+	b[10] = uint8(len(self.CodecInitializationData) >> 8)
+	b[11] = uint8(len(self.CodecInitializationData))
+	n = 12
+	n += copy(b[n:], self.CodecInitializationData)
+	return
+}
+
+// levels VP9的level和最大亮度采样数
+var levels = []struct {
+	level   uint8
+	samples uint
+}{
+	{10, 36864}, {11, 73728}, {20, 122880}, {21, 245760}, {30, 552960}, {31, 983040},
+	{40, 2228224}, {50, 8912896}, {60, 35651584},
+}
+
+// LevelForSize 按分辨率估计的最低level
+func LevelForSize(width, height uint) uint8 {
+	for _, l := range levels {
+		if width*height <= l.samples {
+			return l.level
+		}
+	}
+	return 62
+}
+
+type CodecData struct {
+	Record     []byte
+	RecordInfo VPCodecConfRecord
+	// FrameHeader 关键帧的头部, vpcC不带分辨率, 没有关键帧时Width/Height为0
+	FrameHeader FrameHeader
+
+	seqHdrTag *flvio.Tag
+	// fpsEstimator 码流不带帧率, 由packet时间戳估计, 见WithFPSEstimator
+	fpsEstimator *av.FPSEstimator
+}
+
+// WithFPSEstimator 挂载帧率估计, 码流不带帧率时FPS()使用其估计值
+func (self CodecData) WithFPSEstimator(e *av.FPSEstimator) av.CodecData {
+	self.fpsEstimator = e
+	return self
+}
+
+// SequenceHeaderTag 推流端的sequence header tag, 未设置时ok为false
+func (self CodecData) SequenceHeaderTag() (tag flvio.Tag, ok bool) {
+	if self.seqHdrTag != nil {
+		return *self.seqHdrTag, true
+	}
+	return
+}
+
+// SetSequenceHeaderTag 保存sequence header tag, 转发时原样写出
+func (self *CodecData) SetSequenceHeaderTag(tag flvio.Tag) {
+	self.seqHdrTag = &tag
+}
+
+func (self CodecData) Type() av.CodecType {
+	return av.VP9
+}
+
+// VPCodecConfRecordBytes vpcC
+func (self CodecData) VPCodecConfRecordBytes() []byte {
+	return self.Record
+}
+
+func (self CodecData) Width() int {
+	return int(self.FrameHeader.Width)
+}
+
+func (self CodecData) Height() int {
+	return int(self.FrameHeader.Height)
+}
+
+// FPS VP9码流不带帧率, 返回FPSEstimator的估计值, 没有时为0
+func (self CodecData) FPS() int {
+	return self.fpsEstimator.FPS()
+}
+
+func (self CodecData) Resolution() string {
+	return fmt.Sprintf("%vx%v", self.Width(), self.Height())
+}
+
+// Tag RFC 6381的codecs参数, 如vp09.00.31.08
+func (self CodecData) Tag() string {
+	return fmt.Sprintf("vp09.%02d.%02d.%02d", self.RecordInfo.Profile, self.RecordInfo.Level, self.RecordInfo.BitDepth)
+}
+
+func (self CodecData) Bandwidth() string {
+	return fmt.Sprintf("%v", (int(float64(self.Width())*float64(1.71)))*1000)
+}
+
+// ProfileName profile的名字
+func ProfileName(profile uint8) string {
+	return fmt.Sprintf("Profile %d", profile)
+}
+
+func (self CodecData) MarshalJSON() ([]byte, error) {
+	desc := av.Describe(self, self.Record)
+	desc.Profile = ProfileName(self.RecordInfo.Profile)
+	desc.Level = fmt.Sprintf("%d.%d", self.RecordInfo.Level/10, self.RecordInfo.Level%10)
+	return json.Marshal(desc)
+}
+
+// WithKeyFrame 从关键帧的头部得到分辨率, packet的第一帧不是关键帧时返回错误
+func (self CodecData) WithKeyFrame(data []byte) (CodecData, error) {
+	frames := SplitSuperframe(data)
+	if len(frames) == 0 {
+		return self, ErrFrameInvalid
+	}
+	h, err := ParseFrameHeader(frames[0])
+	if err != nil {
+		return self, err
+	}
+	if !h.IsKeyFrame() {
+		return self, fmt.Errorf("vp9parser: not a key frame")
+	}
+	self.FrameHeader = h
+	return self, nil
+}
+
+// NewCodecDataFromVPCodecConfRecord 从E-RTMP/mp4中的vpcC创建, 分辨率需要之后用WithKeyFrame设置
+func NewCodecDataFromVPCodecConfRecord(record []byte) (self CodecData, err error) {
+	self.Record = record
+	if _, err = (&self.RecordInfo).Unmarshal(record); err != nil {
+		return
+	}
+	self.FrameHeader.Profile = uint(self.RecordInfo.Profile)
+	self.FrameHeader.BitDepth = uint(self.RecordInfo.BitDepth)
+	return
+}
+
+// NewCodecDataFromKeyFrame 从码流中的关键帧创建, vpcC的字段由帧头生成
+func NewCodecDataFromKeyFrame(data []byte) (self CodecData, err error) {
+	if self, err = self.WithKeyFrame(data); err != nil {
+		return
+	}
+	h := self.FrameHeader
+	recordinfo := VPCodecConfRecord{
+		Profile:                 uint8(h.Profile),
+		Level:                   LevelForSize(h.Width, h.Height),
+		BitDepth:                uint8(h.BitDepth),
+		ChromaSubsampling:       ChromaSubsampling420Colocated,
+		VideoFullRangeFlag:      uint8(h.ColorRange),
+		ColourPrimaries:         2, // unspecified
+		TransferCharacteristics: 2,
+		MatrixCoefficients:      2,
+	}
+	switch {
+	case h.SubsamplingX == 1 && h.SubsamplingY == 0:
+		recordinfo.ChromaSubsampling = ChromaSubsampling422
+	case h.SubsamplingX == 0 && h.SubsamplingY == 0:
+		recordinfo.ChromaSubsampling = ChromaSubsampling444
+	}
+	self.Record = make([]byte, recordinfo.Len())
+	recordinfo.Marshal(self.Record)
+	self.RecordInfo = recordinfo
+	return
+}
@@ -0,0 +1,107 @@
+package vp9parser
+
+import (
+	"bytes"
+	"testing"
+)
+
+type bitWriter struct {
+	buf  []byte
+	nbit int
+}
+
+func (w *bitWriter) write(v uint64, n int) {
+	for i := n - 1; i >= 0; i-- {
+		if w.nbit%8 == 0 {
+			w.buf = append(w.buf, 0)
+		}
+		if v>>uint(i)&1 != 0 {
+			w.buf[len(w.buf)-1] |= 0x80 >> uint(w.nbit%8)
+		}
+		w.nbit++
+	}
+}
+
+// testKeyFrame profile 0, 8bit BT.709, 1280x720的关键帧头部
+func testKeyFrame() []byte {
+	w := &bitWriter{}
+	w.write(2, 2)         // frame_marker
+	w.write(0, 2)         // profile_low_bit, profile_high_bit
+	w.write(0, 1)         // show_existing_frame
+	w.write(KEY_FRAME, 1) // frame_type
+	w.write(1, 1)         // show_frame
+	w.write(0, 1)         // error_resilient_mode
+	w.write(0x498342, 24) // frame_sync_code
+	w.write(2, 3)         // color_space CS_BT_709
+	w.write(0, 1)         // color_range
+	w.write(1279, 16)     // frame_width_minus_1
+	w.write(719, 16)      // frame_height_minus_1
+	return append(w.buf, 0, 0, 0)
+}
+
+func TestParseFrameHeader(t *testing.T) {
+	h, err := ParseFrameHeader(testKeyFrame())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !h.IsKeyFrame() || h.Width != 1280 || h.Height != 720 || h.BitDepth != 8 || h.SubsamplingX != 1 || h.SubsamplingY != 1 {
+		t.Fatalf("unexpected frame header %+v", h)
+	}
+
+	// 非关键帧只有前几个字段
+	inter := []byte{0x86, 0x00}
+	if h, err = ParseFrameHeader(inter); err != nil || h.IsKeyFrame() {
+		t.Fatalf("inter frame: %+v err=%v", h, err)
+	}
+	if _, err = ParseFrameHeader([]byte{0x00}); err != ErrFrameInvalid {
+		t.Fatalf("expected ErrFrameInvalid, got %v", err)
+	}
+}
+
+func TestSplitSuperframe(t *testing.T) {
+	key := testKeyFrame()
+	inter := []byte{0x86, 0x00, 0x11}
+	// 两帧, 每帧大小1字节: marker 0b11000001
+	marker := byte(0xc1)
+	data := append(append(append([]byte{}, key...), inter...), marker, byte(len(key)), byte(len(inter)), marker)
+	frames := SplitSuperframe(data)
+	if len(frames) != 2 || !bytes.Equal(frames[0], key) || !bytes.Equal(frames[1], inter) {
+		t.Fatalf("split %d frames", len(frames))
+	}
+	if !IsKeyFrame(data) || IsKeyFrame(inter) {
+		t.Fatal("IsKeyFrame mismatch")
+	}
+	if frames = SplitSuperframe(key); len(frames) != 1 {
+		t.Fatalf("expected 1 frame, got %d", len(frames))
+	}
+}
+
+func TestCodecData(t *testing.T) {
+	codec, err := NewCodecDataFromKeyFrame(testKeyFrame())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if codec.Tag() != "vp09.00.31.08" || codec.Resolution() != "1280x720" {
+		t.Fatalf("got tag %s resolution %s", codec.Tag(), codec.Resolution())
+	}
+	if codec.Record[0] != 1 || len(codec.Record) != 12 {
+		t.Fatalf("unexpected vpcC % x", codec.Record)
+	}
+
+	// vpcC往返, 带和不带FullBox头
+	for _, record := range [][]byte{codec.VPCodecConfRecordBytes(), codec.Record[4:]} {
+		parsed, err := NewCodecDataFromVPCodecConfRecord(record)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if parsed.RecordInfo.Level != 31 || parsed.RecordInfo.ChromaSubsampling != ChromaSubsampling420Colocated || parsed.Width() != 0 {
+			t.Fatalf("unexpected record %+v", parsed.RecordInfo)
+		}
+		if parsed, err = parsed.WithKeyFrame(testKeyFrame()); err != nil || parsed.Width() != 1280 {
+			t.Fatalf("WithKeyFrame width %d err=%v", parsed.Width(), err)
+		}
+	}
+	if _, err = NewCodecDataFromVPCodecConfRecord(codec.Record[:6]); err == nil {
+		t.Fatal("expected error for short vpcC")
+	}
+}
@@ -0,0 +1,496 @@
+package es
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/bugVanisher/streamer/media/av"
+	"github.com/bugVanisher/streamer/media/codec/aacparser"
+	"github.com/bugVanisher/streamer/media/codec/h264parser"
+	"github.com/bugVanisher/streamer/media/codec/h265parser"
+	"github.com/bugVanisher/streamer/utils/bits/pio"
+)
+
+// DefaultFPS 视频elementary stream没有指定帧率且SPS中没有VUI帧率时使用的帧率
+const DefaultFPS = 25
+
+// nalReader 从AnnexB字节流中逐个读出NALU, 不要求一次读入整个文件
+type nalReader struct {
+	r       io.Reader
+	buf     []byte
+	from    int // buf中下一次查找起始码的位置
+	started bool
+	eof     bool
+}
+
+func (self *nalReader) fill() (err error) {
+	if self.eof {
+		return io.EOF
+	}
+	if cap(self.buf)-len(self.buf) < 32*1024 {
+		buf := make([]byte, len(self.buf), 2*cap(self.buf)+64*1024)
+		copy(buf, self.buf)
+		self.buf = buf
+	}
+	n, err := self.r.Read(self.buf[len(self.buf):cap(self.buf)])
+	self.buf = self.buf[:len(self.buf)+n]
+	if err == io.EOF {
+		self.eof = true
+		err = nil
+	}
+	return
+}
+
+// next 返回下一个NALU, 不含起始码和结尾的0字节
+func (self *nalReader) next() (nalu []byte, err error) {
+	for {
+		if i := bytes.Index(self.buf[self.from:], startCode[1:]); i >= 0 {
+			i += self.from
+			if self.started {
+				nalu = append([]byte(nil), bytes.TrimRight(self.buf[:i], "\x00")...)
+			}
+			self.buf = self.buf[:copy(self.buf, self.buf[i+3:])]
+			self.from = 0
+			if self.started && len(nalu) > 0 {
+				return
+			}
+			self.started = true
+			continue
+		}
+		if self.eof {
+			if self.started && len(self.buf) > 0 {
+				nalu = append([]byte(nil), bytes.TrimRight(self.buf, "\x00")...)
+				self.buf, self.from = self.buf[:0], 0
+				if len(nalu) > 0 {
+					return
+				}
+			}
+			return nil, io.EOF
+		}
+		if len(self.buf) > 2 {
+			self.from = len(self.buf) - 2
+		}
+		if err = self.fill(); err != nil {
+			return
+		}
+	}
+}
+
+// VideoDemuxer 读取AnnexB格式的H.264/H.265裸流, 按access unit输出packet, 时间戳按固定帧率生成.
+// 裸流中没有时间戳, 含B帧的流输出的是解码顺序, CompositionTime为0
+type VideoDemuxer struct {
+	nr      *nalReader
+	typ     av.CodecType
+	fps     float64
+	codec   av.CodecData
+	pending []byte // 已读出, 属于下一个access unit的NALU
+	probed  []av.Packet
+	frames  int64
+	err     error
+}
+
+// NewVideoDemuxer 创建视频裸流demuxer, typ为av.H264或av.H265, fps不大于0时使用SPS中的帧率或DefaultFPS
+func NewVideoDemuxer(r io.Reader, typ av.CodecType, fps float64) *VideoDemuxer {
+	return &VideoDemuxer{nr: &nalReader{r: r}, typ: typ, fps: fps}
+}
+
+// Streams 读取到参数集为止, 返回视频流的CodecData
+func (self *VideoDemuxer) Streams() (streams []av.CodecData, err error) {
+	if self.codec != nil {
+		return []av.CodecData{self.codec}, nil
+	}
+	if self.typ != av.H264 && self.typ != av.H265 {
+		return nil, fmt.Errorf("es: unsupported video codec %v", self.typ)
+	}
+	params := map[int][]byte{}
+	for self.codec == nil {
+		var nalus [][]byte
+		if nalus, err = self.readAU(); err != nil {
+			if err == io.EOF {
+				err = fmt.Errorf("es: no %v parameter sets found", self.typ)
+			}
+			return
+		}
+		for _, nalu := range nalus {
+			if t := self.naluType(nalu); self.isParamSet(t) {
+				if _, ok := params[t]; !ok {
+					params[t] = nalu
+				}
+			}
+		}
+		if self.typ == av.H264 && params[7] != nil && params[8] != nil {
+			if self.codec, err = h264parser.NewCodecDataFromSPSAndPPS(params[7], params[8]); err != nil {
+				return
+			}
+		} else if self.typ == av.H265 && params[32] != nil && params[33] != nil && params[34] != nil {
+			if self.codec, err = h265parser.NewCodecDataFromVPSAndSPSAndPPS(params[32], params[33], params[34]); err != nil {
+				return
+			}
+		}
+		// 参数集之前的帧不能解码, 丢弃
+		if self.codec != nil {
+			if self.fps <= 0 {
+				self.fps = DefaultFPS
+				if f, ok := self.codec.(interface{ FPS() int }); ok && f.FPS() > 0 {
+					self.fps = float64(f.FPS())
+				}
+			}
+			if pkt, ok := self.packet(nalus); ok {
+				self.probed = append(self.probed, pkt)
+			}
+		}
+	}
+	return []av.CodecData{self.codec}, nil
+}
+
+func (self *VideoDemuxer) ReadPacket() (pkt av.Packet, err error) {
+	if _, err = self.Streams(); err != nil {
+		return
+	}
+	if len(self.probed) > 0 {
+		pkt = self.probed[0]
+		self.probed = self.probed[1:]
+		return
+	}
+	for {
+		var nalus [][]byte
+		if nalus, err = self.readAU(); err != nil {
+			return
+		}
+		var ok bool
+		if pkt, ok = self.packet(nalus); ok {
+			return
+		}
+	}
+}
+
+// packet 把access unit转成AVCC格式的packet, 参数集和AUD不放入packet
+func (self *VideoDemuxer) packet(nalus [][]byte) (pkt av.Packet, ok bool) {
+	var data []byte
+	for _, nalu := range nalus {
+		t := self.naluType(nalu)
+		if self.isParamSet(t) || self.isAUD(t) {
+			continue
+		}
+		if self.isKeyFrame(t) {
+			pkt.IsKeyFrame = true
+		}
+		data = append(data, 0, 0, 0, 0)
+		pio.PutU32BE(data[len(data)-4:], uint32(len(nalu)))
+		data = append(data, nalu...)
+	}
+	if len(data) == 0 {
+		return
+	}
+	dur := time.Duration(float64(time.Second) / self.fps)
+	pkt.Time = av.MediaTimeFromDuration(time.Duration(float64(self.frames) * float64(time.Second) / self.fps))
+	pkt.Duration = dur
+	pkt.Data = data
+	pkt.DataType = int8(av.FLV_TAG_VIDEO)
+	pkt.AVCPacketType = av.AVC_NALU
+	self.frames++
+	return pkt, true
+}
+
+// readAU 读出一个access unit的全部NALU
+func (self *VideoDemuxer) readAU() (nalus [][]byte, err error) {
+	if self.err != nil {
+		return nil, self.err
+	}
+	vcl := false
+	if self.pending != nil {
+		nalus = append(nalus, self.pending)
+		vcl = self.isVCL(self.naluType(self.pending))
+		self.pending = nil
+	}
+	for {
+		var nalu []byte
+		if nalu, err = self.nr.next(); err != nil {
+			self.err = err
+			if len(nalus) > 0 {
+				err = nil
+			}
+			return
+		}
+		if vcl && self.startsAU(nalu) {
+			self.pending = nalu
+			return
+		}
+		if self.isVCL(self.naluType(nalu)) {
+			vcl = true
+		}
+		nalus = append(nalus, nalu)
+	}
+}
+
+func (self *VideoDemuxer) naluType(nalu []byte) int {
+	if self.typ == av.H265 {
+		return int(nalu[0]>>1) & 0x3f
+	}
+	return int(nalu[0]) & 0x1f
+}
+
+func (self *VideoDemuxer) isVCL(t int) bool {
+	if self.typ == av.H265 {
+		return t < 32
+	}
+	return t >= 1 && t <= 5
+}
+
+func (self *VideoDemuxer) isParamSet(t int) bool {
+	if self.typ == av.H265 {
+		return t >= 32 && t <= 34
+	}
+	return t == 7 || t == 8
+}
+
+func (self *VideoDemuxer) isAUD(t int) bool {
+	if self.typ == av.H265 {
+		return t == 35
+	}
+	return t == 9
+}
+
+func (self *VideoDemuxer) isKeyFrame(t int) bool {
+	if self.typ == av.H265 {
+		return t >= 16 && t <= 21
+	}
+	return t == 5
+}
+
+// startsAU 已经读到VCL NALU之后, nalu是否是下一个access unit的开始
+func (self *VideoDemuxer) startsAU(nalu []byte) bool {
+	t := self.naluType(nalu)
+	if self.typ == av.H265 {
+		switch {
+		case t < 32:
+			// first_slice_segment_in_pic_flag
+			return len(nalu) > 2 && nalu[2]&0x80 != 0
+		case t >= 32 && t <= 35, t == 39, t >= 41 && t <= 44, t >= 48 && t <= 55:
+			return true
+		}
+		return false
+	}
+	switch {
+	case t >= 1 && t <= 5:
+		// first_mb_in_slice为0
+		return len(nalu) > 1 && nalu[1]&0x80 != 0
+	case t >= 6 && t <= 9, t >= 14 && t <= 18:
+		return true
+	}
+	return false
+}
+
+// AudioDemuxer 读取ADTS格式的AAC裸流, 时间戳按采样数生成
+type AudioDemuxer struct {
+	r       *bufio.Reader
+	codec   aacparser.CodecData
+	probed  bool
+	first   *av.Packet
+	samples int64
+}
+
+// NewAudioDemuxer 创建ADTS裸流demuxer
+func NewAudioDemuxer(r io.Reader) *AudioDemuxer {
+	return &AudioDemuxer{r: bufio.NewReader(r)}
+}
+
+// Streams 读取第一个ADTS帧, 返回音频流的CodecData
+func (self *AudioDemuxer) Streams() (streams []av.CodecData, err error) {
+	if !self.probed {
+		var pkt av.Packet
+		var config aacparser.MPEG4AudioConfig
+		if pkt, config, err = self.readFrame(); err != nil {
+			if err == io.EOF {
+				err = fmt.Errorf("es: no adts frame found")
+			}
+			return
+		}
+		if self.codec, err = aacparser.NewCodecDataFromMPEG4AudioConfig(config); err != nil {
+			return
+		}
+		self.first = &pkt
+		self.probed = true
+	}
+	return []av.CodecData{self.codec}, nil
+}
+
+func (self *AudioDemuxer) ReadPacket() (pkt av.Packet, err error) {
+	if _, err = self.Streams(); err != nil {
+		return
+	}
+	if self.first != nil {
+		pkt = *self.first
+		self.first = nil
+		return
+	}
+	pkt, _, err = self.readFrame()
+	return
+}
+
+func (self *AudioDemuxer) readFrame() (pkt av.Packet, config aacparser.MPEG4AudioConfig, err error) {
+	var hdr []byte
+	if hdr, err = self.r.Peek(aacparser.ADTSHeaderLength); err != nil {
+		if err == io.ErrUnexpectedEOF || (err == io.EOF && len(hdr) > 0) {
+			err = io.EOF
+		}
+		return
+	}
+	var hdrlen, framelen, samples int
+	if config, hdrlen, framelen, samples, err = aacparser.ParseADTSHeader(hdr); err != nil {
+		return
+	}
+	// 保留的采样率序号没有对应采样率, 无法生成时间戳
+	if config.SampleRate == 0 {
+		err = fmt.Errorf("es: invalid adts sampling_frequency_index %d", config.SampleRateIndex)
+		return
+	}
+	frame := make([]byte, framelen)
+	if _, err = io.ReadFull(self.r, frame); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			err = io.EOF
+		}
+		return
+	}
+	pkt.Time = av.MediaTimeFromDuration(time.Duration(self.samples) * time.Second / time.Duration(config.SampleRate))
+	pkt.Duration = time.Duration(samples) * time.Second / time.Duration(config.SampleRate)
+	pkt.Data = frame[hdrlen:]
+	pkt.DataType = int8(av.FLV_TAG_AUDIO)
+	pkt.AVCPacketType = av.AVC_NALU
+	self.samples += int64(samples)
+	return
+}
+
+// MergeDemuxer 把多个单路流的demuxer合成一个多路流的demuxer, packet按时间戳交织输出
+type MergeDemuxer struct {
+	demuxers []av.Demuxer
+	streams  []av.CodecData
+	idx      [][]int8 // 每个demuxer的流在合并后的序号
+	heads    []*av.Packet
+	done     []bool
+	files    []io.Closer // OpenFiles打开的文件
+}
+
+// NewMergeDemuxer 合并demuxers, 流的顺序和demuxers的顺序一致
+func NewMergeDemuxer(demuxers ...av.Demuxer) *MergeDemuxer {
+	return &MergeDemuxer{
+		demuxers: demuxers,
+		heads:    make([]*av.Packet, len(demuxers)),
+		done:     make([]bool, len(demuxers)),
+	}
+}
+
+func (self *MergeDemuxer) Streams() (streams []av.CodecData, err error) {
+	if self.idx != nil {
+		return self.streams, nil
+	}
+	idx := make([][]int8, len(self.demuxers))
+	for i, demuxer := range self.demuxers {
+		var s []av.CodecData
+		if s, err = demuxer.Streams(); err != nil {
+			return
+		}
+		for _, stream := range s {
+			idx[i] = append(idx[i], int8(len(streams)))
+			streams = append(streams, stream)
+		}
+	}
+	self.streams, self.idx = streams, idx
+	return
+}
+
+// ReadPacket 返回时间戳最小的packet, 所有demuxer都结束后返回io.EOF
+func (self *MergeDemuxer) ReadPacket() (pkt av.Packet, err error) {
+	if _, err = self.Streams(); err != nil {
+		return
+	}
+	min := -1
+	for i, demuxer := range self.demuxers {
+		if self.heads[i] == nil && !self.done[i] {
+			var p av.Packet
+			if p, err = demuxer.ReadPacket(); err != nil {
+				if err != io.EOF {
+					return
+				}
+				err = nil
+				self.done[i] = true
+				continue
+			}
+			p.Idx = self.idx[i][p.Idx]
+			self.heads[i] = &p
+		}
+		if self.heads[i] != nil && (min < 0 || self.heads[i].Time < self.heads[min].Time) {
+			min = i
+		}
+	}
+	if min < 0 {
+		return pkt, io.EOF
+	}
+	pkt = *self.heads[min]
+	self.heads[min] = nil
+	return
+}
+
+// Close 关闭实现了io.Closer的demuxer和OpenFiles打开的文件
+func (self *MergeDemuxer) Close() (err error) {
+	closers := self.files
+	for _, demuxer := range self.demuxers {
+		if c, ok := demuxer.(io.Closer); ok {
+			closers = append(closers, c)
+		}
+	}
+	for _, c := range closers {
+		if cerr := c.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return
+}
+
+// OpenFiles 按扩展名(.h264, .264, .265, .h265, .aac)打开多个elementary stream文件, 合成一个多路流的demuxer,
+// 如一路视频和一路音频. fps为视频流的帧率, 见NewVideoDemuxer
+func OpenFiles(fps float64, filenames ...string) (demuxer *MergeDemuxer, err error) {
+	demuxer = NewMergeDemuxer()
+	defer func() {
+		if err != nil {
+			demuxer.Close()
+			demuxer = nil
+		}
+	}()
+	for _, filename := range filenames {
+		var typ av.CodecType
+		switch strings.ToLower(path.Ext(filename)) {
+		case ".h264", ".264":
+			typ = av.H264
+		case ".h265", ".265", ".hevc":
+			typ = av.H265
+		case ".aac":
+			typ = av.AAC
+		default:
+			return demuxer, fmt.Errorf("es: unknown elementary stream file %s", filename)
+		}
+		var f *os.File
+		if f, err = os.Open(filename); err != nil {
+			return
+		}
+		demuxer.files = append(demuxer.files, f)
+		if typ == av.AAC {
+			demuxer.add(NewAudioDemuxer(f))
+		} else {
+			demuxer.add(NewVideoDemuxer(f, typ, fps))
+		}
+	}
+	return
+}
+
+func (self *MergeDemuxer) add(demuxer av.Demuxer) {
+	self.demuxers = append(self.demuxers, demuxer)
+	self.heads = append(self.heads, nil)
+	self.done = append(self.done, false)
+}
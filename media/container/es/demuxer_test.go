@@ -0,0 +1,123 @@
+package es
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bugVanisher/streamer/media/av"
+	"github.com/bugVanisher/streamer/media/codec/aacparser"
+	"github.com/bugVanisher/streamer/media/codec/h264parser"
+)
+
+func testAnnexB(t *testing.T) []byte {
+	h264 := testStreams(t)[1].(h264parser.CodecData)
+	var b []byte
+	for _, nalu := range [][]byte{{0x09, 0xf0}, h264.SPS(), h264.PPS(), {0x65, 0x88, 0x01}, {0x41, 0x9a, 0x02}, {0x41, 0x1a, 0x03}, {0x41, 0x9a, 0x04, 0x00}} {
+		b = append(b, startCode...)
+		b = append(b, nalu...)
+	}
+	// 3字节起始码
+	return append(b, 0, 0, 1, 0x41, 0x9a, 0x05)
+}
+
+func TestVideoDemuxer(t *testing.T) {
+	d := NewVideoDemuxer(bytes.NewReader(testAnnexB(t)), av.H264, 25)
+	streams, err := d.Streams()
+	require.Nil(t, err)
+	require.Equal(t, av.H264, streams[0].Type())
+
+	var pkts []av.Packet
+	for {
+		pkt, err := d.ReadPacket()
+		if err == io.EOF {
+			break
+		}
+		require.Nil(t, err)
+		pkts = append(pkts, pkt)
+	}
+	require.Equal(t, 4, len(pkts))
+	require.True(t, pkts[0].IsKeyFrame)
+	require.False(t, pkts[1].IsKeyFrame)
+	// 参数集和AUD不在packet中
+	require.Equal(t, []byte{0, 0, 0, 3, 0x65, 0x88, 0x01}, pkts[0].Data)
+	// 同一帧的两个slice
+	require.Equal(t, []byte{0, 0, 0, 3, 0x41, 0x9a, 0x02, 0, 0, 0, 3, 0x41, 0x1a, 0x03}, pkts[1].Data)
+	require.Equal(t, []byte{0, 0, 0, 3, 0x41, 0x9a, 0x04}, pkts[2].Data)
+	require.Equal(t, []byte{0, 0, 0, 3, 0x41, 0x9a, 0x05}, pkts[3].Data)
+	for i, pkt := range pkts {
+		require.Equal(t, time.Duration(i)*40*time.Millisecond, pkt.Time.Duration())
+		require.Equal(t, int8(av.FLV_TAG_VIDEO), pkt.DataType)
+	}
+}
+
+func testADTS(n int) []byte {
+	config := aacparser.MPEG4AudioConfig{ObjectType: 2, SampleRateIndex: 4, ChannelConfig: 2}
+	(&config).Complete()
+	var b []byte
+	hdr := make([]byte, aacparser.ADTSHeaderLength)
+	for i := 0; i < n; i++ {
+		aacparser.FillADTSHeader(hdr, config, 1024, 2)
+		b = append(b, hdr...)
+		b = append(b, byte(i), byte(i))
+	}
+	return b
+}
+
+func TestAudioDemuxer(t *testing.T) {
+	d := NewAudioDemuxer(bytes.NewReader(testADTS(3)))
+	streams, err := d.Streams()
+	require.Nil(t, err)
+	require.Equal(t, 44100, streams[0].(av.AudioCodecData).SampleRate())
+	for i := 0; i < 3; i++ {
+		pkt, err := d.ReadPacket()
+		require.Nil(t, err)
+		require.Equal(t, []byte{byte(i), byte(i)}, pkt.Data)
+		require.Equal(t, time.Duration(i)*1024*time.Second/44100, pkt.Time.Duration())
+	}
+	_, err = d.ReadPacket()
+	require.Equal(t, io.EOF, err)
+}
+
+func TestAudioDemuxerMalformed(t *testing.T) {
+	for _, index := range []uint{13, 15} {
+		// 保留的采样率序号
+		b := testADTS(2)
+		b[2] = b[2]&^0x3c | byte(index)<<2
+		_, err := NewAudioDemuxer(bytes.NewReader(b)).Streams()
+		require.NotNil(t, err)
+	}
+	// 后续帧损坏时ReadPacket返回错误
+	b := testADTS(2)
+	b[aacparser.ADTSHeaderLength+2+2] |= 0x3c
+	d := NewAudioDemuxer(bytes.NewReader(b))
+	_, err := d.ReadPacket()
+	require.Nil(t, err)
+	_, err = d.ReadPacket()
+	require.NotNil(t, err)
+}
+
+func TestMergeDemuxer(t *testing.T) {
+	d := NewMergeDemuxer(NewVideoDemuxer(bytes.NewReader(testAnnexB(t)), av.H264, 25), NewAudioDemuxer(bytes.NewReader(testADTS(6))))
+	streams, err := d.Streams()
+	require.Nil(t, err)
+	require.Equal(t, []av.CodecType{av.H264, av.AAC}, []av.CodecType{streams[0].Type(), streams[1].Type()})
+
+	var last av.MediaTime
+	counts := map[int8]int{}
+	for {
+		pkt, err := d.ReadPacket()
+		if err == io.EOF {
+			break
+		}
+		require.Nil(t, err)
+		require.True(t, pkt.Time >= last)
+		require.Equal(t, map[int8]int8{0: av.FLV_TAG_VIDEO, 1: av.FLV_TAG_AUDIO}[pkt.Idx], pkt.DataType)
+		last = pkt.Time
+		counts[pkt.Idx]++
+	}
+	require.Equal(t, map[int8]int{0: 4, 1: 6}, counts)
+}
@@ -0,0 +1,73 @@
+// Package es 把单路流写成裸的elementary stream: H.264/H.265为AnnexB起始码格式, AAC为ADTS,
+// 可以直接交给JM/HM或ffprobe等分析工具
+package es
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/bugVanisher/streamer/media/av"
+	"github.com/bugVanisher/streamer/media/av/pktque"
+	"github.com/bugVanisher/streamer/media/codec/aacparser"
+	"github.com/bugVanisher/streamer/media/codec/h264parser"
+	"github.com/bugVanisher/streamer/media/codec/h265parser"
+)
+
+// startCode AnnexB的4字节起始码
+var startCode = []byte{0, 0, 0, 1}
+
+// Muxer 只写入streams中第一路typ类型的流, 其他流的packet被忽略
+type Muxer struct {
+	w       io.Writer
+	typ     av.CodecType
+	idx     int
+	codec   av.CodecData
+	adtshdr []byte
+}
+
+// NewMuxer 创建typ类型的elementary stream muxer, typ为av.H264, av.H265或av.AAC
+func NewMuxer(w io.Writer, typ av.CodecType) *Muxer {
+	return &Muxer{w: w, typ: typ, idx: -1, adtshdr: make([]byte, aacparser.ADTSHeaderLength)}
+}
+
+// WriteHeader 选出要写入的流, header变化时重新调用
+func (self *Muxer) WriteHeader(streams []av.CodecData) (err error) {
+	switch self.typ {
+	case av.H264, av.H265, av.AAC:
+	default:
+		return fmt.Errorf("es: unsupported codec %v", self.typ)
+	}
+	for i, stream := range streams {
+		if stream.Type() == self.typ {
+			self.idx, self.codec = i, stream
+			return
+		}
+	}
+	return fmt.Errorf("es: no %v stream", self.typ)
+}
+
+func (self *Muxer) WritePacket(pkt av.Packet) (err error) {
+	if int(pkt.Idx) != self.idx || pkt.IsSequenceHeader() || pkt.IsScriptData() {
+		return
+	}
+	switch codec := self.codec.(type) {
+	case h264parser.CodecData, h265parser.CodecData:
+		// 关键帧之前重复参数集(帧中已带时不重复), 从任意关键帧开始都可以解码
+		data, _ := pktque.ToAnnexB(codec, pkt.Data, pkt.IsKeyFrame, true)
+		_, err = self.w.Write(data)
+		return
+
+	case aacparser.CodecData:
+		aacparser.FillADTSHeader(self.adtshdr, codec.Config, 1024, len(pkt.Data))
+		if _, err = self.w.Write(self.adtshdr); err != nil {
+			return
+		}
+		_, err = self.w.Write(pkt.Data)
+		return
+	}
+	return fmt.Errorf("es: unexpected codec data %T for %v", self.codec, self.typ)
+}
+
+func (self *Muxer) WriteTrailer() error {
+	return nil
+}
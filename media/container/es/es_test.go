@@ -0,0 +1,70 @@
+package es
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bugVanisher/streamer/media/av"
+	"github.com/bugVanisher/streamer/media/codec/aacparser"
+	"github.com/bugVanisher/streamer/media/codec/h264parser"
+)
+
+func testStreams(t *testing.T) []av.CodecData {
+	aac, err := aacparser.NewCodecDataFromMPEG4AudioConfigBytes([]byte{0x12, 0x10}) // AAC-LC 44100 stereo
+	require.Nil(t, err)
+	sps := []byte{0x67, 0x64, 0x00, 0x1e, 0xac, 0xd9, 0x40, 0xa0, 0x2f, 0xf9, 0x70, 0x11, 0x00, 0x00, 0x03,
+		0x00, 0x01, 0x00, 0x00, 0x03, 0x00, 0x32, 0x0f, 0x16, 0x2d, 0x96}
+	pps := []byte{0x68, 0xeb, 0xe3, 0xcb, 0x22, 0xc0}
+	h264, err := h264parser.NewCodecDataFromSPSAndPPS(sps, pps)
+	require.Nil(t, err)
+	return []av.CodecData{aac, h264}
+}
+
+func testPackets() []av.Packet {
+	// AVCC: 两个NALU, 长度前缀4字节
+	avcc := []byte{0, 0, 0, 2, 0x65, 0xaa, 0, 0, 0, 1, 0x06}
+	return []av.Packet{
+		{Idx: 1, DataType: av.FLV_TAG_VIDEO, AVCPacketType: av.AVC_SEQHDR, IsKeyFrame: true, Data: []byte{1, 2, 3}},
+		{Idx: 1, DataType: av.FLV_TAG_VIDEO, AVCPacketType: av.AVC_NALU, IsKeyFrame: true, Data: avcc},
+		{Idx: 0, DataType: av.FLV_TAG_AUDIO, AVCPacketType: av.AVC_NALU, Data: []byte{0x21, 0x22, 0x23}},
+		{Idx: 1, DataType: av.FLV_TAG_VIDEO, AVCPacketType: av.AVC_NALU, Data: []byte{0, 0, 0, 2, 0x41, 0xbb}},
+	}
+}
+
+func TestMuxerH264(t *testing.T) {
+	streams := testStreams(t)
+	var buf bytes.Buffer
+	m := NewMuxer(&buf, av.H264)
+	require.Nil(t, m.WriteHeader(streams))
+	for _, pkt := range testPackets() {
+		require.Nil(t, m.WritePacket(pkt))
+	}
+	require.Nil(t, m.WriteTrailer())
+
+	h264 := streams[1].(h264parser.CodecData)
+	var want []byte
+	for _, nalu := range [][]byte{h264.SPS(), h264.PPS(), {0x65, 0xaa}, {0x06}, {0x41, 0xbb}} {
+		want = append(want, startCode...)
+		want = append(want, nalu...)
+	}
+	require.Equal(t, want, buf.Bytes())
+}
+
+func TestMuxerAAC(t *testing.T) {
+	var buf bytes.Buffer
+	m := NewMuxer(&buf, av.AAC)
+	require.Nil(t, m.WriteHeader(testStreams(t)))
+	for _, pkt := range testPackets() {
+		require.Nil(t, m.WritePacket(pkt))
+	}
+	b := buf.Bytes()
+	require.Equal(t, aacparser.ADTSHeaderLength+3, len(b))
+	require.Equal(t, []byte{0xff, 0xf1}, b[:2])
+	// ADTS frame_length包含头部
+	require.Equal(t, aacparser.ADTSHeaderLength+3, int(b[3]&0x3)<<11|int(b[4])<<3|int(b[5])>>5)
+	require.Equal(t, []byte{0x21, 0x22, 0x23}, b[aacparser.ADTSHeaderLength:])
+
+	require.NotNil(t, NewMuxer(&buf, av.H265).WriteHeader(testStreams(t)))
+}
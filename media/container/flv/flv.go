@@ -8,9 +8,12 @@ import (
 	"github.com/bugVanisher/streamer/media/av/avutil"
 	"github.com/bugVanisher/streamer/media/codec"
 	"github.com/bugVanisher/streamer/media/codec/aacparser"
+	"github.com/bugVanisher/streamer/media/codec/av1parser"
 	"github.com/bugVanisher/streamer/media/codec/fake"
 	"github.com/bugVanisher/streamer/media/codec/h264parser"
 	"github.com/bugVanisher/streamer/media/codec/h265parser"
+	"github.com/bugVanisher/streamer/media/codec/mp3parser"
+	"github.com/bugVanisher/streamer/media/codec/vp9parser"
 	"github.com/bugVanisher/streamer/media/container/flv/flvio"
 	"github.com/bugVanisher/streamer/utils/bits/pio"
 	"github.com/rs/zerolog/log"
@@ -31,6 +34,14 @@ func NewMetadataByStreams(streams []av.CodecData) (metadata flvio.AMFMap, err er
 				metadata["videocodecid"] = flvio.VIDEO_H264
 			case av.H265:
 				metadata["videocodecid"] = flvio.VIDEO_H265
+				// E-RTMP中videocodecid为fourcc
+				if seqhdr, isTag := _stream.(h265parser.CodecData).SequenceHeaderTag(); isTag && seqhdr.IsExHeader {
+					metadata["videocodecid"] = flvio.FOURCC_HVC1
+				}
+			case av.AV1:
+				metadata["videocodecid"] = flvio.FOURCC_AV01
+			case av.VP9:
+				metadata["videocodecid"] = flvio.FOURCC_VP09
 
 			default:
 				err = fmt.Errorf("flv: metadata: unsupported video codecType=%v", stream.Type())
@@ -51,6 +62,15 @@ func NewMetadataByStreams(streams []av.CodecData) (metadata flvio.AMFMap, err er
 			case av.SPEEX:
 				metadata["audiocodecid"] = flvio.SOUND_SPEEX
 
+			case av.MP3:
+				metadata["audiocodecid"] = flvio.SOUND_MP3
+
+			case av.PCM_ALAW:
+				metadata["audiocodecid"] = flvio.SOUND_ALAW
+
+			case av.PCM_MULAW:
+				metadata["audiocodecid"] = flvio.SOUND_MULAW
+
 			default:
 				err = fmt.Errorf("flv: metadata: unsupported audio codecType=%v", stream.Type())
 				return
@@ -71,10 +91,47 @@ type Prober struct {
 	Streams                        []av.CodecData
 	CachedPkts                     []av.Packet
 	TaskID                         string
+
+	// clock 展开32位时间戳的回绕, packet的Time单调增长
+	clock av.MsUnwrapper
+
+	// ParseSEI 解析H.264帧中的SEI消息和字幕, 填充packet的SEI和Captions
+	ParseSEI bool
+
+	// Validate 严格校验H.264/H.265帧的AVCC结构, 不合法的帧不转为packet, 结果计入NALUStats
+	Validate bool
+	// OnInvalidNALU Validate时帧不合法的回调
+	OnInvalidNALU func(tag flvio.Tag, errs h264parser.NALUErrors)
+	// NALUStats Validate时的帧校验统计
+	NALUStats h264parser.NALUStats
+
+	// rejected 上一个tag没有通过校验
+	rejected bool
+
+	// RecoveryPoint 检测H.264非关键帧中的recovery point SEI(open GOP), 填充packet的RecoveryPoint
+	RecoveryPoint bool
+
+	// fps 视频帧的dts喂给的帧率估计, 挂在视频CodecData上作为码流不带帧率时FPS()的后备
+	fps *av.FPSEstimator
+}
+
+// estimateFPS 给视频CodecData挂上帧率估计, 换sequence header后继续沿用之前的窗口
+func (self *Prober) estimateFPS(stream av.CodecData) av.CodecData {
+	e, ok := stream.(av.FPSEstimated)
+	if !ok {
+		return stream
+	}
+	if self.fps == nil {
+		self.fps = av.NewFPSEstimator(av.DefaultFPSWindow)
+	}
+	return e.WithFPSEstimator(self.fps)
 }
 
 func (self *Prober) CacheTag(_tag flvio.Tag, timestamp int32) {
 	pkt, _ := self.TagToPacket(_tag, timestamp)
+	if self.rejected {
+		return
+	}
 	self.CachedPkts = append(self.CachedPkts, pkt)
 }
 
@@ -92,27 +149,19 @@ func (self *Prober) PushTag(tag flvio.Tag, timestamp int32) (err error) {
 		case flvio.AVC_SEQHDR:
 			if !self.GotVideo {
 				var stream av.CodecData
-				if stream, err = h264parser.NewCodecDataFromAVCDecoderConfRecord(tag.Data); err != nil {
-					if stream, err = h265parser.NewCodecDataFromAVCDecoderConfRecord(tag.Data); err != nil {
-						err = fmt.Errorf("flv: h264 seqhdr invalid")
-						return
-					}
+				if stream, err = NewVideoCodecData(tag); err != nil {
+					return
 				}
+				stream = self.estimateFPS(stream)
 				self.VideoStreamIdx = len(self.Streams)
-				h264, isH264 := stream.(h264parser.CodecData)
-				if isH264 {
-					h264.SequnceHeaderTag = tag
-					self.Streams = append(self.Streams, h264)
-				} else {
-					h265, _ := stream.(h265parser.CodecData)
-					h265.SequnceHeaderTag = tag
-					self.Streams = append(self.Streams, h265)
-				}
-
+				self.Streams = append(self.Streams, stream)
 				self.GotVideo = true
 			}
 
 		case flvio.AVC_NALU:
+			if tag.FrameType == flvio.FRAME_KEY {
+				self.probeVP9FrameSize(tag.Data)
+			}
 			self.CacheTag(tag, timestamp)
 		}
 
@@ -127,7 +176,7 @@ func (self *Prober) PushTag(tag flvio.Tag, timestamp int32) (err error) {
 						err = fmt.Errorf("flv: aac seqhdr invalid")
 						return
 					}
-					stream.SequnceHeaderTag = tag
+					stream.SetSequenceHeaderTag(tag)
 					self.AudioStreamIdx = len(self.Streams)
 					self.Streams = append(self.Streams, stream)
 					self.GotAudio = true
@@ -146,6 +195,26 @@ func (self *Prober) PushTag(tag flvio.Tag, timestamp int32) (err error) {
 				self.CacheTag(tag, timestamp)
 			}
 
+		case flvio.SOUND_MP3:
+			if !self.GotAudio {
+				self.AudioStreamIdx = len(self.Streams)
+				self.Streams = append(self.Streams, newMP3CodecData(tag))
+				self.GotAudio = true
+			}
+			self.CacheTag(tag, timestamp)
+
+		case flvio.SOUND_ALAW, flvio.SOUND_MULAW:
+			if !self.GotAudio {
+				stream := codec.NewPCMAlawCodecData()
+				if tag.SoundFormat == flvio.SOUND_MULAW {
+					stream = codec.NewPCMMulawCodecData()
+				}
+				self.AudioStreamIdx = len(self.Streams)
+				self.Streams = append(self.Streams, stream)
+				self.GotAudio = true
+			}
+			self.CacheTag(tag, timestamp)
+
 		case flvio.SOUND_NELLYMOSER:
 			if !self.GotAudio {
 				stream := fake.CodecData{
@@ -166,10 +235,35 @@ func (self *Prober) PushTag(tag flvio.Tag, timestamp int32) (err error) {
 	return
 }
 
+// probeVP9FrameSize vpcC不带分辨率, 从第一个关键帧的帧头得到
+func (self *Prober) probeVP9FrameSize(data []byte) {
+	if !self.GotVideo {
+		return
+	}
+	vp9, ok := self.Streams[self.VideoStreamIdx].(vp9parser.CodecData)
+	if !ok || vp9.Width() != 0 {
+		return
+	}
+	if stream, err := vp9.WithKeyFrame(data); err == nil {
+		self.Streams[self.VideoStreamIdx] = stream
+	} else {
+		log.Debug().Err(err).Str("taskid", self.TaskID).Msg("flv: vp9 key frame header invalid")
+	}
+}
+
+// waitingVP9FrameSize VP9还没有从关键帧得到分辨率
+func (self *Prober) waitingVP9FrameSize() bool {
+	if !self.GotVideo || self.PushedCount >= MaxProbePacketCount {
+		return false
+	}
+	vp9, ok := self.Streams[self.VideoStreamIdx].(vp9parser.CodecData)
+	return ok && vp9.Width() == 0
+}
+
 func (self *Prober) Probed() (ok bool) {
 	if self.HasAudio || self.HasVideo {
 		if self.HasAudio == self.GotAudio && self.HasVideo == self.GotVideo {
-			return true
+			return !self.waitingVP9FrameSize()
 		}
 	} else {
 		if self.PushedCount == MaxProbePacketCount {
@@ -179,7 +273,12 @@ func (self *Prober) Probed() (ok bool) {
 	return
 }
 
+// TagToPacket 把tag转为packet, timestamp按32位回绕展开为64位的pkt.Time
 func (self *Prober) TagToPacket(tag flvio.Tag, timestamp int32) (pkt av.Packet, ok bool) {
+	var seqhdr bool
+	if self.rejected = self.Validate && !self.validateFrame(tag); self.rejected {
+		return
+	}
 	switch tag.Type {
 	case flvio.TAG_VIDEO:
 		pkt.Idx = int8(self.VideoStreamIdx)
@@ -191,14 +290,30 @@ func (self *Prober) TagToPacket(tag flvio.Tag, timestamp int32) (pkt av.Packet,
 			pkt.Data = tag.Data
 			pkt.CompositionTime = flvio.TsToTime(tag.CompositionTime)
 			pkt.IsKeyFrame = tag.FrameType == flvio.FRAME_KEY
+			if self.ParseSEI && tag.CodecID == flvio.VIDEO_H264 {
+				pkt.SEI, pkt.Captions = h264parser.ParseSEIFromNALUs(tag.Data)
+			}
+			if pkt.IsKeyFrame {
+				self.activateParameterSets(tag.Data)
+			}
+			if self.RecoveryPoint && !pkt.IsKeyFrame && tag.CodecID == flvio.VIDEO_H264 {
+				_, pkt.RecoveryPoint = h264parser.FindRecoveryPoint(tag.Data)
+			}
+			if codec, ok := self.h264(); ok && codec.MayBeInterlaced() {
+				pkt.Picture = codec.PictureStructure(tag.Data)
+			}
 		case flvio.AVC_SEQHDR:
-			ok = true
+			ok, seqhdr = true, true
 		}
 
 	case flvio.TAG_AUDIO:
 		pkt.Idx = int8(self.AudioStreamIdx)
 		pkt.DataType = int8(tag.Type)
 		pkt.AVCPacketType = tag.AACPacketType
+		if tag.SoundFormat != flvio.SOUND_AAC {
+			// 只有AAC有AACPacketType, 其它格式的0不能当作sequence header
+			pkt.AVCPacketType = flvio.AAC_RAW
+		}
 		switch tag.SoundFormat {
 		case flvio.SOUND_AAC:
 			switch tag.AACPacketType {
@@ -206,13 +321,17 @@ func (self *Prober) TagToPacket(tag flvio.Tag, timestamp int32) (pkt av.Packet,
 				ok = true
 				pkt.Data = tag.Data
 			case flvio.AAC_SEQHDR:
-				ok = true
+				ok, seqhdr = true, true
 			}
 
 		case flvio.SOUND_SPEEX:
 			ok = true
 			pkt.Data = tag.Data
 
+		case flvio.SOUND_MP3, flvio.SOUND_ALAW, flvio.SOUND_MULAW:
+			ok = true
+			pkt.Data = tag.Data
+
 		case flvio.SOUND_NELLYMOSER:
 			ok = true
 			pkt.Data = tag.Data
@@ -222,7 +341,15 @@ func (self *Prober) TagToPacket(tag flvio.Tag, timestamp int32) (pkt av.Packet,
 		ok = true
 	}
 
-	pkt.Time = flvio.TsToTime(timestamp)
+	// 推流端重发的sequence header时间戳常为0, 不作为回绕的参考
+	if seqhdr {
+		pkt.Time = self.clock.Peek(uint32(timestamp))
+	} else {
+		pkt.Time = self.clock.Unwrap(uint32(timestamp))
+	}
+	if ok && tag.Type == flvio.TAG_VIDEO && !seqhdr {
+		self.fps.Add(pkt.Time)
+	}
 	return
 }
 
@@ -236,22 +363,142 @@ func (self *Prober) PopPacket() av.Packet {
 	return pkt
 }
 
+// NewVideoCodecData 从视频sequence header创建CodecData, 支持传统tag和E-RTMP扩展头(hvc1)
+func NewVideoCodecData(tag flvio.Tag) (stream av.CodecData, err error) {
+	if tag.IsExHeader {
+		switch tag.FourCC {
+		case flvio.FOURCC_AVC1:
+		case flvio.FOURCC_HVC1:
+			var h265 h265parser.CodecData
+			if h265, err = h265parser.NewCodecDataFromHVCCDecoderConfRecord(tag.Data); err != nil {
+				err = fmt.Errorf("flv: hvc1 seqhdr invalid, error:%s", err.Error())
+				return
+			}
+			h265.SetSequenceHeaderTag(tag)
+			stream = h265
+			return
+		case flvio.FOURCC_AV01:
+			var av1 av1parser.CodecData
+			if av1, err = av1parser.NewCodecDataFromAV1CodecConfRecord(tag.Data); err != nil {
+				err = fmt.Errorf("flv: av01 seqhdr invalid, error:%s", err.Error())
+				return
+			}
+			av1.SetSequenceHeaderTag(tag)
+			stream = av1
+			return
+		case flvio.FOURCC_VP09:
+			var vp9 vp9parser.CodecData
+			if vp9, err = vp9parser.NewCodecDataFromVPCodecConfRecord(tag.Data); err != nil {
+				err = fmt.Errorf("flv: vp09 seqhdr invalid, error:%s", err.Error())
+				return
+			}
+			vp9.SetSequenceHeaderTag(tag)
+			stream = vp9
+			return
+		default:
+			err = fmt.Errorf("flv: unsupported video fourcc %s", flvio.FourCCString(tag.FourCC))
+			return
+		}
+	}
+	if tag.CodecID != flvio.VIDEO_H265 {
+		var h264 h264parser.CodecData
+		if h264, err = h264parser.NewCodecDataFromAVCDecoderConfRecord(tag.Data); err == nil {
+			h264.SetSequenceHeaderTag(tag)
+			stream = h264
+			return
+		}
+	}
+	var h265 h265parser.CodecData
+	if h265, err = h265parser.NewCodecDataFromHVCCDecoderConfRecord(tag.Data); err != nil {
+		err = fmt.Errorf("flv: h264 seqhdr invalid")
+		return
+	}
+	h265.SetSequenceHeaderTag(tag)
+	stream = h265
+	return
+}
+
+// h264 视频流的H.264 CodecData
+func (self *Prober) h264() (codec h264parser.CodecData, ok bool) {
+	if self.GotVideo {
+		codec, ok = self.Streams[self.VideoStreamIdx].(h264parser.CodecData)
+	}
+	return
+}
+
+// validateFrame 校验H.264/H.265帧, 不合法时计入统计并回调OnInvalidNALU
+func (self *Prober) validateFrame(tag flvio.Tag) bool {
+	if tag.Type != flvio.TAG_VIDEO || tag.AVCPacketType != flvio.AVC_NALU || !self.GotVideo {
+		return true
+	}
+	var lengthSize int
+	switch codec := self.Streams[self.VideoStreamIdx].(type) {
+	case h264parser.CodecData:
+		lengthSize = int(codec.RecordInfo.LengthSizeMinusOne) + 1
+	case h265parser.CodecData:
+		lengthSize = int(codec.RecordInfo.LengthSizeMinusOne) + 1
+	default:
+		return true
+	}
+	errs := h264parser.ValidateAVCC(tag.Data, lengthSize)
+	self.NALUStats.Add(errs)
+	if len(errs) == 0 {
+		return true
+	}
+	if self.OnInvalidNALU != nil {
+		self.OnInvalidNALU(tag, errs)
+	}
+	return false
+}
+
+// activateParameterSets record中有多组参数集时, 按关键帧引用的PPS切换生效的参数集
+func (self *Prober) activateParameterSets(frame []byte) {
+	codec, ok := self.h264()
+	if !ok || len(codec.RecordInfo.SPS)+len(codec.RecordInfo.PPS) <= 2 {
+		return
+	}
+	if _, err := codec.ActivateFrame(frame); err != nil {
+		return
+	}
+	self.Streams[self.VideoStreamIdx] = codec
+}
+
+func videoConfRecordBytes(stream av.CodecData) []byte {
+	switch codec := stream.(type) {
+	case h264parser.CodecData:
+		return codec.AVCDecoderConfRecordBytes()
+	case h265parser.CodecData:
+		return codec.AVCDecoderConfRecordBytes()
+	case av1parser.CodecData:
+		return codec.AV1CodecConfRecordBytes()
+	case vp9parser.CodecData:
+		return codec.VPCodecConfRecordBytes()
+	}
+	return nil
+}
+
 func (self *Prober) TagToHeader(tag flvio.Tag) (err error) {
 	switch tag.Type {
 	case flvio.TAG_VIDEO:
 		switch tag.AVCPacketType {
 		case flvio.AVC_SEQHDR:
-			var stream h264parser.CodecData
-			if stream, err = h264parser.NewCodecDataFromAVCDecoderConfRecord(tag.Data); err != nil {
-				err = fmt.Errorf("flv: h264 seqhdr invalid, error:" + err.Error())
+			var stream av.CodecData
+			if stream, err = NewVideoCodecData(tag); err != nil {
 				return
 			}
-			stream.SequnceHeaderTag = tag
+			stream = self.estimateFPS(stream)
 			if !self.GotVideo {
 				self.VideoStreamIdx = len(self.Streams)
 				self.Streams = append(self.Streams, stream)
 				self.GotVideo = true
 			} else {
+				// vpcC不带分辨率, 沿用之前关键帧的帧头直到下一个关键帧
+				if vp9, ok := stream.(vp9parser.CodecData); ok {
+					if prev, ok := self.Streams[self.VideoStreamIdx].(vp9parser.CodecData); ok {
+						vp9.FrameHeader = prev.FrameHeader
+						stream = vp9
+					}
+				}
 				self.Streams[self.VideoStreamIdx] = stream
 			}
 		}
@@ -265,7 +512,7 @@ func (self *Prober) TagToHeader(tag flvio.Tag) (err error) {
 					err = fmt.Errorf("flv: aac seqhdr invalid")
 					return
 				}
-				stream.SequnceHeaderTag = tag
+				stream.SetSequenceHeaderTag(tag)
 				if !self.GotAudio {
 					self.AudioStreamIdx = len(self.Streams)
 					self.Streams = append(self.Streams, stream)
@@ -284,11 +531,23 @@ func (self *Prober) HeaderChanged(tag flvio.Tag) (bool, error) {
 	var changed bool
 	switch tag.Type {
 	case flvio.TAG_VIDEO:
-		if !self.GotVideo || !bytes.Equal(tag.Data, self.Streams[self.VideoStreamIdx].(h264parser.CodecData).AVCDecoderConfRecordBytes()) {
+		if !self.GotVideo || !bytes.Equal(tag.Data, videoConfRecordBytes(self.Streams[self.VideoStreamIdx])) {
 			changed = true
 		}
+		// 轮换多组参数集的流, 重发的record只是参数集顺序或未生效的参数集不同时不算变化
+		if h264, ok := self.h264(); changed && ok && !tag.IsExHeader && tag.CodecID == flvio.VIDEO_H264 && tag.AVCPacketType == flvio.AVC_SEQHDR {
+			if next, updated, err := h264.Update(tag.Data); err == nil && !updated {
+				next.SetSequenceHeaderTag(tag)
+				self.Streams[self.VideoStreamIdx] = self.estimateFPS(next)
+				return false, nil
+			}
+		}
 	case flvio.TAG_AUDIO:
-		if !self.GotAudio || !bytes.Equal(tag.Data, self.Streams[self.AudioStreamIdx].(aacparser.CodecData).MPEG4AudioConfigBytes()) {
+		aac, isAAC := aacparser.CodecData{}, false
+		if self.GotAudio {
+			aac, isAAC = self.Streams[self.AudioStreamIdx].(aacparser.CodecData)
+		}
+		if !isAAC || !bytes.Equal(tag.Data, aac.MPEG4AudioConfigBytes()) {
 			changed = true
 		}
 	}
@@ -334,58 +593,102 @@ func (self *Prober) DigKeyFrame(data []byte) {
 	return
 }
 
+// SequenceHeaderCodecData 保存了推流端sequence header tag的CodecData, 新增编码只需实现该接口即可原样转发
+type SequenceHeaderCodecData interface {
+	av.CodecData
+	SequenceHeaderTag() (tag flvio.Tag, ok bool)
+}
+
+// seqHeaderTag 取出CodecData中保存的sequence header tag
+func seqHeaderTag(stream av.CodecData) (tag flvio.Tag, ok bool) {
+	if c, isSeq := stream.(SequenceHeaderCodecData); isSeq {
+		return c.SequenceHeaderTag()
+	}
+	return
+}
+
+// mpeg4AudioCodecData aacparser和aac两个包的AAC CodecData都能给出AudioSpecificConfig
+type mpeg4AudioCodecData interface {
+	av.AudioCodecData
+	MPEG4AudioConfigBytes() []byte
+}
+
 func CodecDataToTag(stream av.CodecData) (_tag flvio.Tag, ok bool, err error) {
 	switch stream.Type() {
 	case av.H264:
-		h264 := stream.(h264parser.CodecData)
-		tag := flvio.Tag{
+		// 优先转发推流端的tag, 由SPS/PPS创建的CodecData没有tag时按AVCDecoderConfigurationRecord生成
+		if seqhdr, isTag := seqHeaderTag(stream); isTag {
+			return seqhdr, true, nil
+		}
+		_tag = flvio.Tag{
 			Type:          flvio.TAG_VIDEO,
 			AVCPacketType: flvio.AVC_SEQHDR,
 			CodecID:       flvio.VIDEO_H264,
-			Data:          h264.AVCDecoderConfRecordBytes(),
+			Data:          stream.(h264parser.CodecData).AVCDecoderConfRecordBytes(),
 			FrameType:     flvio.FRAME_KEY,
 		}
-		tag = h264.SequnceHeaderTag.(flvio.Tag)
 		ok = true
-		_tag = tag
 	case av.H265:
-		h265c := stream.(h265parser.CodecData)
-		tag := flvio.Tag{
+		// 保留推流端的tag格式, E-RTMP扩展头的hvc1原样转发
+		if seqhdr, isTag := seqHeaderTag(stream); isTag {
+			return seqhdr, true, nil
+		}
+		_tag = flvio.Tag{
 			Type:          flvio.TAG_VIDEO,
 			AVCPacketType: flvio.AVC_SEQHDR,
 			CodecID:       flvio.VIDEO_H265,
-			Data:          h265c.AVCDecoderConfRecordBytes(),
+			Data:          stream.(h265parser.CodecData).AVCDecoderConfRecordBytes(),
+			FrameType:     flvio.FRAME_KEY,
+		}
+		ok = true
+	case av.AV1:
+		// AV1只能用E-RTMP扩展头
+		if seqhdr, isTag := seqHeaderTag(stream); isTag {
+			return seqhdr, true, nil
+		}
+		_tag = flvio.Tag{
+			Type:          flvio.TAG_VIDEO,
+			AVCPacketType: flvio.AVC_SEQHDR,
+			IsExHeader:    true,
+			ExPacketType:  flvio.PKTTYPE_SEQUENCE_START,
+			FourCC:        flvio.FOURCC_AV01,
+			Data:          stream.(av1parser.CodecData).AV1CodecConfRecordBytes(),
+			FrameType:     flvio.FRAME_KEY,
+		}
+		ok = true
+	case av.VP9:
+		// VP9只能用E-RTMP扩展头
+		if seqhdr, isTag := seqHeaderTag(stream); isTag {
+			return seqhdr, true, nil
+		}
+		_tag = flvio.Tag{
+			Type:          flvio.TAG_VIDEO,
+			AVCPacketType: flvio.AVC_SEQHDR,
+			IsExHeader:    true,
+			ExPacketType:  flvio.PKTTYPE_SEQUENCE_START,
+			FourCC:        flvio.FOURCC_VP09,
+			Data:          stream.(vp9parser.CodecData).VPCodecConfRecordBytes(),
 			FrameType:     flvio.FRAME_KEY,
 		}
 		ok = true
-		_tag = tag
 	case av.NELLYMOSER:
 	case av.SPEEX:
+	case av.MP3, av.PCM_ALAW, av.PCM_MULAW:
 
 	case av.AAC:
-		aac := stream.(aacparser.CodecData)
-		tag := flvio.Tag{
-			Type:          flvio.TAG_AUDIO,
-			SoundFormat:   flvio.SOUND_AAC,
-			SoundRate:     flvio.SOUND_44Khz,
-			AACPacketType: flvio.AAC_SEQHDR,
-			Data:          aac.MPEG4AudioConfigBytes(),
-		}
-		switch aac.SampleFormat().BytesPerSample() {
-		case 1:
-			tag.SoundSize = flvio.SOUND_8BIT
-		default:
-			tag.SoundSize = flvio.SOUND_16BIT
+		// 由ADTS/静音等生成的CodecData没有tag时按AudioSpecificConfig生成
+		if seqhdr, isTag := seqHeaderTag(stream); isTag {
+			return seqhdr, true, nil
 		}
-		switch aac.ChannelLayout().Count() {
-		case 1:
-			tag.SoundType = flvio.SOUND_MONO
-		case 2:
-			tag.SoundType = flvio.SOUND_STEREO
+		aac, isAAC := stream.(mpeg4AudioCodecData)
+		if !isAAC {
+			err = fmt.Errorf("flv: aac codec data has no sequence header")
+			return
 		}
-		tag = aac.SequnceHeaderTag.(flvio.Tag)
+		_tag = PacketTagHeader(stream)
+		_tag.AACPacketType = flvio.AAC_SEQHDR
+		_tag.Data = aac.MPEG4AudioConfigBytes()
 		ok = true
-		_tag = tag
 
 	default:
 		err = fmt.Errorf("flv: unspported codecType=%v", stream.Type())
@@ -394,33 +697,52 @@ func CodecDataToTag(stream av.CodecData) (_tag flvio.Tag, ok bool, err error) {
 	return
 }
 
-func PacketToTag(pkt av.Packet, stream av.CodecData) (tag flvio.Tag, timestamp int32) {
+// PacketTagHeader 预先计算stream的packet tag头, 除Data/FrameType/CompositionTime外每个packet都相同.
+// 同一路流连续写packet时缓存该结果再用FillPacketTag, 避免每个packet都对CodecData做类型断言
+func PacketTagHeader(stream av.CodecData) (tag flvio.Tag) {
 	switch stream.Type() {
 	case av.H264:
 		tag = flvio.Tag{
-			Type:            flvio.TAG_VIDEO,
-			AVCPacketType:   flvio.AVC_NALU,
-			CodecID:         flvio.VIDEO_H264,
-			Data:            pkt.Data,
-			CompositionTime: flvio.TimeToTs(pkt.CompositionTime),
-		}
-		if pkt.IsKeyFrame {
-			tag.FrameType = flvio.FRAME_KEY
-		} else {
-			tag.FrameType = flvio.FRAME_INTER
+			Type:          flvio.TAG_VIDEO,
+			AVCPacketType: flvio.AVC_NALU,
+			CodecID:       flvio.VIDEO_H264,
 		}
 	case av.H265:
 		tag = flvio.Tag{
-			Type:            flvio.TAG_VIDEO,
-			AVCPacketType:   flvio.AVC_NALU,
-			CodecID:         flvio.VIDEO_H265,
-			Data:            pkt.Data,
-			CompositionTime: flvio.TimeToTs(pkt.CompositionTime),
+			Type:          flvio.TAG_VIDEO,
+			AVCPacketType: flvio.AVC_NALU,
+			CodecID:       flvio.VIDEO_H265,
 		}
-		if pkt.IsKeyFrame {
-			tag.FrameType = flvio.FRAME_KEY
-		} else {
-			tag.FrameType = flvio.FRAME_INTER
+		if seqhdr, isTag := seqHeaderTag(stream); isTag && seqhdr.IsExHeader {
+			tag.IsExHeader = true
+			tag.FourCC = flvio.FOURCC_HVC1
+			tag.ExPacketType = flvio.PKTTYPE_CODED_FRAMES
+			tag.Multitrack = seqhdr.Multitrack
+			tag.TrackID = seqhdr.TrackID
+		}
+	case av.AV1:
+		tag = flvio.Tag{
+			Type:          flvio.TAG_VIDEO,
+			AVCPacketType: flvio.AVC_NALU,
+			IsExHeader:    true,
+			ExPacketType:  flvio.PKTTYPE_CODED_FRAMES,
+			FourCC:        flvio.FOURCC_AV01,
+		}
+		if seqhdr, isTag := seqHeaderTag(stream); isTag {
+			tag.Multitrack = seqhdr.Multitrack
+			tag.TrackID = seqhdr.TrackID
+		}
+	case av.VP9:
+		tag = flvio.Tag{
+			Type:          flvio.TAG_VIDEO,
+			AVCPacketType: flvio.AVC_NALU,
+			IsExHeader:    true,
+			ExPacketType:  flvio.PKTTYPE_CODED_FRAMES,
+			FourCC:        flvio.FOURCC_VP09,
+		}
+		if seqhdr, isTag := seqHeaderTag(stream); isTag {
+			tag.Multitrack = seqhdr.Multitrack
+			tag.TrackID = seqhdr.TrackID
 		}
 	case av.AAC:
 		tag = flvio.Tag{
@@ -428,7 +750,6 @@ func PacketToTag(pkt av.Packet, stream av.CodecData) (tag flvio.Tag, timestamp i
 			SoundFormat:   flvio.SOUND_AAC,
 			SoundRate:     flvio.SOUND_44Khz,
 			AACPacketType: flvio.AAC_RAW,
-			Data:          pkt.Data,
 		}
 		astream := stream.(av.AudioCodecData)
 		switch astream.SampleFormat().BytesPerSample() {
@@ -443,26 +764,102 @@ func PacketToTag(pkt av.Packet, stream av.CodecData) (tag flvio.Tag, timestamp i
 		case 2:
 			tag.SoundType = flvio.SOUND_STEREO
 		}
-
-		aac := stream.(aacparser.CodecData)
-		tagSeqHeader := aac.SequnceHeaderTag.(flvio.Tag)
-		tag.SoundRate = tagSeqHeader.SoundRate
+		if seqhdr, isTag := seqHeaderTag(stream); isTag {
+			tag.SoundRate = seqhdr.SoundRate
+		}
 	case av.SPEEX:
 		tag = flvio.Tag{
 			Type:        flvio.TAG_AUDIO,
 			SoundFormat: flvio.SOUND_SPEEX,
-			Data:        pkt.Data,
 		}
 
 	case av.NELLYMOSER:
 		tag = flvio.Tag{
 			Type:        flvio.TAG_AUDIO,
 			SoundFormat: flvio.SOUND_NELLYMOSER,
-			Data:        pkt.Data,
+		}
+
+	case av.MP3:
+		astream := stream.(av.AudioCodecData)
+		tag = flvio.Tag{
+			Type:        flvio.TAG_AUDIO,
+			SoundFormat: flvio.SOUND_MP3,
+			SoundRate:   flvSoundRate(astream.SampleRate()),
+			SoundSize:   flvio.SOUND_16BIT,
+			SoundType:   flvio.SOUND_STEREO,
+		}
+		if astream.ChannelLayout().Count() == 1 {
+			tag.SoundType = flvio.SOUND_MONO
+		}
+
+	case av.PCM_ALAW, av.PCM_MULAW:
+		// G.711固定为8kHz单声道, SoundRate/SoundType按规范填写
+		tag = flvio.Tag{
+			Type:        flvio.TAG_AUDIO,
+			SoundFormat: flvio.SOUND_ALAW,
+			SoundRate:   flvio.SOUND_5_5Khz,
+			SoundSize:   flvio.SOUND_16BIT,
+			SoundType:   flvio.SOUND_MONO,
+		}
+		if stream.Type() == av.PCM_MULAW {
+			tag.SoundFormat = flvio.SOUND_MULAW
 		}
 	}
+	return
+}
+
+// flvSoundRate 采样率对应的tag SoundRate, 不在5.5k/11k/22k中的都按44k
+func flvSoundRate(sampleRate int) uint8 {
+	switch {
+	case sampleRate <= 8000:
+		return flvio.SOUND_5_5Khz
+	case sampleRate <= 12000:
+		return flvio.SOUND_11Khz
+	case sampleRate <= 24000:
+		return flvio.SOUND_22Khz
+	}
+	return flvio.SOUND_44Khz
+}
 
-	timestamp = flvio.TimeToTs(pkt.Time)
+// newMP3CodecData 采样率和声道优先从MP3帧头得到, tag中的SoundRate只有4种取值
+func newMP3CodecData(tag flvio.Tag) av.AudioCodecData {
+	if stream, err := mp3parser.NewCodecDataFromFrame(tag.Data); err == nil {
+		return stream
+	}
+	sampleRate := 44100
+	switch tag.SoundRate {
+	case flvio.SOUND_5_5Khz:
+		sampleRate = 8000
+	case flvio.SOUND_11Khz:
+		sampleRate = 11025
+	case flvio.SOUND_22Khz:
+		sampleRate = 22050
+	}
+	return mp3parser.NewCodecData(sampleRate, tag.ChannelLayout())
+}
+
+// FillPacketTag 在PacketTagHeader返回的tag头的拷贝上填充packet
+func FillPacketTag(tag *flvio.Tag, pkt av.Packet) (timestamp int32) {
+	tag.Data = pkt.Data
+	if tag.Type == flvio.TAG_VIDEO {
+		tag.CompositionTime = flvio.TimeToTs(pkt.CompositionTime)
+		// 只有avc1/hvc1的CodedFrames带CompositionTime
+		if tag.IsExHeader && tag.CompositionTime == 0 && tag.FourCC != flvio.FOURCC_AV01 && tag.FourCC != flvio.FOURCC_VP09 {
+			tag.ExPacketType = flvio.PKTTYPE_CODED_FRAMESX
+		}
+		if pkt.IsKeyFrame {
+			tag.FrameType = flvio.FRAME_KEY
+		} else {
+			tag.FrameType = flvio.FRAME_INTER
+		}
+	}
+	// 64位时间按32位回绕写出, 与读取时的展开对应
+	return int32(pkt.Time.MsU32())
+}
+
+func PacketToTag(pkt av.Packet, stream av.CodecData) (tag flvio.Tag, timestamp int32) {
+	tag = PacketTagHeader(stream)
+	timestamp = FillPacketTag(&tag, pkt)
 	return
 }
 
@@ -470,6 +867,7 @@ type Muxer struct {
 	bufw          writeFlusher
 	b             []byte
 	streams       []av.CodecData
+	tagHdrs       []flvio.Tag
 	flvHeaderSent bool
 }
 
@@ -489,7 +887,7 @@ func NewMuxer(w io.Writer) *Muxer {
 	return NewMuxerWriteFlusher(bufio.NewWriterSize(w, pio.RecommendBufioSize))
 }
 
-var CodecTypes = []av.CodecType{av.H264, av.AAC, av.SPEEX, av.H265}
+var CodecTypes = []av.CodecType{av.H264, av.AAC, av.SPEEX, av.H265, av.AV1, av.VP9, av.MP3, av.PCM_ALAW, av.PCM_MULAW}
 
 func (self *Muxer) WriteHeader(streams []av.CodecData) (err error) {
 	if len(streams) == 0 {
@@ -526,17 +924,21 @@ func (self *Muxer) WriteHeader(streams []av.CodecData) (err error) {
 	}
 
 	self.streams = streams
+	self.tagHdrs = make([]flvio.Tag, len(streams))
+	for i, stream := range streams {
+		self.tagHdrs[i] = PacketTagHeader(stream)
+	}
 	return
 }
 
 func (self *Muxer) WritePacket(pkt av.Packet) (err error) {
-	stream := self.streams[pkt.Idx]
-	tag, timestamp := PacketToTag(pkt, stream)
+	tag := self.tagHdrs[pkt.Idx]
+	timestamp := FillPacketTag(&tag, pkt)
 
 	if err = flvio.WriteTag(self.bufw, tag, timestamp, self.b); err != nil {
 		return
 	}
-	if pkt.DataType == int8(flvio.TAG_VIDEO) {
+	if pkt.IsVideo() {
 		if err = self.bufw.Flush(); err != nil {
 			err = fmt.Errorf("flv.Muxer Flush error: %v", err)
 			return
@@ -556,8 +958,10 @@ func (self *Muxer) VideoResolution() (width uint32, height uint32) {
 	headers := self.streams
 	for _, h := range headers {
 		if h.Type() == av.H264 {
-			data := h.(h264parser.CodecData)
-			tag := data.SequnceHeaderTag.(flvio.Tag)
+			tag, ok := h.(h264parser.CodecData).SequenceHeaderTag()
+			if !ok {
+				continue
+			}
 			videoHdr, _ := h264parser.NewCodecDataFromAVCDecoderConfRecord(tag.Data)
 			width = uint32(videoHdr.SPSInfo.Width)
 			height = uint32(videoHdr.SPSInfo.Height)
@@ -588,6 +992,11 @@ func NewDemuxer(r io.ReadCloser) *Demuxer {
 	}
 }
 
+// SetParseSEI 读取时解析H.264帧中的SEI消息和字幕, 默认关闭
+func (self *Demuxer) SetParseSEI(enable bool) {
+	self.prober.ParseSEI = enable
+}
+
 func (self *Demuxer) prepare() (err error) {
 	for self.stage < 2 {
 		switch self.stage {
@@ -668,7 +1077,7 @@ func (self *Demuxer) Close() error {
 
 func Handler(h *avutil.RegisterHandler) {
 	h.Probe = func(b []byte) bool {
-		return b[0] == 'F' && b[1] == 'L' && b[2] == 'V'
+		return len(b) >= 3 && b[0] == 'F' && b[1] == 'L' && b[2] == 'V'
 	}
 
 	h.Ext = ".flv"
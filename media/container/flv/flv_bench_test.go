@@ -0,0 +1,161 @@
+package flv
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/bugVanisher/streamer/media/av"
+	"github.com/bugVanisher/streamer/media/codec/aacparser"
+	"github.com/bugVanisher/streamer/media/codec/h264parser"
+	"github.com/bugVanisher/streamer/media/container/flv/flvio"
+)
+
+// 热点路径基准, go test -run xxx -bench . -benchmem
+// WriteHeader时预先计算tag头后(ns/op): MuxerWritePacket 77 -> 62, 每个AAC packet的tag 16 -> 2.8,
+// CodecDataToTag/H264 59 -> 5.5
+func benchStreams(b *testing.B) []av.CodecData {
+	aac, err := aacparser.NewCodecDataFromMPEG4AudioConfigBytes([]byte{0x12, 0x10})
+	if err != nil {
+		b.Fatal(err)
+	}
+	aac.SetSequenceHeaderTag(flvio.Tag{
+		Type:          flvio.TAG_AUDIO,
+		SoundFormat:   flvio.SOUND_AAC,
+		SoundRate:     flvio.SOUND_44Khz,
+		SoundSize:     flvio.SOUND_16BIT,
+		SoundType:     flvio.SOUND_STEREO,
+		AACPacketType: flvio.AAC_SEQHDR,
+		Data:          aac.ConfigBytes,
+	})
+	sps := []byte{0x67, 0x64, 0x00, 0x1e, 0xac, 0xd9, 0x40, 0xa0, 0x2f, 0xf9, 0x70, 0x11, 0x00, 0x00, 0x03,
+		0x00, 0x01, 0x00, 0x00, 0x03, 0x00, 0x32, 0x0f, 0x16, 0x2d, 0x96}
+	pps := []byte{0x68, 0xeb, 0xe3, 0xcb, 0x22, 0xc0}
+	h264, err := h264parser.NewCodecDataFromSPSAndPPS(sps, pps)
+	if err != nil {
+		b.Fatal(err)
+	}
+	h264.SetSequenceHeaderTag(flvio.Tag{
+		Type:          flvio.TAG_VIDEO,
+		FrameType:     flvio.FRAME_KEY,
+		CodecID:       flvio.VIDEO_H264,
+		AVCPacketType: flvio.AVC_SEQHDR,
+		Data:          h264.Record,
+	})
+	return []av.CodecData{h264, aac}
+}
+
+func benchPackets() []av.Packet {
+	return []av.Packet{
+		{Idx: 0, DataType: flvio.TAG_VIDEO, AVCPacketType: av.AVC_NALU, IsKeyFrame: true,
+			Time: av.MediaTimeFromDuration(40 * time.Millisecond), CompositionTime: 80 * time.Millisecond, Data: make([]byte, 4096)},
+		{Idx: 1, DataType: flvio.TAG_AUDIO, AVCPacketType: av.AVC_NALU,
+			Time: av.MediaTimeFromDuration(43 * time.Millisecond), Data: make([]byte, 256)},
+	}
+}
+
+func BenchmarkPacketToTag(b *testing.B) {
+	streams := benchStreams(b)
+	for _, pkt := range benchPackets() {
+		pkt := pkt
+		stream := streams[pkt.Idx]
+		b.Run(stream.Type().String(), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				PacketToTag(pkt, stream)
+			}
+		})
+	}
+}
+
+func BenchmarkFillPacketTag(b *testing.B) {
+	streams := benchStreams(b)
+	for _, pkt := range benchPackets() {
+		pkt := pkt
+		hdr := PacketTagHeader(streams[pkt.Idx])
+		b.Run(streams[pkt.Idx].Type().String(), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				tag := hdr
+				FillPacketTag(&tag, pkt)
+			}
+		})
+	}
+}
+
+func BenchmarkCodecDataToTag(b *testing.B) {
+	for _, stream := range benchStreams(b) {
+		stream := stream
+		b.Run(stream.Type().String(), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				CodecDataToTag(stream)
+			}
+		})
+	}
+}
+
+func BenchmarkTagToPacket(b *testing.B) {
+	streams := benchStreams(b)
+	prober := &Prober{Streams: streams, VideoStreamIdx: 0, AudioStreamIdx: 1}
+	for _, pkt := range benchPackets() {
+		tag, ts := PacketToTag(pkt, streams[pkt.Idx])
+		b.Run(streams[pkt.Idx].Type().String(), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				prober.TagToPacket(tag, ts)
+			}
+		})
+	}
+}
+
+func BenchmarkMuxerWritePacket(b *testing.B) {
+	streams := benchStreams(b)
+	pkts := benchPackets()
+	m := NewMuxer(io.Discard)
+	if err := m.WriteHeader(streams); err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := m.WritePacket(pkts[i&1]); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDemuxerReadPacket(b *testing.B) {
+	streams := benchStreams(b)
+	pkts := benchPackets()
+	w := &bytes.Buffer{}
+	m := NewMuxer(w)
+	if err := m.WriteHeader(streams); err != nil {
+		b.Fatal(err)
+	}
+	for i := 0; i < 1000; i++ {
+		if err := m.WritePacket(pkts[i&1]); err != nil {
+			b.Fatal(err)
+		}
+	}
+	if err := m.WriteTrailer(); err != nil {
+		b.Fatal(err)
+	}
+	data := w.Bytes()
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		d := NewDemuxer(io.NopCloser(bytes.NewReader(data)))
+		for {
+			if _, err := d.ReadPacket(); err != nil {
+				if err != io.EOF {
+					b.Fatal(err)
+				}
+				break
+			}
+		}
+	}
+}
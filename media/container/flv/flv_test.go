@@ -2,11 +2,17 @@ package flv
 
 import (
 	"io"
+	"math"
 	"os"
 	"testing"
-	"time"
 
 	"github.com/stretchr/testify/require"
+
+	"github.com/bugVanisher/streamer/media/av"
+	"github.com/bugVanisher/streamer/media/codec/aacparser"
+	"github.com/bugVanisher/streamer/media/codec/h264parser"
+	"github.com/bugVanisher/streamer/media/codec/vp9parser"
+	"github.com/bugVanisher/streamer/media/container/flv/flvio"
 )
 
 func TestDemuxer(t *testing.T) {
@@ -26,8 +32,216 @@ func TestDemuxer(t *testing.T) {
 				break
 			}
 		}
-		t.Logf("pkt.Time:%d\n", pkt.Time/time.Millisecond)
+		t.Logf("pkt.Time:%d\n", pkt.Time.Ms())
 		count++
 	}
 	require.Equal(t, 14336, count)
 }
+
+func TestProberTimestampRollover(t *testing.T) {
+	p := &Prober{}
+	nalu := flvio.Tag{Type: flvio.TAG_VIDEO, AVCPacketType: flvio.AVC_NALU, Data: []byte{1}}
+	seqhdr := flvio.Tag{Type: flvio.TAG_VIDEO, AVCPacketType: flvio.AVC_SEQHDR}
+
+	var times []av.MediaTime
+	for _, ts := range []uint32{math.MaxInt32 - 40, math.MaxInt32 + 40, math.MaxUint32 - 10, 30} {
+		pkt, ok := p.TagToPacket(nalu, int32(ts))
+		require.True(t, ok)
+		times = append(times, pkt.Time)
+	}
+	require.Equal(t, []av.MediaTime{
+		av.MediaTimeFromMsU32(math.MaxInt32 - 40),
+		av.MediaTimeFromMsU32(math.MaxInt32 + 40),
+		av.MediaTimeFromMsU32(math.MaxUint32 - 10),
+		av.MediaTimeFromMsU32(math.MaxUint32) + av.MediaTimeFromMs(31),
+	}, times)
+
+	// 时间戳为0的sequence header不影响之后的展开
+	p.TagToPacket(seqhdr, 0)
+	pkt, _ := p.TagToPacket(nalu, 70)
+	require.Equal(t, av.MediaTimeFromMsU32(math.MaxUint32)+av.MediaTimeFromMs(71), pkt.Time)
+
+	// 写出时按32位回绕
+	tag := nalu
+	require.Equal(t, int32(70), FillPacketTag(&tag, pkt))
+}
+
+func TestProberVP9(t *testing.T) {
+	// profile 0, 1280x720的关键帧头部
+	keyframe := []byte{0x82, 0x49, 0x83, 0x42, 0x40, 0x4f, 0xf0, 0x2c, 0xf0, 0x00}
+	stream, err := vp9parser.NewCodecDataFromKeyFrame(keyframe)
+	require.Nil(t, err)
+
+	seqhdr, ok, err := CodecDataToTag(stream)
+	require.Nil(t, err)
+	require.True(t, ok)
+	require.True(t, seqhdr.IsExHeader)
+	require.Equal(t, uint32(flvio.FOURCC_VP09), seqhdr.FourCC)
+
+	// vpcC不带分辨率, 等到关键帧才探测完成
+	p := &Prober{HasVideo: true}
+	require.Nil(t, p.PushTag(seqhdr, 0))
+	require.False(t, p.Probed())
+	tag, _ := PacketToTag(av.Packet{IsKeyFrame: true, Data: keyframe}, stream)
+	require.Equal(t, uint8(flvio.PKTTYPE_CODED_FRAMES), tag.ExPacketType)
+	require.Nil(t, p.PushTag(tag, 0))
+	require.True(t, p.Probed())
+	require.Equal(t, "1280x720", p.Streams[0].(vp9parser.CodecData).Resolution())
+
+	// 重发的sequence header沿用之前的分辨率
+	require.Nil(t, p.TagToHeader(seqhdr))
+	require.Equal(t, 1280, p.Streams[0].(av.VideoCodecData).Width())
+}
+
+func TestProberMP3(t *testing.T) {
+	// MPEG-2 Layer III, 22.05kHz, mono, tag中的SoundRate为44k
+	frame := []byte{0xff, 0xf3, 0x80, 0xc0, 0x00, 0x00}
+	tag := flvio.Tag{Type: flvio.TAG_AUDIO, SoundFormat: flvio.SOUND_MP3, SoundRate: flvio.SOUND_44Khz,
+		SoundType: flvio.SOUND_STEREO, Data: frame}
+	p := &Prober{HasAudio: true}
+	require.Nil(t, p.PushTag(tag, 0))
+	require.True(t, p.Probed())
+	stream := p.Streams[0].(av.AudioCodecData)
+	require.Equal(t, av.MP3, stream.Type())
+	require.Equal(t, 22050, stream.SampleRate())
+	require.Equal(t, av.CH_MONO, stream.ChannelLayout())
+
+	// MP3没有sequence header, packet不能被当作AAC_SEQHDR
+	pkt := p.PopPacket()
+	require.False(t, pkt.IsSequenceHeader())
+	require.Equal(t, frame, pkt.Data)
+
+	out, _ := PacketToTag(pkt, stream)
+	require.Equal(t, []uint8{flvio.SOUND_MP3, flvio.SOUND_22Khz, flvio.SOUND_MONO}, []uint8{out.SoundFormat, out.SoundRate, out.SoundType})
+	metadata, err := NewMetadataByStreams(p.Streams)
+	require.Nil(t, err)
+	require.Equal(t, flvio.SOUND_MP3, metadata["audiocodecid"])
+}
+
+func TestProberG711(t *testing.T) {
+	for _, c := range []struct {
+		format uint8
+		typ    av.CodecType
+	}{{flvio.SOUND_ALAW, av.PCM_ALAW}, {flvio.SOUND_MULAW, av.PCM_MULAW}} {
+		tag := flvio.Tag{Type: flvio.TAG_AUDIO, SoundFormat: c.format, Data: make([]byte, 160)}
+		p := &Prober{HasAudio: true}
+		require.Nil(t, p.PushTag(tag, 0))
+		require.True(t, p.Probed())
+		stream := p.Streams[0].(av.AudioCodecData)
+		require.Equal(t, c.typ, stream.Type())
+		require.Equal(t, 8000, stream.SampleRate())
+
+		pkt := p.PopPacket()
+		require.False(t, pkt.IsSequenceHeader())
+		out, _ := PacketToTag(pkt, stream)
+		require.Equal(t, []uint8{c.format, flvio.SOUND_MONO}, []uint8{out.SoundFormat, out.SoundType})
+		_, ok, err := CodecDataToTag(stream)
+		require.Nil(t, err)
+		require.False(t, ok)
+	}
+}
+
+func TestProberValidate(t *testing.T) {
+	sps := []byte{0x67, 0x64, 0x00, 0x1e, 0xac, 0xd9, 0x40, 0xa0, 0x2f, 0xf9, 0x70, 0x11, 0x00, 0x00, 0x03,
+		0x00, 0x01, 0x00, 0x00, 0x03, 0x00, 0x32, 0x0f, 0x16, 0x2d, 0x96}
+	pps := []byte{0x68, 0xeb, 0xe3, 0xcb, 0x22, 0xc0}
+	stream, err := h264parser.NewCodecDataFromSPSAndPPS(sps, pps)
+	require.Nil(t, err)
+	seqhdr, _, err := CodecDataToTag(stream)
+	require.Nil(t, err)
+
+	var invalid []h264parser.NALUErrors
+	p := &Prober{HasVideo: true, Validate: true}
+	p.OnInvalidNALU = func(tag flvio.Tag, errs h264parser.NALUErrors) {
+		invalid = append(invalid, errs)
+	}
+	frame := func(key bool, data []byte) flvio.Tag {
+		tag := flvio.Tag{Type: flvio.TAG_VIDEO, CodecID: flvio.VIDEO_H264, AVCPacketType: flvio.AVC_NALU, FrameType: flvio.FRAME_INTER, Data: data}
+		if key {
+			tag.FrameType = flvio.FRAME_KEY
+		}
+		return tag
+	}
+	require.Nil(t, p.PushTag(seqhdr, 0))
+	// 探测阶段不合法的帧不被缓存
+	require.Nil(t, p.PushTag(frame(true, []byte{0, 0, 0, 9, 0x65}), 0))
+	require.Nil(t, p.PushTag(frame(true, []byte{0, 0, 0, 2, 0x65, 0x88}), 0))
+	require.True(t, p.Probed())
+	require.Equal(t, []byte{0, 0, 0, 2, 0x65, 0x88}, p.PopPacket().Data)
+	require.True(t, p.Empty())
+
+	_, ok := p.TagToPacket(frame(false, []byte{0, 0, 0, 0, 0, 0, 0, 1, 0xc1}), 40)
+	require.False(t, ok)
+	pkt, ok := p.TagToPacket(frame(false, []byte{0, 0, 0, 1, 0x41}), 80)
+	require.True(t, ok)
+	require.Equal(t, []byte{0, 0, 0, 1, 0x41}, pkt.Data)
+	_, ok = p.TagToPacket(seqhdr, 80)
+	require.True(t, ok)
+
+	require.Equal(t, 2, len(invalid))
+	require.Equal(t, h264parser.NALUTruncated, invalid[0][0].Kind)
+	require.Equal(t, h264parser.NALUStats{Frames: 4, InvalidFrames: 2, ZeroLength: 1, ForbiddenBit: 1, Truncated: 1}, p.NALUStats)
+}
+
+func TestProberRecoveryPoint(t *testing.T) {
+	sei := h264parser.MarshalSEINALU(h264parser.SEI_RECOVERY_POINT, []byte{0xc0})
+	data := []byte{0, 0, 0, byte(len(sei))}
+	data = append(append(data, sei...), 0, 0, 0, 2, 0x41, 0x9a)
+	tag := flvio.Tag{Type: flvio.TAG_VIDEO, CodecID: flvio.VIDEO_H264, AVCPacketType: flvio.AVC_NALU, FrameType: flvio.FRAME_INTER, Data: data}
+
+	p := &Prober{HasVideo: true}
+	pkt, ok := p.TagToPacket(tag, 0)
+	require.True(t, ok)
+	require.False(t, pkt.RecoveryPoint)
+
+	p.RecoveryPoint = true
+	pkt, ok = p.TagToPacket(tag, 40)
+	require.True(t, ok)
+	require.True(t, pkt.RecoveryPoint)
+	require.False(t, pkt.IsKeyFrame)
+}
+
+func TestProberEstimateFPS(t *testing.T) {
+	keyframe := []byte{0x82, 0x49, 0x83, 0x42, 0x40, 0x4f, 0xf0, 0x2c, 0xf0, 0x00}
+	stream, err := vp9parser.NewCodecDataFromKeyFrame(keyframe)
+	require.Nil(t, err)
+	seqhdr, _, err := CodecDataToTag(stream)
+	require.Nil(t, err)
+	tag, _ := PacketToTag(av.Packet{IsKeyFrame: true, Data: keyframe}, stream)
+
+	p := &Prober{HasVideo: true}
+	require.Nil(t, p.PushTag(seqhdr, 0))
+	require.Equal(t, 0, p.Streams[0].(vp9parser.CodecData).FPS())
+	for i := 0; i < 10; i++ {
+		_, ok := p.TagToPacket(tag, int32(i*40))
+		require.True(t, ok)
+	}
+	require.Equal(t, 25, p.Streams[0].(vp9parser.CodecData).FPS())
+
+	// 重发的sequence header不影响估计
+	_, err = p.HeaderChanged(seqhdr)
+	require.Nil(t, err)
+	require.Nil(t, p.TagToHeader(seqhdr))
+	require.Equal(t, 25, p.Streams[0].(vp9parser.CodecData).FPS())
+}
+
+type aacNoConfig struct{}
+
+func (aacNoConfig) Type() av.CodecType { return av.AAC }
+
+func TestCodecDataToTagAAC(t *testing.T) {
+	// 没有保存sequence header的AAC按AudioSpecificConfig生成
+	stream, err := aacparser.NewSilenceCodecData(48000, av.CH_STEREO)
+	require.Nil(t, err)
+	tag, ok, err := CodecDataToTag(stream)
+	require.Nil(t, err)
+	require.True(t, ok)
+	require.Equal(t, []uint8{flvio.TAG_AUDIO, flvio.SOUND_AAC, flvio.AAC_SEQHDR, flvio.SOUND_STEREO},
+		[]uint8{tag.Type, tag.SoundFormat, tag.AACPacketType, tag.SoundType})
+	require.Equal(t, stream.MPEG4AudioConfigBytes(), tag.Data)
+
+	// 无法生成时返回错误, 不能写出空tag
+	_, ok, err = CodecDataToTag(aacNoConfig{})
+	require.NotNil(t, err)
+	require.False(t, ok)
+}
@@ -458,6 +458,15 @@ func parseAMF0Val(b []byte, offset int) (val interface{}, n int, err error) {
 		val = string(b[n : n+length])
 		n += length
 
+	case avmplusobjectmarker:
+		// 切换为AMF3编码的一个值
+		var nval int
+		if val, nval, err = ParseAMF3Val(b[n:]); err != nil {
+			err = amf0ParseErr("avmplus: "+err.Error(), offset+n, nil)
+			return
+		}
+		n += nval
+
 	default:
 		err = amf0ParseErr(fmt.Sprintf("invalidmarker=%d", marker), offset+n, err)
 		return
@@ -0,0 +1,716 @@
+package flvio
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bugVanisher/streamer/utils/bits/pio"
+)
+
+type AMF3ParseError struct {
+	Offset  int
+	Message string
+	Next    *AMF3ParseError
+}
+
+func (self *AMF3ParseError) Error() string {
+	s := []string{}
+	for p := self; p != nil; p = p.Next {
+		s = append(s, fmt.Sprintf("%s:%d", p.Message, p.Offset))
+	}
+	return "amf3 parse error: " + strings.Join(s, ",")
+}
+
+func amf3ParseErr(message string, offset int, err error) error {
+	next, _ := err.(*AMF3ParseError)
+	return &AMF3ParseError{
+		Offset:  offset,
+		Message: message,
+		Next:    next,
+	}
+}
+
+const (
+	amf3IntMin = -(1 << 28)
+	amf3IntMax = 1<<28 - 1
+)
+
+// amf3Traits object的traits信息
+type amf3Traits struct {
+	dynamic bool
+	sealed  []string
+}
+
+// amf3Decoder 保存一次AMF3解析上下文中的string/object/traits引用表
+type amf3Decoder struct {
+	strings []string
+	objects []interface{}
+	traits  []*amf3Traits
+}
+
+// ParseAMF3Val 解析一个AMF3值, 每次调用使用新的引用表.
+// integer/double统一解析为float64, object解析为AMFMap, 带关联部分的array解析为AMFECMAArray,
+// 否则为AMFArray, ByteArray解析为[]byte.
+func ParseAMF3Val(b []byte) (val interface{}, n int, err error) {
+	d := &amf3Decoder{}
+	return d.parseVal(b, 0)
+}
+
+func parseU29(b []byte) (v uint32, n int, ok bool) {
+	for n < 4 {
+		if len(b) <= n {
+			return
+		}
+		c := b[n]
+		n++
+		if n == 4 {
+			v = v<<8 | uint32(c)
+			ok = true
+			return
+		}
+		v = v<<7 | uint32(c&0x7f)
+		if c&0x80 == 0 {
+			ok = true
+			return
+		}
+	}
+	return
+}
+
+func (self *amf3Decoder) parseU29(b []byte, offset int, message string) (v uint32, n int, err error) {
+	var ok bool
+	if v, n, ok = parseU29(b); !ok {
+		err = amf3ParseErr(message, offset, nil)
+	}
+	return
+}
+
+func (self *amf3Decoder) parseString(b []byte, offset int) (s string, n int, err error) {
+	var u uint32
+	if u, n, err = self.parseU29(b, offset, "string.length"); err != nil {
+		return
+	}
+	if u&1 == 0 {
+		idx := int(u >> 1)
+		if idx >= len(self.strings) {
+			err = amf3ParseErr(fmt.Sprintf("string.ref=%d", idx), offset+n, nil)
+			return
+		}
+		s = self.strings[idx]
+		return
+	}
+	length := int(u >> 1)
+	if len(b) < n+length {
+		err = amf3ParseErr("string.body", offset+n, nil)
+		return
+	}
+	s = string(b[n : n+length])
+	n += length
+	if length > 0 {
+		self.strings = append(self.strings, s)
+	}
+	return
+}
+
+// parseRef 解析object类型的U29头, 是引用时返回被引用的值
+func (self *amf3Decoder) parseRef(b []byte, offset int, message string) (u uint32, ref interface{}, isref bool, n int, err error) {
+	if u, n, err = self.parseU29(b, offset, message); err != nil {
+		return
+	}
+	if u&1 == 0 {
+		idx := int(u >> 1)
+		if idx >= len(self.objects) {
+			err = amf3ParseErr(fmt.Sprintf("%s.ref=%d", message, idx), offset+n, nil)
+			return
+		}
+		ref, isref = self.objects[idx], true
+	}
+	u >>= 1
+	return
+}
+
+func (self *amf3Decoder) parseVal(b []byte, offset int) (val interface{}, n int, err error) {
+	if len(b) < n+1 {
+		err = amf3ParseErr("marker", offset+n, err)
+		return
+	}
+	marker := b[n]
+	n++
+
+	var size int
+	switch marker {
+	case amf3undefinedmarker, amf3nullmarker:
+
+	case amf3falsemarker:
+		val = false
+
+	case amf3truemarker:
+		val = true
+
+	case amf3integermarker:
+		var u uint32
+		if u, size, err = self.parseU29(b[n:], offset+n, "integer"); err != nil {
+			return
+		}
+		n += size
+		i := int32(u)
+		if u&0x10000000 != 0 {
+			i -= 1 << 29
+		}
+		val = float64(i)
+
+	case amf3doublemarker:
+		if len(b) < n+8 {
+			err = amf3ParseErr("double", offset+n, err)
+			return
+		}
+		val = parseBEFloat64(b[n:])
+		n += 8
+
+	case amf3stringmarker:
+		if val, size, err = self.parseString(b[n:], offset+n); err != nil {
+			return
+		}
+		n += size
+
+	case amf3xmldocmarker, amf3xmlmarker:
+		var u uint32
+		var isref bool
+		if u, val, isref, size, err = self.parseRef(b[n:], offset+n, "xml"); err != nil || isref {
+			n += size
+			return
+		}
+		n += size
+		length := int(u)
+		if len(b) < n+length {
+			err = amf3ParseErr("xml.body", offset+n, err)
+			return
+		}
+		val = string(b[n : n+length])
+		n += length
+		self.objects = append(self.objects, val)
+
+	case amf3datemarker:
+		var isref bool
+		if _, val, isref, size, err = self.parseRef(b[n:], offset+n, "date"); err != nil || isref {
+			n += size
+			return
+		}
+		n += size
+		if len(b) < n+8 {
+			err = amf3ParseErr("date", offset+n, err)
+			return
+		}
+		ts := parseBEFloat64(b[n:])
+		n += 8
+		val = time.Unix(int64(ts/1000), (int64(ts)%1000)*1000000)
+		self.objects = append(self.objects, val)
+
+	case amf3arraymarker:
+		var u uint32
+		var isref bool
+		if u, val, isref, size, err = self.parseRef(b[n:], offset+n, "array"); err != nil || isref {
+			n += size
+			return
+		}
+		n += size
+		count := int(u)
+		idx := len(self.objects)
+		self.objects = append(self.objects, nil)
+
+		assoc := AMFECMAArray{}
+		for {
+			var key string
+			if key, size, err = self.parseString(b[n:], offset+n); err != nil {
+				err = amf3ParseErr("array.key", offset+n, err)
+				return
+			}
+			n += size
+			if key == "" {
+				break
+			}
+			var aval interface{}
+			if aval, size, err = self.parseVal(b[n:], offset+n); err != nil {
+				err = amf3ParseErr("array.assoc", offset+n, err)
+				return
+			}
+			n += size
+			assoc[key] = aval
+		}
+		if count > len(b)-n {
+			err = amf3ParseErr("array.count", offset+n, err)
+			return
+		}
+		dense := make(AMFArray, count)
+		for i := range dense {
+			if dense[i], size, err = self.parseVal(b[n:], offset+n); err != nil {
+				err = amf3ParseErr("array.dense", offset+n, err)
+				return
+			}
+			n += size
+		}
+		if len(assoc) == 0 {
+			val = dense
+		} else {
+			for i, v := range dense {
+				assoc[strconv.Itoa(i)] = v
+			}
+			val = assoc
+		}
+		self.objects[idx] = val
+
+	case amf3objectmarker:
+		var u uint32
+		var isref bool
+		if u, val, isref, size, err = self.parseRef(b[n:], offset+n, "object"); err != nil || isref {
+			n += size
+			return
+		}
+		n += size
+
+		var traits *amf3Traits
+		switch {
+		case u&1 == 0:
+			idx := int(u >> 1)
+			if idx >= len(self.traits) {
+				err = amf3ParseErr(fmt.Sprintf("object.traits.ref=%d", idx), offset+n, err)
+				return
+			}
+			traits = self.traits[idx]
+		case u&2 != 0:
+			err = amf3ParseErr("object.externalizable", offset+n, err)
+			return
+		default:
+			traits = &amf3Traits{dynamic: u&4 != 0}
+			if _, size, err = self.parseString(b[n:], offset+n); err != nil {
+				err = amf3ParseErr("object.classname", offset+n, err)
+				return
+			}
+			n += size
+			count := int(u >> 3)
+			if count > len(b)-n {
+				err = amf3ParseErr("object.sealed.count", offset+n, err)
+				return
+			}
+			for i := 0; i < count; i++ {
+				var name string
+				if name, size, err = self.parseString(b[n:], offset+n); err != nil {
+					err = amf3ParseErr("object.sealed.name", offset+n, err)
+					return
+				}
+				n += size
+				traits.sealed = append(traits.sealed, name)
+			}
+			self.traits = append(self.traits, traits)
+		}
+
+		obj := AMFMap{}
+		self.objects = append(self.objects, obj)
+		for _, name := range traits.sealed {
+			var oval interface{}
+			if oval, size, err = self.parseVal(b[n:], offset+n); err != nil {
+				err = amf3ParseErr("object.sealed.val", offset+n, err)
+				return
+			}
+			n += size
+			obj[name] = oval
+		}
+		for traits.dynamic {
+			var key string
+			if key, size, err = self.parseString(b[n:], offset+n); err != nil {
+				err = amf3ParseErr("object.key", offset+n, err)
+				return
+			}
+			n += size
+			if key == "" {
+				break
+			}
+			var oval interface{}
+			if oval, size, err = self.parseVal(b[n:], offset+n); err != nil {
+				err = amf3ParseErr("object.val", offset+n, err)
+				return
+			}
+			n += size
+			obj[key] = oval
+		}
+		val = obj
+
+	case amf3bytearraymarker:
+		var u uint32
+		var isref bool
+		if u, val, isref, size, err = self.parseRef(b[n:], offset+n, "bytearray"); err != nil || isref {
+			n += size
+			return
+		}
+		n += size
+		length := int(u)
+		if len(b) < n+length {
+			err = amf3ParseErr("bytearray.body", offset+n, err)
+			return
+		}
+		val = append([]byte(nil), b[n:n+length]...)
+		n += length
+		self.objects = append(self.objects, val)
+
+	case amf3vectorintmarker, amf3vectoruintmarker, amf3vectordoublemarker, amf3vectorobjectmarker:
+		var u uint32
+		var isref bool
+		if u, val, isref, size, err = self.parseRef(b[n:], offset+n, "vector"); err != nil || isref {
+			n += size
+			return
+		}
+		n += size
+		count := int(u)
+		// fixed-vector标志
+		if len(b) < n+1 {
+			err = amf3ParseErr("vector.fixed", offset+n, err)
+			return
+		}
+		n++
+		if marker == amf3vectorobjectmarker {
+			if _, size, err = self.parseString(b[n:], offset+n); err != nil {
+				err = amf3ParseErr("vector.typename", offset+n, err)
+				return
+			}
+			n += size
+		}
+		if count > len(b)-n {
+			err = amf3ParseErr("vector.count", offset+n, err)
+			return
+		}
+		idx := len(self.objects)
+		self.objects = append(self.objects, nil)
+		arr := make(AMFArray, count)
+		for i := range arr {
+			switch marker {
+			case amf3vectorintmarker, amf3vectoruintmarker:
+				if len(b) < n+4 {
+					err = amf3ParseErr("vector.int", offset+n, err)
+					return
+				}
+				if marker == amf3vectorintmarker {
+					arr[i] = float64(pio.I32BE(b[n:]))
+				} else {
+					arr[i] = float64(pio.U32BE(b[n:]))
+				}
+				n += 4
+			case amf3vectordoublemarker:
+				if len(b) < n+8 {
+					err = amf3ParseErr("vector.double", offset+n, err)
+					return
+				}
+				arr[i] = parseBEFloat64(b[n:])
+				n += 8
+			default:
+				if arr[i], size, err = self.parseVal(b[n:], offset+n); err != nil {
+					err = amf3ParseErr("vector.val", offset+n, err)
+					return
+				}
+				n += size
+			}
+		}
+		val = arr
+		self.objects[idx] = val
+
+	case amf3dictionarymarker:
+		var u uint32
+		var isref bool
+		if u, val, isref, size, err = self.parseRef(b[n:], offset+n, "dictionary"); err != nil || isref {
+			n += size
+			return
+		}
+		n += size
+		count := int(u)
+		// weak-keys标志
+		if len(b) < n+1 {
+			err = amf3ParseErr("dictionary.weak", offset+n, err)
+			return
+		}
+		n++
+		if count > len(b)-n {
+			err = amf3ParseErr("dictionary.count", offset+n, err)
+			return
+		}
+		dict := AMFECMAArray{}
+		self.objects = append(self.objects, dict)
+		for i := 0; i < count; i++ {
+			var k, v interface{}
+			if k, size, err = self.parseVal(b[n:], offset+n); err != nil {
+				err = amf3ParseErr("dictionary.key", offset+n, err)
+				return
+			}
+			n += size
+			if v, size, err = self.parseVal(b[n:], offset+n); err != nil {
+				err = amf3ParseErr("dictionary.val", offset+n, err)
+				return
+			}
+			n += size
+			dict[fmt.Sprint(k)] = v
+		}
+		val = dict
+
+	default:
+		err = amf3ParseErr(fmt.Sprintf("invalidmarker=%d", marker), offset+n, err)
+		return
+	}
+
+	return
+}
+
+func lenU29(v uint32) int {
+	switch {
+	case v < 0x80:
+		return 1
+	case v < 0x4000:
+		return 2
+	case v < 0x200000:
+		return 3
+	default:
+		return 4
+	}
+}
+
+func fillU29(b []byte, v uint32) int {
+	switch {
+	case v < 0x80:
+		b[0] = byte(v)
+		return 1
+	case v < 0x4000:
+		b[0] = byte(v>>7) | 0x80
+		b[1] = byte(v) & 0x7f
+		return 2
+	case v < 0x200000:
+		b[0] = byte(v>>14) | 0x80
+		b[1] = byte(v>>7) | 0x80
+		b[2] = byte(v) & 0x7f
+		return 3
+	default:
+		b[0] = byte(v>>22) | 0x80
+		b[1] = byte(v>>15) | 0x80
+		b[2] = byte(v>>8) | 0x80
+		b[3] = byte(v)
+		return 4
+	}
+}
+
+func lenAMF3String(s string) int {
+	return lenU29(uint32(len(s))<<1|1) + len(s)
+}
+
+func fillAMF3String(b []byte, s string) (n int) {
+	n += fillU29(b, uint32(len(s))<<1|1)
+	n += copy(b[n:], s)
+	return
+}
+
+// amf3Number 将go数值类型转换为AMF3的integer或double
+func amf3Number(_val interface{}) (i int64, f float64, isint bool, ok bool) {
+	switch val := _val.(type) {
+	case int8:
+		i, isint = int64(val), true
+	case int16:
+		i, isint = int64(val), true
+	case int32:
+		i, isint = int64(val), true
+	case int64:
+		i, isint = val, true
+	case int:
+		i, isint = int64(val), true
+	case uint8:
+		i, isint = int64(val), true
+	case uint16:
+		i, isint = int64(val), true
+	case uint32:
+		i, isint = int64(val), true
+	case uint64:
+		if val > amf3IntMax {
+			return 0, float64(val), false, true
+		}
+		i, isint = int64(val), true
+	case uint:
+		if uint64(val) > amf3IntMax {
+			return 0, float64(val), false, true
+		}
+		i, isint = int64(val), true
+	case float32:
+		return 0, float64(val), false, true
+	case float64:
+		return 0, val, false, true
+	default:
+		return
+	}
+	ok = true
+	if i < amf3IntMin || i > amf3IntMax {
+		f, isint = float64(i), false
+	}
+	return
+}
+
+// LenAMF3Val 计算FillAMF3Val编码后的长度
+func LenAMF3Val(_val interface{}) (n int) {
+	if i, _, isint, ok := amf3Number(_val); ok {
+		if isint {
+			return 1 + lenU29(uint32(i)&0x1fffffff)
+		}
+		return 9
+	}
+
+	switch val := _val.(type) {
+	case string:
+		n += 1 + lenAMF3String(val)
+
+	case AMFECMAArray:
+		n += 2
+		for k, v := range val {
+			if len(k) > 0 {
+				n += lenAMF3String(k) + LenAMF3Val(v)
+			}
+		}
+		n++
+
+	case AMFMap:
+		n += 3
+		for k, v := range val {
+			if len(k) > 0 {
+				n += lenAMF3String(k) + LenAMF3Val(v)
+			}
+		}
+		n++
+
+	case AMFArray:
+		n += 1 + lenU29(uint32(len(val))<<1|1) + 1
+		for _, v := range val {
+			n += LenAMF3Val(v)
+		}
+
+	case []byte:
+		n += 1 + lenU29(uint32(len(val))<<1|1) + len(val)
+
+	case time.Time:
+		n += 1 + 1 + 8
+
+	case bool:
+		n++
+
+	case nil:
+		n++
+	}
+
+	return
+}
+
+// FillAMF3Val 以AMF3编码写入一个值, 不使用引用表.
+// AMFMap编码为匿名的dynamic object, AMFECMAArray编码为只有关联部分的array.
+func FillAMF3Val(b []byte, _val interface{}) (n int) {
+	if i, f, isint, ok := amf3Number(_val); ok {
+		if isint {
+			b[n] = amf3integermarker
+			n++
+			n += fillU29(b[n:], uint32(i)&0x1fffffff)
+		} else {
+			b[n] = amf3doublemarker
+			n++
+			n += fillBEFloat64(b[n:], f)
+		}
+		return
+	}
+
+	switch val := _val.(type) {
+	case string:
+		b[n] = amf3stringmarker
+		n++
+		n += fillAMF3String(b[n:], val)
+
+	case AMFECMAArray:
+		b[n] = amf3arraymarker
+		n++
+		n += fillU29(b[n:], 0<<1|1)
+		for k, v := range val {
+			if len(k) > 0 {
+				n += fillAMF3String(b[n:], k)
+				n += FillAMF3Val(b[n:], v)
+			}
+		}
+		n += fillAMF3String(b[n:], "")
+
+	case AMFMap:
+		b[n] = amf3objectmarker
+		n++
+		// traits内联, dynamic, 0个sealed成员
+		n += fillU29(b[n:], 0x0b)
+		n += fillAMF3String(b[n:], "")
+		for k, v := range val {
+			if len(k) > 0 {
+				n += fillAMF3String(b[n:], k)
+				n += FillAMF3Val(b[n:], v)
+			}
+		}
+		n += fillAMF3String(b[n:], "")
+
+	case AMFArray:
+		b[n] = amf3arraymarker
+		n++
+		n += fillU29(b[n:], uint32(len(val))<<1|1)
+		n += fillAMF3String(b[n:], "")
+		for _, v := range val {
+			n += FillAMF3Val(b[n:], v)
+		}
+
+	case []byte:
+		b[n] = amf3bytearraymarker
+		n++
+		n += fillU29(b[n:], uint32(len(val))<<1|1)
+		n += copy(b[n:], val)
+
+	case time.Time:
+		b[n] = amf3datemarker
+		n++
+		n += fillU29(b[n:], 1)
+		n += fillBEFloat64(b[n:], float64(val.UnixNano()/1000000))
+
+	case bool:
+		if val {
+			b[n] = amf3truemarker
+		} else {
+			b[n] = amf3falsemarker
+		}
+		n++
+
+	case nil:
+		b[n] = amf3nullmarker
+		n++
+	}
+
+	return
+}
+
+// isAMFComplex 是否是object/array类型, 在AVMPlus编码中需要切换到AMF3
+func isAMFComplex(val interface{}) bool {
+	switch val.(type) {
+	case AMFMap, AMFECMAArray, AMFArray, []byte:
+		return true
+	}
+	return false
+}
+
+// LenAVMPlusVal 计算FillAVMPlusVal编码后的长度
+func LenAVMPlusVal(val interface{}) int {
+	if isAMFComplex(val) {
+		return 1 + LenAMF3Val(val)
+	}
+	return LenAMF0Val(val)
+}
+
+// FillAVMPlusVal 用于CommandMsgAMF3/DataMsgAMF3: 简单类型保持AMF0编码,
+// object/array写入avmplus-object-marker后切换为AMF3编码
+func FillAVMPlusVal(b []byte, val interface{}) (n int) {
+	if isAMFComplex(val) {
+		b[n] = avmplusobjectmarker
+		n++
+		n += FillAMF3Val(b[n:], val)
+		return
+	}
+	return FillAMF0Val(b, val)
+}
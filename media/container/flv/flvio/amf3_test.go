@@ -0,0 +1,77 @@
+package flvio
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAMF3RoundTrip(t *testing.T) {
+	val := AMFMap{
+		"app":      "live",
+		"int":      300,
+		"negative": -5,
+		"big":      int64(1) << 40,
+		"float":    1.5,
+		"ok":       true,
+		"none":     nil,
+		"list":     AMFArray{"a", 1, false},
+		"ecma":     AMFECMAArray{"k": "v"},
+		"bytes":    []byte{1, 2, 3},
+	}
+	b := make([]byte, LenAMF3Val(val))
+	require.Equal(t, len(b), FillAMF3Val(b, val))
+
+	got, n, err := ParseAMF3Val(b)
+	require.Nil(t, err)
+	require.Equal(t, len(b), n)
+	require.Equal(t, AMFMap{
+		"app":      "live",
+		"int":      float64(300),
+		"negative": float64(-5),
+		"big":      float64(int64(1) << 40),
+		"float":    1.5,
+		"ok":       true,
+		"none":     nil,
+		"list":     AMFArray{"a", float64(1), false},
+		"ecma":     AMFECMAArray{"k": "v"},
+		"bytes":    []byte{1, 2, 3},
+	}, got)
+}
+
+func TestAMF3References(t *testing.T) {
+	// [ {name:"a"}, {name:"a"}(traits/string引用), obj引用 ]
+	b := []byte{
+		amf3arraymarker, 0x07, 0x01,
+		amf3objectmarker, 0x13, 0x01, 0x09, 'n', 'a', 'm', 'e', amf3stringmarker, 0x03, 'a',
+		amf3objectmarker, 0x01, amf3stringmarker, 0x02,
+		amf3objectmarker, 0x02,
+	}
+	got, n, err := ParseAMF3Val(b)
+	require.Nil(t, err)
+	require.Equal(t, len(b), n)
+	require.Equal(t, AMFArray{AMFMap{"name": "a"}, AMFMap{"name": "a"}, AMFMap{"name": "a"}}, got)
+}
+
+func TestAVMPlusInAMF0(t *testing.T) {
+	args := []interface{}{"connect", 1, AMFMap{"app": "live"}}
+	size := 0
+	for _, arg := range args {
+		size += LenAVMPlusVal(arg)
+	}
+	b := make([]byte, size)
+	n := 0
+	for _, arg := range args {
+		n += FillAVMPlusVal(b[n:], arg)
+	}
+	require.Equal(t, size, n)
+
+	vals := []interface{}{}
+	for n = 0; n < len(b); {
+		val, size, err := ParseAMF0Val(b[n:])
+		require.Nil(t, err)
+		n += size
+		vals = append(vals, val)
+	}
+	require.Equal(t, []interface{}{"connect", float64(1), AMFMap{"app": "live"}}, vals)
+}
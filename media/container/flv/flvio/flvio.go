@@ -62,6 +62,46 @@ const (
 	VIDEO_H265 = 12
 )
 
+// Enhanced RTMP(E-RTMP), 见 https://veovera.org/docs/enhanced/enhanced-rtmp-v2
+const (
+	// VIDEO_EX_HEADER 视频tag首字节最高位, 置位表示使用扩展头
+	VIDEO_EX_HEADER = 0x80
+
+	PKTTYPE_SEQUENCE_START         = 0
+	PKTTYPE_CODED_FRAMES           = 1
+	PKTTYPE_SEQUENCE_END           = 2
+	PKTTYPE_CODED_FRAMESX          = 3 // 没有CompositionTime, 即CompositionTime为0
+	PKTTYPE_METADATA               = 4
+	PKTTYPE_MPEG2TS_SEQUENCE_START = 5
+	PKTTYPE_MULTITRACK             = 6
+
+	MULTITRACK_ONE_TRACK               = 0
+	MULTITRACK_MANY_TRACKS             = 1
+	MULTITRACK_MANY_TRACKS_MANY_CODECS = 2
+
+	// AVC_EXMETADATA 扩展头的metadata包没有对应的AVCPacketType, 用该值标记以免被当成header或者帧
+	AVC_EXMETADATA = 0xff
+)
+
+const (
+	FOURCC_AVC1 = 0x61766331 // 'avc1'
+	FOURCC_HVC1 = 0x68766331 // 'hvc1'
+	FOURCC_AV01 = 0x61763031 // 'av01'
+	FOURCC_VP09 = 0x76703039 // 'vp09'
+)
+
+// FourCCString 返回fourcc的字符串形式
+func FourCCString(fourcc uint32) string {
+	return string([]byte{byte(fourcc >> 24), byte(fourcc >> 16), byte(fourcc >> 8), byte(fourcc)})
+}
+
+// Track 扩展头multitrack中的一路轨道
+type Track struct {
+	TrackID uint8
+	FourCC  uint32
+	Data    []byte
+}
+
 type Tag struct {
 	Type uint8
 
@@ -151,6 +191,25 @@ type Tag struct {
 
 	CompositionTime int32
 
+	/*
+		E-RTMP扩展头, IsExHeader为true时以下字段有效.
+		ExPacketType为扩展头的包类型, 解析时会同时映射到AVCPacketType, 以兼容只认识AVC的代码.
+		FourCC为hvc1/av01/vp09/avc1, hvc1和avc1会同时映射到CodecID.
+	*/
+	IsExHeader   bool
+	ExPacketType uint8
+	FourCC       uint32
+
+	/*
+		multitrack, Multitrack为true时有效.
+		写入时只支持单轨道(MULTITRACK_ONE_TRACK), 多轨道的tag解析后Data为第一路轨道,
+		全部轨道保存在Tracks中.
+	*/
+	Multitrack     bool
+	MultitrackType uint8
+	TrackID        uint8
+	Tracks         []Track
+
 	Data []byte
 }
 
@@ -188,7 +247,7 @@ func (self *Tag) audioParseHeader(b []byte) (n int, err error) {
 	return
 }
 
-func (self Tag) audioFillHeader(b []byte) (n int) {
+func (self *Tag) audioFillHeader(b []byte) (n int) {
 	var flags uint8
 	flags |= self.SoundFormat << 4
 	flags |= self.SoundRate << 2
@@ -212,6 +271,9 @@ func (self *Tag) videoParseHeader(b []byte) (n int, err error) {
 		return
 	}
 	flags := b[n]
+	if flags&VIDEO_EX_HEADER != 0 {
+		return self.exVideoParseHeader(b)
+	}
 	self.FrameType = flags >> 4
 	self.CodecID = flags & 0xf
 	n++
@@ -231,7 +293,159 @@ func (self *Tag) videoParseHeader(b []byte) (n int, err error) {
 	return
 }
 
-func (self Tag) videoFillHeader(b []byte) (n int) {
+// exHasCompositionTime CodedFrames包只有avc1和hvc1带CompositionTime
+func exHasCompositionTime(pktType uint8, fourcc uint32) bool {
+	return pktType == PKTTYPE_CODED_FRAMES && (fourcc == FOURCC_AVC1 || fourcc == FOURCC_HVC1)
+}
+
+// exMapCodec 把扩展头映射到传统的CodecID和AVCPacketType
+func (self *Tag) exMapCodec() {
+	switch self.FourCC {
+	case FOURCC_AVC1:
+		self.CodecID = VIDEO_H264
+	case FOURCC_HVC1:
+		self.CodecID = VIDEO_H265
+	default:
+		self.CodecID = 0
+	}
+	switch self.ExPacketType {
+	case PKTTYPE_SEQUENCE_START:
+		self.AVCPacketType = AVC_SEQHDR
+	case PKTTYPE_CODED_FRAMES, PKTTYPE_CODED_FRAMESX:
+		self.AVCPacketType = AVC_NALU
+	case PKTTYPE_SEQUENCE_END:
+		self.AVCPacketType = AVC_EOS
+	default:
+		self.AVCPacketType = AVC_EXMETADATA
+	}
+}
+
+func (self *Tag) exVideoParseHeader(b []byte) (n int, err error) {
+	invalid := fmt.Errorf("videodata: ex header parse invalid")
+	flags := b[n]
+	n++
+	self.IsExHeader = true
+	self.FrameType = (flags >> 4) & 0x7
+	self.ExPacketType = flags & 0xf
+
+	if self.ExPacketType == PKTTYPE_MULTITRACK {
+		if len(b) < n+1 {
+			err = invalid
+			return
+		}
+		self.Multitrack = true
+		self.MultitrackType = b[n] >> 4
+		self.ExPacketType = b[n] & 0xf
+		n++
+		if self.MultitrackType != MULTITRACK_MANY_TRACKS_MANY_CODECS {
+			if len(b) < n+4 {
+				err = invalid
+				return
+			}
+			self.FourCC = pio.U32BE(b[n:])
+			n += 4
+		}
+		self.Tracks = self.Tracks[:0]
+		for len(b) > n {
+			track := Track{FourCC: self.FourCC}
+			track.TrackID = b[n]
+			n++
+			if self.MultitrackType == MULTITRACK_MANY_TRACKS_MANY_CODECS {
+				if len(b) < n+4 {
+					err = invalid
+					return
+				}
+				track.FourCC = pio.U32BE(b[n:])
+				n += 4
+			}
+			size := len(b) - n
+			if self.MultitrackType != MULTITRACK_ONE_TRACK {
+				if len(b) < n+3 {
+					err = invalid
+					return
+				}
+				size = int(pio.U24BE(b[n:]))
+				n += 3
+				if len(b) < n+size {
+					err = invalid
+					return
+				}
+			}
+			track.Data = b[n : n+size]
+			n += size
+			self.Tracks = append(self.Tracks, track)
+		}
+		if len(self.Tracks) == 0 {
+			err = invalid
+			return
+		}
+		// 以第一路轨道作为tag的数据, 返回值n指向该轨道数据的开始
+		first := self.Tracks[0]
+		self.TrackID = first.TrackID
+		self.FourCC = first.FourCC
+		self.exMapCodec()
+		if exHasCompositionTime(self.ExPacketType, self.FourCC) {
+			if len(first.Data) < 3 {
+				err = invalid
+				return
+			}
+			self.CompositionTime = pio.I24BE(first.Data)
+			first.Data = first.Data[3:]
+			self.Tracks[0].Data = first.Data
+		}
+		// 单轨道时b[n:]即为轨道数据, 多轨道时需要用ParseBody取第一路轨道
+		n = len(b) - len(first.Data)
+		return
+	}
+
+	if self.ExPacketType != PKTTYPE_SEQUENCE_END || len(b) >= n+4 {
+		if len(b) < n+4 {
+			err = invalid
+			return
+		}
+		self.FourCC = pio.U32BE(b[n:])
+		n += 4
+	}
+	self.exMapCodec()
+	if exHasCompositionTime(self.ExPacketType, self.FourCC) {
+		if len(b) < n+3 {
+			err = invalid
+			return
+		}
+		self.CompositionTime = pio.I24BE(b[n:])
+		n += 3
+	}
+	return
+}
+
+func (self *Tag) exVideoFillHeader(b []byte) (n int) {
+	pktType := self.ExPacketType
+	if self.Multitrack {
+		b[n] = VIDEO_EX_HEADER | (self.FrameType&0x7)<<4 | PKTTYPE_MULTITRACK
+		n++
+		b[n] = MULTITRACK_ONE_TRACK<<4 | pktType&0xf
+		n++
+		pio.PutU32BE(b[n:], self.FourCC)
+		n += 4
+		b[n] = self.TrackID
+		n++
+	} else {
+		b[n] = VIDEO_EX_HEADER | (self.FrameType&0x7)<<4 | pktType&0xf
+		n++
+		pio.PutU32BE(b[n:], self.FourCC)
+		n += 4
+	}
+	if exHasCompositionTime(pktType, self.FourCC) {
+		pio.PutI24BE(b[n:], self.CompositionTime)
+		n += 3
+	}
+	return
+}
+
+func (self *Tag) videoFillHeader(b []byte) (n int) {
+	if self.IsExHeader {
+		return self.exVideoFillHeader(b)
+	}
 	flags := self.FrameType<<4 | self.CodecID
 	b[n] = flags
 	n++
@@ -242,7 +456,7 @@ func (self Tag) videoFillHeader(b []byte) (n int) {
 	return
 }
 
-func (self Tag) FillHeader(b []byte) (n int) {
+func (self *Tag) FillHeader(b []byte) (n int) {
 	switch self.Type {
 	case TAG_AUDIO:
 		return self.audioFillHeader(b)
@@ -278,6 +492,20 @@ const (
 const TagHeaderLength = 11
 const TagTrailerLength = 4
 
+// ParseBody 解析tag头并设置Data, multitrack的tag取第一路轨道的数据
+func (self *Tag) ParseBody(b []byte) (err error) {
+	var n int
+	if n, err = self.ParseHeader(b); err != nil {
+		return
+	}
+	if self.Multitrack && len(self.Tracks) > 0 {
+		self.Data = self.Tracks[0].Data
+	} else {
+		self.Data = b[n:]
+	}
+	return
+}
+
 func ParseTagHeader(b []byte) (tag Tag, ts int32, datalen int, err error) {
 	tagtype := b[0]
 
@@ -315,11 +543,9 @@ func ReadTag(r io.Reader, b []byte) (tag Tag, ts int32, err error) {
 		return
 	}
 
-	var n int
-	if n, err = (&tag).ParseHeader(data); err != nil {
+	if err = (&tag).ParseBody(data); err != nil {
 		return
 	}
-	tag.Data = data[n:]
 
 	if _, err = io.ReadFull(r, b[:4]); err != nil {
 		return
@@ -0,0 +1,72 @@
+package flvio
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func benchVideoTag() Tag {
+	return Tag{
+		Type:            TAG_VIDEO,
+		FrameType:       FRAME_INTER,
+		CodecID:         VIDEO_H264,
+		AVCPacketType:   AVC_NALU,
+		CompositionTime: 80,
+		Data:            make([]byte, 4096),
+	}
+}
+
+func BenchmarkWriteTag(b *testing.B) {
+	tag := benchVideoTag()
+	buf := make([]byte, 256)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := WriteTag(io.Discard, tag, int32(i), buf); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkReadTag(b *testing.B) {
+	w := &bytes.Buffer{}
+	buf := make([]byte, 256)
+	if err := WriteTag(w, benchVideoTag(), 40, buf); err != nil {
+		b.Fatal(err)
+	}
+	data := w.Bytes()
+	r := bytes.NewReader(data)
+	b.ReportAllocs()
+	b.SetBytes(int64(len(data)))
+	for i := 0; i < b.N; i++ {
+		r.Reset(data)
+		if _, _, err := ReadTag(r, buf); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkParseTagHeader(b *testing.B) {
+	buf := make([]byte, TagHeaderLength)
+	FillTagHeader(buf, TAG_VIDEO, 4096, 40)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, _, _, err := ParseTagHeader(buf); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkParseBody(b *testing.B) {
+	src := benchVideoTag()
+	hdr := make([]byte, MaxTagSubHeaderLength)
+	n := src.FillHeader(hdr)
+	data := append(hdr[:n:n], src.Data...)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		tag := Tag{Type: TAG_VIDEO}
+		if err := tag.ParseBody(data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package flvio
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExVideoHeader(t *testing.T) {
+	tag := Tag{
+		Type:            TAG_VIDEO,
+		IsExHeader:      true,
+		FrameType:       FRAME_KEY,
+		ExPacketType:    PKTTYPE_CODED_FRAMES,
+		FourCC:          FOURCC_HVC1,
+		CompositionTime: 40,
+	}
+	b := make([]byte, MaxTagSubHeaderLength)
+	n := tag.FillHeader(b)
+	require.Equal(t, 8, n)
+	data := append(b[:n:n], 1, 2, 3)
+
+	got := Tag{Type: TAG_VIDEO}
+	require.Nil(t, got.ParseBody(data))
+	require.True(t, got.IsExHeader)
+	require.Equal(t, uint8(VIDEO_H265), got.CodecID)
+	require.Equal(t, uint8(AVC_NALU), got.AVCPacketType)
+	require.Equal(t, int32(40), got.CompositionTime)
+	require.Equal(t, []byte{1, 2, 3}, got.Data)
+
+	// av01没有CompositionTime
+	tag.FourCC = FOURCC_AV01
+	n = tag.FillHeader(b)
+	require.Equal(t, 5, n)
+}
+
+func TestExVideoHeaderMultitrack(t *testing.T) {
+	// ManyTracks: hvc1, 两路轨道, SequenceStart
+	data := []byte{
+		VIDEO_EX_HEADER | FRAME_KEY<<4 | PKTTYPE_MULTITRACK,
+		MULTITRACK_MANY_TRACKS<<4 | PKTTYPE_SEQUENCE_START,
+		'h', 'v', 'c', '1',
+		0, 0, 0, 2, 0xa, 0xb,
+		1, 0, 0, 1, 0xc,
+	}
+	tag := Tag{Type: TAG_VIDEO}
+	require.Nil(t, tag.ParseBody(data))
+	require.True(t, tag.Multitrack)
+	require.Equal(t, uint8(AVC_SEQHDR), tag.AVCPacketType)
+	require.Equal(t, 2, len(tag.Tracks))
+	require.Equal(t, []byte{0xa, 0xb}, tag.Data)
+	require.Equal(t, uint8(1), tag.Tracks[1].TrackID)
+	require.Equal(t, []byte{0xc}, tag.Tracks[1].Data)
+
+	// 转发时写成单轨道
+	b := make([]byte, MaxTagSubHeaderLength)
+	n := tag.FillHeader(b)
+	out := Tag{Type: TAG_VIDEO}
+	require.Nil(t, out.ParseBody(append(b[:n:n], tag.Data...)))
+	require.Equal(t, uint8(MULTITRACK_ONE_TRACK), out.MultitrackType)
+	require.Equal(t, []byte{0xa, 0xb}, out.Data)
+}
@@ -0,0 +1,60 @@
+package fmp4
+
+// box 按ISO BMFF格式拼装box, 只用于写
+type box []byte
+
+func (self *box) u8(v uint8) *box {
+	*self = append(*self, v)
+	return self
+}
+
+func (self *box) u16(v uint16) *box {
+	*self = append(*self, byte(v>>8), byte(v))
+	return self
+}
+
+func (self *box) u32(v uint32) *box {
+	*self = append(*self, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+	return self
+}
+
+func (self *box) u64(v uint64) *box {
+	self.u32(uint32(v >> 32))
+	self.u32(uint32(v))
+	return self
+}
+
+func (self *box) zeros(n int) *box {
+	*self = append(*self, make([]byte, n)...)
+	return self
+}
+
+func (self *box) bytes(b ...[]byte) *box {
+	for _, v := range b {
+		*self = append(*self, v...)
+	}
+	return self
+}
+
+// makeBox 生成typ类型的box, payload依次拼接
+func makeBox(typ string, payload ...[]byte) []byte {
+	size := 8
+	for _, p := range payload {
+		size += len(p)
+	}
+	b := make(box, 0, size)
+	b.u32(uint32(size)).bytes([]byte(typ)).bytes(payload...)
+	return b
+}
+
+// makeFullBox 生成带version和flags的box
+func makeFullBox(typ string, version uint8, flags uint32, payload ...[]byte) []byte {
+	return makeBox(typ, append([][]byte{{version, byte(flags >> 16), byte(flags >> 8), byte(flags)}}, payload...)...)
+}
+
+// unityMatrix mvhd/tkhd中的单位矩阵
+var unityMatrix = []byte{
+	0x00, 0x01, 0x00, 0x00, 0, 0, 0, 0, 0, 0, 0, 0,
+	0, 0, 0, 0, 0x00, 0x01, 0x00, 0x00, 0, 0, 0, 0,
+	0, 0, 0, 0, 0, 0, 0, 0, 0x40, 0x00, 0x00, 0x00,
+}
@@ -0,0 +1,369 @@
+// Package fmp4 实现fragmented MP4(ISO BMFF)的封装, 用于录制文件的点播转封装
+package fmp4
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/bugVanisher/streamer/media/av"
+	"github.com/bugVanisher/streamer/media/codec/aacparser"
+	"github.com/bugVanisher/streamer/media/codec/h264parser"
+	"github.com/bugVanisher/streamer/media/codec/h265parser"
+)
+
+const (
+	videoTimeScale = 90000
+	// audioOnlyFragment 纯音频时每个分片的时长
+	audioOnlyFragment = time.Second
+
+	sampleFlagsKey    = 0x02000000 // sample_depends_on=2
+	sampleFlagsNonKey = 0x01010000 // sample_depends_on=1, sample_is_non_sync_sample=1
+)
+
+// CodecTypes fmp4支持的编码格式
+var CodecTypes = []av.CodecType{av.H264, av.H265, av.AAC}
+
+type sample struct {
+	dts  int64
+	cto  int32
+	key  bool
+	data []byte
+}
+
+type track struct {
+	id        uint32
+	codec     av.CodecData
+	timescale uint32
+	pending   []sample
+	lastDur   uint32
+}
+
+func (self *track) convert(d time.Duration) int64 {
+	return int64(d/time.Microsecond) * int64(self.timescale) / 1e6
+}
+
+// take 取出前n个sample并计算时长, 最后一个sample的时长由next给出
+func (self *track) take(n int, next int64, hasNext bool) (samples []sample, durs []uint32) {
+	samples = self.pending[:n]
+	durs = make([]uint32, n)
+	for i := range samples {
+		var dur int64
+		switch {
+		case i+1 < len(self.pending):
+			dur = self.pending[i+1].dts - samples[i].dts
+		case hasNext:
+			dur = next - samples[i].dts
+		default:
+			dur = int64(self.lastDur)
+		}
+		if dur < 0 {
+			dur = 0
+		}
+		durs[i] = uint32(dur)
+		self.lastDur = durs[i]
+	}
+	self.pending = append([]sample(nil), self.pending[n:]...)
+	return
+}
+
+// Muxer 将av.Packet封装为fragmented MP4, 每个视频关键帧开始一个新的moof+mdat分片
+type Muxer struct {
+	w           io.Writer
+	tracks      []*track
+	videoIdx    int
+	seq         uint32
+	wroteHeader bool
+}
+
+// NewMuxer ...
+func NewMuxer(w io.Writer) *Muxer {
+	return &Muxer{
+		w:        w,
+		videoIdx: -1,
+	}
+}
+
+// SupportedCodecTypes ...
+func (self *Muxer) SupportedCodecTypes() []av.CodecType {
+	return CodecTypes
+}
+
+// WriteHeader 写入ftyp和moov, 之后的header变化会被忽略
+func (self *Muxer) WriteHeader(streams []av.CodecData) (err error) {
+	if self.wroteHeader {
+		return
+	}
+
+	self.tracks = nil
+	self.videoIdx = -1
+	traks := [][]byte{}
+	trexs := [][]byte{}
+	for i, stream := range streams {
+		t := &track{
+			id:    uint32(i + 1),
+			codec: stream,
+		}
+		switch stream.Type() {
+		case av.H264, av.H265:
+			t.timescale = videoTimeScale
+			t.lastDur = videoTimeScale / 25
+			if self.videoIdx < 0 {
+				self.videoIdx = i
+			}
+		case av.AAC:
+			t.timescale = uint32(stream.(av.AudioCodecData).SampleRate())
+			t.lastDur = 1024
+		default:
+			err = fmt.Errorf("fmp4: codec type=%v is not supported", stream.Type())
+			return
+		}
+		var trak []byte
+		if trak, err = self.makeTrak(t); err != nil {
+			return
+		}
+		self.tracks = append(self.tracks, t)
+		traks = append(traks, trak)
+
+		var trex box
+		trex.u32(t.id).u32(1).u32(0).u32(0).u32(0)
+		trexs = append(trexs, makeFullBox("trex", 0, 0, trex))
+	}
+
+	var ftyp box
+	ftyp.bytes([]byte("isom")).u32(0x200).bytes([]byte("isom"), []byte("iso5"), []byte("iso6"), []byte("mp41"))
+
+	var mvhd box
+	mvhd.u32(0).u32(0).u32(1000).u32(0).u32(0x00010000).u16(0x0100).zeros(10).
+		bytes(unityMatrix).zeros(24).u32(uint32(len(streams) + 1))
+
+	moov := makeBox("moov", append([][]byte{makeFullBox("mvhd", 0, 0, mvhd)},
+		append(traks, makeBox("mvex", trexs...))...)...)
+
+	if _, err = self.w.Write(makeBox("ftyp", ftyp)); err != nil {
+		return
+	}
+	if _, err = self.w.Write(moov); err != nil {
+		return
+	}
+	self.wroteHeader = true
+	return
+}
+
+func (self *Muxer) makeTrak(t *track) (trak []byte, err error) {
+	var width, height int
+	var hdlrType string
+	var mhd []byte
+	var entry []byte
+
+	switch codec := t.codec.(type) {
+	case h264parser.CodecData:
+		width, height = codec.Width(), codec.Height()
+		entry = makeVisualEntry("avc1", width, height, makeBox("avcC", codec.AVCDecoderConfRecordBytes()))
+	case h265parser.CodecData:
+		width, height = codec.Width(), codec.Height()
+		entry = makeVisualEntry("hvc1", width, height, makeBox("hvcC", codec.AVCDecoderConfRecordBytes()))
+	case aacparser.CodecData:
+		entry = makeAudioEntry(codec)
+	default:
+		err = fmt.Errorf("fmp4: codec data %T is not supported", t.codec)
+		return
+	}
+
+	var tkhd box
+	tkhd.u32(0).u32(0).u32(t.id).u32(0).u32(0).zeros(8).u16(0).u16(0)
+	if t.codec.Type().IsVideo() {
+		hdlrType = "vide"
+		tkhd.u16(0)
+		var vmhd box
+		vmhd.zeros(8)
+		mhd = makeFullBox("vmhd", 0, 1, vmhd)
+	} else {
+		hdlrType = "soun"
+		tkhd.u16(0x0100)
+		var smhd box
+		smhd.zeros(4)
+		mhd = makeFullBox("smhd", 0, 0, smhd)
+	}
+	tkhd.u16(0).bytes(unityMatrix).u32(uint32(width) << 16).u32(uint32(height) << 16)
+
+	var mdhd box
+	mdhd.u32(0).u32(0).u32(t.timescale).u32(0).u16(0x55c4).u16(0) // und
+
+	var hdlr box
+	hdlr.u32(0).bytes([]byte(hdlrType)).zeros(12).bytes([]byte("streamer\x00"))
+
+	var dref box
+	dref.u32(1).bytes(makeFullBox("url ", 0, 1))
+
+	var stsd box
+	stsd.u32(1).bytes(entry)
+	empty := make(box, 0, 4)
+	empty.u32(0)
+	var stsz box
+	stsz.u32(0).u32(0)
+
+	stbl := makeBox("stbl",
+		makeFullBox("stsd", 0, 0, stsd),
+		makeFullBox("stts", 0, 0, empty),
+		makeFullBox("stsc", 0, 0, empty),
+		makeFullBox("stsz", 0, 0, stsz),
+		makeFullBox("stco", 0, 0, empty),
+	)
+	minf := makeBox("minf", mhd, makeBox("dinf", makeFullBox("dref", 0, 0, dref)), stbl)
+	mdia := makeBox("mdia", makeFullBox("mdhd", 0, 0, mdhd), makeFullBox("hdlr", 0, 0, hdlr), minf)
+	trak = makeBox("trak", makeFullBox("tkhd", 0, 3, tkhd), mdia)
+	return
+}
+
+func makeVisualEntry(typ string, width, height int, conf []byte) []byte {
+	var b box
+	b.zeros(6).u16(1).zeros(16).u16(uint16(width)).u16(uint16(height)).
+		u32(0x00480000).u32(0x00480000).u32(0).u16(1).zeros(32).u16(0x0018).u16(0xffff).bytes(conf)
+	return makeBox(typ, b)
+}
+
+func makeAudioEntry(codec aacparser.CodecData) []byte {
+	config := codec.MPEG4AudioConfigBytes()
+
+	var dsi box
+	dsi.u8(0x05).bytes(descLen(len(config))).bytes(config)
+	var dcd box
+	dcd.u8(0x40).u8(0x15).zeros(3).u32(0).u32(0).bytes(dsi)
+	var es box
+	es.u16(0).u8(0).u8(0x04).bytes(descLen(len(dcd))).bytes(dcd).u8(0x06).bytes(descLen(1)).u8(0x02)
+	var esd box
+	esd.u8(0x03).bytes(descLen(len(es))).bytes(es)
+
+	var b box
+	b.zeros(6).u16(1).zeros(8).u16(uint16(codec.ChannelLayout().Count())).u16(16).zeros(4).
+		u32(uint32(codec.SampleRate()) << 16).bytes(makeFullBox("esds", 0, 0, esd))
+	return makeBox("mp4a", b)
+}
+
+// descLen MPEG-4描述符的变长长度, 固定使用4字节形式
+func descLen(n int) []byte {
+	return []byte{0x80 | byte(n>>21)&0x7f, 0x80 | byte(n>>14)&0x7f, 0x80 | byte(n>>7)&0x7f, byte(n) & 0x7f}
+}
+
+// WritePacket 缓存sample, 遇到视频关键帧时输出之前的分片
+func (self *Muxer) WritePacket(pkt av.Packet) (err error) {
+	if pkt.IsSequenceHeader() || pkt.IsScriptData() || len(pkt.Data) == 0 {
+		return
+	}
+	if int(pkt.Idx) < 0 || int(pkt.Idx) >= len(self.tracks) {
+		return
+	}
+
+	t := self.tracks[pkt.Idx]
+	s := sample{
+		dts:  t.convert(pkt.Time.Duration()),
+		cto:  int32(t.convert(pkt.CompositionTime)),
+		key:  pkt.IsKeyFrame || !t.codec.Type().IsVideo(),
+		data: pkt.Data,
+	}
+
+	if self.videoIdx >= 0 {
+		if int(pkt.Idx) == self.videoIdx && s.key && len(t.pending) > 0 {
+			if err = self.flush(s.dts, true); err != nil {
+				return
+			}
+		}
+	} else if len(t.pending) > 0 && s.dts-t.pending[0].dts >= t.convert(audioOnlyFragment) {
+		if err = self.flush(s.dts, true); err != nil {
+			return
+		}
+	}
+
+	t.pending = append(t.pending, s)
+	return
+}
+
+// WriteTrailer 输出剩余的sample
+func (self *Muxer) WriteTrailer() (err error) {
+	if !self.wroteHeader {
+		return
+	}
+	return self.flush(0, false)
+}
+
+// flush 输出一个分片. hasNext时next为触发分片的sample的dts(所在track的时间基),
+// 视频track的最后一个sample以它计算时长, 其他track保留最后一个sample到下一分片
+func (self *Muxer) flush(next int64, hasNext bool) (err error) {
+	type frag struct {
+		t       *track
+		samples []sample
+		durs    []uint32
+	}
+	var frags []frag
+	for i, t := range self.tracks {
+		n := len(t.pending)
+		trigger := hasNext && (i == self.videoIdx || self.videoIdx < 0)
+		if hasNext && !trigger {
+			n--
+		}
+		if n <= 0 {
+			continue
+		}
+		samples, durs := t.take(n, next, trigger)
+		frags = append(frags, frag{t: t, samples: samples, durs: durs})
+	}
+	if len(frags) == 0 {
+		return
+	}
+
+	self.seq++
+	moof := func(offsets []uint32) []byte {
+		var mfhd box
+		mfhd.u32(self.seq)
+		boxes := [][]byte{makeFullBox("mfhd", 0, 0, mfhd)}
+		for i, f := range frags {
+			var tfhd box
+			tfhd.u32(f.t.id)
+			var tfdt box
+			tfdt.u64(uint64(f.samples[0].dts))
+			var trun box
+			trun.u32(uint32(len(f.samples))).u32(offsets[i])
+			for j, s := range f.samples {
+				flags := uint32(sampleFlagsNonKey)
+				if s.key {
+					flags = sampleFlagsKey
+				}
+				trun.u32(f.durs[j]).u32(uint32(len(s.data))).u32(flags).u32(uint32(s.cto))
+			}
+			boxes = append(boxes, makeBox("traf",
+				makeFullBox("tfhd", 0, 0x020000, tfhd), // default-base-is-moof
+				makeFullBox("tfdt", 1, 0, tfdt),
+				makeFullBox("trun", 1, 0x000f01, trun),
+			))
+		}
+		return makeBox("moof", boxes...)
+	}
+
+	offsets := make([]uint32, len(frags))
+	size := uint32(len(moof(offsets))) + 8
+	var total uint32
+	for i, f := range frags {
+		offsets[i] = size + total
+		for _, s := range f.samples {
+			total += uint32(len(s.data))
+		}
+	}
+
+	var mdat box
+	mdat.u32(8 + total).bytes([]byte("mdat"))
+	if _, err = self.w.Write(moof(offsets)); err != nil {
+		return
+	}
+	if _, err = self.w.Write(mdat); err != nil {
+		return
+	}
+	for _, f := range frags {
+		for _, s := range f.samples {
+			if _, err = self.w.Write(s.data); err != nil {
+				return
+			}
+		}
+	}
+	return
+}
@@ -0,0 +1,60 @@
+package fmp4
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bugVanisher/streamer/media/av"
+	"github.com/bugVanisher/streamer/media/codec/aacparser"
+)
+
+func topLevelBoxes(t *testing.T, b []byte) (types []string, payloads [][]byte) {
+	for len(b) > 0 {
+		require.True(t, len(b) >= 8)
+		size := int(binary.BigEndian.Uint32(b))
+		require.True(t, size >= 8)
+		require.True(t, size <= len(b))
+		types = append(types, string(b[4:8]))
+		payloads = append(payloads, b[8:size])
+		b = b[size:]
+	}
+	return
+}
+
+func TestMuxerAudioOnly(t *testing.T) {
+	codec, err := aacparser.NewCodecDataFromMPEG4AudioConfigBytes([]byte{0x12, 0x10}) // AAC-LC 44100 stereo
+	require.Nil(t, err)
+
+	var buf bytes.Buffer
+	m := NewMuxer(&buf)
+	require.Nil(t, m.WriteHeader([]av.CodecData{codec}))
+
+	frameDur := time.Second * 1024 / 44100
+	for i := 0; i < 100; i++ {
+		require.Nil(t, m.WritePacket(av.Packet{
+			Idx:           0,
+			Time:          av.MediaTimeFromDuration(time.Duration(i) * frameDur),
+			Data:          bytes.Repeat([]byte{byte(i)}, 10),
+			DataType:      int8(av.FLV_TAG_AUDIO),
+			AVCPacketType: av.AVC_NALU,
+		}))
+	}
+	require.Nil(t, m.WriteTrailer())
+
+	types, payloads := topLevelBoxes(t, buf.Bytes())
+	require.Equal(t, "ftyp", types[0])
+	require.Equal(t, "moov", types[1])
+	require.True(t, len(types) > 3)
+
+	total := 0
+	for i := 2; i < len(types); i += 2 {
+		require.Equal(t, "moof", types[i])
+		require.Equal(t, "mdat", types[i+1])
+		total += len(payloads[i+1])
+	}
+	require.Equal(t, 100*10, total)
+}
@@ -9,14 +9,17 @@ import (
 	"time"
 
 	"github.com/bugVanisher/streamer/media/av"
+	"github.com/bugVanisher/streamer/media/av/pktque"
 	aacparser "github.com/bugVanisher/streamer/media/codec/aacparser"
+	"github.com/bugVanisher/streamer/media/codec/av1parser"
 	h264parser "github.com/bugVanisher/streamer/media/codec/h264parser"
+	"github.com/bugVanisher/streamer/media/codec/h265parser"
 	"github.com/bugVanisher/streamer/media/container/flv/flvio"
 	"github.com/bugVanisher/streamer/media/container/ts/tsio"
 	"github.com/bugVanisher/streamer/utils/bits/pio"
 )
 
-var CodecTypes = []av.CodecType{av.H264, av.AAC}
+var CodecTypes = []av.CodecType{av.H264, av.H265, av.AV1, av.AAC}
 
 type Stream struct {
 	av.CodecData
@@ -36,8 +39,12 @@ type Stream struct {
 	datalen    int
 
 	config aacparser.MPEG4AudioConfig
+	latm   *aacparser.LATMDemuxer // stream_type 0x11的LOAS/LATM解析状态
+	vps    []byte
 	sps    []byte
 	pps    []byte
+
+	field *av.Packet // 等待和另一个场合并的H.264单场packet
 }
 
 type Muxer struct {
@@ -53,6 +60,11 @@ type Muxer struct {
 	nalus   [][]byte
 
 	tswpat, tswpmt *tsio.TSWriter
+
+	// FixTimestamps 写入前用pktque.CTSFixer修正视频的负数/不递增DTS和错误的CompositionTime
+	FixTimestamps bool
+	ctsfix        pktque.CTSFixer
+	codecs        []av.CodecData
 }
 
 func NewMuxer(w io.Writer) *Muxer {
@@ -103,6 +115,14 @@ func (self *Muxer) writePaddingTSPackets(tsw *tsio.TSWriter) (err error) {
 }
 
 func (self *Muxer) WriteTrailer() (err error) {
+	for _, stream := range self.streams {
+		if field := stream.field; field != nil {
+			stream.field = nil
+			if err = self.writePacket(*field); err != nil {
+				return
+			}
+		}
+	}
 	if self.PaddingToMakeCounterCont {
 		for _, stream := range self.streams {
 			if err = self.writePaddingTSPackets(stream.tsw); err != nil {
@@ -144,6 +164,22 @@ func (self *Muxer) WritePATPMT() (err error) {
 				StreamType:    tsio.ElementaryStreamTypeH264,
 				ElementaryPID: stream.pid,
 			})
+		case av.H265:
+			elemStreams = append(elemStreams, tsio.ElementaryStreamInfo{
+				StreamType:    tsio.ElementaryStreamTypeH265,
+				ElementaryPID: stream.pid,
+			})
+		case av.AV1:
+			// av1_video_descriptor和av1C的前4个字节相同
+			record := stream.CodecData.(av1parser.CodecData).AV1CodecConfRecordBytes()
+			elemStreams = append(elemStreams, tsio.ElementaryStreamInfo{
+				StreamType:    tsio.ElementaryStreamTypePrivateData,
+				ElementaryPID: stream.pid,
+				Descriptors: []tsio.Descriptor{
+					{Tag: tsio.DescriptorTagRegistration, Data: tsio.FormatIdentifierAV1},
+					{Tag: tsio.DescriptorTagAV1Video, Data: record[:4]},
+				},
+			})
 		}
 	}
 
@@ -188,24 +224,66 @@ func (self *Muxer) WriteHeader(streams []av.CodecData) (err error) {
 	if err = self.WritePATPMT(); err != nil {
 		return
 	}
+	self.codecs = streams
 	return
 }
 
+// CTSFixStats FixTimestamps时的修正统计
+func (self *Muxer) CTSFixStats() pktque.CTSFixStats {
+	return self.ctsfix.Stats
+}
+
 func (self *Muxer) WritePacket(pkt av.Packet) (err error) {
 	stream := self.streams[pkt.Idx]
-	pkt.Time += time.Second
+	if stream.Type() == av.H264 && (stream.field != nil || pkt.Picture.IsSingleField()) {
+		return self.writeField(stream, pkt)
+	}
+	return self.writePacket(pkt)
+}
+
+// writeField 单独成packet的顶场和底场合并成一个PES, 使用第一个场的时间戳,
+// 避免两个场的PES时间戳相同, 或者把每个场当作一帧. 没有配对的场单独写入
+func (self *Muxer) writeField(stream *Stream, pkt av.Packet) (err error) {
+	if first := stream.field; first != nil {
+		stream.field = nil
+		if pkt.Picture.IsSingleField() && pkt.Picture != first.Picture {
+			pair := *first
+			pair.Data = append(first.Data, pkt.Data...)
+			pair.Picture = av.PictureFieldPair
+			return self.writePacket(pair)
+		}
+		if err = self.writePacket(*first); err != nil {
+			return
+		}
+	}
+	if !pkt.Picture.IsSingleField() {
+		return self.writePacket(pkt)
+	}
+	// packet的数据可能被调用者复用, 保存副本
+	pkt.Data = append([]byte(nil), pkt.Data...)
+	stream.field = &pkt
+	return
+}
+
+func (self *Muxer) writePacket(pkt av.Packet) (err error) {
+	stream := self.streams[pkt.Idx]
+	// 在场合并之后修正, 配对的两个场作为一帧
+	if self.FixTimestamps && stream.Type().IsVideo() {
+		self.ctsfix.ModifyPacket(&pkt, self.codecs, int(pkt.Idx), -1)
+	}
+	dts := pkt.Time.Duration() + time.Second
 
 	switch stream.Type() {
 	case av.AAC:
 		codec := stream.CodecData.(aacparser.CodecData)
 
-		n := tsio.FillPESHeader(self.peshdr, tsio.StreamIdAAC, len(self.adtshdr)+len(pkt.Data), pkt.Time, 0)
+		n := tsio.FillPESHeader(self.peshdr, tsio.StreamIdAAC, len(self.adtshdr)+len(pkt.Data), dts, 0)
 		self.datav[0] = self.peshdr[:n]
 		aacparser.FillADTSHeader(self.adtshdr, codec.Config, 1024, len(pkt.Data))
 		self.datav[1] = self.adtshdr
 		self.datav[2] = pkt.Data
 
-		if err = stream.tsw.WritePackets(self.w, self.datav[:3], pkt.Time, true, false); err != nil {
+		if err = stream.tsw.WritePackets(self.w, self.datav[:3], dts, true, false); err != nil {
 			return
 		}
 
@@ -214,8 +292,7 @@ func (self *Muxer) WritePacket(pkt av.Packet) (err error) {
 
 		nalus := self.nalus[:0]
 		if pkt.IsKeyFrame {
-			nalus = append(nalus, codec.SPS())
-			nalus = append(nalus, codec.PPS())
+			nalus = append(nalus, codec.ParameterSets()...)
 		}
 		pktnalus, _ := h264parser.SplitNALUs(pkt.Data)
 		for _, nalu := range pktnalus {
@@ -232,10 +309,74 @@ func (self *Muxer) WritePacket(pkt av.Packet) (err error) {
 			datav = append(datav, nalu)
 		}
 
-		n := tsio.FillPESHeader(self.peshdr, tsio.StreamIdH264, -1, pkt.Time+pkt.CompositionTime, pkt.Time)
+		n := tsio.FillPESHeader(self.peshdr, tsio.StreamIdH264, -1, dts+pkt.CompositionTime, dts)
+		datav[0] = self.peshdr[:n]
+
+		if err = stream.tsw.WritePackets(self.w, datav, dts, pkt.IsKeyFrame, false); err != nil {
+			return
+		}
+
+	case av.H265:
+		codec := stream.CodecData.(h265parser.CodecData)
+
+		nalus := self.nalus[:0]
+		if pkt.IsKeyFrame {
+			nalus = append(nalus, codec.VPS())
+			nalus = append(nalus, codec.SPS())
+			nalus = append(nalus, codec.PPS())
+		}
+		pktnalus, _ := h265parser.SplitNALUs(pkt.Data)
+		for _, nalu := range pktnalus {
+			nalus = append(nalus, nalu)
+		}
+
+		datav := self.datav[:1]
+		for i, nalu := range nalus {
+			if i == 0 {
+				datav = append(datav, h265parser.AUDBytes)
+			} else {
+				datav = append(datav, h265parser.StartCodeBytes)
+			}
+			datav = append(datav, nalu)
+		}
+
+		n := tsio.FillPESHeader(self.peshdr, tsio.StreamIdH265, -1, dts+pkt.CompositionTime, dts)
 		datav[0] = self.peshdr[:n]
 
-		if err = stream.tsw.WritePackets(self.w, datav, pkt.Time, pkt.IsKeyFrame, false); err != nil {
+		if err = stream.tsw.WritePackets(self.w, datav, dts, pkt.IsKeyFrame, false); err != nil {
+			return
+		}
+
+	case av.AV1:
+		codec := stream.CodecData.(av1parser.CodecData)
+
+		// 每个temporal unit以temporal delimiter开始, 关键帧之前带sequence header
+		payload := pkt.Data
+		if av1parser.OBUType(payload) == av1parser.OBU_TEMPORAL_DELIMITER {
+			var h av1parser.OBUHeader
+			if h, err = av1parser.ParseOBUHeader(payload); err != nil {
+				return
+			}
+			payload = payload[h.HeaderLen+h.Size:]
+		}
+		tu := append([]byte{}, av1parser.TemporalDelimiter...)
+		if pkt.IsKeyFrame && !av1parser.IsKeyFrame(payload) {
+			tu = append(tu, av1parser.WithSizeField(codec.SequenceHeaderOBU())...)
+		}
+		var data []byte
+		if data, err = av1parser.ToStartCodeFormat(append(tu, payload...)); err != nil {
+			return
+		}
+
+		datalen := len(data)
+		if datalen+tsio.MaxPESHeaderLength > 0xffff {
+			datalen = -1
+		}
+		n := tsio.FillPESHeader(self.peshdr, tsio.StreamIdPrivate1, datalen, dts+pkt.CompositionTime, dts)
+		self.datav[0] = self.peshdr[:n]
+		self.datav[1] = data
+
+		if err = stream.tsw.WritePackets(self.w, self.datav[:2], dts, pkt.IsKeyFrame, false); err != nil {
 			return
 		}
 	}
@@ -346,8 +487,17 @@ func (self *Demuxer) initPMT(payload []byte) (err error) {
 		switch info.StreamType {
 		case tsio.ElementaryStreamTypeH264:
 			self.streams = append(self.streams, stream)
+		case tsio.ElementaryStreamTypeH265:
+			self.streams = append(self.streams, stream)
+		case tsio.ElementaryStreamTypePrivateData:
+			if info.IsAV1() {
+				self.streams = append(self.streams, stream)
+			}
 		case tsio.ElementaryStreamTypeAdtsAAC:
 			self.streams = append(self.streams, stream)
+		case tsio.ElementaryStreamTypeLATMAAC:
+			stream.latm = &aacparser.LATMDemuxer{}
+			self.streams = append(self.streams, stream)
 		}
 	}
 	return
@@ -430,7 +580,7 @@ func (self *Stream) addPacket(payload []byte, timedelta time.Duration, dataType
 	pkt := av.Packet{
 		Idx:           int8(self.idx),
 		IsKeyFrame:    self.iskeyframe,
-		Time:          dts + timedelta,
+		Time:          av.MediaTime(dts + timedelta),
 		Data:          payload,
 		DataType:      dataType,
 		HeaderChanged: headerChanged,
@@ -484,6 +634,36 @@ func (self *Stream) payloadEnd() (n int, err error) {
 			payload = payload[framelen:]
 		}
 
+	case tsio.ElementaryStreamTypeLATMAAC:
+		// 转为裸AAC和MPEG4AudioConfig, 与ADTS一样输出
+		delta := time.Duration(0)
+		for len(payload) > 0 {
+			frames, framelen, ferr := self.latm.ReadFrame(payload)
+			if framelen == 0 || framelen > len(payload) {
+				err = ferr
+				return
+			}
+			payload = payload[framelen:]
+			if ferr != nil {
+				// 还没有收到StreamMuxConfig, 丢弃
+				continue
+			}
+			headerChanged := false
+			if self.CodecData == nil || self.latm.ConfigChanged {
+				headerChanged = self.CodecData != nil
+				self.config = self.latm.Config
+				if err = self.updateAacCodec(); err != nil {
+					return
+				}
+			}
+			for _, frame := range frames {
+				self.addPacket(frame, delta, flvio.TAG_AUDIO, headerChanged)
+				headerChanged = false
+				n++
+				delta += self.config.FrameDuration()
+			}
+		}
+
 	case tsio.ElementaryStreamTypeH264:
 		nalus, _ := h264parser.SplitNALUs(payload)
 		var sps, pps []byte
@@ -538,6 +718,74 @@ func (self *Stream) payloadEnd() (n int, err error) {
 			}
 		}
 
+	case tsio.ElementaryStreamTypeH265:
+		nalus, _ := h265parser.SplitNALUs(payload)
+		var vps, sps, pps []byte
+		headerChanged := false
+		for _, nalu := range nalus {
+			if len(nalu) < 2 {
+				continue
+			}
+			switch naltype := h265parser.NALUType(nalu); {
+			case naltype == h265parser.NAL_UNIT_VPS:
+				vps = nalu
+			case naltype == h265parser.NAL_UNIT_SPS:
+				sps = nalu
+			case naltype == h265parser.NAL_UNIT_PPS:
+				pps = nalu
+			case h265parser.IsDataNALU(nalu):
+				// 参数集在第一个slice之前, 有变化时更新codec
+				if self.CodecData != nil && len(vps) > 0 && len(sps) > 0 && len(pps) > 0 &&
+					!(bytes.Equal(vps, self.vps) && bytes.Equal(sps, self.sps) && bytes.Equal(pps, self.pps)) {
+					self.vps, self.sps, self.pps = vps, sps, pps
+					if err = self.updateHevcCodec(); err != nil {
+						return
+					}
+					headerChanged = true
+				}
+				// raw nalu to avcc
+				b := make([]byte, 4+len(nalu))
+				pio.PutU32BE(b[0:4], uint32(len(nalu)))
+				copy(b[4:], nalu)
+				self.addPacket(b, time.Duration(0), flvio.TAG_VIDEO, headerChanged)
+				headerChanged = false
+				n++
+			}
+		}
+
+		if self.CodecData == nil && len(vps) > 0 && len(sps) > 0 && len(pps) > 0 {
+			self.vps, self.sps, self.pps = vps, sps, pps
+			if err = self.updateHevcCodec(); err != nil {
+				return
+			}
+		}
+
+	case tsio.ElementaryStreamTypePrivateData:
+		var tu []byte
+		if tu, err = av1parser.FromStartCodeFormat(payload); err != nil {
+			return
+		}
+		var obus [][]byte
+		if obus, err = av1parser.SplitOBUs(tu); err != nil {
+			return
+		}
+		headerChanged := false
+		for _, obu := range obus {
+			if av1parser.OBUType(obu) == av1parser.OBU_SEQUENCE_HEADER && !bytes.Equal(obu, self.sps) {
+				headerChanged = self.CodecData != nil
+				self.sps = obu
+				if err = self.updateAv1Codec(); err != nil {
+					return
+				}
+				break
+			}
+		}
+		// sequence header之前的temporal unit不能解码
+		if self.CodecData != nil {
+			self.addPacket(tu, time.Duration(0), flvio.TAG_VIDEO, headerChanged)
+			n++
+		}
+
 	}
 
 	return
@@ -591,7 +839,7 @@ func (self *Stream) updateAacCodec() (err error) {
 	case 2:
 		tag.SoundType = flvio.SOUND_STEREO
 	}
-	codec.SequnceHeaderTag = tag
+	codec.SetSequenceHeaderTag(tag)
 	self.CodecData = codec
 	return nil
 }
@@ -610,7 +858,45 @@ func (self *Stream) updateAvcCodec() (err error) {
 		Data:          codec.AVCDecoderConfRecordBytes(),
 		FrameType:     flvio.FRAME_KEY,
 	}
-	codec.SequnceHeaderTag = tag
+	codec.SetSequenceHeaderTag(tag)
+	self.CodecData = codec
+	return nil
+}
+
+func (self *Stream) updateHevcCodec() (err error) {
+	codec, err := h265parser.NewCodecDataFromVPSAndSPSAndPPS(self.vps, self.sps, self.pps)
+	if err != nil {
+		return
+	}
+	// hack gen flv hvcc tag
+	tag := flvio.Tag{
+		Type:          flvio.TAG_VIDEO,
+		AVCPacketType: flvio.AVC_SEQHDR,
+		CodecID:       flvio.VIDEO_H265,
+		Data:          codec.AVCDecoderConfRecordBytes(),
+		FrameType:     flvio.FRAME_KEY,
+	}
+	codec.SetSequenceHeaderTag(tag)
+	self.CodecData = codec
+	return nil
+}
+
+func (self *Stream) updateAv1Codec() (err error) {
+	codec, err := av1parser.NewCodecDataFromSequenceHeader(self.sps)
+	if err != nil {
+		return
+	}
+	// hack gen flv av1C tag
+	tag := flvio.Tag{
+		Type:          flvio.TAG_VIDEO,
+		AVCPacketType: flvio.AVC_SEQHDR,
+		IsExHeader:    true,
+		ExPacketType:  flvio.PKTTYPE_SEQUENCE_START,
+		FourCC:        flvio.FOURCC_AV01,
+		Data:          codec.AV1CodecConfRecordBytes(),
+		FrameType:     flvio.FRAME_KEY,
+	}
+	codec.SetSequenceHeaderTag(tag)
 	self.CodecData = codec
 	return nil
 }
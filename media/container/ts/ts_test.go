@@ -0,0 +1,84 @@
+package ts
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bugVanisher/streamer/media/av"
+	"github.com/bugVanisher/streamer/media/codec/h264parser"
+)
+
+// videoPESCount 视频流(pid 0x100)的PES个数
+func videoPESCount(b []byte) (n int) {
+	for ; len(b) >= 188; b = b[188:] {
+		pid := uint16(b[1]&0x1f)<<8 | uint16(b[2])
+		if pid == 0x100 && b[1]&0x40 != 0 {
+			n++
+		}
+	}
+	return
+}
+
+func TestMuxerFieldPair(t *testing.T) {
+	sps := []byte{0x67, 0x64, 0x00, 0x1e, 0xac, 0xd9, 0x40, 0xa0, 0x2f, 0xf9, 0x70, 0x11, 0x00, 0x00, 0x03,
+		0x00, 0x01, 0x00, 0x00, 0x03, 0x00, 0x32, 0x0f, 0x16, 0x2d, 0x96}
+	pps := []byte{0x68, 0xeb, 0xe3, 0xcb, 0x22, 0xc0}
+	codec, err := h264parser.NewCodecDataFromSPSAndPPS(sps, pps)
+	require.Nil(t, err)
+
+	buf := &bytes.Buffer{}
+	m := NewMuxer(buf)
+	require.Nil(t, m.WriteHeader([]av.CodecData{codec}))
+	psi := buf.Len()
+
+	field := func(ts time.Duration, picture av.PictureStructure, key bool) av.Packet {
+		return av.Packet{IsKeyFrame: key, DataType: av.FLV_TAG_VIDEO, AVCPacketType: av.AVC_NALU,
+			Time: av.MediaTimeFromDuration(ts), Data: []byte{0, 0, 0, 2, 0x65, 0x88}, Picture: picture}
+	}
+	// 顶场和底场各一个packet, 合并为一个PES
+	require.Nil(t, m.WritePacket(field(0, av.PictureTopField, true)))
+	require.Equal(t, psi, buf.Len())
+	require.Nil(t, m.WritePacket(field(0, av.PictureBottomField, false)))
+	require.Equal(t, 1, videoPESCount(buf.Bytes()))
+
+	// 连续两个同极性的场不能配对, 分别写入
+	require.Nil(t, m.WritePacket(field(40*time.Millisecond, av.PictureTopField, false)))
+	require.Nil(t, m.WritePacket(field(60*time.Millisecond, av.PictureTopField, false)))
+	require.Equal(t, 2, videoPESCount(buf.Bytes()))
+	// 帧packet写入前先写出等待中的场
+	require.Nil(t, m.WritePacket(field(80*time.Millisecond, av.PictureInterlacedFrame, false)))
+	require.Equal(t, 4, videoPESCount(buf.Bytes()))
+
+	// trailer写出没有配对的场
+	require.Nil(t, m.WritePacket(field(120*time.Millisecond, av.PictureBottomField, false)))
+	require.Equal(t, 4, videoPESCount(buf.Bytes()))
+	require.Nil(t, m.WriteTrailer())
+	require.Equal(t, 5, videoPESCount(buf.Bytes()))
+}
+
+func TestMuxerFixTimestamps(t *testing.T) {
+	sps := []byte{0x67, 0x64, 0x00, 0x1e, 0xac, 0xd9, 0x40, 0xa0, 0x2f, 0xf9, 0x70, 0x11, 0x00, 0x00, 0x03,
+		0x00, 0x01, 0x00, 0x00, 0x03, 0x00, 0x32, 0x0f, 0x16, 0x2d, 0x96}
+	pps := []byte{0x68, 0xeb, 0xe3, 0xcb, 0x22, 0xc0}
+	codec, err := h264parser.NewCodecDataFromSPSAndPPS(sps, pps)
+	require.Nil(t, err)
+
+	m := NewMuxer(&bytes.Buffer{})
+	m.FixTimestamps = true
+	require.Nil(t, m.WriteHeader([]av.CodecData{codec}))
+	frame := func(ts, cts time.Duration) av.Packet {
+		return av.Packet{DataType: av.FLV_TAG_VIDEO, AVCPacketType: av.AVC_NALU, Time: av.MediaTimeFromDuration(ts),
+			CompositionTime: cts, Data: []byte{0, 0, 0, 2, 0x41, 0x88}}
+	}
+	require.Nil(t, m.WritePacket(frame(0, 0)))
+	require.Nil(t, m.WritePacket(frame(40*time.Millisecond, -40*time.Millisecond)))
+	require.Nil(t, m.WritePacket(frame(20*time.Millisecond, 0)))
+
+	stats := m.CTSFixStats()
+	require.Equal(t, int64(3), stats.Frames)
+	require.Equal(t, int64(1), stats.DTSFixed)
+	require.Equal(t, int64(2), stats.NegativeCTS)
+}
@@ -1,6 +1,7 @@
 package tsio
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"time"
@@ -10,7 +11,10 @@ import (
 
 const (
 	StreamIdH264 = 0xe0
+	StreamIdH265 = 0xe0
 	StreamIdAAC  = 0xc0
+	// StreamIdPrivate1 private_stream_1, AV1使用
+	StreamIdPrivate1 = 0xbd
 )
 
 const (
@@ -34,9 +38,36 @@ var ErrParsePAT = fmt.Errorf("invalid PAT")
 
 const (
 	ElementaryStreamTypeH264    = 0x1B
+	ElementaryStreamTypeH265    = 0x24
 	ElementaryStreamTypeAdtsAAC = 0x0F
+	// ElementaryStreamTypeLATMAAC LOAS/LATM封装的AAC
+	ElementaryStreamTypeLATMAAC = 0x11
+	// ElementaryStreamTypePrivateData PES中的私有数据, 由registration descriptor确定格式
+	ElementaryStreamTypePrivateData = 0x06
 )
 
+// AV1的descriptor, 见AOM的Carriage of AV1 in MPEG-2 TS
+const (
+	DescriptorTagRegistration = 0x05
+	DescriptorTagAV1Video     = 0x80
+)
+
+// FormatIdentifierAV1 registration descriptor中AV1的format_identifier
+var FormatIdentifierAV1 = []byte("AV01")
+
+// IsAV1 私有数据流是否带AV1的registration descriptor
+func (self ElementaryStreamInfo) IsAV1() bool {
+	if self.StreamType != ElementaryStreamTypePrivateData {
+		return false
+	}
+	for _, desc := range self.Descriptors {
+		if desc.Tag == DescriptorTagRegistration && bytes.HasPrefix(desc.Data, FormatIdentifierAV1) {
+			return true
+		}
+	}
+	return false
+}
+
 type PATEntry struct {
 	ProgramNumber uint16
 	NetworkPID    uint16
@@ -193,7 +224,7 @@ func (self PMT) parseDescs(b []byte) (descs []Descriptor, err error) {
 			desc.Tag = b[n]
 			desc.Data = make([]byte, b[n+1])
 			n += 2
-			if n+len(desc.Data) < len(b) {
+			if n+len(desc.Data) <= len(b) {
 				copy(desc.Data, b[n:])
 				descs = append(descs, desc)
 				n += len(desc.Data)
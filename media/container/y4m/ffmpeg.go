@@ -0,0 +1,179 @@
+//go:build ffmpeg && cgo
+
+package y4m
+
+/*
+#cgo pkg-config: libavcodec libavutil
+#include <errno.h>
+#include <stdlib.h>
+#include <string.h>
+#include <libavcodec/avcodec.h>
+#include <libavutil/pixfmt.h>
+
+static int averror_eagain() { return AVERROR(EAGAIN); }
+static int averror_eof() { return AVERROR_EOF; }
+
+static int set_extradata(AVCodecContext *ctx, const void *data, int size) {
+	ctx->extradata = av_mallocz(size + AV_INPUT_BUFFER_PADDING_SIZE);
+	if (!ctx->extradata) {
+		return AVERROR(ENOMEM);
+	}
+	memcpy(ctx->extradata, data, size);
+	ctx->extradata_size = size;
+	return 0;
+}
+*/
+import "C"
+
+import (
+	"fmt"
+	"unsafe"
+
+	"github.com/bugVanisher/streamer/media/av"
+	"github.com/bugVanisher/streamer/media/codec/h264parser"
+	"github.com/bugVanisher/streamer/media/codec/h265parser"
+)
+
+// FFmpegAvailable 是否以-tags ffmpeg编译, 包含ffmpeg解码器
+const FFmpegAvailable = true
+
+// ffmpegDecoder 用libavcodec解码AVCC格式的H.264/H.265 packet, 输出YUV420P的帧
+type ffmpegDecoder struct {
+	ctx   *C.AVCodecContext
+	frame *C.AVFrame
+	pkt   *C.AVPacket
+}
+
+// NewFFmpegDecoder 用AVCDecoderConfigurationRecord/HEVCDecoderConfigurationRecord作为extradata创建解码器
+func NewFFmpegDecoder(codec av.VideoCodecData) (Decoder, error) {
+	var id C.enum_AVCodecID
+	var extradata []byte
+	switch c := codec.(type) {
+	case h264parser.CodecData:
+		id = C.AV_CODEC_ID_H264
+		extradata = c.AVCDecoderConfRecordBytes()
+	case h265parser.CodecData:
+		id = C.AV_CODEC_ID_HEVC
+		extradata = c.AVCDecoderConfRecordBytes()
+	default:
+		return nil, fmt.Errorf("y4m: ffmpeg: unsupported video codec %v", codec.Type())
+	}
+	avcodec := C.avcodec_find_decoder(id)
+	if avcodec == nil {
+		return nil, fmt.Errorf("y4m: ffmpeg: no decoder for %v", codec.Type())
+	}
+	dec := &ffmpegDecoder{ctx: C.avcodec_alloc_context3(avcodec)}
+	if dec.ctx == nil {
+		return nil, fmt.Errorf("y4m: ffmpeg: alloc codec context failed")
+	}
+	if len(extradata) > 0 {
+		if r := C.set_extradata(dec.ctx, unsafe.Pointer(&extradata[0]), C.int(len(extradata))); r < 0 {
+			dec.Close()
+			return nil, averror("set extradata", r)
+		}
+	}
+	if r := C.avcodec_open2(dec.ctx, avcodec, nil); r < 0 {
+		dec.Close()
+		return nil, averror("avcodec_open2", r)
+	}
+	dec.frame = C.av_frame_alloc()
+	dec.pkt = C.av_packet_alloc()
+	if dec.frame == nil || dec.pkt == nil {
+		dec.Close()
+		return nil, fmt.Errorf("y4m: ffmpeg: alloc frame failed")
+	}
+	return dec, nil
+}
+
+func (self *ffmpegDecoder) Decode(pkt av.Packet) (frames []*Frame, err error) {
+	if len(pkt.Data) == 0 {
+		return
+	}
+	// packet数据复制到ffmpeg分配的内存, C结构中不能保存Go指针
+	if r := C.av_new_packet(self.pkt, C.int(len(pkt.Data))); r < 0 {
+		return nil, averror("av_new_packet", r)
+	}
+	C.memcpy(unsafe.Pointer(self.pkt.data), unsafe.Pointer(&pkt.Data[0]), C.size_t(len(pkt.Data)))
+	self.pkt.dts = C.int64_t(pkt.Time.Ms())
+	self.pkt.pts = C.int64_t(pkt.Time.Ms()) + C.int64_t(pkt.CompositionTime.Milliseconds())
+	if pkt.IsKeyFrame {
+		self.pkt.flags |= C.AV_PKT_FLAG_KEY
+	}
+	r := C.avcodec_send_packet(self.ctx, self.pkt)
+	C.av_packet_unref(self.pkt)
+	if r < 0 {
+		return nil, averror("avcodec_send_packet", r)
+	}
+	return self.receive()
+}
+
+// Flush 送入空packet, 取出解码延迟中的剩余帧
+func (self *ffmpegDecoder) Flush() (frames []*Frame, err error) {
+	if r := C.avcodec_send_packet(self.ctx, nil); r < 0 && r != C.averror_eof() {
+		return nil, averror("avcodec_send_packet", r)
+	}
+	return self.receive()
+}
+
+func (self *ffmpegDecoder) receive() (frames []*Frame, err error) {
+	for {
+		r := C.avcodec_receive_frame(self.ctx, self.frame)
+		if r == C.averror_eagain() || r == C.averror_eof() {
+			return
+		}
+		if r < 0 {
+			return frames, averror("avcodec_receive_frame", r)
+		}
+		f, err := self.copyFrame()
+		C.av_frame_unref(self.frame)
+		if err != nil {
+			return frames, err
+		}
+		frames = append(frames, f)
+	}
+}
+
+// copyFrame 按行复制去掉linesize的填充
+func (self *ffmpegDecoder) copyFrame() (*Frame, error) {
+	src := self.frame
+	if src.format != C.AV_PIX_FMT_YUV420P && src.format != C.AV_PIX_FMT_YUVJ420P {
+		return nil, fmt.Errorf("y4m: ffmpeg: unsupported pixel format %d, only yuv420p", int(src.format))
+	}
+	f := &Frame{Width: int(src.width), Height: int(src.height)}
+	cw, ch := f.ChromaSize()
+	planes := []*[]byte{&f.Y, &f.U, &f.V}
+	for i, plane := range planes {
+		w, h := f.Width, f.Height
+		if i > 0 {
+			w, h = cw, ch
+		}
+		stride := int(src.linesize[i])
+		data := unsafe.Slice((*byte)(unsafe.Pointer(src.data[i])), stride*(h-1)+w)
+		buf := make([]byte, w*h)
+		for y := 0; y < h; y++ {
+			copy(buf[y*w:(y+1)*w], data[y*stride:])
+		}
+		*plane = buf
+	}
+	return f, nil
+}
+
+func (self *ffmpegDecoder) Close() error {
+	if self.pkt != nil {
+		C.av_packet_free(&self.pkt)
+	}
+	if self.frame != nil {
+		C.av_frame_free(&self.frame)
+	}
+	if self.ctx != nil {
+		C.avcodec_free_context(&self.ctx)
+	}
+	return nil
+}
+
+func averror(op string, r C.int) error {
+	buf := (*C.char)(C.malloc(C.AV_ERROR_MAX_STRING_SIZE))
+	defer C.free(unsafe.Pointer(buf))
+	C.av_strerror(r, buf, C.AV_ERROR_MAX_STRING_SIZE)
+	return fmt.Errorf("y4m: ffmpeg: %s: %s", op, C.GoString(buf))
+}
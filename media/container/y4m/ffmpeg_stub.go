@@ -0,0 +1,15 @@
+//go:build !ffmpeg || !cgo
+
+package y4m
+
+import (
+	"github.com/bugVanisher/streamer/media/av"
+)
+
+// FFmpegAvailable 是否以-tags ffmpeg编译, 包含ffmpeg解码器
+const FFmpegAvailable = false
+
+// NewFFmpegDecoder 没有ffmpeg时总是返回ErrNoFFmpeg
+func NewFFmpegDecoder(codec av.VideoCodecData) (Decoder, error) {
+	return nil, ErrNoFFmpeg
+}
@@ -0,0 +1,165 @@
+// Package y4m 把解码后的视频帧写成YUV4MPEG2(Y4M)文件, 用于和参考解码结果做像素级比对.
+// 解码由Decoder完成, 默认的ffmpeg解码器需要以-tags ffmpeg编译
+package y4m
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/bugVanisher/streamer/media/av"
+)
+
+// ErrNoFFmpeg 没有以-tags ffmpeg编译时NewFFmpegDecoder返回的错误
+var ErrNoFFmpeg = errors.New("y4m: built without ffmpeg, rebuild with -tags ffmpeg (needs cgo and libavcodec)")
+
+// Frame 一帧YUV 4:2:0图像, 各平面按宽度紧密排列, 色度平面宽高为亮度的一半(向上取整)
+type Frame struct {
+	Width  int
+	Height int
+	Y      []byte
+	U      []byte
+	V      []byte
+}
+
+// ChromaSize 色度平面的宽和高
+func (f *Frame) ChromaSize() (w, h int) {
+	return (f.Width + 1) / 2, (f.Height + 1) / 2
+}
+
+// Decoder 视频解码器, Decode可能因为解码延迟不返回或返回多帧, Flush返回剩余的帧
+type Decoder interface {
+	Decode(pkt av.Packet) ([]*Frame, error)
+	Flush() ([]*Frame, error)
+	Close() error
+}
+
+// Writer 写Y4M文件, 第一帧决定文件头中的分辨率, 之后的帧分辨率必须相同
+type Writer struct {
+	w      io.Writer
+	fps    int
+	width  int
+	height int
+	Frames int
+}
+
+// NewWriter fps不大于0时写入25
+func NewWriter(w io.Writer, fps int) *Writer {
+	if fps <= 0 {
+		fps = 25
+	}
+	return &Writer{w: w, fps: fps}
+}
+
+func (self *Writer) WriteFrame(f *Frame) (err error) {
+	cw, ch := f.ChromaSize()
+	if len(f.Y) < f.Width*f.Height || len(f.U) < cw*ch || len(f.V) < cw*ch {
+		return fmt.Errorf("y4m: frame %dx%d planes too short", f.Width, f.Height)
+	}
+	if self.Frames == 0 {
+		self.width, self.height = f.Width, f.Height
+		if _, err = fmt.Fprintf(self.w, "YUV4MPEG2 W%d H%d F%d:1 Ip A1:1 C420jpeg\n", f.Width, f.Height, self.fps); err != nil {
+			return
+		}
+	} else if f.Width != self.width || f.Height != self.height {
+		return fmt.Errorf("y4m: resolution changed from %dx%d to %dx%d", self.width, self.height, f.Width, f.Height)
+	}
+	for _, b := range [][]byte{[]byte("FRAME\n"), f.Y[:f.Width*f.Height], f.U[:cw*ch], f.V[:cw*ch]} {
+		if _, err = self.w.Write(b); err != nil {
+			return
+		}
+	}
+	self.Frames++
+	return
+}
+
+// Muxer 解码第一路视频流并把每一帧写入Y4M, 其他流被忽略
+type Muxer struct {
+	w          io.Writer
+	newDecoder func(av.VideoCodecData) (Decoder, error)
+	yw         *Writer
+	dec        Decoder
+	idx        int
+}
+
+// NewMuxer newDecoder为每个视频header创建解码器, 见NewFFmpegMuxer
+func NewMuxer(w io.Writer, newDecoder func(av.VideoCodecData) (Decoder, error)) *Muxer {
+	return &Muxer{w: w, newDecoder: newDecoder, idx: -1}
+}
+
+// NewFFmpegMuxer 用ffmpeg解码的Muxer, 没有以-tags ffmpeg编译时WriteHeader返回ErrNoFFmpeg
+func NewFFmpegMuxer(w io.Writer) *Muxer {
+	return NewMuxer(w, NewFFmpegDecoder)
+}
+
+// WriteHeader header变化时先输出旧解码器中剩余的帧, 再用新的header创建解码器
+func (self *Muxer) WriteHeader(streams []av.CodecData) (err error) {
+	for i, stream := range streams {
+		video, ok := stream.(av.VideoCodecData)
+		if !ok {
+			continue
+		}
+		if err = self.closeDecoder(); err != nil {
+			return
+		}
+		if self.dec, err = self.newDecoder(video); err != nil {
+			return
+		}
+		self.idx = i
+		if self.yw == nil {
+			fps := 0
+			if f, ok := stream.(interface{ FPS() int }); ok {
+				fps = f.FPS()
+			}
+			self.yw = NewWriter(self.w, fps)
+		}
+		return
+	}
+	return fmt.Errorf("y4m: no video stream")
+}
+
+func (self *Muxer) WritePacket(pkt av.Packet) (err error) {
+	if self.dec == nil || int(pkt.Idx) != self.idx || pkt.IsSequenceHeader() || pkt.IsScriptData() {
+		return
+	}
+	frames, err := self.dec.Decode(pkt)
+	if err != nil {
+		return
+	}
+	return self.writeFrames(frames)
+}
+
+func (self *Muxer) WriteTrailer() error {
+	return self.closeDecoder()
+}
+
+// Frames 已写入的帧数
+func (self *Muxer) Frames() int {
+	if self.yw == nil {
+		return 0
+	}
+	return self.yw.Frames
+}
+
+func (self *Muxer) closeDecoder() (err error) {
+	if self.dec == nil {
+		return
+	}
+	dec := self.dec
+	self.dec = nil
+	defer dec.Close()
+	frames, err := dec.Flush()
+	if err != nil {
+		return
+	}
+	return self.writeFrames(frames)
+}
+
+func (self *Muxer) writeFrames(frames []*Frame) (err error) {
+	for _, f := range frames {
+		if err = self.yw.WriteFrame(f); err != nil {
+			return
+		}
+	}
+	return
+}
@@ -0,0 +1,87 @@
+package y4m
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bugVanisher/streamer/media/av"
+	"github.com/bugVanisher/streamer/media/codec/aacparser"
+	"github.com/bugVanisher/streamer/media/codec/h264parser"
+)
+
+// fakeDecoder 每个packet延迟一帧输出, 帧的像素值为packet的第一个字节
+type fakeDecoder struct {
+	pending []*Frame
+	closed  bool
+}
+
+func (d *fakeDecoder) frame(v byte) *Frame {
+	return &Frame{Width: 3, Height: 2, Y: bytes.Repeat([]byte{v}, 6), U: []byte{v, v}, V: []byte{v, v}}
+}
+
+func (d *fakeDecoder) Decode(pkt av.Packet) (frames []*Frame, err error) {
+	frames, d.pending = d.pending, []*Frame{d.frame(pkt.Data[0])}
+	return
+}
+
+func (d *fakeDecoder) Flush() (frames []*Frame, err error) {
+	frames, d.pending = d.pending, nil
+	return
+}
+
+func (d *fakeDecoder) Close() error {
+	d.closed = true
+	return nil
+}
+
+func TestMuxer(t *testing.T) {
+	aac, err := aacparser.NewCodecDataFromMPEG4AudioConfigBytes([]byte{0x12, 0x10})
+	require.Nil(t, err)
+	sps := []byte{0x67, 0x64, 0x00, 0x1e, 0xac, 0xd9, 0x40, 0xa0, 0x2f, 0xf9, 0x70, 0x11, 0x00, 0x00, 0x03,
+		0x00, 0x01, 0x00, 0x00, 0x03, 0x00, 0x32, 0x0f, 0x16, 0x2d, 0x96}
+	h264, err := h264parser.NewCodecDataFromSPSAndPPS(sps, []byte{0x68, 0xeb, 0xe3, 0xcb, 0x22, 0xc0})
+	require.Nil(t, err)
+
+	var buf bytes.Buffer
+	var decs []*fakeDecoder
+	m := NewMuxer(&buf, func(av.VideoCodecData) (Decoder, error) {
+		decs = append(decs, &fakeDecoder{})
+		return decs[len(decs)-1], nil
+	})
+	require.Nil(t, m.WriteHeader([]av.CodecData{aac, h264}))
+	require.Nil(t, m.WritePacket(av.Packet{Idx: 1, DataType: av.FLV_TAG_VIDEO, AVCPacketType: av.AVC_NALU, Data: []byte{1}}))
+	require.Nil(t, m.WritePacket(av.Packet{Idx: 0, DataType: av.FLV_TAG_AUDIO, AVCPacketType: av.AVC_NALU, Data: []byte{9}}))
+	require.Nil(t, m.WritePacket(av.Packet{Idx: 1, DataType: av.FLV_TAG_VIDEO, AVCPacketType: av.AVC_NALU, Data: []byte{2}}))
+	// header变化时输出旧解码器剩余的帧
+	require.Nil(t, m.WriteHeader([]av.CodecData{aac, h264}))
+	require.True(t, decs[0].closed)
+	require.Nil(t, m.WritePacket(av.Packet{Idx: 1, DataType: av.FLV_TAG_VIDEO, AVCPacketType: av.AVC_NALU, Data: []byte{3}}))
+	require.Nil(t, m.WriteTrailer())
+	require.Equal(t, 3, m.Frames())
+
+	var want []byte
+	// 帧率来自SPS的VUI
+	want = append(want, "YUV4MPEG2 W3 H2 F50:1 Ip A1:1 C420jpeg\n"...)
+	for _, v := range []byte{1, 2, 3} {
+		want = append(want, "FRAME\n"...)
+		want = append(want, bytes.Repeat([]byte{v}, 10)...)
+	}
+	require.Equal(t, want, buf.Bytes())
+}
+
+func TestWriterResolutionChange(t *testing.T) {
+	w := NewWriter(&bytes.Buffer{}, 30)
+	d := &fakeDecoder{}
+	require.Nil(t, w.WriteFrame(d.frame(0)))
+	require.NotNil(t, w.WriteFrame(&Frame{Width: 2, Height: 2, Y: make([]byte, 4), U: []byte{0}, V: []byte{0}}))
+}
+
+func TestNoFFmpeg(t *testing.T) {
+	if FFmpegAvailable {
+		t.Skip("built with ffmpeg")
+	}
+	_, err := NewFFmpegDecoder(nil)
+	require.Equal(t, ErrNoFFmpeg, err)
+}
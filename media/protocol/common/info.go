@@ -8,4 +8,6 @@ type Info struct {
 	RawURL       string
 	IsPublishing bool
 	IsPlaying    bool
+	// Vhost 虚拟主机, 来自tcUrl或app、流名的vhost参数(SRS风格), 未指定时为空
+	Vhost string
 }
@@ -4,9 +4,11 @@ import (
 	"bytes"
 	"container/list"
 	"fmt"
+	"github.com/bugVanisher/streamer/statistics"
 	"github.com/rs/zerolog/log"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"sync"
 	"time"
 )
@@ -35,6 +37,18 @@ type TSCache struct {
 
 	m3u8body *bytes.Buffer
 	m3u8Lock sync.RWMutex
+	m3u8Seq  int // m3u8中第一个切片的序号
+
+	subtitles []*SubtitleTrack
+
+	stats *SegmentStats
+
+	// overhead ServeHTTP回复的播放列表和切片字节数相对切片中媒体负载的开销
+	overhead *statistics.Overhead
+
+	// m3u8ETag/m3u8ModTime 当前m3u8的版本, 用于条件请求, 由m3u8Lock保护
+	m3u8ETag    string
+	m3u8ModTime time.Time
 }
 
 func NewTSCache(id, path string, hlsWindow int) *TSCache {
@@ -45,6 +59,7 @@ func NewTSCache(id, path string, hlsWindow int) *TSCache {
 		ll:        list.New(),
 		lm:        make(map[string]TSItem),
 		m3u8body:  bytes.NewBuffer(nil),
+		overhead:  statistics.NewOverhead("hls"),
 	}
 }
 
@@ -52,6 +67,85 @@ func (c *TSCache) ID() string {
 	return c.id
 }
 
+// SetSegmentStats 设置切片统计, 之后SetItem的切片都会被记录
+func (c *TSCache) SetSegmentStats(stats *SegmentStats) {
+	c.stats = stats
+}
+
+// Overhead ServeHTTP的协议开销统计, 网络字节包括播放列表和切片的响应体, 媒体字节为回复的切片中的负载
+func (c *TSCache) Overhead() *statistics.Overhead {
+	return c.overhead
+}
+
+// SegmentReport 返回切片统计报告, 未设置统计时返回空报告
+func (c *TSCache) SegmentReport() SegmentReport {
+	if c.stats == nil {
+		return SegmentReport{}
+	}
+	return c.stats.Report()
+}
+
+// AddSubtitleTrack 添加WebVTT字幕轨道, 之后SetItem的每个ts切片都切出对应的字幕切片. 录制模式不生成字幕
+func (c *TSCache) AddSubtitleTrack(track *SubtitleTrack) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.subtitles = append(c.subtitles, track)
+}
+
+func (c *TSCache) subtitleTrack(name string) *SubtitleTrack {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	for _, t := range c.subtitles {
+		if t.Name == name || t.PlayListName() == name {
+			return t
+		}
+	}
+	return nil
+}
+
+// GetSubtitlePlayList 字幕轨道的媒体playlist, name为轨道名或playlist文件名
+func (c *TSCache) GetSubtitlePlayList(name string) ([]byte, error) {
+	t := c.subtitleTrack(name)
+	if t == nil {
+		return nil, ErrM3u8Empty
+	}
+	c.m3u8Lock.RLock()
+	seq := c.m3u8Seq
+	c.m3u8Lock.RUnlock()
+	body := t.playList(seq)
+	if body == nil {
+		return nil, ErrM3u8Empty
+	}
+	return body, nil
+}
+
+// GetSubtitleItem 字幕切片, key为切片文件名
+func (c *TSCache) GetSubtitleItem(key string) ([]byte, error) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	for _, t := range c.subtitles {
+		if data, ok := t.segment(key); ok {
+			return data, nil
+		}
+	}
+	return nil, ErrNoTsKey
+}
+
+// GetMasterPlayList master playlist, variant为ts媒体playlist的地址, 带有字幕轨道时作为SUBTITLES rendition
+func (c *TSCache) GetMasterPlayList(variant string, bandwidth int) []byte {
+	c.lock.RLock()
+	tracks := c.subtitles
+	c.lock.RUnlock()
+	w := bytes.NewBufferString("#EXTM3U\n#EXT-X-VERSION:3\n")
+	w.WriteString(subtitleMedia(tracks))
+	fmt.Fprintf(w, "#EXT-X-STREAM-INF:BANDWIDTH=%d", bandwidth)
+	if len(tracks) > 0 {
+		fmt.Fprintf(w, ",SUBTITLES=\"%s\"", SubtitleGroupID)
+	}
+	fmt.Fprintf(w, "\n%s\n", variant)
+	return w.Bytes()
+}
+
 func (c *TSCache) IsRecord() bool {
 	return c.hlsWindow == 0
 }
@@ -76,7 +170,10 @@ func (c *TSCache) genRecordM3U8PlayList(key string, item TSItem) {
 	}
 
 	c.DumpTsFile(key, item)
+	c.m3u8Lock.Lock()
+	defer c.m3u8Lock.Unlock()
 	fmt.Fprintf(c.m3u8body, "#EXTINF:%.3f,\n%s\n", float64(item.Duration)/float64(1000), item.Name)
+	c.updatePlayListVersion()
 }
 
 func (c *TSCache) genM3U8PlayList() {
@@ -111,9 +208,46 @@ func (c *TSCache) genM3U8PlayList() {
 		"#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-ALLOW-CACHE:NO\n#EXT-X-TARGETDURATION:%d\n#EXT-X-MEDIA-SEQUENCE:%d\n\n",
 		maxDuration/1000+1, seq)
 	c.m3u8body.Write(w.Bytes())
+	c.m3u8Seq = seq
+	c.updatePlayListVersion()
+}
+
+// updatePlayListVersion m3u8内容变化后更新ETag和修改时间, 调用时需持有m3u8Lock
+func (c *TSCache) updatePlayListVersion() {
+	etag := playListETag(c.m3u8body.Bytes())
+	if etag != c.m3u8ETag {
+		c.m3u8ETag = etag
+		c.m3u8ModTime = time.Now()
+	}
+}
+
+// GetM3U8PlayListVersion 返回m3u8内容及其ETag和修改时间
+func (c *TSCache) GetM3U8PlayListVersion() (body []byte, etag string, modTime time.Time, err error) {
+	c.m3u8Lock.RLock()
+	defer c.m3u8Lock.RUnlock()
+	if c.m3u8body.Len() == 0 {
+		return nil, "", time.Time{}, ErrM3u8Empty
+	}
+	body = append([]byte(nil), c.m3u8body.Bytes()...)
+	return body, c.m3u8ETag, c.m3u8ModTime, nil
 }
 
 func (c *TSCache) SetItem(key string, item TSItem) {
+	if c.stats != nil {
+		record := SegmentRecord{
+			Name:            item.Name,
+			SeqNum:          item.SeqNum,
+			Duration:        item.Duration,
+			Size:            len(item.Data),
+			KeyFrameAligned: item.KeyFrameAligned,
+			GenLatency:      item.GenLatency,
+		}
+		c.stats.Add(record)
+		if c.stats.IsViolation(record) {
+			log.Warn().Str("streamID", c.id).Str("tsFile", key).Int("duration", item.Duration).
+				Msg("[hls] segment duration out of target")
+		}
+	}
 	if c.IsRecord() {
 		c.genRecordM3U8PlayList(key, item)
 		return
@@ -143,6 +277,15 @@ func (c *TSCache) SetItem(key string, item TSItem) {
 
 	// 更新m3u8
 	c.genM3U8PlayList()
+
+	// 字幕切片和ts切片对齐, 淘汰到窗口中的第一个ts切片
+	if len(c.subtitles) > 0 {
+		first := c.lm[c.ll.Front().Value.(string)].SeqNum
+		for _, t := range c.subtitles {
+			t.cut(item.SeqNum, item.Start, time.Duration(item.Duration)*time.Millisecond)
+			t.evict(first)
+		}
+	}
 }
 
 func (c *TSCache) GetItem(key string) (TSItem, error) {
@@ -189,8 +332,11 @@ func (c *TSCache) DumpM3U8PlayList() {
 	w.Write(c.m3u8body.Bytes())
 	w.WriteString("#EXT-X-ENDLIST\n")
 	log.Info().Str("m3u8", c.m3u8body.String()).Msg("[hls] DumpM3U8PlayList")
+	if c.stats != nil {
+		log.Info().Str("streamID", c.id).Str("report", c.stats.Report().String()).Msg("[hls] segment statistic")
+	}
 
-	m3u8Path := fmt.Sprintf("%s/%s_%d.m3u8", c.path, c.id, c.firstTsTimeStamp)
+	m3u8Path := filepath.Join(c.path, fmt.Sprintf("%s_%d.m3u8", c.id, c.firstTsTimeStamp))
 	err := ioutil.WriteFile(m3u8Path, w.Bytes(), os.ModePerm)
 	if err != nil {
 		log.Error().Str("streamID", c.id).Str("m3u8Path", m3u8Path).Err(err).Msg("[hls] DumpM3U8PlayList WriteFile")
@@ -203,8 +349,8 @@ func (c *TSCache) DumpTsFile(key string, item TSItem) {
 	if len(c.path) == 0 {
 		return
 	}
-	os.MkdirAll(c.path+"/"+c.id, os.ModePerm)
-	tsFile := c.path + "/" + c.id + "/" + key
+	os.MkdirAll(filepath.Join(c.path, c.id), os.ModePerm)
+	tsFile := filepath.Join(c.path, c.id, key)
 	err := ioutil.WriteFile(tsFile, item.Data, 0666)
 	if err != nil {
 		log.Error().Str("streamID", c.id).
@@ -218,6 +364,13 @@ type TSItem struct {
 	SeqNum   int
 	Duration int
 	Data     []byte
+	// Start 切片第一个packet的时间, 用于对齐字幕切片, 只需要设置第一个切片
+	Start time.Duration
+
+	KeyFrameAligned bool
+	GenLatency      time.Duration
+	// MediaBytes 切片中音视频packet的负载字节数, 由Segmenter设置
+	MediaBytes int
 }
 
 func NewTSItem(name string, duration, seqNum int, b []byte) TSItem {
@@ -3,6 +3,9 @@ package hls
 import (
 	"fmt"
 	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
 )
 
 func TestTSCache_GetItem(t *testing.T) {
@@ -56,3 +59,27 @@ func BenchmarkTSCache_GetItem(b *testing.B) {
 		tsCache.GetItem("test1-5.ts")
 	}
 }
+
+func TestSegmentStats_Report(t *testing.T) {
+	tsCache := NewTSCache("test2", "", 15000)
+	tsCache.SetSegmentStats(NewSegmentStats(2*time.Second, 200*time.Millisecond))
+	for i := 0; i < 10; i++ {
+		tsFileName := fmt.Sprintf("test2-%d.ts", i)
+		tsCache.SetItem(tsFileName, TSItem{
+			Name:            tsFileName,
+			SeqNum:          i,
+			Duration:        1900 + i*50,
+			Data:            make([]byte, 1000*(i+1)),
+			KeyFrameAligned: i != 3,
+			GenLatency:      time.Duration(i) * time.Millisecond,
+		})
+	}
+	report := tsCache.SegmentReport()
+	require.Equal(t, 10, report.Count)
+	require.Equal(t, int64(1900), report.Duration.Min)
+	require.Equal(t, int64(2350), report.Duration.Max)
+	require.Equal(t, int64(10000), report.Size.Max)
+	// 2250, 2300, 2350 超出2000±200
+	require.Equal(t, 3, report.Violations)
+	require.Equal(t, 1, report.Unaligned)
+}
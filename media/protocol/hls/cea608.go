@@ -0,0 +1,187 @@
+package hls
+
+import (
+	"strings"
+	"time"
+
+	"github.com/bugVanisher/streamer/media/av"
+)
+
+// CEA-608的字幕模式
+const (
+	cc608PopOn = iota
+	cc608RollUp
+	cc608PaintOn
+)
+
+// cc608Special 0x11 0x30-0x3f特殊字符
+var cc608Special = []rune("®°½¿™¢£♪à èâêîôû")
+
+// cc608Basic 基本字符集中和ASCII不同的字符
+var cc608Basic = map[byte]rune{
+	0x2a: 'á', 0x5c: 'é', 0x5e: 'í', 0x5f: 'ó', 0x60: 'ú',
+	0x7b: 'ç', 0x7c: '÷', 0x7d: 'Ñ', 0x7e: 'ñ', 0x7f: '█',
+}
+
+// CEA608Decoder 把field 1的CEA-608字幕数据解码为cue, 只解码数据通道1(CC1).
+// 支持pop-on、roll-up和paint-on, roll-up按行输出cue, 不模拟屏幕上的滚动; 扩展字符集保留其前面的基本字符
+type CEA608Decoder struct {
+	mode     int
+	channel  int             // 当前数据通道, 由控制码选择
+	lastCtrl [2]byte         // 控制码通常发送两次, 重复的第二个不再处理
+	shown    strings.Builder // 屏幕上显示的文字
+	hidden   strings.Builder // pop-on模式下还没有显示的文字
+	shownAt  time.Duration   // shown开始显示的时间
+	cues     []Cue
+}
+
+// NewCEA608Decoder 创建CC1解码器
+func NewCEA608Decoder() *CEA608Decoder {
+	return &CEA608Decoder{channel: 1}
+}
+
+// Decode 解码t时刻packet中的字幕数据, 返回在此之前结束显示的cue, 返回值在下一次Decode前有效
+func (d *CEA608Decoder) Decode(t time.Duration, cc []av.CaptionData) []Cue {
+	d.cues = d.cues[:0]
+	for _, c := range cc {
+		if c.Type != 0 {
+			continue
+		}
+		// 去掉奇校验位
+		b1, b2 := c.Data1&0x7f, c.Data2&0x7f
+		if b1 == 0 && b2 == 0 {
+			continue
+		}
+		if b1 >= 0x10 && b1 <= 0x1f {
+			if d.lastCtrl == [2]byte{b1, b2} {
+				d.lastCtrl = [2]byte{}
+				continue
+			}
+			d.lastCtrl = [2]byte{b1, b2}
+			d.channel = 1
+			if b1&0x08 != 0 {
+				d.channel = 2
+			}
+			if d.channel == 1 {
+				d.control(t, b1, b2)
+			}
+			continue
+		}
+		d.lastCtrl = [2]byte{}
+		if d.channel != 1 || b1 < 0x20 {
+			continue
+		}
+		d.write(t, cc608Char(b1))
+		if b2 >= 0x20 {
+			d.write(t, cc608Char(b2))
+		}
+	}
+	return d.cues
+}
+
+// Flush 在t时刻结束正在显示的字幕并返回对应的cue, 字幕从t开始继续显示. 用于在切片边界切分跨切片的字幕
+func (d *CEA608Decoder) Flush(t time.Duration) (cue Cue, ok bool) {
+	text := cc608Text(d.shown.String())
+	if text == "" || t <= d.shownAt {
+		return
+	}
+	cue = Cue{Start: d.shownAt, End: t, Text: text}
+	d.shownAt = t
+	return cue, true
+}
+
+func (d *CEA608Decoder) control(t time.Duration, b1, b2 byte) {
+	switch {
+	case (b1 == 0x14 || b1 == 0x15) && b2 >= 0x20 && b2 <= 0x2f:
+		d.command(t, b2)
+	case b1 == 0x11 && b2 >= 0x30 && b2 <= 0x3f:
+		d.write(t, cc608Special[b2-0x30])
+	case b1 == 0x11 && b2 >= 0x20 && b2 <= 0x2f:
+		// mid-row code在屏幕上占一个空格
+		d.write(t, ' ')
+	case b1 <= 0x17 && b2 >= 0x40:
+		// preamble address code, 换到新的一行
+		if buf := d.target(); buf.Len() > 0 && !strings.HasSuffix(buf.String(), "\n") {
+			buf.WriteByte('\n')
+		}
+	}
+}
+
+func (d *CEA608Decoder) command(t time.Duration, cmd byte) {
+	switch cmd {
+	case 0x20: // RCL
+		d.mode = cc608PopOn
+	case 0x21: // BS
+		buf := d.target()
+		if r := []rune(buf.String()); len(r) > 0 {
+			buf.Reset()
+			buf.WriteString(string(r[:len(r)-1]))
+		}
+	case 0x25, 0x26, 0x27: // RU2-RU4
+		if d.mode == cc608PopOn {
+			d.erase(t)
+		}
+		d.mode = cc608RollUp
+	case 0x29: // RDC
+		d.mode = cc608PaintOn
+	case 0x2c: // EDM
+		d.erase(t)
+	case 0x2d: // CR
+		if d.mode == cc608RollUp {
+			d.erase(t)
+		} else {
+			d.target().WriteByte('\n')
+		}
+	case 0x2e: // ENM
+		d.hidden.Reset()
+	case 0x2f: // EOC
+		d.erase(t)
+		d.shown.WriteString(d.hidden.String())
+		d.shownAt = t
+		d.hidden.Reset()
+		d.mode = cc608PopOn
+	}
+}
+
+// target 当前模式下写入的缓冲
+func (d *CEA608Decoder) target() *strings.Builder {
+	if d.mode == cc608PopOn {
+		return &d.hidden
+	}
+	return &d.shown
+}
+
+func (d *CEA608Decoder) write(t time.Duration, r rune) {
+	buf := d.target()
+	if buf == &d.shown && buf.Len() == 0 {
+		d.shownAt = t
+	}
+	buf.WriteRune(r)
+}
+
+// erase 在t时刻清除屏幕, 结束显示的文字成为一条cue
+func (d *CEA608Decoder) erase(t time.Duration) {
+	if text := cc608Text(d.shown.String()); text != "" && t > d.shownAt {
+		d.cues = append(d.cues, Cue{Start: d.shownAt, End: t, Text: text})
+	}
+	d.shown.Reset()
+}
+
+func cc608Char(b byte) rune {
+	if r, ok := cc608Basic[b]; ok {
+		return r
+	}
+	return rune(b)
+}
+
+// cc608Text 去掉每行首尾和空行
+func cc608Text(s string) string {
+	lines := strings.Split(s, "\n")
+	kept := lines[:0]
+	for _, line := range lines {
+		if line = strings.TrimSpace(line); line != "" {
+			kept = append(kept, line)
+		}
+	}
+	return strings.Join(kept, "\n")
+}
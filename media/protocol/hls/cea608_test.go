@@ -0,0 +1,41 @@
+package hls
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bugVanisher/streamer/media/av"
+)
+
+// cc608 把字节对转成field 1的字幕数据, 不带校验位
+func cc608(b ...byte) (cc []av.CaptionData) {
+	for i := 0; i+1 < len(b); i += 2 {
+		cc = append(cc, av.CaptionData{Data1: b[i], Data2: b[i+1]})
+	}
+	return
+}
+
+func TestCEA608Decoder(t *testing.T) {
+	// roll-up: 每个CR结束一行, 退格删除前一个字符, 特殊字符
+	d := NewCEA608Decoder()
+	require.Empty(t, d.Decode(0, cc608(0x14, 0x25, 0x14, 0x25, 'A', 'B', 'X', 0, 0x14, 0x21)))
+	require.Empty(t, d.Decode(time.Second, cc608(0x11, 0x37)))
+	cues := d.Decode(2*time.Second, cc608(0x14, 0x2d, 'C', 'D'))
+	require.Equal(t, []Cue{{Start: 0, End: 2 * time.Second, Text: "AB♪"}}, cues)
+	cues = d.Decode(3*time.Second, cc608(0x14, 0x2c))
+	require.Equal(t, []Cue{{Start: 2 * time.Second, End: 3 * time.Second, Text: "CD"}}, cues)
+
+	// pop-on: PAC换行, 通道2的数据和field 2不解码
+	d = NewCEA608Decoder()
+	require.Empty(t, d.Decode(0, cc608(0x14, 0x20, 'O', 'N', 0x14, 0x70, 'T', 'W', 0x1c, 0x20, 'N', 'O', 0x14, 0x2f)))
+	require.Empty(t, d.Decode(0, []av.CaptionData{{Type: 1, Data1: 'Z', Data2: 'Z'}}))
+	cue, ok := d.Flush(time.Second)
+	require.True(t, ok)
+	require.Equal(t, Cue{Start: 0, End: time.Second, Text: "ON\nTW"}, cue)
+	cues = d.Decode(1500*time.Millisecond, cc608(0x14, 0x2c))
+	require.Equal(t, []Cue{{Start: time.Second, End: 1500 * time.Millisecond, Text: "ON\nTW"}}, cues)
+	_, ok = d.Flush(2 * time.Second)
+	require.False(t, ok)
+}
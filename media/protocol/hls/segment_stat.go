@@ -0,0 +1,125 @@
+package hls
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// SegmentRecord 单个ts切片的统计记录
+type SegmentRecord struct {
+	Name            string
+	SeqNum          int
+	Duration        int // 毫秒
+	Size            int
+	KeyFrameAligned bool          // 切片是否以关键帧开始
+	GenLatency      time.Duration // 从切片第一个包到切片生成完成的耗时
+}
+
+// Distribution 数值分布
+type Distribution struct {
+	Min int64 `json:"min"`
+	Max int64 `json:"max"`
+	Avg int64 `json:"avg"`
+	P50 int64 `json:"p50"`
+	P95 int64 `json:"p95"`
+}
+
+func newDistribution(values []int64) Distribution {
+	var d Distribution
+	if len(values) == 0 {
+		return d
+	}
+	sorted := make([]int64, len(values))
+	copy(sorted, values)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	var sum int64
+	for _, v := range sorted {
+		sum += v
+	}
+	d.Min = sorted[0]
+	d.Max = sorted[len(sorted)-1]
+	d.Avg = sum / int64(len(sorted))
+	d.P50 = sorted[(len(sorted)-1)*50/100]
+	d.P95 = sorted[(len(sorted)-1)*95/100]
+	return d
+}
+
+// SegmentReport 切片统计报告
+type SegmentReport struct {
+	Count      int          `json:"count"`
+	Duration   Distribution `json:"duration"`    // 毫秒
+	Size       Distribution `json:"size"`        // 字节
+	GenLatency Distribution `json:"gen_latency"` // 毫秒
+	Violations int          `json:"violations"`  // 时长超出target±tolerance的切片数
+	Unaligned  int          `json:"unaligned"`   // 不以关键帧开始的切片数
+}
+
+func (r SegmentReport) String() string {
+	return fmt.Sprintf("count:%d duration(ms) min:%d avg:%d p95:%d max:%d size(B) avg:%d max:%d latency(ms) avg:%d p95:%d violations:%d unaligned:%d",
+		r.Count, r.Duration.Min, r.Duration.Avg, r.Duration.P95, r.Duration.Max,
+		r.Size.Avg, r.Size.Max, r.GenLatency.Avg, r.GenLatency.P95, r.Violations, r.Unaligned)
+}
+
+// SegmentStats 统计切片时长、大小、关键帧对齐和生成耗时的分布
+type SegmentStats struct {
+	target    int // 目标时长, 毫秒
+	tolerance int // 允许偏差, 毫秒
+
+	lock    sync.Mutex
+	records []SegmentRecord
+}
+
+// NewSegmentStats 创建切片统计, target为目标时长, tolerance为允许的偏差
+func NewSegmentStats(target, tolerance time.Duration) *SegmentStats {
+	return &SegmentStats{
+		target:    int(target / time.Millisecond),
+		tolerance: int(tolerance / time.Millisecond),
+	}
+}
+
+// Add 记录一个切片
+func (s *SegmentStats) Add(record SegmentRecord) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.records = append(s.records, record)
+}
+
+// IsViolation 切片时长是否超出target±tolerance, target为0时不检查
+func (s *SegmentStats) IsViolation(record SegmentRecord) bool {
+	if s.target == 0 {
+		return false
+	}
+	diff := record.Duration - s.target
+	if diff < 0 {
+		diff = -diff
+	}
+	return diff > s.tolerance
+}
+
+// Report 生成当前的统计报告
+func (s *SegmentStats) Report() SegmentReport {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	report := SegmentReport{Count: len(s.records)}
+	durations := make([]int64, 0, len(s.records))
+	sizes := make([]int64, 0, len(s.records))
+	latencies := make([]int64, 0, len(s.records))
+	for _, r := range s.records {
+		durations = append(durations, int64(r.Duration))
+		sizes = append(sizes, int64(r.Size))
+		latencies = append(latencies, int64(r.GenLatency/time.Millisecond))
+		if s.IsViolation(r) {
+			report.Violations++
+		}
+		if !r.KeyFrameAligned {
+			report.Unaligned++
+		}
+	}
+	report.Duration = newDistribution(durations)
+	report.Size = newDistribution(sizes)
+	report.GenLatency = newDistribution(latencies)
+	return report
+}
@@ -0,0 +1,103 @@
+package hls
+
+import (
+	"time"
+
+	"github.com/bugVanisher/streamer/media/av"
+)
+
+// gopOutlierAccept 连续观测到这么多个超过估计值10倍的GOP时, 认为推流源的GOP发生了变化, 改用新的GOP长度
+const gopOutlierAccept = 3
+
+// SegmentTargeter 根据观测到的GOP长度在关键帧处选择切片点, 使切片时长与目标时长的误差最小
+type SegmentTargeter struct {
+	target   time.Duration
+	gop      time.Duration
+	outliers int // 连续超过估计值10倍的GOP个数
+
+	segStart     av.MediaTime
+	lastKeyFrame av.MediaTime
+	started      bool
+
+	// GOPHint 建议的GOP发生变化时回调, 可用于通知推流源调整关键帧间隔
+	GOPHint   func(gop time.Duration)
+	suggested time.Duration
+}
+
+// NewSegmentTargeter 创建切片点选择器, target为目标切片时长
+func NewSegmentTargeter(target time.Duration) *SegmentTargeter {
+	return &SegmentTargeter{target: target}
+}
+
+// OnKeyFrame 每个关键帧调用一次, ts为关键帧的pkt.Time, 返回true表示应在该关键帧处开始新切片
+func (t *SegmentTargeter) OnKeyFrame(ts av.MediaTime) (cut bool) {
+	if !t.started {
+		t.started = true
+		t.segStart = ts
+		t.lastKeyFrame = ts
+		return false
+	}
+	t.observeGOP((ts - t.lastKeyFrame).Duration())
+	t.lastKeyFrame = ts
+
+	elapsed := (ts - t.segStart).Duration()
+	if elapsed <= 0 {
+		return false
+	}
+	if t.gop == 0 {
+		cut = elapsed >= t.target
+	} else {
+		// 在当前关键帧切片的误差不大于等到下一个关键帧再切的误差
+		cut = absDuration(elapsed-t.target) <= absDuration(elapsed+t.gop-t.target)
+	}
+	if cut {
+		t.segStart = ts
+	}
+	return
+}
+
+// observeGOP 平滑更新GOP长度, 时间戳回退时忽略. 跳变过大时先忽略, 连续gopOutlierAccept次后直接采用新的长度
+func (t *SegmentTargeter) observeGOP(gop time.Duration) {
+	if gop <= 0 {
+		return
+	}
+	if t.gop > 0 && gop > 10*t.gop {
+		if t.outliers++; t.outliers < gopOutlierAccept {
+			return
+		}
+		t.gop = 0
+	}
+	t.outliers = 0
+	if t.gop == 0 {
+		t.gop = gop
+	} else {
+		t.gop = (t.gop*7 + gop) / 8
+	}
+
+	suggested := t.SuggestedGOP()
+	if t.GOPHint != nil && suggested != t.suggested {
+		t.GOPHint(suggested)
+	}
+	t.suggested = suggested
+}
+
+// GOP 当前观测到的GOP长度
+func (t *SegmentTargeter) GOP() time.Duration {
+	return t.gop
+}
+
+// SuggestedGOP 能整除目标时长且最接近当前GOP的关键帧间隔
+func (t *SegmentTargeter) SuggestedGOP() time.Duration {
+	if t.gop == 0 || t.gop >= t.target {
+		return t.target
+	}
+	n := (t.target + t.gop/2) / t.gop
+	return t.target / n
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
@@ -0,0 +1,56 @@
+package hls
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bugVanisher/streamer/media/av"
+)
+
+func TestSegmentTargeterGOPStep(t *testing.T) {
+	st := NewSegmentTargeter(4 * time.Second)
+	var hints []time.Duration
+	st.GOPHint = func(gop time.Duration) {
+		hints = append(hints, gop)
+	}
+	var ts av.MediaTime
+	keyFrame := func(gop time.Duration) bool {
+		ts += av.MediaTimeFromDuration(gop)
+		return st.OnKeyFrame(ts)
+	}
+
+	st.OnKeyFrame(ts)
+	for i := 0; i < 10; i++ {
+		keyFrame(200 * time.Millisecond)
+	}
+	require.Equal(t, 200*time.Millisecond, st.GOP())
+
+	// 单个超过10倍的GOP当作时间戳跳变忽略
+	keyFrame(3 * time.Second)
+	require.Equal(t, 200*time.Millisecond, st.GOP())
+	keyFrame(200 * time.Millisecond)
+	require.Equal(t, 200*time.Millisecond, st.GOP())
+
+	// 推流源把GOP改为4秒, 前两个仍被忽略, 连续第三个起采用新的长度
+	keyFrame(4 * time.Second)
+	keyFrame(4 * time.Second)
+	require.Equal(t, 200*time.Millisecond, st.GOP())
+	keyFrame(4 * time.Second)
+	require.Equal(t, 4*time.Second, st.GOP())
+	require.Equal(t, 4*time.Second, st.SuggestedGOP())
+	require.Equal(t, []time.Duration{200 * time.Millisecond, 4 * time.Second}, hints)
+
+	// 之后每个关键帧都切片
+	for i := 0; i < 3; i++ {
+		require.True(t, keyFrame(4*time.Second))
+		require.Equal(t, 4*time.Second, st.GOP())
+	}
+
+	// GOP变短时平滑收敛
+	for i := 0; i < 50; i++ {
+		keyFrame(time.Second)
+	}
+	require.InDelta(t, float64(time.Second), float64(st.GOP()), float64(10*time.Millisecond))
+}
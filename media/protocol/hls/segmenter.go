@@ -0,0 +1,169 @@
+package hls
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	"github.com/bugVanisher/streamer/media/av"
+	"github.com/bugVanisher/streamer/media/container/ts"
+	"github.com/bugVanisher/streamer/statistics"
+)
+
+// Segmenter 把packet切成ts切片写入TSCache, 有视频时由SegmentTargeter在关键帧处选择切片点,
+// 只有音频时切片时长达到目标时长后在下一个packet处切片
+type Segmenter struct {
+	cache    *TSCache
+	targeter *SegmentTargeter
+	prefix   string
+
+	muxer    *ts.Muxer
+	buf      bytes.Buffer
+	hasVideo bool
+	seq      int
+	open     bool         // 当前切片已经写入了packet
+	segStart av.MediaTime // 当前切片第一个packet的时间
+	lastEnd  av.MediaTime // 已写入packet的最大结束时间
+	aligned  bool         // 当前切片的第一个视频帧是关键帧, 只有音频时总是true
+	sawVideo bool         // 当前切片已经写入了视频帧
+	genStart time.Time    // 当前切片第一个packet写入的时间
+	media    int          // 当前切片中packet的负载字节数
+
+	// overhead 切出的ts切片相对packet负载的封装开销
+	overhead *statistics.Overhead
+
+	captions *SubtitleTrack
+	cc       *CEA608Decoder
+
+	now func() time.Time
+}
+
+// NewSegmenter 创建切片器, 切片名为prefix-序号.ts, target为目标切片时长
+func NewSegmenter(cache *TSCache, prefix string, target time.Duration) *Segmenter {
+	s := &Segmenter{
+		cache:    cache,
+		targeter: NewSegmentTargeter(target),
+		prefix:   prefix,
+		now:      time.Now,
+		overhead: statistics.NewOverhead("ts"),
+	}
+	s.muxer = ts.NewMuxer(&s.buf)
+	return s
+}
+
+// Targeter 切片点选择器, 可以在写入packet之前设置GOPHint
+func (s *Segmenter) Targeter() *SegmentTargeter {
+	return s.targeter
+}
+
+// AddCaptionTrack 把packet中的CEA-608 CC1字幕解码到track, 并把track加入TSCache.
+// packet需要由开启了ParseSEI的demuxer读出
+func (s *Segmenter) AddCaptionTrack(track *SubtitleTrack) {
+	s.cache.AddSubtitleTrack(track)
+	s.captions = track
+	s.cc = NewCEA608Decoder()
+}
+
+// Overhead 切片的TS封装开销统计, 包括PAT/PMT、TS/PES头和适配域填充, 每切出一个切片更新一次.
+// 可以在写入packet的同时调用
+func (s *Segmenter) Overhead() *statistics.Overhead {
+	return s.overhead
+}
+
+// Report 切片统计报告, TSCache没有设置SegmentStats时为空. 可以在写入packet的同时调用
+func (s *Segmenter) Report() SegmentReport {
+	return s.cache.SegmentReport()
+}
+
+// WriteHeader header变化时在当前切片中写入新的PAT/PMT
+func (s *Segmenter) WriteHeader(streams []av.CodecData) (err error) {
+	s.hasVideo = false
+	for _, stream := range streams {
+		if stream.Type().IsVideo() {
+			s.hasVideo = true
+		}
+	}
+	return s.muxer.WriteHeader(streams)
+}
+
+// WritePacket 写入音视频packet, sequence header和onMetaData不写入ts
+func (s *Segmenter) WritePacket(pkt av.Packet) (err error) {
+	if (!pkt.IsVideo() && !pkt.IsAudio()) || pkt.IsSequenceHeader() {
+		return
+	}
+	if s.cc != nil && len(pkt.Captions) > 0 {
+		for _, cue := range s.cc.Decode(pkt.Time.Duration(), pkt.Captions) {
+			s.captions.AddCue(cue)
+		}
+	}
+	var cut bool
+	if pkt.IsVideoKeyFrame() {
+		cut = s.targeter.OnKeyFrame(pkt.Time)
+	} else if !s.hasVideo && s.open {
+		cut = (pkt.Time - s.segStart).Duration() >= s.targeter.target
+	}
+	if cut && s.open {
+		if err = s.cut(pkt.Time); err != nil {
+			return
+		}
+	}
+	if !s.open {
+		s.buf.Reset()
+		if err = s.muxer.WritePATPMT(); err != nil {
+			return
+		}
+		s.open = true
+		s.segStart = pkt.Time
+		s.aligned, s.sawVideo = true, false
+		s.genStart = s.now()
+		s.media = 0
+	}
+	if pkt.IsVideo() && !s.sawVideo {
+		s.sawVideo = true
+		s.aligned = pkt.IsKeyFrame
+	}
+	if err = s.muxer.WritePacket(pkt); err != nil {
+		return
+	}
+	s.media += len(pkt.Data)
+	if end := pkt.Time + av.MediaTimeFromDuration(pkt.Duration); end > s.lastEnd {
+		s.lastEnd = end
+	}
+	return
+}
+
+// WriteTrailer 切出最后一个不完整的切片
+func (s *Segmenter) WriteTrailer() (err error) {
+	if !s.open {
+		return
+	}
+	if err = s.muxer.WriteTrailer(); err != nil {
+		return
+	}
+	return s.cut(s.lastEnd)
+}
+
+// cut 以end为结束时间切出当前切片, 正在显示的字幕在end处切分
+func (s *Segmenter) cut(end av.MediaTime) error {
+	if s.cc != nil {
+		if cue, ok := s.cc.Flush(end.Duration()); ok {
+			s.captions.AddCue(cue)
+		}
+	}
+	duration := (end - s.segStart).Duration()
+	if duration < 0 {
+		return fmt.Errorf("hls: segment %d ends before it starts", s.seq)
+	}
+	name := fmt.Sprintf("%s-%d.ts", s.prefix, s.seq)
+	item := NewTSItem(name, int(duration/time.Millisecond), s.seq, s.buf.Bytes())
+	item.Start = s.segStart.Duration()
+	item.KeyFrameAligned = s.aligned
+	item.GenLatency = s.now().Sub(s.genStart)
+	item.MediaBytes = s.media
+	s.overhead.AddWire(uint64(len(item.Data)))
+	s.overhead.AddMedia(uint64(s.media))
+	s.cache.SetItem(name, item)
+	s.seq++
+	s.open = false
+	return nil
+}
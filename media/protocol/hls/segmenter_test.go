@@ -0,0 +1,165 @@
+package hls
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bugVanisher/streamer/media/av"
+	"github.com/bugVanisher/streamer/media/codec/h264parser"
+)
+
+func testH264(t *testing.T) av.CodecData {
+	sps := []byte{0x67, 0x64, 0x00, 0x1e, 0xac, 0xd9, 0x40, 0xa0, 0x2f, 0xf9, 0x70, 0x11, 0x00, 0x00, 0x03,
+		0x00, 0x01, 0x00, 0x00, 0x03, 0x00, 0x32, 0x0f, 0x16, 0x2d, 0x96}
+	h264, err := h264parser.NewCodecDataFromSPSAndPPS(sps, []byte{0x68, 0xeb, 0xe3, 0xcb, 0x22, 0xc0})
+	require.Nil(t, err)
+	return h264
+}
+
+// writeGOPs 按25fps写入frames帧, 每gop帧一个关键帧
+func writeGOPs(t *testing.T, s *Segmenter, frames, gop int) {
+	for i := 0; i < frames; i++ {
+		pkt := av.Packet{
+			IsKeyFrame:    i%gop == 0,
+			DataType:      int8(av.FLV_TAG_VIDEO),
+			AVCPacketType: av.AVC_NALU,
+			Time:          av.MediaTimeFromMs(int32(i * 40)),
+			Duration:      40 * time.Millisecond,
+			Data:          []byte{0, 0, 0, 2, 0x65, byte(i)},
+		}
+		if !pkt.IsKeyFrame {
+			pkt.Data[4] = 0x41
+		}
+		require.Nil(t, s.WritePacket(pkt))
+	}
+	require.Nil(t, s.WriteTrailer())
+}
+
+func segmentDurations(t *testing.T, c *TSCache, prefix string, n int) (durations []int) {
+	for i := 0; i < n; i++ {
+		item, err := c.GetItem(fmt.Sprintf("%s-%d.ts", prefix, i))
+		require.Nil(t, err)
+		require.Equal(t, i, item.SeqNum)
+		durations = append(durations, item.Duration)
+	}
+	_, err := c.GetItem(fmt.Sprintf("%s-%d.ts", prefix, n))
+	require.Equal(t, ErrNoTsKey, err)
+	return
+}
+
+func TestSegmenter(t *testing.T) {
+	// 1s的GOP能整除2s的目标时长, 每两个GOP切一次
+	c := NewTSCache("test", "", 60000)
+	s := NewSegmenter(c, "test", 2*time.Second)
+	require.Nil(t, s.WriteHeader([]av.CodecData{testH264(t)}))
+	writeGOPs(t, s, 250, 25)
+	require.Equal(t, []int{2000, 2000, 2000, 2000, 2000}, segmentDurations(t, c, "test", 5))
+	item, err := c.GetItem("test-1.ts")
+	require.Nil(t, err)
+	require.Equal(t, 2*time.Second, item.Start)
+	// 每个切片以PAT开始
+	require.Equal(t, []byte{0x47, 0x40, 0x00}, item.Data[:3])
+	// 每帧6字节负载, 每个切片50帧, 其余都是TS封装和填充
+	require.Equal(t, 300, item.MediaBytes)
+	require.Equal(t, uint64(1500), s.Overhead().MediaBytes())
+	require.Equal(t, uint64(5*len(item.Data)), s.Overhead().WireBytes())
+	require.InDelta(t, float64(len(item.Data)-300)*100/float64(len(item.Data)), s.Overhead().GetOverhead(), 0.01)
+
+	// 1.5s的GOP切4s的目标时长, 在4.5s处切片比在3s或6s处误差更小, 并建议1.333s的GOP
+	var hints []time.Duration
+	c = NewTSCache("gop", "", 60000)
+	s = NewSegmenter(c, "gop", 4*time.Second)
+	s.Targeter().GOPHint = func(gop time.Duration) { hints = append(hints, gop) }
+	require.Nil(t, s.WriteHeader([]av.CodecData{testH264(t)}))
+	writeGOPs(t, s, 375, 38)
+	durations := segmentDurations(t, c, "gop", 4)
+	require.Equal(t, []int{4560, 4560, 4560}, durations[:3])
+	require.Equal(t, []time.Duration{4 * time.Second / 3}, hints)
+}
+
+func TestSegmenterStats(t *testing.T) {
+	c := NewTSCache("test", "", 60000)
+	c.SetSegmentStats(NewSegmentStats(2*time.Second, 100*time.Millisecond))
+	s := NewSegmenter(c, "test", 2*time.Second)
+	// 每写入一个packet时钟走10ms
+	now := time.Unix(0, 0)
+	s.now = func() time.Time { return now }
+	require.Nil(t, s.WriteHeader([]av.CodecData{testH264(t)}))
+	// 从GOP中间开始拉流, 第一个切片不以关键帧开始
+	for i := 10; i < 250; i++ {
+		data := []byte{0, 0, 0, 2, 0x41, byte(i)}
+		if i%25 == 0 {
+			data[4] = 0x65
+		}
+		require.Nil(t, s.WritePacket(av.Packet{IsKeyFrame: i%25 == 0, DataType: int8(av.FLV_TAG_VIDEO), AVCPacketType: av.AVC_NALU,
+			Time: av.MediaTimeFromMs(int32(i * 40)), Duration: 40 * time.Millisecond, Data: data}))
+		now = now.Add(10 * time.Millisecond)
+	}
+	require.Nil(t, s.WriteTrailer())
+
+	first, err := c.GetItem("test-0.ts")
+	require.Nil(t, err)
+	require.False(t, first.KeyFrameAligned)
+	second, err := c.GetItem("test-1.ts")
+	require.Nil(t, err)
+	require.True(t, second.KeyFrameAligned)
+	// 从切片的第一个packet到下一个切片的第一个关键帧到来, 经过50个packet
+	require.Equal(t, 500*time.Millisecond, second.GenLatency)
+
+	report := s.Report()
+	require.Equal(t, 5, report.Count)
+	require.Equal(t, 1, report.Unaligned)
+	require.Equal(t, int64(500), report.GenLatency.P95)
+}
+
+// captionFrame 带有GA94字幕SEI的AVCC帧, cc为带奇校验位的CEA-608 field 1字节对
+func captionFrame(nalu byte, cc ...byte) []byte {
+	payload := []byte{0xb5, 0x00, 0x31, 'G', 'A', '9', '4', 0x03, 0x40 | byte(len(cc)/2), 0xff}
+	for i := 0; i+1 < len(cc); i += 2 {
+		payload = append(payload, 0xfc, cc[i], cc[i+1])
+	}
+	payload = append(payload, 0xff)
+	sei := h264parser.MarshalSEINALU(h264parser.SEI_USER_DATA_REGISTERED_ITU_T_35, payload)
+	frame := append([]byte{0, 0, 0, byte(len(sei))}, sei...)
+	return append(frame, 0, 0, 0, 2, nalu, 0x88)
+}
+
+func TestSegmenterCaptions(t *testing.T) {
+	c := NewTSCache("test", "", 60000)
+	s := NewSegmenter(c, "test", 2*time.Second)
+	track := NewSubtitleTrack("CC1", "en")
+	s.AddCaptionTrack(track)
+	require.Nil(t, s.WriteHeader([]av.CodecData{testH264(t)}))
+	for i := 0; i < 100; i++ {
+		nalu := byte(0x41)
+		if i%25 == 0 {
+			nalu = 0x65
+		}
+		data := []byte{0, 0, 0, 2, nalu, byte(i)}
+		switch i {
+		case 10:
+			// pop-on: RCL RCL "HI" EOC EOC, 0.4s开始显示
+			data = captionFrame(nalu, 0x94, 0x20, 0x94, 0x20, 0xc8, 0x49, 0x94, 0x2f, 0x94, 0x2f)
+		case 60:
+			// EDM EDM, 2.4s清除
+			data = captionFrame(nalu, 0x94, 0x2c, 0x94, 0x2c)
+		}
+		pkt := av.Packet{IsKeyFrame: i%25 == 0, DataType: int8(av.FLV_TAG_VIDEO), AVCPacketType: av.AVC_NALU,
+			Time: av.MediaTimeFromMs(int32(i * 40)), Duration: 40 * time.Millisecond, Data: data}
+		pkt.SEI, pkt.Captions = h264parser.ParseSEIFromNALUs(pkt.Data)
+		require.Nil(t, s.WritePacket(pkt))
+	}
+	require.Nil(t, s.WriteTrailer())
+
+	// 跨切片的字幕在切片边界处切分
+	vtt, err := c.GetSubtitleItem("CC1-0.vtt")
+	require.Nil(t, err)
+	require.Contains(t, string(vtt), "\n00:00:00.400 --> 00:00:02.000\nHI\n")
+	vtt, err = c.GetSubtitleItem("CC1-1.vtt")
+	require.Nil(t, err)
+	require.Contains(t, string(vtt), "\n00:00:02.000 --> 00:00:02.400\nHI\n")
+	require.NotContains(t, string(vtt), "00:00:00.400")
+}
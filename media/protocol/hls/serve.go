@@ -0,0 +1,163 @@
+package hls
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// playListETag m3u8内容的强ETag
+func playListETag(body []byte) string {
+	h := fnv.New64a()
+	h.Write(body)
+	return fmt.Sprintf(`"%x"`, h.Sum64())
+}
+
+// acceptEncoding 按Accept-Encoding选择gzip或deflate, 都不接受时返回空
+func acceptEncoding(header string) string {
+	accepted := map[string]bool{}
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		coding := strings.ToLower(strings.TrimSpace(fields[0]))
+		ok := true
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if q, err := strconv.ParseFloat(param[2:], 64); err == nil && q == 0 {
+					ok = false
+				}
+			}
+		}
+		accepted[coding] = ok
+	}
+	for _, coding := range []string{"gzip", "deflate"} {
+		if accepted[coding] {
+			return coding
+		}
+	}
+	return ""
+}
+
+// etagMatch If-None-Match是否包含etag, 比较时忽略弱标记和压缩编码的后缀
+func etagMatch(ifNoneMatch, etag string) bool {
+	base := func(tag string) string {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		tag = strings.Trim(tag, `"`)
+		if i := strings.LastIndexByte(tag, '-'); i >= 0 {
+			tag = tag[:i]
+		}
+		return tag
+	}
+	for _, tag := range strings.Split(ifNoneMatch, ",") {
+		if strings.TrimSpace(tag) == "*" || base(tag) == base(etag) {
+			return true
+		}
+	}
+	return false
+}
+
+// notModified 条件请求是否可以回复304, If-None-Match优先于If-Modified-Since
+func notModified(r *http.Request, etag string, modTime time.Time) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		return etag != "" && etagMatch(inm, etag)
+	}
+	if ims := r.Header.Get("If-Modified-Since"); ims != "" && !modTime.IsZero() {
+		t, err := http.ParseTime(ims)
+		return err == nil && !modTime.Truncate(time.Second).After(t)
+	}
+	return false
+}
+
+// ServePlayList 回复m3u8, 支持ETag/Last-Modified条件请求和gzip/deflate压缩, 模拟CDN的行为
+func ServePlayList(w http.ResponseWriter, r *http.Request, body []byte, etag string, modTime time.Time) {
+	h := w.Header()
+	h.Set("Content-Type", "application/vnd.apple.mpegurl")
+	h.Set("Cache-Control", "no-cache")
+	h.Add("Vary", "Accept-Encoding")
+	if !modTime.IsZero() {
+		h.Set("Last-Modified", modTime.UTC().Format(http.TimeFormat))
+	}
+	coding := acceptEncoding(r.Header.Get("Accept-Encoding"))
+	if etag != "" {
+		if coding != "" {
+			// 不同编码的表示使用不同的ETag
+			h.Set("ETag", strings.TrimSuffix(etag, `"`)+"-"+coding+`"`)
+		} else {
+			h.Set("ETag", etag)
+		}
+	}
+	if notModified(r, etag, modTime) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	if coding != "" {
+		buf := &bytes.Buffer{}
+		var zw interface {
+			Write([]byte) (int, error)
+			Close() error
+		}
+		if coding == "gzip" {
+			zw = gzip.NewWriter(buf)
+		} else {
+			zw, _ = flate.NewWriter(buf, flate.DefaultCompression)
+		}
+		zw.Write(body)
+		zw.Close()
+		body = buf.Bytes()
+		h.Set("Content-Encoding", coding)
+	}
+	h.Set("Content-Length", strconv.Itoa(len(body)))
+	if r.Method != http.MethodHead {
+		w.Write(body)
+	}
+}
+
+// countWriter 统计写出的响应体字节数
+type countWriter struct {
+	http.ResponseWriter
+	n int
+}
+
+func (w *countWriter) Write(p []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(p)
+	w.n += n
+	return n, err
+}
+
+// ServeHTTP 实现http.Handler, 以.m3u8结尾的请求回复播放列表, 其它按文件名回复缓存中的ts切片.
+// 响应体字节数计入Overhead
+func (c *TSCache) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	w := &countWriter{ResponseWriter: rw}
+	defer func() {
+		c.overhead.AddWire(uint64(w.n))
+	}()
+	name := path.Base(r.URL.Path)
+	if strings.HasSuffix(name, ".m3u8") {
+		body, etag, modTime, err := c.GetM3U8PlayListVersion()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		ServePlayList(w, r, body, etag, modTime)
+		return
+	}
+	item, err := c.GetItem(name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "video/mp2t")
+	w.Header().Set("Content-Length", strconv.Itoa(len(item.Data)))
+	if r.Method != http.MethodHead {
+		w.Write(item.Data)
+		c.overhead.AddMedia(uint64(item.MediaBytes))
+	}
+}
@@ -0,0 +1,130 @@
+package hls
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newServeCache(n int) *TSCache {
+	c := NewTSCache("serve", "./", 15000)
+	for i := 0; i < n; i++ {
+		name := fmt.Sprintf("serve-%d.ts", i)
+		c.SetItem(name, TSItem{Name: name, SeqNum: i, Duration: 2000, Data: []byte(name)})
+	}
+	return c
+}
+
+func TestTSCache_ServePlayList(t *testing.T) {
+	c := newServeCache(4)
+	body, etag, modTime, err := c.GetM3U8PlayListVersion()
+	require.NoError(t, err)
+	require.NotEmpty(t, etag)
+	require.False(t, modTime.IsZero())
+
+	rec := httptest.NewRecorder()
+	c.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/live/serve.m3u8", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "application/vnd.apple.mpegurl", rec.Header().Get("Content-Type"))
+	require.Equal(t, etag, rec.Header().Get("ETag"))
+	require.Equal(t, body, rec.Body.Bytes())
+
+	// gzip
+	req := httptest.NewRequest(http.MethodGet, "/live/serve.m3u8", nil)
+	req.Header.Set("Accept-Encoding", "deflate;q=0.5, gzip")
+	rec = httptest.NewRecorder()
+	c.ServeHTTP(rec, req)
+	require.Equal(t, "gzip", rec.Header().Get("Content-Encoding"))
+	zr, err := gzip.NewReader(rec.Body)
+	require.NoError(t, err)
+	plain, err := ioutil.ReadAll(zr)
+	require.NoError(t, err)
+	require.Equal(t, body, plain)
+	gzipETag := rec.Header().Get("ETag")
+	require.NotEqual(t, etag, gzipETag)
+
+	// deflate, gzip被q=0排除
+	req = httptest.NewRequest(http.MethodGet, "/live/serve.m3u8", nil)
+	req.Header.Set("Accept-Encoding", "gzip;q=0, deflate")
+	rec = httptest.NewRecorder()
+	c.ServeHTTP(rec, req)
+	require.Equal(t, "deflate", rec.Header().Get("Content-Encoding"))
+	plain, err = ioutil.ReadAll(flate.NewReader(rec.Body))
+	require.NoError(t, err)
+	require.Equal(t, body, plain)
+
+	// If-None-Match, 压缩表示的ETag同样命中
+	for _, inm := range []string{etag, gzipETag, "W/" + etag, `"other", ` + etag} {
+		req = httptest.NewRequest(http.MethodGet, "/live/serve.m3u8", nil)
+		req.Header.Set("If-None-Match", inm)
+		rec = httptest.NewRecorder()
+		c.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusNotModified, rec.Code, inm)
+		require.Equal(t, 0, rec.Body.Len())
+	}
+
+	// If-Modified-Since
+	req = httptest.NewRequest(http.MethodGet, "/live/serve.m3u8", nil)
+	req.Header.Set("If-Modified-Since", rec.Header().Get("Last-Modified"))
+	rec = httptest.NewRecorder()
+	c.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusNotModified, rec.Code)
+
+	// 新切片后ETag变化, 旧ETag不再命中
+	c.SetItem("serve-4.ts", TSItem{Name: "serve-4.ts", SeqNum: 4, Duration: 2000, Data: []byte("x")})
+	req = httptest.NewRequest(http.MethodGet, "/live/serve.m3u8", nil)
+	req.Header.Set("If-None-Match", etag)
+	rec = httptest.NewRecorder()
+	c.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.NotEqual(t, etag, rec.Header().Get("ETag"))
+}
+
+func TestTSCache_ServeOverhead(t *testing.T) {
+	c := NewTSCache("serve", "./", 15000)
+	c.SetItem("serve-0.ts", TSItem{Name: "serve-0.ts", Duration: 2000, Data: bytes.Repeat([]byte{0x47}, 1880), MediaBytes: 1500})
+	rec := httptest.NewRecorder()
+	c.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/live/serve.m3u8", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	playlist := rec.Body.Len()
+	rec = httptest.NewRecorder()
+	c.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/live/serve-0.ts", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	// 播放列表全部计为开销
+	o := c.Overhead()
+	require.Equal(t, "hls", o.Proto)
+	require.Equal(t, uint64(playlist+1880), o.WireBytes())
+	require.Equal(t, uint64(1500), o.MediaBytes())
+	require.InDelta(t, float64(playlist+380)*100/float64(playlist+1880), o.GetOverhead(), 0.01)
+
+	// HEAD不回复响应体
+	rec = httptest.NewRecorder()
+	c.ServeHTTP(rec, httptest.NewRequest(http.MethodHead, "/live/serve-0.ts", nil))
+	require.Equal(t, uint64(playlist+1880), o.WireBytes())
+	require.Equal(t, uint64(1500), o.MediaBytes())
+}
+
+func TestTSCache_ServeSegment(t *testing.T) {
+	c := newServeCache(4)
+	rec := httptest.NewRecorder()
+	c.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/live/serve-3.ts", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "video/mp2t", rec.Header().Get("Content-Type"))
+	require.True(t, bytes.Equal([]byte("serve-3.ts"), rec.Body.Bytes()))
+
+	rec = httptest.NewRecorder()
+	c.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/live/missing.ts", nil))
+	require.Equal(t, http.StatusNotFound, rec.Code)
+
+	rec = httptest.NewRecorder()
+	NewTSCache("empty", "./", 15000).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/live/empty.m3u8", nil))
+	require.Equal(t, http.StatusNotFound, rec.Code)
+}
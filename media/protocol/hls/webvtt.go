@@ -0,0 +1,170 @@
+package hls
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SubtitleGroupID master playlist中字幕rendition的GROUP-ID
+const SubtitleGroupID = "subs"
+
+// vttTimestampMap ts muxer的时间戳比packet时间晚1秒, 字幕中的时间为packet时间
+const vttTimestampMap = "X-TIMESTAMP-MAP=MPEGTS:90000,LOCAL:00:00:00.000"
+
+// Cue 一条字幕, Start/End为流的packet时间
+type Cue struct {
+	Start time.Duration
+	End   time.Duration
+	Text  string
+}
+
+type vttSegment struct {
+	name     string
+	seq      int
+	duration time.Duration
+	data     []byte
+}
+
+// SubtitleTrack 一路WebVTT字幕, 作为TYPE=SUBTITLES的rendition. 切片和ts切片一一对应, 由TSCache在SetItem时切出
+type SubtitleTrack struct {
+	Name     string // rendition名, 也是playlist和切片文件名的前缀, 如CC1
+	Language string
+	Default  bool
+
+	lock    sync.Mutex
+	cues    []Cue // 还没有结束在已切出切片中的cue
+	segs    []vttSegment
+	next    time.Duration // 下一个切片的起点
+	started bool
+}
+
+// NewSubtitleTrack 创建字幕轨道, language为RFC 5646语言标签, 可以为空
+func NewSubtitleTrack(name, language string) *SubtitleTrack {
+	return &SubtitleTrack{Name: name, Language: language}
+}
+
+// AddCue 添加一条字幕, 应在覆盖其时间范围的ts切片SetItem之前添加
+func (t *SubtitleTrack) AddCue(cue Cue) {
+	if cue.End <= cue.Start || strings.TrimSpace(cue.Text) == "" {
+		return
+	}
+	t.lock.Lock()
+	t.cues = append(t.cues, cue)
+	t.lock.Unlock()
+}
+
+// PlayListName 字幕媒体playlist的文件名
+func (t *SubtitleTrack) PlayListName() string {
+	return t.Name + ".m3u8"
+}
+
+// cut 切出与ts切片seq对应的字幕切片, 跨切片的cue在每个切片中重复出现
+func (t *SubtitleTrack) cut(seq int, start, duration time.Duration) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if !t.started {
+		t.next, t.started = start, true
+	}
+	start = t.next
+	end := start + duration
+	t.next = end
+
+	w := bytes.NewBuffer(nil)
+	fmt.Fprintf(w, "WEBVTT\n%s\n", vttTimestampMap)
+	kept := t.cues[:0]
+	for _, cue := range t.cues {
+		if cue.Start < end && cue.End > start {
+			fmt.Fprintf(w, "\n%s --> %s\n%s\n", vttTime(cue.Start), vttTime(cue.End), cue.Text)
+		}
+		if cue.End > end {
+			kept = append(kept, cue)
+		}
+	}
+	t.cues = kept
+	t.segs = append(t.segs, vttSegment{
+		name:     fmt.Sprintf("%s-%d.vtt", t.Name, seq),
+		seq:      seq,
+		duration: duration,
+		data:     w.Bytes(),
+	})
+}
+
+// evict 淘汰seq之前的切片
+func (t *SubtitleTrack) evict(seq int) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	i := 0
+	for i < len(t.segs) && t.segs[i].seq < seq {
+		i++
+	}
+	t.segs = append(t.segs[:0], t.segs[i:]...)
+}
+
+// playList 从seq开始的字幕媒体playlist, 和ts的playlist包含相同的切片序号
+func (t *SubtitleTrack) playList(seq int) []byte {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	w := bytes.NewBuffer(nil)
+	var maxDuration time.Duration
+	first := -1
+	for _, seg := range t.segs {
+		if seg.seq < seq {
+			continue
+		}
+		if first < 0 {
+			first = seg.seq
+		}
+		if seg.duration > maxDuration {
+			maxDuration = seg.duration
+		}
+		fmt.Fprintf(w, "#EXTINF:%.3f,\n%s\n", seg.duration.Seconds(), seg.name)
+	}
+	if first < 0 {
+		return nil
+	}
+	body := bytes.NewBuffer(nil)
+	fmt.Fprintf(body, "#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-ALLOW-CACHE:NO\n#EXT-X-TARGETDURATION:%d\n#EXT-X-MEDIA-SEQUENCE:%d\n\n",
+		int(maxDuration/time.Second)+1, first)
+	body.Write(w.Bytes())
+	return body.Bytes()
+}
+
+func (t *SubtitleTrack) segment(name string) ([]byte, bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	for _, seg := range t.segs {
+		if seg.name == name {
+			return seg.data, true
+		}
+	}
+	return nil, false
+}
+
+// vttTime WebVTT的时间格式hh:mm:ss.ttt
+func vttTime(d time.Duration) string {
+	if d < 0 {
+		d = 0
+	}
+	ms := d.Milliseconds()
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
+
+// subtitleMedia 字幕rendition的EXT-X-MEDIA行
+func subtitleMedia(tracks []*SubtitleTrack) string {
+	w := &strings.Builder{}
+	for _, t := range tracks {
+		fmt.Fprintf(w, "#EXT-X-MEDIA:TYPE=SUBTITLES,GROUP-ID=\"%s\",NAME=\"%s\"", SubtitleGroupID, t.Name)
+		if t.Language != "" {
+			fmt.Fprintf(w, ",LANGUAGE=\"%s\"", t.Language)
+		}
+		def := "NO"
+		if t.Default {
+			def = "YES"
+		}
+		fmt.Fprintf(w, ",DEFAULT=%s,AUTOSELECT=YES,URI=\"%s\"\n", def, t.PlayListName())
+	}
+	return w.String()
+}
@@ -0,0 +1,61 @@
+package hls
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubtitleTrack(t *testing.T) {
+	c := NewTSCache("test1", "", 8000)
+	cc1 := NewSubtitleTrack("CC1", "en")
+	cc1.Default = true
+	c.AddSubtitleTrack(cc1)
+	c.AddSubtitleTrack(NewSubtitleTrack("CC3", ""))
+
+	cc1.AddCue(Cue{Start: 11500 * time.Millisecond, End: 13 * time.Second, Text: "hello"})
+	cc1.AddCue(Cue{Start: 13 * time.Second, End: 13 * time.Second, Text: "empty"})
+	for i := 0; i < 6; i++ {
+		name := fmt.Sprintf("test1-%d.ts", i)
+		c.SetItem(name, TSItem{Name: name, SeqNum: i, Duration: 2000, Start: 10 * time.Second})
+	}
+
+	// 窗口中的ts切片为2~5, m3u8跳过第一个
+	m3u8, err := c.GetSubtitlePlayList("CC1.m3u8")
+	require.Nil(t, err)
+	require.Equal(t, "#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-ALLOW-CACHE:NO\n#EXT-X-TARGETDURATION:3\n#EXT-X-MEDIA-SEQUENCE:3\n\n"+
+		"#EXTINF:2.000,\nCC1-3.vtt\n#EXTINF:2.000,\nCC1-4.vtt\n#EXTINF:2.000,\nCC1-5.vtt\n", string(m3u8))
+	ts, err := c.GetM3U8PlayList()
+	require.Nil(t, err)
+	require.True(t, strings.Contains(string(ts), "#EXT-X-MEDIA-SEQUENCE:3\n"))
+
+	_, err = c.GetSubtitleItem("CC1-1.vtt")
+	require.Equal(t, ErrNoTsKey, err)
+
+	// 跨切片的cue在两个切片中都出现
+	cue := "WEBVTT\n" + vttTimestampMap + "\n\n00:00:11.500 --> 00:00:13.000\nhello\n"
+	c2 := NewTSCache("test2", "", 60000)
+	track := NewSubtitleTrack("CC1", "en")
+	c2.AddSubtitleTrack(track)
+	track.AddCue(Cue{Start: 11500 * time.Millisecond, End: 13 * time.Second, Text: "hello"})
+	for i := 0; i < 3; i++ {
+		name := fmt.Sprintf("test2-%d.ts", i)
+		c2.SetItem(name, TSItem{Name: name, SeqNum: i, Duration: 2000, Start: 10 * time.Second})
+	}
+	for _, key := range []string{"CC1-0.vtt", "CC1-1.vtt"} {
+		vtt, err := c2.GetSubtitleItem(key)
+		require.Nil(t, err)
+		require.Equal(t, cue, string(vtt))
+	}
+	vtt, err := c2.GetSubtitleItem("CC1-2.vtt")
+	require.Nil(t, err)
+	require.Equal(t, "WEBVTT\n"+vttTimestampMap+"\n", string(vtt))
+
+	require.Equal(t, "#EXTM3U\n#EXT-X-VERSION:3\n"+
+		"#EXT-X-MEDIA:TYPE=SUBTITLES,GROUP-ID=\"subs\",NAME=\"CC1\",LANGUAGE=\"en\",DEFAULT=YES,AUTOSELECT=YES,URI=\"CC1.m3u8\"\n"+
+		"#EXT-X-MEDIA:TYPE=SUBTITLES,GROUP-ID=\"subs\",NAME=\"CC3\",DEFAULT=NO,AUTOSELECT=YES,URI=\"CC3.m3u8\"\n"+
+		"#EXT-X-STREAM-INF:BANDWIDTH=2000000,SUBTITLES=\"subs\"\ntest1.m3u8\n", string(c.GetMasterPlayList("test1.m3u8", 2000000)))
+}
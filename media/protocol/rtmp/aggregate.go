@@ -0,0 +1,70 @@
+package rtmp
+
+import (
+	"fmt"
+
+	"github.com/bugVanisher/streamer/media/container/flv/flvio"
+	"github.com/bugVanisher/streamer/utils/bits/pio"
+)
+
+// aggregateMsg aggregate消息拆出的子消息
+type aggregateMsg struct {
+	msgtypeid uint8
+	timestamp uint32
+	msgdata   []byte
+}
+
+// splitAggregate 拆分aggregate消息(type 22). 消息体为连续的flv tag: 11字节tag头 + 数据 + 4字节back pointer,
+// 子消息的时间戳以第一个子消息为基准, 平移到aggregate消息本身的时间戳上
+func splitAggregate(timestamp uint32, b []byte) (msgs []aggregateMsg, err error) {
+	var base uint32
+	for n := 0; n < len(b); {
+		if len(b)-n < flvio.TagHeaderLength {
+			err = fmt.Errorf("rtmp: aggregate msg short tag header, left bytes=%d", len(b)-n)
+			return
+		}
+		h := b[n:]
+		datalen := int(pio.U24BE(h[1:4]))
+		ts := pio.U24BE(h[4:7]) | uint32(h[7])<<24
+		n += flvio.TagHeaderLength
+		if len(b)-n < datalen {
+			err = fmt.Errorf("rtmp: aggregate msg tag datalen=%d exceeds left bytes=%d", datalen, len(b)-n)
+			return
+		}
+		if len(msgs) == 0 {
+			base = ts
+		}
+		msgs = append(msgs, aggregateMsg{
+			msgtypeid: h[0],
+			timestamp: timestamp + (ts - base),
+			msgdata:   b[n : n+datalen],
+		})
+		// 跳过back pointer, 最后一个tag可能没有
+		n += datalen + flvio.TagTrailerLength
+	}
+	return
+}
+
+// handleAggregate 拆分aggregate消息后处理第一个子消息, 其余的由pollMsg依次处理
+func (self *conn) handleAggregate(timestamp uint32, msgsid uint32, msgdata []byte) (err error) {
+	msgs, err := splitAggregate(timestamp, msgdata)
+	if err != nil {
+		return
+	}
+	self.aggmsgsid = msgsid
+	self.aggmsgs = msgs
+	return self.nextAggregateMsg()
+}
+
+// nextAggregateMsg 处理下一个子消息, 只接受音视频和数据消息
+func (self *conn) nextAggregateMsg() (err error) {
+	for len(self.aggmsgs) > 0 {
+		msg := self.aggmsgs[0]
+		self.aggmsgs = self.aggmsgs[1:]
+		switch msg.msgtypeid {
+		case msgtypeidAudioMsg, msgtypeidVideoMsg, msgtypeidDataMsgAMF0:
+			return self.handleMsg(msg.timestamp, self.aggmsgsid, msg.msgtypeid, msg.msgdata)
+		}
+	}
+	return
+}
@@ -0,0 +1,51 @@
+package rtmp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bugVanisher/streamer/media/container/flv/flvio"
+)
+
+func aggregateTag(b []byte, tagtype uint8, ts int32, data []byte) []byte {
+	h := make([]byte, flvio.TagHeaderLength)
+	flvio.FillTagHeader(h, tagtype, len(data), ts)
+	t := make([]byte, flvio.TagTrailerLength)
+	flvio.FillTagTrailer(t, len(data))
+	return append(append(append(b, h...), data...), t...)
+}
+
+func TestAggregate(t *testing.T) {
+	var b []byte
+	b = aggregateTag(b, flvio.TAG_VIDEO, 5000, []byte{0x17, flvio.AVC_NALU, 0, 0, 0, 1, 2})
+	b = aggregateTag(b, flvio.TAG_AUDIO, 5023, []byte{0xaf, flvio.AAC_RAW, 3})
+	b = aggregateTag(b, flvio.TAG_VIDEO, 5040, []byte{0x27, flvio.AVC_NALU, 0, 0, 0, 4})
+
+	c := newConn(nil)
+	require.Nil(t, c.handleMsg(1000, 1, msgtypeidAggregateMsg, b))
+	require.True(t, c.gotmsg)
+	require.Equal(t, uint8(msgtypeidVideoMsg), c.msgtypeid)
+	require.Equal(t, uint32(1000), c.timestamp)
+	require.Equal(t, uint32(1), c.msgsid)
+	require.Equal(t, []byte{1, 2}, c.avtag.Data)
+
+	// 剩余的子消息不再读取网络
+	require.Nil(t, c.pollMsg())
+	require.Equal(t, uint8(msgtypeidAudioMsg), c.msgtypeid)
+	require.Equal(t, uint32(1023), c.timestamp)
+	require.Equal(t, []byte{3}, c.avtag.Data)
+
+	require.Nil(t, c.pollMsg())
+	require.Equal(t, uint32(1040), c.timestamp)
+	require.False(t, c.avtag.FrameType == flvio.FRAME_KEY)
+	require.Empty(t, c.aggmsgs)
+
+	// 最后一个tag没有back pointer
+	msgs, err := splitAggregate(0, b[:len(b)-flvio.TagTrailerLength])
+	require.Nil(t, err)
+	require.Len(t, msgs, 3)
+
+	_, err = splitAggregate(0, b[:len(b)-flvio.TagTrailerLength-1])
+	require.NotNil(t, err)
+}
@@ -0,0 +1,186 @@
+package rtmp
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"math/rand"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/bugVanisher/streamer/media/container/flv/flvio"
+)
+
+// maxAuthAttempts Adobe认证最多的connect次数: 无认证 -> 带用户名 -> challenge/response
+const maxAuthAttempts = 3
+
+// ConnectError 服务端以_error拒绝connect
+type ConnectError struct {
+	Code        string
+	Description string
+}
+
+func (self *ConnectError) Error() string {
+	return fmt.Sprintf("rtmp: connect rejected: %s %s", self.Code, self.Description)
+}
+
+func newConnectError(params []interface{}) *ConnectError {
+	e := &ConnectError{}
+	if len(params) > 0 {
+		if obj, ok := params[0].(flvio.AMFMap); ok {
+			e.Code, _ = obj["code"].(string)
+			e.Description, _ = obj["description"].(string)
+		}
+	}
+	return e
+}
+
+// TokenSigner 生成追加到publish/play流名后的鉴权query参数, stream不含原有的query
+type TokenSigner func(app, stream string) url.Values
+
+// AuthKeySigner 常见CDN的URL鉴权:
+// auth_key=<过期时间戳>-<rand>-0-<md5("/app/stream-<过期时间戳>-<rand>-0-key")>
+func AuthKeySigner(key string, ttl time.Duration) TokenSigner {
+	return func(app, stream string) url.Values {
+		exp := strconv.FormatInt(time.Now().Add(ttl).Unix(), 10)
+		r := strconv.FormatUint(uint64(rand.Uint32()), 16)
+		sum := md5.Sum([]byte(fmt.Sprintf("/%s/%s-%s-%s-0-%s", app, stream, exp, r, key)))
+		return url.Values{"auth_key": {exp + "-" + r + "-0-" + hex.EncodeToString(sum[:])}}
+	}
+}
+
+// signPath 用TokenSigner给publish/play的路径追加鉴权参数
+func (self *conn) signPath(app, path string) string {
+	if self.opts.TokenSigner == nil {
+		return path
+	}
+	stream := path
+	sep := "?"
+	if i := strings.IndexByte(path, '?'); i >= 0 {
+		stream = path[:i]
+		sep = "&"
+	}
+	q := self.opts.TokenSigner(app, stream)
+	if len(q) == 0 {
+		return path
+	}
+	return path + sep + q.Encode()
+}
+
+// connect 发送connect命令. 设置了AuthUser时处理Adobe认证(authmod=adobe):
+// 服务端每次拒绝后断开连接, 客户端重新建连并在app和tcUrl后带上认证参数再次connect
+func (self *conn) connect(path string) (err error) {
+	tcurl := getTcUrl(self.URL)
+	vhost := ""
+	if self.info.Vhost != "" {
+		vhost = "?" + vhostParam + "=" + url.QueryEscape(self.info.Vhost)
+	}
+	authparams := ""
+	for i := 0; i < maxAuthAttempts; i++ {
+		if i > 0 {
+			if err = self.redial(); err != nil {
+				return
+			}
+		}
+		params := vhost + authparams
+		if vhost != "" && authparams != "" {
+			params = vhost + "&" + authparams[1:]
+		}
+		err = self.writeConnect(path+params, tcurl+params)
+		cerr, ok := err.(*ConnectError)
+		if !ok || self.opts.AuthUser == "" {
+			return
+		}
+		if authparams, err = self.adobeAuthParams(cerr.Description); err != nil {
+			return
+		}
+		log.Debug().Str("ID", self.Info().ID).Str("description", cerr.Description).Msg("[rtmp] connect needs adobe auth, reconnecting")
+	}
+	return fmt.Errorf("rtmp: adobe auth not finished after %d attempts", maxAuthAttempts)
+}
+
+// adobeAuthParams 根据_error的description生成下一次connect的认证参数
+func (self *conn) adobeAuthParams(description string) (string, error) {
+	user := self.opts.AuthUser
+	if !strings.Contains(description, "authmod=adobe") {
+		return "", fmt.Errorf("rtmp: connect rejected: %s", description)
+	}
+	i := strings.Index(description, "?reason=")
+	if i < 0 {
+		// code=403 need auth; authmod=adobe, 先上报用户名以获取salt和challenge
+		if strings.Contains(description, "code=403") {
+			return "?authmod=adobe&user=" + url.QueryEscape(user), nil
+		}
+		return "", fmt.Errorf("rtmp: connect rejected: %s", description)
+	}
+	q, err := url.ParseQuery(description[i+1:])
+	if err != nil {
+		return "", fmt.Errorf("rtmp: invalid adobe auth description %q: %v", description, err)
+	}
+	switch reason := q.Get("reason"); reason {
+	case "needauth":
+	case "authfailed":
+		return "", fmt.Errorf("rtmp: adobe auth failed, incorrect password")
+	case "nosuchuser":
+		return "", fmt.Errorf("rtmp: adobe auth failed, no such user %s", user)
+	default:
+		return "", fmt.Errorf("rtmp: adobe auth failed, reason %s", reason)
+	}
+	salt, challenge, opaque := q.Get("salt"), q.Get("challenge"), q.Get("opaque")
+	if salt == "" {
+		return "", fmt.Errorf("rtmp: adobe auth salt missing: %s", description)
+	}
+	challenge2 := fmt.Sprintf("%08x", rand.Uint32())
+	response := adobeAuthResponse(user, self.opts.AuthPassword, salt, challenge, opaque, challenge2)
+	params := "?authmod=adobe&user=" + url.QueryEscape(user) + "&challenge=" + challenge2 + "&response=" + response
+	if opaque != "" {
+		params += "&opaque=" + opaque
+	}
+	return params, nil
+}
+
+// adobeAuthResponse base64(md5(base64(md5(user+salt+password)) + (opaque或challenge) + challenge2))
+func adobeAuthResponse(user, password, salt, challenge, opaque, challenge2 string) string {
+	sum := md5.Sum([]byte(user + salt + password))
+	h := md5.New()
+	h.Write([]byte(base64.StdEncoding.EncodeToString(sum[:])))
+	if opaque != "" {
+		h.Write([]byte(opaque))
+	} else {
+		h.Write([]byte(challenge))
+	}
+	h.Write([]byte(challenge2))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// redial 关闭当前连接, 重新建连并完成握手, 连接上的chunk状态全部重置
+func (self *conn) redial() (err error) {
+	if self.dial == nil {
+		return fmt.Errorf("rtmp: connection can not be redialed")
+	}
+	self.netconn.Close()
+	netconn, err := self.dial()
+	if err != nil {
+		return
+	}
+	self.netconn = netconn
+	self.readcsmap = make(map[uint32]*chunkStream)
+	self.readMaxChunkSize = 128
+	self.writeMaxChunkSize = 128
+	self.readAckSize = 0
+	self.ackn = 0
+	self.aggmsgs = nil
+	self.txrxcount.ReadWriter = netconn
+	self.bufr.Reset(self.txrxcount)
+	self.bufw.Reset(self.txrxcount)
+
+	stage := self.stage
+	err = self.HandshakeClient()
+	self.stage = stage
+	return
+}
@@ -0,0 +1,44 @@
+package rtmp
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdobeAuthResponse(t *testing.T) {
+	require.Equal(t, "j9k4FydXi5HZ7Up8WGr0SA==", adobeAuthResponse("user", "pass", "salt1", "chal", "opq", "0000abcd"))
+	require.Equal(t, "sKtvNitY7xI+QPtgoT6aNg==", adobeAuthResponse("user", "pass", "salt1", "chal", "", "0000abcd"))
+}
+
+func TestAdobeAuthParams(t *testing.T) {
+	c := newConn(nil, WithAdobeAuth("user", "pass"))
+
+	params, err := c.adobeAuthParams("[ code=403 need auth; authmod=adobe ] : ")
+	require.Nil(t, err)
+	require.Equal(t, "?authmod=adobe&user=user", params)
+
+	params, err = c.adobeAuthParams("[ AccessManager.Reject ] : [ authmod=adobe ] : ?reason=needauth&user=user&salt=salt1&challenge=chal&opaque=opq")
+	require.Nil(t, err)
+	q, err := url.ParseQuery(strings.TrimPrefix(params, "?"))
+	require.Nil(t, err)
+	require.Equal(t, "opq", q.Get("opaque"))
+	require.Len(t, q.Get("challenge"), 8)
+	require.Equal(t, adobeAuthResponse("user", "pass", "salt1", "chal", "opq", q.Get("challenge")),
+		strings.SplitN(strings.SplitN(params, "&response=", 2)[1], "&", 2)[0])
+
+	_, err = c.adobeAuthParams("[ AccessManager.Reject ] : [ authmod=adobe ] : ?reason=authfailed&opaque=opq")
+	require.NotNil(t, err)
+	_, err = c.adobeAuthParams("NetConnection.Connect.Rejected")
+	require.NotNil(t, err)
+}
+
+func TestSignPath(t *testing.T) {
+	c := newConn(nil, WithTokenSigner(func(app, stream string) url.Values {
+		return url.Values{"sign": {app + "." + stream}}
+	}))
+	require.Equal(t, "test?sign=live.test", c.signPath("live", "test"))
+	require.Equal(t, "test?a=1&sign=live.test", c.signPath("live", "test?a=1"))
+}
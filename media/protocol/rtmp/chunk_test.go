@@ -0,0 +1,164 @@
+package rtmp
+
+import (
+	"bytes"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bugVanisher/streamer/media/av"
+	"github.com/bugVanisher/streamer/media/container/flv/flvio"
+	"github.com/bugVanisher/streamer/utils/bits/pio"
+)
+
+// readVideoTag 从连接读取一条音视频消息
+func readVideoTag(c *conn) (tag flvio.Tag, err error) {
+	for {
+		if err = c.pollMsg(); err != nil {
+			return
+		}
+		if c.msgtypeid == msgtypeidVideoMsg {
+			return c.avtag, nil
+		}
+	}
+}
+
+func TestWriteChunked(t *testing.T) {
+	for _, ts := range []int32{40, FlvTimestampMax + 1000} {
+		wc, rc := net.Pipe()
+		w, r := newConn(wc), newConn(rc)
+		data := bytes.Repeat([]byte("0123456789"), 100)
+		tag := flvio.Tag{Type: flvio.TAG_VIDEO, FrameType: flvio.FRAME_KEY, CodecID: flvio.VIDEO_H264,
+			AVCPacketType: flvio.AVC_NALU, Data: data}
+
+		go func() {
+			w.wlock.Lock()
+			w.writeAVTagTo(1, tag, ts)
+			w.flushWrite()
+			w.wlock.Unlock()
+		}()
+		got, err := readVideoTag(r)
+		require.Nil(t, err)
+		require.Equal(t, data, got.Data)
+		require.Equal(t, uint32(ts), r.readcsmap[7].timenow)
+		w.Close()
+		r.Close()
+	}
+}
+
+func TestAppendChunks(t *testing.T) {
+	c := newConn(nil)
+	data := make([]byte, 300)
+	// 128字节一个chunk, tag头5字节在第一个chunk中
+	bufs := c.appendChunks(nil, make([]byte, 17), 5, data, 7, 40)
+	var lens []int
+	for _, buf := range bufs {
+		lens = append(lens, len(buf))
+	}
+	require.Equal(t, []int{17, 123, 1, 128, 1, 49}, lens)
+	require.Equal(t, []byte{0xc7}, bufs[2])
+
+	bufs = c.appendChunks(nil, make([]byte, 21), 5, data, 7, FlvTimestampMax+1)
+	require.Equal(t, []byte{0xc7, 0x01, 0, 0, 0}, bufs[2])
+
+	c.opts.LegacyChunkSize = true
+	require.Equal(t, 2, len(c.appendChunks(nil, make([]byte, 17), 5, data, 7, 40)))
+}
+
+func TestWriteLegacyChunkSize(t *testing.T) {
+	wc, rc := net.Pipe()
+	w, r := newConn(wc, WithLegacyChunkSize(true)), newConn(rc)
+	defer w.Close()
+	defer r.Close()
+	data := make([]byte, 1000)
+	go func() {
+		w.wlock.Lock()
+		w.writeAVTagTo(1, flvio.Tag{Type: flvio.TAG_VIDEO, FrameType: flvio.FRAME_INTER, CodecID: flvio.VIDEO_H264,
+			AVCPacketType: flvio.AVC_NALU, Data: data}, 0)
+		w.flushWrite()
+		w.wlock.Unlock()
+	}()
+	got, err := readVideoTag(r)
+	require.Nil(t, err)
+	require.Equal(t, data, got.Data)
+	// 先发送了SetChunkSize
+	require.True(t, r.readMaxChunkSize > 1000)
+}
+
+func TestTimestampRollover(t *testing.T) {
+	wc, rc := net.Pipe()
+	w, r := newConn(wc), newConn(rc)
+	defer w.Close()
+	defer r.Close()
+	tag := flvio.Tag{Type: flvio.TAG_VIDEO, FrameType: flvio.FRAME_INTER, CodecID: flvio.VIDEO_H264,
+		AVCPacketType: flvio.AVC_NALU, Data: make([]byte, 300)}
+
+	// 64位时间跨过32位回绕, 写出时按32位截断, 读取后展开为连续的时间
+	start := av.MediaTimeFromMsU32(1<<31 - 40)
+	var want []av.MediaTime
+	for i := 0; i < 4; i++ {
+		want = append(want, start+av.MediaTime(i)*av.MediaTimeFromMs(1<<30))
+	}
+	go func() {
+		w.wlock.Lock()
+		for _, tm := range want {
+			w.writeAVTagTo(1, tag, int32(tm.MsU32()))
+		}
+		w.flushWrite()
+		w.wlock.Unlock()
+	}()
+	for _, tm := range want {
+		got, err := readVideoTag(r)
+		require.Nil(t, err)
+		require.Equal(t, tag.Data, got.Data)
+		pkt, _ := r.prober.TagToPacket(got, int32(r.timestamp))
+		require.Equal(t, tm, pkt.Time)
+	}
+}
+
+func be32(v uint32) []byte {
+	b := make([]byte, 4)
+	pio.PutU32BE(b, v)
+	return b
+}
+
+func TestReadExtTimestampDelta(t *testing.T) {
+	wc, rc := net.Pipe()
+	r := newConn(rc)
+	defer wc.Close()
+	defer r.Close()
+
+	tagData := func(n int) []byte {
+		b := make([]byte, n)
+		b[0], b[1] = 0x27, flvio.AVC_NALU
+		return b
+	}
+	var raw []byte
+	// 类型0, 扩展时间戳接近回绕
+	raw = append(raw, 0x07, 0xff, 0xff, 0xff, 0, 0, 5, msgtypeidVideoMsg, 1, 0, 0, 0)
+	raw = append(raw, be32(0xfffffff0)...)
+	raw = append(raw, tagData(5)...)
+	// 类型1, 扩展字段是增量, 后续类型3 chunk重复该增量
+	const delta = 0x01000020
+	raw = append(raw, 0x47, 0xff, 0xff, 0xff, 0, 0, 200, msgtypeidVideoMsg)
+	raw = append(raw, be32(delta)...)
+	second := tagData(200)
+	second[199] = 9
+	raw = append(raw, second[:128]...)
+	raw = append(raw, 0xc7)
+	raw = append(raw, be32(delta)...)
+	raw = append(raw, second[128:]...)
+	go wc.Write(raw)
+
+	first, err := readVideoTag(r)
+	require.Nil(t, err)
+	pkt, _ := r.prober.TagToPacket(first, int32(r.timestamp))
+	require.Equal(t, av.MediaTimeFromMs(-16), pkt.Time)
+
+	got, err := readVideoTag(r)
+	require.Nil(t, err)
+	require.Equal(t, second[5:], got.Data)
+	pkt, _ = r.prober.TagToPacket(got, int32(r.timestamp))
+	require.Equal(t, av.MediaTimeFromMs(delta-16), pkt.Time)
+}
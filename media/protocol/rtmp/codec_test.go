@@ -0,0 +1,112 @@
+package rtmp
+
+import (
+	"bytes"
+	"encoding/hex"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bugVanisher/streamer/media/av"
+	"github.com/bugVanisher/streamer/media/av/avutil"
+	"github.com/bugVanisher/streamer/media/codec/h265parser"
+	"github.com/bugVanisher/streamer/media/codec/mp3parser"
+	"github.com/bugVanisher/streamer/media/container/flv/flvio"
+)
+
+// publishPlay 向服务端推送streams和pkts, 返回拉流端读到的streams和前n个packet
+func publishPlay(t *testing.T, streams []av.CodecData, pkts []av.Packet, n int) ([]av.CodecData, []av.Packet) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	s := NewServer("")
+	go s.Serve(l)
+	defer s.Close()
+	url := "rtmp://" + l.Addr().String() + "/live/codec"
+
+	pub, err := Dial(l.Addr().String(), WithTcURL(url))
+	require.Nil(t, err)
+	defer pub.Close()
+	require.Nil(t, pub.HandshakeClient())
+	require.Nil(t, pub.ConnectPublish())
+	require.Nil(t, pub.WriteHeader(streams))
+
+	play, err := Dial(l.Addr().String(), WithTcURL(url))
+	require.Nil(t, err)
+	defer play.Close()
+	require.Nil(t, play.HandshakeClient())
+	require.Nil(t, play.ConnectPlay())
+
+	for _, pkt := range pkts {
+		require.Nil(t, pub.WritePacket(pkt))
+	}
+	require.Nil(t, pub.WriteTrailer())
+
+	got, err := play.Streams()
+	require.Nil(t, err)
+	var read []av.Packet
+	for i := 0; i < n; i++ {
+		pkt, err := play.ReadPacket()
+		require.Nil(t, err)
+		read = append(read, pkt)
+	}
+	return got, read
+}
+
+func testH265(t *testing.T) h265parser.CodecData {
+	vps, _ := hex.DecodeString("40010c01ffff016000000300900000030000030078999809")
+	sps, _ := hex.DecodeString("420101016000000300900000030000030078a003c08010e5966669" +
+		"24cae010000003001000000301e080")
+	pps, _ := hex.DecodeString("4401c172b46240")
+	h265, err := h265parser.NewCodecDataFromVPSAndSPSAndPPS(vps, sps, pps)
+	require.Nil(t, err)
+	return h265
+}
+
+func TestServerPublishPlayHEVC(t *testing.T) {
+	h265 := testH265(t)
+
+	// 服务端探测需要MaxProbePacketCount个tag
+	var pkts []av.Packet
+	for i := 0; i < 30; i++ {
+		pkts = append(pkts, av.Packet{IsKeyFrame: i == 0, DataType: int8(flvio.TAG_VIDEO),
+			AVCPacketType: av.AVC_NALU, Time: av.MediaTimeFromMs(int32(i * 40)), Data: bytes.Repeat([]byte{byte(i)}, 1000+i)})
+	}
+	streams, read := publishPlay(t, []av.CodecData{h265}, pkts, 20)
+	require.Len(t, streams, 1)
+	require.Equal(t, av.H265, streams[0].Type())
+	require.Equal(t, h265.AVCDecoderConfRecordBytes(), streams[0].(h265parser.CodecData).AVCDecoderConfRecordBytes())
+	// 服务端按写缓冲批量发送, 最后几帧可能还在缓冲中, 只检查前20帧
+	for i, pkt := range read {
+		require.Equal(t, pkts[i].Data, pkt.Data)
+		require.Equal(t, pkts[i].Time, pkt.Time)
+	}
+}
+
+func TestServerPublishPlayMP3(t *testing.T) {
+	h265 := testH265(t)
+	// MPEG-1 Layer III, 128kbps, 48kHz, stereo, 384字节一帧
+	frame := append([]byte{0xff, 0xfb, 0x94, 0x00}, make([]byte, 380)...)
+	mp3, err := mp3parser.NewCodecDataFromFrame(frame)
+	require.Nil(t, err)
+
+	var pkts []av.Packet
+	for i := 0; i < 30; i++ {
+		pkts = append(pkts, av.Packet{IsKeyFrame: i == 0, DataType: int8(flvio.TAG_VIDEO),
+			AVCPacketType: av.AVC_NALU, Time: av.MediaTimeFromMs(int32(i * 40)), Data: bytes.Repeat([]byte{byte(i)}, 1000+i)})
+		pkts = append(pkts, av.Packet{Idx: 1, DataType: int8(flvio.TAG_AUDIO), Time: av.MediaTimeFromMs(int32(i * 24)), Data: frame})
+	}
+	streams, read := publishPlay(t, []av.CodecData{h265, mp3}, pkts, 20)
+	require.Len(t, streams, 2)
+	require.Equal(t, av.H265, streams[0].Type())
+	require.Equal(t, av.MP3, streams[1].Type())
+	require.Equal(t, 48000, streams[1].(av.AudioCodecData).SampleRate())
+	for i, pkt := range read {
+		require.Equal(t, pkts[i].Data, pkt.Data)
+	}
+
+	// 经过queue的header保留准确的采样率
+	hdrs := avutil.RevertHeader(avutil.ConvertHeader([]av.CodecData{mp3}))
+	require.Len(t, hdrs, 1)
+	require.Equal(t, mp3, hdrs[0])
+}
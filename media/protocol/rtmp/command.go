@@ -0,0 +1,79 @@
+package rtmp
+
+import (
+	"github.com/bugVanisher/streamer/media/container/flv/flvio"
+)
+
+// Command 收到的一条AMF命令消息
+type Command struct {
+	MsgSID  uint32 // 消息流id, connect/createStream等连接级命令为0
+	Name    string
+	TransID float64
+	Object  flvio.AMFMap // 命令对象, AMF null时为nil
+	Params  []interface{}
+}
+
+// CommandResponder 在CommandHandler中向对端发送命令
+type CommandResponder interface {
+	// Reply 以收到的命令的transid回复, name一般为_result或_error, args依次为命令对象和参数
+	Reply(name string, args ...interface{}) error
+	// Send 在同一个消息流上发送transid为0的命令, 如onStatus或自定义的通知
+	Send(name string, args ...interface{}) error
+}
+
+// CommandHandler 在读消息的goroutine中回调, c为收到命令的连接. 返回handled为true时内置逻辑不再处理该命令,
+// 返回错误时读消息失败. 接管connect/publish/play等命令需要自行完成相应的回复
+type CommandHandler func(c Conn, cmd Command, w CommandResponder) (handled bool, err error)
+
+// commandResponder 回复当前命令所在的消息流
+type commandResponder struct {
+	c       *conn
+	msgsid  uint32
+	transid float64
+}
+
+func (self commandResponder) Reply(name string, args ...interface{}) error {
+	return self.c.writeCommand(self.msgsid, name, self.transid, args...)
+}
+
+func (self commandResponder) Send(name string, args ...interface{}) error {
+	return self.c.writeCommand(self.msgsid, name, 0, args...)
+}
+
+// writeCommand 写命令消息并flush, 读写在不同goroutine中时持有wlock
+func (self *conn) writeCommand(msgsid uint32, name string, transid float64, args ...interface{}) (err error) {
+	if self.lockedRead {
+		self.wlock.Lock()
+		defer self.wlock.Unlock()
+	}
+	csid := uint32(3)
+	if msgsid != 0 {
+		csid = 5
+	}
+	if err = self.writeCommandMsg(csid, msgsid, append([]interface{}{name, transid}, args...)...); err != nil {
+		return
+	}
+	return self.flushWrite()
+}
+
+// runCommandHandler 把刚读到的命令交给Options.CommandHandler, 被接管时清除gotcommand
+func (self *conn) runCommandHandler() (err error) {
+	if self.opts.CommandHandler == nil {
+		return
+	}
+	cmd := Command{
+		MsgSID:  self.msgsid,
+		Name:    self.commandname,
+		TransID: self.commandtransid,
+		Object:  self.commandobj,
+		Params:  self.commandparams,
+	}
+	handled, err := self.opts.CommandHandler(self, cmd, commandResponder{c: self, msgsid: self.msgsid, transid: self.commandtransid})
+	if err != nil {
+		return
+	}
+	if handled {
+		self.gotcommand = false
+	}
+	return
+}
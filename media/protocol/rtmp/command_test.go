@@ -0,0 +1,72 @@
+package rtmp
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bugVanisher/streamer/media/container/flv/flvio"
+)
+
+func TestCommandHandler(t *testing.T) {
+	var cmds []Command
+	handler := func(c Conn, cmd Command, w CommandResponder) (bool, error) {
+		cmds = append(cmds, cmd)
+		switch cmd.Name {
+		case "releaseStream":
+			return true, w.Reply("_result", nil)
+		case "getStats":
+			if err := w.Send("onStats", nil, flvio.AMFMap{"code": "Stats.Begin"}); err != nil {
+				return true, err
+			}
+			return true, w.Reply("_result", nil, flvio.AMFMap{"clients": float64(1)})
+		}
+		return false, nil
+	}
+	sc, cc := net.Pipe()
+	server, client := newConn(sc, WithCommandHandler(handler)), newConn(cc)
+	defer server.Close()
+	defer client.Close()
+
+	type reply struct {
+		name    string
+		transid float64
+		params  []interface{}
+	}
+	replies := make(chan []reply, 1)
+	go func() {
+		client.writeCommandMsg(3, 0, "releaseStream", 2, nil, "live")
+		client.writeCommandMsg(3, 0, "getStats", 3, nil)
+		client.writeCommandMsg(3, 0, "FCPublish", 4, nil, "live")
+		client.flushWrite()
+		var got []reply
+		for i := 0; i < 3; i++ {
+			if client.pollCommand() != nil {
+				break
+			}
+			got = append(got, reply{client.commandname, client.commandtransid, client.commandparams})
+		}
+		replies <- got
+	}()
+
+	// 被接管的命令不再作为命令交给内置逻辑
+	for i := 0; i < 2; i++ {
+		require.Nil(t, server.pollMsg())
+		require.True(t, server.gotmsg)
+		require.False(t, server.gotcommand)
+	}
+	require.Nil(t, server.pollMsg())
+	require.True(t, server.gotcommand)
+	require.Equal(t, "FCPublish", server.commandname)
+
+	got := <-replies
+	require.Equal(t, []reply{
+		{"_result", 2, []interface{}{}},
+		{"onStats", 0, []interface{}{flvio.AMFMap{"code": "Stats.Begin"}}},
+		{"_result", 3, []interface{}{flvio.AMFMap{"clients": float64(1)}}},
+	}, got)
+	require.Len(t, cmds, 3)
+	require.Equal(t, Command{Name: "releaseStream", TransID: 2, Params: []interface{}{"live"}}, cmds[0])
+	require.Equal(t, "FCPublish", cmds[2].Name)
+}
@@ -19,8 +19,18 @@ type Conn interface {
 	ConnectPublish() error // 执行connect命令和publish命令
 	ConnectPlay() error    // 执行connect命令和play命令
 
+	ConnectCreateStream() error     // 执行connect命令和createStream命令, 不发送publish
+	Publish() error                 // 在ConnectCreateStream之后执行publish命令
+	CreateStream() (*Stream, error) // 在已建立的连接上创建新的消息流, 用于一个连接推多路流
+
 	OnStatus(msg flvio.AMFMap) error
 	HandshakeServer() error
 	VideoResolution() (width uint32, height uint32)
 	ProtoType() string
+	TxBytes() uint64 // 已发送的网络字节数
+	RxBytes() uint64 // 已接收的网络字节数
+	Metrics() Metrics
+	Debuger() *Debuger
+	// ServePlayControl 服务端拉流时读取pause/seek命令并回调handler, 阻塞直到连接出错
+	ServePlayControl(handler func(ctl PlayControl) error) error
 }
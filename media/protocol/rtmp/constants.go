@@ -20,6 +20,36 @@ var (
 		"code":        "NetStream.Publish.StreamDuplicated",
 		"description": "Stream duplicated",
 	}
+	AMFMapOnStatusUnpublishSuccess = flvio.AMFMap{
+		"level":       "status",
+		"code":        "NetStream.Unpublish.Success",
+		"description": "Stop publishing",
+	}
+	AMFMapOnStatusPauseNotify = flvio.AMFMap{
+		"level":       "status",
+		"code":        "NetStream.Pause.Notify",
+		"description": "Paused live",
+	}
+	AMFMapOnStatusUnpauseNotify = flvio.AMFMap{
+		"level":       "status",
+		"code":        "NetStream.Unpause.Notify",
+		"description": "Unpaused live",
+	}
+	AMFMapOnStatusPauseFailed = flvio.AMFMap{
+		"level":       "error",
+		"code":        "NetStream.Failed",
+		"description": "Pause failed",
+	}
+	AMFMapOnStatusSeekNotify = flvio.AMFMap{
+		"level":       "status",
+		"code":        "NetStream.Seek.Notify",
+		"description": "Seeking",
+	}
+	AMFMapOnStatusSeekFailed = flvio.AMFMap{
+		"level":       "error",
+		"code":        "NetStream.Seek.Failed",
+		"description": "Seek failed",
+	}
 )
 
 var (
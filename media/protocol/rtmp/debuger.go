@@ -2,27 +2,28 @@ package rtmp
 
 import (
 	"fmt"
-	"os"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/bugVanisher/streamer/common/output"
 )
 
 // Debuger debug对象，记录任务的debug信息
 type Debuger struct {
 	taskID         string
-	enabled        bool     //debug模式开关, 为true时开启
-	debugFileName  string   //debug信息保存文件
-	debugDuration  int64    //debug时长,单位秒
-	debugStartTime int64    //debug开始时间,时间戳秒
-	debugFile      *os.File //debug文件
+	enabled        int32        //debug模式开关, 为1时开启, 可能在其他goroutine中切换
+	debugFileName  string       //debug信息保存文件
+	debugDuration  int64        //debug时长,单位秒
+	debugStartTime int64        //debug开始时间,时间戳秒
+	debugFile      *output.File //debug文件, 按output的滚动配置滚动
 	debugLock      sync.Mutex
 }
 
 // NewDebuger 创建debuger
 func NewDebuger(taskID string) *Debuger {
 	return &Debuger{
-		taskID:  taskID,
-		enabled: false,
+		taskID: taskID,
 	}
 }
 
@@ -31,17 +32,28 @@ func (t *Debuger) Enabled() bool {
 	if t == nil {
 		return false
 	}
-	return t.enabled
+	return atomic.LoadInt32(&t.enabled) == 1
 }
 
-// StartDebug 开启debug功能, 需要设定输出文件和debug时长, 如果已经在debug模式则忽略本次调用
+// FileName 当前或最近一次debug的输出文件
+func (t *Debuger) FileName() string {
+	if t == nil {
+		return ""
+	}
+	t.debugLock.Lock()
+	defer t.debugLock.Unlock()
+	return t.debugFileName
+}
+
+// StartDebug 开启debug功能, 需要设定输出文件和debug时长, 如果已经在debug模式则忽略本次调用.
+// 文件按output.GetConfig()中的滚动策略滚动, 父目录不存在时自动创建
 func (t *Debuger) StartDebug(debugFileName string, debugDuration int64) bool {
 	if t == nil {
 		return false
 	}
 	t.debugLock.Lock()
 	defer t.debugLock.Unlock()
-	if t.enabled {
+	if t.Enabled() {
 		return true
 	}
 	t.debugStartTime = time.Now().Unix()
@@ -52,12 +64,12 @@ func (t *Debuger) StartDebug(debugFileName string, debugDuration int64) bool {
 	if t.debugFile != nil {
 		t.debugFile.Close()
 	}
-	t.debugFile, err = os.Create(t.debugFileName)
+	t.debugFile, err = output.OpenFile(t.debugFileName, output.GetConfig().Rotation)
 	if err != nil {
-		t.debugFile.Close()
+		t.debugFile = nil
 		return false
 	}
-	t.enabled = true
+	atomic.StoreInt32(&t.enabled, 1)
 	return true
 }
 
@@ -68,12 +80,13 @@ func (t *Debuger) StopDebug() {
 	}
 	t.debugLock.Lock()
 	defer t.debugLock.Unlock()
-	if !t.enabled {
+	if !t.Enabled() {
 		return
 	}
-	t.enabled = false
+	atomic.StoreInt32(&t.enabled, 0)
 	if t.debugFile != nil {
 		t.debugFile.Close()
+		t.debugFile = nil
 	}
 	return
 }
@@ -83,13 +96,18 @@ func (t *Debuger) Debug(format string, args ...interface{}) {
 	if t == nil {
 		return
 	}
-	if !t.enabled || t.debugFile == nil {
+	if !t.Enabled() {
 		return
 	}
 
 	msg := fmt.Sprintf(time.Now().Format("2006-01-02 15:04:05.000")+" "+format+"\n", args...)
-	t.debugFile.Write([]byte(msg))
-	if t.debugDuration > 0 && time.Now().Unix() >= t.debugStartTime+t.debugDuration {
+	t.debugLock.Lock()
+	if t.debugFile != nil {
+		t.debugFile.Write([]byte(msg))
+	}
+	expired := t.debugDuration > 0 && time.Now().Unix() >= t.debugStartTime+t.debugDuration
+	t.debugLock.Unlock()
+	if expired {
 		t.StopDebug()
 	}
 	return
@@ -0,0 +1,115 @@
+package rtmp
+
+import (
+	"sync"
+	"time"
+)
+
+// EgressLimitAll SetEgressLimit的key, 作用于没有单独设置的所有流
+const EgressLimitAll = "*"
+
+// egressLimiter 一路流所有拉流会话共享的出口带宽上限(字节/秒), 模拟按流计费的带宽限制.
+// 按公平份额分配: 每个拉流会话一个令牌桶, 速率为总速率/拉流会话数, 会话加入或离开时重新分配
+type egressLimiter struct {
+	lock    sync.Mutex
+	rate    int64
+	players map[string]*pacer
+
+	throttled     int64         // 需要等待令牌的次数
+	throttledTime time.Duration // 累计等待的时间
+}
+
+func newEgressLimiter(rate int64) *egressLimiter {
+	return &egressLimiter{rate: rate, players: make(map[string]*pacer)}
+}
+
+// setRate 修改总速率, 0为不限速, 立即对所有拉流会话生效
+func (self *egressLimiter) setRate(rate int64) {
+	self.lock.Lock()
+	self.rate = rate
+	self.share()
+	self.lock.Unlock()
+}
+
+// join 拉流会话id开始拉流
+func (self *egressLimiter) join(id string) {
+	self.lock.Lock()
+	p := &pacer{last: time.Now()}
+	self.players[id] = p
+	self.share()
+	// 新会话起播时有一个份额的突发, 和newPacer一致
+	p.tokens = p.burst
+	self.lock.Unlock()
+}
+
+// leave 拉流会话id结束拉流, 它的份额分给其它会话
+func (self *egressLimiter) leave(id string) {
+	self.lock.Lock()
+	delete(self.players, id)
+	self.share()
+	self.lock.Unlock()
+}
+
+// share 按拉流会话数平分总速率, 每个会话最多积攒1秒的令牌. 调用方持有lock
+func (self *egressLimiter) share() {
+	if len(self.players) == 0 {
+		return
+	}
+	rate := self.rate / int64(len(self.players))
+	if self.rate > 0 && rate <= 0 {
+		rate = 1
+	}
+	for _, p := range self.players {
+		p.rate, p.burst = rate, rate
+		if p.tokens > rate {
+			p.tokens = rate
+		}
+	}
+}
+
+// wait 拉流会话id发送n字节前调用, 超过份额时休眠
+func (self *egressLimiter) wait(id string, n int) {
+	self.lock.Lock()
+	p, ok := self.players[id]
+	if !ok || self.rate <= 0 {
+		self.lock.Unlock()
+		return
+	}
+	d := p.reserve(n, time.Now())
+	if d > 0 {
+		self.throttled++
+		self.throttledTime += d
+	}
+	self.lock.Unlock()
+	if d > 0 {
+		time.Sleep(d)
+	}
+}
+
+// stat 返回速率上限和限速统计
+func (self *egressLimiter) stat() (rate, throttled int64, throttledTime time.Duration) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return self.rate, self.throttled, self.throttledTime
+}
+
+// SetEgressLimit 设置流key(app/stream)所有拉流会话的出口总带宽上限(字节/秒), 各拉流会话平分.
+// key为EgressLimitAll时作用于没有单独设置的所有流, rate为0时不限制(单独设置为0的流不受*的限制). 对正在拉流的会话立即生效
+func (s *Server) SetEgressLimit(key string, rate int64) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.egressLimits[key] = rate
+	for k, st := range s.streams {
+		if key == EgressLimitAll || key == k {
+			st.egress.setRate(s.egressLimit(k))
+		}
+	}
+}
+
+// egressLimit 流key的出口带宽上限, 调用方持有lock
+func (s *Server) egressLimit(key string) int64 {
+	if rate, ok := s.egressLimits[key]; ok {
+		return rate
+	}
+	return s.egressLimits[EgressLimitAll]
+}
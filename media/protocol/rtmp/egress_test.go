@@ -0,0 +1,62 @@
+package rtmp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEgressLimiterFairShare(t *testing.T) {
+	l := newEgressLimiter(200 * 1000)
+	l.join("a")
+	l.join("b")
+	require.Equal(t, int64(100*1000), l.players["a"].rate)
+
+	// 每个会话的份额为100KB/s, 先用完1秒的令牌, 再发送10KB需要等待约100ms
+	start := time.Now()
+	l.wait("a", 100*1000)
+	l.wait("a", 10*1000)
+	elapsed := time.Since(start)
+	require.True(t, elapsed >= 80*time.Millisecond, elapsed)
+	require.True(t, elapsed < 500*time.Millisecond, elapsed)
+	rate, throttled, throttledTime := l.stat()
+	require.Equal(t, int64(200*1000), rate)
+	require.Equal(t, int64(1), throttled)
+	require.True(t, throttledTime > 0)
+
+	// b离开后a独享全部速率
+	l.leave("b")
+	require.Equal(t, int64(200*1000), l.players["a"].rate)
+
+	// 取消限速后不再等待
+	l.setRate(0)
+	start = time.Now()
+	l.wait("a", 1000*1000)
+	require.True(t, time.Since(start) < 10*time.Millisecond)
+}
+
+func TestServerEgressLimit(t *testing.T) {
+	s := NewServer("")
+	s.SetEgressLimit(EgressLimitAll, 625000)
+	s.SetEgressLimit("live/free", 1000)
+	s.SetEgressLimit("live/vip", 0)
+
+	s.lock.Lock()
+	free, vip, other := s.acquire("live/free"), s.acquire("live/vip"), s.acquire("live/other")
+	s.lock.Unlock()
+	require.Equal(t, int64(1000), free.egress.rate)
+	require.Equal(t, int64(0), vip.egress.rate)
+	require.Equal(t, int64(625000), other.egress.rate)
+
+	// 修改默认值对已有的流立即生效, 单独设置的流不受影响
+	s.SetEgressLimit(EgressLimitAll, 125000)
+	require.Equal(t, int64(125000), other.egress.rate)
+	require.Equal(t, int64(1000), free.egress.rate)
+
+	for _, info := range s.Streams() {
+		if info.Key == "live/other" {
+			require.Equal(t, int64(125000), info.EgressLimit)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package rtmp
+
+import "time"
+
+// flusher 音视频消息的批量发送状态, 见Options.FlushBytes和Options.FlushInterval. 持有wlock时访问
+type flusher struct {
+	pending int         // 上次flush之后写入的音视频字节数
+	timer   *time.Timer // 设置了FlushInterval时创建
+	armed   bool
+	err     error // 定时flush的错误, 下次写入时返回
+}
+
+// afterAVWrite 写入一条音视频消息后按策略flush: 累计达到FlushBytes时立即发送, 否则在FlushInterval后发送
+func (self *conn) afterAVWrite(n int) (err error) {
+	if err = self.flush.err; err != nil {
+		self.flush.err = nil
+		return
+	}
+	self.flush.pending += n
+	if self.opts.FlushBytes > 0 && self.flush.pending >= self.opts.FlushBytes {
+		return self.flushWrite()
+	}
+	if self.flush.timer != nil && !self.flush.armed {
+		self.flush.armed = true
+		self.flush.timer.Reset(self.opts.FlushInterval)
+	}
+	return
+}
+
+func (self *conn) flushTimer() {
+	self.wlock.Lock()
+	defer self.wlock.Unlock()
+	self.flush.armed = false
+	if self.flush.pending == 0 {
+		return
+	}
+	if err := self.flushWrite(); err != nil {
+		self.flush.err = err
+	}
+}
@@ -0,0 +1,95 @@
+package rtmp
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bugVanisher/streamer/media/container/flv/flvio"
+)
+
+// writeCountConn 记录每次Write的字节数
+type writeCountConn struct {
+	net.Conn
+	lock   sync.Mutex
+	writes []int
+}
+
+func (c *writeCountConn) Write(p []byte) (int, error) {
+	c.lock.Lock()
+	c.writes = append(c.writes, len(p))
+	c.lock.Unlock()
+	return len(p), nil
+}
+
+func (c *writeCountConn) SetDeadline(t time.Time) error {
+	return nil
+}
+
+func (c *writeCountConn) SetReadDeadline(t time.Time) error {
+	return nil
+}
+
+func (c *writeCountConn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
+
+func (c *writeCountConn) Close() error {
+	return nil
+}
+
+func (c *writeCountConn) count() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return len(c.writes)
+}
+
+// waitCount 等待Write次数达到n
+func (c *writeCountConn) waitCount(n int) bool {
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		if c.count() == n {
+			return true
+		}
+	}
+	return false
+}
+
+func writeTestAudio(c *conn, ts int32) error {
+	c.wlock.Lock()
+	defer c.wlock.Unlock()
+	return c.writeAVTagTo(1, flvio.Tag{Type: flvio.TAG_AUDIO, SoundFormat: flvio.SOUND_AAC,
+		AACPacketType: flvio.AAC_RAW, Data: make([]byte, 100)}, ts)
+}
+
+func TestFlushBytes(t *testing.T) {
+	nc := &writeCountConn{}
+	c := newConn(nc, WithFlushStrategy(300, 0))
+	for i := 0; i < 2; i++ {
+		require.Nil(t, writeTestAudio(c, int32(i*23)))
+	}
+	require.Equal(t, 0, nc.count())
+	// 第3条累计超过300字节
+	require.Nil(t, writeTestAudio(c, 46))
+	require.Equal(t, 1, nc.count())
+	require.Nil(t, writeTestAudio(c, 69))
+	require.Equal(t, 1, nc.count())
+}
+
+func TestFlushInterval(t *testing.T) {
+	nc := &writeCountConn{}
+	c := newConn(nc, WithFlushStrategy(0, 20*time.Millisecond))
+	defer c.Close()
+	require.Nil(t, writeTestAudio(c, 0))
+	require.Nil(t, writeTestAudio(c, 23))
+	require.Equal(t, 0, nc.count())
+	require.True(t, nc.waitCount(1))
+
+	// 没有新数据时不再发送
+	time.Sleep(50 * time.Millisecond)
+	require.Equal(t, 1, nc.count())
+	require.Nil(t, writeTestAudio(c, 46))
+	require.True(t, nc.waitCount(2))
+}
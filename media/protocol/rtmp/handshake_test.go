@@ -0,0 +1,68 @@
+package rtmp
+
+import (
+	"io"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bugVanisher/streamer/utils/bits/pio"
+)
+
+func TestHandshake(t *testing.T) {
+	for _, simple := range []bool{false, true} {
+		sc, cc := net.Pipe()
+		server := newConn(sc)
+		client := newConn(cc, WithSimpleHandshake(simple))
+		done := make(chan error, 1)
+		go func() {
+			done <- server.HandshakeServer()
+		}()
+		require.Nil(t, client.HandshakeClient(), "simple=%v", simple)
+		// C2留在写缓冲中, 由之后的connect一起发送
+		require.Nil(t, client.bufw.Flush())
+		require.Nil(t, <-done, "simple=%v", simple)
+		require.Equal(t, 1, client.stage)
+		require.Equal(t, 1, server.stage)
+		sc.Close()
+		cc.Close()
+	}
+}
+
+func TestHandshakeClientInvalidS1Digest(t *testing.T) {
+	sc, cc := net.Pipe()
+	defer sc.Close()
+	client := newConn(cc)
+	defer client.Close()
+
+	// 服务端S1带版本号但digest不合法, 客户端应回退为简单握手, 以S1作为C2
+	S0S1S2 := make([]byte, 1+1536*2)
+	S0S1S2[0] = 3
+	S1 := S0S1S2[1 : 1536+1]
+	pio.PutU32BE(S1[4:8], 0x0d0e0a0d)
+	for i := 8; i < len(S1); i++ {
+		S1[i] = byte(i)
+	}
+	c2 := make(chan []byte, 1)
+	go func() {
+		C0C1 := make([]byte, 1+1536)
+		if _, err := io.ReadFull(sc, C0C1); err != nil {
+			c2 <- nil
+			return
+		}
+		if _, err := sc.Write(S0S1S2); err != nil {
+			c2 <- nil
+			return
+		}
+		C2 := make([]byte, 1536)
+		if _, err := io.ReadFull(sc, C2); err != nil {
+			c2 <- nil
+			return
+		}
+		c2 <- C2
+	}()
+	require.Nil(t, client.HandshakeClient())
+	require.Nil(t, client.bufw.Flush())
+	require.Equal(t, S1, <-c2)
+}
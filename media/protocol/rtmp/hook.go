@@ -4,4 +4,7 @@ import "github.com/bugVanisher/streamer/media/protocol/common"
 
 type Hook interface {
 	OnPlayOrPublish(info common.Info) error
+	// OnUnpublish 推流端发送FCUnpublish/deleteStream/closeStream停止推流后回调, 每路流最多一次.
+	// 只是断开连接时不回调
+	OnUnpublish(info common.Info)
 }
@@ -0,0 +1,146 @@
+package rtmp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/bugVanisher/streamer/media/container/flv/flvio"
+)
+
+const (
+	JournalKindCommand = "cmd"
+	JournalKindEvent   = "evt"
+)
+
+// JournalEntry 会话日志的一条记录, 每条记录一行json
+type JournalEntry struct {
+	T       int64         `json:"t"` // 距会话开始的毫秒数
+	Kind    string        `json:"k"`
+	Name    string        `json:"n"`
+	MsgSID  uint32        `json:"sid,omitempty"`
+	TransID float64       `json:"tid,omitempty"`
+	Obj     flvio.AMFMap  `json:"obj,omitempty"`
+	Params  []interface{} `json:"p,omitempty"`
+}
+
+// Journal 按会话记录收到的rtmp命令和关键事件, 可用Replay在测试服务端上重放
+type Journal struct {
+	lock  sync.Mutex
+	w     io.Writer
+	enc   *json.Encoder
+	start time.Time
+}
+
+// NewJournal 创建会话日志, 记录写入w
+func NewJournal(w io.Writer) *Journal {
+	return &Journal{
+		w:     w,
+		enc:   json.NewEncoder(w),
+		start: time.Now(),
+	}
+}
+
+func (j *Journal) write(e JournalEntry) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	e.T = int64(time.Since(j.start) / time.Millisecond)
+	_ = j.enc.Encode(e)
+}
+
+// Command 记录收到的命令
+func (j *Journal) Command(msgsid uint32, name string, transid float64, obj flvio.AMFMap, params []interface{}) {
+	j.write(JournalEntry{Kind: JournalKindCommand, Name: name, MsgSID: msgsid, TransID: transid, Obj: obj, Params: params})
+}
+
+// Event 记录关键事件, 如publish/play开始、连接关闭
+func (j *Journal) Event(name string, params ...interface{}) {
+	j.write(JournalEntry{Kind: JournalKindEvent, Name: name, Params: params})
+}
+
+// ReadJournal 读取会话日志
+func ReadJournal(r io.Reader) (entries []JournalEntry, err error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var e JournalEntry
+		if err = json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("rtmp: bad journal line %d: %v", len(entries)+1, err)
+		}
+		e.Params = amfValues(e.Params)
+		// 没有命令对象的命令保持nil, 重放时按AMF0 null发送
+		if e.Obj != nil {
+			e.Obj = amfValue(map[string]interface{}(e.Obj)).(flvio.AMFMap)
+		}
+		entries = append(entries, e)
+	}
+	return entries, scanner.Err()
+}
+
+// amfValue 把json解码出的map转换为flvio.AMFMap, 以便重新编码为AMF0
+func amfValue(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		m := flvio.AMFMap{}
+		for k, x := range val {
+			m[k] = amfValue(x)
+		}
+		return m
+	case []interface{}:
+		return flvio.AMFArray(amfValues(val))
+	}
+	return v
+}
+
+func amfValues(vals []interface{}) []interface{} {
+	for i, v := range vals {
+		vals[i] = amfValue(v)
+	}
+	return vals
+}
+
+// Replay 以客户端身份连接netconn, 完成握手后按原始时间间隔重放日志中的命令.
+// realtime为false时不等待, 依次发送全部命令
+func Replay(netconn net.Conn, entries []JournalEntry, realtime bool) (err error) {
+	c := newConn(netconn)
+	c.opts.IsServer = false
+	if err = c.HandshakeClient(); err != nil {
+		return
+	}
+	// 重放只关心服务端收到的命令, 服务端的响应直接丢弃
+	go io.Copy(io.Discard, c.bufr)
+	if err = c.writeBasicConf(); err != nil {
+		return
+	}
+
+	begin := time.Now()
+	for _, e := range entries {
+		if e.Kind != JournalKindCommand {
+			continue
+		}
+		if realtime {
+			if d := time.Duration(e.T)*time.Millisecond - time.Since(begin); d > 0 {
+				time.Sleep(d)
+			}
+		}
+		var obj interface{}
+		if e.Obj != nil {
+			obj = e.Obj
+		}
+		args := append([]interface{}{e.Name, e.TransID, obj}, e.Params...)
+		if err = c.writeCommandMsg(3, e.MsgSID, args...); err != nil {
+			return
+		}
+		if err = c.flushWrite(); err != nil {
+			return
+		}
+	}
+	return
+}
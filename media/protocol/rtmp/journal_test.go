@@ -0,0 +1,135 @@
+package rtmp
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bugVanisher/streamer/media/container/flv/flvio"
+)
+
+// readJournalDir 读取dir中唯一的会话日志
+func readJournalDir(t *testing.T, dir string) []JournalEntry {
+	files, err := filepath.Glob(filepath.Join(dir, "*.journal"))
+	require.Nil(t, err)
+	require.Len(t, files, 1)
+	f, err := os.Open(files[0])
+	require.Nil(t, err)
+	defer f.Close()
+	entries, err := ReadJournal(f)
+	require.Nil(t, err)
+	return entries
+}
+
+func journalCommands(entries []JournalEntry) (cmds []JournalEntry) {
+	for _, e := range entries {
+		if e.Kind == JournalKindCommand {
+			e.T = 0
+			cmds = append(cmds, e)
+		}
+	}
+	return
+}
+
+func TestJournalReplay(t *testing.T) {
+	// 推流会话的命令记录到日志
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	s := NewServer("")
+	s.JournalDir = t.TempDir()
+	go s.Serve(l)
+	pub, err := Dial(l.Addr().String(), WithTcURL("rtmp://"+l.Addr().String()+"/live/journal"))
+	require.Nil(t, err)
+	require.Nil(t, pub.HandshakeClient())
+	require.Nil(t, pub.ConnectPublish())
+	pub.Close()
+	s.Close()
+
+	var recorded []JournalEntry
+	for i := 0; i < 100; i++ {
+		if recorded = journalCommands(readJournalDir(t, s.JournalDir)); len(recorded) > 0 && recorded[len(recorded)-1].Name == "publish" {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	var names []string
+	for _, e := range recorded {
+		names = append(names, e.Name)
+	}
+	require.Equal(t, []string{"connect", "createStream", "publish"}, names)
+	require.Equal(t, "live", recorded[0].Obj["app"])
+	// createStream和publish没有命令对象, 读回后仍为nil
+	require.Nil(t, recorded[1].Obj)
+	require.Nil(t, recorded[2].Obj)
+
+	// 重放到另一个服务端, 服务端收到的命令和日志一致
+	replayed := NewServer("")
+	replayed.JournalDir = t.TempDir()
+	sc, cc := net.Pipe()
+	done := make(chan struct{})
+	go func() {
+		replayed.handleConn(sc)
+		close(done)
+	}()
+	require.Nil(t, Replay(cc, recorded, false))
+	// 等服务端开始推流会话再断开
+	for i := 0; i < 100; i++ {
+		if sessions := replayed.Sessions(); len(sessions) == 1 && sessions[0].Publishing {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cc.Close()
+	<-done
+
+	entries := readJournalDir(t, replayed.JournalDir)
+	require.Equal(t, recorded, journalCommands(entries))
+	var events []string
+	for _, e := range entries {
+		if e.Kind == JournalKindEvent {
+			events = append(events, e.Name)
+		}
+	}
+	require.Equal(t, []string{"publishStart", "close"}, events)
+}
+
+func TestJournalReplayNullObject(t *testing.T) {
+	journal := `{"t":0,"k":"cmd","n":"connect","tid":1,"obj":{"app":"live","tcUrl":"rtmp://127.0.0.1/live"}}
+{"t":1,"k":"cmd","n":"createStream","tid":2,"obj":null}
+{"t":2,"k":"cmd","n":"publish","sid":1,"p":["null","live"]}
+`
+	entries, err := ReadJournal(strings.NewReader(journal))
+	require.Nil(t, err)
+	require.Len(t, entries, 3)
+	require.Equal(t, flvio.AMFMap{"app": "live", "tcUrl": "rtmp://127.0.0.1/live"}, entries[0].Obj)
+	require.Nil(t, entries[1].Obj)
+	require.Nil(t, entries[2].Obj)
+
+	sc, cc := net.Pipe()
+	defer sc.Close()
+	done := make(chan error, 1)
+	go func() {
+		done <- Replay(cc, entries, false)
+	}()
+	// 服务端按原样解码命令, 没有命令对象的命令收到AMF0 null
+	srv := newConn(sc)
+	require.Nil(t, srv.HandshakeServer())
+	var names []string
+	var objs []flvio.AMFMap
+	for len(names) < 3 {
+		require.Nil(t, srv.pollCommand())
+		names = append(names, srv.commandname)
+		objs = append(objs, srv.commandobj)
+	}
+	require.Nil(t, <-done)
+	require.Equal(t, []string{"connect", "createStream", "publish"}, names)
+	require.Equal(t, "live", objs[0]["app"])
+	require.Nil(t, objs[1])
+	require.Nil(t, objs[2])
+	require.Equal(t, []interface{}{"null", "live"}, srv.commandparams)
+}
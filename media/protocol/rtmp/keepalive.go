@@ -0,0 +1,174 @@
+package rtmp
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/bugVanisher/streamer/utils/bits/pio"
+	"github.com/bugVanisher/streamer/utils/loop"
+)
+
+// ErrIdleTimeout 超过IdleTimeout没有收到对端的任何数据
+var ErrIdleTimeout = errors.New("rtmp: idle timeout")
+
+// keepAlive 空闲时发送PingRequest, 对端的PingResponse或其他数据都会刷新lastRx
+type keepAlive struct {
+	lastRx int64 // 最近一次收到数据的时间, UnixNano, 原子操作
+	start  time.Time
+	done   chan struct{}
+	stop   sync.Once
+	task   *loop.Task // 使用EventLoop时的定时任务
+}
+
+// readTimeout 读取一个chunk的超时, 未设置ReadTimeout时使用ReadWriteTimeout
+func (self *Options) readTimeout() time.Duration {
+	if self.ReadTimeout > 0 {
+		return self.ReadTimeout
+	}
+	return self.ReadWriteTimeout
+}
+
+// writeTimeout 每次写入的超时, 未设置WriteTimeout时使用ReadWriteTimeout
+func (self *Options) writeTimeout() time.Duration {
+	if self.WriteTimeout > 0 {
+		return self.WriteTimeout
+	}
+	return self.ReadWriteTimeout
+}
+
+// setReadDeadline 只设置读方向的deadline, 不影响另一个goroutine中的写入
+func (self *conn) setReadDeadline() {
+	self.netconn.SetReadDeadline(time.Now().Add(self.opts.readTimeout()))
+}
+
+func (self *conn) setWriteDeadline() {
+	self.netconn.SetWriteDeadline(time.Now().Add(self.opts.writeTimeout()))
+}
+
+// setIdleDeadline 等待下一个chunk时的读超时, 设置了IdleTimeout时按IdleTimeout等待, 期间由keep-alive发送ping
+func (self *conn) setIdleDeadline() {
+	if self.opts.IdleTimeout > 0 {
+		self.netconn.SetReadDeadline(time.Now().Add(self.opts.IdleTimeout))
+		return
+	}
+	self.setReadDeadline()
+}
+
+func (self *conn) touchRx() {
+	if self.keepalive != nil {
+		atomic.StoreInt64(&self.keepalive.lastRx, time.Now().UnixNano())
+	}
+}
+
+// idleExpired 开启keep-alive且超过IdleTimeout没有收到数据
+func (self *conn) idleExpired() bool {
+	if self.keepalive == nil {
+		return false
+	}
+	return time.Since(time.Unix(0, atomic.LoadInt64(&self.keepalive.lastRx))) > self.opts.IdleTimeout
+}
+
+// startKeepAlive 握手完成后开始空闲检测
+func (self *conn) startKeepAlive() {
+	if self.keepalive == nil {
+		return
+	}
+	self.keepalive.start = time.Now()
+	self.touchRx()
+	if l := self.opts.EventLoop; l != nil {
+		self.keepalive.task = l.Every(self.opts.IdleTimeout/3, self.keepAliveTick)
+		return
+	}
+	go self.runKeepAlive()
+}
+
+func (self *conn) stopKeepAlive() {
+	if ka := self.keepalive; ka != nil {
+		ka.stop.Do(func() {
+			close(ka.done)
+			if ka.task != nil {
+				ka.task.Stop()
+			}
+		})
+	}
+}
+
+// keepAliveTick EventLoop中的保活检查, 不能阻塞Loop: 有其它goroutine正在写入时连接不空闲, 跳过这一次
+func (self *conn) keepAliveTick() {
+	if !self.wlock.TryLock() {
+		return
+	}
+	err := self.pingIfIdle(self.opts.IdleTimeout / 3)
+	self.wlock.Unlock()
+	if err != nil {
+		log.Debug().Err(err).Str("remote", self.RemoteAddr()).Msg("[rtmp] keep-alive ping failed")
+		self.keepalive.task.Stop()
+	}
+}
+
+// pingIfIdle 超过interval没有收到数据时发送PingRequest, 调用方持有wlock
+func (self *conn) pingIfIdle(interval time.Duration) (err error) {
+	ka := self.keepalive
+	if time.Since(time.Unix(0, atomic.LoadInt64(&ka.lastRx))) < interval {
+		return
+	}
+	if err = self.writePing(eventtypePingRequest, uint32(time.Since(ka.start)/time.Millisecond)); err == nil {
+		err = self.flushWrite()
+	}
+	return
+}
+
+// runKeepAlive 超过IdleTimeout/3没有收到数据时发送PingRequest, 直到连接关闭或写入失败
+func (self *conn) runKeepAlive() {
+	ka := self.keepalive
+	interval := self.opts.IdleTimeout / 3
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			self.wlock.Lock()
+			err := self.pingIfIdle(interval)
+			self.wlock.Unlock()
+			if err != nil {
+				log.Debug().Err(err).Str("remote", self.RemoteAddr()).Msg("[rtmp] keep-alive ping failed")
+				return
+			}
+		case <-ka.done:
+			return
+		}
+	}
+}
+
+// replyPing 读路径中回复PingResponse
+func (self *conn) replyPing(timestamp uint32) (err error) {
+	if self.lockedRead {
+		self.wlock.Lock()
+		defer self.wlock.Unlock()
+	}
+	if err = self.writePing(eventtypePingResponse, timestamp); err != nil {
+		return
+	}
+	return self.flushWrite()
+}
+
+func (self *conn) writePing(eventtype uint16, timestamp uint32) (err error) {
+	b := self.tmpwbuf(chunkHeaderLength + 6)
+	n := self.fillChunkHeader(b, 2, 0, msgtypeidUserControl, 0, 6)
+	pio.PutU16BE(b[n:], eventtype)
+	n += 2
+	pio.PutU32BE(b[n:], timestamp)
+	n += 4
+	self.setWriteDeadline()
+	if _, err = self.bufw.Write(b[:n]); err != nil {
+		err = fmt.Errorf("writePing: %s", err.Error())
+		return
+	}
+	self.debug("send ping headertype=0 csid=2 ts=0 msglen=6 msgtypeid=%d eventtype=%d timestamp=%d", msgtypeidUserControl, eventtype, timestamp)
+	return
+}
@@ -0,0 +1,54 @@
+package rtmp
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeepAlivePing(t *testing.T) {
+	pa, pb := net.Pipe()
+	a, b := newConn(pa, WithTimeouts(0, 0, 90*time.Millisecond)), newConn(pb)
+	defer a.Close()
+	defer b.Close()
+	// b只读取并自动回复PingResponse
+	go func() {
+		for b.pollMsg() == nil {
+		}
+	}()
+	a.startKeepAlive()
+	start := time.Now()
+	for {
+		require.Nil(t, a.pollMsg())
+		if a.msgtypeid == msgtypeidUserControl && a.eventtype == eventtypePingResponse {
+			break
+		}
+	}
+	require.True(t, time.Since(start) >= 30*time.Millisecond)
+	require.False(t, a.idleExpired())
+}
+
+func TestIdleTimeout(t *testing.T) {
+	pa, pb := net.Pipe()
+	a := newConn(pa, WithTimeouts(0, 0, 60*time.Millisecond))
+	defer a.Close()
+	defer pb.Close()
+	// 对端不回复, 等待下一个chunk最多IdleTimeout
+	start := time.Now()
+	err := a.pollMsg()
+	require.NotNil(t, err)
+	require.True(t, strings.Contains(err.Error(), "timeout"))
+	require.True(t, time.Since(start) < time.Second)
+}
+
+func TestTimeoutFallback(t *testing.T) {
+	opts := NewOptions()
+	require.Equal(t, opts.ReadWriteTimeout, opts.readTimeout())
+	require.Equal(t, opts.ReadWriteTimeout, opts.writeTimeout())
+	WithTimeouts(time.Second, 2*time.Second, 0)(&opts)
+	require.Equal(t, time.Second, opts.readTimeout())
+	require.Equal(t, 2*time.Second, opts.writeTimeout())
+}
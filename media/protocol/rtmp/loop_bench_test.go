@@ -0,0 +1,87 @@
+package rtmp
+
+import (
+	"net"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bugVanisher/streamer/utils/loop"
+)
+
+// go test -run xxx -bench ConnGoroutines, 每个连接开启保活和统计回调时额外的goroutine数:
+//
+//	BenchmarkConnGoroutines/goroutine  goroutines/conn=2  (保活和统计各一个goroutine)
+//	BenchmarkConnGoroutines/loop       goroutines/conn=0  (共享一个Loop)
+//
+// 读写各自的goroutine由调用方决定, 不计入. 1万路拉流时goroutine少2万个, 每个goroutine的栈至少2KB
+func BenchmarkConnGoroutines(b *testing.B) {
+	const conns = 1000
+	for _, mode := range []string{"goroutine", "loop"} {
+		mode := mode
+		b.Run(mode, func(b *testing.B) {
+			var l *loop.Loop
+			if mode == "loop" {
+				l = loop.New()
+				defer l.Close()
+			}
+			for i := 0; i < b.N; i++ {
+				sink := MetricsSinkFunc(func(m Metrics) {})
+				opts := []Option{WithTimeouts(0, 0, time.Minute), WithMetricsSink(sink, time.Minute)}
+				if l != nil {
+					opts = append(opts, WithEventLoop(l))
+				}
+				before := runtime.NumGoroutine()
+
+				all := make([]*conn, 0, conns)
+				for j := 0; j < conns; j++ {
+					pa, _ := net.Pipe()
+					c := newConn(pa, opts...)
+					c.startKeepAlive()
+					all = append(all, c)
+				}
+				b.ReportMetric(float64(runtime.NumGoroutine()-before)/conns, "goroutines/conn")
+				for _, c := range all {
+					c.Close()
+				}
+			}
+		})
+	}
+}
+
+func TestEventLoopConn(t *testing.T) {
+	l := loop.New()
+	defer l.Close()
+	got := make(chan Metrics, 1)
+	pa, pb := net.Pipe()
+	a := newConn(pa, WithTimeouts(0, 0, 90*time.Millisecond), WithEventLoop(l), WithMetricsSink(MetricsSinkFunc(func(m Metrics) {
+		select {
+		case got <- m:
+		default:
+		}
+	}), time.Hour))
+	b := newConn(pb)
+	defer b.Close()
+	go func() {
+		for b.pollMsg() == nil {
+		}
+	}()
+
+	// 保活ping和统计回调都在Loop中, 连接不启动额外的goroutine
+	before := runtime.NumGoroutine()
+	a.startKeepAlive()
+	require.Equal(t, before, runtime.NumGoroutine())
+	require.Equal(t, 2, l.Len())
+	for {
+		require.Nil(t, a.pollMsg())
+		if a.msgtypeid == msgtypeidUserControl && a.eventtype == eventtypePingResponse {
+			break
+		}
+	}
+
+	require.Nil(t, a.Close())
+	require.Equal(t, uint64(1), (<-got).MsgCount[msgtypeidUserControl])
+	require.Equal(t, 0, l.Len())
+}
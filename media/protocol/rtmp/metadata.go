@@ -0,0 +1,50 @@
+package rtmp
+
+import (
+	"github.com/bugVanisher/streamer/media/av"
+	"github.com/bugVanisher/streamer/media/container/flv"
+	"github.com/bugVanisher/streamer/media/container/flv/flvio"
+)
+
+// Metadata 实现av.MetadataReader, 返回推流端最近一次发送的onMetaData, 没有收到时为nil
+func (self *conn) Metadata() map[string]interface{} {
+	return self.metadata
+}
+
+// SetMetadata 实现av.MetadataWriter, 保存源流的onMetaData, 开启MetadataPassThrough时之后的WriteHeader原样发送
+func (self *conn) SetMetadata(metadata map[string]interface{}) {
+	self.outmetadata = metadata
+}
+
+// headerMetadata WriteHeader发送的onMetaData: 透传的源流onMetaData或由CodecData生成, 再合并Options.Metadata中的字段
+func (self *conn) headerMetadata(streams []av.CodecData, src flvio.AMFMap) (metadata flvio.AMFMap, err error) {
+	if self.opts.MetadataPassThrough && len(src) > 0 {
+		metadata = make(flvio.AMFMap, len(src)+len(self.opts.Metadata))
+		for k, v := range src {
+			metadata[k] = v
+		}
+	} else if metadata, err = flv.NewMetadataByStreams(streams); err != nil {
+		return
+	}
+	for k, v := range self.opts.Metadata {
+		metadata[k] = v
+	}
+	return
+}
+
+// parseMetadata 从数据消息中取出onMetaData, 兼容推流端发送的@setDataFrame
+func parseMetadata(vals []interface{}) (metadata flvio.AMFMap, ok bool) {
+	if len(vals) > 0 && vals[0] == "@setDataFrame" {
+		vals = vals[1:]
+	}
+	if len(vals) < 2 || vals[0] != "onMetaData" {
+		return
+	}
+	switch m := vals[1].(type) {
+	case flvio.AMFMap:
+		return m, true
+	case flvio.AMFECMAArray:
+		return flvio.AMFMap(m), true
+	}
+	return
+}
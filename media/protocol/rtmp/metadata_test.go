@@ -0,0 +1,79 @@
+package rtmp
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bugVanisher/streamer/media/av"
+	"github.com/bugVanisher/streamer/media/codec/aacparser"
+	"github.com/bugVanisher/streamer/media/container/flv/flvio"
+)
+
+func TestHeaderMetadata(t *testing.T) {
+	aac, err := aacparser.NewCodecDataFromMPEG4AudioConfigBytes([]byte{0x12, 0x10})
+	require.Nil(t, err)
+	streams := []av.CodecData{aac}
+	src := flvio.AMFMap{"encoder": "obs", "videodatarate": 2500.0}
+
+	c := newConn(nil, WithMetadata(flvio.AMFMap{"author": "qa", "encoder": "streamer"}))
+	c.SetMetadata(src)
+	metadata, err := c.headerMetadata(streams, src)
+	require.Nil(t, err)
+	require.Equal(t, flvio.SOUND_AAC, metadata["audiocodecid"])
+	require.Equal(t, "streamer", metadata["encoder"])
+	require.Equal(t, "qa", metadata["author"])
+	require.Nil(t, metadata["videodatarate"])
+
+	c.opts.MetadataPassThrough = true
+	metadata, err = c.headerMetadata(streams, src)
+	require.Nil(t, err)
+	require.Equal(t, flvio.AMFMap{"encoder": "streamer", "author": "qa", "videodatarate": 2500.0}, metadata)
+	// 源流的onMetaData不被修改
+	require.Equal(t, "obs", src["encoder"])
+
+	// 源流没有onMetaData时仍由CodecData生成
+	metadata, err = c.headerMetadata(streams, nil)
+	require.Nil(t, err)
+	require.Equal(t, flvio.SOUND_AAC, metadata["audiocodecid"])
+}
+
+func TestReadMetadata(t *testing.T) {
+	wc, rc := net.Pipe()
+	w, r := newConn(wc), newConn(rc)
+	defer w.Close()
+	defer r.Close()
+	go func() {
+		w.wlock.Lock()
+		w.writeDataMsg(5, 1, "@setDataFrame", "onMetaData", flvio.AMFECMAArray{"width": 1280.0, "encoder": "obs"})
+		w.flushWrite()
+		w.wlock.Unlock()
+	}()
+	require.Nil(t, r.pollMsg())
+	require.Equal(t, map[string]interface{}(flvio.AMFMap{"width": 1280.0, "encoder": "obs"}), r.Metadata())
+
+	_, ok := parseMetadata([]interface{}{"onTextData", flvio.AMFMap{}})
+	require.False(t, ok)
+}
+
+func TestScriptDataHeaderChange(t *testing.T) {
+	for _, enable := range []bool{true, false} {
+		wc, rc := net.Pipe()
+		w, r := newConn(wc), newConn(rc, WithScriptDataHeaderChange(enable))
+		r.stage = stageCodecDataDone
+		go func() {
+			w.wlock.Lock()
+			w.writeDataMsg(5, 1, "@setDataFrame", "onMetaData", flvio.AMFECMAArray{"width": 1280.0})
+			w.flushWrite()
+			w.wlock.Unlock()
+		}()
+		pkt, err := r.ReadPacket()
+		require.Nil(t, err)
+		require.True(t, pkt.IsScriptData())
+		require.True(t, pkt.MetadataUpdated)
+		require.Equal(t, enable, pkt.HeaderChanged)
+		w.Close()
+		r.Close()
+	}
+}
@@ -0,0 +1,135 @@
+package rtmp
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bugVanisher/streamer/utils/loop"
+)
+
+// DefaultMetricsInterval 未指定间隔时MetricsSink的回调间隔
+const DefaultMetricsInterval = 10 * time.Second
+
+// Metrics 连接的累计统计
+type Metrics struct {
+	Remote          string
+	TxBytes         uint64           // 已发送的网络字节数
+	RxBytes         uint64           // 已接收的网络字节数
+	ChunksRead      uint64           // 已读取的chunk数
+	AcksSent        uint64           // 已发送的Acknowledgement数
+	MsgCount        map[uint8]uint64 // 按消息类型(msgtypeid)统计的已接收消息数
+	LastRxTimestamp uint32           // 最后接收的音视频消息时间戳, 毫秒
+	LastTxTimestamp uint32           // 最后发送的音视频消息时间戳, 毫秒
+	SendQueueLen    int              // 发送队列中等待发送的项数
+	DroppedFrames   uint64           // 发送队列满时丢弃的音视频帧数
+	PeerChunkSize   uint32           // 对端通过SetChunkSize声明的chunk大小, 未声明时为0
+	ReadBufferSize  int              // 当前的读缓存大小, 随接收速率扩大
+	ReadBufferGrows int              // 读缓存扩大的次数
+	RxThroughput    int64            // 最近一秒的接收速率, 字节/秒
+}
+
+// MetricsSink 连接定期回调统计, 连接关闭时再回调一次. 在独立goroutine或EventLoop中调用, 不应阻塞
+type MetricsSink interface {
+	OnMetrics(m Metrics)
+}
+
+// MetricsSinkFunc 函数形式的MetricsSink
+type MetricsSinkFunc func(m Metrics)
+
+func (f MetricsSinkFunc) OnMetrics(m Metrics) {
+	f(m)
+}
+
+// connMetrics 读写goroutine更新的计数, 全部原子操作
+type connMetrics struct {
+	chunksRead      uint64
+	acksSent        uint64
+	msgCount        [32]uint64
+	lastRxTimestamp uint32
+	lastTxTimestamp uint32
+	peerChunkSize   uint32
+
+	remote string
+	done   chan struct{}
+	stop   sync.Once
+	task   *loop.Task // 使用EventLoop时的定时回调
+}
+
+func (self *conn) countMsg(msgtypeid uint8, timestamp uint32) {
+	if int(msgtypeid) < len(self.metrics.msgCount) {
+		atomic.AddUint64(&self.metrics.msgCount[msgtypeid], 1)
+	}
+	if msgtypeid == msgtypeidAudioMsg || msgtypeid == msgtypeidVideoMsg {
+		atomic.StoreUint32(&self.metrics.lastRxTimestamp, timestamp)
+	}
+}
+
+// Metrics 当前的累计统计
+func (self *conn) Metrics() Metrics {
+	m := Metrics{
+		Remote:          self.metrics.remote,
+		TxBytes:         self.TxBytes(),
+		RxBytes:         self.RxBytes(),
+		ChunksRead:      atomic.LoadUint64(&self.metrics.chunksRead),
+		AcksSent:        atomic.LoadUint64(&self.metrics.acksSent),
+		MsgCount:        map[uint8]uint64{},
+		LastRxTimestamp: atomic.LoadUint32(&self.metrics.lastRxTimestamp),
+		LastTxTimestamp: atomic.LoadUint32(&self.metrics.lastTxTimestamp),
+		PeerChunkSize:   atomic.LoadUint32(&self.metrics.peerChunkSize),
+	}
+	if self.bufr != nil {
+		st := self.bufr.Stats()
+		m.ReadBufferSize, m.ReadBufferGrows, m.RxThroughput = st.Size, st.Grows, st.Throughput
+	}
+	if self.sendq != nil {
+		m.SendQueueLen = self.sendq.len()
+		m.DroppedFrames = atomic.LoadUint64(&self.sendq.dropped)
+	}
+	for i := range self.metrics.msgCount {
+		if n := atomic.LoadUint64(&self.metrics.msgCount[i]); n > 0 {
+			m.MsgCount[uint8(i)] = n
+		}
+	}
+	return m
+}
+
+func (self *conn) stopMetrics() {
+	if self.metrics.done != nil {
+		self.metrics.stop.Do(func() {
+			close(self.metrics.done)
+			if self.metrics.task != nil {
+				// 最后一次回调同样在Loop中执行
+				self.metrics.task.Stop()
+				self.opts.EventLoop.After(0, func() { self.opts.MetricsSink.OnMetrics(self.Metrics()) })
+			}
+		})
+	}
+}
+
+// startMetrics 按间隔回调MetricsSink, 设置了EventLoop时在Loop中回调, 否则启动独立goroutine
+func (self *conn) startMetrics(sink MetricsSink, interval time.Duration) {
+	if interval <= 0 {
+		interval = DefaultMetricsInterval
+	}
+	if l := self.opts.EventLoop; l != nil {
+		self.metrics.task = l.Every(interval, func() { sink.OnMetrics(self.Metrics()) })
+		return
+	}
+	go self.reportMetrics(sink, interval)
+}
+
+// reportMetrics 按间隔回调MetricsSink直到连接关闭
+func (self *conn) reportMetrics(sink MetricsSink, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			sink.OnMetrics(self.Metrics())
+		case <-self.metrics.done:
+			sink.OnMetrics(self.Metrics())
+			return
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package rtmp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetricsSink(t *testing.T) {
+	got := make(chan Metrics, 1)
+	c := newConn(nil, WithMetricsSink(MetricsSinkFunc(func(m Metrics) {
+		select {
+		case got <- m:
+		default:
+		}
+	}), 0))
+
+	require.Nil(t, c.handleMsg(40, 1, msgtypeidAudioMsg, []byte{0xaf, 1, 2}))
+	require.Nil(t, c.handleMsg(80, 1, msgtypeidVideoMsg, []byte{0x27, 1, 0, 0, 0, 3}))
+	require.Nil(t, c.Close())
+	require.Nil(t, c.Close())
+
+	// 关闭时回调最后一次
+	m := <-got
+	require.Equal(t, map[uint8]uint64{msgtypeidAudioMsg: 1, msgtypeidVideoMsg: 1}, m.MsgCount)
+	require.Equal(t, uint32(80), m.LastRxTimestamp)
+	require.Equal(t, 4*1024, m.ReadBufferSize)
+	require.Equal(t, 0, m.ReadBufferGrows)
+}
@@ -50,6 +50,20 @@ func (mr *MockConnMockRecorder) Close() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Close", reflect.TypeOf((*MockConn)(nil).Close))
 }
 
+// ConnectCreateStream mocks base method.
+func (m *MockConn) ConnectCreateStream() error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ConnectCreateStream")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ConnectCreateStream indicates an expected call of ConnectCreateStream.
+func (mr *MockConnMockRecorder) ConnectCreateStream() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ConnectCreateStream", reflect.TypeOf((*MockConn)(nil).ConnectCreateStream))
+}
+
 // ConnectPlay mocks base method.
 func (m *MockConn) ConnectPlay() error {
 	m.ctrl.T.Helper()
@@ -78,6 +92,35 @@ func (mr *MockConnMockRecorder) ConnectPublish() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ConnectPublish", reflect.TypeOf((*MockConn)(nil).ConnectPublish))
 }
 
+// CreateStream mocks base method.
+func (m *MockConn) CreateStream() (*Stream, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateStream")
+	ret0, _ := ret[0].(*Stream)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateStream indicates an expected call of CreateStream.
+func (mr *MockConnMockRecorder) CreateStream() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateStream", reflect.TypeOf((*MockConn)(nil).CreateStream))
+}
+
+// Debuger mocks base method.
+func (m *MockConn) Debuger() *Debuger {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Debuger")
+	ret0, _ := ret[0].(*Debuger)
+	return ret0
+}
+
+// Debuger indicates an expected call of Debuger.
+func (mr *MockConnMockRecorder) Debuger() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Debuger", reflect.TypeOf((*MockConn)(nil).Debuger))
+}
+
 // HandshakeClient mocks base method.
 func (m *MockConn) HandshakeClient() error {
 	m.ctrl.T.Helper()
@@ -149,6 +192,20 @@ func (mr *MockConnMockRecorder) OnStatus(msg interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "OnStatus", reflect.TypeOf((*MockConn)(nil).OnStatus), msg)
 }
 
+// Publish mocks base method.
+func (m *MockConn) Publish() error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Publish")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Publish indicates an expected call of Publish.
+func (mr *MockConnMockRecorder) Publish() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Publish", reflect.TypeOf((*MockConn)(nil).Publish))
+}
+
 // ReadConnect mocks base method.
 func (m *MockConn) ReadConnect() error {
 	m.ctrl.T.Helper()
@@ -192,6 +249,62 @@ func (mr *MockConnMockRecorder) RemoteAddr() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RemoteAddr", reflect.TypeOf((*MockConn)(nil).RemoteAddr))
 }
 
+// Metrics mocks base method.
+func (m *MockConn) Metrics() Metrics {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Metrics")
+	ret0, _ := ret[0].(Metrics)
+	return ret0
+}
+
+// Metrics indicates an expected call of Metrics.
+func (mr *MockConnMockRecorder) Metrics() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Metrics", reflect.TypeOf((*MockConn)(nil).Metrics))
+}
+
+// RxBytes mocks base method.
+func (m *MockConn) RxBytes() uint64 {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RxBytes")
+	ret0, _ := ret[0].(uint64)
+	return ret0
+}
+
+// RxBytes indicates an expected call of RxBytes.
+func (mr *MockConnMockRecorder) RxBytes() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RxBytes", reflect.TypeOf((*MockConn)(nil).RxBytes))
+}
+
+// ServePlayControl mocks base method.
+func (m *MockConn) ServePlayControl(arg0 func(PlayControl) error) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ServePlayControl", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ServePlayControl indicates an expected call of ServePlayControl.
+func (mr *MockConnMockRecorder) ServePlayControl(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ServePlayControl", reflect.TypeOf((*MockConn)(nil).ServePlayControl), arg0)
+}
+
+// TxBytes mocks base method.
+func (m *MockConn) TxBytes() uint64 {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "TxBytes")
+	ret0, _ := ret[0].(uint64)
+	return ret0
+}
+
+// TxBytes indicates an expected call of TxBytes.
+func (mr *MockConnMockRecorder) TxBytes() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TxBytes", reflect.TypeOf((*MockConn)(nil).TxBytes))
+}
+
 // VideoResolution mocks base method.
 func (m *MockConn) VideoResolution() (uint32, uint32) {
 	m.ctrl.T.Helper()
@@ -0,0 +1,144 @@
+package rtmp
+
+import (
+	"sync"
+	"time"
+
+	"github.com/bugVanisher/streamer/media/av"
+	"github.com/bugVanisher/streamer/statistics"
+	"github.com/bugVanisher/streamer/utils/loop"
+)
+
+// sessionMonitor 服务端会话和Relay的流统计, 推流会话统计收到的packet, 拉流会话统计发出的packet.
+// 每个统计周期在loop.Default()中计算一次StreamHandler, 更新健康分并检查告警
+type sessionMonitor struct {
+	lock    sync.Mutex
+	flow    *statistics.AVFlow
+	health  *statistics.Health
+	alerter *statistics.Alerter // 可选
+	width   uint32
+	height  uint32
+	task    *loop.Task
+
+	// overhead 连接的网络字节数相对packet负载的开销, wire为空时不统计
+	overhead *statistics.Overhead
+	wire     func() uint64
+	percent  float64
+}
+
+func newSessionMonitor() *sessionMonitor {
+	return &sessionMonitor{
+		flow:     statistics.NewAVFlow(),
+		health:   statistics.NewHealth(statistics.DefaultHealthWindow),
+		overhead: statistics.NewOverhead("rtmp"),
+	}
+}
+
+// setWire 在start之前设置连接的网络字节计数, 推流会话为接收的字节数, 拉流会话为发送的字节数
+func (m *sessionMonitor) setWire(wire func() uint64) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.wire = wire
+}
+
+// setAlerter 在start之前设置告警规则
+func (m *sessionMonitor) setAlerter(a *statistics.Alerter) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.alerter = a
+}
+
+// start 每隔interval统计一次, 直到stop
+func (m *sessionMonitor) start(interval time.Duration) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.task == nil {
+		m.task = loop.Default().Every(interval, m.tick)
+	}
+}
+
+func (m *sessionMonitor) stop() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.task != nil {
+		m.task.Stop()
+	}
+}
+
+// setCodecData 用作Transport的AfterReadHeaders
+func (m *sessionMonitor) setCodecData(streams []av.CodecData) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.flow.SetCodecData(streams)
+	for _, stream := range streams {
+		if v, ok := stream.(av.VideoCodecData); ok {
+			m.width, m.height = uint32(v.Width()), uint32(v.Height())
+		}
+	}
+	return nil
+}
+
+// stat 用作Transport的AfterReadPacket
+func (m *sessionMonitor) stat(pkt *av.Packet) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.flow.Stat(pkt)
+	m.overhead.AddMedia(uint64(len(pkt.Data)))
+	return nil
+}
+
+// tick 计算一个统计周期的数据, 更新健康分并检查告警. 告警回调在释放锁之后执行
+func (m *sessionMonitor) tick() {
+	m.lock.Lock()
+	sh := statistics.StreamHandler{
+		VideoBitrate:  m.flow.VideoBitrate.GetBitrate(),
+		VideoFPS:      m.flow.VideoFPS.GetFPS(),
+		AudioFPS:      m.flow.AudioFPS.GetFPS(),
+		VideoGop:      m.flow.VideoGop.GetGop(),
+		VideoDuration: m.flow.VideoDuration.GetDuration(),
+		AudioDuration: m.flow.AudioDuration.GetDuration(),
+		AudioBitrate:  m.flow.AudioBitrate.GetBitrate(),
+		VideoWidth:    m.width,
+		VideoHeight:   m.height,
+		VideoDelay:    m.flow.VideoDelay.GetDelay(),
+		Proto:         m.overhead.Proto,
+		LostRefFrames: m.flow.VideoRefFrame.GetLost(),
+		ReorderErrors: m.flow.VideoRefFrame.GetReorderErrors(),
+
+		DeclaredBitrate: m.flow.VideoVBV.GetDeclaredBitrate(),
+		VBVViolations:   m.flow.VideoVBV.GetViolations(),
+	}
+	if m.wire != nil {
+		m.overhead.SetWire(m.wire())
+		sh.WireBytes, sh.MediaBytes = m.overhead.WireBytes(), m.overhead.MediaBytes()
+		sh.Overhead = m.overhead.GetOverhead()
+		m.percent = sh.Overhead
+	}
+	m.health.Add(sh)
+	sh.Health = m.health.Score()
+	alerter := m.alerter
+	m.lock.Unlock()
+	if alerter != nil {
+		alerter.Check(&sh, time.Now())
+	}
+}
+
+// score 当前的健康分, 还没有统计周期时为100
+func (m *sessionMonitor) score() int {
+	return m.health.Score()
+}
+
+// overheadPercent 最近一个统计周期的协议开销百分比
+func (m *sessionMonitor) overheadPercent() float64 {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.percent
+}
+
+// degraded 是否有告警正在触发
+func (m *sessionMonitor) degraded() bool {
+	m.lock.Lock()
+	alerter := m.alerter
+	m.lock.Unlock()
+	return alerter != nil && alerter.Degraded()
+}
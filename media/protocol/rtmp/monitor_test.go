@@ -0,0 +1,103 @@
+package rtmp
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bugVanisher/streamer/media/av"
+	"github.com/bugVanisher/streamer/statistics"
+)
+
+func TestSessionMonitor(t *testing.T) {
+	m := newSessionMonitor()
+	require.Equal(t, 100, m.score())
+	// 没有收到packet的周期按卡顿和时长漂移扣分
+	for i := 0; i < 3; i++ {
+		m.tick()
+	}
+	require.Equal(t, 60, m.score())
+}
+
+func TestSessionMonitorOverhead(t *testing.T) {
+	m := newSessionMonitor()
+	var wire uint64
+	m.setWire(func() uint64 { return wire })
+	require.Nil(t, m.stat(&av.Packet{DataType: int8(av.FLV_TAG_VIDEO), AVCPacketType: av.AVC_NALU, Data: make([]byte, 900)}))
+	wire = 1000
+	m.tick()
+	require.InDelta(t, 10, m.overheadPercent(), 0.01)
+
+	// 只统计一个周期内的增量
+	require.Nil(t, m.stat(&av.Packet{DataType: int8(av.FLV_TAG_AUDIO), Data: make([]byte, 1500)}))
+	wire += 2000
+	m.tick()
+	require.InDelta(t, 25, m.overheadPercent(), 0.01)
+}
+
+func TestServerSessionHealth(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	s := NewServer("")
+	s.statInterval = 10 * time.Millisecond
+	go s.Serve(l)
+	defer s.Close()
+
+	pub, err := Dial(l.Addr().String(), WithTcURL("rtmp://"+l.Addr().String()+"/live/health"))
+	require.Nil(t, err)
+	defer pub.Close()
+	require.Nil(t, pub.HandshakeClient())
+	require.Nil(t, pub.ConnectPublish())
+
+	// 推流端不发送数据, 健康分随卡顿的统计周期下降
+	for i := 0; i < 200; i++ {
+		sessions := s.Sessions()
+		if len(sessions) == 1 && sessions[0].Health < 100 {
+			require.True(t, sessions[0].Publishing)
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("session health not updated")
+}
+
+func TestServerSessionDegraded(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	rule, err := statistics.ParseAlertRule("fps<1")
+	require.Nil(t, err)
+	alerts := make(chan string, 1)
+	s := NewServer("")
+	s.statInterval = 10 * time.Millisecond
+	s.AlertRules = []statistics.AlertRule{rule}
+	s.OnAlert = func(id string, e statistics.AlertEvent) {
+		if e.Firing {
+			select {
+			case alerts <- id:
+			default:
+			}
+		}
+	}
+	go s.Serve(l)
+	defer s.Close()
+
+	pub, err := Dial(l.Addr().String(), WithTcURL("rtmp://"+l.Addr().String()+"/live/degraded"))
+	require.Nil(t, err)
+	defer pub.Close()
+	require.Nil(t, pub.HandshakeClient())
+	require.Nil(t, pub.ConnectPublish())
+
+	// 推流端不发送数据, 帧率为0触发告警
+	var id string
+	select {
+	case id = <-alerts:
+	case <-time.After(2 * time.Second):
+		t.Fatal("alert not fired")
+	}
+	sessions := s.Sessions()
+	require.Len(t, sessions, 1)
+	require.Equal(t, sessions[0].ID, id)
+	require.True(t, sessions[0].Degraded)
+}
@@ -1,6 +1,16 @@
 package rtmp
 
-import "time"
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/bugVanisher/streamer/media/container/flv/flvio"
+	"github.com/bugVanisher/streamer/utils/adaptive"
+	"github.com/bugVanisher/streamer/utils/loop"
+)
 
 var DefaultOptions = NewOptions()
 
@@ -17,6 +27,59 @@ type Options struct {
 	VideoHeaderCheck bool
 	Hook             Hook
 	TcURL            string
+	Journal          *Journal
+	TLSConfig        *tls.Config // 不为空或tcUrl为rtmps://时使用TLS建连, rtmpts://时用于https
+	SimpleHandshake  bool        // 客户端使用不带digest的简单握手
+	AuthUser         string      // 客户端Adobe认证(authmod=adobe)的用户名, 也可以写在tcUrl的userinfo中
+	AuthPassword     string
+	TokenSigner      TokenSigner   // 不为空时给publish/play的流名追加鉴权参数
+	PaceRate         int64         // 大于0时按该速率(字节/秒)发送音视频消息, 模拟受限的上行带宽
+	PaceBurst        int64         // 令牌桶容量(字节), 0时等于PaceRate
+	FlushBytes       int           // 大于0时音视频消息累计到该字节数就发送, 大于WriteBufferSize时写缓冲扩大到该值
+	FlushInterval    time.Duration // 大于0时音视频消息写入后最多等待该时长发送. 都为0时只在写缓冲满时发送
+	MetricsSink      MetricsSink   // 不为空时每个连接按MetricsInterval回调统计
+	MetricsInterval  time.Duration
+	// StreamHandler 不为空时, 服务端接受同一连接上主流之外的publish, 每路新流在独立goroutine中回调
+	StreamHandler func(s *Stream)
+	// SendQueueSize 大于0时音视频写入先放入该长度的队列, 由独立goroutine发送, 队列满时按SendQueuePolicy处理
+	SendQueueSize   int
+	SendQueuePolicy SendQueuePolicy
+	// LegacyChunkSize 为true时大于chunk size的音视频消息先发送SetChunkSize扩大到消息长度, 不拆分成多个chunk(旧的行为)
+	LegacyChunkSize bool
+	// Metadata 合并到WriteHeader发送的onMetaData中的字段, 如encoder, author或自定义字段, 覆盖同名字段
+	Metadata flvio.AMFMap
+	// MetadataPassThrough 为true时转推原样发送源流的onMetaData(经av.Transport传入), 源流没有时仍由CodecData生成
+	MetadataPassThrough bool
+	// ReadTimeout 读取一个chunk的超时, WriteTimeout 每次写入的超时, 为0时使用ReadWriteTimeout
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	// IdleTimeout 大于0时等待下一个chunk最多IdleTimeout, 空闲超过IdleTimeout/3发送PingRequest保活
+	IdleTimeout time.Duration
+	// CommandHandler 不为空时每收到一条命令消息先回调, 见WithCommandHandler
+	CommandHandler CommandHandler
+	// DialContext 不为空时客户端用它建立tcp连接(rtmps在其上握手TLS), 如经过NewProxyDialer创建的代理
+	DialContext DialContextFunc
+	// ClientCertificates rtmps/rtmpts客户端证书, 用于双向认证
+	ClientCertificates []tls.Certificate
+	// ALPN rtmps握手时声明的应用层协议
+	ALPN []string
+	// ScriptDataHeaderChange 为true时读到的script data包置HeaderChanged, 触发调用者重新发送header(旧的行为),
+	// 为false时只置MetadataUpdated
+	ScriptDataHeaderChange bool
+	// ParseSEI 解析H.264帧中的SEI消息和CEA-608/708字幕, 填充到av.Packet的SEI和Captions
+	ParseSEI bool
+	// Vhost 客户端connect时在tcUrl和app后带上?vhost=, 为空时使用推拉流URL中的vhost参数
+	Vhost string
+	// FlashVer 客户端connect的flashVer, 为空时使用fingerprint的全局配置
+	FlashVer string
+	// ValidateNALU 严格校验读到的H.264/H.265帧, 丢弃零长度NALU, forbidden_zero_bit为1或长度被截断的帧
+	ValidateNALU bool
+	// MaxReadBufferSize 读缓存按接收速率从ReadBufferSize自动扩大的上限, 不大于ReadBufferSize时读缓存大小固定
+	MaxReadBufferSize int
+	// RecoveryPoint 检测H.264非关键帧中的recovery point SEI, 标记packet的RecoveryPoint, 见queue.Queue.SetRecoveryPoint
+	RecoveryPoint bool
+	// EventLoop 不为空时连接的保活ping和MetricsSink回调在该Loop中执行, 不再每个连接各启动一个goroutine
+	EventLoop *loop.Loop
 }
 
 // rtmp连接的参数选项设置函数
@@ -33,6 +96,9 @@ func NewOptions() Options {
 		IsServer:         true,
 		EnableDebug:      false,
 		VideoHeaderCheck: true,
+
+		ScriptDataHeaderChange: true,
+		MaxReadBufferSize:      adaptive.DefaultMaxSize,
 	}
 }
 
@@ -50,6 +116,15 @@ func WithReadWriteTimeout(timeout time.Duration) Option {
 	}
 }
 
+// WithTimeouts 分别设置读、写超时和空闲超时, 为0的读写超时使用ReadWriteTimeout, idle为0时不发送ping
+func WithTimeouts(read, write, idle time.Duration) Option {
+	return func(opts *Options) {
+		opts.ReadTimeout = read
+		opts.WriteTimeout = write
+		opts.IdleTimeout = idle
+	}
+}
+
 // WithReadBufferSize 设置rtmp连接读缓存的大小
 func WithReadBufferSize(size int) Option {
 	return func(opts *Options) {
@@ -57,6 +132,30 @@ func WithReadBufferSize(size int) Option {
 	}
 }
 
+// WithMaxReadBufferSize 设置读缓存自动扩大的上限, 不大于ReadBufferSize时关闭自动扩大
+func WithMaxReadBufferSize(size int) Option {
+	return func(opts *Options) {
+		opts.MaxReadBufferSize = size
+	}
+}
+
+// WithRecoveryPoint 检测open GOP流中用recovery point SEI标记的随机访问点
+func WithRecoveryPoint(enabled bool) Option {
+	return func(opts *Options) {
+		opts.RecoveryPoint = enabled
+	}
+}
+
+// WithEventLoop 多个连接共享l执行保活和统计回调, 用于上万路连接的压测, l为nil时使用loop.Default()
+func WithEventLoop(l *loop.Loop) Option {
+	return func(opts *Options) {
+		if l == nil {
+			l = loop.Default()
+		}
+		opts.EventLoop = l
+	}
+}
+
 // WithWriteBufferSize 设置rtmp连接写缓存的大小
 func WithWriteBufferSize(size int) Option {
 	return func(opts *Options) {
@@ -105,3 +204,184 @@ func WithTcURL(u string) Option {
 		opts.TcURL = u
 	}
 }
+
+// WithJournal 设置会话日志, 记录收到的命令和关键事件
+func WithJournal(j *Journal) Option {
+	return func(opts *Options) {
+		opts.Journal = j
+	}
+}
+
+// WithSimpleHandshake 客户端回退到简单握手, 默认使用带digest的复杂握手
+func WithSimpleHandshake(simple bool) Option {
+	return func(opts *Options) {
+		opts.SimpleHandshake = simple
+	}
+}
+
+// WithAdobeAuth 客户端在服务端要求时使用Adobe challenge/response认证
+func WithAdobeAuth(user, password string) Option {
+	return func(opts *Options) {
+		opts.AuthUser = user
+		opts.AuthPassword = password
+	}
+}
+
+// WithTokenSigner 客户端publish/play时在流名后追加签名参数, 如AuthKeySigner
+func WithTokenSigner(signer TokenSigner) Option {
+	return func(opts *Options) {
+		opts.TokenSigner = signer
+	}
+}
+
+// WithStreamHandler 服务端支持一个连接上多路publish, handler读取每路新流直到EOF
+func WithStreamHandler(handler func(s *Stream)) Option {
+	return func(opts *Options) {
+		opts.StreamHandler = handler
+	}
+}
+
+// WithCommandHandler 每收到一条AMF命令消息先回调handler, 用于实现FCPublish/releaseStream或自定义的RPC.
+// handler返回handled为true时该命令不再按内置逻辑处理
+func WithCommandHandler(handler CommandHandler) Option {
+	return func(opts *Options) {
+		opts.CommandHandler = handler
+	}
+}
+
+// WithPacer 出方向限速, rate为字节/秒, burst为允许的突发字节数
+func WithPacer(rate, burst int64) Option {
+	return func(opts *Options) {
+		opts.PaceRate = rate
+		opts.PaceBurst = burst
+	}
+}
+
+// WithFlushStrategy 音视频消息的批量发送策略, 累计bytes字节或等待interval后发送, 减少高帧率时的系统调用
+func WithFlushStrategy(bytes int, interval time.Duration) Option {
+	return func(opts *Options) {
+		opts.FlushBytes = bytes
+		opts.FlushInterval = interval
+	}
+}
+
+// WithLegacyChunkSize 恢复旧的行为: 大于chunk size的音视频消息先发送SetChunkSize, 不按chunk size拆分
+func WithLegacyChunkSize(legacy bool) Option {
+	return func(opts *Options) {
+		opts.LegacyChunkSize = legacy
+	}
+}
+
+// WithMetadata 在onMetaData中追加或覆盖字段
+func WithMetadata(fields flvio.AMFMap) Option {
+	return func(opts *Options) {
+		opts.Metadata = fields
+	}
+}
+
+// WithScriptDataHeaderChange 设置读到script data时是否置HeaderChanged触发重新发送header, 默认为true.
+// 关闭后script data包只置MetadataUpdated, av.Transport只更新dst的onMetaData, 不再重新发送header
+func WithScriptDataHeaderChange(enable bool) Option {
+	return func(opts *Options) {
+		opts.ScriptDataHeaderChange = enable
+	}
+}
+
+// WithParseSEI 读取时解析H.264帧中的SEI消息和字幕, 默认关闭
+func WithParseSEI(enable bool) Option {
+	return func(opts *Options) {
+		opts.ParseSEI = enable
+	}
+}
+
+// WithValidateNALU 读取时严格校验H.264/H.265帧的NALU结构, 不合法的帧被丢弃并记录日志, 默认关闭
+func WithValidateNALU(enable bool) Option {
+	return func(opts *Options) {
+		opts.ValidateNALU = enable
+	}
+}
+
+// WithMetadataPassThrough 转推时透传源流的onMetaData, 不由CodecData重新生成
+func WithMetadataPassThrough(pass bool) Option {
+	return func(opts *Options) {
+		opts.MetadataPassThrough = pass
+	}
+}
+
+// WithSendQueue 拉流连接的异步发送队列, 慢速的拉流端按policy积压或丢帧, 不阻塞写入方
+func WithSendQueue(size int, policy SendQueuePolicy) Option {
+	return func(opts *Options) {
+		opts.SendQueueSize = size
+		opts.SendQueuePolicy = policy
+	}
+}
+
+// WithMetricsSink 每个连接按interval回调统计, interval为0时使用DefaultMetricsInterval
+func WithMetricsSink(sink MetricsSink, interval time.Duration) Option {
+	return func(opts *Options) {
+		opts.MetricsSink = sink
+		opts.MetricsInterval = interval
+	}
+}
+
+// WithTLSConfig 设置rtmps的TLS配置
+func WithTLSConfig(cfg *tls.Config) Option {
+	return func(opts *Options) {
+		opts.TLSConfig = cfg
+	}
+}
+
+// WithDialContext 客户端通过dial建立tcp连接, 如经过代理
+func WithDialContext(dial DialContextFunc) Option {
+	return func(opts *Options) {
+		opts.DialContext = dial
+	}
+}
+
+// WithClientCertificates rtmps握手时出示的客户端证书
+func WithClientCertificates(certs ...tls.Certificate) Option {
+	return func(opts *Options) {
+		opts.ClientCertificates = certs
+	}
+}
+
+// WithVhost 设置客户端connect的虚拟主机
+func WithVhost(vhost string) Option {
+	return func(opts *Options) {
+		opts.Vhost = vhost
+	}
+}
+
+// WithFlashVer 设置客户端connect的flashVer
+func WithFlashVer(flashVer string) Option {
+	return func(opts *Options) {
+		opts.FlashVer = flashVer
+	}
+}
+
+// WithALPN rtmps握手时声明的ALPN协议
+func WithALPN(protos ...string) Option {
+	return func(opts *Options) {
+		opts.ALPN = protos
+	}
+}
+
+// NewTLSConfig 创建rtmps客户端的TLS配置, rootCAFile为空时使用系统根证书, serverName为空时使用连接的host
+func NewTLSConfig(rootCAFile string, insecureSkipVerify bool, serverName string) (*tls.Config, error) {
+	cfg := &tls.Config{
+		InsecureSkipVerify: insecureSkipVerify,
+		ServerName:         serverName,
+	}
+	if rootCAFile != "" {
+		pem, err := os.ReadFile(rootCAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("rtmp: no certificate found in %s", rootCAFile)
+		}
+		cfg.RootCAs = pool
+	}
+	return cfg, nil
+}
@@ -0,0 +1,43 @@
+package rtmp
+
+import (
+	"time"
+)
+
+// pacer 出方向的令牌桶, 速率rate字节/秒, 最多积攒burst字节.
+// 一次写入超过剩余令牌时记为欠账并休眠到还清, 关键帧这样的大包也不会一次性突发
+type pacer struct {
+	rate   int64
+	burst  int64
+	tokens int64
+	last   time.Time
+}
+
+func newPacer(rate, burst int64) *pacer {
+	if burst <= 0 {
+		burst = rate
+	}
+	return &pacer{rate: rate, burst: burst, tokens: burst, last: time.Now()}
+}
+
+// wait 消耗n字节令牌, 不足时休眠. 调用方持有wlock
+func (self *pacer) wait(n int) {
+	if d := self.reserve(n, time.Now()); d > 0 {
+		time.Sleep(d)
+	}
+}
+
+// reserve 消耗n字节令牌, 返回还清欠账需要等待的时间
+func (self *pacer) reserve(n int, now time.Time) time.Duration {
+	// 按float64计算, 长时间空闲后int64(elapsed)*rate会溢出
+	self.tokens += int64(now.Sub(self.last).Seconds() * float64(self.rate))
+	if self.tokens > self.burst {
+		self.tokens = self.burst
+	}
+	self.last = now
+	self.tokens -= int64(n)
+	if self.tokens < 0 {
+		return time.Duration(-self.tokens * int64(time.Second) / self.rate)
+	}
+	return 0
+}
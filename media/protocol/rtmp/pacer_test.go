@@ -0,0 +1,30 @@
+package rtmp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPacer(t *testing.T) {
+	p := newPacer(1000*1000, 1000)
+	start := time.Now()
+	p.wait(1000)
+	require.True(t, time.Since(start) < 10*time.Millisecond)
+
+	// 超过burst的大包欠账休眠
+	p.wait(50 * 1000)
+	elapsed := time.Since(start)
+	require.True(t, elapsed >= 45*time.Millisecond, elapsed)
+	require.True(t, elapsed < 500*time.Millisecond, elapsed)
+}
+
+func TestPacerLongIdle(t *testing.T) {
+	// 10MB/s空闲15分钟后令牌补满到burst, 不会因溢出变成长时间欠账
+	p := newPacer(10*1000*1000, 0)
+	now := p.last
+	require.Equal(t, time.Duration(0), p.reserve(10*1000*1000, now))
+	require.Equal(t, time.Duration(0), p.reserve(1000, now.Add(15*time.Minute)))
+	require.Equal(t, int64(10*1000*1000-1000), p.tokens)
+}
@@ -0,0 +1,150 @@
+package rtmp
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/bugVanisher/streamer/media/container/flv/flvio"
+	"github.com/bugVanisher/streamer/media/protocol/common"
+)
+
+// 拉流端的NetStream控制命令
+const (
+	PlayControlPause = "pause"
+	PlayControlSeek  = "seek"
+)
+
+// PlayControl 拉流端发送的pause/seek命令
+type PlayControl struct {
+	Command string        // PlayControlPause 或 PlayControlSeek
+	Pause   bool          // pause命令: true暂停, false恢复
+	Pos     time.Duration // 暂停/恢复/seek时的流时间位置, 毫秒精度
+}
+
+func (self PlayControl) String() string {
+	if self.Command == PlayControlPause {
+		return fmt.Sprintf("pause(%v, %v)", self.Pause, self.Pos)
+	}
+	return fmt.Sprintf("seek(%v)", self.Pos)
+}
+
+// PlayControlHook 可选, Options.Hook同时实现该接口时, 拉流端每次pause/seek先回调, 返回错误时拒绝该命令
+type PlayControlHook interface {
+	OnPlayControl(info common.Info, ctl PlayControl) error
+}
+
+// ServePlayControl 服务端拉流连接上读取拉流端的命令, 直到连接出错或关闭, 收到deleteStream/closeStream时返回io.EOF.
+// 写packet在另一个goroutine中进行, pause/seek命令经Hook确认后回调handler, handler返回错误时回复失败状态.
+func (self *conn) ServePlayControl(handler func(ctl PlayControl) error) (err error) {
+	if !self.opts.IsServer || !self.playing {
+		return fmt.Errorf("rtmp: ServePlayControl must be called on a playing server conn")
+	}
+	self.wlock.Lock()
+	self.lockedRead = true
+	self.wlock.Unlock()
+
+	for {
+		// 拉流端空闲时很少发送数据, 先等待数据到达, 读超时时不会破坏chunk状态
+		self.setReadDeadline()
+		if _, err = self.bufr.Peek(1); err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				// 开启keep-alive时拉流端应回复ping, 超过IdleTimeout没有数据认为连接已断开
+				if self.idleExpired() {
+					return ErrIdleTimeout
+				}
+				continue
+			}
+			return
+		}
+		if err = self.pollMsg(); err != nil {
+			return
+		}
+		// < deleteStream/closeStream, 拉流端停止播放
+		if self.gotcommand && (self.commandname == "deleteStream" || self.commandname == "closeStream") {
+			log.Info().Str("ID", self.info.ID).Str("remote", self.RemoteAddr()).Msg("[rtmp] < " + self.commandname)
+			self.journalEvent("playStop", self.info.StreamName)
+			return io.EOF
+		}
+		if !self.gotcommand || self.msgsid != self.avmsgsid {
+			continue
+		}
+		ctl, ok := self.parsePlayControl()
+		if !ok {
+			continue
+		}
+		log.Info().Str("ID", self.info.ID).Str("remote", self.RemoteAddr()).Msg("[rtmp] < " + ctl.String())
+		self.journalEvent(ctl.Command, ctl.Pos.Milliseconds())
+
+		var cberr error
+		if hook, ok := self.opts.Hook.(PlayControlHook); ok {
+			cberr = hook.OnPlayControl(self.Info(), ctl)
+		}
+		if cberr == nil && handler != nil {
+			cberr = handler(ctl)
+		}
+		if cberr != nil {
+			log.Info().Err(cberr).Str("ID", self.info.ID).Msg("[rtmp] reject " + ctl.String())
+		}
+		if err = self.replyPlayControl(ctl, cberr); err != nil {
+			return
+		}
+	}
+}
+
+// parsePlayControl pause(null, flag, ms) / seek(null, ms)
+func (self *conn) parsePlayControl() (ctl PlayControl, ok bool) {
+	switch self.commandname {
+	case PlayControlPause:
+		if len(self.commandparams) < 1 {
+			return
+		}
+		ctl.Pause, _ = self.commandparams[0].(bool)
+		if len(self.commandparams) > 1 {
+			ms, _ := self.commandparams[1].(float64)
+			ctl.Pos = time.Duration(ms) * time.Millisecond
+		}
+	case PlayControlSeek:
+		if len(self.commandparams) < 1 {
+			return
+		}
+		ms, _ := self.commandparams[0].(float64)
+		ctl.Pos = time.Duration(ms) * time.Millisecond
+	default:
+		return
+	}
+	ctl.Command = self.commandname
+	return ctl, true
+}
+
+func (self *conn) replyPlayControl(ctl PlayControl, cberr error) (err error) {
+	self.wlock.Lock()
+	defer self.wlock.Unlock()
+
+	var status flvio.AMFMap
+	switch {
+	case cberr != nil && ctl.Command == PlayControlSeek:
+		status = AMFMapOnStatusSeekFailed
+	case cberr != nil:
+		status = AMFMapOnStatusPauseFailed
+	case ctl.Command == PlayControlSeek:
+		status = AMFMapOnStatusSeekNotify
+	case ctl.Pause:
+		status = AMFMapOnStatusPauseNotify
+	default:
+		status = AMFMapOnStatusUnpauseNotify
+	}
+	if cberr == nil && !(ctl.Command == PlayControlPause && ctl.Pause) {
+		// 恢复和seek之后数据重新开始
+		if err = self.writeStreamBegin(self.avmsgsid); err != nil {
+			return
+		}
+	}
+	if err = self.writeCommandMsg(5, self.avmsgsid, "onStatus", 0, nil, status); err != nil {
+		return
+	}
+	return self.flushWrite()
+}
@@ -0,0 +1,231 @@
+package rtmp
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bugVanisher/streamer/media/av"
+	"github.com/bugVanisher/streamer/media/container/flv/flvio"
+	"github.com/bugVanisher/streamer/media/protocol/common"
+)
+
+// rejectHook OnPlayControl在reject非0时拒绝pause/seek
+type rejectHook struct {
+	reject int32
+}
+
+func (h *rejectHook) OnPlayOrPublish(info common.Info) error { return nil }
+func (h *rejectHook) OnUnpublish(info common.Info)           {}
+func (h *rejectHook) OnPlayControl(info common.Info, ctl PlayControl) error {
+	if atomic.LoadInt32(&h.reject) != 0 {
+		return errors.New("rejected")
+	}
+	return nil
+}
+
+// playEvent 拉流端收到的onStatus或视频帧
+type playEvent struct {
+	code string
+	ms   int32
+	key  bool
+}
+
+// playControlClient 拉流端, 在另一个goroutine中读取消息, 写命令在测试goroutine中进行
+type playControlClient struct {
+	*conn
+	events chan playEvent
+	// pending 等待onStatus时收到的视频帧
+	pending []playEvent
+}
+
+func dialPlayControl(t *testing.T, addr, url string) *playControlClient {
+	nc, err := Dial(addr, WithTcURL(url))
+	require.Nil(t, err)
+	c := nc.(*conn)
+	require.Nil(t, c.HandshakeClient())
+	require.Nil(t, c.ConnectPlay())
+	p := &playControlClient{conn: c, events: make(chan playEvent, 1024)}
+	go func() {
+		defer close(p.events)
+		for {
+			if err := c.pollMsg(); err != nil {
+				return
+			}
+			switch {
+			case c.gotcommand && c.commandname == "onStatus" && len(c.commandparams) > 0:
+				status, _ := c.commandparams[0].(flvio.AMFMap)
+				code, _ := status["code"].(string)
+				p.events <- playEvent{code: code}
+			case c.msgtypeid == msgtypeidVideoMsg && c.avtag.AVCPacketType == flvio.AVC_NALU:
+				p.events <- playEvent{ms: int32(c.timestamp), key: c.avtag.FrameType == flvio.FRAME_KEY}
+			}
+		}
+	}()
+	return p
+}
+
+// waitVideo 等到时间为ms的视频帧
+func (p *playControlClient) waitVideo(t *testing.T, ms int32) {
+	for {
+		e, ok := p.nextVideo(3 * time.Second)
+		require.True(t, ok, "video at %dms not received", ms)
+		if e.ms == ms {
+			return
+		}
+	}
+}
+
+// command 发送pause/seek命令并返回onStatus的状态码. 回复之前可能已经开始发送新位置的帧, 留给nextVideo读取
+func (p *playControlClient) command(t *testing.T, name string, args ...interface{}) (code string) {
+	require.Nil(t, p.writeCommand(p.avmsgsid, name, 0, append([]interface{}{nil}, args...)...))
+	timeout := time.After(3 * time.Second)
+	for {
+		select {
+		case e, ok := <-p.events:
+			require.True(t, ok, "connection closed")
+			if e.code != "" {
+				return e.code
+			}
+			p.pending = append(p.pending, e)
+		case <-timeout:
+			t.Fatalf("no reply to %s", name)
+		}
+	}
+}
+
+// nextVideo 返回下一个视频帧, within内没有时返回false
+func (p *playControlClient) nextVideo(within time.Duration) (playEvent, bool) {
+	if len(p.pending) > 0 {
+		e := p.pending[0]
+		p.pending = p.pending[1:]
+		return e, true
+	}
+	timeout := time.After(within)
+	for {
+		select {
+		case e, ok := <-p.events:
+			if !ok {
+				return playEvent{}, false
+			}
+			if e.code == "" {
+				return e, true
+			}
+		case <-timeout:
+			return playEvent{}, false
+		}
+	}
+}
+
+// playControlServer 启动服务端并推送frames帧视频, 每10帧一个关键帧, 帧间隔40ms
+func playControlServer(t *testing.T, hook Hook) (s *Server, addr, url string, pub Conn) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	// 每条音视频消息立即发送, 便于检查pause/seek之后收到的帧
+	s = NewServer("", WithFlushStrategy(1, 0))
+	if hook != nil {
+		s.SetVhostHook(VhostAll, hook)
+	}
+	go s.Serve(l)
+	t.Cleanup(func() { s.Close() })
+	addr = l.Addr().String()
+	url = "rtmp://" + addr + "/live/playcontrol"
+
+	pub, err = Dial(addr, WithTcURL(url))
+	require.Nil(t, err)
+	t.Cleanup(func() { pub.Close() })
+	require.Nil(t, pub.HandshakeClient())
+	require.Nil(t, pub.ConnectPublish())
+	require.Nil(t, pub.WriteHeader([]av.CodecData{testH265(t)}))
+	writePlayControlFrames(t, pub, 0, 30)
+	return
+}
+
+func writePlayControlFrames(t *testing.T, pub Conn, from, to int) {
+	for i := from; i < to; i++ {
+		require.Nil(t, pub.WritePacket(av.Packet{IsKeyFrame: i%10 == 0, DataType: int8(flvio.TAG_VIDEO),
+			AVCPacketType: av.AVC_NALU, Time: av.MediaTimeFromMs(int32(i * 40)), Data: bytes.Repeat([]byte{byte(i)}, 1000)}))
+	}
+	require.Nil(t, pub.WriteTrailer())
+}
+
+func TestServePlayControl(t *testing.T) {
+	s, addr, url, pub := playControlServer(t, nil)
+	play := dialPlayControl(t, addr, url)
+	defer play.Close()
+	play.waitVideo(t, 29*40)
+
+	// 缓存内seek, 从不晚于目标的最近关键帧开始发送
+	require.Equal(t, "NetStream.Seek.Notify", play.command(t, "seek", float64(500)))
+	e, ok := play.nextVideo(3 * time.Second)
+	require.True(t, ok)
+	require.True(t, e.key)
+	require.Equal(t, int32(400), e.ms)
+	play.waitVideo(t, 29*40)
+
+	// 超出缓存的seek失败, 继续从原位置发送
+	require.Equal(t, "NetStream.Seek.Failed", play.command(t, "seek", float64(60000)))
+
+	// 暂停后不再收到视频, 已在读取中的一帧除外
+	require.Equal(t, "NetStream.Pause.Notify", play.command(t, "pause", true, float64(1160)))
+	writePlayControlFrames(t, pub, 30, 40)
+	var leaked int
+	for {
+		if _, ok := play.nextVideo(300 * time.Millisecond); !ok {
+			break
+		}
+		leaked++
+	}
+	require.True(t, leaked <= 1, "leaked %d frames while paused", leaked)
+
+	// 恢复后继续发送
+	require.Equal(t, "NetStream.Unpause.Notify", play.command(t, "pause", false, float64(1160)))
+	play.waitVideo(t, 39*40)
+	require.Len(t, s.Sessions(), 2)
+}
+
+func TestServePlayControlHookReject(t *testing.T) {
+	hook := &rejectHook{reject: 1}
+	_, addr, url, _ := playControlServer(t, hook)
+	play := dialPlayControl(t, addr, url)
+	defer play.Close()
+	play.waitVideo(t, 29*40)
+
+	// Hook拒绝时回复失败, 游标不动
+	require.Equal(t, "NetStream.Seek.Failed", play.command(t, "seek", float64(500)))
+	require.Equal(t, "NetStream.Failed", play.command(t, "pause", true, float64(1160)))
+	_, ok := play.nextVideo(200 * time.Millisecond)
+	require.False(t, ok)
+
+	atomic.StoreInt32(&hook.reject, 0)
+	require.Equal(t, "NetStream.Seek.Notify", play.command(t, "seek", float64(500)))
+	e, ok := play.nextVideo(3 * time.Second)
+	require.True(t, ok)
+	require.Equal(t, int32(400), e.ms)
+}
+
+func TestServePlayControlDisconnectWhilePaused(t *testing.T) {
+	s, addr, url, pub := playControlServer(t, nil)
+	play := dialPlayControl(t, addr, url)
+	play.waitVideo(t, 29*40)
+	require.Equal(t, "NetStream.Pause.Notify", play.command(t, "pause", true, float64(1160)))
+	// 有新帧时写packet的goroutine阻塞在暂停中
+	writePlayControlFrames(t, pub, 30, 32)
+	time.Sleep(100 * time.Millisecond)
+
+	// 暂停中断开, 阻塞在暂停中的写packet结束, 拉流会话退出
+	play.Close()
+	for i := 0; i < 200; i++ {
+		sessions := s.Sessions()
+		if len(sessions) == 1 && sessions[0].Publishing {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("play session did not end after disconnect while paused")
+}
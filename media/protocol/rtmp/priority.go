@@ -0,0 +1,196 @@
+package rtmp
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/bugVanisher/streamer/media/protocol/common"
+	"github.com/bugVanisher/streamer/statistics"
+)
+
+// Priority 拉流会话的优先级, 由拉流URL的priority参数指定, 资源紧张时先断开低优先级的会话
+type Priority int
+
+const (
+	PriorityLow Priority = iota
+	PriorityNormal
+	PriorityHigh
+)
+
+func (self Priority) String() string {
+	switch self {
+	case PriorityLow:
+		return "low"
+	case PriorityHigh:
+		return "high"
+	}
+	return "normal"
+}
+
+// ParsePriority 解析low/normal/high
+func ParsePriority(s string) (Priority, error) {
+	switch s {
+	case "low":
+		return PriorityLow, nil
+	case "", "normal":
+		return PriorityNormal, nil
+	case "high":
+		return PriorityHigh, nil
+	}
+	return PriorityNormal, fmt.Errorf("rtmp: invalid priority %q, want low, normal or high", s)
+}
+
+// playPriority 拉流URL的priority参数, 无效时为PriorityNormal
+func playPriority(info common.Info) Priority {
+	u, err := url.Parse(info.RawURL)
+	if err != nil {
+		return PriorityNormal
+	}
+	p, err := ParsePriority(u.Query().Get("priority"))
+	if err != nil {
+		log.Warn().Err(err).Str("url", info.RawURL).Msg("[rtmp] ignore invalid priority")
+	}
+	return p
+}
+
+// ShedOptions 资源紧张时按优先级断开拉流会话, 见Server.EnableShedding
+type ShedOptions struct {
+	Interval  time.Duration // 检查间隔, 0时为1秒
+	MaxCPU    float64       // 进程cpu使用率上限, 1为一个核, 0时不检查
+	MaxEgress int64         // 所有拉流会话的出口总带宽上限(字节/秒), 0时不检查
+	// OnShed 可选, 断开会话后回调
+	OnShed func(ShedEvent)
+}
+
+// ShedEvent 一次因资源紧张断开拉流会话的事件
+type ShedEvent struct {
+	Session  string        `json:"session"`
+	Key      string        `json:"key"`
+	Remote   string        `json:"remote"`
+	Priority string        `json:"priority"`
+	Reason   string        `json:"reason"` // cpu或egress
+	CPU      float64       `json:"cpu"`
+	Egress   int64         `json:"egress"`
+	Played   time.Duration `json:"played"`
+	At       time.Time     `json:"at"`
+}
+
+// shedder 资源使用率的采样状态
+type shedder struct {
+	opts      ShedOptions
+	lastAt    time.Time
+	lastCPU   time.Duration
+	lastBytes map[string]int64 // 每个拉流游标上次采样时已发送的字节数
+}
+
+// EnableShedding 开启按优先级的降级: 每个周期采样cpu和拉流出口带宽, 超过上限时断开一个最低优先级、
+// 最晚开始拉流的会话, 直到恢复. 高优先级的会话不会被断开. 在Serve之前调用, 服务端关闭后停止
+func (s *Server) EnableShedding(opts ShedOptions) {
+	if opts.Interval <= 0 {
+		opts.Interval = time.Second
+	}
+	sh := &shedder{opts: opts, lastBytes: map[string]int64{}}
+	sh.lastAt = time.Now()
+	sh.lastCPU, _ = statistics.ProcessCPUTime()
+	go func() {
+		ticker := time.NewTicker(opts.Interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			s.lock.Lock()
+			closed := s.closed
+			s.lock.Unlock()
+			if closed {
+				return
+			}
+			cpu, egress := s.sample(sh)
+			s.checkPressure(sh, cpu, egress)
+		}
+	}()
+}
+
+// sample 返回上个周期的cpu使用率和拉流出口带宽
+func (s *Server) sample(sh *shedder) (cpu float64, egress int64) {
+	now := time.Now()
+	elapsed := now.Sub(sh.lastAt)
+	if total, err := statistics.ProcessCPUTime(); err == nil {
+		if elapsed > 0 {
+			cpu = float64(total-sh.lastCPU) / float64(elapsed)
+		}
+		sh.lastCPU = total
+	}
+	sh.lastAt = now
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var sent int64
+	bytes := make(map[string]int64, len(s.subscribers))
+	for id, cursor := range s.subscribers {
+		b := cursor.Stat().Bytes
+		bytes[id] = b
+		if last, ok := sh.lastBytes[id]; ok && b > last {
+			sent += b - last
+		}
+	}
+	sh.lastBytes = bytes
+	if elapsed > 0 {
+		egress = sent * int64(time.Second) / int64(elapsed)
+	}
+	return
+}
+
+// checkPressure 超过上限时断开一个会话
+func (s *Server) checkPressure(sh *shedder, cpu float64, egress int64) (ev ShedEvent, shed bool) {
+	var reason string
+	switch {
+	case sh.opts.MaxCPU > 0 && cpu > sh.opts.MaxCPU:
+		reason = "cpu"
+	case sh.opts.MaxEgress > 0 && egress > sh.opts.MaxEgress:
+		reason = "egress"
+	default:
+		return
+	}
+	if ev, shed = s.shedOne(reason); !shed {
+		log.Warn().Str("reason", reason).Float64("cpu", cpu).Int64("egress", egress).
+			Msg("[rtmp] under pressure but no sheddable session")
+		return
+	}
+	ev.CPU, ev.Egress = cpu, egress
+	log.Warn().Str("session", ev.Session).Str("key", ev.Key).Str("remote", ev.Remote).Str("priority", ev.Priority).
+		Str("reason", reason).Float64("cpu", cpu).Int64("egress", egress).Msg("[rtmp] shed subscriber")
+	if sh.opts.OnShed != nil {
+		sh.opts.OnShed(ev)
+	}
+	return
+}
+
+// shedOne 断开一个优先级最低、最晚开始的拉流会话, 高优先级的会话不断开
+func (s *Server) shedOne(reason string) (ev ShedEvent, ok bool) {
+	s.lock.Lock()
+	var candidates []*serverSession
+	for _, ss := range s.sessions {
+		if ss.playing && ss.priority < PriorityHigh {
+			candidates = append(candidates, ss)
+		}
+	}
+	if len(candidates) == 0 {
+		s.lock.Unlock()
+		return
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].priority != candidates[j].priority {
+			return candidates[i].priority < candidates[j].priority
+		}
+		return candidates[i].startAt.After(candidates[j].startAt)
+	})
+	ss := candidates[0]
+	now := time.Now()
+	ev = ShedEvent{Session: ss.id, Key: ss.key, Remote: ss.remote, Priority: ss.priority.String(),
+		Reason: reason, Played: now.Sub(ss.startAt), At: now}
+	s.lock.Unlock()
+	ss.conn.Close()
+	return ev, true
+}
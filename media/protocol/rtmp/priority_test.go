@@ -0,0 +1,83 @@
+package rtmp
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bugVanisher/streamer/media/protocol/common"
+)
+
+func TestParsePriority(t *testing.T) {
+	for s, want := range map[string]Priority{"": PriorityNormal, "low": PriorityLow, "normal": PriorityNormal, "high": PriorityHigh} {
+		p, err := ParsePriority(s)
+		require.Nil(t, err)
+		require.Equal(t, want, p)
+	}
+	_, err := ParsePriority("urgent")
+	require.NotNil(t, err)
+
+	require.Equal(t, PriorityLow, playPriority(common.Info{RawURL: "rtmp://127.0.0.1/live/test?priority=low"}))
+	require.Equal(t, PriorityNormal, playPriority(common.Info{RawURL: "rtmp://127.0.0.1/live/test?priority=bad"}))
+	require.Equal(t, PriorityNormal, playPriority(common.Info{RawURL: "rtmp://127.0.0.1/live/test"}))
+}
+
+func TestServerShedLowestPriority(t *testing.T) {
+	s := NewServer("")
+	now := time.Now()
+	peers := map[string]net.Conn{}
+	add := func(id string, playing bool, p Priority, startAt time.Time) {
+		a, b := net.Pipe()
+		peers[id] = b
+		s.sessions[id] = &serverSession{id: id, conn: NewConn(a), key: "live/test", playing: playing, priority: p, startAt: startAt}
+	}
+	closed := func(id string) bool {
+		peers[id].SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+		_, err := peers[id].Read(make([]byte, 1))
+		nerr, ok := err.(net.Error)
+		return err != nil && !(ok && nerr.Timeout())
+	}
+	add("publisher", false, PriorityLow, now.Add(-time.Minute))
+	add("vip", true, PriorityHigh, now)
+	add("normal", true, PriorityNormal, now)
+	add("low-old", true, PriorityLow, now.Add(-time.Second))
+	add("low-new", true, PriorityLow, now)
+
+	var events []ShedEvent
+	sh := &shedder{opts: ShedOptions{MaxCPU: 0.8, MaxEgress: 1000, OnShed: func(ev ShedEvent) { events = append(events, ev) }}}
+
+	// 未超过上限时不断开
+	_, shed := s.checkPressure(sh, 0.5, 500)
+	require.False(t, shed)
+
+	// 同优先级先断开最晚开始拉流的会话
+	ev, shed := s.checkPressure(sh, 0.9, 500)
+	require.True(t, shed)
+	require.Equal(t, "low-new", ev.Session)
+	require.Equal(t, "cpu", ev.Reason)
+	require.Equal(t, "low", ev.Priority)
+	require.Equal(t, 1, len(events))
+	require.True(t, closed("low-new"))
+	require.False(t, closed("low-old"))
+
+	// 连接关闭后会话由handleConn移除, 这里手动移除
+	delete(s.sessions, "low-new")
+	ev, _ = s.checkPressure(sh, 0, 2000)
+	require.Equal(t, "low-old", ev.Session)
+	require.Equal(t, "egress", ev.Reason)
+
+	delete(s.sessions, "low-old")
+	ev, _ = s.checkPressure(sh, 0.9, 0)
+	require.Equal(t, "normal", ev.Session)
+	require.True(t, closed("normal"))
+
+	// 只剩高优先级的拉流会话和推流会话, 不再断开
+	delete(s.sessions, "normal")
+	_, shed = s.checkPressure(sh, 0.9, 2000)
+	require.False(t, shed)
+	require.Equal(t, 3, len(events))
+	require.False(t, closed("vip"))
+	require.False(t, closed("publisher"))
+}
@@ -0,0 +1,178 @@
+package rtmp
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// DialContextFunc 建立网络连接, 见WithDialContext
+type DialContextFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// NewProxyDialer 通过代理建立连接, proxyURL为http://[user:password@]host:port(CONNECT隧道)
+// 或socks5://[user:password@]host:port. 到代理的连接由forward建立, 为nil时直接连接
+func NewProxyDialer(proxyURL string, forward DialContextFunc) (DialContextFunc, error) {
+	u, err := url.Parse(proxyURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("rtmp: proxy url %q has no host", proxyURL)
+	}
+	if forward == nil {
+		forward = (&net.Dialer{}).DialContext
+	}
+	var handshake func(c net.Conn, u *url.URL, addr string) error
+	switch u.Scheme {
+	case "http":
+		handshake = httpConnect
+	case "socks5", "socks5h":
+		handshake = socks5Connect
+	default:
+		return nil, fmt.Errorf("rtmp: unsupported proxy scheme %q", u.Scheme)
+	}
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		c, err := forward(ctx, network, u.Host)
+		if err != nil {
+			return nil, err
+		}
+		// 握手期间遵循ctx的超时
+		if deadline, ok := ctx.Deadline(); ok {
+			c.SetDeadline(deadline)
+		}
+		if err = handshake(c, u, addr); err != nil {
+			c.Close()
+			return nil, fmt.Errorf("rtmp: proxy %s: %v", u.Host, err)
+		}
+		c.SetDeadline(time.Time{})
+		return c, nil
+	}, nil
+}
+
+// httpConnect 发送CONNECT请求建立隧道
+func httpConnect(c net.Conn, u *url.URL, addr string) (err error) {
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: http.Header{},
+	}
+	if u.User != nil {
+		password, _ := u.User.Password()
+		auth := base64.StdEncoding.EncodeToString([]byte(u.User.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+auth)
+	}
+	if err = req.Write(c); err != nil {
+		return
+	}
+	// rtmp由客户端先发送数据, 代理的响应之后不会有多读的字节
+	resp, err := http.ReadResponse(bufio.NewReaderSize(c, 1), req)
+	if err != nil {
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("CONNECT %s got status %s", addr, resp.Status)
+	}
+	return
+}
+
+// socks5Connect RFC 1928的CONNECT命令, 支持无认证和RFC 1929用户名密码认证, 目标地址由代理解析
+func socks5Connect(c net.Conn, u *url.URL, addr string) (err error) {
+	host, portstr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return
+	}
+	port, err := strconv.Atoi(portstr)
+	if err != nil || port <= 0 || port > 0xffff {
+		return fmt.Errorf("invalid port %q", portstr)
+	}
+	if len(host) > 255 {
+		return fmt.Errorf("host too long")
+	}
+
+	methods := []byte{0x00}
+	if u.User != nil {
+		methods = append(methods, 0x02)
+	}
+	if _, err = c.Write(append([]byte{0x05, byte(len(methods))}, methods...)); err != nil {
+		return
+	}
+	b := make([]byte, 262)
+	if _, err = io.ReadFull(c, b[:2]); err != nil {
+		return
+	}
+	if b[0] != 0x05 {
+		return fmt.Errorf("socks version %d", b[0])
+	}
+	switch b[1] {
+	case 0x00:
+	case 0x02:
+		if u.User == nil {
+			return fmt.Errorf("socks server requires authentication")
+		}
+		user := u.User.Username()
+		password, _ := u.User.Password()
+		if len(user) > 255 || len(password) > 255 {
+			return fmt.Errorf("socks user or password too long")
+		}
+		req := []byte{0x01, byte(len(user))}
+		req = append(req, user...)
+		req = append(req, byte(len(password)))
+		req = append(req, password...)
+		if _, err = c.Write(req); err != nil {
+			return
+		}
+		if _, err = io.ReadFull(c, b[:2]); err != nil {
+			return
+		}
+		if b[1] != 0x00 {
+			return fmt.Errorf("socks authentication failed")
+		}
+	default:
+		return fmt.Errorf("socks server accepts no supported authentication method")
+	}
+
+	req := []byte{0x05, 0x01, 0x00}
+	if ip := net.ParseIP(host); ip != nil && ip.To4() != nil {
+		req = append(append(req, 0x01), ip.To4()...)
+	} else if ip != nil {
+		req = append(append(req, 0x04), ip.To16()...)
+	} else {
+		req = append(append(req, 0x03, byte(len(host))), host...)
+	}
+	req = append(req, byte(port>>8), byte(port))
+	if _, err = c.Write(req); err != nil {
+		return
+	}
+	if _, err = io.ReadFull(c, b[:4]); err != nil {
+		return
+	}
+	if b[1] != 0x00 {
+		return fmt.Errorf("socks connect %s failed with code %d", addr, b[1])
+	}
+	// 跳过代理绑定的地址和端口
+	var n int
+	switch b[3] {
+	case 0x01:
+		n = net.IPv4len
+	case 0x04:
+		n = net.IPv6len
+	case 0x03:
+		if _, err = io.ReadFull(c, b[:1]); err != nil {
+			return
+		}
+		n = int(b[0])
+	default:
+		return fmt.Errorf("socks address type %d", b[3])
+	}
+	_, err = io.ReadFull(c, b[:n+2])
+	return
+}
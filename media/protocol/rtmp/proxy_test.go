@@ -0,0 +1,234 @@
+package rtmp
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bugVanisher/streamer/media/av"
+	"github.com/bugVanisher/streamer/media/codec/h264parser"
+	"github.com/bugVanisher/streamer/media/container/flv/flvio"
+)
+
+// testProxy 最简单的http CONNECT/socks5代理, 记录请求的目标地址
+func testProxy(t *testing.T, socks bool) (addr string, targets chan string) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	t.Cleanup(func() { l.Close() })
+	targets = make(chan string, 1)
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				var target string
+				if socks {
+					b := make([]byte, 256)
+					io.ReadFull(c, b[:2])
+					io.ReadFull(c, b[:b[1]])
+					c.Write([]byte{5, 0})
+					io.ReadFull(c, b[:5])
+					host := make([]byte, b[4])
+					io.ReadFull(c, host)
+					io.ReadFull(c, b[:2])
+					target = net.JoinHostPort(string(host), strconv.Itoa(int(b[0])<<8|int(b[1])))
+					c.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+				} else {
+					req, err := http.ReadRequest(bufio.NewReader(c))
+					if err != nil || req.Method != http.MethodConnect || req.Header.Get("Proxy-Authorization") == "" {
+						c.Write([]byte("HTTP/1.1 407 Proxy Authentication Required\r\n\r\n"))
+						return
+					}
+					target = req.Host
+					c.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+				}
+				targets <- target
+				up, err := net.Dial("tcp", target)
+				if err != nil {
+					return
+				}
+				defer up.Close()
+				go io.Copy(up, c)
+				io.Copy(c, up)
+			}()
+		}
+	}()
+	return l.Addr().String(), targets
+}
+
+func TestProxyDialer(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	s := NewServer("")
+	go s.Serve(l)
+	defer s.Close()
+	// 用域名访问以检查由代理解析地址
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+	target := net.JoinHostPort("localhost", port)
+
+	for i, proxy := range []struct {
+		scheme string
+		socks  bool
+	}{{"http://user:pass@", false}, {"socks5://", true}} {
+		addr, targets := testProxy(t, proxy.socks)
+		dial, err := NewProxyDialer(proxy.scheme+addr, nil)
+		require.Nil(t, err)
+		c, err := Dial(target, WithTcURL("rtmp://"+target+"/live/proxy"+strconv.Itoa(i)), WithDialContext(dial))
+		require.Nil(t, err, proxy.scheme)
+		require.Equal(t, target, <-targets)
+		require.Nil(t, c.HandshakeClient())
+		require.Nil(t, c.ConnectPublish())
+		c.Close()
+	}
+
+	_, err = NewProxyDialer("ftp://127.0.0.1:21", nil)
+	require.NotNil(t, err)
+}
+
+// testCert 自签名证书, 同时用作服务端证书和客户端证书
+func testCert(t *testing.T) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.Nil(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "localhost"},
+		DNSNames:              []string{"localhost"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.Nil(t, err)
+	cert := tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+	cert.Leaf, err = x509.ParseCertificate(der)
+	require.Nil(t, err)
+	return cert
+}
+
+func TestDialMutualTLS(t *testing.T) {
+	cert := testCert(t)
+	pool := x509.NewCertPool()
+	pool.AddCert(cert.Leaf)
+	states := make(chan tls.ConnectionState, 2)
+	l, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    pool,
+		NextProtos:   []string{"rtmp"},
+		VerifyConnection: func(cs tls.ConnectionState) error {
+			states <- cs
+			return nil
+		},
+	})
+	require.Nil(t, err)
+	s := NewServer("")
+	go s.Serve(l)
+	defer s.Close()
+
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+	host := net.JoinHostPort("localhost", port)
+	c, err := Dial(host, WithTcURL("rtmps://"+host+"/live/mtls"), WithTLSConfig(&tls.Config{RootCAs: pool}),
+		WithClientCertificates(cert), WithALPN("rtmp"))
+	require.Nil(t, err)
+	defer c.Close()
+	cs := <-states
+	require.Equal(t, "rtmp", cs.NegotiatedProtocol)
+	require.Len(t, cs.PeerCertificates, 1)
+	require.Nil(t, c.HandshakeClient())
+	require.Nil(t, c.ConnectPublish())
+
+	// 没有客户端证书时服务端拒绝握手
+	c2, err := Dial(host, WithTcURL("rtmps://"+host+"/live/mtls"), WithTLSConfig(&tls.Config{RootCAs: pool}))
+	if err == nil {
+		// TLS 1.3的客户端在服务端校验证书之前完成握手, 错误在之后的读写中返回
+		err = c2.HandshakeClient()
+		c2.Close()
+	}
+	require.NotNil(t, err)
+}
+
+func TestServeTLS(t *testing.T) {
+	cert := testCert(t)
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	key, err := x509.MarshalECPrivateKey(cert.PrivateKey.(*ecdsa.PrivateKey))
+	require.Nil(t, err)
+	require.Nil(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]}), 0600))
+	require.Nil(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: key}), 0600))
+
+	s := NewServer("")
+	require.NotNil(t, s.ServeTLS(newLocalListener(t), certFile, filepath.Join(dir, "missing.pem")))
+	l := newLocalListener(t)
+	go s.ServeTLS(l, certFile, keyFile)
+	defer s.Close()
+
+	pool := x509.NewCertPool()
+	pool.AddCert(cert.Leaf)
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+	host := net.JoinHostPort("localhost", port)
+	dial := func(path string) Conn {
+		c, err := Dial(host, WithTcURL("rtmps://"+host+path), WithTLSConfig(&tls.Config{RootCAs: pool}))
+		require.Nil(t, err)
+		require.Nil(t, c.HandshakeClient())
+		return c
+	}
+	sps := []byte{0x67, 0x64, 0x00, 0x1e, 0xac, 0xd9, 0x40, 0xa0, 0x2f, 0xf9, 0x70, 0x11, 0x00, 0x00, 0x03,
+		0x00, 0x01, 0x00, 0x00, 0x03, 0x00, 0x32, 0x0f, 0x16, 0x2d, 0x96}
+	h264, err := h264parser.NewCodecDataFromSPSAndPPS(sps, []byte{0x68, 0xeb, 0xe3, 0xcb, 0x22, 0xc0})
+	require.Nil(t, err)
+	pub := dial("/live/tls")
+	defer pub.Close()
+	require.Nil(t, pub.ConnectPublish())
+	require.Nil(t, pub.WriteHeader([]av.CodecData{h264}))
+	play := dial("/live/tls")
+	defer play.Close()
+	require.Nil(t, play.ConnectPlay())
+
+	// 服务端按写缓冲批量发送, 写入足够多的数据
+	for i := 0; i < 30; i++ {
+		require.Nil(t, pub.WritePacket(av.Packet{IsKeyFrame: i == 0, DataType: int8(flvio.TAG_VIDEO),
+			AVCPacketType: av.AVC_NALU, Time: av.MediaTimeFromMs(int32(i * 40)), Data: bytes.Repeat([]byte{byte(i)}, 1000)}))
+	}
+	require.Nil(t, pub.WriteTrailer())
+	streams, err := play.Streams()
+	require.Nil(t, err)
+	require.Equal(t, av.H264, streams[0].Type())
+	pkt, err := play.ReadPacket()
+	require.Nil(t, err)
+	require.Equal(t, bytes.Repeat([]byte{0}, 1000), pkt.Data)
+
+	// 明文rtmp客户端无法和rtmps服务端握手
+	plain, err := Dial(l.Addr().String(), WithTcURL("rtmp://"+l.Addr().String()+"/live/tls"), WithReadWriteTimeout(time.Second))
+	require.Nil(t, err)
+	defer plain.Close()
+	require.NotNil(t, plain.HandshakeClient())
+}
+
+func newLocalListener(t *testing.T) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	return l
+}
@@ -0,0 +1,38 @@
+package rtmp
+
+// RecoveryPointAll SetRecoveryPoint的key, 作用于没有单独设置的所有流
+const RecoveryPointAll = "*"
+
+// SetRecoveryPoint 设置流key(app/stream)是否把带recovery point SEI的帧当作关键帧. open GOP的推流端
+// 很少发送IDR, 开启后拉流可以从recovery point开始, 不必等待下一个IDR. key为RecoveryPointAll时作用于
+// 没有单独设置的所有流. 对之后建立的推流连接生效, 已在推流的流从之后写入的帧开始生效
+func (s *Server) SetRecoveryPoint(key string, enabled bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.recoveryPoints[key] = enabled
+	for k, st := range s.streams {
+		if key == RecoveryPointAll || key == k {
+			st.queue.SetRecoveryPoint(s.recoveryPoint(k))
+		}
+	}
+}
+
+// recoveryPoint 流key是否把recovery point帧当作关键帧, 调用方持有lock
+func (s *Server) recoveryPoint(key string) bool {
+	if enabled, ok := s.recoveryPoints[key]; ok {
+		return enabled
+	}
+	return s.recoveryPoints[RecoveryPointAll]
+}
+
+// detectRecoveryPoint 是否有流开启了recovery point, 开启时推流连接检测recovery point SEI
+func (s *Server) detectRecoveryPoint() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, enabled := range s.recoveryPoints {
+		if enabled {
+			return true
+		}
+	}
+	return false
+}
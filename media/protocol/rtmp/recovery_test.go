@@ -0,0 +1,42 @@
+package rtmp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bugVanisher/streamer/media/av"
+	"github.com/bugVanisher/streamer/media/container/flv/flvio"
+)
+
+func TestServerRecoveryPoint(t *testing.T) {
+	s := NewServer("")
+	detect := func() bool {
+		opts, _ := s.connOptions(nil)
+		o := NewOptions()
+		for _, opt := range opts {
+			opt(&o)
+		}
+		return o.RecoveryPoint
+	}
+	require.False(t, detect())
+
+	s.SetRecoveryPoint("live/open", true)
+	require.True(t, detect())
+
+	s.lock.Lock()
+	open, other := s.acquire("live/open"), s.acquire("live/other")
+	s.lock.Unlock()
+	gops := func(st *serverStream) uint32 {
+		st.queue.WritePacket(av.Packet{DataType: int8(flvio.TAG_VIDEO), RecoveryPoint: true})
+		return st.queue.Stat().GopCount
+	}
+	require.Equal(t, uint32(1), gops(open))
+	require.Equal(t, uint32(0), gops(other))
+
+	// 修改默认值对已有的流立即生效, 单独设置的流不受影响
+	s.SetRecoveryPoint(RecoveryPointAll, true)
+	s.SetRecoveryPoint("live/open", false)
+	require.Equal(t, uint32(1), gops(open))
+	require.Equal(t, uint32(1), gops(other))
+}
@@ -0,0 +1,312 @@
+package rtmp
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sync/atomic"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/bugVanisher/streamer/media/av"
+	"github.com/bugVanisher/streamer/media/codec/h264parser"
+	"github.com/bugVanisher/streamer/media/container/flv"
+	"github.com/bugVanisher/streamer/media/container/flv/flvio"
+	"github.com/bugVanisher/streamer/statistics"
+)
+
+// RelayStats 转发统计
+type RelayStats struct {
+	AudioMsgs     uint64 // 已转发的音频消息数
+	VideoMsgs     uint64 // 已转发的视频消息数
+	DataMsgs      uint64 // 已转发的数据消息数
+	Bytes         uint64 // 已转发的消息体字节数
+	Filtered      uint64 // 没有转发的命令等其他消息数
+	Rewritten     uint64 // 注入或删除字段后重新编码的onMetaData和改写了level的H.264 sequence header数
+	LastTimestamp uint32 // 最后转发的消息时间戳, 毫秒
+	MsgStreams    uint64 // 开启WithRelayMultiStream时转发过的其他消息流数
+	Health        int    // 开启WithRelayAlerter时主流的健康分, 0-100
+	Degraded      bool   // 开启WithRelayAlerter时主流有告警正在触发
+}
+
+// RelayOption Relay的选项
+type RelayOption func(r *Relay)
+
+// WithRelayMetadata 在转发的onMetaData中注入或覆盖这些字段
+func WithRelayMetadata(fields flvio.AMFMap) RelayOption {
+	return func(r *Relay) {
+		r.metadata = fields
+	}
+}
+
+// WithRelayStripMetadata 从转发的onMetaData中删除这些字段
+func WithRelayStripMetadata(keys ...string) RelayOption {
+	return func(r *Relay) {
+		r.strip = keys
+	}
+}
+
+// WithRelayMaxH264Level 把H.264 sequence header中record和SPS的level_idc限制为不超过level, 不转码,
+// 用于按声明的level拒绝播放的播放器
+func WithRelayMaxH264Level(level uint8) RelayOption {
+	return func(r *Relay) {
+		r.maxH264Level = level
+	}
+}
+
+// WithRelayMultiStream src上主流之外publish的消息流也转发: 每路流在dst上CreateStream后以同名publish,
+// 多路流共用dst的一个socket. 这些流经过探测后按packet重新封装, 不是原样转发消息体. src必须是服务端连接
+func WithRelayMultiStream(enable bool) RelayOption {
+	return func(r *Relay) {
+		r.multiStream = enable
+	}
+}
+
+// WithRelayAlerter 每个统计周期统计转发的主流和src连接的协议开销, 并按a的规则检查告警, 结果见Stats的Health和Degraded.
+// 只解析消息的tag头, 转发的消息体不变
+func WithRelayAlerter(a *statistics.Alerter) RelayOption {
+	return func(r *Relay) {
+		r.monitor = newSessionMonitor()
+		r.monitor.setAlerter(a)
+		r.prober = &flv.Prober{}
+	}
+}
+
+// Relay 在一对连接之间转发消息, 不解析音视频数据也不重新封装: 音视频和数据消息的消息体原样按dst的chunk大小发送,
+// 命令和协议控制消息由各自的连接处理, 不转发. 用于CPU开销低的边缘转推
+type Relay struct {
+	src, dst *conn
+	metadata flvio.AMFMap
+	strip    []string
+
+	maxH264Level uint8
+	multiStream  bool
+	ctx          context.Context
+
+	monitor *sessionMonitor // 可选
+	prober  *flv.Prober
+
+	audioMsgs     uint64
+	videoMsgs     uint64
+	dataMsgs      uint64
+	bytes         uint64
+	filtered      uint64
+	rewritten     uint64
+	lastTimestamp uint32
+	msgStreams    uint64
+}
+
+// NewRelay src为推流到本服务的连接或已play的客户端连接, dst为拉流的连接或已publish的客户端连接.
+// 两者都必须由NewConn或Dial创建
+func NewRelay(src, dst Conn, opt ...RelayOption) (*Relay, error) {
+	s, ok := src.(*conn)
+	if !ok {
+		return nil, fmt.Errorf("rtmp: relay src %T is not an rtmp conn", src)
+	}
+	d, ok := dst.(*conn)
+	if !ok {
+		return nil, fmt.Errorf("rtmp: relay dst %T is not an rtmp conn", dst)
+	}
+	r := &Relay{src: s, dst: d}
+	for _, o := range opt {
+		o(r)
+	}
+	if r.multiStream {
+		if !s.opts.IsServer {
+			return nil, fmt.Errorf("rtmp: relay multi stream needs a server src")
+		}
+		s.opts.StreamHandler = r.relayStream
+	}
+	return r, nil
+}
+
+// Stats 当前的转发统计, 可以在Run的同时调用
+func (r *Relay) Stats() RelayStats {
+	stats := RelayStats{
+		AudioMsgs:     atomic.LoadUint64(&r.audioMsgs),
+		VideoMsgs:     atomic.LoadUint64(&r.videoMsgs),
+		DataMsgs:      atomic.LoadUint64(&r.dataMsgs),
+		Bytes:         atomic.LoadUint64(&r.bytes),
+		Filtered:      atomic.LoadUint64(&r.filtered),
+		Rewritten:     atomic.LoadUint64(&r.rewritten),
+		LastTimestamp: atomic.LoadUint32(&r.lastTimestamp),
+		MsgStreams:    atomic.LoadUint64(&r.msgStreams),
+	}
+	if r.monitor != nil {
+		stats.Health = r.monitor.score()
+		stats.Degraded = r.monitor.degraded()
+	}
+	return stats
+}
+
+// Run 完成两端的握手和connect后循环转发, 直到ctx结束、推流端停止推流(返回io.EOF)或任一端出错
+func (r *Relay) Run(ctx context.Context) (err error) {
+	r.ctx = ctx
+	defer func() {
+		// 其他消息流随主流一起结束
+		if err == nil {
+			err = io.EOF
+		}
+		r.src.closeMsgStreams(err)
+	}()
+	if err = r.src.prepare(stageCommandDone, prepareReading); err != nil {
+		return
+	}
+	if err = r.dst.prepare(stageCommandDone, prepareWriting); err != nil {
+		return
+	}
+	if r.monitor != nil {
+		r.monitor.setWire(r.src.RxBytes)
+		r.monitor.start(statistics.StatInterval)
+		defer r.monitor.stop()
+	}
+	for ctx.Err() == nil {
+		if r.src.unpublished {
+			return io.EOF
+		}
+		if err = r.src.pollMsg(); err != nil {
+			return
+		}
+		if r.src.gotcommand && r.src.opts.IsServer {
+			if _, err = r.src.handleUnpublish(); err != nil {
+				return
+			}
+		}
+		if r.multiStream {
+			var handled bool
+			if handled, err = r.src.handleMsgStream(); err != nil {
+				return
+			}
+			if handled {
+				continue
+			}
+		}
+		if err = r.forward(); err != nil {
+			return
+		}
+	}
+	return ctx.Err()
+}
+
+// forward 转发src刚读到的消息, src的读缓冲中没有更多数据时flush
+func (r *Relay) forward() (err error) {
+	src, dst := r.src, r.dst
+	var csid uint32
+	var counter *uint64
+	switch src.msgtypeid {
+	case msgtypeidAudioMsg:
+		csid, counter = 6, &r.audioMsgs
+	case msgtypeidVideoMsg:
+		csid, counter = 7, &r.videoMsgs
+	case msgtypeidDataMsgAMF0, msgtypeidDataMsgAMF3:
+		csid, counter = 5, &r.dataMsgs
+	default:
+		atomic.AddUint64(&r.filtered, 1)
+		return
+	}
+
+	dst.wlock.Lock()
+	defer dst.wlock.Unlock()
+	if metadata, ok := parseMetadata(src.datamsgvals); ok && (len(r.metadata) > 0 || len(r.strip) > 0) {
+		if err = dst.writeDataMsg(csid, dst.avmsgsid, "onMetaData", r.rewriteMetadata(metadata)); err != nil {
+			return
+		}
+		atomic.AddUint64(&r.rewritten, 1)
+	} else if err = dst.writeRawMsgTo(dst.avmsgsid, src.msgtypeid, csid, src.timestamp, r.rewriteVideo(src.msgdata)); err != nil {
+		return
+	}
+	atomic.AddUint64(counter, 1)
+	atomic.AddUint64(&r.bytes, uint64(len(src.msgdata)))
+	atomic.StoreUint32(&r.lastTimestamp, src.timestamp)
+	r.stat()
+	if src.bufr.Buffered() == 0 && len(src.aggmsgs) == 0 {
+		err = dst.flushWrite()
+	}
+	return
+}
+
+// stat 开启WithRelayAlerter时统计src刚读到的音视频消息, 只用第一个视频sequence header
+func (r *Relay) stat() {
+	tag := r.src.avtag
+	if r.monitor == nil || tag.Type == 0 {
+		return
+	}
+	if tag.Type == flvio.TAG_VIDEO && tag.AVCPacketType == flvio.AVC_SEQHDR {
+		if !r.prober.GotVideo && r.prober.PushTag(tag, int32(r.src.timestamp)) == nil {
+			r.monitor.setCodecData(r.prober.Streams)
+		}
+		return
+	}
+	if pkt, ok := r.prober.TagToPacket(tag, int32(r.src.timestamp)); ok && pkt.AVCPacketType != flvio.AAC_SEQHDR {
+		r.monitor.stat(&pkt)
+	}
+}
+
+// relayStream 在dst上创建同名的消息流, 把src上这路流的packet转发过去, 在StreamHandler的goroutine中运行
+func (r *Relay) relayStream(st *Stream) {
+	defer st.Close()
+	out, err := r.dst.CreateStream()
+	if err == nil {
+		err = out.Publish(st.Info().StreamName)
+	}
+	if err != nil {
+		log.Error().Err(err).Str("stream", st.Info().StreamName).Msg("[rtmp] relay stream publish failed")
+		return
+	}
+	defer out.Close()
+	atomic.AddUint64(&r.msgStreams, 1)
+	// 这路流没有更多已收到的packet时发送, 不等主流flush
+	t := av.NewTransport(av.WithAfterWritePacket(func(*av.Packet) error {
+		if len(st.pkts) > 0 {
+			return nil
+		}
+		return out.WriteTrailer()
+	}))
+	err = t.CopyAV(r.ctx, out, st)
+	log.Info().Err(err).Str("stream", st.Info().StreamName).Uint32("src", st.ID()).Uint32("dst", out.ID()).
+		Msg("[rtmp] relay stream end")
+}
+
+// rewriteVideo 设置了WithRelayMaxH264Level时改写H.264 sequence header的level, 不能改写时原样转发
+func (r *Relay) rewriteVideo(data []byte) []byte {
+	if r.maxH264Level == 0 || r.src.msgtypeid != msgtypeidVideoMsg || len(data) < 5 ||
+		data[0]&0x80 != 0 || data[0]&0x0f != flvio.VIDEO_H264 || data[1] != flvio.AVC_SEQHDR {
+		return data
+	}
+	record, err := h264parser.RewriteRecordProfileLevel(data[5:], h264parser.CapLevel(r.maxH264Level))
+	if err != nil || bytes.Equal(record, data[5:]) {
+		return data
+	}
+	atomic.AddUint64(&r.rewritten, 1)
+	return append(append(make([]byte, 0, 5+len(record)), data[:5]...), record...)
+}
+
+// rewriteMetadata 复制后删除strip中的字段, 再合并注入的字段
+func (r *Relay) rewriteMetadata(src flvio.AMFMap) flvio.AMFMap {
+	metadata := make(flvio.AMFMap, len(src)+len(r.metadata))
+	for k, v := range src {
+		metadata[k] = v
+	}
+	for _, k := range r.strip {
+		delete(metadata, k)
+	}
+	for k, v := range r.metadata {
+		metadata[k] = v
+	}
+	return metadata
+}
+
+// writeRawMsgTo 把消息体原样拆成chunk发送, 调用方持有wlock
+func (self *conn) writeRawMsgTo(msgsid uint32, msgtypeid uint8, csid uint32, timestamp uint32, data []byte) (err error) {
+	ts := int32(timestamp)
+	hdrlen := chunkHeaderLength
+	if timestamp > FlvTimestampMax {
+		hdrlen += 4
+	}
+	b := self.tmpwbuf(hdrlen)
+	n := self.fillChunkHeader(b, csid, ts, msgtypeid, msgsid, len(data))
+	bufs := self.appendChunks(self.wvec[:0], b[:n], 0, data, csid, ts)
+	_, err = self.sendChunks(bufs, len(data), ts)
+	return
+}
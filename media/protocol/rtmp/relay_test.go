@@ -0,0 +1,230 @@
+package rtmp
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bugVanisher/streamer/media/av"
+	"github.com/bugVanisher/streamer/media/codec/h264parser"
+	"github.com/bugVanisher/streamer/media/container/flv/flvio"
+	"github.com/bugVanisher/streamer/statistics"
+)
+
+func TestRelay(t *testing.T) {
+	// 上游服务端透传onMetaData, 以便拉流端检查relay改写后的字段
+	upstream, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	s := NewServer("", WithMetadataPassThrough(true))
+	go s.Serve(upstream)
+	defer s.Close()
+
+	edge, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	defer edge.Close()
+	relays := make(chan *Relay, 1)
+	done := make(chan error, 1)
+	go func() {
+		nc, err := edge.Accept()
+		if err != nil {
+			done <- err
+			return
+		}
+		src := NewConn(nc)
+		defer src.Close()
+		dst, err := Dial(upstream.Addr().String(), WithTcURL("rtmp://"+upstream.Addr().String()+"/live/out"))
+		if err != nil {
+			done <- err
+			return
+		}
+		defer dst.Close()
+		r, _ := NewRelay(src, dst, WithRelayMetadata(flvio.AMFMap{"relay": "edge"}), WithRelayStripMetadata("encoder"),
+			WithRelayMaxH264Level(21))
+		relays <- r
+		done <- r.Run(context.Background())
+	}()
+
+	sps := []byte{0x67, 0x64, 0x00, 0x1e, 0xac, 0xd9, 0x40, 0xa0, 0x2f, 0xf9, 0x70, 0x11, 0x00, 0x00, 0x03,
+		0x00, 0x01, 0x00, 0x00, 0x03, 0x00, 0x32, 0x0f, 0x16, 0x2d, 0x96}
+	h264, err := h264parser.NewCodecDataFromSPSAndPPS(sps, []byte{0x68, 0xeb, 0xe3, 0xcb, 0x22, 0xc0})
+	require.Nil(t, err)
+	pub, err := Dial(edge.Addr().String(), WithTcURL("rtmp://"+edge.Addr().String()+"/live/in"),
+		WithMetadata(flvio.AMFMap{"encoder": "obs"}), WithChunkSize(500))
+	require.Nil(t, err)
+	require.Nil(t, pub.HandshakeClient())
+	require.Nil(t, pub.ConnectPublish())
+	require.Nil(t, pub.WriteHeader([]av.CodecData{h264}))
+
+	play, err := Dial(upstream.Addr().String(), WithTcURL("rtmp://"+upstream.Addr().String()+"/live/out"))
+	require.Nil(t, err)
+	defer play.Close()
+	require.Nil(t, play.HandshakeClient())
+	require.Nil(t, play.ConnectPlay())
+
+	// 服务端探测需要MaxProbePacketCount个tag
+	var sent [][]byte
+	for i := 0; i < 30; i++ {
+		data := bytes.Repeat([]byte{byte(i)}, 1000+i)
+		sent = append(sent, data)
+		require.Nil(t, pub.WritePacket(av.Packet{IsKeyFrame: i == 0, DataType: int8(flvio.TAG_VIDEO),
+			AVCPacketType: av.AVC_NALU, Time: av.MediaTimeFromMs(int32(i * 40)), Data: data}))
+	}
+	require.Nil(t, pub.WriteTrailer())
+
+	streams, err := play.Streams()
+	require.Nil(t, err)
+	require.Equal(t, av.H264, streams[0].Type())
+	// sequence header的level被限制为2.1
+	require.Equal(t, uint(21), streams[0].(h264parser.CodecData).SPSInfo.LevelIdc)
+	require.Equal(t, uint8(21), streams[0].(h264parser.CodecData).RecordInfo.AVCLevelIndication)
+	// 服务端按写缓冲批量发送, 最后几帧可能还在缓冲中, 只检查前20帧
+	for i := 0; i < 20; i++ {
+		pkt, err := play.ReadPacket()
+		require.Nil(t, err)
+		require.Equal(t, sent[i], pkt.Data)
+		require.Equal(t, av.MediaTimeFromMs(int32(i*40)), pkt.Time)
+	}
+	metadata := play.(*conn).Metadata()
+	require.Equal(t, "edge", metadata["relay"])
+	require.Nil(t, metadata["encoder"])
+
+	// 推流端断开后relay结束
+	r := <-relays
+	pub.Close()
+	require.NotNil(t, <-done)
+	stats := r.Stats()
+	require.Equal(t, uint64(31), stats.VideoMsgs)
+	require.Equal(t, uint64(2), stats.Rewritten)
+	require.Equal(t, uint32(29*40), stats.LastTimestamp)
+}
+
+func TestRelayMultiStream(t *testing.T) {
+	upstream, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	s := NewServer("")
+	go s.Serve(upstream)
+	defer s.Close()
+
+	edge, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	defer edge.Close()
+	relays := make(chan *Relay, 1)
+	done := make(chan error, 1)
+	go func() {
+		nc, err := edge.Accept()
+		if err != nil {
+			done <- err
+			return
+		}
+		src := NewConn(nc)
+		defer src.Close()
+		dst, err := Dial(upstream.Addr().String(), WithTcURL("rtmp://"+upstream.Addr().String()+"/live/a"))
+		if err != nil {
+			done <- err
+			return
+		}
+		defer dst.Close()
+		r, err := NewRelay(src, dst, WithRelayMultiStream(true))
+		if err != nil {
+			done <- err
+			return
+		}
+		relays <- r
+		done <- r.Run(context.Background())
+	}()
+
+	sps := []byte{0x67, 0x64, 0x00, 0x1e, 0xac, 0xd9, 0x40, 0xa0, 0x2f, 0xf9, 0x70, 0x11, 0x00, 0x00, 0x03,
+		0x00, 0x01, 0x00, 0x00, 0x03, 0x00, 0x32, 0x0f, 0x16, 0x2d, 0x96}
+	h264, err := h264parser.NewCodecDataFromSPSAndPPS(sps, []byte{0x68, 0xeb, 0xe3, 0xcb, 0x22, 0xc0})
+	require.Nil(t, err)
+	// 主流a和msgsid 2上的b共用推流端到edge、edge到上游的两个socket
+	pub, err := Dial(edge.Addr().String(), WithTcURL("rtmp://"+edge.Addr().String()+"/live/a"))
+	require.Nil(t, err)
+	require.Nil(t, pub.HandshakeClient())
+	require.Nil(t, pub.ConnectPublish())
+	b, err := pub.CreateStream()
+	require.Nil(t, err)
+	require.Nil(t, b.Publish("b"))
+	require.NotEqual(t, pub.(*conn).avmsgsid, b.ID())
+	require.Nil(t, pub.WriteHeader([]av.CodecData{h264}))
+	require.Nil(t, b.WriteHeader([]av.CodecData{h264}))
+
+	frame := func(name byte, i int) av.Packet {
+		return av.Packet{IsKeyFrame: i == 0, DataType: int8(flvio.TAG_VIDEO), AVCPacketType: av.AVC_NALU,
+			Time: av.MediaTimeFromMs(int32(i * 40)), Data: bytes.Repeat([]byte{name, byte(i)}, 500)}
+	}
+	// 服务端探测需要MaxProbePacketCount个tag
+	for i := 0; i < 30; i++ {
+		require.Nil(t, pub.WritePacket(frame('a', i)))
+		require.Nil(t, b.WritePacket(frame('b', i)))
+	}
+	require.Nil(t, pub.WriteTrailer())
+	require.Nil(t, b.WriteTrailer())
+
+	for _, name := range []byte{'a', 'b'} {
+		play, err := Dial(upstream.Addr().String(), WithTcURL("rtmp://"+upstream.Addr().String()+"/live/"+string(name)))
+		require.Nil(t, err)
+		require.Nil(t, play.HandshakeClient())
+		require.Nil(t, play.ConnectPlay())
+		streams, err := play.Streams()
+		require.Nil(t, err)
+		require.Equal(t, av.H264, streams[0].Type())
+		for i := 0; i < 20; i++ {
+			pkt, err := play.ReadPacket()
+			require.Nil(t, err)
+			require.Equal(t, frame(name, i).Data, pkt.Data)
+		}
+		play.Close()
+	}
+
+	r := <-relays
+	pub.Close()
+	require.NotNil(t, <-done)
+	require.Equal(t, uint64(1), r.Stats().MsgStreams)
+}
+
+func TestRelayAlerter(t *testing.T) {
+	rule, err := statistics.ParseAlertRule("health<100")
+	require.Nil(t, err)
+	var events []statistics.AlertEvent
+	r := &Relay{src: &conn{}}
+	WithRelayAlerter(statistics.NewAlerter("live/in", []statistics.AlertRule{rule}, func(e statistics.AlertEvent) {
+		events = append(events, e)
+	}))(r)
+	require.Equal(t, 100, r.Stats().Health)
+	require.False(t, r.Stats().Degraded)
+
+	sps := []byte{0x67, 0x64, 0x00, 0x1e, 0xac, 0xd9, 0x40, 0xa0, 0x2f, 0xf9, 0x70, 0x11, 0x00, 0x00, 0x03,
+		0x00, 0x01, 0x00, 0x00, 0x03, 0x00, 0x32, 0x0f, 0x16, 0x2d, 0x96}
+	h264, err := h264parser.NewCodecDataFromSPSAndPPS(sps, []byte{0x68, 0xeb, 0xe3, 0xcb, 0x22, 0xc0})
+	require.Nil(t, err)
+	r.src.avtag = flvio.Tag{Type: flvio.TAG_VIDEO, FrameType: flvio.FRAME_KEY, CodecID: flvio.VIDEO_H264,
+		AVCPacketType: flvio.AVC_SEQHDR, Data: h264.AVCDecoderConfRecordBytes()}
+	r.stat()
+	for i := 0; i < 5; i++ {
+		r.src.avtag = flvio.Tag{Type: flvio.TAG_VIDEO, FrameType: flvio.FRAME_INTER, CodecID: flvio.VIDEO_H264,
+			AVCPacketType: flvio.AVC_NALU, Data: []byte{0, 0, 0, 2, 0x41, 0x9a}}
+		if i == 0 {
+			r.src.avtag.FrameType = flvio.FRAME_KEY
+			r.src.avtag.Data = []byte{0, 0, 0, 2, 0x65, 0x88}
+		}
+		r.src.timestamp = uint32(i * 40)
+		r.stat()
+	}
+	// 只解析tag头, sequence header给出分辨率
+	require.Equal(t, uint32(640), r.monitor.width)
+	require.Equal(t, uint32(360), r.monitor.height)
+
+	// 之后不再有消息, 卡顿的统计周期拉低健康分
+	for i := 0; i < 3; i++ {
+		r.monitor.tick()
+	}
+	stats := r.Stats()
+	require.True(t, stats.Health < 100)
+	require.True(t, stats.Degraded)
+	require.Len(t, events, 1)
+	require.Equal(t, "live/in", events[0].Stream)
+}
@@ -0,0 +1,240 @@
+package rtmp
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RTMPT(rtmp over http)隧道: 客户端用POST /open/1 取得session id, 之后数据放在POST /send/<sid>/<seq>的body中发送,
+// 没有数据发送时用POST /idle/<sid>/<seq>轮询, 结束时POST /close/<sid>/<seq>.
+// send/idle的响应第一个字节为服务端建议的轮询间隔, 之后是服务端发来的rtmp数据
+const (
+	rtmptContentType = "application/x-fcs"
+	// rtmptPollUnit 轮询间隔字节的单位
+	rtmptPollUnit = 10 * time.Millisecond
+	// rtmptMaxPollInterval 最长的轮询间隔, 避免服务端建议的间隔过长增加延时
+	rtmptMaxPollInterval = 500 * time.Millisecond
+)
+
+// isRTMPT tcUrl是否为rtmpt://或rtmpts://
+func isRTMPT(tcurl string) bool {
+	return strings.HasPrefix(tcurl, "rtmpt://") || strings.HasPrefix(tcurl, "rtmpts://")
+}
+
+type rtmptAddr string
+
+func (a rtmptAddr) Network() string { return "rtmpt" }
+func (a rtmptAddr) String() string  { return string(a) }
+
+// rtmptConn 以net.Conn的形式提供RTMPT隧道, 由conn像tcp连接一样读写
+type rtmptConn struct {
+	client *http.Client
+	base   string // http(s)://host
+	remote rtmptAddr
+	sid    string
+
+	lock     sync.Mutex // 隧道请求必须按seq顺序串行
+	seq      uint64
+	interval time.Duration
+
+	rlock   sync.Mutex
+	rbuf    bytes.Buffer
+	notify  chan struct{} // 收到数据时唤醒Read
+	done    chan struct{}
+	closing sync.Once
+
+	dlock         sync.Mutex
+	readDeadline  time.Time
+	writeDeadline time.Time
+}
+
+// dialRTMPT 建立RTMPT隧道, rtmpts使用https, cfg为nil时使用默认TLS配置, dial不为空时用于建立到http服务的连接
+func dialRTMPT(host string, secure bool, cfg *tls.Config, timeout time.Duration, dial DialContextFunc) (net.Conn, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if dial != nil {
+		transport.DialContext = dial
+	}
+	scheme := "http"
+	if secure {
+		scheme = "https"
+		transport.TLSClientConfig = cfg
+	}
+	c := &rtmptConn{
+		client:   &http.Client{Transport: transport},
+		base:     scheme + "://" + host,
+		remote:   rtmptAddr(host),
+		interval: rtmptPollUnit,
+		notify:   make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	body, err := c.post(ctx, "/open/1", []byte{0})
+	if err != nil {
+		return nil, err
+	}
+	if c.sid = strings.TrimSpace(string(body)); c.sid == "" {
+		return nil, fmt.Errorf("rtmpt: open got empty session id")
+	}
+	return c, nil
+}
+
+func (c *rtmptConn) post(ctx context.Context, path string, data []byte) (body []byte, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.base+path, bytes.NewReader(data))
+	if err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", rtmptContentType)
+	req.Header.Set("Cache-Control", "no-cache")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		err = fmt.Errorf("rtmpt: POST %s got status %d", path, resp.StatusCode)
+		return
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// exchange 发送一次send/idle请求, 把响应中的数据放入读缓存
+func (c *rtmptConn) exchange(cmd string, data []byte, deadline time.Time) (err error) {
+	ctx := context.Background()
+	if !deadline.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, deadline)
+		defer cancel()
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	select {
+	case <-c.done:
+		return net.ErrClosed
+	default:
+	}
+	path := fmt.Sprintf("/%s/%s/%d", cmd, c.sid, c.seq)
+	c.seq++
+	body, err := c.post(ctx, path, data)
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			err = os.ErrDeadlineExceeded
+		}
+		return
+	}
+	if len(body) == 0 {
+		return fmt.Errorf("rtmpt: POST %s got empty response", path)
+	}
+	if c.interval = time.Duration(body[0]) * rtmptPollUnit; c.interval > rtmptMaxPollInterval {
+		c.interval = rtmptMaxPollInterval
+	}
+	if len(body) > 1 {
+		c.rlock.Lock()
+		c.rbuf.Write(body[1:])
+		c.rlock.Unlock()
+		select {
+		case c.notify <- struct{}{}:
+		default:
+		}
+	}
+	return
+}
+
+func (c *rtmptConn) Read(p []byte) (n int, err error) {
+	for {
+		c.rlock.Lock()
+		if c.rbuf.Len() > 0 {
+			n, err = c.rbuf.Read(p)
+			c.rlock.Unlock()
+			return
+		}
+		c.rlock.Unlock()
+
+		deadline := c.deadline(&c.readDeadline)
+		if !deadline.IsZero() && !time.Now().Before(deadline) {
+			return 0, os.ErrDeadlineExceeded
+		}
+		if err = c.exchange("idle", []byte{0}, deadline); err != nil {
+			return
+		}
+		c.rlock.Lock()
+		got := c.rbuf.Len() > 0
+		c.rlock.Unlock()
+		if got {
+			continue
+		}
+
+		c.lock.Lock()
+		wait := time.NewTimer(c.interval)
+		c.lock.Unlock()
+		select {
+		case <-wait.C:
+		case <-c.notify:
+			wait.Stop()
+		case <-c.done:
+			wait.Stop()
+			return 0, net.ErrClosed
+		}
+	}
+}
+
+func (c *rtmptConn) Write(p []byte) (n int, err error) {
+	if err = c.exchange("send", p, c.deadline(&c.writeDeadline)); err != nil {
+		return
+	}
+	return len(p), nil
+}
+
+func (c *rtmptConn) Close() (err error) {
+	c.closing.Do(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		c.lock.Lock()
+		_, err = c.post(ctx, fmt.Sprintf("/close/%s/%d", c.sid, c.seq), []byte{0})
+		c.seq++
+		close(c.done)
+		c.lock.Unlock()
+		c.client.CloseIdleConnections()
+	})
+	return
+}
+
+func (c *rtmptConn) deadline(t *time.Time) time.Time {
+	c.dlock.Lock()
+	defer c.dlock.Unlock()
+	return *t
+}
+
+func (c *rtmptConn) LocalAddr() net.Addr  { return rtmptAddr("") }
+func (c *rtmptConn) RemoteAddr() net.Addr { return c.remote }
+
+func (c *rtmptConn) SetDeadline(t time.Time) error {
+	c.dlock.Lock()
+	c.readDeadline, c.writeDeadline = t, t
+	c.dlock.Unlock()
+	return nil
+}
+
+func (c *rtmptConn) SetReadDeadline(t time.Time) error {
+	c.dlock.Lock()
+	c.readDeadline = t
+	c.dlock.Unlock()
+	return nil
+}
+
+func (c *rtmptConn) SetWriteDeadline(t time.Time) error {
+	c.dlock.Lock()
+	c.writeDeadline = t
+	c.dlock.Unlock()
+	return nil
+}
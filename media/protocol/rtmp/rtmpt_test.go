@@ -0,0 +1,71 @@
+package rtmp
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// rtmptEcho 把send收到的数据在之后的响应中原样返回
+type rtmptEcho struct {
+	lock    sync.Mutex
+	pending []byte
+	paths   []string
+}
+
+func (e *rtmptEcho) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.paths = append(e.paths, r.URL.Path)
+	switch {
+	case r.URL.Path == "/open/1":
+		w.Write([]byte("s1\n"))
+	case strings.HasPrefix(r.URL.Path, "/send/"):
+		e.pending = append(e.pending, body...)
+		w.Write([]byte{1})
+	case strings.HasPrefix(r.URL.Path, "/idle/"):
+		w.Write(append([]byte{1}, e.pending...))
+		e.pending = nil
+	case strings.HasPrefix(r.URL.Path, "/close/"):
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestRTMPT(t *testing.T) {
+	echo := &rtmptEcho{}
+	srv := httptest.NewServer(echo)
+	defer srv.Close()
+
+	opts := NewOptions()
+	opts.TcURL = "rtmpt://" + srv.Listener.Addr().String() + "/live/test"
+	c, err := dialNet(srv.Listener.Addr().String(), &opts)
+	require.Nil(t, err)
+	require.Equal(t, srv.Listener.Addr().String(), c.RemoteAddr().String())
+
+	n, err := c.Write([]byte("hello"))
+	require.Nil(t, err)
+	require.Equal(t, 5, n)
+	b := make([]byte, 16)
+	n, err = c.Read(b)
+	require.Nil(t, err)
+	require.Equal(t, "hello", string(b[:n]))
+
+	// 没有数据时读超时
+	c.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	_, err = c.Read(b)
+	require.NotNil(t, err)
+
+	require.Nil(t, c.Close())
+	echo.lock.Lock()
+	defer echo.lock.Unlock()
+	require.Equal(t, []string{"/open/1", "/send/s1/0", "/idle/s1/1"}, echo.paths[:3])
+	require.True(t, strings.HasPrefix(echo.paths[len(echo.paths)-1], "/close/s1/"))
+}
@@ -0,0 +1,268 @@
+package rtmp
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/bugVanisher/streamer/media/av"
+	"github.com/bugVanisher/streamer/media/container/flv/flvio"
+)
+
+var errSendQueueClosed = fmt.Errorf("rtmp: send queue closed")
+
+// SendQueuePolicy 发送队列满时的处理策略, 见Options.SendQueueSize
+type SendQueuePolicy string
+
+const (
+	SendQueueBlock      SendQueuePolicy = "block"       // 阻塞写入方直到队列有空间
+	SendQueueDropGOP    SendQueuePolicy = "drop-gop"    // 丢弃队列中最早的GOP
+	SendQueueDropNonKey SendQueuePolicy = "drop-nonkey" // 丢弃队列中的视频非关键帧
+)
+
+// ParseSendQueuePolicy 解析发送队列策略, 空字符串为SendQueueBlock
+func ParseSendQueuePolicy(s string) (SendQueuePolicy, error) {
+	switch policy := SendQueuePolicy(s); policy {
+	case "":
+		return SendQueueBlock, nil
+	case SendQueueBlock, SendQueueDropGOP, SendQueueDropNonKey:
+		return policy, nil
+	}
+	return "", fmt.Errorf("rtmp: invalid send queue policy %q", s)
+}
+
+// sendItem 发送队列中的一项, streams不为nil时为header变化
+type sendItem struct {
+	pkt      av.Packet
+	streams  []av.CodecData
+	metadata flvio.AMFMap // 入队时SetMetadata设置的onMetaData
+}
+
+// keep 不能丢弃的项: header变化, sequence header和script data
+func (item *sendItem) keep() bool {
+	return item.streams != nil || item.pkt.IsSequenceHeader() || item.pkt.IsScriptData()
+}
+
+func (item *sendItem) isKeyFrame() bool {
+	return item.streams == nil && item.pkt.IsVideo() && item.pkt.IsKeyFrame && !item.pkt.IsSequenceHeader()
+}
+
+func (item *sendItem) isNonKeyVideo() bool {
+	return !item.keep() && item.pkt.IsVideo() && !item.pkt.IsKeyFrame
+}
+
+// sendQueue 连接的异步发送队列, WritePacket放入队列后返回, 由独立goroutine写入网络,
+// 慢速的拉流端只会在队列中积压或按策略丢帧, 不会阻塞上游的分发循环
+type sendQueue struct {
+	dropped uint64 // 原子操作, 丢弃的音视频帧数
+
+	c      *conn
+	size   int
+	policy SendQueuePolicy
+
+	lock    sync.Mutex
+	cond    *sync.Cond
+	items   []sendItem
+	busy    bool // writer正在写入取出的项
+	waitKey bool // 丢弃过视频帧, 下一个视频关键帧之前的视频帧都丢弃
+	err     error
+	closed  bool
+	// headerSent 第一次WriteHeader已同步写入, 之后的header变化经过队列. 只在写入方goroutine中访问
+	headerSent bool
+}
+
+func newSendQueue(c *conn, size int, policy SendQueuePolicy) *sendQueue {
+	q := &sendQueue{c: c, size: size, policy: policy}
+	q.cond = sync.NewCond(&q.lock)
+	go q.run()
+	return q
+}
+
+// push 放入一项, 队列满时按策略丢帧或等待. writer出错后返回该错误
+func (q *sendQueue) push(item sendItem) (err error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	for {
+		if q.err != nil {
+			return q.err
+		}
+		if q.closed {
+			return errSendQueueClosed
+		}
+		if item.isKeyFrame() {
+			q.waitKey = false
+		} else if q.waitKey && item.isNonKeyVideo() {
+			q.drop(1)
+			return
+		}
+		if len(q.items) < q.size {
+			break
+		}
+		// 丢帧后可能进入等待关键帧的状态, 重新检查当前项
+		if !q.makeRoom() {
+			q.cond.Wait()
+		}
+	}
+	q.items = append(q.items, item)
+	q.cond.Broadcast()
+	return
+}
+
+// makeRoom 队列满时按策略丢帧, 返回是否丢弃了帧
+func (q *sendQueue) makeRoom() bool {
+	switch q.policy {
+	case SendQueueDropGOP:
+		return q.dropGOP() > 0
+	case SendQueueDropNonKey:
+		return q.dropNonKey() > 0
+	}
+	return false
+}
+
+// dropGOP 丢弃队首到下一个视频关键帧之前的包, 队列中没有关键帧时丢弃全部可丢弃的包并等待关键帧
+func (q *sendQueue) dropGOP() int {
+	next := -1
+	for i := 1; i < len(q.items); i++ {
+		if q.items[i].isKeyFrame() {
+			next = i
+			break
+		}
+	}
+	end := next
+	if next == -1 {
+		end = len(q.items)
+	}
+	kept := q.items[:0]
+	for i := range q.items[:end] {
+		if q.items[i].keep() {
+			kept = append(kept, q.items[i])
+		}
+	}
+	n := end - len(kept)
+	kept = append(kept, q.items[end:]...)
+	q.items = q.truncate(kept)
+	if next == -1 && n > 0 {
+		q.waitKey = true
+	}
+	q.drop(n)
+	return n
+}
+
+// dropNonKey 丢弃队列中的视频非关键帧, 之后的非关键帧参考了被丢弃的帧, 一直丢弃到下一个关键帧
+func (q *sendQueue) dropNonKey() int {
+	kept := q.items[:0]
+	for i := range q.items {
+		if !q.items[i].isNonKeyVideo() {
+			kept = append(kept, q.items[i])
+		}
+	}
+	n := len(q.items) - len(kept)
+	q.items = q.truncate(kept)
+	if n > 0 {
+		q.waitKey = true
+	}
+	q.drop(n)
+	return n
+}
+
+// truncate 清除kept之后的旧元素, 不持有被丢弃packet的数据
+func (q *sendQueue) truncate(kept []sendItem) []sendItem {
+	tail := q.items[len(kept):]
+	for i := range tail {
+		tail[i] = sendItem{}
+	}
+	return kept
+}
+
+func (q *sendQueue) drop(n int) {
+	if n <= 0 {
+		return
+	}
+	if atomic.AddUint64(&q.dropped, uint64(n)) == uint64(n) {
+		log.Warn().Str("ID", q.c.Info().ID).Str("remote", q.c.RemoteAddr()).Str("policy", string(q.policy)).
+			Msg("[rtmp] send queue full, start dropping frames")
+	}
+}
+
+// run 依次写入队列中的项, 队列为空时flush
+func (q *sendQueue) run() {
+	for {
+		q.lock.Lock()
+		for len(q.items) == 0 && !q.closed {
+			q.cond.Wait()
+		}
+		if q.closed {
+			q.lock.Unlock()
+			return
+		}
+		item := q.items[0]
+		q.items[0] = sendItem{}
+		q.items = q.items[1:]
+		empty := len(q.items) == 0
+		q.busy = true
+		q.cond.Broadcast()
+		q.lock.Unlock()
+
+		err := q.c.writeQueued(item, empty)
+
+		q.lock.Lock()
+		q.busy = false
+		if err != nil {
+			q.err = err
+			q.items = nil
+		}
+		q.cond.Broadcast()
+		q.lock.Unlock()
+		if err != nil {
+			return
+		}
+	}
+}
+
+// drain 等待队列中的项全部写入
+func (q *sendQueue) drain() error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	for (len(q.items) > 0 || q.busy) && q.err == nil && !q.closed {
+		q.cond.Wait()
+	}
+	return q.err
+}
+
+func (q *sendQueue) close() {
+	q.lock.Lock()
+	q.closed = true
+	q.items = nil
+	q.cond.Broadcast()
+	q.lock.Unlock()
+}
+
+func (q *sendQueue) len() int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return len(q.items)
+}
+
+// writeQueued writer goroutine写入队列中的一项, flush为true时写入后发送写缓冲
+func (self *conn) writeQueued(item sendItem, flush bool) (err error) {
+	self.wlock.Lock()
+	defer self.wlock.Unlock()
+	if item.streams != nil {
+		if len(item.streams) > 0 {
+			var tagHdrs []flvio.Tag
+			if tagHdrs, err = self.writeHeaderTo(self.avmsgsid, item.streams, item.metadata); err != nil {
+				return
+			}
+			self.streams = item.streams
+			self.tagHdrs = tagHdrs
+		}
+	} else if err = self.writePacketTo(self.avmsgsid, self.streams, self.tagHdrs, item.pkt); err != nil {
+		return
+	}
+	if flush && self.bufw.Buffered() > 0 {
+		err = self.flushWrite()
+	}
+	return
+}
@@ -0,0 +1,95 @@
+package rtmp
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bugVanisher/streamer/media/av"
+)
+
+// newTestSendQueue 不启动writer的发送队列, 模拟不读取的拉流端
+func newTestSendQueue(size int, policy SendQueuePolicy) *sendQueue {
+	q := &sendQueue{c: &conn{}, size: size, policy: policy}
+	q.cond = sync.NewCond(&q.lock)
+	return q
+}
+
+func testVideo(ts int, key bool) sendItem {
+	return sendItem{pkt: av.Packet{DataType: av.FLV_TAG_VIDEO, AVCPacketType: av.AVC_NALU, IsKeyFrame: key,
+		Time: av.MediaTime(ts)}}
+}
+
+func testAudio(ts int) sendItem {
+	return sendItem{pkt: av.Packet{DataType: av.FLV_TAG_AUDIO, AVCPacketType: av.AVC_NALU, Time: av.MediaTime(ts)}}
+}
+
+func queuedTimes(q *sendQueue) (times []int) {
+	for _, item := range q.items {
+		times = append(times, int(item.pkt.Time))
+	}
+	return
+}
+
+func TestSendQueueDropGOP(t *testing.T) {
+	q := newTestSendQueue(6, SendQueueDropGOP)
+	for _, item := range []sendItem{testVideo(0, true), testAudio(1), testVideo(2, false), testVideo(3, true),
+		testAudio(4), testVideo(5, false)} {
+		require.Nil(t, q.push(item))
+	}
+	// 队列满, 丢弃第一个GOP
+	require.Nil(t, q.push(testVideo(6, false)))
+	require.Equal(t, []int{3, 4, 5, 6}, queuedTimes(q))
+	require.Equal(t, uint64(3), q.dropped)
+
+	// 队列中没有下一个关键帧, 全部丢弃并等待关键帧, header变化保留
+	require.Nil(t, q.push(sendItem{streams: []av.CodecData{}}))
+	require.Nil(t, q.push(testAudio(7)))
+	require.Nil(t, q.push(testVideo(8, false)))
+	require.Equal(t, []int{0}, queuedTimes(q))
+	require.NotNil(t, q.items[0].streams)
+	require.Nil(t, q.push(testVideo(9, false)))
+	require.Nil(t, q.push(testAudio(10)))
+	require.Nil(t, q.push(testVideo(11, true)))
+	require.Equal(t, []int{0, 10, 11}, queuedTimes(q))
+	require.Equal(t, uint64(10), q.dropped)
+}
+
+func TestSendQueueDropNonKey(t *testing.T) {
+	q := newTestSendQueue(4, SendQueueDropNonKey)
+	for _, item := range []sendItem{testVideo(0, true), testVideo(1, false), testAudio(2), testVideo(3, false)} {
+		require.Nil(t, q.push(item))
+	}
+	require.Nil(t, q.push(testAudio(4)))
+	require.Equal(t, []int{0, 2, 4}, queuedTimes(q))
+	// 非关键帧丢弃到下一个关键帧
+	require.Nil(t, q.push(testVideo(5, false)))
+	require.Nil(t, q.push(testVideo(6, true)))
+	require.Equal(t, []int{0, 2, 4, 6}, queuedTimes(q))
+	require.Equal(t, uint64(3), q.dropped)
+
+	// 没有可丢弃的帧时等待writer
+	done := make(chan error)
+	go func() { done <- q.push(testAudio(7)) }()
+	q.lock.Lock()
+	q.items = q.items[1:]
+	q.cond.Broadcast()
+	q.lock.Unlock()
+	require.Nil(t, <-done)
+	require.Equal(t, []int{2, 4, 6, 7}, queuedTimes(q))
+
+	q.close()
+	require.Equal(t, errSendQueueClosed, q.push(testAudio(8)))
+}
+
+func TestParseSendQueuePolicy(t *testing.T) {
+	policy, err := ParseSendQueuePolicy("")
+	require.Nil(t, err)
+	require.Equal(t, SendQueueBlock, policy)
+	policy, err = ParseSendQueuePolicy("drop-gop")
+	require.Nil(t, err)
+	require.Equal(t, SendQueueDropGOP, policy)
+	_, err = ParseSendQueuePolicy("drop-all")
+	require.NotNil(t, err)
+}
@@ -0,0 +1,91 @@
+package rtmp
+
+import (
+	"bytes"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bugVanisher/streamer/media/av"
+	"github.com/bugVanisher/streamer/media/codec/aacparser"
+	"github.com/bugVanisher/streamer/media/codec/h264parser"
+	"github.com/bugVanisher/streamer/media/container/es"
+	"github.com/bugVanisher/streamer/media/container/flv/flvio"
+)
+
+// receiveHeaderTags 推流端WriteHeader(streams), 返回对端收到的音视频tag
+func receiveHeaderTags(t *testing.T, streams []av.CodecData) (tags []flvio.Tag) {
+	wc, rc := net.Pipe()
+	w, r := newConn(wc), newConn(rc)
+	defer w.Close()
+	defer r.Close()
+	w.stage, w.avmsgsid = stageCommandDone, 1
+	errc := make(chan error, 1)
+	go func() {
+		err := w.WriteHeader(streams)
+		if err == nil {
+			err = w.flushWrite()
+		}
+		errc <- err
+	}()
+	for len(tags) < len(streams) {
+		tag, err := r.pollAVTag()
+		require.Nil(t, err)
+		if r.msgtypeid == msgtypeidVideoMsg || r.msgtypeid == msgtypeidAudioMsg {
+			require.Equal(t, uint32(1), r.msgsid)
+			tags = append(tags, tag)
+		}
+	}
+	require.Nil(t, <-errc)
+	return
+}
+
+func TestWriteHeaderSilenceAAC(t *testing.T) {
+	// 静音填充的CodecData没有推流端的tag, 仍要发出AAC sequence header
+	silence, err := aacparser.NewSilenceCodecData(44100, av.CH_STEREO)
+	require.Nil(t, err)
+	tags := receiveHeaderTags(t, []av.CodecData{silence})
+	require.Equal(t, uint8(flvio.TAG_AUDIO), tags[0].Type)
+	require.Equal(t, uint8(flvio.SOUND_AAC), tags[0].SoundFormat)
+	require.Equal(t, uint8(flvio.AAC_SEQHDR), tags[0].AACPacketType)
+	aac, err := aacparser.NewCodecDataFromMPEG4AudioConfigBytes(tags[0].Data)
+	require.Nil(t, err)
+	require.Equal(t, 44100, aac.SampleRate())
+	require.Equal(t, av.CH_STEREO, aac.ChannelLayout())
+}
+
+func TestWriteHeaderES(t *testing.T) {
+	// .h264/.aac裸流的CodecData由参数集和ADTS头生成, 同样要发出sequence header
+	sps := []byte{0x67, 0x64, 0x00, 0x1e, 0xac, 0xd9, 0x40, 0xa0, 0x2f, 0xf9, 0x70, 0x11, 0x00, 0x00, 0x03,
+		0x00, 0x01, 0x00, 0x00, 0x03, 0x00, 0x32, 0x0f, 0x16, 0x2d, 0x96}
+	pps := []byte{0x68, 0xeb, 0xe3, 0xcb, 0x22, 0xc0}
+	var annexb []byte
+	for _, nalu := range [][]byte{sps, pps, {0x65, 0x88, 0x01}} {
+		annexb = append(append(annexb, 0, 0, 0, 1), nalu...)
+	}
+	config := aacparser.MPEG4AudioConfig{ObjectType: aacparser.AOT_AAC_LC, SampleRateIndex: 3, ChannelConfig: 1}
+	config.Complete()
+	adts := make([]byte, aacparser.ADTSHeaderLength)
+	aacparser.FillADTSHeader(adts, config, 1024, 2)
+	adts = append(adts, 0, 0)
+
+	d := es.NewMergeDemuxer(es.NewVideoDemuxer(bytes.NewReader(annexb), av.H264, 25), es.NewAudioDemuxer(bytes.NewReader(adts)))
+	streams, err := d.Streams()
+	require.Nil(t, err)
+	tags := receiveHeaderTags(t, streams)
+
+	require.Equal(t, uint8(flvio.TAG_VIDEO), tags[0].Type)
+	require.Equal(t, uint8(flvio.VIDEO_H264), tags[0].CodecID)
+	require.Equal(t, uint8(flvio.AVC_SEQHDR), tags[0].AVCPacketType)
+	h264, err := h264parser.NewCodecDataFromAVCDecoderConfRecord(tags[0].Data)
+	require.Nil(t, err)
+	require.Equal(t, sps, h264.SPS())
+
+	require.Equal(t, uint8(flvio.TAG_AUDIO), tags[1].Type)
+	require.Equal(t, uint8(flvio.AAC_SEQHDR), tags[1].AACPacketType)
+	aac, err := aacparser.NewCodecDataFromMPEG4AudioConfigBytes(tags[1].Data)
+	require.Nil(t, err)
+	require.Equal(t, 48000, aac.SampleRate())
+	require.Equal(t, av.CH_MONO, aac.ChannelLayout())
+}
@@ -0,0 +1,815 @@
+package rtmp
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bugVanisher/streamer/common/acl"
+	"github.com/bugVanisher/streamer/common/output"
+	"github.com/bugVanisher/streamer/media/av"
+	"github.com/bugVanisher/streamer/media/av/pktque"
+	"github.com/bugVanisher/streamer/media/av/queue"
+	"github.com/bugVanisher/streamer/media/protocol/common"
+	"github.com/bugVanisher/streamer/statistics"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	ErrServerClosed    = errors.New("rtmp: server closed")
+	ErrStreamPublished = errors.New("rtmp: stream already published")
+	ErrSessionNotFound = errors.New("rtmp: session not found")
+	ErrSeekOutOfBuffer = errors.New("rtmp: seek position not in buffer")
+	ErrSessionNotPlay  = errors.New("rtmp: session is not playing")
+)
+
+// StreamKey 流的路由key, 格式为app/stream, 指定了vhost时为vhost/app/stream
+func StreamKey(info common.Info) string {
+	if info.Vhost != "" {
+		return info.Vhost + "/" + info.App + "/" + info.StreamName
+	}
+	return info.App + "/" + info.StreamName
+}
+
+// serverStream 服务端的一路流, 推流写入queue, 拉流从queue的游标读取
+type serverStream struct {
+	key        string
+	queue      *queue.Queue
+	publisher  string // 推流端地址, 为空表示没有推流
+	players    int
+	publishAt  time.Time
+	waitingPub bool
+	egress     *egressLimiter // 拉流会话共享的出口带宽上限
+}
+
+// StreamInfo 服务端流的状态
+type StreamInfo struct {
+	Key        string    `json:"key"`
+	Publishing bool      `json:"publishing"`
+	Publisher  string    `json:"publisher,omitempty"`
+	Players    int       `json:"players"`
+	PublishAt  time.Time `json:"publish_at,omitempty"`
+	// EgressLimit 拉流出口总带宽上限(字节/秒), 0为不限制
+	EgressLimit int64 `json:"egress_limit,omitempty"`
+	// Throttled 拉流会话因超过带宽份额而等待的次数和累计时间
+	Throttled     int64         `json:"throttled,omitempty"`
+	ThrottledTime time.Duration `json:"throttled_time,omitempty"`
+}
+
+// serverSession 服务端的一个连接
+type serverSession struct {
+	id         string
+	conn       Conn
+	remote     string
+	key        string
+	publishing bool
+	playing    bool
+	startAt    time.Time
+	debugTimer *time.Timer
+	tracks     *pktque.TrackToggleDemuxer // 拉流会话的轨道开关
+	priority   Priority                   // 拉流会话的优先级, 见EnableShedding
+	monitor    *sessionMonitor            // 推流或拉流的流统计和健康分
+}
+
+// SessionInfo 服务端会话的状态
+type SessionInfo struct {
+	ID         string    `json:"id"`
+	Remote     string    `json:"remote"`
+	Key        string    `json:"key,omitempty"`
+	Publishing bool      `json:"publishing"`
+	Playing    bool      `json:"playing"`
+	StartAt    time.Time `json:"start_at"`
+	Debugging  bool      `json:"debugging"`
+	DebugFile  string    `json:"debug_file,omitempty"`
+	// Subscription 拉流会话的订阅统计
+	Subscription *queue.CursorStat `json:"subscription,omitempty"`
+	// Tracks 拉流会话的轨道开关状态
+	Tracks *pktque.TrackState `json:"tracks,omitempty"`
+	// Priority 拉流会话的优先级
+	Priority string `json:"priority,omitempty"`
+	// Health 推流或拉流的健康分, 0-100, 见statistics.Health
+	Health int `json:"health"`
+	// Degraded 有AlertRules告警正在触发
+	Degraded bool `json:"degraded"`
+	// Overhead 最近一个统计周期连接的chunk头等协议开销百分比
+	Overhead float64 `json:"overhead"`
+}
+
+// Server rtmp服务端, 按app/stream把推流分发给拉流
+type Server struct {
+	Addr string
+	// ACL 可选, 在accept时执行访问控制
+	ACL *acl.ACL
+	// TLSConfig 可选, ServeTLS/ListenAndServeTLS的TLS配置, 其中没有证书时需要指定证书文件
+	TLSConfig *tls.Config
+	// JournalDir 可选, 不为空时每个会话的命令日志写入该目录
+	JournalDir string
+	// DebugDir 可选, 会话debug抓取文件的输出目录, 为空时使用output配置的debug目录
+	DebugDir string
+	// AlertRules 可选, 每个推流和拉流会话的统计周期按规则检查, 告警触发期间会话标记为Degraded
+	AlertRules []statistics.AlertRule
+	// OnAlert 可选, 会话告警触发和恢复时回调, id为会话ID, e.Stream为流key. 在事件循环中调用, 不应阻塞
+	OnAlert func(id string, e statistics.AlertEvent)
+
+	opts []Option
+
+	lock     sync.Mutex
+	streams  map[string]*serverStream
+	listener net.Listener
+	// aclListener 设置了ACL时包装的listener, 用于ACLStats
+	aclListener *acl.Listener
+	conns       map[net.Conn]struct{}
+	sessions    map[string]*serverSession
+	// subscribers 拉流游标, key为会话ID
+	subscribers map[string]*queue.QueueCursor
+	seq         uint64
+	closed      bool
+	serveErr    error // accept出错退出时的错误
+	// egressLimits 按流设置的出口带宽上限, 见SetEgressLimit
+	egressLimits map[string]int64
+	// vhostHooks 按虚拟主机设置的hook, 见SetVhostHook
+	vhostHooks map[string]Hook
+	// recoveryPoints 按流设置是否把recovery point帧当作关键帧, 见SetRecoveryPoint
+	recoveryPoints map[string]bool
+	// statInterval 会话流统计的周期
+	statInterval time.Duration
+}
+
+// NewServer 创建rtmp服务端, opt作用于每个accept的连接
+func NewServer(addr string, opt ...Option) *Server {
+	return &Server{
+		Addr:        addr,
+		opts:        opt,
+		streams:     make(map[string]*serverStream),
+		conns:       make(map[net.Conn]struct{}),
+		sessions:    make(map[string]*serverSession),
+		subscribers: make(map[string]*queue.QueueCursor),
+
+		egressLimits: make(map[string]int64),
+		vhostHooks:   make(map[string]Hook),
+
+		recoveryPoints: make(map[string]bool),
+
+		statInterval: statistics.StatInterval,
+	}
+}
+
+// ListenAndServe 监听Addr并处理连接, 阻塞直到Close
+func (s *Server) ListenAndServe() error {
+	addr := s.Addr
+	if addr == "" {
+		addr = ":1935"
+	}
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// ListenAndServeTLS 监听Addr并以rtmps处理连接, 阻塞直到Close. Addr为空时监听:443
+func (s *Server) ListenAndServeTLS(certFile, keyFile string) error {
+	addr := s.Addr
+	if addr == "" {
+		addr = ":443"
+	}
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.ServeTLS(l, certFile, keyFile)
+}
+
+// ServeTLS 在l上accept连接并握手TLS后处理, 阻塞直到Close. certFile/keyFile为PEM格式的证书和私钥,
+// TLSConfig中已有证书时可以为空. ACL在TLS握手之前执行
+func (s *Server) ServeTLS(l net.Listener, certFile, keyFile string) error {
+	cfg := &tls.Config{}
+	if s.TLSConfig != nil {
+		cfg = s.TLSConfig.Clone()
+	}
+	if certFile != "" || keyFile != "" || (len(cfg.Certificates) == 0 && cfg.GetCertificate == nil) {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			l.Close()
+			return err
+		}
+		cfg.Certificates = append(cfg.Certificates, cert)
+	}
+	var al *acl.Listener
+	if s.ACL != nil {
+		al = acl.NewListener(l, s.ACL)
+		l = al
+	}
+	return s.serve(tls.NewListener(l, cfg), al)
+}
+
+// Serve 在l上accept连接并处理, 阻塞直到Close
+func (s *Server) Serve(l net.Listener) error {
+	var al *acl.Listener
+	if s.ACL != nil {
+		al = acl.NewListener(l, s.ACL)
+		l = al
+	}
+	return s.serve(l, al)
+}
+
+func (s *Server) serve(l net.Listener, al *acl.Listener) error {
+	s.lock.Lock()
+	if s.closed {
+		s.lock.Unlock()
+		l.Close()
+		return ErrServerClosed
+	}
+	s.listener = l
+	s.aclListener = al
+	s.lock.Unlock()
+	log.Info().Str("addr", l.Addr().String()).Msg("[rtmp] server listening")
+
+	for {
+		nc, err := l.Accept()
+		if err != nil {
+			s.lock.Lock()
+			closed := s.closed
+			s.lock.Unlock()
+			if closed {
+				return ErrServerClosed
+			}
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				time.Sleep(10 * time.Millisecond)
+				continue
+			}
+			s.lock.Lock()
+			s.serveErr = err
+			s.lock.Unlock()
+			return err
+		}
+		go s.handleConn(nc)
+	}
+}
+
+// Listener 返回正在使用的listener, 未开始Serve时为nil
+func (s *Server) Listener() net.Listener {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.listener
+}
+
+// ACLStats 返回ACL的accept、拒绝和限速统计, 未设置ACL或未开始Serve时ok为false
+func (s *Server) ACLStats() (stats acl.Stats, ok bool) {
+	s.lock.Lock()
+	al := s.aclListener
+	s.lock.Unlock()
+	if al == nil {
+		return stats, false
+	}
+	return al.Stats(), true
+}
+
+// Health 服务端已关闭或accept出错退出时返回错误
+func (s *Server) Health() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.health()
+}
+
+func (s *Server) health() error {
+	if s.closed {
+		return ErrServerClosed
+	}
+	return s.serveErr
+}
+
+// Ready 监听已建立、流注册表已初始化且服务正常时返回nil
+func (s *Server) Ready() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err := s.health(); err != nil {
+		return err
+	}
+	if s.listener == nil {
+		return errors.New("rtmp: listener not bound")
+	}
+	if s.streams == nil || s.sessions == nil {
+		return errors.New("rtmp: registry not initialized")
+	}
+	return nil
+}
+
+// Close 停止accept并断开所有连接
+func (s *Server) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.closed = true
+	for nc := range s.conns {
+		nc.Close()
+	}
+	for _, st := range s.streams {
+		st.queue.Close()
+	}
+	if s.listener != nil {
+		return s.listener.Close()
+	}
+	return nil
+}
+
+// Streams 返回当前所有流的状态
+func (s *Server) Streams() []StreamInfo {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	infos := make([]StreamInfo, 0, len(s.streams))
+	for _, st := range s.streams {
+		info := StreamInfo{Key: st.key, Players: st.players}
+		info.EgressLimit, info.Throttled, info.ThrottledTime = st.egress.stat()
+		if st.publisher != "" {
+			info.Publishing = true
+			info.Publisher = st.publisher
+			info.PublishAt = st.publishAt
+		}
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Key < infos[j].Key })
+	return infos
+}
+
+// Sessions 返回当前所有会话的状态
+func (s *Server) Sessions() []SessionInfo {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	infos := make([]SessionInfo, 0, len(s.sessions))
+	for _, ss := range s.sessions {
+		info := ss.info()
+		if cursor, ok := s.subscribers[ss.id]; ok {
+			stat := cursor.Stat()
+			info.Subscription = &stat
+		}
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].StartAt.Before(infos[j].StartAt) })
+	return infos
+}
+
+// StartDebug 在运行中的会话上开启debug抓取, duration<=0时一直抓取到StopDebug或会话结束, 返回抓取文件路径.
+// 会话已经在抓取时返回正在使用的文件.
+func (s *Server) StartDebug(id string, duration time.Duration) (string, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	ss, ok := s.sessions[id]
+	if !ok {
+		return "", ErrSessionNotFound
+	}
+	d := ss.conn.Debuger()
+	if d.Enabled() {
+		return d.FileName(), nil
+	}
+	name := fmt.Sprintf("rtmpdebug.%s.%s.log", id, time.Now().Format("20060102T150405"))
+	file := output.Path(output.KindDebug, name)
+	if s.DebugDir != "" {
+		file = filepath.Join(s.DebugDir, name)
+	}
+	seconds := int64(-1)
+	if duration > 0 {
+		seconds = int64((duration + time.Second - 1) / time.Second)
+	}
+	if !d.StartDebug(file, seconds) {
+		return "", fmt.Errorf("rtmp: create debug file %s failed", file)
+	}
+	if ss.debugTimer != nil {
+		ss.debugTimer.Stop()
+		ss.debugTimer = nil
+	}
+	// Debuger只在写入时检查时长, 空闲的会话由timer停止
+	if duration > 0 {
+		ss.debugTimer = time.AfterFunc(duration, d.StopDebug)
+	}
+	log.Info().Str("session", id).Str("file", file).Dur("duration", duration).Msg("[rtmp] session debug start")
+	return file, nil
+}
+
+// StopDebug 停止会话的debug抓取, 返回抓取文件路径
+func (s *Server) StopDebug(id string) (string, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	ss, ok := s.sessions[id]
+	if !ok {
+		return "", ErrSessionNotFound
+	}
+	if ss.debugTimer != nil {
+		ss.debugTimer.Stop()
+		ss.debugTimer = nil
+	}
+	d := ss.conn.Debuger()
+	d.StopDebug()
+	log.Info().Str("session", id).Str("file", d.FileName()).Msg("[rtmp] session debug stop")
+	return d.FileName(), nil
+}
+
+// SetTrack 在拉流会话上打开或关闭音频/视频轨道, 在下一个关键帧生效并重新发送header
+func (s *Server) SetTrack(id, track string, enabled bool) (state pktque.TrackState, err error) {
+	s.lock.Lock()
+	ss, ok := s.sessions[id]
+	var tracks *pktque.TrackToggleDemuxer
+	if ok {
+		tracks = ss.tracks
+	}
+	s.lock.Unlock()
+	if !ok {
+		return state, ErrSessionNotFound
+	}
+	if tracks == nil {
+		return state, ErrSessionNotPlay
+	}
+	if state, err = tracks.SetTrack(track, enabled); err != nil {
+		return
+	}
+	log.Info().Str("session", id).Str("track", track).Bool("enabled", enabled).Msg("[rtmp] session set track")
+	return
+}
+
+func (ss *serverSession) info() SessionInfo {
+	d := ss.conn.Debuger()
+	var tracks *pktque.TrackState
+	if ss.tracks != nil {
+		state := ss.tracks.State()
+		tracks = &state
+	}
+	var priority string
+	if ss.playing {
+		priority = ss.priority.String()
+	}
+	return SessionInfo{
+		ID:         ss.id,
+		Remote:     ss.remote,
+		Key:        ss.key,
+		Publishing: ss.publishing,
+		Playing:    ss.playing,
+		StartAt:    ss.startAt,
+		Debugging:  d.Enabled(),
+		DebugFile:  d.FileName(),
+		Tracks:     tracks,
+		Priority:   priority,
+		Health:     ss.monitor.score(),
+		Degraded:   ss.monitor.degraded(),
+		Overhead:   ss.monitor.overheadPercent(),
+	}
+}
+
+// OnPlayOrPublish 实现Hook接口, 拒绝重复推流, 再由虚拟主机的hook决定
+func (s *Server) OnPlayOrPublish(info common.Info) error {
+	s.lock.Lock()
+	st, ok := s.streams[StreamKey(info)]
+	published := ok && st.publisher != ""
+	hook := s.vhostHook(info.Vhost)
+	s.lock.Unlock()
+	if published {
+		return ErrStreamPublished
+	}
+	if hook != nil {
+		return hook.OnPlayOrPublish(info)
+	}
+	return nil
+}
+
+// OnUnpublish 实现Hook接口, 推流端停止推流后立即关闭queue, 拉流读完缓存后结束
+func (s *Server) OnUnpublish(info common.Info) {
+	s.lock.Lock()
+	if st, ok := s.streams[StreamKey(info)]; ok && st.publisher != "" {
+		st.queue.Close()
+	}
+	s.lock.Unlock()
+	if hook := s.hookOf(info); hook != nil {
+		hook.OnUnpublish(info)
+	}
+}
+
+// OnPlayControl 实现PlayControlHook接口, vhost的Hook实现了PlayControlHook时由其决定是否允许pause/seek
+func (s *Server) OnPlayControl(info common.Info, ctl PlayControl) error {
+	if hook, ok := s.hookOf(info).(PlayControlHook); ok {
+		return hook.OnPlayControl(info, ctl)
+	}
+	return nil
+}
+
+func (s *Server) connOptions(nc net.Conn) ([]Option, *os.File) {
+	opts := append([]Option{WithServerHook(s), WithStreamHandler(s.handleStream)}, s.opts...)
+	if s.detectRecoveryPoint() {
+		opts = append(opts, WithRecoveryPoint(true))
+	}
+	if s.JournalDir == "" {
+		return opts, nil
+	}
+	name := fmt.Sprintf("%s_%s.journal", time.Now().Format("20060102T150405.000"),
+		strings.NewReplacer(":", "_", "[", "", "]", "").Replace(nc.RemoteAddr().String()))
+	f, err := os.Create(filepath.Join(s.JournalDir, name))
+	if err != nil {
+		log.Error().Err(err).Msg("[rtmp] create journal failed")
+		return opts, nil
+	}
+	return append(opts, WithJournal(NewJournal(f))), f
+}
+
+func (s *Server) handleConn(nc net.Conn) {
+	s.lock.Lock()
+	if s.closed {
+		s.lock.Unlock()
+		nc.Close()
+		return
+	}
+	s.conns[nc] = struct{}{}
+	s.lock.Unlock()
+
+	opts, journal := s.connOptions(nc)
+	c := NewConn(nc, opts...)
+	s.lock.Lock()
+	s.seq++
+	ss := &serverSession{
+		id:      strconv.FormatUint(s.seq, 10),
+		conn:    c,
+		remote:  nc.RemoteAddr().String(),
+		startAt: time.Now(),
+		monitor: newSessionMonitor(),
+	}
+	s.sessions[ss.id] = ss
+	s.lock.Unlock()
+	defer func() {
+		c.Close()
+		if journal != nil {
+			journal.Close()
+		}
+		s.lock.Lock()
+		delete(s.conns, nc)
+		delete(s.sessions, ss.id)
+		if ss.debugTimer != nil {
+			ss.debugTimer.Stop()
+		}
+		s.lock.Unlock()
+		ss.monitor.stop()
+		c.Debuger().StopDebug()
+	}()
+
+	if err := c.HandshakeServer(); err != nil {
+		log.Debug().Err(err).Str("remote", nc.RemoteAddr().String()).Msg("[rtmp] server handshake failed")
+		return
+	}
+	if err := c.ReadConnect(); err != nil {
+		log.Debug().Err(err).Str("remote", nc.RemoteAddr().String()).Msg("[rtmp] server read connect failed")
+		return
+	}
+
+	info := c.Info()
+	key := StreamKey(info)
+	s.lock.Lock()
+	ss.key, ss.publishing, ss.playing = key, info.IsPublishing, info.IsPlaying
+	if info.IsPlaying {
+		ss.priority = playPriority(info)
+	}
+	s.lock.Unlock()
+	if len(s.AlertRules) > 0 && (info.IsPublishing || info.IsPlaying) {
+		ss.monitor.setAlerter(statistics.NewAlerter(key, s.AlertRules, func(e statistics.AlertEvent) {
+			if s.OnAlert != nil {
+				s.OnAlert(ss.id, e)
+			}
+		}))
+	}
+	if info.IsPublishing {
+		ss.monitor.setWire(c.RxBytes)
+	} else if info.IsPlaying {
+		ss.monitor.setWire(c.TxBytes)
+	}
+	ss.monitor.start(s.statInterval)
+	var err error
+	if info.IsPublishing {
+		err = s.handlePublish(key, c.RemoteAddr(), c, ss.monitor)
+	} else if info.IsPlaying {
+		// 拉流不经过连接的Hook, 在这里由虚拟主机的hook决定
+		if hook := s.hookOf(info); hook != nil {
+			err = hook.OnPlayOrPublish(info)
+		}
+		if err == nil {
+			err = s.handlePlay(key, ss.id, c)
+		}
+	}
+	log.Info().Err(err).Str("key", key).Str("remote", nc.RemoteAddr().String()).
+		Bool("publish", info.IsPublishing).Msg("[rtmp] server session end")
+}
+
+// acquire 获取或创建key对应的流
+func (s *Server) acquire(key string) *serverStream {
+	st, ok := s.streams[key]
+	if !ok {
+		st = &serverStream{key: key, queue: queue.NewQueue(), egress: newEgressLimiter(s.egressLimit(key))}
+		st.queue.SetSID(key)
+		st.queue.SetCursorHook(s)
+		st.queue.SetRecoveryPoint(s.recoveryPoint(key))
+		s.streams[key] = st
+	}
+	return st
+}
+
+// release 流没有推流和拉流时删除
+func (s *Server) release(st *serverStream) {
+	if st.publisher == "" && st.players == 0 && s.streams[st.key] == st {
+		delete(s.streams, st.key)
+	}
+}
+
+// handleStream 处理同一连接上额外的推流消息流
+func (s *Server) handleStream(ms *Stream) {
+	defer ms.Close()
+	key := StreamKey(ms.Info())
+	err := s.handlePublish(key, ms.RemoteAddr(), ms, nil)
+	log.Info().Err(err).Str("key", key).Str("remote", ms.RemoteAddr()).
+		Uint32("msgsid", ms.ID()).Msg("[rtmp] server stream end")
+}
+
+// handlePublish 推流写入queue, mon不为nil时统计收到的packet
+func (s *Server) handlePublish(key, remote string, src av.Demuxer, mon *sessionMonitor) error {
+	s.lock.Lock()
+	st := s.acquire(key)
+	if st.publisher != "" {
+		s.lock.Unlock()
+		return ErrStreamPublished
+	}
+	st.publisher = remote
+	st.publishAt = time.Now()
+	s.lock.Unlock()
+	log.Info().Str("key", key).Str("remote", remote).Msg("[rtmp] server publish start")
+
+	var topts []av.Option
+	if mon != nil {
+		topts = append(topts, av.WithAfterReadHeaders(mon.setCodecData), av.WithAfterReadPacket(mon.stat))
+	}
+	err := av.NewTransport(topts...).CopyAV(context.Background(), st.queue, src)
+
+	s.lock.Lock()
+	st.publisher = ""
+	// 推流结束后关闭queue, 拉流读到EOF后退出, 之后的推流使用新的queue
+	st.queue.Close()
+	if s.streams[key] == st {
+		delete(s.streams, key)
+	}
+	s.lock.Unlock()
+	return err
+}
+
+// OnCursorAttach 实现queue.CursorHook, 记录拉流会话的游标
+func (s *Server) OnCursorAttach(c *queue.QueueCursor) {
+	s.lock.Lock()
+	s.subscribers[c.ID()] = c
+	s.lock.Unlock()
+}
+
+// OnCursorDetach 实现queue.CursorHook
+func (s *Server) OnCursorDetach(c *queue.QueueCursor, stat queue.CursorStat) {
+	s.lock.Lock()
+	if s.subscribers[c.ID()] == c {
+		delete(s.subscribers, c.ID())
+	}
+	s.lock.Unlock()
+	log.Info().Str("session", stat.ID).Str("key", stat.SID).Int64("packets", stat.Packets).Int64("bytes", stat.Bytes).
+		Dur("duration", stat.Duration).Msg("[rtmp] server subscriber detach")
+}
+
+// handlePlay 拉流, id为会话ID, 同时作为游标的订阅者ID
+func (s *Server) handlePlay(key, id string, c Conn) error {
+	s.lock.Lock()
+	st := s.acquire(key)
+	st.players++
+	s.lock.Unlock()
+	st.egress.join(id)
+	defer func() {
+		st.egress.leave(id)
+		s.lock.Lock()
+		st.players--
+		s.release(st)
+		s.lock.Unlock()
+	}()
+	log.Info().Str("key", key).Str("remote", c.RemoteAddr()).Msg("[rtmp] server play start")
+
+	cursor := newPlayCursor(st.queue.CursorWithOptions(id, key, playCursorOptions(c.Info())))
+	defer cursor.Close()
+	go func() {
+		err := c.ServePlayControl(cursor.control)
+		log.Debug().Err(err).Str("key", key).Str("remote", c.RemoteAddr()).Msg("[rtmp] server play control end")
+		cursor.Close()
+	}()
+	var src av.Demuxer = cursor
+	if interval, ok := playPreviewInterval(c.Info()); ok {
+		// 关键帧预览流, 只有视频关键帧
+		src = pktque.NewKeyFrameDemuxer(cursor, interval)
+	}
+	tracks := pktque.NewTrackToggleDemuxer(src)
+	mon := newSessionMonitor()
+	s.lock.Lock()
+	if ss, ok := s.sessions[id]; ok {
+		ss.tracks = tracks
+		mon = ss.monitor
+	}
+	s.lock.Unlock()
+	return av.NewTransport(av.WithAfterReadHeaders(mon.setCodecData), av.WithAfterWritePacket(mon.stat),
+		av.WithAfterReadPacket(func(pkt *av.Packet) error {
+			st.egress.wait(id, len(pkt.Data))
+			return nil
+		})).CopyAV(context.Background(), c, tracks)
+}
+
+// 拉流URL中preview参数的取值
+const (
+	PreviewKeyFrame = "keyframe" // 只输出视频关键帧
+	Preview1FPS     = "1fps"     // 只输出视频关键帧, 最多每秒一帧
+)
+
+// playPreviewInterval 拉流URL带preview参数时输出关键帧预览流, 返回关键帧的最小间隔
+func playPreviewInterval(info common.Info) (interval time.Duration, ok bool) {
+	u, err := url.Parse(info.RawURL)
+	if err != nil {
+		return
+	}
+	switch preview := u.Query().Get("preview"); preview {
+	case "":
+	case PreviewKeyFrame:
+		ok = true
+	case Preview1FPS:
+		interval, ok = time.Second, true
+	default:
+		log.Warn().Str("url", info.RawURL).Msg("[rtmp] ignore invalid preview " + preview)
+	}
+	return
+}
+
+// playCursorOptions 从play的URL参数解析起播位置, 参数无效时使用默认值
+func playCursorOptions(info common.Info) queue.CursorOptions {
+	u, err := url.Parse(info.RawURL)
+	if err != nil {
+		return queue.CursorOptions{}
+	}
+	opts, err := queue.ParseCursorOptions(u.Query())
+	if err != nil {
+		log.Warn().Err(err).Str("url", info.RawURL).Msg("[rtmp] ignore invalid play options")
+		return queue.CursorOptions{}
+	}
+	return opts
+}
+
+// playCursor 拉流游标, 处理拉流端的pause/seek
+type playCursor struct {
+	*queue.QueueCursor
+	lock   sync.Mutex
+	cond   *sync.Cond
+	paused bool
+	closed bool
+}
+
+func newPlayCursor(cursor *queue.QueueCursor) *playCursor {
+	p := &playCursor{QueueCursor: cursor}
+	p.cond = sync.NewCond(&p.lock)
+	return p
+}
+
+// ReadPacket 暂停时阻塞, 直到恢复或拉流端断开
+func (p *playCursor) ReadPacket() (av.Packet, error) {
+	p.lock.Lock()
+	for p.paused && !p.closed {
+		p.cond.Wait()
+	}
+	p.lock.Unlock()
+	return p.QueueCursor.ReadPacket()
+}
+
+func (p *playCursor) control(ctl PlayControl) error {
+	switch ctl.Command {
+	case PlayControlPause:
+		// 直播恢复时不回到暂停位置, 游标落后于缓存时会自动跳到最新的关键帧
+		p.lock.Lock()
+		p.paused = ctl.Pause
+		p.cond.Broadcast()
+		p.lock.Unlock()
+	case PlayControlSeek:
+		if !p.SeekToTime(ctl.Pos) {
+			return ErrSeekOutOfBuffer
+		}
+	}
+	return nil
+}
+
+// Close 可重复调用, 写packet的goroutine和读命令的goroutine都会关闭游标, 只有第一次生效
+func (p *playCursor) Close() error {
+	p.lock.Lock()
+	if p.closed {
+		p.lock.Unlock()
+		return nil
+	}
+	p.closed = true
+	p.cond.Broadcast()
+	p.lock.Unlock()
+	return p.QueueCursor.Close()
+}
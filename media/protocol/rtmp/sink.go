@@ -0,0 +1,249 @@
+package rtmp
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/bugVanisher/streamer/media/av"
+	"github.com/bugVanisher/streamer/media/av/queue"
+)
+
+// SinkPolicy 外部sink写入跟不上推流时的处理策略
+type SinkPolicy string
+
+const (
+	SinkBlock   SinkPolicy = "block"   // 不主动跳帧, 落后超出queue缓存后从最新的关键帧继续
+	SinkSkip    SinkPolicy = "skip"    // 落后超过SkipFrames帧时跳到最新的关键帧
+	SinkDegrade SinkPolicy = "degrade" // 持续落后时只写音频和定期的关键帧, 见queue.DegradeOptions
+)
+
+// DefaultSinkSkipFrames SinkSkip未设置帧数时的跳帧阈值
+var DefaultSinkSkipFrames = 100
+
+// sinkFollowInterval 推流结束后流还没有从注册表删除时, 重新订阅的等待间隔
+const sinkFollowInterval = 100 * time.Millisecond
+
+// ParseSinkPolicy 解析sink策略, 空字符串为SinkBlock
+func ParseSinkPolicy(s string) (SinkPolicy, error) {
+	switch policy := SinkPolicy(s); policy {
+	case "":
+		return SinkBlock, nil
+	case SinkBlock, SinkSkip, SinkDegrade:
+		return policy, nil
+	}
+	return "", fmt.Errorf("rtmp: invalid sink policy %q", s)
+}
+
+type sinkOptions struct {
+	policy     SinkPolicy
+	skipFrames int
+	cursor     queue.CursorOptions
+	follow     bool
+	onError    func(error)
+}
+
+// SinkOption AttachSink的选项
+type SinkOption func(*sinkOptions)
+
+// WithSinkPolicy 设置sink跟不上时的策略, skipFrames只用于SinkSkip, 0时为DefaultSinkSkipFrames
+func WithSinkPolicy(policy SinkPolicy, skipFrames int) SinkOption {
+	return func(o *sinkOptions) {
+		o.policy, o.skipFrames = policy, skipFrames
+	}
+}
+
+// WithSinkCursorOptions 设置起播位置, 和拉流URL参数的含义相同
+func WithSinkCursorOptions(opts queue.CursorOptions) SinkOption {
+	return func(o *sinkOptions) {
+		o.cursor = opts
+	}
+}
+
+// WithSinkFollow 推流结束后继续等待同一个key的下一次推流, 每次推流sink都会收到WriteHeader和WriteTrailer
+func WithSinkFollow(follow bool) SinkOption {
+	return func(o *sinkOptions) {
+		o.follow = follow
+	}
+}
+
+// WithSinkErrorHandler sink因为错误停止时回调, 在sink的goroutine中调用
+func WithSinkErrorHandler(f func(error)) SinkOption {
+	return func(o *sinkOptions) {
+		o.onError = f
+	}
+}
+
+// Sink 挂在服务端一路流上的外部av.Muxer, 由AttachSink创建.
+// sink的WriteHeader/WritePacket/WriteTrailer都在同一个goroutine中调用, 返回错误时sink停止
+type Sink struct {
+	id   string
+	key  string
+	mux  av.Muxer
+	opts sinkOptions
+	s    *Server
+
+	lock    sync.Mutex
+	cursor  *queue.QueueCursor
+	stopped bool
+	last    *queue.Queue // 上一次订阅的queue, 只在sink的goroutine中使用
+
+	stop chan struct{}
+	done chan struct{}
+	err  error
+}
+
+// AttachSink 把mux挂到key(app/stream)对应的流上, 流还没有推流时等待推流开始.
+// 返回的Sink在推流结束(WithSinkFollow时为Stop)、mux出错或服务端关闭时结束
+func (s *Server) AttachSink(key string, mux av.Muxer, opt ...SinkOption) *Sink {
+	o := sinkOptions{policy: SinkBlock}
+	for _, f := range opt {
+		f(&o)
+	}
+	switch o.policy {
+	case SinkSkip:
+		if o.skipFrames <= 0 {
+			o.skipFrames = DefaultSinkSkipFrames
+		}
+		o.cursor.SkipFrameThreshold = o.skipFrames
+	case SinkDegrade:
+		o.cursor.Degrade = true
+	}
+
+	s.lock.Lock()
+	s.seq++
+	k := &Sink{
+		id:   fmt.Sprintf("sink-%d", s.seq),
+		key:  key,
+		mux:  mux,
+		opts: o,
+		s:    s,
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	s.lock.Unlock()
+	go k.run()
+	return k
+}
+
+// ID sink的ID, 同时是游标的订阅者ID
+func (k *Sink) ID() string {
+	return k.id
+}
+
+// Key 流的app/stream
+func (k *Sink) Key() string {
+	return k.key
+}
+
+// Stat 当前游标的订阅统计, 还没有开始订阅时ok为false
+func (k *Sink) Stat() (stat queue.CursorStat, ok bool) {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	if k.cursor == nil {
+		return
+	}
+	return k.cursor.Stat(), true
+}
+
+// Stop 停止sink并等待其退出, 返回sink的错误
+func (k *Sink) Stop() error {
+	k.lock.Lock()
+	if !k.stopped {
+		k.stopped = true
+		close(k.stop)
+	}
+	if k.cursor != nil {
+		k.cursor.Close()
+	}
+	k.lock.Unlock()
+	return k.Wait()
+}
+
+// Wait 等待sink结束, 正常结束或Stop时返回nil
+func (k *Sink) Wait() error {
+	<-k.done
+	return k.err
+}
+
+// Done sink结束时关闭
+func (k *Sink) Done() <-chan struct{} {
+	return k.done
+}
+
+func (k *Sink) run() {
+	defer close(k.done)
+	for {
+		err := k.runOnce()
+		k.lock.Lock()
+		stopped := k.stopped
+		k.cursor = nil
+		k.lock.Unlock()
+		if stopped || err == ErrServerClosed {
+			// 主动停止和服务端关闭都是正常结束
+			err, stopped = nil, true
+		}
+		if err != nil {
+			k.err = err
+			log.Error().Err(err).Str("sink", k.id).Str("key", k.key).Msg("[rtmp] sink stopped")
+			if k.opts.onError != nil {
+				k.opts.onError(err)
+			}
+			return
+		}
+		if stopped || !k.opts.follow {
+			log.Info().Str("sink", k.id).Str("key", k.key).Msg("[rtmp] sink end")
+			return
+		}
+	}
+}
+
+// runOnce 订阅一次推流, 推流结束时返回nil
+func (k *Sink) runOnce() error {
+	s := k.s
+	s.lock.Lock()
+	if s.closed {
+		s.lock.Unlock()
+		return ErrServerClosed
+	}
+	st := s.acquire(k.key)
+	if st.queue == k.last {
+		// 推流已经结束但还没有清理, 等待之后的推流使用新的queue
+		s.lock.Unlock()
+		select {
+		case <-k.stop:
+		case <-time.After(sinkFollowInterval):
+		}
+		return nil
+	}
+	k.last = st.queue
+	st.players++
+	s.lock.Unlock()
+	defer func() {
+		s.lock.Lock()
+		st.players--
+		s.release(st)
+		s.lock.Unlock()
+	}()
+
+	cursor := st.queue.CursorWithOptions(k.id, k.key, k.opts.cursor)
+	defer cursor.Close()
+	k.lock.Lock()
+	if k.stopped {
+		k.lock.Unlock()
+		return nil
+	}
+	k.cursor = cursor
+	k.lock.Unlock()
+
+	log.Info().Str("sink", k.id).Str("key", k.key).Str("policy", string(k.opts.policy)).Msg("[rtmp] sink attach")
+	err := av.NewTransport().CopyAV(context.Background(), k.mux, cursor)
+	if err == io.EOF {
+		err = nil
+	}
+	return err
+}
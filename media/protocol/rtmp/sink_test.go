@@ -0,0 +1,158 @@
+package rtmp
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bugVanisher/streamer/media/av"
+	"github.com/bugVanisher/streamer/media/codec/h264parser"
+	"github.com/bugVanisher/streamer/media/container/flv/flvio"
+)
+
+// recordMuxer 记录sink收到的调用, failAt大于0时第failAt个packet返回错误
+type recordMuxer struct {
+	lock     sync.Mutex
+	headers  int
+	packets  int
+	trailers int
+	failAt   int
+}
+
+func (m *recordMuxer) WriteHeader(streams []av.CodecData) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.headers++
+	return nil
+}
+
+func (m *recordMuxer) WritePacket(pkt av.Packet) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.packets++
+	if m.packets == m.failAt {
+		return errors.New("sink full")
+	}
+	return nil
+}
+
+func (m *recordMuxer) WriteTrailer() error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.trailers++
+	return nil
+}
+
+func (m *recordMuxer) counts() (int, int, int) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.headers, m.packets, m.trailers
+}
+
+// packetsDemuxer 按顺序输出pkts, 之后等待end关闭再返回io.EOF
+type packetsDemuxer struct {
+	streams []av.CodecData
+	pkts    []av.Packet
+	end     chan struct{}
+}
+
+func (d *packetsDemuxer) Streams() ([]av.CodecData, error) { return d.streams, nil }
+
+func (d *packetsDemuxer) ReadPacket() (pkt av.Packet, err error) {
+	if len(d.pkts) == 0 {
+		<-d.end
+		return pkt, io.EOF
+	}
+	pkt, d.pkts = d.pkts[0], d.pkts[1:]
+	return
+}
+
+func newTestPublish(t *testing.T) *packetsDemuxer {
+	sps := []byte{0x67, 0x64, 0x00, 0x1e, 0xac, 0xd9, 0x40, 0xa0, 0x2f, 0xf9, 0x70, 0x11, 0x00, 0x00, 0x03,
+		0x00, 0x01, 0x00, 0x00, 0x03, 0x00, 0x32, 0x0f, 0x16, 0x2d, 0x96}
+	h264, err := h264parser.NewCodecDataFromSPSAndPPS(sps, []byte{0x68, 0xeb, 0xe3, 0xcb, 0x22, 0xc0})
+	require.Nil(t, err)
+	d := &packetsDemuxer{streams: []av.CodecData{h264}, end: make(chan struct{})}
+	for i := 0; i < 20; i++ {
+		d.pkts = append(d.pkts, av.Packet{IsKeyFrame: i == 0, DataType: int8(flvio.TAG_VIDEO),
+			AVCPacketType: av.AVC_NALU, Time: av.MediaTimeFromMs(int32(i * 40)), Data: []byte{byte(i)}})
+	}
+	return d
+}
+
+// publish 推流直到sink收到packets个包, queue关闭后游标读不到header
+func publish(t *testing.T, s *Server, m *recordMuxer, packets int) {
+	d := newTestPublish(t)
+	done := make(chan error, 1)
+	go func() { done <- s.handlePublish("live/test", "pub", d, nil) }()
+	for i := 0; i < 200; i++ {
+		if _, n, _ := m.counts(); n >= packets {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	close(d.end)
+	require.Equal(t, io.EOF, <-done)
+}
+
+// waitAttached 等待sink订阅, 之后的推流从第一个包开始写入sink
+func waitAttached(t *testing.T, k *Sink) {
+	for i := 0; i < 200; i++ {
+		if _, ok := k.Stat(); ok {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatal("sink not attached")
+}
+
+func TestSinkFollow(t *testing.T) {
+	s := NewServer("")
+	defer s.Close()
+	m := &recordMuxer{}
+	k := s.AttachSink("live/test", m, WithSinkFollow(true), WithSinkPolicy(SinkSkip, 0))
+	require.Equal(t, "live/test", k.Key())
+
+	for i := 1; i <= 2; i++ {
+		waitAttached(t, k)
+		publish(t, s, m, 20*i)
+		for j := 0; j < 200; j++ {
+			if _, _, trailers := m.counts(); trailers == i {
+				break
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+		// 游标在第一个包上重新发送header, header次数不固定
+		headers, packets, trailers := m.counts()
+		require.True(t, headers >= i)
+		require.Equal(t, []int{20 * i, i}, []int{packets, trailers})
+	}
+
+	// 没有推流时Stop也能立即返回
+	require.Nil(t, k.Stop())
+	select {
+	case <-k.Done():
+	default:
+		t.Fatal("sink not done after Stop")
+	}
+	require.Len(t, s.Streams(), 0)
+}
+
+func TestSinkError(t *testing.T) {
+	s := NewServer("")
+	defer s.Close()
+	errs := make(chan error, 1)
+	m := &recordMuxer{failAt: 5}
+	k := s.AttachSink("live/test", m, WithSinkErrorHandler(func(err error) { errs <- err }))
+	waitAttached(t, k)
+	publish(t, s, m, 5)
+	require.EqualError(t, k.Wait(), "sink full")
+	require.EqualError(t, <-errs, "sink full")
+
+	_, err := ParseSinkPolicy("drop")
+	require.NotNil(t, err)
+}
@@ -0,0 +1,387 @@
+package rtmp
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/bugVanisher/streamer/media/av"
+	"github.com/bugVanisher/streamer/media/container/flv"
+	"github.com/bugVanisher/streamer/media/container/flv/flvio"
+	"github.com/bugVanisher/streamer/media/protocol/common"
+	"github.com/bugVanisher/streamer/utils"
+)
+
+// streamPktQueueSize 服务端每路消息流缓存的packet数, 满了之后阻塞整个连接的读取
+const streamPktQueueSize = 256
+
+var errStreamClosed = fmt.Errorf("rtmp: stream closed")
+
+// Stream NetConnection上除主流之外的一路消息流, 以msgsid区分, 和FMS一样多路流共享一个socket.
+// 客户端通过Conn.CreateStream创建后Publish, 作为av.Muxer写入, 消息以整条为单位和其他流交错.
+// 服务端在设置了Options.StreamHandler时, 主流的读取循环把其他msgsid上的publish分发为Stream,
+// 作为av.Demuxer读取; 只有主流在被读取时其他流才有数据.
+type Stream struct {
+	c    *conn
+	id   uint32
+	info common.Info
+
+	// 服务端收流
+	prober *flv.Prober
+	pkts   chan av.Packet
+	ready  chan struct{}
+	done   chan struct{}
+	once   sync.Once
+	lock   sync.Mutex
+	heads  []av.CodecData
+	err    error
+	// unpublished 推流端发送了FCUnpublish/deleteStream/closeStream, 读完缓存后回调Hook.OnUnpublish
+	unpublished bool
+	unpubOnce   sync.Once
+
+	// 客户端推流
+	streams []av.CodecData
+	tagHdrs []flvio.Tag
+}
+
+// ID 消息流的msgsid
+func (self *Stream) ID() uint32 {
+	return self.id
+}
+
+// Info 消息流的信息
+func (self *Stream) Info() common.Info {
+	return self.info
+}
+
+// RemoteAddr 所在连接的对端地址
+func (self *Stream) RemoteAddr() string {
+	return self.c.RemoteAddr()
+}
+
+// CreateStream 在已完成connect和createStream的客户端连接上创建新的消息流
+func (self *conn) CreateStream() (st *Stream, err error) {
+	if self.opts.IsServer || self.avmsgsid == 0 {
+		err = fmt.Errorf("rtmp: CreateStream must be called on a connected client")
+		return
+	}
+	// 只在写入时持有wlock, 读取中回复ping/ack时会再次获取wlock
+	self.wlock.Lock()
+	transid := self.nextTransID()
+	if err = self.writeCommandMsg(3, 0, "createStream", transid, nil); err == nil {
+		err = self.flushWrite()
+	}
+	self.wlock.Unlock()
+	if err != nil {
+		return
+	}
+	for {
+		if err = self.pollCommand(); err != nil {
+			return
+		}
+		// < _result(msgsid) of createStream
+		if self.commandname == "_result" && int(self.commandtransid) == transid {
+			ok, id := self.checkCreateStreamResult()
+			if !ok {
+				err = fmt.Errorf("rtmp: createStream command failed")
+				return
+			}
+			st = &Stream{c: self, id: id}
+			log.Debug().Str("ID", self.Info().ID).Uint32("msgsid", id).Msg("[rtmp] < _result() of createStream")
+			return
+		}
+	}
+}
+
+// nextTransID 额外命令使用的transaction id, 避开connect/createStream/publish固定使用的1~3
+func (self *conn) nextTransID() int {
+	self.transid++
+	return 3 + self.transid
+}
+
+// Publish 在消息流上执行publish命令, path为流名, 可以带query
+func (self *Stream) Publish(path string) (err error) {
+	c := self.c
+	app, _ := SplitPath(c.URL)
+	log.Debug().Str("ID", c.Info().ID).Uint32("msgsid", self.id).Msgf("[rtmp] > publish('%s')", path)
+	// 只在写入时持有wlock, 读取中回复ping/ack时会再次获取wlock
+	c.wlock.Lock()
+	if err = c.writeCommandMsg(8, self.id, "publish", c.nextTransID(), nil, c.signPath(app, path)); err == nil {
+		err = c.flushWrite()
+	}
+	c.wlock.Unlock()
+	if err != nil {
+		return
+	}
+	for {
+		if err = c.pollCommand(); err != nil {
+			return
+		}
+		// < onStatus() of publish
+		if c.commandname == "onStatus" && c.msgsid == self.id {
+			if err = c.checkPublishResult(); err != nil {
+				return
+			}
+			break
+		}
+	}
+
+	self.info = c.Info()
+	self.info.StreamName = resolveStreamID(path)
+	self.info.ID = utils.ExtractStreamID(self.info.StreamName)
+	self.info.IsPublishing = true
+	self.info.IsPlaying = false
+	return
+}
+
+// WriteHeader 写入onMetaData和sequence header
+func (self *Stream) WriteHeader(streams []av.CodecData) (err error) {
+	if len(streams) == 0 {
+		return
+	}
+	self.c.wlock.Lock()
+	defer self.c.wlock.Unlock()
+	var tagHdrs []flvio.Tag
+	if tagHdrs, err = self.c.writeHeaderTo(self.id, streams, nil); err != nil {
+		return
+	}
+	self.streams = streams
+	self.tagHdrs = tagHdrs
+	return
+}
+
+// WritePacket ...
+func (self *Stream) WritePacket(pkt av.Packet) error {
+	if self.streams == nil {
+		return fmt.Errorf("rtmp: call WriteHeader() before WritePacket()")
+	}
+	self.c.wlock.Lock()
+	defer self.c.wlock.Unlock()
+	return self.c.writePacketTo(self.id, self.streams, self.tagHdrs, pkt)
+}
+
+// WriteTrailer ...
+func (self *Stream) WriteTrailer() error {
+	self.c.wlock.Lock()
+	defer self.c.wlock.Unlock()
+	return self.c.flushWrite()
+}
+
+// Streams 服务端等待探测完成后返回header
+func (self *Stream) Streams() ([]av.CodecData, error) {
+	if self.prober == nil {
+		return self.streams, nil
+	}
+	select {
+	case <-self.ready:
+		self.lock.Lock()
+		defer self.lock.Unlock()
+		return self.heads, nil
+	case <-self.done:
+		return nil, self.err
+	}
+}
+
+// ReadPacket 服务端读取这路流的packet, 流结束时返回io.EOF
+func (self *Stream) ReadPacket() (pkt av.Packet, err error) {
+	if self.prober == nil {
+		err = fmt.Errorf("rtmp: ReadPacket on a publishing stream")
+		return
+	}
+	select {
+	case pkt = <-self.pkts:
+		return
+	case <-self.done:
+	}
+	// 优先返回已经缓存的packet
+	select {
+	case pkt = <-self.pkts:
+	default:
+		err = self.err
+		if self.unpublished && self.c.opts.Hook != nil {
+			self.unpubOnce.Do(func() { self.c.opts.Hook.OnUnpublish(self.info) })
+		}
+	}
+	return
+}
+
+// Close 客户端发送deleteStream, 服务端停止接收这路流
+func (self *Stream) Close() (err error) {
+	if self.prober != nil {
+		self.closeWithErr(errStreamClosed)
+		return
+	}
+	c := self.c
+	c.wlock.Lock()
+	defer c.wlock.Unlock()
+	if err = c.writeCommandMsg(3, 0, "deleteStream", 0, nil, self.id); err != nil {
+		return
+	}
+	return c.flushWrite()
+}
+
+func (self *Stream) closeWithErr(err error) {
+	self.once.Do(func() {
+		self.err = err
+		close(self.done)
+	})
+}
+
+func (self *Stream) closed() bool {
+	select {
+	case <-self.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (self *Stream) send(pkt av.Packet) bool {
+	select {
+	case self.pkts <- pkt:
+		return true
+	case <-self.done:
+		return false
+	}
+}
+
+// push 在连接的读取goroutine中调用, prober只在该goroutine中使用
+func (self *Stream) push(tag flvio.Tag, timestamp uint32) {
+	if self.closed() {
+		return
+	}
+	if !self.prober.Probed() {
+		if err := self.prober.PushTag(tag, int32(timestamp)); err != nil {
+			self.closeWithErr(err)
+			return
+		}
+		if !self.prober.Probed() {
+			return
+		}
+		self.lock.Lock()
+		self.heads = self.prober.Streams
+		self.lock.Unlock()
+		close(self.ready)
+		for !self.prober.Empty() {
+			if !self.send(self.prober.PopPacket()) {
+				return
+			}
+		}
+		return
+	}
+
+	pkt, ok := self.prober.TagToPacket(tag, int32(timestamp))
+	if !ok {
+		return
+	}
+	if pkt.IsSequenceHeader() {
+		changed, err := self.prober.HeaderChanged(tag)
+		if err != nil {
+			self.closeWithErr(fmt.Errorf("fails to resolve seq header: %s", err.Error()))
+			return
+		}
+		if !changed {
+			return
+		}
+		pkt.HeaderChanged = true
+		self.lock.Lock()
+		self.heads = self.prober.Streams
+		self.lock.Unlock()
+	} else if pkt.IsScriptData() {
+		pkt.MetadataUpdated = true
+		pkt.HeaderChanged = self.c.opts.ScriptDataHeaderChange
+	}
+	self.send(pkt)
+}
+
+// handleMsgStream 处理主流之外的消息流的命令和数据, handled为true时消息已处理
+func (self *conn) handleMsgStream() (handled bool, err error) {
+	if self.gotcommand {
+		switch self.commandname {
+		// < createStream, 主流之后的createStream分配新的msgsid
+		case "createStream":
+			self.nextsid++
+			return true, self.writeCommand(0, "_result", self.commandtransid, nil, self.nextsid)
+
+		case "publish":
+			if self.msgsid == self.avmsgsid {
+				return
+			}
+			return true, self.acceptStreamPublish()
+
+		}
+		return
+	}
+
+	switch self.msgtypeid {
+	case msgtypeidVideoMsg, msgtypeidAudioMsg, msgtypeidDataMsgAMF0, msgtypeidDataMsgAMF3:
+		if self.msgsid == self.avmsgsid {
+			return
+		}
+		// 没有publish的消息流上的数据直接丢弃
+		if st, ok := self.msgstreams[self.msgsid]; ok {
+			tag := self.avtag
+			if self.msgtypeid == msgtypeidDataMsgAMF0 || self.msgtypeid == msgtypeidDataMsgAMF3 {
+				tag = self.scripttag
+			}
+			st.push(tag, self.timestamp)
+		}
+		return true, nil
+	}
+	return
+}
+
+// acceptStreamPublish 接受主流之外的publish, 回复onStatus后交给StreamHandler
+func (self *conn) acceptStreamPublish() (err error) {
+	if len(self.commandparams) < 1 {
+		return fmt.Errorf("rtmp: publish params invalid")
+	}
+	publishpath, _ := self.commandparams[0].(string)
+	log.Info().Uint32("msgsid", self.msgsid).Msg(fmt.Sprintf("[rtmp] < publish(%s)", publishpath))
+
+	var info common.Info
+	if _, info, err = createURL(self.tcurl, self.connectpath, publishpath, self.hastcurl); err != nil {
+		return fmt.Errorf("rtmp: publish params wrong: %v", err)
+	}
+	info.IsPublishing = true
+
+	onStatusMsg := AMFMapOnStatusPublishStart
+	if _, ok := self.msgstreams[self.msgsid]; ok {
+		onStatusMsg = AMFMapOnStatusPublishBadName
+	} else if self.opts.Hook != nil {
+		if cberr := self.opts.Hook.OnPlayOrPublish(info); cberr != nil {
+			log.Info().Err(cberr).Str("stream", info.StreamName).Msg("[rtmp] reject publish")
+			onStatusMsg = AMFMapOnStatusPublishStreamDuplicated
+		}
+	}
+	// > onStatus()
+	if err = self.writeCommand(self.msgsid, "onStatus", self.commandtransid, nil, onStatusMsg); err != nil {
+		return
+	}
+	if onStatusMsg["code"] != AMFMapOnStatusPublishStart["code"] {
+		return
+	}
+
+	st := &Stream{
+		c:      self,
+		id:     self.msgsid,
+		info:   info,
+		prober: newProber(info.StreamName, self.opts),
+		pkts:   make(chan av.Packet, streamPktQueueSize),
+		ready:  make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	self.msgstreams[st.id] = st
+	self.journalEvent("publishStart", info.StreamName)
+	go self.opts.StreamHandler(st)
+	return
+}
+
+// closeMsgStreams 连接读取结束时结束所有其他消息流
+func (self *conn) closeMsgStreams(err error) {
+	for id, st := range self.msgstreams {
+		st.closeWithErr(err)
+		delete(self.msgstreams, id)
+	}
+}
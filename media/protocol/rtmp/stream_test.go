@@ -0,0 +1,63 @@
+package rtmp
+
+import (
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateStreamPingDuringCommand(t *testing.T) {
+	l := newLocalListener(t)
+	defer l.Close()
+	// 服务端在回复createStream和publish之前先发送ping, 客户端在等待回复时回复PingResponse
+	go func() {
+		nc, err := l.Accept()
+		if err != nil {
+			return
+		}
+		s := newConn(nc)
+		defer s.Close()
+		for s.pollCommand() == nil {
+			switch s.commandname {
+			case "createStream":
+				s.writePing(eventtypePingRequest, 1)
+				s.writeCommandMsg(3, 0, "_result", s.commandtransid, nil, 2)
+			case "publish":
+				s.writePing(eventtypePingRequest, 2)
+				s.writeCommandMsg(5, s.msgsid, "onStatus", s.commandtransid, nil, AMFMapOnStatusPublishStart)
+			}
+			s.flushWrite()
+		}
+	}()
+
+	nc, err := net.Dial("tcp", l.Addr().String())
+	require.Nil(t, err)
+	// IdleTimeout使读路径中的写入持有wlock
+	c := newConn(nc, WithTimeouts(0, 0, time.Hour))
+	defer c.Close()
+	require.True(t, c.lockedRead)
+	c.opts.IsServer = false
+	c.avmsgsid = 1
+	c.URL, _ = url.Parse("rtmp://" + l.Addr().String() + "/live/a")
+
+	var st *Stream
+	done := make(chan error, 1)
+	go func() {
+		var err error
+		if st, err = c.CreateStream(); err == nil {
+			err = st.Publish("b")
+		}
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		require.Nil(t, err)
+		require.Equal(t, uint32(2), st.ID())
+		require.True(t, st.Info().IsPublishing)
+	case <-time.After(5 * time.Second):
+		t.Fatal("CreateStream/Publish deadlocked on wlock")
+	}
+}
@@ -0,0 +1,96 @@
+package rtmp
+
+import (
+	"io"
+
+	"github.com/rs/zerolog/log"
+)
+
+// handleUnpublish 服务端处理推流端的FCUnpublish/deleteStream/closeStream, handled为true时命令已处理.
+// 主流停止推流后ReadPacket返回io.EOF, 其他消息流的Stream读完缓存后返回io.EOF
+func (self *conn) handleUnpublish() (handled bool, err error) {
+	var id uint32
+	switch self.commandname {
+	// < FCUnpublish(name), 按流名查找消息流
+	case "FCUnpublish":
+		var name string
+		if len(self.commandparams) > 0 {
+			name, _ = self.commandparams[0].(string)
+		}
+		var ok bool
+		if id, ok = self.publishingMsgsid(resolveStreamID(name)); !ok {
+			return
+		}
+		// > _result() + onFCUnpublish()
+		if self.commandtransid != 0 {
+			if err = self.writeCommandMsg(3, self.msgsid, "_result", self.commandtransid, nil); err != nil {
+				return
+			}
+		}
+		if err = self.writeCommandMsg(3, self.msgsid, "onFCUnpublish", 0, nil, AMFMapOnStatusUnpublishSuccess); err != nil {
+			return
+		}
+
+	// < deleteStream(msgsid)
+	case "deleteStream":
+		id = self.msgsid
+		if len(self.commandparams) > 0 {
+			f, _ := self.commandparams[0].(float64)
+			id = uint32(f)
+		}
+
+	// < closeStream, 在要关闭的消息流上发送
+	case "closeStream":
+		id = self.msgsid
+
+	default:
+		return
+	}
+
+	if id == self.avmsgsid && self.publishing && !self.unpublished {
+		if err = self.writeUnpublishSuccess(id); err != nil {
+			return
+		}
+		self.unpublished = true
+		log.Info().Str("ID", self.info.ID).Uint32("msgsid", id).Msg("[rtmp] < " + self.commandname)
+		self.journalEvent("unpublish", self.info.StreamName)
+		if self.opts.Hook != nil {
+			self.opts.Hook.OnUnpublish(self.Info())
+		}
+		return true, nil
+	}
+	if st, ok := self.msgstreams[id]; ok {
+		if err = self.writeUnpublishSuccess(id); err != nil {
+			return
+		}
+		delete(self.msgstreams, id)
+		st.unpublished = true
+		st.closeWithErr(io.EOF)
+		log.Info().Str("ID", st.info.ID).Uint32("msgsid", id).Msg("[rtmp] < " + self.commandname)
+		self.journalEvent("unpublish", st.info.StreamName)
+		return true, nil
+	}
+	// 已经结束的消息流, 比如FCUnpublish之后的deleteStream
+	return true, nil
+}
+
+// publishingMsgsid 按流名查找正在推流的消息流
+func (self *conn) publishingMsgsid(name string) (id uint32, ok bool) {
+	if self.publishing && !self.unpublished && name == self.info.StreamName {
+		return self.avmsgsid, true
+	}
+	for id, st := range self.msgstreams {
+		if name == st.info.StreamName {
+			return id, true
+		}
+	}
+	return
+}
+
+// writeUnpublishSuccess > onStatus("NetStream.Unpublish.Success")
+func (self *conn) writeUnpublishSuccess(msgsid uint32) (err error) {
+	if err = self.writeCommandMsg(5, msgsid, "onStatus", 0, nil, AMFMapOnStatusUnpublishSuccess); err != nil {
+		return
+	}
+	return self.flushWrite()
+}
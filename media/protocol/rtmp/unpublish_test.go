@@ -0,0 +1,85 @@
+package rtmp
+
+import (
+	"io"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bugVanisher/streamer/media/container/flv/flvio"
+	"github.com/bugVanisher/streamer/media/protocol/common"
+)
+
+type unpublishHook struct {
+	infos chan common.Info
+}
+
+func (h *unpublishHook) OnPlayOrPublish(info common.Info) error {
+	return nil
+}
+
+func (h *unpublishHook) OnUnpublish(info common.Info) {
+	h.infos <- info
+}
+
+// publishingPair 服务端处于推流状态的连接和对应的客户端
+func publishingPair(hook Hook) (server, client *conn) {
+	sc, cc := net.Pipe()
+	server = newConn(sc, WithServerHook(hook))
+	server.publishing, server.avmsgsid = true, 1
+	server.info.StreamName = "live"
+	client = newConn(cc)
+	return
+}
+
+func TestUnpublish(t *testing.T) {
+	for _, cmd := range []struct {
+		args    []interface{}
+		replies []string
+	}{
+		{[]interface{}{"FCUnpublish", 4, nil, "live?token=1"}, []string{"_result", "onFCUnpublish", "onStatus"}},
+		{[]interface{}{"deleteStream", 0, nil, 1}, []string{"onStatus"}},
+	} {
+		hook := &unpublishHook{infos: make(chan common.Info, 1)}
+		server, client := publishingPair(hook)
+
+		replies := make(chan []flvio.AMFMap, 1)
+		go func() {
+			client.writeCommandMsg(3, 0, cmd.args...)
+			client.flushWrite()
+			var got []flvio.AMFMap
+			for range cmd.replies {
+				if client.pollCommand() != nil {
+					break
+				}
+				reply := flvio.AMFMap{"name": client.commandname}
+				if len(client.commandparams) > 0 {
+					status, _ := client.commandparams[0].(flvio.AMFMap)
+					reply["code"] = status["code"]
+				}
+				got = append(got, reply)
+			}
+			replies <- got
+		}()
+
+		_, err := server.pollAVTag()
+		require.Equal(t, io.EOF, err)
+		info := <-hook.infos
+		require.Equal(t, "live", info.StreamName)
+		require.True(t, info.IsPublishing)
+
+		got := <-replies
+		require.Len(t, got, len(cmd.replies))
+		for i, name := range cmd.replies {
+			require.Equal(t, name, got[i]["name"])
+		}
+		require.Equal(t, "NetStream.Unpublish.Success", got[len(got)-1]["code"])
+
+		// 停止推流后不再读取连接
+		_, err = server.pollAVTag()
+		require.Equal(t, io.EOF, err)
+		server.Close()
+		client.Close()
+	}
+}
@@ -0,0 +1,79 @@
+package rtmp
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/bugVanisher/streamer/media/protocol/common"
+)
+
+const (
+	vhostParam = "vhost"
+	// srsVhostSep SRS兼容的app写法: live...vhost...example.com
+	srsVhostSep = "...vhost..."
+	// VhostAll SetVhostHook的key, 没有单独设置hook的vhost都使用它
+	VhostAll = "*"
+)
+
+// parseVhost 解析虚拟主机并从app中去掉vhost参数. 依次取tcUrl的vhost参数, app的vhost参数或SRS的
+// app...vhost...host写法, publish/play路径的vhost参数
+func parseVhost(tcurl, app, ppath string) (vhost, cleanApp string) {
+	cleanApp = app
+	if i := strings.Index(cleanApp, srsVhostSep); i >= 0 {
+		vhost = cleanApp[i+len(srsVhostSep):]
+		cleanApp = cleanApp[:i]
+		if j := strings.IndexAny(vhost, "?&/"); j >= 0 {
+			vhost = vhost[:j]
+		}
+	}
+	if i := strings.IndexByte(cleanApp, '?'); i >= 0 {
+		q, _ := url.ParseQuery(cleanApp[i+1:])
+		if v := q.Get(vhostParam); v != "" {
+			vhost = v
+		}
+		q.Del(vhostParam)
+		cleanApp = cleanApp[:i]
+		if rest := q.Encode(); rest != "" {
+			cleanApp += "?" + rest
+		}
+	}
+	if tu, err := url.Parse(tcurl); tcurl != "" && err == nil {
+		if v := tu.Query().Get(vhostParam); v != "" {
+			return v, cleanApp
+		}
+	}
+	if vhost == "" {
+		if i := strings.IndexByte(ppath, '?'); i >= 0 {
+			q, _ := url.ParseQuery(ppath[i+1:])
+			vhost = q.Get(vhostParam)
+		}
+	}
+	return
+}
+
+// SetVhostHook 设置虚拟主机的hook, 推拉流开始时按common.Info.Vhost回调, 返回错误时拒绝.
+// vhost为空表示未指定vhost的连接, VhostAll对应没有单独设置的vhost; hook为nil时删除
+func (s *Server) SetVhostHook(vhost string, hook Hook) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if hook == nil {
+		delete(s.vhostHooks, vhost)
+		return
+	}
+	s.vhostHooks[vhost] = hook
+}
+
+// vhostHook 虚拟主机的hook, 没有时为nil, 调用时需持有锁
+func (s *Server) vhostHook(vhost string) Hook {
+	if hook, ok := s.vhostHooks[vhost]; ok {
+		return hook
+	}
+	return s.vhostHooks[VhostAll]
+}
+
+// hookOf 加锁查找info对应的虚拟主机hook
+func (s *Server) hookOf(info common.Info) Hook {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.vhostHook(info.Vhost)
+}
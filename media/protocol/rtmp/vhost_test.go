@@ -0,0 +1,74 @@
+package rtmp
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bugVanisher/streamer/media/protocol/common"
+)
+
+func TestParseVhost(t *testing.T) {
+	for _, c := range []struct {
+		tcurl, app, ppath string
+		vhost, cleanApp   string
+	}{
+		{"rtmp://127.0.0.1/live", "live", "test", "", "live"},
+		{"rtmp://127.0.0.1/live?vhost=a.com", "live?vhost=a.com", "test", "a.com", "live"},
+		{"rtmp://127.0.0.1/live", "live?vhost=b.com&token=1", "test", "b.com", "live?token=1"},
+		{"rtmp://127.0.0.1/live...vhost...c.com", "live...vhost...c.com", "test", "c.com", "live"},
+		{"rtmp://127.0.0.1/live", "live", "test?vhost=d.com", "d.com", "live"},
+		// tcUrl优先
+		{"rtmp://127.0.0.1/live?vhost=a.com", "live?vhost=b.com", "test?vhost=d.com", "a.com", "live"},
+	} {
+		vhost, app := parseVhost(c.tcurl, c.app, c.ppath)
+		require.Equal(t, c.vhost, vhost, c.app)
+		require.Equal(t, c.cleanApp, app, c.app)
+	}
+
+	_, info, err := createURL("rtmp://127.0.0.1/live?vhost=a.com", "live?vhost=a.com", "test", false)
+	require.Nil(t, err)
+	require.Equal(t, "a.com", info.Vhost)
+	require.Equal(t, "live", info.App)
+	require.Equal(t, "test", info.StreamName)
+	require.Equal(t, "a.com/live/test", StreamKey(info))
+}
+
+type vhostHook struct {
+	err   error
+	infos []common.Info
+}
+
+func (h *vhostHook) OnPlayOrPublish(info common.Info) error {
+	h.infos = append(h.infos, info)
+	return h.err
+}
+
+func (h *vhostHook) OnUnpublish(info common.Info) {}
+
+func TestServerVhostHook(t *testing.T) {
+	s := NewServer("")
+	denied := &vhostHook{err: errors.New("denied")}
+	other := &vhostHook{}
+	s.SetVhostHook("deny.com", denied)
+	s.SetVhostHook(VhostAll, other)
+
+	require.NotNil(t, s.OnPlayOrPublish(common.Info{Vhost: "deny.com", App: "live", StreamName: "test", IsPublishing: true}))
+	require.Len(t, denied.infos, 1)
+	require.Nil(t, s.OnPlayOrPublish(common.Info{Vhost: "a.com", App: "live", StreamName: "test", IsPublishing: true}))
+	require.Nil(t, s.OnPlayOrPublish(common.Info{App: "live", StreamName: "test", IsPublishing: true}))
+	require.Len(t, other.infos, 2)
+
+	// 删除后不再回调
+	s.SetVhostHook(VhostAll, nil)
+	require.Nil(t, s.OnPlayOrPublish(common.Info{Vhost: "a.com", App: "live", StreamName: "test", IsPublishing: true}))
+	require.Len(t, other.infos, 2)
+
+	// 不同vhost的同名流互不影响
+	s.lock.Lock()
+	s.acquire(StreamKey(common.Info{Vhost: "a.com", App: "live", StreamName: "test"})).publisher = "1.1.1.1:1"
+	s.lock.Unlock()
+	require.Equal(t, ErrStreamPublished, s.OnPlayOrPublish(common.Info{Vhost: "a.com", App: "live", StreamName: "test", IsPublishing: true}))
+	require.Nil(t, s.OnPlayOrPublish(common.Info{Vhost: "b.com", App: "live", StreamName: "test", IsPublishing: true}))
+}
@@ -0,0 +1,50 @@
+package rtmp
+
+import (
+	"io"
+	"net"
+	"strconv"
+	"testing"
+
+	"github.com/bugVanisher/streamer/media/container/flv/flvio"
+)
+
+// go test -run xxx -bench WriteAVTag -benchmem, 经本地tcp连接发送
+func BenchmarkWriteAVTag(b *testing.B) {
+	for _, size := range []int{1024, 64 * 1024, 512 * 1024} {
+		size := size
+		b.Run(strconv.Itoa(size/1024)+"K", func(b *testing.B) {
+			l, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer l.Close()
+			go func() {
+				c, err := l.Accept()
+				if err != nil {
+					return
+				}
+				io.Copy(io.Discard, c)
+			}()
+			nc, err := net.Dial("tcp", l.Addr().String())
+			if err != nil {
+				b.Fatal(err)
+			}
+			c := newConn(nc)
+			defer c.Close()
+			// 与writeBasicConf协商后的chunk size一致
+			c.writeMaxChunkSize = c.opts.ChunkSize
+			tag := flvio.Tag{Type: flvio.TAG_VIDEO, FrameType: flvio.FRAME_INTER, CodecID: flvio.VIDEO_H264,
+				AVCPacketType: flvio.AVC_NALU, Data: make([]byte, size)}
+			b.ReportAllocs()
+			b.SetBytes(int64(size))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := c.writeAVTagTo(1, tag, int32(i)); err != nil {
+					b.Fatal(err)
+				}
+			}
+			c.flushWrite()
+		})
+	}
+}
@@ -2,6 +2,8 @@ package slice
 
 import (
 	"fmt"
+	"github.com/bugVanisher/streamer/common/ratelog"
+	"github.com/bugVanisher/streamer/media/av"
 	"github.com/rs/zerolog/log"
 	"io"
 	"sync"
@@ -52,7 +54,7 @@ type Queue struct {
 
 	maxPktCount    int
 	maxCacheTime   int32
-	minPktDts      int32
+	minPktDts      av.MediaTime
 	curPKtCount    int
 	curGOPCount    int
 	curPktDuration int32
@@ -194,7 +196,7 @@ func (q *Queue) WritePacket(pkt Packet) error {
 	}
 	q.lastRecvSliceStamp = now
 	if recvInterval > 800 {
-		log.Info().Str("sid", q.sid).Uint8("SliceType", pkt.SliceType).Uint8("posFlag", pkt.PosFlag).
+		ratelog.Info("[Queue] RecvSlicePacket too long").Str("sid", q.sid).Uint8("SliceType", pkt.SliceType).Uint8("posFlag", pkt.PosFlag).
 			Uint64("SliceId", pkt.SliceId).Int("recInterval", recvInterval).Msg("[Queue] RecvSlicePacket too long")
 	}
 
@@ -205,11 +207,11 @@ func (q *Queue) WritePacket(pkt Packet) error {
 		q.curGOPCount++
 	}
 
-	for q.buf.Count > 1 && (q.buf.Count >= q.maxPktCount || (pkt.FrameDts > 0 && pkt.FrameDts-q.minPktDts > q.maxCacheTime)) {
+	for q.buf.Count > 1 && (q.buf.Count >= q.maxPktCount || (pkt.FrameDts > 0 && (pkt.FrameDts-q.minPktDts).Ms() > q.maxCacheTime)) {
 		tmpPkt := q.buf.Pop()
 		if pkt.FrameDts > 0 && tmpPkt.FrameDts > q.minPktDts {
 			q.minPktDts = tmpPkt.FrameDts
-			q.curPktDuration = pkt.FrameDts - q.minPktDts
+			q.curPktDuration = (pkt.FrameDts - q.minPktDts).Ms()
 		}
 		if tmpPkt.SliceType == SLICE_TYPE_VIDEO && tmpPkt.FrameType == SLICE_FRAME_TYPE_IDR && tmpPkt.PosFlag == SLICE_POSFLAG_START {
 			q.curGOPCount--
@@ -219,7 +221,7 @@ func (q *Queue) WritePacket(pkt Packet) error {
 	//清理header
 	clearPoint := len(q.headers) - 1
 	for ; clearPoint >= 0; clearPoint-- {
-		if q.buf.Head >= q.headers[clearPoint].BeginAt {
+		if q.buf.Head.GE(q.headers[clearPoint].BeginAt) {
 			break
 		}
 	}
@@ -340,17 +342,17 @@ func (q *QueueCursor) SetTimeOffset(timeOffset int) {
 		i := buf.Tail - 1
 		delayedFrame := 0
 		lastKeyFramePos := buf.Tail
-		var latestFrameDts int32
+		var latestFrameDts av.MediaTime
 		if buf.IsValidPos(i) {
 			latestFrameDts = buf.Get(i).FrameDts
 			for ; buf.IsValidPos(i); i-- {
 				pkt := buf.Get(i)
 				if pkt.FrameType == SLICE_FRAME_TYPE_IDR && pkt.PosFlag == SLICE_POSFLAG_START {
-					if latestFrameDts-buf.Get(i).FrameDts >= int32(timeOffset) {
+					if (latestFrameDts - buf.Get(i).FrameDts).Ms() >= int32(timeOffset) {
 						//timeOffset < 0 表示：有可能从紧挨着的前一个关键帧，或者后一个关键帧开始发，关键看哪个离的近
-						if isNegative && lastKeyFramePos < buf.Tail {
-							tmp1 := latestFrameDts - buf.Get(i).FrameDts - int32(timeOffset)
-							tmp2 := int32(timeOffset) - (latestFrameDts - buf.Get(lastKeyFramePos).FrameDts)
+						if isNegative && lastKeyFramePos.LT(buf.Tail) {
+							tmp1 := (latestFrameDts - buf.Get(i).FrameDts).Ms() - int32(timeOffset)
+							tmp2 := int32(timeOffset) - (latestFrameDts - buf.Get(lastKeyFramePos).FrameDts).Ms()
 							if tmp2 < tmp1 {
 								return lastKeyFramePos, buf.Get(lastKeyFramePos).SliceId, tmp2
 							}
@@ -365,17 +367,17 @@ func (q *QueueCursor) SetTimeOffset(timeOffset int) {
 
 		if adjustToLastKeyFrame {
 			if buf.IsValidPos(i) {
-				return i, buf.Get(i).SliceId, latestFrameDts - buf.Get(i).FrameDts
+				return i, buf.Get(i).SliceId, (latestFrameDts - buf.Get(i).FrameDts).Ms()
 			}
 			if buf.IsValidPos(lastKeyFramePos) {
-				return lastKeyFramePos, buf.Get(lastKeyFramePos).SliceId, latestFrameDts - buf.Get(lastKeyFramePos).FrameDts
+				return lastKeyFramePos, buf.Get(lastKeyFramePos).SliceId, (latestFrameDts - buf.Get(lastKeyFramePos).FrameDts).Ms()
 			}
 			//这个位置仍然不可用，表示队列中没有关键帧,这种情况下会导致外层继续等待
 			return lastKeyFramePos, 0, 0
 		}
 
 		if buf.IsValidPos(i) {
-			return i, buf.Get(i).SliceId, latestFrameDts - buf.Get(i).FrameDts
+			return i, buf.Get(i).SliceId, (latestFrameDts - buf.Get(i).FrameDts).Ms()
 		}
 
 		//这里返回的可能是一个不可用位置
@@ -492,7 +494,7 @@ func (q *QueueCursor) ReadPacket() (pkt Packet, err error) {
 					err = io.EOF
 					break
 				}
-				log.Err(fmt.Errorf("[QueueCursor] re-init slice cursor pos invalid")).
+				ratelog.Error("[QueueCursor] re-init slice cursor pos invalid").
 					Str("id", q.id).
 					Str("sid", q.sid).
 					Int("head", int(buf.Head)).
@@ -500,7 +502,7 @@ func (q *QueueCursor) ReadPacket() (pkt Packet, err error) {
 					Int("pos", int(q.pos)).
 					Int("delayframe", int(buf.Tail-q.pos)).
 					Int64("readcount", q.readCount).
-					Msg("")
+					Msg("[QueueCursor] re-init slice cursor pos invalid")
 
 				q.que.cond.Wait()
 				continue
@@ -524,7 +526,7 @@ func (q *QueueCursor) ReadPacket() (pkt Packet, err error) {
 				q.lastSendSliceStamp = now
 
 				if sendInterval > 800 {
-					log.Info().
+					ratelog.Info("[QueueCursor] slice SendSlicePacket too long").
 						Str("id", q.id).
 						Str("sid", q.sid).
 						Uint8("SliceType", pktTmp.SliceType).
@@ -538,7 +540,7 @@ func (q *QueueCursor) ReadPacket() (pkt Packet, err error) {
 			}
 
 			if q.SliceStreamBase == 0 && pktTmp.SliceId != q.curAtSliceId {
-				log.Info().
+				ratelog.Info("[QueueCursor] slice SendSlicePacket Jump").
 					Str("id", q.id).
 					Str("sid", q.sid).
 					Uint64("curSliceId", q.curAtSliceId).
@@ -571,7 +573,7 @@ func (q *QueueCursor) ReadPacket() (pkt Packet, err error) {
 			}
 			if pkt.HeaderBeginAt > int(q.curHeaderBeginAt) {
 				pkt.HeaderChanged = true // 触发重新发送slice header
-				log.Info().
+				ratelog.Info("[QueueCursor] slice resend header").
 					Str("id", q.id).
 					Str("sid", q.sid).
 					Int("curHeaderBeginAt", int(q.curHeaderBeginAt)).
@@ -595,7 +597,7 @@ func (q *QueueCursor) ReadPacket() (pkt Packet, err error) {
 
 func (qc *QueueCursor) Format() string {
 	pkt := qc.que.buf.Get(qc.pos)
-	return fmt.Sprintf("cursor: curPos[%d], pktTimestamp[%d]", qc.pos, pkt.FrameDts)
+	return fmt.Sprintf("cursor: curPos[%d], pktTimestamp[%d]", qc.pos, pkt.FrameDts.Ms())
 }
 
 func (qc *QueueCursor) Close() error {
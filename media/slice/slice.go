@@ -60,9 +60,9 @@ type Packet struct {
 	Data       []byte // slice data
 
 	// no encode， for p2p quickOffset
-	FrameDts      int32 // frame dts
-	HeaderBeginAt int   // header pos in queue
-	HeaderChanged bool  // indicates if the sps/pps info changed
+	FrameDts      av.MediaTime // frame dts
+	HeaderBeginAt int          // header pos in queue
+	HeaderChanged bool         // indicates if the sps/pps info changed
 }
 
 func (p *Packet) IsHeader() bool {
@@ -101,7 +101,7 @@ func (s *DataSliceInfo) GenerateSlice(data []byte, avPkt *av.Packet) []Packet {
 		var slicePkt Packet
 		slicePkt.SliceId = s.SliceId
 		slicePkt.FrameId = s.FrameId
-		slicePkt.FrameDts = utils.TimeToTs(avPkt.Time)
+		slicePkt.FrameDts = avPkt.Time
 		sliceDataSize = dataSize / sliceCnt
 		if overSize > 0 {
 			sliceDataSize++
@@ -115,7 +115,7 @@ func (s *DataSliceInfo) GenerateSlice(data []byte, avPkt *av.Packet) []Packet {
 				slicePkt.FrameType = SLICE_FRAME_TYPE_IDR
 			}
 		}
-		if avPkt.DataType == av.FLV_TAG_AUDIO {
+		if avPkt.IsAudio() {
 			slicePkt.SliceType = SLICE_TYPE_AUDIO
 			slicePkt.FrameType = SLICE_FRAME_TYPE_AUDIO
 		}
@@ -135,7 +135,7 @@ func (s *DataSliceInfo) GenerateSlice(data []byte, avPkt *av.Packet) []Packet {
 		slicePkt.ExtendFlag = KSliceExtendFlag
 		if slicePkt.ExtendFlag > 0 {
 			slicePkt.Extend = NewExtend()
-			slicePkt.Extend[KSliceExtendKeyTimeStamp] = uint32(slicePkt.FrameDts)
+			slicePkt.Extend[KSliceExtendKeyTimeStamp] = slicePkt.FrameDts.MsU32()
 			extendData := slicePkt.Extend.Encode()
 			extendSize := uint16(len(extendData))
 			slicePkt.Size = KSliceHeaderSize + extendSize + uint16(sliceDataSize)
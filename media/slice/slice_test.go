@@ -6,7 +6,6 @@ import (
 	"github.com/bugVanisher/streamer/media/av"
 	"github.com/stretchr/testify/require"
 	"testing"
-	"time"
 )
 
 func TestExtend(t *testing.T) {
@@ -31,14 +30,14 @@ func TestSlice(t *testing.T) {
 	data := make([]byte, 5003)
 	var avPkt av.Packet
 	avPkt.DataType = av.FLV_TAG_VIDEO
-	avPkt.Time = time.Millisecond * 1324
+	avPkt.Time = av.MediaTimeFromMs(1324)
 	slicePkts := info.GenerateSlice(data, &avPkt)
 	require.Equal(t, 4, len(slicePkts))
 	for _, slicePkt := range slicePkts {
 		fmt.Printf("gene: %#v\n", slicePkt)
 		sliceHeader, _, err := ParseSliceHeader(slicePkt.Data)
 		require.Equal(t, nil, err)
-		sliceHeader.FrameDts = 1324
+		sliceHeader.FrameDts = av.MediaTimeFromMs(1324)
 		sliceHeader.Data = slicePkt.Data
 		fmt.Printf("pars: %#v\n", sliceHeader)
 		require.Equal(t, slicePkt, sliceHeader)
@@ -1,7 +1,6 @@
 package sliceio
 
 import (
-	"bufio"
 	"bytes"
 	"fmt"
 	"io"
@@ -11,13 +10,14 @@ import (
 	"github.com/bugVanisher/streamer/media/container/flv/flvio"
 	"github.com/bugVanisher/streamer/media/slice"
 	"github.com/bugVanisher/streamer/utils"
+	"github.com/bugVanisher/streamer/utils/adaptive"
 )
 
 var MaxProbePacketCount = 20
 
 type Demuxer struct {
 	r                              io.ReadCloser
-	bufr                           *bufio.Reader
+	bufr                           *adaptive.Reader
 	b                              []byte
 	stage                          int
 	headers                        []slice.Packet
@@ -29,11 +29,16 @@ type Demuxer struct {
 func NewDemuxer(r io.ReadCloser) *Demuxer {
 	return &Demuxer{
 		r:    r,
-		bufr: bufio.NewReaderSize(r, 4*1024),
+		bufr: adaptive.NewReader(r, adaptive.DefaultMinSize, adaptive.DefaultMaxSize),
 		b:    make([]byte, 256),
 	}
 }
 
+// ReadBufferStats 读缓存的大小和扩大次数, 可以在其它goroutine调用
+func (self *Demuxer) ReadBufferStats() adaptive.Stats {
+	return self.bufr.Stats()
+}
+
 func (self *Demuxer) prepare() (err error) {
 	//有avcheader和aacheader return TRUE；或者 slice cache得到MaxProbePacketCount true
 	for self.stage < MaxProbePacketCount {
@@ -176,18 +181,20 @@ func ReadSlice(r io.Reader, b []byte) (pkt slice.Packet, err error) {
 	// parse frame dts from audio&video
 	if pkt.PosFlag == slice.SLICE_POSFLAG_START || pkt.PosFlag == slice.SLICE_POSFLAG_STARTEND {
 		var tagSize int
+		var ts int32
 		sliceHeaderSize := slice.KSliceHeaderSize + int(extendSize)
-		_, pkt.FrameDts, tagSize, err = flvio.ParseTagHeader(pkt.Data[sliceHeaderSize:])
+		_, ts, tagSize, err = flvio.ParseTagHeader(pkt.Data[sliceHeaderSize:])
 		if err != nil {
 			err = fmt.Errorf("slice ParseTagHeader err:%s", err.Error())
 		}
 		// skip avc header
-		if pkt.FrameDts == 0 && sliceHeaderSize+tagSize+4+flvio.TagHeaderLength*2 < int(datalen) {
-			_, pkt.FrameDts, tagSize, err = flvio.ParseTagHeader(pkt.Data[sliceHeaderSize+flvio.TagHeaderLength+tagSize+4:])
+		if ts == 0 && sliceHeaderSize+tagSize+4+flvio.TagHeaderLength*2 < int(datalen) {
+			_, ts, tagSize, err = flvio.ParseTagHeader(pkt.Data[sliceHeaderSize+flvio.TagHeaderLength+tagSize+4:])
 			if err != nil {
 				err = fmt.Errorf("slice ParseTagHeader err2:%s", err.Error())
 			}
 		}
+		pkt.FrameDts = av.MediaTimeFromMs(ts)
 	}
 	return
 }
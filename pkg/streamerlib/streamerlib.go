@@ -0,0 +1,336 @@
+// Package streamerlib 是streamer对外的稳定Go API, 其他服务可以通过它嵌入推流、拉流和转推能力,
+// 而不需要依赖rtmp.conn等内部实现. 本包导出的函数和选项保持向后兼容.
+package streamerlib
+
+import (
+	"context"
+	"io"
+	"net"
+	url2 "net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bugVanisher/streamer/downstream"
+	"github.com/bugVanisher/streamer/media/av"
+	"github.com/bugVanisher/streamer/media/av/avutil"
+	"github.com/bugVanisher/streamer/media/av/pktque"
+	"github.com/bugVanisher/streamer/media/container/flv"
+	"github.com/bugVanisher/streamer/media/protocol/rtmp"
+	"github.com/bugVanisher/streamer/pusher"
+)
+
+// options 推拉流的公共选项
+type options struct {
+	duration         time.Duration
+	dialTimeout      time.Duration
+	readWriteTimeout time.Duration
+	chunkSize        int
+}
+
+// Option 推拉流选项设置函数
+type Option func(*options)
+
+// WithDuration 设置运行时长, 到期后自动停止, 0表示一直运行直到Stop
+func WithDuration(d time.Duration) Option {
+	return func(o *options) {
+		o.duration = d
+	}
+}
+
+// WithDialTimeout 设置建立连接的超时时间
+func WithDialTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.dialTimeout = d
+	}
+}
+
+// WithReadWriteTimeout 设置读写超时时间
+func WithReadWriteTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.readWriteTimeout = d
+	}
+}
+
+// WithChunkSize 设置rtmp推流的ChunkSize
+func WithChunkSize(size int) Option {
+	return func(o *options) {
+		o.chunkSize = size
+	}
+}
+
+func newOptions(opt []Option) *options {
+	o := &options{}
+	for _, f := range opt {
+		f(o)
+	}
+	return o
+}
+
+func (o *options) rtmpOptions() []rtmp.Option {
+	var opts []rtmp.Option
+	if o.dialTimeout > 0 {
+		opts = append(opts, rtmp.WithDialTimeout(o.dialTimeout))
+	}
+	if o.readWriteTimeout > 0 {
+		opts = append(opts, rtmp.WithReadWriteTimeout(o.readWriteTimeout))
+	}
+	if o.chunkSize > 0 {
+		opts = append(opts, rtmp.WithChunkSize(o.chunkSize))
+	}
+	return opts
+}
+
+// Handle 正在运行的推拉流任务
+type Handle struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	once sync.Once
+	err  error
+}
+
+func start(ctx context.Context, o *options, run func(ctx context.Context) error) *Handle {
+	var cancel context.CancelFunc
+	if o.duration > 0 {
+		ctx, cancel = context.WithTimeout(ctx, o.duration)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+	h := &Handle{cancel: cancel, done: make(chan struct{})}
+	go func() {
+		defer close(h.done)
+		defer cancel()
+		err := run(ctx)
+		if ctx.Err() != nil {
+			// 主动停止或到期导致的错误不对外暴露
+			err = nil
+		}
+		h.err = err
+	}()
+	return h
+}
+
+// Stop 停止任务并等待其退出
+func (h *Handle) Stop() error {
+	h.once.Do(h.cancel)
+	return h.Wait()
+}
+
+// Wait 等待任务结束, 返回任务的错误
+func (h *Handle) Wait() error {
+	<-h.done
+	return h.err
+}
+
+// Done 任务结束时关闭
+func (h *Handle) Done() <-chan struct{} {
+	return h.done
+}
+
+// Publish 把source(本地flv文件或http-flv地址)循环推送到rtmp地址url
+func Publish(ctx context.Context, url string, source string, opt ...Option) *Handle {
+	o := newOptions(opt)
+	p := pusher.NewRtmpPusher(url, source, o.rtmpOptions()...)
+	return start(ctx, o, p.Publish)
+}
+
+// Pull 拉取url(http-flv或rtmp地址), 以flv格式写入w, w为nil时丢弃数据. 源结束时任务正常结束
+func Pull(ctx context.Context, url string, w io.Writer, opt ...Option) *Handle {
+	o := newOptions(opt)
+	if w == nil {
+		w = io.Discard
+	}
+	if !isRTMP(url) {
+		d := downstream.NewFlvDownStreamer(url, w)
+		return start(ctx, o, func(ctx context.Context) error {
+			_, err := d.Pull(ctx)
+			return err
+		})
+	}
+	return start(ctx, o, func(ctx context.Context) error {
+		src, err := openSource(url, o)
+		if err != nil {
+			return err
+		}
+		return copyAV(ctx, flv.NewMuxer(w), src)
+	})
+}
+
+// Relay 从src(rtmp地址、http-flv地址或本地flv文件)拉流并转推到rtmp地址dst, 只转推一遍, 源结束时任务正常结束.
+// 本地文件按时间戳实时推送; 源或dst断开时不重连, 需要循环推送文件时使用Publish
+func Relay(ctx context.Context, src string, dst string, opt ...Option) *Handle {
+	o := newOptions(opt)
+	return start(ctx, o, func(ctx context.Context) error {
+		demuxer, err := openSource(src, o)
+		if err != nil {
+			return err
+		}
+		conn, err := dialRTMP(dst, o)
+		if err != nil {
+			demuxer.Close()
+			return err
+		}
+		if err = conn.ConnectPublish(); err != nil {
+			demuxer.Close()
+			conn.Close()
+			return err
+		}
+		return copyAV(ctx, conn, demuxer)
+	})
+}
+
+func isRTMP(url string) bool {
+	return strings.HasPrefix(url, "rtmp://") || strings.HasPrefix(url, "rtmps://")
+}
+
+// dialRTMP 建连并完成握手, url未指定端口时使用1935
+func dialRTMP(rawURL string, o *options) (rtmp.Conn, error) {
+	u, err := url2.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	host := u.Host
+	if u.Port() == "" {
+		host += ":1935"
+	}
+	conn, err := rtmp.Dial(host, append([]rtmp.Option{rtmp.WithTcURL(rawURL)}, o.rtmpOptions()...)...)
+	if err != nil {
+		return nil, err
+	}
+	if err = conn.HandshakeClient(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// openSource 打开拉流源, rtmp地址以play方式拉流, 其他交给avutil.Open. 本地文件加上实时节奏控制
+func openSource(src string, o *options) (av.DemuxCloser, error) {
+	if isRTMP(src) {
+		conn, err := dialRTMP(src, o)
+		if err != nil {
+			return nil, err
+		}
+		if err = conn.ConnectPlay(); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return conn, nil
+	}
+	file, err := avutil.Open(src)
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasPrefix(src, "http") {
+		return file, nil
+	}
+	return &pacedDemuxer{FilterDemuxer: &pktque.FilterDemuxer{Demuxer: file, Filter: &pktque.Walltime{}}, file: file}, nil
+}
+
+// pacedDemuxer 按时间戳实时读取本地文件
+type pacedDemuxer struct {
+	*pktque.FilterDemuxer
+	file av.DemuxCloser
+}
+
+func (d *pacedDemuxer) Close() error {
+	return d.file.Close()
+}
+
+// copyAV 把src写入dst直到src结束, ctx取消时关闭两端以中断阻塞的读写
+func copyAV(ctx context.Context, dst av.Muxer, src av.DemuxCloser) error {
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			src.Close()
+			if c, ok := dst.(io.Closer); ok {
+				c.Close()
+			}
+		case <-stop:
+		}
+	}()
+	defer src.Close()
+	if c, ok := dst.(io.Closer); ok {
+		defer c.Close()
+	}
+	err := av.NewTransport().CopyAV(ctx, dst, src)
+	if err == io.EOF {
+		return nil
+	}
+	return err
+}
+
+// Serve 在addr上启动rtmp服务端, 推流按app/stream分发给拉流
+func Serve(ctx context.Context, addr string, opt ...Option) *Handle {
+	return StartServer(ctx, addr, opt...).Handle
+}
+
+// Server 正在运行的rtmp服务端, 除了拉流之外还可以把流写入自定义的av.Muxer
+type Server struct {
+	*Handle
+	s    *rtmp.Server
+	addr net.Addr
+}
+
+// StartServer 同Serve, 返回的Server可以用AttachSink挂接sink. addr在返回前已开始监听, 监听失败时任务立即结束并返回错误
+func StartServer(ctx context.Context, addr string, opt ...Option) *Server {
+	o := newOptions(opt)
+	s := rtmp.NewServer(addr, o.rtmpOptions()...)
+	if addr == "" {
+		addr = ":1935"
+	}
+	l, err := net.Listen("tcp", addr)
+	h := start(ctx, o, func(ctx context.Context) error {
+		if err != nil {
+			return err
+		}
+		go func() {
+			<-ctx.Done()
+			s.Close()
+		}()
+		return s.Serve(l)
+	})
+	srv := &Server{Handle: h, s: s}
+	if err == nil {
+		srv.addr = l.Addr()
+	}
+	return srv
+}
+
+// Addr 实际监听的地址, addr端口为0时可以由此得到分配的端口. 监听失败时为nil
+func (s *Server) Addr() net.Addr {
+	return s.addr
+}
+
+// Sink 挂在服务端流上的自定义av.Muxer, 见AttachSink
+type Sink = rtmp.Sink
+
+// SinkOption AttachSink的选项
+type SinkOption = rtmp.SinkOption
+
+// SinkPolicy sink写入跟不上推流时的处理策略
+type SinkPolicy = rtmp.SinkPolicy
+
+const (
+	SinkBlock   = rtmp.SinkBlock   // 不主动跳帧
+	SinkSkip    = rtmp.SinkSkip    // 落后时跳到最新的关键帧
+	SinkDegrade = rtmp.SinkDegrade // 持续落后时只写音频和定期的关键帧
+)
+
+var (
+	// WithSinkPolicy 设置sink跟不上时的策略
+	WithSinkPolicy = rtmp.WithSinkPolicy
+	// WithSinkFollow 推流结束后继续等待下一次推流
+	WithSinkFollow = rtmp.WithSinkFollow
+	// WithSinkErrorHandler sink出错停止时回调
+	WithSinkErrorHandler = rtmp.WithSinkErrorHandler
+)
+
+// AttachSink 把mux挂到key(app/stream)对应的流上, 推流开始后mux依次收到WriteHeader、WritePacket和WriteTrailer.
+// mux返回错误时sink停止, 错误由Sink.Wait返回; 服务端停止时sink正常结束
+func (s *Server) AttachSink(key string, mux av.Muxer, opt ...SinkOption) *Sink {
+	return s.s.AttachSink(key, mux, opt...)
+}
@@ -0,0 +1,131 @@
+package streamerlib
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bugVanisher/streamer/media/av"
+	"github.com/bugVanisher/streamer/media/codec/h264parser"
+	"github.com/bugVanisher/streamer/media/container/flv"
+	"github.com/bugVanisher/streamer/media/container/flv/flvio"
+)
+
+// writeTestFLV 写一秒只有H.264视频的flv文件, 25fps, 每5帧一个关键帧, 第i帧的内容都是byte(i+1)
+func writeTestFLV(t *testing.T) string {
+	sps := []byte{0x67, 0x64, 0x00, 0x1e, 0xac, 0xd9, 0x40, 0xa0, 0x2f, 0xf9, 0x70, 0x11, 0x00, 0x00, 0x03,
+		0x00, 0x01, 0x00, 0x00, 0x03, 0x00, 0x32, 0x0f, 0x16, 0x2d, 0x96}
+	h264, err := h264parser.NewCodecDataFromSPSAndPPS(sps, []byte{0x68, 0xeb, 0xe3, 0xcb, 0x22, 0xc0})
+	require.Nil(t, err)
+
+	name := filepath.Join(t.TempDir(), "streamerlib.flv")
+	f, err := os.Create(name)
+	require.Nil(t, err)
+	defer f.Close()
+	m := flv.NewMuxer(f)
+	require.Nil(t, m.WriteHeader([]av.CodecData{h264}))
+	for i := 0; i < 25; i++ {
+		require.Nil(t, m.WritePacket(av.Packet{
+			IsKeyFrame:    i%5 == 0,
+			DataType:      int8(flvio.TAG_VIDEO),
+			AVCPacketType: av.AVC_NALU,
+			Time:          av.MediaTimeFromMs(int32(i * 40)),
+			Data:          bytes.Repeat([]byte{byte(i + 1)}, 10000),
+		}))
+	}
+	require.Nil(t, m.WriteTrailer())
+	return name
+}
+
+// lockedBuffer 可以在拉流goroutine写入的同时读取长度
+type lockedBuffer struct {
+	lock sync.Mutex
+	buf  bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) Len() int {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.buf.Len()
+}
+
+func (b *lockedBuffer) Bytes() []byte {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return append([]byte(nil), b.buf.Bytes()...)
+}
+
+func TestPublishRelayPull(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	srv := StartServer(ctx, "127.0.0.1:0")
+	require.NotNil(t, srv.Addr())
+	base := "rtmp://" + srv.Addr().String() + "/live/"
+	file := writeTestFLV(t)
+
+	pub := Publish(ctx, base+"src", file)
+	time.Sleep(200 * time.Millisecond)
+	relay := Relay(ctx, base+"src", base+"dst")
+	var pulled lockedBuffer
+	pull := Pull(ctx, base+"dst", &pulled)
+
+	// 文件循环推送, 经过转推后拉到的数据超过两遍文件
+	for i := 0; i < 100 && pulled.Len() < 500000; i++ {
+		time.Sleep(50 * time.Millisecond)
+	}
+	require.True(t, pulled.Len() >= 500000, "pulled %d bytes", pulled.Len())
+
+	require.Nil(t, pull.Stop())
+	require.Nil(t, relay.Stop())
+	require.Nil(t, pub.Stop())
+	// 取消ctx后服务端也正常结束
+	cancel()
+	require.Nil(t, srv.Wait())
+
+	// 拉到的是完整的flv, 帧内容和文件一致
+	demuxer := flv.NewDemuxer(io.NopCloser(bytes.NewReader(pulled.Bytes())))
+	streams, err := demuxer.Streams()
+	require.Nil(t, err)
+	require.Equal(t, av.H264, streams[0].Type())
+	for i := 0; i < 30; i++ {
+		pkt, err := demuxer.ReadPacket()
+		require.Nil(t, err)
+		require.Len(t, pkt.Data, 10000)
+		require.Equal(t, bytes.Repeat(pkt.Data[:1], 10000), pkt.Data)
+	}
+}
+
+func TestRelayFileOnce(t *testing.T) {
+	ctx := context.Background()
+	srv := StartServer(ctx, "127.0.0.1:0")
+	defer srv.Stop()
+	base := "rtmp://" + srv.Addr().String() + "/live/"
+
+	// 本地文件只按时间戳实时转推一遍, 推完后任务正常结束
+	start := time.Now()
+	relay := Relay(ctx, writeTestFLV(t), base+"once")
+	select {
+	case <-relay.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("relay of a file did not finish")
+	}
+	require.Nil(t, relay.Wait())
+	require.True(t, time.Since(start) >= 900*time.Millisecond, "not paced: %v", time.Since(start))
+
+	// 地址不可用时返回错误
+	require.NotNil(t, Relay(ctx, writeTestFLV(t), "rtmp://127.0.0.1:1/live/none", WithDialTimeout(time.Second)).Wait())
+	require.NotNil(t, StartServer(ctx, srv.Addr().String()).Wait())
+}
@@ -0,0 +1,156 @@
+package pusher
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bugVanisher/streamer/media/protocol/rtmp"
+	"github.com/rs/zerolog/log"
+)
+
+// ChurnReportInterval churn统计输出间隔
+var ChurnReportInterval = 5 * time.Second
+
+// Churner 按固定速率不断启动推流并在生命周期结束后停止, 用于压测服务端的注册/回收路径
+type Churner struct {
+	pusher   *RtmpOverTcpUpStreamer
+	rate     float64
+	lifetime time.Duration
+
+	seq      int64
+	active   int64
+	started  int64
+	failed   int64
+	accepted int64
+	latency  int64 // 累计accept耗时, 单位纳秒
+
+	total ChurnStat
+}
+
+// ChurnStat 一段时间内的churn统计
+type ChurnStat struct {
+	Started       int64
+	Accepted      int64
+	Failed        int64
+	AcceptLatency time.Duration // 累计accept耗时
+}
+
+// FailRate 启动失败的比例
+func (s ChurnStat) FailRate() float64 {
+	if s.Started == 0 {
+		return 0
+	}
+	return float64(s.Failed) / float64(s.Started)
+}
+
+// AvgAcceptLatency 平均accept耗时
+func (s ChurnStat) AvgAcceptLatency() time.Duration {
+	if s.Accepted == 0 {
+		return 0
+	}
+	return s.AcceptLatency / time.Duration(s.Accepted)
+}
+
+// NewChurner 创建churn推流, rate为每秒启动的推流数, lifetime为每路推流的存活时间, 都必须大于0
+func NewChurner(rtmpUrl string, filename string, rate float64, lifetime time.Duration, option ...rtmp.Option) (*Churner, error) {
+	if rate <= 0 {
+		return nil, fmt.Errorf("churn rate must be positive, got %v", rate)
+	}
+	if lifetime <= 0 {
+		return nil, fmt.Errorf("churn lifetime must be positive, got %v", lifetime)
+	}
+	return &Churner{
+		pusher:   NewRtmpPusher(rtmpUrl, filename, option...),
+		rate:     rate,
+		lifetime: lifetime,
+	}, nil
+}
+
+// Total Publish返回后的累计统计
+func (c *Churner) Total() ChurnStat {
+	return c.total
+}
+
+// Publish 实现Pusher接口, 阻塞直到ctx结束
+func (c *Churner) Publish(ctx context.Context) error {
+	interval := time.Duration(float64(time.Second) / c.rate)
+	if interval <= 0 {
+		interval = time.Millisecond
+	}
+	spawn := time.NewTicker(interval)
+	defer spawn.Stop()
+	report := time.NewTicker(ChurnReportInterval)
+	defer report.Stop()
+
+	var wg sync.WaitGroup
+	for {
+		select {
+		case <-ctx.Done():
+			// 等所有推流停止后再输出, 最后一个周期的统计才完整
+			wg.Wait()
+			c.report()
+			return nil
+		case <-report.C:
+			c.report()
+		case <-spawn.C:
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				c.one(ctx, IndexedURL(c.pusher.rtmpUrl, i))
+			}(int(atomic.AddInt64(&c.seq, 1) - 1))
+		}
+	}
+}
+
+// one 启动一路推流, 记录accept耗时, 存活lifetime后停止
+func (c *Churner) one(ctx context.Context, url string) {
+	atomic.AddInt64(&c.started, 1)
+	start := time.Now()
+	conn, err := c.pusher.dial(url)
+	if err == nil {
+		defer conn.Close()
+		err = conn.Publish()
+	}
+	if err != nil {
+		atomic.AddInt64(&c.failed, 1)
+		log.Debug().Err(err).Str("url", url).Msg("churn publish failed")
+		return
+	}
+	atomic.AddInt64(&c.accepted, 1)
+	atomic.AddInt64(&c.latency, int64(time.Since(start)))
+	atomic.AddInt64(&c.active, 1)
+	defer atomic.AddInt64(&c.active, -1)
+
+	ctx, cancel := context.WithTimeout(ctx, c.lifetime)
+	defer cancel()
+	if err = c.pusher.stream(ctx, conn, url, c.pusher.filename); err != nil && ctx.Err() == nil {
+		log.Debug().Err(err).Str("url", url).Msg("churn stream broken")
+	}
+}
+
+// report 输出本周期的accept耗时和失败率, 累加到总计后清零周期计数
+func (c *Churner) report() ChurnStat {
+	stat := ChurnStat{
+		Started:       atomic.SwapInt64(&c.started, 0),
+		Failed:        atomic.SwapInt64(&c.failed, 0),
+		Accepted:      atomic.SwapInt64(&c.accepted, 0),
+		AcceptLatency: time.Duration(atomic.SwapInt64(&c.latency, 0)),
+	}
+	c.total.Started += stat.Started
+	c.total.Failed += stat.Failed
+	c.total.Accepted += stat.Accepted
+	c.total.AcceptLatency += stat.AcceptLatency
+
+	log.Info().
+		Int64("started", stat.Started).
+		Int64("accepted", stat.Accepted).
+		Int64("failed", stat.Failed).
+		Float64("fail_rate", stat.FailRate()).
+		Dur("avg_accept_latency", stat.AvgAcceptLatency()).
+		Int64("active", atomic.LoadInt64(&c.active)).
+		Msg("churn statistic")
+	return stat
+}
@@ -0,0 +1,72 @@
+package pusher
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bugVanisher/streamer/media/protocol/common"
+	"github.com/bugVanisher/streamer/media/protocol/rtmp"
+)
+
+// oddRejectHook 拒绝序号为奇数的推流
+type oddRejectHook struct{}
+
+func (oddRejectHook) OnPlayOrPublish(info common.Info) error {
+	i, err := strconv.Atoi(strings.TrimPrefix(info.StreamName, "churn"))
+	if err != nil || i%2 == 1 {
+		return errors.New("rejected")
+	}
+	return nil
+}
+
+func (oddRejectHook) OnUnpublish(info common.Info) {}
+
+func TestNewChurnerValidate(t *testing.T) {
+	_, err := NewChurner("rtmp://127.0.0.1/live/churn", "/tmp/a.flv", 0, time.Second)
+	require.NotNil(t, err)
+	_, err = NewChurner("rtmp://127.0.0.1/live/churn", "/tmp/a.flv", -1, time.Second)
+	require.NotNil(t, err)
+	_, err = NewChurner("rtmp://127.0.0.1/live/churn", "/tmp/a.flv", 10, 0)
+	require.NotNil(t, err)
+}
+
+func TestChurner(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	s := rtmp.NewServer("")
+	s.SetVhostHook(rtmp.VhostAll, oddRejectHook{})
+	go s.Serve(l)
+	defer s.Close()
+
+	// 每秒20路, 每路存活200ms, 稳定后约有4路同时在推
+	c, err := NewChurner("rtmp://"+l.Addr().String()+"/live/churn%d", writeTestFLV(t, 1000), 20, 200*time.Millisecond)
+	require.Nil(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Publish(ctx)
+	}()
+	time.Sleep(700 * time.Millisecond)
+	active := atomic.LoadInt64(&c.active)
+	require.True(t, active >= 1 && active <= 4, "active %d", active)
+	require.Nil(t, <-done)
+
+	// Publish等所有推流停止后才输出最后的统计
+	require.Equal(t, int64(0), atomic.LoadInt64(&c.active))
+	total := c.Total()
+	require.True(t, total.Started >= 15 && total.Started <= 20, "started %d", total.Started)
+	require.Equal(t, total.Started, total.Accepted+total.Failed)
+	// 序号从0开始, 奇数序号被拒绝
+	require.Equal(t, total.Started/2, total.Failed)
+	require.InDelta(t, float64(total.Started/2)/float64(total.Started), total.FailRate(), 1e-9)
+	require.True(t, total.AvgAcceptLatency() > 0 && total.AvgAcceptLatency() < time.Second, "latency %v", total.AvgAcceptLatency())
+}
@@ -0,0 +1,56 @@
+package pusher
+
+import (
+	"context"
+	"io"
+
+	"github.com/bugVanisher/streamer/media/av/avutil"
+	"github.com/bugVanisher/streamer/media/protocol/rtmp"
+	"github.com/rs/zerolog/log"
+)
+
+// DryRun 建连并publish, 只发送音视频头和第一个GOP, 检查后断开连接
+func DryRun(ctx context.Context, rtmpUrl string, filename string, option ...rtmp.Option) (report avutil.GOPReport, err error) {
+	r := NewRtmpPusher(rtmpUrl, filename, option...)
+	conn, err := r.dial(rtmpUrl)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	if err = conn.Publish(); err != nil {
+		log.Error().Err(err).Msg("rtmp Publish error")
+		return
+	}
+
+	file, err := avutil.Open(filename)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	streams, err := file.Streams()
+	if err != nil {
+		return
+	}
+	checker := avutil.NewGOPChecker(streams)
+	if err = conn.WriteHeader(streams); err != nil {
+		return
+	}
+	for ctx.Err() == nil {
+		pkt, rerr := file.ReadPacket()
+		if rerr == io.EOF {
+			break
+		}
+		if rerr != nil {
+			err = rerr
+			return
+		}
+		if err = conn.WritePacket(pkt); err != nil {
+			return
+		}
+		if checker.Add(pkt) {
+			break
+		}
+	}
+	return checker.Report(), ctx.Err()
+}
@@ -0,0 +1,70 @@
+package pusher
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bugVanisher/streamer/media/av"
+	"github.com/bugVanisher/streamer/media/codec/h264parser"
+	"github.com/bugVanisher/streamer/media/container/flv"
+	"github.com/bugVanisher/streamer/media/container/flv/flvio"
+	"github.com/bugVanisher/streamer/media/protocol/rtmp"
+)
+
+// writeTestFLV 写一个只有H.264视频的flv文件, 每帧大小不同以便比对
+func writeTestFLV(t *testing.T, frameSize int) string {
+	sps := []byte{0x67, 0x64, 0x00, 0x1e, 0xac, 0xd9, 0x40, 0xa0, 0x2f, 0xf9, 0x70, 0x11, 0x00, 0x00, 0x03,
+		0x00, 0x01, 0x00, 0x00, 0x03, 0x00, 0x32, 0x0f, 0x16, 0x2d, 0x96}
+	h264, err := h264parser.NewCodecDataFromSPSAndPPS(sps, []byte{0x68, 0xeb, 0xe3, 0xcb, 0x22, 0xc0})
+	require.Nil(t, err)
+
+	name := filepath.Join(t.TempDir(), "interop.flv")
+	f, err := os.Create(name)
+	require.Nil(t, err)
+	defer f.Close()
+	m := flv.NewMuxer(f)
+	require.Nil(t, m.WriteHeader([]av.CodecData{h264}))
+	for i := 0; i < 10; i++ {
+		require.Nil(t, m.WritePacket(av.Packet{
+			IsKeyFrame:    i == 0,
+			DataType:      int8(flvio.TAG_VIDEO),
+			AVCPacketType: av.AVC_NALU,
+			Time:          av.MediaTimeFromMs(int32(i * 40)),
+			Data:          bytes.Repeat([]byte{byte(i + 1)}, frameSize+i),
+		}))
+	}
+	require.Nil(t, m.WriteTrailer())
+	return name
+}
+
+func TestInterop(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	s := rtmp.NewServer("")
+	go s.Serve(l)
+	defer s.Close()
+
+	reports := Interop(context.Background(), []InteropEndpoint{
+		{Name: "builtin", URL: "rtmp://" + l.Addr().String() + "/live/interop"},
+	}, InteropOptions{
+		File:      writeTestFLV(t, 3000),
+		ChunkSize: 1000,
+		RunFor:    3 * time.Second,
+	})
+	require.Len(t, reports, 1)
+	r := reports[0]
+	require.Equal(t, InteropPass, r.ComplexHandshake.Status)
+	require.Equal(t, InteropPass, r.SimpleHandshake.Status)
+	require.Equal(t, InteropCheck{Status: InteropPass, Detail: "open"}, r.Auth)
+	require.Equal(t, InteropPass, r.Publish.Status, r.Publish.Detail)
+	require.Equal(t, InteropPass, r.ChunkSizeHonored.Status)
+	require.True(t, r.PeerChunkSize > 0)
+	require.Equal(t, InteropSkip, r.HEVC.Status)
+}
@@ -0,0 +1,161 @@
+package pusher
+
+import (
+	"context"
+	"time"
+
+	"github.com/bugVanisher/streamer/media/av"
+	"github.com/bugVanisher/streamer/media/protocol/rtmp"
+	"github.com/rs/zerolog/log"
+)
+
+// Reconnect 推流断线重连策略
+type Reconnect struct {
+	MaxRetries int           // 每次断线最多连续重连的次数, 0表示不重连, 小于0表示不限次数
+	MinBackoff time.Duration // 第一次重连前的等待时间, 之后每次翻倍
+	MaxBackoff time.Duration // 重连等待时间的上限
+}
+
+// DefaultReconnect 默认的重连策略, 无限重试, 等待时间从500ms翻倍到10s
+var DefaultReconnect = Reconnect{MaxRetries: -1, MinBackoff: 500 * time.Millisecond, MaxBackoff: 10 * time.Second}
+
+// Enabled 是否开启重连
+func (p Reconnect) Enabled() bool {
+	return p.MaxRetries != 0
+}
+
+// Backoff 第attempt次(从1开始)重连前的等待时间
+func (p Reconnect) Backoff(attempt int) time.Duration {
+	d := p.MinBackoff
+	if d <= 0 {
+		d = DefaultReconnect.MinBackoff
+	}
+	for i := 1; i < attempt; i++ {
+		d *= 2
+		if p.MaxBackoff > 0 && d >= p.MaxBackoff {
+			return p.MaxBackoff
+		}
+	}
+	return d
+}
+
+// resumeMuxer 包装推流连接, 写入失败时按重连策略重新建连并publish, 补发header后继续写入.
+// 时间戳在重连前后保持单调递增, 下游看到的是一条连续的流. 重连后丢弃视频直到下一个关键帧, 音频照常写入
+type resumeMuxer struct {
+	ctx    context.Context
+	pusher *RtmpOverTcpUpStreamer
+	url    string
+	dial   func(url string) (rtmp.Conn, error)
+
+	conn       rtmp.Conn
+	streams    []av.CodecData
+	last       av.MediaTime
+	prevTx     uint64 // 已断开连接的发送字节数
+	reconnects int
+	waitKey    bool // 重连后还没有写入视频关键帧
+}
+
+func newResumeMuxer(ctx context.Context, pusher *RtmpOverTcpUpStreamer, url string, conn rtmp.Conn) *resumeMuxer {
+	return &resumeMuxer{ctx: ctx, pusher: pusher, url: url, dial: pusher.dial, conn: conn}
+}
+
+// WriteHeader 实现av.Muxer, 记录header用于重连后补发
+func (m *resumeMuxer) WriteHeader(streams []av.CodecData) error {
+	m.streams = streams
+	if err := m.conn.WriteHeader(streams); err != nil {
+		// 重连成功时header已经补发
+		return m.resume(err, nil)
+	}
+	return nil
+}
+
+// WritePacket 实现av.Muxer
+func (m *resumeMuxer) WritePacket(pkt av.Packet) error {
+	if pkt.Time < m.last {
+		pkt.Time = m.last
+	}
+	m.last = pkt.Time
+	if err := m.writePacket(pkt); err != nil {
+		return m.resume(err, func() error { return m.writePacket(pkt) })
+	}
+	return nil
+}
+
+// writePacket 重连后新连接从GOP中间开始时下游无法解码, 丢弃视频帧直到关键帧
+func (m *resumeMuxer) writePacket(pkt av.Packet) error {
+	if m.waitKey && pkt.IsVideo() && !pkt.IsSequenceHeader() {
+		if !pkt.IsKeyFrame {
+			return nil
+		}
+		m.waitKey = false
+	}
+	return m.conn.WritePacket(pkt)
+}
+
+// WriteTrailer 实现av.Muxer
+func (m *resumeMuxer) WriteTrailer() error {
+	return m.conn.WriteTrailer()
+}
+
+// Close 关闭当前连接
+func (m *resumeMuxer) Close() error {
+	return m.conn.Close()
+}
+
+// TxBytes 所有连接累计的发送字节数
+func (m *resumeMuxer) TxBytes() uint64 {
+	return m.prevTx + m.conn.TxBytes()
+}
+
+// resume 写入失败后重连, retry不为空时在重连成功后重试写入
+func (m *resumeMuxer) resume(err error, retry func() error) error {
+	policy := m.pusher.reconnect
+	if !policy.Enabled() {
+		return err
+	}
+	for attempt := 1; policy.MaxRetries < 0 || attempt <= policy.MaxRetries; attempt++ {
+		backoff := policy.Backoff(attempt)
+		log.Warn().Err(err).Str("url", m.url).Int("attempt", attempt).Dur("backoff", backoff).
+			Int64("lastTs", int64(m.last.Ms())).Msg("publish broken, reconnecting")
+		select {
+		case <-m.ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		if err = m.reconnect(); err != nil {
+			continue
+		}
+		if retry != nil {
+			if err = retry(); err != nil {
+				continue
+			}
+		}
+		m.reconnects++
+		log.Info().Str("url", m.url).Int("reconnects", m.reconnects).Msg("publish resumed")
+		return nil
+	}
+	return err
+}
+
+// reconnect 关闭旧连接, 重新建连publish并补发header
+func (m *resumeMuxer) reconnect() error {
+	m.conn.Close()
+	conn, err := m.dial(m.url)
+	if err != nil {
+		return err
+	}
+	if err = conn.Publish(); err != nil {
+		conn.Close()
+		return err
+	}
+	if len(m.streams) > 0 {
+		if err = conn.WriteHeader(m.streams); err != nil {
+			conn.Close()
+			return err
+		}
+	}
+	m.prevTx += m.conn.TxBytes()
+	m.conn = conn
+	m.waitKey = true
+	return nil
+}
@@ -0,0 +1,101 @@
+package pusher
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bugVanisher/streamer/media/av"
+	"github.com/bugVanisher/streamer/media/protocol/rtmp"
+)
+
+func TestReconnectBackoff(t *testing.T) {
+	p := Reconnect{MaxRetries: -1, MinBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+	var backoffs []time.Duration
+	for attempt := 1; attempt <= 6; attempt++ {
+		backoffs = append(backoffs, p.Backoff(attempt))
+	}
+	require.Equal(t, []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond,
+		800 * time.Millisecond, time.Second, time.Second}, backoffs)
+
+	// 没有设置时使用默认值, 不设上限
+	require.Equal(t, DefaultReconnect.MinBackoff, Reconnect{}.Backoff(1))
+	require.Equal(t, 8*DefaultReconnect.MinBackoff, Reconnect{}.Backoff(4))
+	require.False(t, Reconnect{}.Enabled())
+	require.True(t, DefaultReconnect.Enabled())
+}
+
+// fakeConn 记录写入的header和packet, 写入failAt个packet后断开
+type fakeConn struct {
+	rtmp.Conn
+	failAt  int
+	streams []av.CodecData
+	pkts    []av.Packet
+	closed  bool
+}
+
+func (c *fakeConn) Publish() error { return nil }
+
+func (c *fakeConn) WriteHeader(streams []av.CodecData) error {
+	c.streams = streams
+	return nil
+}
+
+func (c *fakeConn) WritePacket(pkt av.Packet) error {
+	if c.failAt > 0 && len(c.pkts) >= c.failAt {
+		return errors.New("broken pipe")
+	}
+	c.pkts = append(c.pkts, pkt)
+	return nil
+}
+
+func (c *fakeConn) Close() error {
+	c.closed = true
+	return nil
+}
+
+func (c *fakeConn) TxBytes() uint64 { return 100 }
+
+func TestResumeMuxer(t *testing.T) {
+	first := &fakeConn{failAt: 2}
+	second := &fakeConn{}
+	p := &RtmpOverTcpUpStreamer{reconnect: Reconnect{MaxRetries: 1, MinBackoff: time.Millisecond}}
+	m := newResumeMuxer(context.Background(), p, "rtmp://127.0.0.1/live/test", first)
+	m.dial = func(url string) (rtmp.Conn, error) {
+		return second, nil
+	}
+
+	video := func(ms int32, key bool) av.Packet {
+		return av.Packet{DataType: int8(av.FLV_TAG_VIDEO), AVCPacketType: av.AVC_NALU, IsKeyFrame: key,
+			Time: av.MediaTimeFromMs(ms), Data: []byte{byte(ms)}}
+	}
+	audio := func(ms int32) av.Packet {
+		return av.Packet{DataType: int8(av.FLV_TAG_AUDIO), AVCPacketType: av.AAC_RAW, Time: av.MediaTimeFromMs(ms),
+			Data: []byte{byte(ms)}}
+	}
+	streams := []av.CodecData{nil}
+	require.Nil(t, m.WriteHeader(streams))
+	for _, pkt := range []av.Packet{
+		video(0, true), video(40, false),
+		// 断开, 重连后这一帧和之后的非关键帧被丢弃, 音频照常写入
+		video(80, false), audio(90), video(120, false),
+		video(160, true), audio(170), video(200, false),
+	} {
+		require.Nil(t, m.WritePacket(pkt))
+	}
+
+	require.True(t, first.closed)
+	require.Len(t, first.pkts, 2)
+	require.Equal(t, streams, second.streams)
+	var times []int32
+	for _, pkt := range second.pkts {
+		times = append(times, pkt.Time.Ms())
+	}
+	require.Equal(t, []int32{90, 160, 170, 200}, times)
+	require.True(t, second.pkts[1].IsKeyFrame)
+	require.Equal(t, 1, m.reconnects)
+	require.Equal(t, uint64(200), m.TxBytes())
+}
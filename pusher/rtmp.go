@@ -2,12 +2,16 @@ package pusher
 
 import (
 	"context"
+	"fmt"
 	"github.com/bugVanisher/streamer/common/errs"
+	"github.com/bugVanisher/streamer/common/fingerprint"
 	"github.com/bugVanisher/streamer/media/av"
 	"github.com/bugVanisher/streamer/media/av/avutil"
 	"github.com/bugVanisher/streamer/media/av/pktque"
+	"github.com/bugVanisher/streamer/media/container/es"
 	"github.com/bugVanisher/streamer/media/container/flv"
 	"github.com/bugVanisher/streamer/media/protocol/rtmp"
+	"github.com/bugVanisher/streamer/statistics"
 	"github.com/rs/zerolog/log"
 	"io"
 	"net"
@@ -19,9 +23,30 @@ import (
 )
 
 type RtmpOverTcpUpStreamer struct {
-	opt      []rtmp.Option
-	rtmpUrl  string
-	filename string
+	opt       []rtmp.Option
+	rtmpUrl   string
+	filename  string
+	noPacing  bool
+	reconnect Reconnect
+	// 截取推送的片段, 见SetTrim
+	startOffset time.Duration
+	length      time.Duration
+	// 反复seek推送, 见SetSeekStress
+	seekStress *pktque.SeekStressOptions
+	// elementary stream输入, 见SetElementaryStream
+	esAudio string
+	esFPS   float64
+	// 时间戳漂移, 见SetClockDrift
+	drift *pktque.ClockDriftOptions
+	// 注入的时间戳异常, 见SetTimeAnomalies
+	anomalies []pktque.TimeAnomaly
+	// 注入的GOP结构异常, 见SetGOPMutations
+	mutations []pktque.GOPMutation
+	// 插入发送时间SEI, 见SetSendTimeSEI
+	sendTimeSEI         bool
+	sendTimeSEIKeyFrame bool
+	// 源没有音频时合成静音, 见SetSilence
+	silence *pktque.SilenceOptions
 }
 
 func NewRtmpPusher(rtmpUrl string, filename string, option ...rtmp.Option) *RtmpOverTcpUpStreamer {
@@ -33,13 +58,86 @@ func NewRtmpPusher(rtmpUrl string, filename string, option ...rtmp.Option) *Rtmp
 	return pusher
 }
 
+// SetPacing 设置推送本地文件时是否按时间戳实时发送, 默认开启
+func (r *RtmpOverTcpUpStreamer) SetPacing(enable bool) {
+	r.noPacing = !enable
+}
+
+// SetTrim 只推送文件从start之前最近的关键帧开始的片段, 时间戳从0开始, 推送length时长后写trailer结束.
+// length为0时推送到文件结束, 设置后文件只推送一遍
+func (r *RtmpOverTcpUpStreamer) SetTrim(start, length time.Duration) {
+	r.startOffset = start
+	r.length = length
+}
+
+func (r *RtmpOverTcpUpStreamer) trimmed() bool {
+	return r.startOffset > 0 || r.length > 0
+}
+
+// SetSeekStress 推送本地文件时反复seek到关键帧, 测试源站对时间戳跳变的处理, 一直推送到结束. opts为nil时关闭
+func (r *RtmpOverTcpUpStreamer) SetSeekStress(opts *pktque.SeekStressOptions) {
+	r.seekStress = opts
+}
+
+// SetClockDrift 推送本地文件时按opts改写时间戳, 模拟时钟不准的编码器, 发送节奏仍按源时间戳. opts为nil时关闭
+func (r *RtmpOverTcpUpStreamer) SetClockDrift(opts *pktque.ClockDriftOptions) {
+	r.drift = opts
+}
+
+// SetTimeAnomalies 推送本地文件时在指定的源时间注入时间戳跳变/归零/回退, 发送节奏仍按源时间戳
+func (r *RtmpOverTcpUpStreamer) SetTimeAnomalies(anomalies []pktque.TimeAnomaly) {
+	r.anomalies = anomalies
+}
+
+// SetGOPMutations 推送本地文件时在指定的源时间丢弃关键帧、去掉带内参数集、不重发sequence header或只改变PPS,
+// 验证源站和拉流端对不规范GOP结构的容忍程度
+func (r *RtmpOverTcpUpStreamer) SetGOPMutations(mutations []pktque.GOPMutation) {
+	r.mutations = mutations
+}
+
+// SetSendTimeSEI 在H.264视频帧中插入携带发送时间的SEI, 拉流端用h264parser.ParseSendTime得到端到端延迟.
+// keyFrameOnly为true时只在关键帧中插入
+func (r *RtmpOverTcpUpStreamer) SetSendTimeSEI(enable, keyFrameOnly bool) {
+	r.sendTimeSEI = enable
+	r.sendTimeSEIKeyFrame = keyFrameOnly
+}
+
+// SetSilence 源(文件或转推的URL)没有音频时合成一路AAC静音推送, 用于测试不接受纯视频流的播放器. opts为nil时关闭
+func (r *RtmpOverTcpUpStreamer) SetSilence(opts *pktque.SilenceOptions) {
+	r.silence = opts
+}
+
+// SetElementaryStream 推送的文件为视频裸流(.h264/.265)时, 和audio(.aac)合成两路流推送, audio可以为空.
+// fps为视频的帧率, 不大于0时使用SPS中的帧率
+func (r *RtmpOverTcpUpStreamer) SetElementaryStream(audio string, fps float64) {
+	r.esAudio = audio
+	r.esFPS = fps
+}
+
+// open 打开要推送的文件, 设置了elementary stream输入时合成音视频两路流
+func (r *RtmpOverTcpUpStreamer) open(file string) (av.DemuxCloser, error) {
+	if r.esAudio == "" && r.esFPS <= 0 {
+		return avutil.Open(file)
+	}
+	files := []string{file}
+	if r.esAudio != "" {
+		files = append(files, r.esAudio)
+	}
+	return es.OpenFiles(r.esFPS, files...)
+}
+
+// SetReconnect 设置推流断线后的重连策略, 默认不重连
+func (r *RtmpOverTcpUpStreamer) SetReconnect(policy Reconnect) {
+	r.reconnect = policy
+}
+
 func init() {
 	avutil.DefaultHandlers.Add(Handler)
 }
 
 func Handler(h *avutil.RegisterHandler) {
 	h.Probe = func(b []byte) bool {
-		return b[0] == 'F' && b[1] == 'L' && b[2] == 'V'
+		return len(b) >= 3 && b[0] == 'F' && b[1] == 'L' && b[2] == 'V'
 	}
 
 	h.Ext = ".flv"
@@ -75,10 +173,10 @@ func Handler(h *avutil.RegisterHandler) {
 			return false, nil, errs.Wrapf(errs.ErrConnectURL, "url: %s", s)
 		}
 
-		req.Header.Set("User-Agent", "streamer")
 		req.Header.Set("Accept", "*/*")
 		req.Header.Set("Range", "bytes=0-")
 		req.Header.Set("Connection", "close")
+		fingerprint.GetConfig().Apply(req)
 
 		response, err := httpClient.Do(req)
 		if err != nil {
@@ -98,69 +196,157 @@ func Handler(h *avutil.RegisterHandler) {
 	h.CodecTypes = flv.CodecTypes
 }
 
-func (r *RtmpOverTcpUpStreamer) publish(ctx context.Context, url string, resource string) error {
-	flvFile := resource
-	rtmpURL := url
-
-	isFile := path.IsAbs(flvFile)
+// dial 建立rtmp连接并完成handshake、connect和createStream, 返回的连接可直接publish
+func (r *RtmpOverTcpUpStreamer) dial(rtmpURL string) (rtmp.Conn, error) {
+	conn, err := dialHandshake(rtmpURL, r.opt...)
+	if err != nil {
+		return nil, err
+	}
+	err = conn.ConnectCreateStream()
+	if err != nil {
+		log.Error().Err(err).Msg("rtmp ConnectCreateStream error")
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
 
+// dialHandshake 建连并完成握手, url未指定端口时按scheme使用默认端口
+func dialHandshake(rtmpURL string, option ...rtmp.Option) (rtmp.Conn, error) {
 	u, err := url2.Parse(rtmpURL)
 	if err != nil {
 		log.Error().Err(err).Msg("parse rtmp url error")
-		return err
+		return nil, err
 	}
 	host := u.Host
 	if !strings.Contains(u.Host, ":") {
-		host = u.Host + ":1935"
+		switch u.Scheme {
+		case "rtmps", "rtmpts":
+			host = u.Host + ":443"
+		case "rtmpt":
+			host = u.Host + ":80"
+		default:
+			host = u.Host + ":1935"
+		}
 	}
-	r.opt = append([]rtmp.Option{rtmp.WithTcURL(rtmpURL)}, r.opt...)
-	conn, err := rtmp.Dial(host, r.opt...)
+	opt := append([]rtmp.Option{rtmp.WithTcURL(rtmpURL)}, option...)
+	conn, err := rtmp.Dial(host, opt...)
 	if err != nil {
 		log.Error().Err(err).Msg("rtmp dial error")
-		return err
+		return nil, err
 	}
-	defer conn.Close()
 
 	err = conn.HandshakeClient()
 	if err != nil {
 		log.Error().Err(err).Msg("rtmp HandshakeClient error")
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+func (r *RtmpOverTcpUpStreamer) publish(ctx context.Context, url string, resource string) error {
+	conn, err := r.dial(url)
+	if err != nil {
 		return err
 	}
-	err = conn.ConnectPublish()
+	defer conn.Close()
+
+	err = conn.Publish()
 	if err != nil {
-		log.Error().Err(err).Msg("rtmp ConnectPublish error")
+		log.Error().Err(err).Msg("rtmp Publish error")
 		return err
 	}
+	return r.stream(ctx, conn, url, resource)
+}
+
+// stream 循环读取文件并写入已publish的连接, 开启重连时连接断开后重新publish到url并继续推送
+func (r *RtmpOverTcpUpStreamer) stream(ctx context.Context, conn rtmp.Conn, url string, resource string) error {
+	m := newResumeMuxer(ctx, r, url, conn)
+	defer m.Close()
+
+	flvFile := resource
+	isFile := path.IsAbs(flvFile)
 
 	pktCount := 0
+	overhead := statistics.NewOverhead(conn.ProtoType())
+	lastStat := time.Now()
 
 	t := av.NewTransport(av.WithAfterWritePacket(func(pkt *av.Packet) error {
 		pktCount++
 		if pktCount%1000 == 0 {
 			log.Debug().Msgf("send packet count %d", pktCount)
 		}
+		overhead.AddMedia(uint64(len(pkt.Data)))
+		if time.Since(lastStat) >= statistics.StatInterval {
+			lastStat = time.Now()
+			overhead.SetWire(m.TxBytes())
+			log.Debug().Str("proto", overhead.Proto).
+				Uint64("wireBytes", overhead.WireBytes()).
+				Uint64("mediaBytes", overhead.MediaBytes()).
+				Float64("overhead", overhead.GetOverhead()).
+				Msg("publish overhead stat")
+		}
 		return nil
 	}))
 
 	round := 0
 
+	if r.seekStress != nil {
+		if !isFile {
+			return fmt.Errorf("seek stress needs a local file, got %s", flvFile)
+		}
+		return r.streamSeekStress(ctx, t, m, flvFile)
+	}
+
 	filters := pktque.Filters{}
 	if isFile {
-		filters = append(filters, &pktque.FixTime{MakeIncrement: true}, &pktque.Walltime{})
+		filters = append(filters, &pktque.FixTime{MakeIncrement: true})
+		if !r.noPacing {
+			filters = append(filters, &pktque.Walltime{})
+		}
+		if r.drift != nil {
+			filters = append(filters, pktque.NewClockDrift(*r.drift))
+		}
+		if len(r.anomalies) > 0 {
+			filters = append(filters, pktque.NewTimeAnomalies(r.anomalies))
+		}
+	}
+	if r.sendTimeSEI {
+		filters = append(filters, pktque.NewSendTimeSEI(r.sendTimeSEIKeyFrame))
 	}
 	var demuxer = &pktque.FilterDemuxer{Filter: filters}
+	var src av.Demuxer = demuxer
+	if isFile && len(r.mutations) > 0 {
+		// 在FixTime之后注入, 文件循环推送时只注入一次
+		src = pktque.NewGOPMutationDemuxer(demuxer, r.mutations)
+	}
+	if r.silence != nil {
+		silence, err := pktque.NewSilenceDemuxer(src, *r.silence)
+		if err != nil {
+			return err
+		}
+		src = silence
+	}
 	for {
-		file, err := avutil.Open(flvFile)
+		file, err := r.open(flvFile)
 		if err != nil {
 			log.Error().Err(err).Msg("open file error")
 			return err
 		}
 		demuxer.Demuxer = file
-		err = t.CopyAV(ctx, conn, demuxer)
+		if r.trimmed() {
+			demuxer.Demuxer = pktque.NewTrimDemuxer(file, r.startOffset, r.length)
+		}
+		err = t.CopyAV(ctx, m, src)
 		if err != io.EOF {
 			log.Error().Err(err).Msg("CopyAV error")
 			return err
 		}
+		if r.trimmed() {
+			log.Info().Dur("start", r.startOffset).Dur("length", r.length).Int("packets", pktCount).Msg("trimmed push finished")
+			return file.Close()
+		}
 		round++
 		log.Debug().Msgf("has read %d round", round)
 		err = file.Close()
@@ -171,6 +357,22 @@ func (r *RtmpOverTcpUpStreamer) publish(ctx context.Context, url string, resourc
 	}
 }
 
+// streamSeekStress 反复seek推送文件, 时间戳跳变需要原样发送, 不经过FixTime和Walltime
+func (r *RtmpOverTcpUpStreamer) streamSeekStress(ctx context.Context, t *av.Transport, m av.Muxer, flvFile string) error {
+	file, err := r.open(flvFile)
+	if err != nil {
+		log.Error().Err(err).Msg("open file error")
+		return err
+	}
+	defer file.Close()
+	opts := *r.seekStress
+	opts.Pace = !r.noPacing
+	demuxer := pktque.NewSeekStressDemuxer(file, opts)
+	err = t.CopyAV(ctx, m, demuxer)
+	log.Info().Int("seeks", demuxer.Seeks).Bool("reverse", opts.Reverse).Bool("monotonic", opts.Monotonic).Msg("seek stress push finished")
+	return err
+}
+
 func (r *RtmpOverTcpUpStreamer) Publish(ctx context.Context) error {
 	return r.publish(ctx, r.rtmpUrl, r.filename)
 }
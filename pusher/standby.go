@@ -0,0 +1,150 @@
+package pusher
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bugVanisher/streamer/media/protocol/rtmp"
+	"github.com/rs/zerolog/log"
+)
+
+// StandbyPool 预先建立N条rtmp连接(完成handshake、connect、createStream)并保持空闲,
+// 收到触发信号后所有连接同时publish, 用于把建连风暴和publish风暴分开压测
+type StandbyPool struct {
+	pusher *RtmpOverTcpUpStreamer
+	urls   []string
+	conns  []rtmp.Conn
+
+	ready    chan struct{}
+	trigger  chan struct{}
+	fireOnce sync.Once
+}
+
+// NewStandbyPool 创建一个大小为size的预热连接池
+func NewStandbyPool(rtmpUrl string, filename string, size int, option ...rtmp.Option) *StandbyPool {
+	return &StandbyPool{
+		pusher:  NewRtmpPusher(rtmpUrl, filename, option...),
+		urls:    StandbyURLs(rtmpUrl, size),
+		ready:   make(chan struct{}),
+		trigger: make(chan struct{}),
+	}
+}
+
+// StandbyURLs 为每条预热连接生成推流地址, 只有一条连接时直接使用原地址
+func StandbyURLs(rtmpUrl string, size int) []string {
+	urls := make([]string, 0, size)
+	for i := 0; i < size; i++ {
+		if size == 1 && !strings.Contains(rtmpUrl, "%d") {
+			urls = append(urls, rtmpUrl)
+			continue
+		}
+		urls = append(urls, IndexedURL(rtmpUrl, i))
+	}
+	return urls
+}
+
+// IndexedURL 生成第i路推流地址, url中包含%d时替换为序号, 否则在流名后追加"_序号".
+// 只替换%d, url中的%2F等转义保持不变
+func IndexedURL(rtmpUrl string, i int) string {
+	if strings.Contains(rtmpUrl, "%d") {
+		return strings.ReplaceAll(rtmpUrl, "%d", strconv.Itoa(i))
+	}
+	u, query := rtmpUrl, ""
+	if idx := strings.Index(rtmpUrl, "?"); idx >= 0 {
+		u, query = rtmpUrl[:idx], rtmpUrl[idx:]
+	}
+	return fmt.Sprintf("%s_%d%s", u, i, query)
+}
+
+// Ready 所有连接预热完成后关闭
+func (p *StandbyPool) Ready() <-chan struct{} {
+	return p.ready
+}
+
+// Fire 触发所有预热连接同时publish, 可重复调用
+func (p *StandbyPool) Fire() {
+	p.fireOnce.Do(func() {
+		close(p.trigger)
+	})
+}
+
+// prepare 并发建立所有预热连接, 失败的连接会被丢弃
+func (p *StandbyPool) prepare() {
+	conns := make([]rtmp.Conn, len(p.urls))
+	var wg sync.WaitGroup
+	for i, u := range p.urls {
+		wg.Add(1)
+		go func(i int, u string) {
+			defer wg.Done()
+			conn, err := p.pusher.dial(u)
+			if err != nil {
+				log.Error().Err(err).Str("url", u).Msg("standby conn prepare failed")
+				return
+			}
+			conns[i] = conn
+		}(i, u)
+	}
+	wg.Wait()
+	p.conns = conns
+}
+
+// Publish 实现Pusher接口, 预热全部连接后等待触发, 然后并发publish并推流
+func (p *StandbyPool) Publish(ctx context.Context) error {
+	start := time.Now()
+	p.prepare()
+	standby := 0
+	for _, conn := range p.conns {
+		if conn != nil {
+			standby++
+		}
+	}
+	log.Info().Int("standby", standby).Int("total", len(p.urls)).
+		Dur("cost", time.Since(start)).Msg("standby pool ready")
+	close(p.ready)
+
+	defer func() {
+		for _, conn := range p.conns {
+			if conn != nil {
+				conn.Close()
+			}
+		}
+	}()
+	if standby == 0 {
+		return fmt.Errorf("standby pool: no connection established")
+	}
+
+	select {
+	case <-p.trigger:
+	case <-ctx.Done():
+		return nil
+	}
+
+	var wg sync.WaitGroup
+	errCh := make(chan error, len(p.conns))
+	fireAt := time.Now()
+	for i, conn := range p.conns {
+		if conn == nil {
+			continue
+		}
+		wg.Add(1)
+		go func(u string, conn rtmp.Conn) {
+			defer wg.Done()
+			if err := conn.Publish(); err != nil {
+				log.Error().Err(err).Str("url", u).Msg("standby conn publish failed")
+				errCh <- err
+				return
+			}
+			log.Debug().Str("url", u).Dur("latency", time.Since(fireAt)).Msg("standby conn published")
+			if err := p.pusher.stream(ctx, conn, u, p.pusher.filename); err != nil && ctx.Err() == nil {
+				errCh <- err
+			}
+		}(p.urls[i], conn)
+	}
+	wg.Wait()
+	close(errCh)
+	return <-errCh
+}
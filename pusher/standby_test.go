@@ -0,0 +1,67 @@
+package pusher
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bugVanisher/streamer/media/protocol/rtmp"
+)
+
+func TestIndexedURL(t *testing.T) {
+	require.Equal(t, "rtmp://127.0.0.1/live/s_2", IndexedURL("rtmp://127.0.0.1/live/s", 2))
+	require.Equal(t, "rtmp://127.0.0.1/live/s_2?token=a%2Fb", IndexedURL("rtmp://127.0.0.1/live/s?token=a%2Fb", 2))
+	// %d之外的转义原样保留
+	require.Equal(t, "rtmp://127.0.0.1/live/s3?token=a%2Fb", IndexedURL("rtmp://127.0.0.1/live/s%d?token=a%2Fb", 3))
+	require.Equal(t, []string{"rtmp://127.0.0.1/live/s"}, StandbyURLs("rtmp://127.0.0.1/live/s", 1))
+	require.Equal(t, []string{"rtmp://127.0.0.1/live/s0", "rtmp://127.0.0.1/live/s1"},
+		StandbyURLs("rtmp://127.0.0.1/live/s%d", 2))
+}
+
+func TestStandbyPool(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	s := rtmp.NewServer("")
+	go s.Serve(l)
+	defer s.Close()
+
+	p := NewStandbyPool("rtmp://"+l.Addr().String()+"/live/standby?token=a%2Fb", writeTestFLV(t, 1000), 3)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		done <- p.Publish(ctx)
+	}()
+
+	// 预热完成后连接都已建立, 但还没有publish
+	select {
+	case <-p.Ready():
+	case <-time.After(5 * time.Second):
+		t.Fatal("standby pool not ready")
+	}
+	sessions := s.Sessions()
+	require.Len(t, sessions, 3)
+	for _, ss := range sessions {
+		require.False(t, ss.Publishing)
+	}
+
+	p.Fire()
+	p.Fire()
+	keys := map[string]bool{}
+	for i := 0; i < 200 && len(keys) < 3; i++ {
+		keys = map[string]bool{}
+		for _, ss := range s.Sessions() {
+			if ss.Publishing {
+				keys[ss.Key] = true
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	require.Equal(t, map[string]bool{"live/standby_0": true, "live/standby_1": true, "live/standby_2": true}, keys)
+
+	cancel()
+	require.Nil(t, <-done)
+}
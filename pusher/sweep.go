@@ -0,0 +1,129 @@
+package pusher
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/bugVanisher/streamer/downstream"
+	"github.com/bugVanisher/streamer/media/protocol/rtmp"
+	"github.com/bugVanisher/streamer/statistics"
+	"github.com/rs/zerolog/log"
+)
+
+// SweepParams 一组推流参数
+type SweepParams struct {
+	ChunkSize       int
+	ReadBufferSize  int
+	WriteBufferSize int
+	Pacing          bool
+}
+
+func (p SweepParams) String() string {
+	return fmt.Sprintf("chunk=%d rbuf=%d wbuf=%d pacing=%v", p.ChunkSize, p.ReadBufferSize, p.WriteBufferSize, p.Pacing)
+}
+
+// SweepResult 一组参数的运行结果
+type SweepResult struct {
+	Params         SweepParams
+	ConnectLatency time.Duration // 建连到publish成功的耗时
+	Throughput     float64       // 发送速率, kb/s
+	CPU            float64       // 进程cpu占用, 百分比
+	PullDelay      int64         // 拉流延迟, 毫秒, 未配置拉流地址时为0
+	Err            error
+}
+
+// SweepMatrix 生成参数矩阵的全部组合
+func SweepMatrix(chunkSizes, readBufferSizes, writeBufferSizes []int, pacing []bool) []SweepParams {
+	var matrix []SweepParams
+	for _, c := range chunkSizes {
+		for _, r := range readBufferSizes {
+			for _, w := range writeBufferSizes {
+				for _, p := range pacing {
+					matrix = append(matrix, SweepParams{ChunkSize: c, ReadBufferSize: r, WriteBufferSize: w, Pacing: p})
+				}
+			}
+		}
+	}
+	return matrix
+}
+
+// Sweep 依次用每组参数推流runFor时长, pullUrl不为空时同时拉流统计延迟
+func Sweep(ctx context.Context, rtmpUrl, filename, pullUrl string, runFor time.Duration, matrix []SweepParams) []SweepResult {
+	results := make([]SweepResult, 0, len(matrix))
+	for _, params := range matrix {
+		if ctx.Err() != nil {
+			break
+		}
+		log.Info().Str("params", params.String()).Msg("sweep run")
+		results = append(results, sweepOne(ctx, rtmpUrl, filename, pullUrl, runFor, params))
+	}
+	return results
+}
+
+// WriteSweepReport 以表格输出每组参数的结果
+func WriteSweepReport(out io.Writer, results []SweepResult) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "CHUNK\tRBUF\tWBUF\tPACING\tCONNECT\tKBPS\tCPU%\tDELAY(ms)\tERROR")
+	for _, r := range results {
+		errMsg := ""
+		if r.Err != nil {
+			errMsg = r.Err.Error()
+		}
+		fmt.Fprintf(w, "%d\t%d\t%d\t%v\t%s\t%.0f\t%.1f\t%d\t%s\n",
+			r.Params.ChunkSize, r.Params.ReadBufferSize, r.Params.WriteBufferSize, r.Params.Pacing,
+			r.ConnectLatency.Round(time.Millisecond), r.Throughput, r.CPU, r.PullDelay, errMsg)
+	}
+	return w.Flush()
+}
+
+func sweepOne(ctx context.Context, rtmpUrl, filename, pullUrl string, runFor time.Duration, params SweepParams) (result SweepResult) {
+	result.Params = params
+	r := NewRtmpPusher(rtmpUrl, filename,
+		rtmp.WithChunkSize(params.ChunkSize),
+		rtmp.WithReadBufferSize(params.ReadBufferSize),
+		rtmp.WithWriteBufferSize(params.WriteBufferSize))
+	r.SetPacing(params.Pacing)
+
+	ctx, cancel := context.WithTimeout(ctx, runFor)
+	defer cancel()
+
+	cpuBegin, _ := statistics.ProcessCPUTime()
+	start := time.Now()
+	conn, err := r.dial(rtmpUrl)
+	if err == nil {
+		defer conn.Close()
+		err = conn.Publish()
+	}
+	if err != nil {
+		result.Err = err
+		return
+	}
+	result.ConnectLatency = time.Since(start)
+
+	var puller *downstream.FlvDownStreamer
+	if pullUrl != "" {
+		puller = downstream.NewFlvDownStreamer(pullUrl, io.Discard)
+		go puller.Pull(ctx)
+	}
+
+	streamStart := time.Now()
+	if err = r.stream(ctx, conn, rtmpUrl, filename); err != nil && ctx.Err() == nil {
+		result.Err = err
+	}
+	elapsed := time.Since(streamStart).Seconds()
+	if elapsed > 0 {
+		result.Throughput = float64(conn.TxBytes()) * 8 / 1024 / elapsed
+	}
+	if cpuEnd, err := statistics.ProcessCPUTime(); err == nil && elapsed > 0 {
+		result.CPU = (cpuEnd - cpuBegin).Seconds() / time.Since(start).Seconds() * 100
+	}
+	if puller != nil {
+		if stat, ok := puller.LastStatistic(); ok {
+			result.PullDelay = stat.VideoDelay
+		}
+	}
+	return
+}
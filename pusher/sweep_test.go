@@ -0,0 +1,65 @@
+package pusher
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bugVanisher/streamer/media/protocol/rtmp"
+)
+
+func TestSweepMatrix(t *testing.T) {
+	matrix := SweepMatrix([]int{128, 4096}, []int{4096}, []int{1024, 8192}, []bool{true, false})
+	require.Len(t, matrix, 8)
+	// 最后一个维度变化最快
+	require.Equal(t, []SweepParams{
+		{ChunkSize: 128, ReadBufferSize: 4096, WriteBufferSize: 1024, Pacing: true},
+		{ChunkSize: 128, ReadBufferSize: 4096, WriteBufferSize: 1024, Pacing: false},
+		{ChunkSize: 128, ReadBufferSize: 4096, WriteBufferSize: 8192, Pacing: true},
+		{ChunkSize: 128, ReadBufferSize: 4096, WriteBufferSize: 8192, Pacing: false},
+	}, matrix[:4])
+	require.Equal(t, SweepParams{ChunkSize: 4096, ReadBufferSize: 4096, WriteBufferSize: 8192, Pacing: false}, matrix[7])
+	require.Equal(t, "chunk=128 rbuf=4096 wbuf=1024 pacing=true", matrix[0].String())
+
+	// 任一维度为空时没有组合
+	require.Empty(t, SweepMatrix([]int{128}, nil, []int{1024}, []bool{true}))
+}
+
+func TestWriteSweepReport(t *testing.T) {
+	var b bytes.Buffer
+	require.Nil(t, WriteSweepReport(&b, []SweepResult{
+		{Params: SweepParams{ChunkSize: 128, ReadBufferSize: 4096, WriteBufferSize: 1024, Pacing: true},
+			ConnectLatency: 12345 * time.Microsecond, Throughput: 1999.6, CPU: 12.34, PullDelay: 300},
+		{Params: SweepParams{ChunkSize: 60000, ReadBufferSize: 4096, WriteBufferSize: 1024},
+			Err: errors.New("connection refused")},
+	}))
+	require.Equal(t, ""+
+		"CHUNK  RBUF  WBUF  PACING  CONNECT  KBPS  CPU%  DELAY(ms)  ERROR\n"+
+		"128    4096  1024  true    12ms     2000  12.3  300        \n"+
+		"60000  4096  1024  false   0s       0     0.0   0          connection refused\n", b.String())
+}
+
+func TestSweep(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	s := rtmp.NewServer("")
+	go s.Serve(l)
+	defer s.Close()
+
+	matrix := SweepMatrix([]int{1000, 4096}, []int{4096}, []int{4096}, []bool{true})
+	results := Sweep(context.Background(), "rtmp://"+l.Addr().String()+"/live/sweep", writeTestFLV(t, 3000), "",
+		500*time.Millisecond, matrix)
+	require.Len(t, results, 2)
+	for i, r := range results {
+		require.Equal(t, matrix[i], r.Params)
+		require.Nil(t, r.Err)
+		require.True(t, r.ConnectLatency > 0 && r.ConnectLatency < time.Second, "connect %v", r.ConnectLatency)
+		require.True(t, r.Throughput > 0, "throughput %v", r.Throughput)
+		require.Equal(t, int64(0), r.PullDelay)
+	}
+}
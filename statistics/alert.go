@@ -0,0 +1,161 @@
+package statistics
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// AlertRule 告警规则, 指标值满足比较条件并持续For时长后触发
+type AlertRule struct {
+	Metric    string
+	Op        string
+	Threshold float64
+	For       time.Duration
+}
+
+func (r AlertRule) String() string {
+	return fmt.Sprintf("%s%s%g for %s", r.Metric, r.Op, r.Threshold, r.For)
+}
+
+var alertRuleRegexp = regexp.MustCompile(`^\s*([a-z_]+)\s*(<=|>=|<|>)\s*(-?[0-9.]+)\s*(?:for\s+(\S+))?\s*$`)
+
+// ParseAlertRule 解析告警规则, 格式如 "fps<20 for 10s", "delay>3000", 阈值可以为负数如 "drift<-500"
+func ParseAlertRule(s string) (AlertRule, error) {
+	var rule AlertRule
+	m := alertRuleRegexp.FindStringSubmatch(s)
+	if m == nil {
+		return rule, fmt.Errorf("invalid alert rule: %q", s)
+	}
+	if _, ok := alertMetrics[m[1]]; !ok {
+		return rule, fmt.Errorf("unknown alert metric: %q", m[1])
+	}
+	threshold, err := strconv.ParseFloat(m[3], 64)
+	if err != nil {
+		return rule, fmt.Errorf("invalid alert threshold: %q", m[3])
+	}
+	rule.Metric, rule.Op, rule.Threshold = m[1], m[2], threshold
+	if m[4] != "" {
+		if rule.For, err = time.ParseDuration(m[4]); err != nil {
+			return rule, fmt.Errorf("invalid alert duration: %q", m[4])
+		}
+	}
+	return rule, nil
+}
+
+// alertMetrics 可用于告警的指标
+var alertMetrics = map[string]func(sh *StreamHandler) float64{
+	"fps":       func(sh *StreamHandler) float64 { return float64(sh.VideoFPS) },
+	"audio_fps": func(sh *StreamHandler) float64 { return float64(sh.AudioFPS) },
+	"bitrate":   func(sh *StreamHandler) float64 { return float64(sh.VideoBitrate+sh.AudioBitrate) / 1024 }, // kb/s
+	"delay":     func(sh *StreamHandler) float64 { return float64(sh.VideoDelay) },                          // ms
+	"drift":     func(sh *StreamHandler) float64 { return float64(sh.VideoDurationDelay()) },                // ms
+	"gop":       func(sh *StreamHandler) float64 { return sh.VideoGop },                                     // s
+	"health":    func(sh *StreamHandler) float64 { return float64(sh.Health) },
+	"overhead":  func(sh *StreamHandler) float64 { return sh.Overhead },
+}
+
+func (r AlertRule) match(v float64) bool {
+	switch r.Op {
+	case "<":
+		return v < r.Threshold
+	case "<=":
+		return v <= r.Threshold
+	case ">":
+		return v > r.Threshold
+	case ">=":
+		return v >= r.Threshold
+	}
+	return false
+}
+
+// AlertEvent 告警事件, Firing为false表示告警恢复
+type AlertEvent struct {
+	Stream string    `json:"stream"`
+	Rule   string    `json:"rule"`
+	Metric string    `json:"metric"`
+	Value  float64   `json:"value"`
+	Firing bool      `json:"firing"`
+	Time   time.Time `json:"time"`
+}
+
+type alertState struct {
+	since  time.Time
+	firing bool
+}
+
+// Alerter 按规则检查每个统计周期的数据, 在告警触发和恢复时回调OnEvent
+type Alerter struct {
+	Stream  string
+	OnEvent func(e AlertEvent)
+
+	lock   sync.Mutex
+	rules  []AlertRule
+	states []alertState
+}
+
+// NewAlerter 创建Alerter实例
+func NewAlerter(stream string, rules []AlertRule, onEvent func(e AlertEvent)) *Alerter {
+	return &Alerter{
+		Stream:  stream,
+		OnEvent: onEvent,
+		rules:   rules,
+		states:  make([]alertState, len(rules)),
+	}
+}
+
+// Check 检查一个周期的统计数据
+func (a *Alerter) Check(sh *StreamHandler, now time.Time) {
+	a.lock.Lock()
+	var events []AlertEvent
+	for i, rule := range a.rules {
+		v := alertMetrics[rule.Metric](sh)
+		st := &a.states[i]
+		if !rule.match(v) {
+			if st.firing {
+				events = append(events, a.event(rule, v, false, now))
+			}
+			*st = alertState{}
+			continue
+		}
+		if st.since.IsZero() {
+			st.since = now
+		}
+		if !st.firing && now.Sub(st.since) >= rule.For {
+			st.firing = true
+			events = append(events, a.event(rule, v, true, now))
+		}
+	}
+	a.lock.Unlock()
+
+	if a.OnEvent != nil {
+		for _, e := range events {
+			a.OnEvent(e)
+		}
+	}
+}
+
+func (a *Alerter) event(rule AlertRule, v float64, firing bool, now time.Time) AlertEvent {
+	return AlertEvent{
+		Stream: a.Stream,
+		Rule:   rule.String(),
+		Metric: rule.Metric,
+		Value:  v,
+		Firing: firing,
+		Time:   now,
+	}
+}
+
+// Degraded 是否有告警正在触发
+func (a *Alerter) Degraded() bool {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	for _, st := range a.states {
+		if st.firing {
+			return true
+		}
+	}
+	return false
+}
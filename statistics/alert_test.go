@@ -0,0 +1,39 @@
+package statistics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseAlertRule(t *testing.T) {
+	for _, c := range []struct {
+		s    string
+		rule AlertRule
+	}{
+		{"fps<20 for 10s", AlertRule{Metric: "fps", Op: "<", Threshold: 20, For: 10 * time.Second}},
+		{" delay >= 3000 ", AlertRule{Metric: "delay", Op: ">=", Threshold: 3000}},
+		{"overhead>0.25", AlertRule{Metric: "overhead", Op: ">", Threshold: 0.25}},
+		// 负数阈值
+		{"drift < -500", AlertRule{Metric: "drift", Op: "<", Threshold: -500}},
+		{"drift<=-1.5 for 1m", AlertRule{Metric: "drift", Op: "<=", Threshold: -1.5, For: time.Minute}},
+	} {
+		rule, err := ParseAlertRule(c.s)
+		require.Nil(t, err, c.s)
+		require.Equal(t, c.rule, rule, c.s)
+	}
+
+	for _, s := range []string{
+		"fps",
+		"fps<",
+		"fps<--5",
+		"fps<5-",
+		"fps<1.2.3",
+		"unknown<1",
+		"fps<20 for soon",
+	} {
+		_, err := ParseAlertRule(s)
+		require.NotNil(t, err, s)
+	}
+}
@@ -0,0 +1,9 @@
+package statistics
+
+import "time"
+
+// ProcessCPUTime 当前进程累计使用的cpu时间(用户态+内核态).
+// 不读取/proc, 在Windows和没有挂载/proc的容器中同样可用
+func ProcessCPUTime() (time.Duration, error) {
+	return processCPUTime()
+}
@@ -0,0 +1,12 @@
+//go:build !aix && !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris && !windows
+
+package statistics
+
+import (
+	"errors"
+	"time"
+)
+
+func processCPUTime() (time.Duration, error) {
+	return 0, errors.New("process cpu time not supported on this platform")
+}
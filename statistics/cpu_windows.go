@@ -0,0 +1,25 @@
+//go:build windows
+
+package statistics
+
+import (
+	"syscall"
+	"time"
+)
+
+func processCPUTime() (time.Duration, error) {
+	var creation, exit, kernel, user syscall.Filetime
+	h, err := syscall.GetCurrentProcess()
+	if err != nil {
+		return 0, err
+	}
+	if err = syscall.GetProcessTimes(h, &creation, &exit, &kernel, &user); err != nil {
+		return 0, err
+	}
+	// Filetime是以100ns为单位的时长
+	return time.Duration((filetimeTicks(kernel) + filetimeTicks(user)) * 100), nil
+}
+
+func filetimeTicks(ft syscall.Filetime) int64 {
+	return int64(ft.HighDateTime)<<32 | int64(ft.LowDateTime)
+}
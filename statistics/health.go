@@ -0,0 +1,112 @@
+package statistics
+
+import (
+	"math"
+	"sync"
+)
+
+const (
+	DefaultHealthWindow = 20 // 参与健康评分的统计周期数
+
+	healthFPSWeight     = 25
+	healthBitrateWeight = 20
+	healthStallWeight   = 25
+	healthDriftWeight   = 15
+	healthDelayWeight   = 15
+)
+
+// Health 综合帧率稳定性、码率波动、卡顿次数、时长漂移和延迟计算0-100的健康分
+type Health struct {
+	lock    sync.Mutex
+	window  int
+	samples []StreamHandler
+}
+
+// NewHealth 创建Health实例, window为参与评分的最近统计周期数
+func NewHealth(window int) *Health {
+	if window <= 0 {
+		window = DefaultHealthWindow
+	}
+	return &Health{window: window}
+}
+
+// Add 添加一个周期的统计数据
+func (h *Health) Add(sh StreamHandler) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.samples = append(h.samples, sh)
+	if len(h.samples) > h.window {
+		h.samples = h.samples[len(h.samples)-h.window:]
+	}
+}
+
+// Stalls 窗口内视频帧率为0的周期数
+func (h *Health) Stalls() int {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	return h.stalls()
+}
+
+func (h *Health) stalls() int {
+	n := 0
+	for _, s := range h.samples {
+		if s.VideoFPS == 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// Score 计算健康分, 没有统计数据时返回100
+func (h *Health) Score() int {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if len(h.samples) == 0 {
+		return 100
+	}
+
+	fps := make([]float64, 0, len(h.samples))
+	bitrate := make([]float64, 0, len(h.samples))
+	var drift, delay float64
+	for _, s := range h.samples {
+		fps = append(fps, float64(s.VideoFPS))
+		bitrate = append(bitrate, float64(s.VideoBitrate+s.AudioBitrate))
+		drift += math.Abs(float64(s.VideoDurationDelay()))
+		delay += math.Abs(float64(s.VideoDelay))
+	}
+	drift /= float64(len(h.samples))
+	delay /= float64(len(h.samples))
+
+	penalty := math.Min(healthFPSWeight, coefficientOfVariation(fps)*100)
+	penalty += math.Min(healthBitrateWeight, coefficientOfVariation(bitrate)*50)
+	penalty += math.Min(healthStallWeight, float64(h.stalls()*10))
+	penalty += math.Min(healthDriftWeight, drift/100) // 每100ms漂移扣1分
+	penalty += math.Min(healthDelayWeight, delay/200) // 每200ms延迟扣1分
+
+	score := 100 - int(math.Round(penalty))
+	if score < 0 {
+		score = 0
+	}
+	return score
+}
+
+// coefficientOfVariation 变异系数, 标准差/均值
+func coefficientOfVariation(values []float64) float64 {
+	if len(values) < 2 {
+		return 0
+	}
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	mean := sum / float64(len(values))
+	if mean == 0 {
+		return 0
+	}
+	var variance float64
+	for _, v := range values {
+		variance += (v - mean) * (v - mean)
+	}
+	variance /= float64(len(values))
+	return math.Sqrt(variance) / mean
+}
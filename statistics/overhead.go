@@ -0,0 +1,63 @@
+package statistics
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// Overhead 协议开销统计, 对比网络字节数和媒体负载字节数
+type Overhead struct {
+	Proto string
+
+	wire  uint64
+	media uint64
+
+	lastWire  uint64
+	lastMedia uint64
+	percent   float64
+}
+
+// NewOverhead 创建Overhead实例, proto为协议名称
+func NewOverhead(proto string) *Overhead {
+	return &Overhead{Proto: proto}
+}
+
+// AddWire 累加网络字节数
+func (o *Overhead) AddWire(size uint64) {
+	atomic.AddUint64(&o.wire, size)
+}
+
+// SetWire 设置网络字节总数, 用于底层连接已经自行计数的场景
+func (o *Overhead) SetWire(total uint64) {
+	atomic.StoreUint64(&o.wire, total)
+}
+
+// AddMedia 累加媒体负载字节数
+func (o *Overhead) AddMedia(size uint64) {
+	atomic.AddUint64(&o.media, size)
+}
+
+// WireBytes 网络字节总数
+func (o *Overhead) WireBytes() uint64 {
+	return atomic.LoadUint64(&o.wire)
+}
+
+// MediaBytes 媒体负载字节总数
+func (o *Overhead) MediaBytes() uint64 {
+	return atomic.LoadUint64(&o.media)
+}
+
+// GetOverhead 返回距上次调用期间的协议开销百分比, 每个统计周期只应由统计逻辑调用一次
+func (o *Overhead) GetOverhead() float64 {
+	wire, media := o.WireBytes(), o.MediaBytes()
+	dw, dm := wire-o.lastWire, media-o.lastMedia
+	o.lastWire, o.lastMedia = wire, media
+	if dw > 0 && dw >= dm {
+		o.percent = float64(dw-dm) * 100 / float64(dw)
+	}
+	return o.percent
+}
+
+func (o *Overhead) String() string {
+	return fmt.Sprintf("%s %.2f%%", o.Proto, o.percent)
+}
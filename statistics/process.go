@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strconv"
 )
 
@@ -80,10 +81,10 @@ func (s ProcStat) ResidentMemory() uint64 {
 	return s.RSS * uint64(os.Getpagesize())
 }
 
-// CurrentProcStat 当前进程的stat数据
+// CurrentProcStat 当前进程的stat数据, 仅Linux可用, 只需要cpu时间时使用ProcessCPUTime
 func CurrentProcStat() (ProcStat, error) {
 	pid := os.Getpid()
-	statfile := "/proc/" + strconv.Itoa(pid) + "/stat"
+	statfile := filepath.Join("/proc", strconv.Itoa(pid), "stat")
 	return NewProcStat(statfile, pid)
 }
 
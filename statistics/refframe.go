@@ -0,0 +1,72 @@
+package statistics
+
+import (
+	"github.com/bugVanisher/streamer/media/av"
+	"github.com/bugVanisher/streamer/media/codec/h264parser"
+)
+
+// RefFrame H.264参考帧丢失(frame_num跳变)和POC重排序统计, 只统计H.264视频
+type RefFrame struct {
+	order *h264parser.PictureOrder
+	pps   h264parser.PPSInfo
+
+	// 重置之前累计的值, header变化时PictureOrder重新创建
+	lost    uint64
+	reorder uint64
+}
+
+// NewRefFrame ...
+func NewRefFrame() *RefFrame {
+	return &RefFrame{}
+}
+
+// SetCodecData 收到header时按视频的SPS/PPS重新开始检测, 视频不是H.264时停止统计
+func (r *RefFrame) SetCodecData(streams []av.CodecData) {
+	if r.order != nil {
+		r.lost += r.order.LostRefFrames
+		r.reorder += r.order.ReorderErrors
+	}
+	r.order = nil
+	for _, stream := range streams {
+		if codec, ok := stream.(h264parser.CodecData); ok {
+			r.order = &h264parser.PictureOrder{SPS: codec.SPSInfo}
+			r.pps = codec.PPSInfo
+			return
+		}
+	}
+}
+
+// Add 解析每帧第一个slice的header
+func (r *RefFrame) Add(pkt *av.Packet) {
+	if r.order == nil || !pkt.IsVideoNalu() {
+		return
+	}
+	nalus, _ := h264parser.SplitNALUs(pkt.Data)
+	for _, nalu := range nalus {
+		if len(nalu) == 0 || !h264parser.IsDataNALU(nalu) {
+			continue
+		}
+		h, err := h264parser.ParseSliceHeader(nalu, r.order.SPS, r.pps)
+		if err != nil || h.FirstMbInSlice != 0 {
+			return
+		}
+		r.order.Add(h, pkt.Time.Duration()+pkt.CompositionTime)
+		return
+	}
+}
+
+// GetLost 估计丢失的参考帧数
+func (r *RefFrame) GetLost() uint64 {
+	if r.order == nil {
+		return r.lost
+	}
+	return r.lost + r.order.LostRefFrames
+}
+
+// GetReorderErrors POC顺序和显示时间戳顺序相反的次数
+func (r *RefFrame) GetReorderErrors() uint64 {
+	if r.order == nil {
+		return r.reorder
+	}
+	return r.reorder + r.order.ReorderErrors
+}
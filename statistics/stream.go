@@ -2,7 +2,6 @@ package statistics
 
 import (
 	"github.com/bugVanisher/streamer/media/av"
-	"github.com/bugVanisher/streamer/media/container/flv/flvio"
 	"time"
 )
 
@@ -18,6 +17,8 @@ type AVFlow struct {
 	VideoDelay    *Delay
 	VideoDuration *Duration
 	AudioDuration *Duration
+	VideoRefFrame *RefFrame
+	VideoVBV      *VBV
 }
 
 // NewAVFlow 创建AVFlow实例
@@ -31,18 +32,28 @@ func NewAVFlow() *AVFlow {
 		VideoDelay:    NewDelay(),
 		VideoDuration: NewDuration(),
 		AudioDuration: NewDuration(),
+		VideoRefFrame: NewRefFrame(),
+		VideoVBV:      NewVBV(),
 	}
 }
 
+// SetCodecData 收到header时更新依赖编码参数的统计
+func (s *AVFlow) SetCodecData(streams []av.CodecData) {
+	s.VideoRefFrame.SetCodecData(streams)
+	s.VideoVBV.SetCodecData(streams)
+}
+
 // Stat 统计av.Packet的音视频数据
 func (s *AVFlow) Stat(pkt *av.Packet) {
-	if pkt.DataType == flvio.TAG_VIDEO {
+	if pkt.IsVideo() {
 		s.VideoBitrate.Add(uint64(len(pkt.Data) * 8)) //bit
 		s.VideoFPS.Add()
 		s.VideoGop.Add(pkt)
 		s.VideoDelay.Add(int64(pkt.Time))
 		s.VideoDuration.Add(int64(pkt.Time))
-	} else if pkt.DataType == flvio.TAG_AUDIO {
+		s.VideoRefFrame.Add(pkt)
+		s.VideoVBV.Add(pkt)
+	} else if pkt.IsAudio() {
 		s.AudioFPS.Add()
 		s.AudioBitrate.Add(uint64(len(pkt.Data) * 8)) //bit
 		s.AudioDuration.Add(int64(pkt.Time))
@@ -73,6 +84,22 @@ type StreamHandler struct {
 	AudioDuration int64
 	AudioBitrate  uint64
 	VideoDelay    int64
+	Proto         string
+	WireBytes     uint64
+	MediaBytes    uint64
+	Overhead      float64 // 协议开销百分比
+	Health        int     // 健康分, 0-100
+	LostRefFrames uint64  // 根据frame_num跳变估计的丢失参考帧数
+	ReorderErrors uint64  // POC顺序和显示时间戳顺序相反的次数
+	// DeclaredBitrate SPS HRD参数中编码器声明的最大码率, bit/s
+	DeclaredBitrate uint64
+	VBVViolations   uint64 // 按声明码率和CPB大小模拟的缓冲下溢次数
+	// 拉流时切HLS切片的统计, 没有开启切片时为0
+	Segments          int     // 已切出的切片数
+	SegmentViolations int     // 时长超出target±tolerance的切片数
+	UnalignedSegments int     // 不以关键帧开始的切片数
+	SegmentOverhead   float64 // 切片的TS封装开销百分比, 包括TS/PES头和填充
+	SegmentLatencyP95 int64   // 切片生成耗时p95, 毫秒
 }
 
 // VideoDurationDelay 视频时长与现实时间的diff，毫秒
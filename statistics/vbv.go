@@ -0,0 +1,68 @@
+package statistics
+
+import (
+	"github.com/bugVanisher/streamer/media/av"
+	"github.com/bugVanisher/streamer/media/codec/h264parser"
+)
+
+// VBV 按SPS HRD参数中编码器声明的最大码率和CPB大小模拟漏桶, 统计缓冲下溢(VBV违规)次数.
+// 缓冲按声明码率持续注入, 每帧取走帧大小, 某帧到达时缓冲中的数据不够即为违规.
+// 只统计H.264视频, SPS没有HRD参数时不统计
+type VBV struct {
+	bitrate  uint64 // 声明的最大码率, bit/s
+	cpbSize  uint64 // 声明的CPB大小, bit
+	fullness float64
+	lastDts  av.MediaTime
+	started  bool
+
+	violations uint64
+}
+
+// NewVBV ...
+func NewVBV() *VBV {
+	return &VBV{}
+}
+
+// SetCodecData 收到header时按视频SPS的HRD参数重新开始模拟
+func (v *VBV) SetCodecData(streams []av.CodecData) {
+	v.bitrate, v.cpbSize, v.started = 0, 0, false
+	for _, stream := range streams {
+		if codec, ok := stream.(h264parser.CodecData); ok {
+			v.bitrate, v.cpbSize = codec.SPSInfo.MaxBitRate(), codec.SPSInfo.CpbSize()
+			return
+		}
+	}
+}
+
+// Add 每个视频帧取走帧大小的数据
+func (v *VBV) Add(pkt *av.Packet) {
+	if v.bitrate == 0 || v.cpbSize == 0 || !pkt.IsVideoNalu() {
+		return
+	}
+	if !v.started {
+		// 从满缓冲开始, 只统计持续超过声明码率的情况
+		v.started, v.fullness, v.lastDts = true, float64(v.cpbSize), pkt.Time
+	}
+	if pkt.Time > v.lastDts {
+		v.fullness += (pkt.Time - v.lastDts).Duration().Seconds() * float64(v.bitrate)
+		v.lastDts = pkt.Time
+	}
+	if v.fullness > float64(v.cpbSize) {
+		v.fullness = float64(v.cpbSize)
+	}
+	v.fullness -= float64(len(pkt.Data) * 8)
+	if v.fullness < 0 {
+		v.violations++
+		v.fullness = 0
+	}
+}
+
+// GetDeclaredBitrate 编码器声明的最大码率, bit/s
+func (v *VBV) GetDeclaredBitrate() uint64 {
+	return v.bitrate
+}
+
+// GetViolations VBV缓冲下溢的次数
+func (v *VBV) GetViolations() uint64 {
+	return v.violations
+}
@@ -0,0 +1,235 @@
+// Package adaptive 按观测到的吞吐量自动增大读缓冲的带缓冲reader, 高码率时减少read系统调用次数
+package adaptive
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// DefaultMinSize 默认的初始缓冲大小
+	DefaultMinSize = 4 * 1024
+	// DefaultMaxSize 默认的缓冲大小上限
+	DefaultMaxSize = 256 * 1024
+	// window 计算吞吐量的统计窗口
+	window = time.Second
+	// targetLatency 缓冲大小按该时长内到达的数据量计算
+	targetLatency = 20 * time.Millisecond
+)
+
+// now 当前时间, 测试时替换
+var now = time.Now
+
+var errNegativeRead = errors.New("adaptive: reader returned negative count from Read")
+
+// Stats 缓冲大小的统计, 可以在其它goroutine读取
+type Stats struct {
+	Size       int   `json:"size"`       // 当前的缓冲大小
+	Grows      int   `json:"grows"`      // 扩大缓冲的次数
+	Throughput int64 `json:"throughput"` // 最近一个统计窗口的吞吐量, 字节/秒
+}
+
+// Reader 带缓冲的reader, 用法和bufio.Reader相同(Read, Peek, Discard, Buffered, Reset).
+// 每个统计窗口结束时按吞吐量计算targetLatency内到达的数据量, 大于当前缓冲时按2的幂扩大, 最大到max, 不缩小
+type Reader struct {
+	rd   io.Reader
+	buf  []byte
+	r, w int
+	err  error
+	max  int
+
+	windowStart time.Time
+	windowBytes int64
+
+	size       int64
+	grows      int64
+	throughput int64
+}
+
+// NewReader 创建初始缓冲为size, 最大为max的reader, max不大于size时缓冲大小固定
+func NewReader(rd io.Reader, size, max int) *Reader {
+	if size <= 0 {
+		size = DefaultMinSize
+	}
+	b := &Reader{buf: make([]byte, size), max: max, size: int64(size)}
+	b.Reset(rd)
+	return b
+}
+
+// Reset 丢弃缓冲的数据, 之后从rd读取, 保留当前的缓冲大小
+func (self *Reader) Reset(rd io.Reader) {
+	self.rd = rd
+	self.r, self.w = 0, 0
+	self.err = nil
+	self.windowStart, self.windowBytes = time.Time{}, 0
+}
+
+// Size 当前的缓冲大小
+func (self *Reader) Size() int {
+	return int(atomic.LoadInt64(&self.size))
+}
+
+// Stats 当前的缓冲统计
+func (self *Reader) Stats() Stats {
+	return Stats{
+		Size:       self.Size(),
+		Grows:      int(atomic.LoadInt64(&self.grows)),
+		Throughput: atomic.LoadInt64(&self.throughput),
+	}
+}
+
+// Buffered 缓冲中可以读取的字节数
+func (self *Reader) Buffered() int {
+	return self.w - self.r
+}
+
+func (self *Reader) readErr() error {
+	err := self.err
+	self.err = nil
+	return err
+}
+
+// account 统计读取的字节数, 窗口结束时按吞吐量调整缓冲大小
+func (self *Reader) account(n int) {
+	now := now()
+	if self.windowStart.IsZero() {
+		self.windowStart = now
+	}
+	self.windowBytes += int64(n)
+	elapsed := now.Sub(self.windowStart)
+	if elapsed < window {
+		return
+	}
+	throughput := self.windowBytes * int64(time.Second) / int64(elapsed)
+	atomic.StoreInt64(&self.throughput, throughput)
+	self.windowStart, self.windowBytes = now, 0
+
+	target := len(self.buf)
+	for int64(target)*int64(time.Second) < throughput*int64(targetLatency) && target < self.max {
+		target *= 2
+	}
+	if target > self.max {
+		target = self.max
+	}
+	if target > len(self.buf) {
+		self.grow(target)
+	}
+}
+
+// grow 换成size大小的缓冲, 保留已缓冲的数据
+func (self *Reader) grow(size int) {
+	buf := make([]byte, size)
+	self.w = copy(buf, self.buf[self.r:self.w])
+	self.r = 0
+	self.buf = buf
+	atomic.StoreInt64(&self.size, int64(size))
+	atomic.AddInt64(&self.grows, 1)
+}
+
+// fill 读取一次数据到缓冲
+func (self *Reader) fill() {
+	if self.r > 0 {
+		copy(self.buf, self.buf[self.r:self.w])
+		self.w -= self.r
+		self.r = 0
+	}
+	// 和bufio一样, 连续读到0字节时返回io.ErrNoProgress
+	for i := 100; i > 0; i-- {
+		n, err := self.rd.Read(self.buf[self.w:])
+		if n < 0 {
+			panic(errNegativeRead)
+		}
+		self.w += n
+		if err != nil {
+			self.err = err
+			return
+		}
+		if n > 0 {
+			self.account(n)
+			return
+		}
+	}
+	self.err = io.ErrNoProgress
+}
+
+// Read 读取数据到p, 缓冲为空且p不小于缓冲时直接读入p
+func (self *Reader) Read(p []byte) (n int, err error) {
+	if len(p) == 0 {
+		if self.Buffered() > 0 {
+			return 0, nil
+		}
+		return 0, self.readErr()
+	}
+	if self.r == self.w {
+		if self.err != nil {
+			return 0, self.readErr()
+		}
+		if len(p) >= len(self.buf) {
+			n, self.err = self.rd.Read(p)
+			if n < 0 {
+				panic(errNegativeRead)
+			}
+			if n > 0 {
+				self.account(n)
+			}
+			return n, self.readErr()
+		}
+		self.fill()
+		if self.r == self.w {
+			return 0, self.readErr()
+		}
+	}
+	n = copy(p, self.buf[self.r:self.w])
+	self.r += n
+	return n, nil
+}
+
+// Peek 返回之后的n个字节而不消费, n大于缓冲大小时返回bufio.ErrBufferFull
+func (self *Reader) Peek(n int) ([]byte, error) {
+	if n < 0 {
+		return nil, bufio.ErrNegativeCount
+	}
+	for self.w-self.r < n && self.w-self.r < len(self.buf) && self.err == nil {
+		self.fill()
+	}
+	if n > len(self.buf) {
+		return self.buf[self.r:self.w], bufio.ErrBufferFull
+	}
+	var err error
+	if avail := self.w - self.r; avail < n {
+		n = avail
+		if err = self.readErr(); err == nil {
+			err = bufio.ErrBufferFull
+		}
+	}
+	return self.buf[self.r : self.r+n], err
+}
+
+// Discard 跳过之后的n个字节
+func (self *Reader) Discard(n int) (discarded int, err error) {
+	if n < 0 {
+		return 0, bufio.ErrNegativeCount
+	}
+	remain := n
+	for {
+		skip := self.Buffered()
+		if skip == 0 {
+			self.fill()
+			skip = self.Buffered()
+		}
+		if skip > remain {
+			skip = remain
+		}
+		self.r += skip
+		remain -= skip
+		if remain == 0 {
+			return n, nil
+		}
+		if self.err != nil {
+			return n - remain, self.readErr()
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package adaptive
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// clockReader 每次Read把测试时钟推进step
+type clockReader struct {
+	r     io.Reader
+	clock *time.Time
+	step  time.Duration
+	reads int
+}
+
+func (self *clockReader) Read(p []byte) (int, error) {
+	self.reads++
+	*self.clock = self.clock.Add(self.step)
+	return self.r.Read(p)
+}
+
+func withClock(t *testing.T) *time.Time {
+	clock := time.Unix(1000, 0)
+	now = func() time.Time { return clock }
+	t.Cleanup(func() { now = time.Now })
+	return &clock
+}
+
+func TestReaderGrow(t *testing.T) {
+	clock := withClock(t)
+	data := make([]byte, 8<<20)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	// 每4KB一次读取耗时1.6ms, 约20Mbps
+	src := &clockReader{r: bytes.NewReader(data), clock: clock, step: 1600 * time.Microsecond}
+	br := NewReader(src, 4*1024, 64*1024)
+
+	out := bytes.NewBuffer(nil)
+	b := make([]byte, 188)
+	for {
+		n, err := br.Read(b)
+		out.Write(b[:n])
+		if err == io.EOF {
+			break
+		}
+		assert.Nil(t, err)
+	}
+	assert.Equal(t, data, out.Bytes())
+
+	st := br.Stats()
+	assert.Equal(t, 64*1024, st.Size)
+	assert.True(t, st.Grows > 0)
+	assert.True(t, st.Throughput > 2<<20)
+	assert.True(t, src.reads < len(data)/(4*1024)/2)
+}
+
+func TestReaderFixed(t *testing.T) {
+	clock := withClock(t)
+	src := &clockReader{r: bytes.NewReader(make([]byte, 1<<20)), clock: clock, step: time.Millisecond}
+	br := NewReader(src, 4*1024, 0)
+	_, err := io.Copy(io.Discard, br)
+	assert.Nil(t, err)
+	assert.Equal(t, 4*1024, br.Size())
+	assert.Equal(t, 0, br.Stats().Grows)
+}
+
+func TestReaderPeekDiscard(t *testing.T) {
+	br := NewReader(bytes.NewReader([]byte("0123456789")), 4, 4)
+	b, err := br.Peek(3)
+	assert.Nil(t, err)
+	assert.Equal(t, "012", string(b))
+	_, err = br.Peek(5)
+	assert.Equal(t, bufio.ErrBufferFull, err)
+
+	n, err := br.Discard(6)
+	assert.Nil(t, err)
+	assert.Equal(t, 6, n)
+	rest, err := io.ReadAll(br)
+	assert.Nil(t, err)
+	assert.Equal(t, "6789", string(rest))
+
+	br.Reset(bytes.NewReader([]byte("ab")))
+	assert.Equal(t, 0, br.Buffered())
+	n, err = br.Discard(3)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, io.EOF, err)
+}
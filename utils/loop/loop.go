@@ -0,0 +1,188 @@
+// Package loop 在一个goroutine中执行大量会话的周期任务(统计回调、保活ping等),
+// 代替每个会话各自的ticker goroutine. 上万路连接的压测中每个会话可以少用2~3个goroutine,
+// 见media/protocol/rtmp的BenchmarkConnGoroutines
+package loop
+
+import (
+	"container/heap"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Loop 按到期时间依次执行任务的事件循环. 所有任务在同一个goroutine中执行, 任务不能阻塞,
+// 否则会推迟其它任务
+type Loop struct {
+	lock   sync.Mutex
+	tasks  taskHeap
+	wake   chan struct{}
+	done   chan struct{}
+	closed sync.Once
+}
+
+// Task Every或After注册的任务
+type Task struct {
+	fn       func()
+	interval time.Duration // 0为只执行一次
+	next     time.Time
+	index    int   // 在堆中的下标, -1为不在堆中
+	stopped  int32 // 原子操作
+	loop     *Loop
+}
+
+var (
+	defaultLoop *Loop
+	defaultOnce sync.Once
+)
+
+// Default 进程共享的Loop, 第一次调用时创建
+func Default() *Loop {
+	defaultOnce.Do(func() { defaultLoop = New() })
+	return defaultLoop
+}
+
+// New 创建Loop并启动它的goroutine
+func New() *Loop {
+	l := &Loop{wake: make(chan struct{}, 1), done: make(chan struct{})}
+	go l.run()
+	return l
+}
+
+// Every 每隔interval执行一次fn, 第一次在interval之后, 直到Stop
+func (l *Loop) Every(interval time.Duration, fn func()) *Task {
+	return l.schedule(&Task{fn: fn, interval: interval, next: time.Now().Add(interval)})
+}
+
+// After 在d之后执行一次fn
+func (l *Loop) After(d time.Duration, fn func()) *Task {
+	return l.schedule(&Task{fn: fn, next: time.Now().Add(d)})
+}
+
+func (l *Loop) schedule(t *Task) *Task {
+	t.loop = l
+	l.lock.Lock()
+	heap.Push(&l.tasks, t)
+	first := t.index == 0
+	l.lock.Unlock()
+	if first {
+		l.notify()
+	}
+	return t
+}
+
+func (l *Loop) notify() {
+	select {
+	case l.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Len 等待执行的任务数
+func (l *Loop) Len() int {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return len(l.tasks)
+}
+
+// Close 停止Loop, 之后不再执行任何任务
+func (l *Loop) Close() {
+	l.closed.Do(func() { close(l.done) })
+}
+
+// Stop 取消任务, 可以在任务中调用. 正在执行的那一次不受影响
+func (t *Task) Stop() {
+	if !atomic.CompareAndSwapInt32(&t.stopped, 0, 1) {
+		return
+	}
+	l := t.loop
+	l.lock.Lock()
+	if t.index >= 0 {
+		heap.Remove(&l.tasks, t.index)
+	}
+	l.lock.Unlock()
+}
+
+// due 取出到期的任务, 周期任务按interval放回堆中, 返回下一个任务的等待时间
+func (l *Loop) due(now time.Time) (tasks []*Task, wait time.Duration) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	for len(l.tasks) > 0 && !l.tasks[0].next.After(now) {
+		t := l.tasks[0]
+		tasks = append(tasks, t)
+		if t.interval <= 0 {
+			heap.Pop(&l.tasks)
+			continue
+		}
+		// 落后超过一个周期时不补执行
+		if t.next = t.next.Add(t.interval); t.next.Before(now) {
+			t.next = now.Add(t.interval)
+		}
+		heap.Fix(&l.tasks, 0)
+	}
+	wait = -1
+	if len(l.tasks) > 0 {
+		wait = l.tasks[0].next.Sub(now)
+	}
+	return
+}
+
+func (l *Loop) run() {
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+	for {
+		select {
+		case <-l.done:
+			return
+		default:
+		}
+		tasks, wait := l.due(time.Now())
+		for _, t := range tasks {
+			if atomic.LoadInt32(&t.stopped) == 0 {
+				t.fn()
+			}
+		}
+		if len(tasks) > 0 {
+			continue
+		}
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		if wait >= 0 {
+			timer.Reset(wait)
+		}
+		select {
+		case <-timer.C:
+		case <-l.wake:
+		case <-l.done:
+			return
+		}
+	}
+}
+
+// taskHeap 按next排序的最小堆
+type taskHeap []*Task
+
+func (h taskHeap) Len() int           { return len(h) }
+func (h taskHeap) Less(i, j int) bool { return h[i].next.Before(h[j].next) }
+func (h taskHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index, h[j].index = i, j
+}
+
+func (h *taskHeap) Push(x interface{}) {
+	t := x.(*Task)
+	t.index = len(*h)
+	*h = append(*h, t)
+}
+
+func (h *taskHeap) Pop() interface{} {
+	old := *h
+	t := old[len(old)-1]
+	old[len(old)-1] = nil
+	t.index = -1
+	*h = old[:len(old)-1]
+	return t
+}
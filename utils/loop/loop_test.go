@@ -0,0 +1,55 @@
+package loop
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoopEvery(t *testing.T) {
+	l := New()
+	defer l.Close()
+
+	var fast, slow int32
+	tf := l.Every(5*time.Millisecond, func() { atomic.AddInt32(&fast, 1) })
+	l.Every(time.Hour, func() { atomic.AddInt32(&slow, 1) })
+	time.Sleep(60 * time.Millisecond)
+	tf.Stop()
+	n := atomic.LoadInt32(&fast)
+	assert.True(t, n >= 5, "fast task ran %d times", n)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&slow))
+	assert.Equal(t, 1, l.Len())
+
+	// Stop之后不再执行
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, n, atomic.LoadInt32(&fast))
+	tf.Stop()
+}
+
+func TestLoopAfter(t *testing.T) {
+	l := New()
+	defer l.Close()
+
+	done := make(chan time.Time, 2)
+	start := time.Now()
+	l.After(20*time.Millisecond, func() { done <- time.Now() })
+	l.After(0, func() { done <- time.Now() })
+	assert.True(t, (<-done).Sub(start) < 20*time.Millisecond)
+	assert.True(t, (<-done).Sub(start) >= 20*time.Millisecond)
+	assert.Equal(t, 0, l.Len())
+
+	// 任务中可以取消自己
+	var task *Task
+	var runs int32
+	ready := make(chan struct{})
+	task = l.Every(time.Millisecond, func() {
+		<-ready
+		atomic.AddInt32(&runs, 1)
+		task.Stop()
+	})
+	close(ready)
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&runs))
+}
@@ -0,0 +1,96 @@
+// Package ring 以单调递增的位置寻址的环形缓冲, 容量按2的幂自动增长.
+// 位置在溢出回绕后仍可比较, 读者持有的位置在[Head, Tail)之内时有效
+package ring
+
+// initialCap 初始容量, 必须是2的幂
+const initialCap = 64
+
+// Pos 元素在缓冲中的位置, 只增不减, 比较时按差值的符号处理回绕
+type Pos int
+
+func (self Pos) LT(pos Pos) bool {
+	return self-pos < 0
+}
+
+func (self Pos) LE(pos Pos) bool {
+	return self-pos <= 0
+}
+
+func (self Pos) GE(pos Pos) bool {
+	return self-pos >= 0
+}
+
+func (self Pos) GT(pos Pos) bool {
+	return self-pos > 0
+}
+
+// Buf 环形缓冲. Size为所有元素sizeOf之和, 如packet的数据字节数
+type Buf[T any] struct {
+	Head, Tail Pos
+	items      []T
+	Size       int
+	Count      int
+
+	sizeOf func(T) int
+}
+
+// New 创建环形缓冲, sizeOf为nil时Size始终为0
+func New[T any](sizeOf func(T) int) *Buf[T] {
+	return &Buf[T]{
+		items:  make([]T, initialCap),
+		sizeOf: sizeOf,
+	}
+}
+
+func (self *Buf[T]) size(v T) int {
+	if self.sizeOf == nil {
+		return 0
+	}
+	return self.sizeOf(v)
+}
+
+// Pop 取出Head位置的元素, 缓冲为空时panic
+func (self *Buf[T]) Pop() T {
+	if self.Count == 0 {
+		panic("ring.Buf: Pop() when count == 0")
+	}
+
+	var zero T
+	i := int(self.Head) & (len(self.items) - 1)
+	v := self.items[i]
+	self.items[i] = zero
+	self.Size -= self.size(v)
+	self.Head++
+	self.Count--
+
+	return v
+}
+
+func (self *Buf[T]) grow() {
+	items := make([]T, len(self.items)*2)
+	for i := self.Head; i.LT(self.Tail); i++ {
+		items[int(i)&(len(items)-1)] = self.items[int(i)&(len(self.items)-1)]
+	}
+	self.items = items
+}
+
+// Push 在Tail位置追加元素, 满时容量翻倍
+func (self *Buf[T]) Push(v T) {
+	if self.Count == len(self.items) {
+		self.grow()
+	}
+	self.items[int(self.Tail)&(len(self.items)-1)] = v
+	self.Tail++
+	self.Count++
+	self.Size += self.size(v)
+}
+
+// Get 取pos位置的元素, 调用者需先用IsValidPos检查位置, 无效位置返回的是被覆盖或已清空的元素
+func (self *Buf[T]) Get(pos Pos) T {
+	return self.items[int(pos)&(len(self.items)-1)]
+}
+
+// IsValidPos pos是否在[Head, Tail)之内
+func (self *Buf[T]) IsValidPos(pos Pos) bool {
+	return pos.GE(self.Head) && pos.LT(self.Tail)
+}
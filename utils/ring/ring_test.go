@@ -0,0 +1,84 @@
+package ring
+
+import (
+	"math"
+	"testing"
+)
+
+func TestBuf(t *testing.T) {
+	b := New(func(s string) int { return len(s) })
+	for i := 0; i < initialCap*2+1; i++ {
+		b.Push("ab")
+	}
+	if b.Count != initialCap*2+1 || b.Size != 2*b.Count || len(b.items) != initialCap*4 {
+		t.Fatalf("count %d size %d cap %d", b.Count, b.Size, len(b.items))
+	}
+	head := b.Head
+	if b.Pop() != "ab" || b.IsValidPos(head) || !b.IsValidPos(b.Head) || b.IsValidPos(b.Tail) {
+		t.Fatal("position validity mismatch after pop")
+	}
+	if b.Size != 2*b.Count {
+		t.Fatalf("size %d after pop", b.Size)
+	}
+}
+
+func TestBufGrowKeepsOrder(t *testing.T) {
+	b := New[int](nil)
+	// 先消费一部分使Head不在0, grow时需要按位置重新排列
+	for i := 0; i < initialCap; i++ {
+		b.Push(i)
+	}
+	for i := 0; i < initialCap/2; i++ {
+		b.Pop()
+	}
+	for i := initialCap; i < initialCap*3; i++ {
+		b.Push(i)
+	}
+	for pos := b.Head; pos.LT(b.Tail); pos++ {
+		if v := b.Get(pos); v != int(pos) {
+			t.Fatalf("pos %d got %d", pos, v)
+		}
+	}
+	if b.Size != 0 {
+		t.Fatalf("nil sizeOf should keep size 0, got %d", b.Size)
+	}
+}
+
+func TestPosWrap(t *testing.T) {
+	a, b := Pos(math.MaxInt), Pos(math.MaxInt)
+	b++ // 回绕为负数
+	if !a.LT(b) || !a.LE(b) || !b.GT(a) || !b.GE(a) || a.GE(b) || !a.LE(a) || !a.GE(a) || a.GT(a) {
+		t.Fatal("comparison should survive wraparound")
+	}
+}
+
+func TestPopEmptyPanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected panic")
+		}
+	}()
+	New[int](nil).Pop()
+}
+
+func BenchmarkBufPushPop(b *testing.B) {
+	buf := New(func(v []byte) int { return len(v) })
+	data := make([]byte, 1024)
+	for i := 0; i < b.N; i++ {
+		buf.Push(data)
+		if buf.Count > 256 {
+			buf.Pop()
+		}
+	}
+}
+
+func BenchmarkBufGet(b *testing.B) {
+	buf := New[int](nil)
+	for i := 0; i < 1024; i++ {
+		buf.Push(i)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = buf.Get(buf.Head + Pos(i&1023))
+	}
+}